@@ -0,0 +1,58 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+)
+
+// String returns the name of the action type: "update", "insert", "delete" or "condition check"
+func (t actionType) String() string {
+	switch t {
+	case updateAction:
+		return "update"
+	case insertAction:
+		return "insert"
+	case deleteAction:
+		return "delete"
+	case conditionCheckAction:
+		return "condition check"
+	}
+	return fmt.Sprintf("actionType(%d)", int(t))
+}
+
+// ActionError is the error of a queued action which failed, with the key of its item so failures can be traced to items. Errors of
+// actions are ActionErrors (use errors.As), wrapping the error of DynamoDB.
+type ActionError struct {
+	Type  string // "update", "insert", "delete" or "condition check"
+	Table string
+	Key   RawDynamoItem // Key attributes of the item (nil for inserts if the key schema of the table couldn't be described)
+	Err   error
+}
+
+func (ae *ActionError) Error() string {
+	verb := map[string]string{"update": "updating", "insert": "inserting", "delete": "deleting", "condition check": "checking"}[ae.Type]
+	if ae.Key == nil {
+		return fmt.Sprintf("error %v item on table %v: %v", verb, ae.Table, ae.Err)
+	}
+	return fmt.Sprintf("error %v item %v on table %v: %v", verb, formatItem(ae.Key), ae.Table, ae.Err)
+}
+
+// Unwrap returns the error of the action
+func (ae *ActionError) Unwrap() error {
+	return ae.Err
+}
+
+// actionError returns err, the error of action a on table, as an ActionError
+func (dd *DynamoDrifter) actionError(ctx context.Context, a *action, table string, da *DrifterAction, err error) error {
+	ae := &ActionError{Type: a.atype.String(), Table: table, Key: a.keys, Err: err}
+	if a.atype == insertAction {
+		ae.Key = nil
+		if attrs, kerr := dd.keyAttributes(ctx, da, table); kerr == nil {
+			ae.Key = RawDynamoItem{}
+			for _, k := range attrs {
+				ae.Key[k] = a.item[k]
+			}
+		}
+	}
+	return ae
+}
@@ -0,0 +1,54 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestActionErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if r.Header.Get("X-Amz-Target") == "DynamoDB_20120810.DescribeTable" {
+			w.Write([]byte(`{"Table":{"TableName":"users","KeySchema":[{"AttributeName":"Org","KeyType":"RANGE"},{"AttributeName":"ID","KeyType":"HASH"}]}}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ValidationException","message":"bad item"}`))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL)}
+	da := dd.newDrifterAction(&DynamoDrifterMigration{TableName: "users"})
+	key := RawDynamoItem{"ID": {N: aws.String("1")}, "Org": {S: aws.String("o")}}
+	item := RawDynamoItem{"ID": key["ID"], "Org": key["Org"], "Name": {S: aws.String("n")}}
+	for _, tc := range []struct {
+		a        action
+		expected string
+	}{
+		{action{atype: updateAction, keys: key, updExpr: "SET a = :a"}, `error updating item {ID: 1, Org: "o"} on table users: ValidationException: bad item`},
+		{action{atype: insertAction, item: item}, `error inserting item {ID: 1, Org: "o"} on table users: ValidationException: bad item`},
+		{action{atype: deleteAction, keys: key, tableName: "other"}, `error deleting item {ID: 1, Org: "o"} on table other: ValidationException: bad item`},
+	} {
+		err := dd.doAction(context.Background(), &tc.a, "users", da)
+		var ae *ActionError
+		if !errors.As(err, &ae) || ae.Type != tc.a.atype.String() || len(ae.Key) != 2 {
+			t.Fatalf("bad action error: %#v", err)
+		}
+		var aerr awserr.Error
+		if !errors.As(err, &aerr) || aerr.Code() != "ValidationException" {
+			t.Fatalf("action errors should wrap DynamoDB errors: %v", err)
+		}
+		if !strings.HasPrefix(err.Error(), tc.expected) {
+			t.Fatalf("bad action error: %v (expected %v)", err, tc.expected)
+		}
+	}
+	if attrs, err := dd.keyAttributes(context.Background(), da, "users"); err != nil || len(attrs) != 2 || attrs[0] != "ID" {
+		t.Fatalf("bad key attributes: %v, %v", attrs, err)
+	}
+}
@@ -0,0 +1,57 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// AdoptFunc maps an item of a homegrown migration tracking table to the applied migration it records (only Number, TableName and
+// Description are used). Items which don't record an applied migration are skipped by returning nil.
+type AdoptFunc func(item RawDynamoItem) (*DynamoDrifterMigration, error)
+
+// Adopt backfills the meta table from table, a homegrown migration tracking table, for teams moving to drift from prior tooling. Each item
+// is mapped by f and the resulting migration is recorded as applied, unless the meta table already has a record of it, so Adopt can safely
+// be run again. It returns the number of migrations recorded.
+func (dd *DynamoDrifter) Adopt(ctx context.Context, table string, f AdoptFunc) (int, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return 0, err
+	}
+	if f == nil {
+		return 0, fmt.Errorf("mapping function is required")
+	}
+	in := &dynamodb.ScanInput{
+		TableName:      aws.String(table),
+		ConsistentRead: aws.Bool(true),
+	}
+	adopted := 0
+	for {
+		req, out := dd.DynamoDB.ScanRequest(in)
+		if err := dd.send(ctx, req); err != nil {
+			return adopted, fmt.Errorf("error scanning table %v: %v", table, err)
+		}
+		for _, item := range out.Items {
+			m, err := f(item)
+			if err != nil {
+				return adopted, fmt.Errorf("error mapping item: %v", err)
+			}
+			if m == nil {
+				continue
+			}
+			rec := &DynamoDrifterMigration{Number: m.Number, TableName: m.TableName, Description: m.Description}
+			added, err := dd.addMetaRecord(ctx, rec)
+			if err != nil {
+				return adopted, err
+			}
+			if added {
+				adopted++
+			}
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return adopted, nil
+		}
+		in.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,169 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Default endpoints of the alerting notifiers
+const (
+	DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	DefaultOpsgenieURL  = "https://api.opsgenie.com/v2/alerts"
+)
+
+// defaultDedupPrefix prefixes deduplication keys of alerts unless overridden
+const defaultDedupPrefix = "dynamo-drift"
+
+// alertKey returns the deduplication key of alerts for the migration of n, so repeated failures of a migration update a single incident
+func alertKey(prefix string, n *Notification) string {
+	if prefix == "" {
+		prefix = defaultDedupPrefix
+	}
+	return prefix + "-migration-" + strconv.FormatUint(uint64(n.Number), 10)
+}
+
+// alertSummary returns a one line summary of the failed run of n
+func alertSummary(n *Notification) string {
+	kind := "Migration"
+	if n.Undo {
+		kind = "Undo of migration"
+	}
+	return fmt.Sprintf("%v %v on table %v failed with %v errors", kind, n.Number, n.TableName, len(n.Errors))
+}
+
+// alertDetails returns the details of the failed run of n attached to alerts
+func alertDetails(n *Notification) map[string]string {
+	d := map[string]string{
+		"number":              strconv.FormatUint(uint64(n.Number), 10),
+		"table":               n.TableName,
+		"description":         n.Description,
+		"undo":                strconv.FormatBool(n.Undo),
+		"owner":               n.Owner,
+		"callbacks_processed": strconv.FormatUint(uint64(n.CallbacksProcessed), 10),
+		"actions_executed":    strconv.FormatUint(uint64(n.ActionsExecuted), 10),
+		"errors":              strconv.Itoa(len(n.Errors)),
+		"duration":            n.Duration.String(),
+	}
+	if len(n.Errors) != 0 {
+		d["first_error"] = n.Errors[0].Error()
+	}
+	return d
+}
+
+// PagerDutyNotifier is a Notifier triggering a PagerDuty incident (Events API v2) when a migration fails, including runs aborted on the
+// first error (see DynamoDrifter.Run). Events are deduplicated per migration number.
+type PagerDutyNotifier struct {
+	RoutingKey  string       // Integration key of the PagerDuty service
+	Client      *http.Client // HTTP client (optional, defaults to http.DefaultClient)
+	URL         string       // Events API endpoint (optional, defaults to DefaultPagerDutyURL)
+	Severity    string       // critical, error, warning or info (optional, defaults to error)
+	DedupPrefix string       // Prefix of deduplication keys (optional, defaults to "dynamo-drift")
+
+	// ResolveOnSuccess resolves the incident of a migration when a later run of it succeeds
+	ResolveOnSuccess bool
+}
+
+// Notify implements Notifier
+func (pn *PagerDutyNotifier) Notify(ctx context.Context, n *Notification) error {
+	event := map[string]interface{}{
+		"routing_key": pn.RoutingKey,
+		"dedup_key":   alertKey(pn.DedupPrefix, n),
+	}
+	switch {
+	case n.Event == NotifyFailed:
+		severity := pn.Severity
+		if severity == "" {
+			severity = "error"
+		}
+		event["event_action"] = "trigger"
+		event["payload"] = map[string]interface{}{
+			"summary":        alertSummary(n),
+			"source":         n.Owner,
+			"severity":       severity,
+			"component":      n.TableName,
+			"class":          "dynamo-drift migration",
+			"custom_details": alertDetails(n),
+		}
+	case n.Event == NotifySucceeded && pn.ResolveOnSuccess:
+		event["event_action"] = "resolve"
+	default:
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling pagerduty event: %v", err)
+	}
+	u := pn.URL
+	if u == "" {
+		u = DefaultPagerDutyURL
+	}
+	return postJSON(ctx, pn.Client, u, body, nil)
+}
+
+// OpsgenieNotifier is a Notifier creating an Opsgenie alert (Alert API v2) when a migration fails, including runs aborted on the first
+// error (see DynamoDrifter.Run). Alerts are deduplicated per migration number by their alias.
+type OpsgenieNotifier struct {
+	APIKey      string       // API key of an Opsgenie API integration
+	Client      *http.Client // HTTP client (optional, defaults to http.DefaultClient)
+	URL         string       // Alert API endpoint (optional, defaults to DefaultOpsgenieURL, use https://api.eu.opsgenie.com/v2/alerts for EU accounts)
+	Priority    string       // P1 to P5 (optional, defaults to P2)
+	Tags        []string     // Tags of alerts (optional)
+	DedupPrefix string       // Prefix of alert aliases (optional, defaults to "dynamo-drift")
+
+	// CloseOnSuccess closes the alert of a migration when a later run of it succeeds
+	CloseOnSuccess bool
+}
+
+// Notify implements Notifier
+func (on *OpsgenieNotifier) Notify(ctx context.Context, n *Notification) error {
+	u := on.URL
+	if u == "" {
+		u = DefaultOpsgenieURL
+	}
+	alias := alertKey(on.DedupPrefix, n)
+	var alert map[string]interface{}
+	switch {
+	case n.Event == NotifyFailed:
+		priority := on.Priority
+		if priority == "" {
+			priority = "P2"
+		}
+		msg := alertSummary(n)
+		if len(msg) > 130 { // maximum length of messages
+			msg = msg[:130]
+		}
+		desc := ""
+		if len(n.Errors) != 0 {
+			desc = n.Errors[0].Error()
+		}
+		alert = map[string]interface{}{
+			"message":     msg,
+			"alias":       alias,
+			"description": desc,
+			"details":     alertDetails(n),
+			"priority":    priority,
+			"source":      n.Owner,
+			"entity":      n.TableName,
+		}
+		if len(on.Tags) != 0 {
+			alert["tags"] = on.Tags
+		}
+	case n.Event == NotifySucceeded && on.CloseOnSuccess:
+		u += "/" + url.PathEscape(alias) + "/close?identifierType=alias"
+		alert = map[string]interface{}{
+			"source": n.Owner,
+			"note":   fmt.Sprintf("Migration %v succeeded", n.Number),
+		}
+	default:
+		return nil
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("error marshaling opsgenie alert: %v", err)
+	}
+	return postJSON(ctx, on.Client, u, body, map[string]string{"Authorization": "GenieKey " + on.APIKey})
+}
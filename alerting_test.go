@@ -0,0 +1,85 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type alertRequest struct {
+	path, auth string
+	body       map[string]interface{}
+}
+
+func alertServer(t *testing.T) (*httptest.Server, *[]alertRequest) {
+	var reqs []alertRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ar := alertRequest{path: r.URL.RequestURI(), auth: r.Header.Get("Authorization")}
+		if err := json.NewDecoder(r.Body).Decode(&ar.body); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		reqs = append(reqs, ar)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return srv, &reqs
+}
+
+func TestPagerDutyNotifier(t *testing.T) {
+	srv, reqs := alertServer(t)
+	defer srv.Close()
+	pn := &PagerDutyNotifier{RoutingKey: "key", URL: srv.URL, ResolveOnSuccess: true}
+	n := &Notification{Event: NotifyStarted, Number: 7, TableName: "users", Owner: "host:1"}
+	if err := pn.Notify(context.Background(), n); err != nil || len(*reqs) != 0 {
+		t.Fatalf("start should not trigger an event: %v, %v", err, *reqs)
+	}
+	n.Event = NotifyFailed
+	n.Errors = []error{fmt.Errorf("foo")}
+	if err := pn.Notify(context.Background(), n); err != nil {
+		t.Fatalf("error notifying: %v", err)
+	}
+	n.Event = NotifySucceeded
+	if err := pn.Notify(context.Background(), n); err != nil {
+		t.Fatalf("error notifying: %v", err)
+	}
+	if len(*reqs) != 2 {
+		t.Fatalf("expected two events: %v", *reqs)
+	}
+	trigger, resolve := (*reqs)[0].body, (*reqs)[1].body
+	payload, _ := trigger["payload"].(map[string]interface{})
+	details, _ := payload["custom_details"].(map[string]interface{})
+	if trigger["event_action"] != "trigger" || trigger["dedup_key"] != "dynamo-drift-migration-7" || trigger["routing_key"] != "key" ||
+		payload["severity"] != "error" || payload["source"] != "host:1" || details["first_error"] != "foo" {
+		t.Fatalf("bad trigger event: %v", trigger)
+	}
+	if resolve["event_action"] != "resolve" || resolve["dedup_key"] != trigger["dedup_key"] {
+		t.Fatalf("bad resolve event: %v", resolve)
+	}
+}
+
+func TestOpsgenieNotifier(t *testing.T) {
+	srv, reqs := alertServer(t)
+	defer srv.Close()
+	on := &OpsgenieNotifier{APIKey: "key", URL: srv.URL + "/v2/alerts", DedupPrefix: "svc", Tags: []string{"drift"}, CloseOnSuccess: true}
+	n := &Notification{Event: NotifyFailed, Number: 7, TableName: "users", Errors: []error{fmt.Errorf("foo")}}
+	if err := on.Notify(context.Background(), n); err != nil {
+		t.Fatalf("error notifying: %v", err)
+	}
+	n.Event = NotifySucceeded
+	if err := on.Notify(context.Background(), n); err != nil {
+		t.Fatalf("error notifying: %v", err)
+	}
+	if len(*reqs) != 2 {
+		t.Fatalf("expected two requests: %v", *reqs)
+	}
+	create, cls := (*reqs)[0], (*reqs)[1]
+	if create.path != "/v2/alerts" || create.auth != "GenieKey key" || create.body["alias"] != "svc-migration-7" ||
+		create.body["priority"] != "P2" || create.body["description"] != "foo" {
+		t.Fatalf("bad alert: %+v", create)
+	}
+	if cls.path != "/v2/alerts/svc-migration-7/close?identifierType=alias" || cls.auth != "GenieKey key" {
+		t.Fatalf("bad close request: %+v", cls)
+	}
+}
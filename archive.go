@@ -0,0 +1,109 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Archive is a destination of archived meta table records (see Archive): each archive is written as a HistoryJSON object with key
+// Prefix followed by "migrations-<first number>-<last number>.json"
+type S3Archive struct {
+	S3     *s3.S3
+	Bucket string
+	Prefix string // ex: "drift/archive/"
+}
+
+// ArchiveSummary is the tombstone of an archive, left in the meta table in place of the archived records (see Archives)
+type ArchiveSummary struct {
+	Location string    `dynamodbav:"Location" json:"location"` // Archive table or S3 URI of the records
+	First    uint      `dynamodbav:"First" json:"first"`       // Lowest archived migration number
+	Last     uint      `dynamodbav:"Last" json:"last"`         // Highest archived migration number
+	Count    uint      `dynamodbav:"Count" json:"count"`
+	Archived time.Time `dynamodbav:"Archived" json:"archived"`
+}
+
+// Archive moves the records of applied migrations numbered below beforeNumber out of the meta table, keeping Applied fast without losing
+// the historical record: the records are copied to ArchiveTable (or to ArchiveS3 if ArchiveTable isn't set), then a tombstone summary
+// is recorded in the meta table (see Archives) and the records are deleted. Archived migrations remain applied (see Pruned).
+// It returns the summary, or nil if there was nothing to archive.
+func (dd *DynamoDrifter) Archive(ctx context.Context, beforeNumber uint) (*ArchiveSummary, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	if dd.ArchiveTable == "" && dd.ArchiveS3 == nil {
+		return nil, fmt.Errorf("ArchiveTable or ArchiveS3 is required")
+	}
+	records, err := dd.metaRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting migration history: %v", err)
+	}
+	ms := []DynamoDrifterMigration{}
+	for _, m := range records {
+		if m.Number < beforeNumber && !m.InProgress {
+			ms = append(ms, m)
+		}
+	}
+	if len(ms) == 0 {
+		return nil, nil
+	}
+	summary := &ArchiveSummary{First: ms[0].Number, Last: ms[len(ms)-1].Number, Count: uint(len(ms)), Archived: time.Now().UTC()}
+	if dd.ArchiveTable != "" {
+		summary.Location = dd.ArchiveTable
+		for i := range ms {
+			item, err := dynamodbattribute.MarshalMap(&ms[i])
+			if err != nil {
+				return nil, fmt.Errorf("error marshaling migration %v: %v", ms[i].Number, err)
+			}
+			req, _ := dd.DynamoDB.PutItemRequest(&dynamodb.PutItemInput{TableName: &dd.ArchiveTable, Item: item})
+			if err := dd.send(ctx, req); err != nil {
+				return nil, fmt.Errorf("error archiving migration %v: %v", ms[i].Number, err)
+			}
+		}
+	} else {
+		b, err := json.Marshal(historyFile{Version: HistoryVersion, Migrations: ms})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding archived migrations: %v", err)
+		}
+		key := fmt.Sprintf("%vmigrations-%v-%v.json", dd.ArchiveS3.Prefix, summary.First, summary.Last)
+		summary.Location = fmt.Sprintf("s3://%v/%v", dd.ArchiveS3.Bucket, key)
+		req, _ := dd.ArchiveS3.S3.PutObjectRequest(&s3.PutObjectInput{
+			Bucket:      aws.String(dd.ArchiveS3.Bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(b),
+			ContentType: aws.String("application/json"),
+		})
+		if err := sendContext(ctx, req); err != nil {
+			return nil, fmt.Errorf("error uploading archived migrations: %v", err)
+		}
+	}
+	if err := dd.removeMetaRecords(ctx, ms, summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// Archives returns the summaries of archives (see Archive), oldest first
+func (dd *DynamoDrifter) Archives(ctx context.Context) ([]ArchiveSummary, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	req, out := dd.DynamoDB.GetItemRequest(&dynamodb.GetItemInput{TableName: &dd.MetaTableName, Key: prunedKey(), ConsistentRead: aws.Bool(true)})
+	if err := dd.send(ctx, req); err != nil {
+		return nil, fmt.Errorf("error getting archives: %v", err)
+	}
+	summaries := []ArchiveSummary{}
+	if av := out.Item["Archives"]; av != nil {
+		if err := dynamodbattribute.Unmarshal(av, &summaries); err != nil {
+			return nil, fmt.Errorf("error unmarshaling archives: %v", err)
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,102 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// RunOptions are the options of a run, see DynamoDrifter.Run
+type RunOptions struct {
+	Concurrency      uint
+	FailOnFirstError bool
+}
+
+// MigrationHandle supervises a migration started by RunAsync
+type MigrationHandle struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	mtx      sync.Mutex
+	progress MigrationProgress
+	errs     []error
+}
+
+// RunAsync starts running migration (as Run does) in the background and returns a handle to supervise it
+func (dd *DynamoDrifter) RunAsync(ctx context.Context, migration *DynamoDrifterMigration, opts RunOptions) *MigrationHandle {
+	ctx, cncl := context.WithCancel(ctx)
+	h := &MigrationHandle{
+		cancel: cncl,
+		done:   make(chan struct{}),
+	}
+	pc := make(chan *MigrationProgress, 1000)
+	tracked := make(chan struct{})
+	go func() {
+		defer close(tracked)
+		for mp := range pc {
+			h.observe(mp)
+		}
+	}()
+	go func() {
+		defer close(h.done)
+		defer cncl()
+		errs := dd.Run(ctx, migration, opts.Concurrency, opts.FailOnFirstError, pc) // closes pc
+		<-tracked
+		h.mtx.Lock()
+		h.errs = errs
+		h.mtx.Unlock()
+	}()
+	return h
+}
+
+func (h *MigrationHandle) observe(mp *MigrationProgress) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if mp.CallbacksProcessed != 0 {
+		h.progress.CallbacksProcessed = mp.CallbacksProcessed
+	}
+	if mp.ActionsExecuted != 0 {
+		h.progress.ActionsExecuted = mp.ActionsExecuted
+	}
+	h.progress.CallbackErrors = append(h.progress.CallbackErrors, mp.CallbackErrors...)
+	h.progress.ActionErrors = append(h.progress.ActionErrors, mp.ActionErrors...)
+}
+
+// Wait blocks until the migration finishes and returns its errors (as returned by Run)
+func (h *MigrationHandle) Wait() []error {
+	<-h.done
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.errs
+}
+
+// Done returns a channel closed when the migration finishes
+func (h *MigrationHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Cancel cancels the migration. Use Wait to wait until it has stopped.
+func (h *MigrationHandle) Cancel() {
+	h.cancel()
+}
+
+// Err returns nil while the migration is running or if it succeeded, otherwise its errors joined
+func (h *MigrationHandle) Err() error {
+	select {
+	case <-h.done:
+	default:
+		return nil
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return errors.Join(h.errs...)
+}
+
+// Progress returns a snapshot of the progress of the migration (the latest counts and all errors reported so far)
+func (h *MigrationHandle) Progress() MigrationProgress {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	p := h.progress
+	p.CallbackErrors = append([]error{}, h.progress.CallbackErrors...)
+	p.ActionErrors = append([]error{}, h.progress.ActionErrors...)
+	return p
+}
@@ -0,0 +1,26 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestMigrationHandle(t *testing.T) {
+	dd := &DynamoDrifter{}
+	h := dd.RunAsync(context.Background(), &DynamoDrifterMigration{}, RunOptions{Concurrency: 1})
+	errs := h.Wait()
+	if len(errs) != 1 || h.Err() == nil {
+		t.Fatalf("run without a client should fail: %v, %v", errs, h.Err())
+	}
+	h = &MigrationHandle{done: make(chan struct{})}
+	h.observe(&MigrationProgress{CallbacksProcessed: 10, CallbackErrors: []error{fmt.Errorf("foo")}})
+	h.observe(&MigrationProgress{ActionsExecuted: 3})
+	p := h.Progress()
+	if p.CallbacksProcessed != 10 || p.ActionsExecuted != 3 || len(p.CallbackErrors) != 1 {
+		t.Fatalf("bad progress: %+v", p)
+	}
+	if h.Err() != nil {
+		t.Fatalf("running migration should not have an error")
+	}
+}
@@ -0,0 +1,75 @@
+package drift
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes how long to wait before retrying a failed call
+type Backoff interface {
+	// Delay returns the wait before retry number attempt (the first retry is attempt 1)
+	Delay(attempt uint) time.Duration
+}
+
+// BackoffFunc is an adapter to allow the use of ordinary functions as a Backoff
+type BackoffFunc func(attempt uint) time.Duration
+
+// Delay calls f(attempt)
+func (f BackoffFunc) Delay(attempt uint) time.Duration {
+	return f(attempt)
+}
+
+// Jitter controls how randomness is applied to backoff delays
+type Jitter int
+
+const (
+	// NoJitter uses the computed delay unmodified
+	NoJitter Jitter = iota
+	// FullJitter uses a random delay between zero and the computed delay
+	FullJitter
+	// EqualJitter uses half of the computed delay plus a random delay between zero and the other half
+	EqualJitter
+)
+
+// ExponentialBackoff is a Backoff that doubles the delay (starting from Base) for every attempt, up to Cap
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Cap    time.Duration // Maximum delay (optional)
+	Jitter Jitter
+}
+
+// Delay returns the delay for attempt
+func (eb ExponentialBackoff) Delay(attempt uint) time.Duration {
+	if attempt == 0 {
+		attempt = 1
+	}
+	d := eb.Base
+	for i := uint(1); i < attempt; i++ {
+		d *= 2
+		if eb.Cap != 0 && d >= eb.Cap || d <= 0 {
+			d = eb.Cap
+			break
+		}
+	}
+	if eb.Cap != 0 && d > eb.Cap {
+		d = eb.Cap
+	}
+	if d <= 0 {
+		return 0
+	}
+	switch eb.Jitter {
+	case FullJitter:
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	case EqualJitter:
+		return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	default:
+		return d
+	}
+}
+
+// DefaultBackoff is the Backoff used by RetryPolicy if none is specified
+var DefaultBackoff Backoff = ExponentialBackoff{
+	Base:   100 * time.Millisecond,
+	Cap:    10 * time.Second,
+	Jitter: FullJitter,
+}
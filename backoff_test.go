@@ -0,0 +1,32 @@
+package drift
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	eb := ExponentialBackoff{Base: 10 * time.Millisecond, Cap: 50 * time.Millisecond}
+	expected := []time.Duration{10, 20, 40, 50, 50}
+	for i, e := range expected {
+		if d := eb.Delay(uint(i + 1)); d != e*time.Millisecond {
+			t.Fatalf("bad delay for attempt %v: %v", i+1, d)
+		}
+	}
+	if d := eb.Delay(1000); d != 50*time.Millisecond {
+		t.Fatalf("delay should be capped: %v", d)
+	}
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	full := ExponentialBackoff{Base: 100 * time.Millisecond, Jitter: FullJitter}
+	equal := ExponentialBackoff{Base: 100 * time.Millisecond, Jitter: EqualJitter}
+	for i := 0; i < 100; i++ {
+		if d := full.Delay(1); d < 0 || d > 100*time.Millisecond {
+			t.Fatalf("full jitter out of range: %v", d)
+		}
+		if d := equal.Delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("equal jitter out of range: %v", d)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// batchable returns whether action a can be part of a BatchWriteItem request, which has no conditions nor updates (nor transactions)
+func batchable(a *action) bool {
+	return a.txn == 0 && a.condExpr == "" && (a.atype == deleteAction || a.atype == insertAction && !a.noOverwrite)
+}
+
+// batchEnd returns the end of the batch of actions starting at i, see DynamoDrifterMigration.BatchWrites: the following batchable actions,
+// up to batchWriteLimit of them on distinct items. Actions which can't be batched are on their own.
+func (dd *DynamoDrifter) batchEnd(ctx context.Context, actions []action, i int, tn string, da *DrifterAction) int {
+	items := map[string]bool{}
+	j := i
+	for ; j < len(actions) && j-i < batchWriteLimit && batchable(&actions[j]); j++ {
+		a := &actions[j]
+		table, err := da.actionTable(a, tn)
+		if err != nil {
+			break
+		}
+		key := a.keys
+		if a.atype == insertAction {
+			attrs, err := dd.keyAttributes(ctx, da, table)
+			if err != nil {
+				break
+			}
+			key = RawDynamoItem{}
+			for _, k := range attrs {
+				key[k] = a.item[k]
+			}
+		}
+		id := table + formatItem(key)
+		if items[id] {
+			break // a batch can't write an item twice
+		}
+		items[id] = true
+	}
+	if j == i {
+		return i + 1
+	}
+	return j
+}
+
+// doBatch applies actions (inserts and deletes of distinct items) as one BatchWriteItem request, retrying unprocessed items as throttled
+// requests
+func (dd *DynamoDrifter) doBatch(ctx context.Context, actions []action, tn string, da *DrifterAction) error {
+	started := time.Now()
+	err := dd.batchWrite(ctx, actions, tn, da)
+	for i := range actions {
+		dd.logAction(&actions[i], tn, time.Since(started), err)
+	}
+	return err
+}
+
+func (dd *DynamoDrifter) batchWrite(ctx context.Context, actions []action, tn string, da *DrifterAction) error {
+	pending := map[string][]*dynamodb.WriteRequest{}
+	for i := range actions {
+		a := &actions[i]
+		table, err := da.actionTable(a, tn)
+		if err != nil {
+			return err
+		}
+		switch a.atype {
+		case insertAction:
+			pending[table] = append(pending[table], &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: a.item}})
+		case deleteAction:
+			pending[table] = append(pending[table], &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: a.keys}})
+		default:
+			return fmt.Errorf("%v actions can't be batched", a.atype)
+		}
+	}
+	err := da.retry.do(ctx, func() error {
+		for table := range pending {
+			if err := da.pace.wait(ctx, table, true); err != nil {
+				return err
+			}
+		}
+		req, out := dd.DynamoDB.BatchWriteItemRequest(&dynamodb.BatchWriteItemInput{
+			RequestItems:           pending,
+			ReturnConsumedCapacity: da.pace.returnConsumedCapacity(),
+		})
+		err := dd.send(ctx, req)
+		for _, cc := range out.ConsumedCapacity {
+			da.pace.consumed(cc, true)
+		}
+		if err != nil {
+			return err
+		}
+		unprocessed := 0
+		for _, wrs := range out.UnprocessedItems {
+			unprocessed += len(wrs)
+		}
+		if unprocessed > 0 {
+			pending = out.UnprocessedItems
+			return awserr.New("ProvisionedThroughputExceededException", fmt.Sprintf("%v items unprocessed", unprocessed), nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error applying batch of %v actions: %w", len(actions), dd.batchErrors(ctx, actions, tn, da, pending, err))
+	}
+	return nil
+}
+
+// batchErrors returns err, the error of the last BatchWriteItem request of actions, as the ActionErrors of the actions still pending
+func (dd *DynamoDrifter) batchErrors(ctx context.Context, actions []action, tn string, da *DrifterAction, pending map[string][]*dynamodb.WriteRequest, err error) error {
+	items := map[string]bool{}
+	for table, wrs := range pending {
+		for _, wr := range wrs {
+			if wr.PutRequest != nil {
+				items[table+formatItem(wr.PutRequest.Item)] = true
+			} else if wr.DeleteRequest != nil {
+				items[table+formatItem(wr.DeleteRequest.Key)] = true
+			}
+		}
+	}
+	errs := []error{}
+	for i := range actions {
+		a := &actions[i]
+		table, _ := da.actionTable(a, tn)
+		item := a.keys
+		if a.atype == insertAction {
+			item = a.item
+		}
+		if items[table+formatItem(item)] {
+			errs = append(errs, dd.actionError(ctx, a, table, da, err))
+		}
+	}
+	if len(errs) == 0 {
+		return err
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,83 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestBatchWrites(t *testing.T) {
+	var mtx sync.Mutex
+	requests := map[string][]int{} // number of items of the requests of each operation
+	unprocessed, failing := true, false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		mtx.Lock()
+		defer mtx.Unlock()
+		switch op {
+		case "DescribeTable":
+			w.Write([]byte(`{"Table":{"TableName":"foo","KeySchema":[{"AttributeName":"ID","KeyType":"HASH"}],"ProvisionedThroughput":{"ReadCapacityUnits":0,"WriteCapacityUnits":0}}}`))
+			return
+		case "BatchWriteItem":
+			in := dynamodb.BatchWriteItemInput{}
+			json.Unmarshal(b, &in)
+			requests[op] = append(requests[op], len(in.RequestItems["foo"]))
+			if unprocessed {
+				unprocessed = failing
+				out, _ := json.Marshal(&dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]*dynamodb.WriteRequest{"foo": in.RequestItems["foo"][:2]}})
+				w.Write(out)
+				return
+			}
+		default:
+			requests[op] = append(requests[op], 1)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL)}
+	m := &DynamoDrifterMigration{TableName: "foo", BatchWrites: true, Callback: func(RawDynamoItem, *DrifterAction) error { return nil }}
+	da := dd.newDrifterAction(m)
+	key := func(i int) RawDynamoItem { return RawDynamoItem{"ID": {S: aws.String(fmt.Sprint(i))}} }
+	for i := 0; i < 30; i++ {
+		da.Delete(key(i), "")
+	}
+	da.Insert(RawDynamoItem{"ID": {S: aws.String("29")}, "Foo": {S: aws.String("v")}}, "") // same item as the last delete
+	da.UpdateItem(key(1), "").Set("Foo", "v").Queue()
+	da.Insert(key(31), "") // alone, as a single action
+	if errs := dd.executeActions(context.Background(), m, da, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors executing actions: %v", errs)
+	}
+	if fmt.Sprint(requests["BatchWriteItem"]) != "[25 2 5]" || len(requests["UpdateItem"]) != 1 || len(requests["PutItem"]) != 2 {
+		t.Fatalf("bad requests: %v", requests)
+	}
+	// a batch whose items stay unprocessed fails with the errors of these items
+	unprocessed, failing = true, true
+	dd.RetryPolicy = &RetryPolicy{Budget: RetryBudget{MaxAttempts: 2}}
+	da = dd.newDrifterAction(m)
+	for i := 40; i < 45; i++ {
+		da.Delete(key(i), "")
+	}
+	errs := dd.executeActions(context.Background(), m, da, 1, false, nil)
+	var ae *ActionError
+	if len(errs) != 1 || !errors.As(errs[0], &ae) || ae.Table != "foo" || ae.Type != "delete" || aws.StringValue(ae.Key["ID"].S) != "40" {
+		t.Fatalf("bad batch error: %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), `item {ID: "41"} on table foo`) || strings.Contains(errs[0].Error(), `{ID: "42"}`) {
+		t.Fatalf("the batch error should only wrap the errors of unprocessed items: %v", errs[0])
+	}
+	if err := validateCallbacks(&DynamoDrifterMigration{ItemTransactions: true, BatchWrites: true, Callback: m.Callback}); err == nil {
+		t.Fatalf("BatchWrites should not be combined with ItemTransactions")
+	}
+}
@@ -0,0 +1,548 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+)
+
+// ErrReplicationLag is returned (wrapped) by BlueGreen.Cutover when the target lags too far behind the source
+var ErrReplicationLag = errors.New("replication lag too high")
+
+// ErrSyncFailed is returned (wrapped) by BlueGreen.Cutover when stream records failed to be applied to the target, which then differs
+// from the source
+var ErrSyncFailed = errors.New("sync failed")
+
+// ErrVerificationFailed is returned (wrapped) by BlueGreen.Verify when sampled items differ between the source and the target
+var ErrVerificationFailed = errors.New("verification failed")
+
+// Steps of blue/green migrations, recorded in the StepProgress of their meta table record
+const (
+	BlueGreenCreate   = "create"
+	BlueGreenBackfill = "backfill"
+	BlueGreenSync     = "sync"
+	BlueGreenVerify   = "verify"
+	BlueGreenCutover  = "cutover"
+)
+
+// streamTimeMargin is subtracted from the start of the backfill when skipping older stream records, since the creation times of stream
+// records are approximate
+const streamTimeMargin = 2 * time.Minute
+
+// BlueGreen migrates a table to a new table (ex: to change its key schema) without downtime, recorded as a single composite migration:
+//
+//  1. Start creates the target table from Schema, copies the items of the source table into it (transformed by Transform) and keeps it
+//     in sync by consuming the DynamoDB stream of the source, until Cutover or Abort
+//  2. Status reports the progress and replication lag, and Verify compares a sample of items of both tables
+//  3. once writes are switched to the target, Cutover stops the sync and records the migration as applied, or Abort stops it and drops
+//     the target
+//
+// The stream of the source must be enabled with new and old images before Start, and the backfill must complete within the retention of
+// the stream (24 hours): the sync then replays the changes made since the backfill started. Its progress is recorded in the meta table
+// record of the migration (see StepProgress), so an interrupted Start resumes after its completed steps.
+type BlueGreen struct {
+	Drifter     *DynamoDrifter
+	Streams     *dynamodbstreams.DynamoDBStreams
+	Number      uint   // Number of the composite migration
+	Description string // Description of the composite migration
+	Source      string // Table migrated ("blue")
+	StreamARN   string // Stream of Source (optional, defaults to its latest stream)
+
+	Schema    *dynamodb.CreateTableInput // Schema of the target table ("green"), including its name
+	Transform Transformer                // Transforms items of the source into items of the target (optional, may not return actions)
+	Segments  uint                       // Number of parallel scan segments of the backfill (optional, defaults to 1)
+
+	PollInterval time.Duration // See StreamConsumer.PollInterval
+
+	mtx      sync.Mutex
+	sr       *stepRecorder
+	status   BlueGreenStatus
+	stop     context.CancelFunc
+	stopped  chan struct{}
+	polls    map[string]shardPoll // last read of the open shards of the stream whose records were applied
+	lastPoll time.Time            // last read of any shard whose records were applied (or start of the sync)
+}
+
+// shardPoll is a read of a shard of the stream of the source whose records were applied to the target
+type shardPoll struct {
+	at     time.Time     // time of the read
+	behind time.Duration // delay of the last record of the read at that time
+}
+
+// BlueGreenStatus is the status of a blue/green migration
+type BlueGreenStatus struct {
+	Backfilled    uint           `json:"backfilled"`      // Items copied by the backfill
+	Synced        uint           `json:"synced"`          // Stream records applied to the target
+	LastRecord    time.Time      `json:"last_record"`     // Approximate creation time of the last applied record
+	Lag           time.Duration  `json:"-"`               // Time the target is behind the source, from the last read of each shard of the stream which was applied
+	SyncErrors    uint           `json:"sync_errors"`     // Records which failed to be applied
+	LastSyncError string         `json:"last_sync_error"` // Last error of the sync
+	Syncing       bool           `json:"syncing"`
+	Steps         []StepProgress `json:"steps"`
+}
+
+// MarshalJSON implements json.Marshaler, encoding the lag in fractional seconds
+func (s BlueGreenStatus) MarshalJSON() ([]byte, error) {
+	type status BlueGreenStatus // without methods
+	return json.Marshal(struct {
+		status
+		Lag float64 `json:"lag_seconds"`
+	}{status(s), s.Lag.Seconds()})
+}
+
+// VerifyReport is the result of BlueGreen.Verify
+type VerifyReport struct {
+	Sampled    uint            `json:"sampled"`    // Items of the source compared
+	Missing    uint            `json:"missing"`    // Items missing from the target
+	Mismatched uint            `json:"mismatched"` // Items which differ in the target
+	Keys       []RawDynamoItem `json:"-"`          // Keys of the first missing or mismatched items
+}
+
+// maxVerifyKeys is the maximum number of keys of a VerifyReport
+const maxVerifyKeys = 10
+
+// Status returns the status of the migration
+func (bg *BlueGreen) Status() BlueGreenStatus {
+	bg.mtx.Lock()
+	defer bg.mtx.Unlock()
+	s := bg.status
+	s.Lag = bg.lag(time.Now())
+	if bg.sr != nil {
+		bg.sr.Lock()
+		s.Steps = append([]StepProgress{}, bg.sr.record.StepProgress...)
+		bg.sr.Unlock()
+	}
+	return s
+}
+
+// lag returns the replication lag at now while syncing: the time since the least recent read of an open shard whose records were
+// applied, plus the delay of its last record at that time. Lag keeps growing when the sync stalls (ex: the stream can't be read).
+// bg.mtx must be held.
+func (bg *BlueGreen) lag(now time.Time) time.Duration {
+	if !bg.status.Syncing {
+		return 0
+	}
+	if len(bg.polls) == 0 {
+		return now.Sub(bg.lastPoll)
+	}
+	var lag time.Duration
+	for _, p := range bg.polls {
+		if l := now.Sub(p.at) + p.behind; l > lag {
+			lag = l
+		}
+	}
+	return lag
+}
+
+// polled records a read of shard at whose records were applied, see lag
+func (bg *BlueGreen) polled(shard string, at time.Time, records []*dynamodbstreams.Record, closed bool) {
+	p := shardPoll{at: at}
+	if n := len(records); n != 0 && records[n-1].Dynamodb != nil {
+		if d := at.Sub(aws.TimeValue(records[n-1].Dynamodb.ApproximateCreationDateTime)); d > 0 {
+			p.behind = d
+		}
+	}
+	bg.mtx.Lock()
+	defer bg.mtx.Unlock()
+	if at.After(bg.lastPoll) {
+		bg.lastPoll = at
+	}
+	if closed {
+		delete(bg.polls, shard) // its child shards are read next
+		return
+	}
+	bg.polls[shard] = p
+}
+
+func (bg *BlueGreen) validate() error {
+	if bg.Drifter == nil || bg.Drifter.DynamoDB == nil {
+		return fmt.Errorf("drifter with a DynamoDB client is required")
+	}
+	if err := checkClient(bg.Drifter.DynamoDB, "CreateTableRequest", "DeleteTableRequest"); err != nil {
+		return err
+	}
+	if bg.Streams == nil {
+		return fmt.Errorf("Streams is required")
+	}
+	if bg.Source == "" || bg.Schema == nil || aws.StringValue(bg.Schema.TableName) == "" {
+		return fmt.Errorf("Source and Schema (with a table name) are required")
+	}
+	if aws.StringValue(bg.Schema.TableName) == bg.Source {
+		return fmt.Errorf("target table must differ from the source")
+	}
+	return nil
+}
+
+// transform transforms an item of the source into an item of the target, returning nil if it isn't copied
+func (bg *BlueGreen) transform(item RawDynamoItem) (RawDynamoItem, error) {
+	if bg.Transform == nil {
+		return item, nil
+	}
+	out, actions, err := bg.Transform.Transform(item.Clone())
+	if err != nil {
+		return nil, fmt.Errorf("error transforming item: %w", err)
+	}
+	if len(actions) != 0 {
+		return nil, fmt.Errorf("transformers of blue/green migrations may not return actions")
+	}
+	return out, nil
+}
+
+// targetKey returns the key attributes of item in the target
+func (bg *BlueGreen) targetKey(item RawDynamoItem) RawDynamoItem {
+	key := RawDynamoItem{}
+	for _, ks := range bg.Schema.KeySchema {
+		name := aws.StringValue(ks.AttributeName)
+		key[name] = item[name]
+	}
+	return key
+}
+
+// step runs f as step name unless it was completed by a previous run, recording its progress
+func (bg *BlueGreen) step(name string, f func() error) error {
+	if bg.sr.completed(name) {
+		bg.Drifter.logf(VerbosityVerbose, "step %v of migration %v already completed", name, bg.Number)
+		return nil
+	}
+	bg.sr.update(name, func(p *StepProgress) {
+		*p = StepProgress{Name: name, Status: StepRunning, Started: time.Now().UTC()}
+	})
+	if err := bg.sr.save(); err != nil {
+		return fmt.Errorf("error recording progress of step %v: %w", name, err)
+	}
+	err := f()
+	bg.sr.update(name, func(p *StepProgress) {
+		p.Status = StepCompleted
+		if err != nil {
+			p.Status = StepFailed
+			p.Error = err.Error()
+		}
+	})
+	if serr := bg.sr.save(); serr != nil && err == nil {
+		err = fmt.Errorf("error recording progress of step %v: %w", name, serr)
+	}
+	if err != nil {
+		return fmt.Errorf("step %v: %w", name, err)
+	}
+	return nil
+}
+
+// Start creates the target table, backfills it and starts syncing it with the source in the background (until Cutover or Abort).
+// It returns once the backfill is complete.
+func (bg *BlueGreen) Start(ctx context.Context) error {
+	if err := bg.validate(); err != nil {
+		return err
+	}
+	bg.mtx.Lock()
+	if bg.stop != nil {
+		bg.mtx.Unlock()
+		return fmt.Errorf("migration %v is already syncing", bg.Number)
+	}
+	bg.mtx.Unlock()
+	dd := bg.Drifter
+	prev, err := dd.getMetaItem(bg.Number)
+	if err != nil {
+		return err
+	}
+	if prev != nil && !prev.InProgress {
+		return fmt.Errorf("migration %v is already applied", bg.Number)
+	}
+	sr := &stepRecorder{dd: dd, record: DynamoDrifterMigration{Number: bg.Number, TableName: bg.Source, Description: bg.Description, InProgress: true}}
+	if prev != nil {
+		sr.record.StepProgress = prev.StepProgress
+	}
+	bg.mtx.Lock()
+	bg.sr = sr
+	bg.mtx.Unlock()
+	streamARN := bg.StreamARN
+	if streamARN == "" {
+		td, _, err := dd.describeTable(ctx, bg.Source)
+		if err != nil {
+			return err
+		}
+		if streamARN = aws.StringValue(td.LatestStreamArn); streamARN == "" {
+			return fmt.Errorf("table %v has no stream", bg.Source)
+		}
+	}
+	target := aws.StringValue(bg.Schema.TableName)
+	err = bg.step(BlueGreenCreate, func() error {
+		req, _ := dd.DynamoDB.CreateTableRequest(bg.Schema)
+		if err := dd.send(ctx, req); err != nil {
+			return fmt.Errorf("error creating table %v: %v", target, err)
+		}
+		return dd.waitForTable(ctx, target)
+	})
+	if err != nil {
+		return err
+	}
+	var since time.Time
+	for _, p := range sr.record.StepProgress {
+		if p.Name == BlueGreenBackfill {
+			since = p.Started
+		}
+	}
+	err = bg.step(BlueGreenBackfill, func() error {
+		since = time.Now().UTC()
+		_, err := dd.copyTable(ctx, bg.Source, target, CloneOptions{Segments: bg.Segments, Progress: func(copied uint) {
+			bg.mtx.Lock()
+			bg.status.Backfilled = copied
+			bg.mtx.Unlock()
+			sr.update(BlueGreenBackfill, func(p *StepProgress) { p.CallbacksProcessed = copied })
+		}}, bg.transform)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bg.sync(streamARN, target, since.Add(-streamTimeMargin))
+	return nil
+}
+
+// sync starts consuming the stream of the source in the background, applying the records created after since to target
+func (bg *BlueGreen) sync(streamARN, target string, since time.Time) {
+	dd := bg.Drifter
+	ctx, cncl := context.WithCancel(context.Background())
+	bg.mtx.Lock()
+	bg.stop, bg.stopped = cncl, make(chan struct{})
+	bg.status.Syncing = true
+	bg.polls, bg.lastPoll = map[string]shardPoll{}, time.Now()
+	stopped := bg.stopped
+	bg.mtx.Unlock()
+	bg.sr.update(BlueGreenSync, func(p *StepProgress) {
+		*p = StepProgress{Name: BlueGreenSync, Status: StepRunning, Started: time.Now().UTC()}
+	})
+	bg.sr.save() // best effort, the sync runs until Cutover or Abort
+	sc := &StreamConsumer{
+		Drifter:       dd,
+		Streams:       bg.Streams,
+		StreamARN:     streamARN,
+		StartAtOldest: true,
+		PollInterval:  bg.PollInterval,
+		Apply: func(ctx context.Context, records []*dynamodbstreams.Record) []error {
+			errs := bg.applyRecords(ctx, target, since, records)
+			bg.mtx.Lock()
+			bg.status.SyncErrors += uint(len(errs))
+			bg.mtx.Unlock()
+			return errs
+		},
+		polled: bg.polled,
+	}
+	go func() {
+		defer close(stopped)
+		sc.Run(ctx, func(err error) {
+			bg.mtx.Lock()
+			defer bg.mtx.Unlock()
+			bg.status.LastSyncError = err.Error() // including errors reading the stream, which are retried
+		})
+	}()
+}
+
+// applyRecords applies the changes of records created after since to target, in order. Writes are retried (see
+// DynamoDrifter.RetryPolicy), since records which fail are skipped.
+func (bg *BlueGreen) applyRecords(ctx context.Context, target string, since time.Time, records []*dynamodbstreams.Record) []error {
+	dd := bg.Drifter
+	errs := []error{}
+	write := func(f func() *request.Request) error {
+		return newRetrier(dd.RetryPolicy).do(ctx, func() error {
+			return dd.send(ctx, f())
+		})
+	}
+	for _, r := range records {
+		if r.Dynamodb == nil || aws.TimeValue(r.Dynamodb.ApproximateCreationDateTime).Before(since) {
+			continue
+		}
+		var err error
+		switch aws.StringValue(r.EventName) {
+		case dynamodbstreams.OperationTypeInsert, dynamodbstreams.OperationTypeModify:
+			var item RawDynamoItem
+			if item, err = bg.transform(r.Dynamodb.NewImage); err == nil && item != nil {
+				err = write(func() *request.Request {
+					req, _ := dd.DynamoDB.PutItemRequest(&dynamodb.PutItemInput{TableName: aws.String(target), Item: item})
+					return req
+				})
+			}
+		case dynamodbstreams.OperationTypeRemove:
+			old := RawDynamoItem(r.Dynamodb.Keys)
+			if r.Dynamodb.OldImage != nil {
+				old = r.Dynamodb.OldImage
+			}
+			var item RawDynamoItem
+			if item, err = bg.transform(old); err == nil && item != nil {
+				err = write(func() *request.Request {
+					req, _ := dd.DynamoDB.DeleteItemRequest(&dynamodb.DeleteItemInput{TableName: aws.String(target), Key: bg.targetKey(item)})
+					return req
+				})
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error applying record %v: %v", aws.StringValue(r.EventID), err))
+			continue
+		}
+		bg.mtx.Lock()
+		bg.status.Synced++
+		bg.status.LastRecord = aws.TimeValue(r.Dynamodb.ApproximateCreationDateTime)
+		synced := bg.status.Synced
+		bg.mtx.Unlock()
+		bg.sr.update(BlueGreenSync, func(p *StepProgress) { p.ActionsExecuted = synced })
+	}
+	return errs
+}
+
+// Verify compares up to sampleSize items of the source (transformed) with their counterpart in the target, and records the result.
+// It returns an error wrapping ErrVerificationFailed if any item is missing or differs. Items changed during the verification may differ
+// until they are synced.
+func (bg *BlueGreen) Verify(ctx context.Context, sampleSize uint) (*VerifyReport, error) {
+	if err := bg.validate(); err != nil {
+		return nil, err
+	}
+	bg.mtx.Lock()
+	sr := bg.sr
+	bg.mtx.Unlock()
+	if sr == nil {
+		return nil, fmt.Errorf("migration %v isn't started", bg.Number)
+	}
+	dd := bg.Drifter
+	target := aws.StringValue(bg.Schema.TableName)
+	vr := &VerifyReport{}
+	verify := func() error {
+		si := &dynamodb.ScanInput{TableName: aws.String(bg.Source)}
+		for vr.Sampled < sampleSize {
+			si.Limit = aws.Int64(int64(sampleSize - vr.Sampled))
+			req, so := dd.DynamoDB.ScanRequest(si)
+			if err := dd.send(ctx, req); err != nil {
+				return fmt.Errorf("error scanning %v: %v", bg.Source, err)
+			}
+			for _, item := range so.Items {
+				expected, err := bg.transform(item)
+				if err != nil {
+					return err
+				}
+				vr.Sampled++
+				if expected == nil {
+					continue
+				}
+				key := bg.targetKey(expected)
+				req, gio := dd.DynamoDB.GetItemRequest(&dynamodb.GetItemInput{TableName: aws.String(target), Key: key, ConsistentRead: aws.Bool(true)})
+				if err := dd.send(ctx, req); err != nil {
+					return fmt.Errorf("error getting item from %v: %v", target, err)
+				}
+				switch {
+				case len(gio.Item) == 0:
+					vr.Missing++
+				case !reflect.DeepEqual(RawDynamoItem(gio.Item), expected):
+					vr.Mismatched++
+				default:
+					continue
+				}
+				if len(vr.Keys) < maxVerifyKeys {
+					vr.Keys = append(vr.Keys, key)
+				}
+			}
+			if len(so.LastEvaluatedKey) == 0 {
+				break
+			}
+			si.ExclusiveStartKey = so.LastEvaluatedKey
+		}
+		if vr.Missing != 0 || vr.Mismatched != 0 {
+			return fmt.Errorf("%w: %v of %v sampled items missing, %v mismatched", ErrVerificationFailed, vr.Missing, vr.Sampled, vr.Mismatched)
+		}
+		return nil
+	}
+	sr.update(BlueGreenVerify, func(p *StepProgress) {
+		*p = StepProgress{Name: BlueGreenVerify, Status: StepRunning, Started: time.Now().UTC()}
+	})
+	err := verify()
+	sr.update(BlueGreenVerify, func(p *StepProgress) {
+		p.Status, p.CallbacksProcessed, p.Errors = StepCompleted, vr.Sampled, vr.Missing+vr.Mismatched
+		if err != nil {
+			p.Status, p.Error = StepFailed, err.Error()
+		}
+	})
+	if serr := sr.save(); serr != nil && err == nil {
+		err = fmt.Errorf("error recording verification: %w", serr)
+	}
+	return vr, err
+}
+
+// stopSync stops the sync and waits for it to return
+func (bg *BlueGreen) stopSync(status StepStatus) {
+	bg.mtx.Lock()
+	stop, stopped := bg.stop, bg.stopped
+	bg.stop, bg.stopped = nil, nil
+	bg.status.Syncing = false
+	bg.mtx.Unlock()
+	if stop == nil {
+		return
+	}
+	stop()
+	<-stopped
+	bg.sr.update(BlueGreenSync, func(p *StepProgress) { p.Status = status })
+}
+
+// Cutover completes the migration once writes were switched to the target: it stops the sync and records the migration as applied.
+// It returns an error wrapping ErrReplicationLag (and keeps syncing) if the replication lag (see BlueGreenStatus.Lag) exceeds maxLag (0
+// to skip the check). Stream record creation times are rounded to the minute, so maxLag should be at least a few minutes.
+// It returns an error wrapping ErrSyncFailed if records failed to be applied to the target: the migration must then be aborted and
+// started again.
+func (bg *BlueGreen) Cutover(ctx context.Context, maxLag time.Duration) error {
+	bg.mtx.Lock()
+	sr, lag, syncing := bg.sr, bg.lag(time.Now()), bg.status.Syncing
+	syncErrs, lastErr := bg.status.SyncErrors, bg.status.LastSyncError
+	bg.mtx.Unlock()
+	if sr == nil || !syncing {
+		return fmt.Errorf("migration %v isn't syncing", bg.Number)
+	}
+	if syncErrs != 0 {
+		return fmt.Errorf("%w: %v records failed to be applied to the target (last error: %v)", ErrSyncFailed, syncErrs, lastErr)
+	}
+	if maxLag != 0 && lag > maxLag {
+		return fmt.Errorf("%w: %v (max %v)", ErrReplicationLag, lag.Round(time.Second), maxLag)
+	}
+	bg.stopSync(StepCompleted)
+	now := time.Now().UTC()
+	sr.update(BlueGreenCutover, func(p *StepProgress) {
+		*p = StepProgress{Name: BlueGreenCutover, Status: StepCompleted, Started: now}
+	})
+	sr.Lock()
+	sr.record.InProgress = false
+	sr.Unlock()
+	if err := sr.save(); err != nil {
+		return fmt.Errorf("error recording migration: %v", err)
+	}
+	dd := bg.Drifter
+	dd.logf(VerbosityNormal, "migration %v cut over from %v to %v", bg.Number, bg.Source, aws.StringValue(bg.Schema.TableName))
+	return nil
+}
+
+// Abort stops the sync, deletes the meta table record of the migration and, if dropTarget is set, deletes the target table
+func (bg *BlueGreen) Abort(ctx context.Context, dropTarget bool) error {
+	if err := bg.validate(); err != nil {
+		return err
+	}
+	bg.stopSync(StepFailed)
+	dd := bg.Drifter
+	if dropTarget {
+		req, _ := dd.DynamoDB.DeleteTableRequest(&dynamodb.DeleteTableInput{TableName: bg.Schema.TableName})
+		var aerr awserr.Error
+		if err := dd.send(ctx, req); err != nil && !(errors.As(err, &aerr) && aerr.Code() == "ResourceNotFoundException") {
+			return fmt.Errorf("error deleting table %v: %v", aws.StringValue(bg.Schema.TableName), err)
+		}
+	}
+	if err := dd.deleteMetaItem(&DynamoDrifterMigration{Number: bg.Number}); err != nil {
+		return err
+	}
+	bg.mtx.Lock()
+	bg.sr = nil
+	bg.mtx.Unlock()
+	return nil
+}
@@ -0,0 +1,178 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+)
+
+func testBlueGreen(url string) *BlueGreen {
+	return &BlueGreen{
+		Drifter: &DynamoDrifter{MetaTableName: "migrations", DynamoDB: getTestHTTPDDBClient(url)},
+		Streams: &dynamodbstreams.DynamoDBStreams{},
+		Number:  1,
+		Source:  "users",
+		Schema: &dynamodb.CreateTableInput{
+			TableName: aws.String("users-v2"),
+			KeySchema: []*dynamodb.KeySchemaElement{{AttributeName: aws.String("Email"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+		},
+		Transform: TransformerFunc(func(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+			if item["Email"] == nil {
+				return nil, nil, nil
+			}
+			delete(item, "ID")
+			return item, nil, nil
+		}),
+	}
+}
+
+func TestBlueGreenValidation(t *testing.T) {
+	for _, bg := range []*BlueGreen{
+		{},
+		{Drifter: &DynamoDrifter{DynamoDB: getTestHTTPDDBClient("http://localhost:1")}},
+		{Drifter: &DynamoDrifter{DynamoDB: getTestHTTPDDBClient("http://localhost:1")}, Streams: &dynamodbstreams.DynamoDBStreams{}, Source: "users"},
+		{Drifter: &DynamoDrifter{DynamoDB: getTestHTTPDDBClient("http://localhost:1")}, Streams: &dynamodbstreams.DynamoDBStreams{}, Source: "users",
+			Schema: &dynamodb.CreateTableInput{TableName: aws.String("users")}},
+	} {
+		if err := bg.Start(context.Background()); err == nil {
+			t.Fatalf("start should fail: %+v", bg)
+		}
+	}
+	bg := testBlueGreen("http://localhost:1")
+	if err := bg.Cutover(context.Background(), 0); err == nil {
+		t.Fatalf("cutover should require a sync")
+	}
+	if _, err := bg.Verify(context.Background(), 10); err == nil {
+		t.Fatalf("verify should require a started migration")
+	}
+	bg.Transform = TransformerFunc(func(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+		return item, []Action{{Type: ActionDelete}}, nil
+	})
+	if _, err := bg.transform(RawDynamoItem{}); err == nil {
+		t.Fatalf("transformers returning actions should be rejected")
+	}
+}
+
+func TestBlueGreenApplyRecords(t *testing.T) {
+	var mtx sync.Mutex
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mtx.Lock()
+		requests = append(requests, strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")+" "+string(b))
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	bg := testBlueGreen(srv.URL)
+	bg.sr = &stepRecorder{dd: bg.Drifter}
+	since := time.Now().Add(-time.Minute)
+	image := func(id, email string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"ID": {N: aws.String(id)}, "Email": {S: aws.String(email)}}
+	}
+	record := func(event string, created time.Time, newImage, oldImage map[string]*dynamodb.AttributeValue) *dynamodbstreams.Record {
+		return &dynamodbstreams.Record{EventName: aws.String(event), Dynamodb: &dynamodbstreams.StreamRecord{
+			ApproximateCreationDateTime: aws.Time(created),
+			Keys:                        map[string]*dynamodb.AttributeValue{"ID": {N: aws.String("1")}},
+			NewImage:                    newImage,
+			OldImage:                    oldImage,
+		}}
+	}
+	errs := bg.applyRecords(context.Background(), "users-v2", since, []*dynamodbstreams.Record{
+		record(dynamodbstreams.OperationTypeInsert, since.Add(-time.Hour), image("1", "old@example.com"), nil),
+		record(dynamodbstreams.OperationTypeModify, time.Now(), image("1", "a@example.com"), nil),
+		record(dynamodbstreams.OperationTypeInsert, time.Now(), map[string]*dynamodb.AttributeValue{"ID": {N: aws.String("2")}}, nil),
+		record(dynamodbstreams.OperationTypeRemove, time.Now(), nil, image("1", "a@example.com")),
+	})
+	if len(errs) != 0 {
+		t.Fatalf("error applying records: %v", errs)
+	}
+	expected := []string{
+		`PutItem {"Item":{"Email":{"S":"a@example.com"}},"TableName":"users-v2"}`,
+		`DeleteItem {"Key":{"Email":{"S":"a@example.com"}},"TableName":"users-v2"}`,
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("bad requests: %v", requests)
+	}
+	s := bg.Status()
+	if s.Synced != 3 || s.LastRecord.IsZero() || s.Steps[0].ActionsExecuted != 3 {
+		t.Fatalf("bad status: %+v", s)
+	}
+	b, err := json.Marshal(s)
+	if err != nil || !strings.Contains(string(b), `"lag_seconds":`) {
+		t.Fatalf("bad status JSON: %s, %v", b, err)
+	}
+}
+
+func TestBlueGreenSyncRetries(t *testing.T) {
+	var mtx sync.Mutex
+	puts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		puts++
+		n := puts
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if n == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ThrottlingException","message":"slow down"}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	bg := testBlueGreen(srv.URL)
+	bg.Drifter.RetryPolicy = &RetryPolicy{Budget: RetryBudget{MaxAttempts: 2}, Backoff: BackoffFunc(func(uint) time.Duration { return 0 })}
+	bg.sr = &stepRecorder{dd: bg.Drifter}
+	errs := bg.applyRecords(context.Background(), "users-v2", time.Time{}, []*dynamodbstreams.Record{{
+		EventName: aws.String(dynamodbstreams.OperationTypeInsert),
+		Dynamodb: &dynamodbstreams.StreamRecord{
+			ApproximateCreationDateTime: aws.Time(time.Now()),
+			NewImage:                    map[string]*dynamodb.AttributeValue{"Email": {S: aws.String("a@example.com")}},
+		},
+	}})
+	if len(errs) != 0 || puts != 2 {
+		t.Fatalf("throttled writes should be retried: %v, %v requests", errs, puts)
+	}
+}
+
+func TestBlueGreenCutoverChecks(t *testing.T) {
+	bg := testBlueGreen("http://localhost:1")
+	bg.sr = &stepRecorder{dd: bg.Drifter}
+	now := time.Now()
+	bg.status.Syncing, bg.polls, bg.lastPoll = true, map[string]shardPoll{}, now.Add(-time.Hour)
+	if lag := bg.Status().Lag; lag < time.Hour {
+		t.Fatalf("lag should grow until shards are read: %v", lag)
+	}
+	created := now.Add(-10 * time.Minute)
+	records := []*dynamodbstreams.Record{{Dynamodb: &dynamodbstreams.StreamRecord{ApproximateCreationDateTime: &created}}}
+	bg.polled("shard-1", now, nil, false)
+	bg.polled("shard-2", now.Add(-time.Minute), records, false)
+	if lag := bg.Status().Lag; lag < 10*time.Minute || lag > 11*time.Minute {
+		t.Fatalf("lag should be that of the least recently read shard: %v", lag)
+	}
+	if err := bg.Cutover(context.Background(), 5*time.Minute); !errors.Is(err, ErrReplicationLag) {
+		t.Fatalf("cutover should fail with lag: %v", err)
+	}
+	bg.polled("shard-2", time.Now(), nil, true)
+	if lag := bg.Status().Lag; lag > time.Minute {
+		t.Fatalf("closed shards should not be lagging: %v", lag)
+	}
+	bg.status.SyncErrors = 1
+	if err := bg.Cutover(context.Background(), 5*time.Minute); !errors.Is(err, ErrSyncFailed) {
+		t.Fatalf("cutover should fail with sync errors: %v", err)
+	}
+}
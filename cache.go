@@ -0,0 +1,99 @@
+package drift
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// lru is a least recently used cache of values of type V, safe for concurrent use
+type lru[V any] struct {
+	sync.Mutex
+	size  int
+	ll    *list.List // most recently used first
+	items map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+// newLRU returns a cache holding at most size values
+func newLRU[V any](size int) *lru[V] {
+	return &lru[V]{
+		size:  size,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// get returns the value cached for key, if any
+func (c *lru[V]) get(key string) (V, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*lruEntry[V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// put caches v for key, evicting the least recently used value if the cache is full
+func (c *lru[V]) put(key string, v V) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry[V]).value = v
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry[V]{key: key, value: v})
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*lruEntry[V]).key)
+	}
+}
+
+// keyString returns a canonical string for the key of an item, usable as a map or cache key
+func keyString(key map[string]*dynamodb.AttributeValue) string {
+	b, _ := json.Marshal(key) // map keys are sorted
+	return string(b)
+}
+
+// LookupCache is a read-through cache of items of a table, for callbacks which repeatedly look up a small set of reference items
+// (ex: configuration or tenant records). It is safe for concurrent use, and should be created once for a migration (outside of its
+// callback) so it is shared by all its callbacks. Items which don't exist are cached too. Cached items are shared and must not be modified.
+type LookupCache struct {
+	Table          string // Table of the items
+	ConsistentRead bool   // Use strongly consistent reads
+	cache          *lru[RawDynamoItem]
+}
+
+// NewLookupCache returns a cache of at most size items of table
+func NewLookupCache(table string, size int) *LookupCache {
+	return &LookupCache{Table: table, cache: newLRU[RawDynamoItem](size)}
+}
+
+// Get returns the item with key (see DrifterAction.Update), read with da.GetItem if it isn't cached, or nil if it doesn't exist
+func (lc *LookupCache) Get(da *DrifterAction, key interface{}) (RawDynamoItem, error) {
+	mkey, err := da.marshalKeys(key)
+	if err != nil {
+		return nil, err
+	}
+	ks := keyString(mkey)
+	if item, ok := lc.cache.get(ks); ok {
+		return item, nil
+	}
+	item, err := da.getItem(context.Background(), lc.Table, mkey, lc.ConsistentRead)
+	if err != nil {
+		return nil, err
+	}
+	lc.cache.put(ks, item)
+	return item, nil
+}
@@ -0,0 +1,49 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestLRU(t *testing.T) {
+	c := newLRU[int](2)
+	c.put("a", 1)
+	c.put("b", 2)
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Fatalf("a should be cached: %v, %v", v, ok)
+	}
+	c.put("c", 3) // evicts b, the least recently used
+	if _, ok := c.get("b"); ok {
+		t.Fatalf("b should have been evicted")
+	}
+	c.put("a", 4)
+	if v, _ := c.get("a"); v != 4 || c.ll.Len() != 2 {
+		t.Fatalf("a should be updated: %v, %v", v, c.ll.Len())
+	}
+}
+
+func TestKeyString(t *testing.T) {
+	k1 := map[string]*dynamodb.AttributeValue{"A": &dynamodb.AttributeValue{S: aws.String("x")}, "B": &dynamodb.AttributeValue{N: aws.String("1")}}
+	k2 := map[string]*dynamodb.AttributeValue{"B": &dynamodb.AttributeValue{N: aws.String("1")}, "A": &dynamodb.AttributeValue{S: aws.String("x")}}
+	k3 := map[string]*dynamodb.AttributeValue{"A": &dynamodb.AttributeValue{N: aws.String("x")}, "B": &dynamodb.AttributeValue{N: aws.String("1")}}
+	if keyString(k1) != keyString(k2) || keyString(k1) == keyString(k3) {
+		t.Fatalf("bad key strings: %v %v %v", keyString(k1), keyString(k2), keyString(k3))
+	}
+}
+
+func TestLookupCache(t *testing.T) {
+	lc := NewLookupCache("tenants", 10)
+	key := RawDynamoItem{"ID": &dynamodb.AttributeValue{S: aws.String("t1")}}
+	tenant := RawDynamoItem{"ID": key["ID"], "Plan": &dynamodb.AttributeValue{S: aws.String("pro")}}
+	lc.cache.put(keyString(key), tenant)
+	item, err := lc.Get(&DrifterAction{}, key) // cached, so DynamoDB isn't called
+	if err != nil || *item["Plan"].S != "pro" {
+		t.Fatalf("bad cached item: %v, %v", item, err)
+	}
+	lc.cache.put(keyString(RawDynamoItem{"ID": &dynamodb.AttributeValue{S: aws.String("t2")}}), nil)
+	if item, err = lc.Get(&DrifterAction{}, map[string]*dynamodb.AttributeValue{"ID": &dynamodb.AttributeValue{S: aws.String("t2")}}); item != nil || err != nil {
+		t.Fatalf("missing items should be cached: %v, %v", item, err)
+	}
+}
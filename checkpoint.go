@@ -0,0 +1,59 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Checkpoint records the scan position of a run of a migration with CheckpointItems in its meta table record: the chunks of the table
+// before it have been processed, callbacks and actions
+type Checkpoint struct {
+	Token   string    `dynamodbav:"Token" json:"token"`     // Continuation token of the next chunk (see RunChunk)
+	Scanned uint      `dynamodbav:"Scanned" json:"scanned"` // Items scanned before the checkpoint
+	Updated time.Time `dynamodbav:"Updated" json:"updated"`
+}
+
+// Resume runs migration as Run does, continuing an interrupted run at its last checkpoint (see CheckpointItems): the items scanned before
+// it are not processed again. Without a checkpoint (ex: the interrupted run didn't complete its first chunk) the migration is run from the
+// start. Checkpoints are only valid for the same migration with the same ScanSegments. Multi-step migrations resume at their failed step as
+// with Run.
+func (dd *DynamoDrifter) Resume(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) []error {
+	if migration != nil && len(migration.Steps) == 0 && migration.CheckpointItems == 0 {
+		if progressChan != nil {
+			close(progressChan)
+		}
+		return []error{fmt.Errorf("Resume requires CheckpointItems")}
+	}
+	return dd.runMigration(ctx, migration, concurrency, failOnFirstError, progressChan, true, nil)
+}
+
+// runCheckpointed runs migration a chunk at a time, recording a checkpoint after each chunk. If resume is set, the run starts at the
+// checkpoint of the interrupted run.
+func (dd *DynamoDrifter) runCheckpointed(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError, resume bool, progressChan chan *MigrationProgress) []error {
+	rr := &runRecord{dd: dd, migration: migration}
+	cp := Checkpoint{}
+	if resume {
+		m, err := dd.getMetaItem(migration.Number)
+		if err != nil {
+			return []error{err}
+		}
+		if m != nil && !m.InProgress {
+			return []error{fmt.Errorf("%w: migration %v has a completed meta table record", ErrAlreadyApplied, migration.Number)}
+		}
+		if m != nil && m.Checkpoint != nil {
+			cp = *m.Checkpoint
+			dd.logf(VerbosityNormal, "migration %v resuming at checkpoint after %v item(s)", migration.Number, cp.Scanned)
+		}
+	}
+	for {
+		next, scanned, errs := dd.runChunk(ctx, migration, cp.Token, migration.CheckpointItems, concurrency, failOnFirstError, progressChan)
+		if len(errs) != 0 || next == "" {
+			return errs
+		}
+		cp = Checkpoint{Token: next, Scanned: cp.Scanned + scanned, Updated: time.Now().UTC()}
+		if err := rr.set("Checkpoint", cp); err != nil {
+			return []error{err}
+		}
+	}
+}
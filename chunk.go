@@ -0,0 +1,167 @@
+package drift
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// scanBounds bounds the scan of a segment
+type scanBounds struct {
+	start    map[string]*dynamodb.AttributeValue // ExclusiveStartKey of the scan (nil to start at the beginning)
+	maxItems uint                                // Maximum number of items to scan
+	scanned  uint                                // Items scanned
+	last     map[string]*dynamodb.AttributeValue // ExclusiveStartKey of the next page to scan
+	done     bool                                // The scan reached the end of the segment (a page without LastEvaluatedKey)
+}
+
+// chunkToken is the decoded continuation token of RunChunk
+type chunkToken struct {
+	Number   uint           `json:"number"`
+	Segments []chunkSegment `json:"segments"`
+}
+
+// chunkSegment is the state of a scan segment in a continuation token
+type chunkSegment struct {
+	Key  map[string]*dynamodb.AttributeValue `json:"key,omitempty"`
+	Done bool                                `json:"done,omitempty"`
+}
+
+func decodeChunkToken(token string, migration *DynamoDrifterMigration, segments uint) (*chunkToken, error) {
+	if token == "" {
+		return &chunkToken{Number: migration.Number, Segments: make([]chunkSegment, segments)}, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid continuation token: %v", err)
+	}
+	ct := &chunkToken{}
+	if err := json.Unmarshal(b, ct); err != nil {
+		return nil, fmt.Errorf("invalid continuation token: %v", err)
+	}
+	if ct.Number != migration.Number {
+		return nil, fmt.Errorf("continuation token of migration %v used with migration %v", ct.Number, migration.Number)
+	}
+	if uint(len(ct.Segments)) != segments {
+		return nil, fmt.Errorf("continuation token has %v scan segments, migration has %v", len(ct.Segments), segments)
+	}
+	return ct, nil
+}
+
+func (ct *chunkToken) encode() (string, error) {
+	b, err := json.Marshal(ct)
+	if err != nil {
+		return "", fmt.Errorf("error encoding continuation token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RunChunk runs a bounded slice of a migration, for orchestration by a serverless workflow (ex: a Step Functions loop of Lambda invocations)
+// where each invocation must fit within a time limit. It scans at most maxItems items starting where the chunk of continuationToken ended
+// ("" for the first chunk), executes their callbacks and then their actions, and returns the continuation token of the next chunk.
+// The maxItems are split between the unfinished scan segments (see ScanSegments).
+//
+// Once the last chunk succeeds, the migration is recorded in the meta table and the returned token is "". On errors the input token is
+// returned, so the chunk can be retried (callbacks must be idempotent, as items of the failed chunk are processed again).
+// Like Run, the first chunk fails with ErrAlreadyApplied if the migration has a completed meta table record, and each chunk holds the lock
+// of dd.Locking while it runs (the first chunk returns "" without errors if the migration was applied while it waited for the lock).
+// Multi-step migrations are not supported, and neither are heartbeats, progress snapshots and notifications (they would be per chunk).
+func (dd *DynamoDrifter) RunChunk(ctx context.Context, migration *DynamoDrifterMigration, continuationToken string, maxItems uint, concurrency uint, failOnFirstError bool) (string, []error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return continuationToken, []error{err}
+	}
+	if err := validateCallbacks(migration); err != nil {
+		return continuationToken, []error{err}
+	}
+	if maxItems == 0 {
+		return continuationToken, []error{fmt.Errorf("maxItems is required")}
+	}
+	first := continuationToken == ""
+	if first {
+		if m, err := dd.getMetaItem(migration.Number); err != nil {
+			return continuationToken, []error{err}
+		} else if m != nil && !m.InProgress {
+			return continuationToken, []error{fmt.Errorf("%w: migration %v has a completed meta table record", ErrAlreadyApplied, migration.Number)}
+		}
+	}
+	ctx, unlock, err := dd.lockRun(ctx)
+	if err != nil {
+		return continuationToken, []error{err}
+	}
+	defer dd.unlockRun(unlock)
+	if dd.Locking != nil && first {
+		if m, err := dd.getMetaItem(migration.Number); err != nil {
+			return continuationToken, []error{err}
+		} else if m != nil && !m.InProgress {
+			dd.logf(VerbosityNormal, "migration %v was applied while waiting for the lock, skipping", migration.Number)
+			return "", []error{}
+		}
+	}
+	next, _, errs := dd.runChunk(ctx, migration, continuationToken, maxItems, concurrency, failOnFirstError, nil)
+	errs = interruptedErrors(ctx, migration, errs)
+	if len(errs) != 0 {
+		return continuationToken, errs
+	}
+	if next != "" {
+		return next, []error{}
+	}
+	if err := dd.insertMetaItem(migration); err != nil {
+		return continuationToken, []error{err}
+	}
+	return "", []error{}
+}
+
+// runChunk runs the chunk of migration starting at continuationToken (see RunChunk), returning the continuation token of the next chunk
+// ("" if the scan is done) and the number of items scanned
+func (dd *DynamoDrifter) runChunk(ctx context.Context, migration *DynamoDrifterMigration, continuationToken string, maxItems uint, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) (string, uint, []error) {
+	segments := migration.ScanSegments
+	if segments == 0 {
+		segments = 1
+	}
+	ct, err := decodeChunkToken(continuationToken, migration, segments)
+	if err != nil {
+		return "", 0, []error{err}
+	}
+	var active uint
+	for _, s := range ct.Segments {
+		if !s.Done {
+			active++
+		}
+	}
+	bounds := make([]*scanBounds, segments)
+	if active > 0 {
+		per := (maxItems + active - 1) / active
+		for i, s := range ct.Segments {
+			if !s.Done {
+				bounds[i] = &scanBounds{start: s.Key, last: s.Key, maxItems: per}
+			}
+		}
+		if errs := dd.run(ctx, migration, concurrency, failOnFirstError, bounds, progressChan); len(errs) != 0 {
+			return "", 0, errs
+		}
+	}
+	if ctx.Err() != nil {
+		return "", 0, []error{interrupted(ctx, migration)} // segments may have stopped before the end of their bounds
+	}
+	done := true
+	var scanned uint
+	for i, b := range bounds {
+		if b == nil {
+			continue
+		}
+		ct.Segments[i] = chunkSegment{Key: b.last, Done: b.done}
+		done = done && ct.Segments[i].Done
+		scanned += b.scanned
+	}
+	if done {
+		return "", scanned, nil
+	}
+	next, err := ct.encode()
+	if err != nil {
+		return "", 0, []error{err}
+	}
+	return next, scanned, nil
+}
@@ -0,0 +1,38 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestChunkToken(t *testing.T) {
+	m := &DynamoDrifterMigration{Number: 3}
+	ct, err := decodeChunkToken("", m, 2)
+	if err != nil || len(ct.Segments) != 2 || ct.Number != 3 {
+		t.Fatalf("bad initial token: %+v, %v", ct, err)
+	}
+	ct.Segments[0].Key = map[string]*dynamodb.AttributeValue{"id": &dynamodb.AttributeValue{S: aws.String("foo")}}
+	ct.Segments[1].Done = true
+	token, err := ct.encode()
+	if err != nil {
+		t.Fatalf("error encoding token: %v", err)
+	}
+	ct, err = decodeChunkToken(token, m, 2)
+	if err != nil {
+		t.Fatalf("error decoding token: %v", err)
+	}
+	if aws.StringValue(ct.Segments[0].Key["id"].S) != "foo" || ct.Segments[0].Done || !ct.Segments[1].Done {
+		t.Fatalf("bad decoded token: %+v", ct)
+	}
+	if _, err := decodeChunkToken(token, &DynamoDrifterMigration{Number: 4}, 2); err == nil {
+		t.Fatalf("token of another migration should be rejected")
+	}
+	if _, err := decodeChunkToken(token, m, 1); err == nil {
+		t.Fatalf("token with another number of segments should be rejected")
+	}
+	if _, err := decodeChunkToken("!!", m, 2); err == nil {
+		t.Fatalf("invalid token should be rejected")
+	}
+}
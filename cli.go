@@ -0,0 +1,301 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+const cliUsage = `usage: dynamo-drift [-config FILE] COMMAND [ARGS]
+
+commands:
+  init [-read N] [-write N]    create the meta table (and the progress table if configured)
+  status                       list applied, in progress and pending migrations
+  up [-to NUMBER] [-dry-run]   run the pending migrations in ascending order, stopping at the first failure
+  down [-dry-run] NUMBER       undo applied migration NUMBER with its UndoMigration or UndoCallback (-force if not the latest)
+
+flags:
+`
+
+// CLI runs the dynamo-drift command line with args (without the program name) on the migrations of r (optional), writing output to stdout
+// and errors to stderr, and returns the exit status: 0 on success, 1 if the command failed and 2 for usage errors. The drifter is
+// configured by the -config file and the environment (see LoadConfig and LoadEnv), including AWS credentials as usual.
+//
+// Migrations are Go code, so applications run them with a binary of their own built around their registry:
+//
+//	func main() {
+//		os.Exit(drift.CLI(context.Background(), os.Args[1:], migrations.Registry, os.Stdout, os.Stderr))
+//	}
+//
+// "up" and "down" hold the meta table lock (see MetaTableLock) while they run, and only plan migrations (see Plan) with -dry-run or if
+// the configuration sets DryRun.
+func CLI(ctx context.Context, args []string, r *Registry, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("dynamo-drift", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, cliUsage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "configuration file, TOML or YAML (overridden by DRIFT_* environment variables)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if r == nil {
+		r = &Registry{}
+	}
+	cmd := &cliCommand{registry: r, stdout: stdout, stderr: stderr}
+	name, cargs := fs.Arg(0), fs.Args()[1:]
+	var run func(ctx context.Context, args []string) error
+	switch name {
+	case "init":
+		run = cmd.init
+	case "status":
+		run = cmd.status
+	case "up":
+		run = cmd.up
+	case "down":
+		run = cmd.down
+	default:
+		fmt.Fprintf(stderr, "unknown command: %v\n", name)
+		fs.Usage()
+		return 2
+	}
+	err := cmd.configure(*configPath)
+	if err == nil {
+		err = run(ctx, cargs)
+	}
+	switch {
+	case errors.Is(err, flag.ErrHelp), errors.Is(err, errCLIUsage):
+		return 2
+	case err != nil:
+		fmt.Fprintf(stderr, "dynamo-drift %v: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// errCLIUsage is returned by commands for usage errors, which they have reported
+var errCLIUsage = errors.New("usage error")
+
+// cliCommand runs the commands of CLI
+type cliCommand struct {
+	config   *Config
+	drifter  *DynamoDrifter
+	registry *Registry
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+// configure loads the configuration (from path if set, then the environment) and creates the drifter
+func (c *cliCommand) configure(path string) error {
+	c.config = &Config{}
+	if path != "" {
+		var err error
+		if c.config, err = LoadConfig(path); err != nil {
+			return err
+		}
+	}
+	if err := c.config.LoadEnv(); err != nil {
+		return err
+	}
+	var err error
+	c.drifter, err = c.config.Drifter()
+	return err
+}
+
+// flags returns the flag set of command name, whose usage is its arguments
+func (c *cliCommand) flags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: dynamo-drift %v %v\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// concurrency returns the configured concurrency of runs
+func (c *cliCommand) concurrency() uint {
+	if c.config.Concurrency == 0 {
+		return 1
+	}
+	return c.config.Concurrency
+}
+
+// lock acquires the meta table lock for the duration of a run, returning the context of the run (cancelled if the lock is lost)
+func (c *cliCommand) lock(ctx context.Context) (context.Context, func() error, error) {
+	owner := c.drifter.Owner
+	if owner == "" {
+		owner = DefaultOwner()
+	}
+	return (&MetaTableLock{Drifter: c.drifter, Owner: owner}).Hold(ctx)
+}
+
+func (c *cliCommand) init(ctx context.Context, args []string) error {
+	fs := c.flags("init", "[-read N] [-write N]")
+	read := fs.Uint("read", 10, "provisioned read capacity of created tables")
+	write := fs.Uint("write", 10, "provisioned write capacity of created tables")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errCLIUsage
+	}
+	if err := c.drifter.Init(*write, *read); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "meta table %v is ready\n", c.drifter.MetaTableName)
+	return nil
+}
+
+func (c *cliCommand) status(ctx context.Context, args []string) error {
+	fs := c.flags("status", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errCLIUsage
+	}
+	records, err := c.drifter.History()
+	if err != nil {
+		return err
+	}
+	pending, err := c.drifter.Pending(c.registry)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "number\ttable\tdescription\tstate\n")
+	i, j := 0, 0
+	for i < len(records) || j < len(pending) {
+		if j < len(pending) && i < len(records) && records[i].Number == pending[j].Number {
+			j++ // in progress
+		}
+		if j == len(pending) || i < len(records) && records[i].Number < pending[j].Number {
+			state := "applied"
+			if records[i].InProgress {
+				state = "in progress"
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", records[i].Number, records[i].TableName, records[i].Description, state)
+			i++
+			continue
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\tpending\n", pending[j].Number, pending[j].TableName, pending[j].Description)
+		j++
+	}
+	return w.Flush()
+}
+
+func (c *cliCommand) up(ctx context.Context, args []string) error {
+	fs := c.flags("up", "[-to NUMBER] [-dry-run]")
+	to := fs.Uint("to", 0, "only run the pending migrations numbered up to NUMBER (optional)")
+	dryRun := fs.Bool("dry-run", c.config.DryRun, "only plan the migrations")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errCLIUsage
+	}
+	if !*dryRun {
+		var unlock func() error
+		var err error
+		ctx, unlock, err = c.lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	pending, err := c.drifter.Pending(c.registry)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, m := range pending {
+		if *to != 0 && m.Number > *to {
+			break
+		}
+		if err := c.apply(ctx, m, *dryRun, false); err != nil {
+			return err
+		}
+		n++
+	}
+	if !*dryRun {
+		fmt.Fprintf(c.stdout, "%v migration(s) applied\n", n)
+	}
+	return nil
+}
+
+func (c *cliCommand) down(ctx context.Context, args []string) error {
+	fs := c.flags("down", "[-dry-run] [-force] NUMBER")
+	dryRun := fs.Bool("dry-run", c.config.DryRun, "only plan the undo migration")
+	force := fs.Bool("force", false, "undo the migration even if other migrations were applied after it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errCLIUsage
+	}
+	number, err := strconv.ParseUint(fs.Arg(0), 10, 0)
+	if err != nil {
+		return fmt.Errorf("invalid migration number: %v", fs.Arg(0))
+	}
+	m := c.registry.get(uint(number))
+	switch {
+	case m == nil:
+		return fmt.Errorf("migration %v is not registered", number)
+	case m.undoMigration() == nil:
+		return fmt.Errorf("migration %v has no UndoMigration nor UndoCallback", number)
+	}
+	if !*dryRun {
+		var unlock func() error
+		var err error
+		ctx, unlock, err = c.lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	rec, err := c.drifter.getMetaItem(m.Number)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return fmt.Errorf("migration %v is not applied", number)
+	}
+	c.drifter.ForceUndo = *force
+	return c.apply(ctx, m.undoMigration(), *dryRun, true)
+}
+
+// apply runs (or undoes) migration, or prints its plan if dryRun is set
+func (c *cliCommand) apply(ctx context.Context, migration *DynamoDrifterMigration, dryRun, undo bool) error {
+	c.config.ApplyDefaults(migration)
+	if dryRun {
+		plan, err := c.drifter.Plan(ctx, migration, PlanOptions{Concurrency: c.concurrency()})
+		if err != nil {
+			return fmt.Errorf("error planning migration %v: %w", migration.Number, err)
+		}
+		fmt.Fprintln(c.stdout, plan.String())
+		return nil
+	}
+	run, verb := c.drifter.Run, "applied"
+	if undo {
+		run, verb = c.drifter.Undo, "undone"
+	}
+	if errs := run(ctx, migration, c.concurrency(), c.config.FailOnFirstError, nil); len(errs) != 0 {
+		return fmt.Errorf("migration %v failed with %v error(s), first: %w", migration.Number, len(errs), errs[0])
+	}
+	fmt.Fprintf(c.stdout, "migration %v %v\n", migration.Number, verb)
+	return nil
+}
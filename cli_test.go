@@ -0,0 +1,112 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCLI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.Scan":
+			w.Write([]byte(`{"Items":[{"Number":{"N":"-1"}},{"Number":{"N":"1"},"TableName":{"S":"users"},"Description":{"S":"add name"}},` +
+				`{"Number":{"N":"3"},"TableName":{"S":"users"},"InProgress":{"BOOL":true}}],"Count":3}`))
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("DRIFT_META_TABLE", "migrations")
+	t.Setenv("DRIFT_ENDPOINT", srv.URL)
+	t.Setenv("DRIFT_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	cb := func(item RawDynamoItem, action *DrifterAction) error { return nil }
+	r := &Registry{}
+	err := r.Register(
+		&DynamoDrifterMigration{Number: 1, TableName: "users", Description: "add name", Callback: cb},
+		&DynamoDrifterMigration{Number: 2, TableName: "users", Description: "add age", Callback: cb},
+		&DynamoDrifterMigration{Number: 3, TableName: "users", Callback: cb},
+	)
+	if err != nil {
+		t.Fatalf("error registering: %v", err)
+	}
+	run := func(args ...string) (int, string, string) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		return CLI(context.Background(), args, r, stdout, stderr), stdout.String(), stderr.String()
+	}
+	if status, _, stderr := run(); status != 2 || !strings.Contains(stderr, "usage: dynamo-drift") {
+		t.Fatalf("missing command should fail with the usage: %v, %v", status, stderr)
+	}
+	if status, _, stderr := run("sideways"); status != 2 || !strings.Contains(stderr, "unknown command") {
+		t.Fatalf("unknown commands should fail: %v, %v", status, stderr)
+	}
+	if status, _, _ := run("status", "extra"); status != 2 {
+		t.Fatalf("extra arguments should fail: %v", status)
+	}
+	status, stdout, stderr := run("status")
+	if status != 0 {
+		t.Fatalf("status failed: %v", stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[1], "applied") || !strings.Contains(lines[2], "add age") ||
+		!strings.HasSuffix(lines[2], "pending") || !strings.HasSuffix(lines[3], "in progress") {
+		t.Fatalf("bad status:\n%v", stdout)
+	}
+	for _, args := range [][]string{{"down", "2"}, {"down", "x"}, {"down", "7"}} {
+		if status, _, stderr := run(args...); status != 1 || !strings.Contains(stderr, "dynamo-drift down: ") {
+			t.Fatalf("%v should fail: %v, %v", args, status, stderr)
+		}
+	}
+}
+
+func TestCLIInterrupted(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	if err := setupTestTables(dd.DynamoDB); err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	if err := dd.Init(10, 10); err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	t.Setenv("DRIFT_META_TABLE", testMetaTable)
+	t.Setenv("DRIFT_ENDPOINT", "http://localhost:8000")
+	t.Setenv("DRIFT_REGION", "us-west-2")
+	t.Setenv("AWS_ACCESS_KEY_ID", "foo")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "bar")
+	// as cmd/dynamo-drift
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	r := &Registry{}
+	err := r.Register(&DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			syscall.Kill(os.Getpid(), syscall.SIGINT)
+			<-ctx.Done()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("error registering: %v", err)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if status := CLI(ctx, []string{"up"}, r, stdout, stderr); status != 1 || !strings.Contains(stderr.String(), "context canceled") {
+		t.Fatalf("interrupted run should fail: %v, %v", status, stderr)
+	}
+	if applied, err := dd.Applied(); err != nil || len(applied) != 0 {
+		t.Fatalf("interrupted run should not be recorded: %v, %v", applied, err)
+	}
+}
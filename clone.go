@@ -0,0 +1,259 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// batchWriteLimit is the maximum number of items of a BatchWriteItem request
+const batchWriteLimit = 25
+
+// CloneOptions are the options of DynamoDrifter.CloneTable
+type CloneOptions struct {
+	CopyItems     bool              // Copy the items of the table (by default only the schema is cloned)
+	SampleSize    uint              // Maximum number of items copied (optional, defaults to all)
+	Segments      uint              // Number of parallel scan segments of the copy (optional, defaults to 1)
+	ReadCapacity  int64             // Provisioned read capacity of the clone and its indexes (optional, defaults to 10)
+	WriteCapacity int64             // Provisioned write capacity of the clone and its indexes (optional, defaults to 10)
+	Progress      func(copied uint) // Called with the total number of items copied after each page (optional, called concurrently if Segments > 1)
+}
+
+// timeToLive is the TTL setting of a table. The vendored SDK predates TTL, so the TTL operations are called with these types
+// (marshaled like SDK types by the JSON protocol).
+type timeToLive struct {
+	AttributeName *string
+	Enabled       *bool   `json:",omitempty"`
+	Status        *string `locationName:"TimeToLiveStatus" json:",omitempty"`
+}
+
+type describeTimeToLiveInput struct {
+	TableName *string
+}
+
+type describeTimeToLiveOutput struct {
+	TimeToLiveDescription *timeToLive
+}
+
+type updateTimeToLiveInput struct {
+	TableName               *string
+	TimeToLiveSpecification *timeToLive
+}
+
+// CloneTable creates table dst with the schema of table src: key schema, secondary indexes (with the provisioned capacity of opts) and TTL
+// setting. If opts.CopyItems is set, the items of src (or opts.SampleSize of them) are then copied into dst, with parallel scan segments
+// and batch writes (retried as per the drifter's RetryPolicy). It returns the number of items copied.
+func (dd *DynamoDrifter) CloneTable(ctx context.Context, src, dst string, opts CloneOptions) (uint, error) {
+	if err := checkClient(dd.DynamoDB, "CreateTableRequest"); err != nil {
+		return 0, err
+	}
+	td, _, err := dd.describeTable(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	pt := &dynamodb.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(10), WriteCapacityUnits: aws.Int64(10)}
+	if opts.ReadCapacity > 0 {
+		pt.ReadCapacityUnits = aws.Int64(opts.ReadCapacity)
+	}
+	if opts.WriteCapacity > 0 {
+		pt.WriteCapacityUnits = aws.Int64(opts.WriteCapacity)
+	}
+	cti := &dynamodb.CreateTableInput{
+		TableName:             aws.String(dst),
+		AttributeDefinitions:  td.AttributeDefinitions,
+		KeySchema:             td.KeySchema,
+		ProvisionedThroughput: pt,
+	}
+	for _, gsi := range td.GlobalSecondaryIndexes {
+		cti.GlobalSecondaryIndexes = append(cti.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndex{
+			IndexName:             gsi.IndexName,
+			KeySchema:             gsi.KeySchema,
+			Projection:            gsi.Projection,
+			ProvisionedThroughput: pt,
+		})
+	}
+	for _, lsi := range td.LocalSecondaryIndexes {
+		cti.LocalSecondaryIndexes = append(cti.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndex{
+			IndexName:  lsi.IndexName,
+			KeySchema:  lsi.KeySchema,
+			Projection: lsi.Projection,
+		})
+	}
+	req, _ := dd.DynamoDB.CreateTableRequest(cti)
+	if err := dd.send(ctx, req); err != nil {
+		return 0, fmt.Errorf("error creating table %v: %v", dst, err)
+	}
+	if err := dd.waitForTable(ctx, dst); err != nil {
+		return 0, err
+	}
+	if err := dd.cloneTimeToLive(ctx, src, dst); err != nil {
+		return 0, err
+	}
+	if !opts.CopyItems {
+		return 0, nil
+	}
+	return dd.copyTable(ctx, src, dst, opts, nil)
+}
+
+// waitForTable waits until table is active
+func (dd *DynamoDrifter) waitForTable(ctx context.Context, table string) error {
+	for {
+		td, _, err := dd.describeTable(ctx, table)
+		if err != nil {
+			return err
+		}
+		if aws.StringValue(td.TableStatus) == dynamodb.TableStatusActive {
+			return nil
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// cloneTimeToLive enables TTL on dst if it is enabled on src
+func (dd *DynamoDrifter) cloneTimeToLive(ctx context.Context, src, dst string) error {
+	out := &describeTimeToLiveOutput{}
+	req, err := dd.newRequest("DescribeTimeToLive", &describeTimeToLiveInput{TableName: aws.String(src)}, out)
+	if err == nil {
+		err = dd.send(ctx, req)
+	}
+	if err != nil {
+		return fmt.Errorf("error describing TTL of %v: %v", src, err)
+	}
+	ttl := out.TimeToLiveDescription
+	if ttl == nil || (aws.StringValue(ttl.Status) != "ENABLED" && aws.StringValue(ttl.Status) != "ENABLING") {
+		return nil
+	}
+	in := &updateTimeToLiveInput{
+		TableName:               aws.String(dst),
+		TimeToLiveSpecification: &timeToLive{AttributeName: ttl.AttributeName, Enabled: aws.Bool(true)},
+	}
+	if req, err = dd.newRequest("UpdateTimeToLive", in, &struct{}{}); err == nil {
+		err = dd.send(ctx, req)
+	}
+	if err != nil {
+		return fmt.Errorf("error enabling TTL of %v: %v", dst, err)
+	}
+	return nil
+}
+
+// copyTable copies the items of src (up to opts.SampleSize) into dst, transformed by transform if not nil (items it returns nil for aren't
+// copied)
+func (dd *DynamoDrifter) copyTable(ctx context.Context, src, dst string, opts CloneOptions, transform func(RawDynamoItem) (RawDynamoItem, error)) (uint, error) {
+	segments := opts.Segments
+	if segments == 0 {
+		segments = 1
+	}
+	ctx, cncl := context.WithCancel(ctx)
+	defer cncl()
+	retry := newRetrier(dd.RetryPolicy)
+	var mtx sync.Mutex
+	var copied uint
+	var firstErr error
+	// reserve returns how many of n items may still be copied
+	reserve := func(n uint) uint {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if opts.SampleSize != 0 && copied+n > opts.SampleSize {
+			n = opts.SampleSize - copied
+		}
+		copied += n
+		return n
+	}
+	fail := func(err error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cncl()
+		}
+	}
+	var wg sync.WaitGroup
+	for seg := uint(0); seg < segments; seg++ {
+		wg.Add(1)
+		go func(seg uint) {
+			defer wg.Done()
+			si := &dynamodb.ScanInput{TableName: aws.String(src)}
+			if segments > 1 {
+				si.Segment = aws.Int64(int64(seg))
+				si.TotalSegments = aws.Int64(int64(segments))
+			}
+			for {
+				req, so := dd.DynamoDB.ScanRequest(si)
+				if err := dd.send(ctx, req); err != nil {
+					fail(fmt.Errorf("error scanning %v: %v", src, err))
+					return
+				}
+				n := reserve(uint(len(so.Items)))
+				items := so.Items[:n]
+				if transform != nil {
+					items = make([]map[string]*dynamodb.AttributeValue, 0, n)
+					for _, item := range so.Items[:n] {
+						ti, err := transform(item)
+						if err != nil {
+							fail(err)
+							return
+						}
+						if ti != nil {
+							items = append(items, ti)
+						}
+					}
+				}
+				for i := 0; i < len(items); i += batchWriteLimit {
+					if err := dd.batchPut(ctx, retry, dst, items[i:min(i+batchWriteLimit, len(items))]); err != nil {
+						fail(err)
+						return
+					}
+				}
+				if opts.Progress != nil && n > 0 {
+					mtx.Lock()
+					c := copied
+					mtx.Unlock()
+					opts.Progress(c)
+				}
+				if len(so.LastEvaluatedKey) == 0 || n < uint(len(so.Items)) {
+					return
+				}
+				si.ExclusiveStartKey = so.LastEvaluatedKey
+			}
+		}(seg)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return copied, nil
+}
+
+// batchPut writes items (at most batchWriteLimit) to table, retrying unprocessed items as throttled requests
+func (dd *DynamoDrifter) batchPut(ctx context.Context, retry *retrier, table string, items []map[string]*dynamodb.AttributeValue) error {
+	pending := make([]*dynamodb.WriteRequest, len(items))
+	for i, item := range items {
+		pending[i] = &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}}
+	}
+	err := retry.do(ctx, func() error {
+		req, out := dd.DynamoDB.BatchWriteItemRequest(&dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{table: pending},
+		})
+		if err := dd.send(ctx, req); err != nil {
+			return err
+		}
+		pending = out.UnprocessedItems[table]
+		if len(pending) > 0 {
+			return awserr.New("ProvisionedThroughputExceededException", fmt.Sprintf("%v items unprocessed", len(pending)), nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error writing items to %v: %w", table, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+func TestTimeToLiveRequest(t *testing.T) {
+	db := getTestDDBClient()
+	in := &updateTimeToLiveInput{
+		TableName:               aws.String("users"),
+		TimeToLiveSpecification: &timeToLive{AttributeName: aws.String("Expires"), Enabled: aws.Bool(true)},
+	}
+	req := db.NewRequest(&request.Operation{Name: "UpdateTimeToLive", HTTPMethod: "POST", HTTPPath: "/"}, in, &struct{}{})
+	if err := req.Build(); err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	if target := req.HTTPRequest.Header.Get("X-Amz-Target"); target != "DynamoDB_20120810.UpdateTimeToLive" {
+		t.Fatalf("bad target: %v", target)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("error reading body: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("error unmarshaling body %s: %v", body, err)
+	}
+	spec, ok := got["TimeToLiveSpecification"].(map[string]interface{})
+	if got["TableName"] != "users" || !ok || spec["AttributeName"] != "Expires" || spec["Enabled"] != true || len(spec) != 2 {
+		t.Fatalf("bad body: %s", body)
+	}
+}
+
+func TestCloneTableValidation(t *testing.T) {
+	dd := &DynamoDrifter{}
+	if _, err := dd.CloneTable(context.Background(), "users", "users-copy", CloneOptions{}); err == nil {
+		t.Fatalf("missing client should fail")
+	}
+}
@@ -0,0 +1,22 @@
+// Command dynamo-drift manages the meta table of drift migrations: "init" creates it and "status" lists the applied migrations. See
+// drift.CLI for the commands and their configuration.
+//
+// Migrations are Go code, which this binary doesn't have: to run them ("up" and "down"), build a binary of your own around the registry
+// of your migrations, as this one with drift.CLI.
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	status := drift.CLI(ctx, os.Args[1:], nil, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(status)
+}
@@ -0,0 +1,156 @@
+package drift
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// setValue returns elements as a set attribute value without duplicates, or nil if there are no elements. elements is a []string
+// (string set), a slice of integers or floats (number set), a [][]byte (binary set), or a raw set *dynamodb.AttributeValue.
+func setValue(elements interface{}) (*dynamodb.AttributeValue, error) {
+	av := &dynamodb.AttributeValue{}
+	seen := map[string]bool{}
+	add := func(set *[]*string, e string) {
+		if !seen[e] {
+			seen[e] = true
+			*set = append(*set, &e)
+		}
+	}
+	switch v := elements.(type) {
+	case []string:
+		for _, e := range v {
+			add(&av.SS, e)
+		}
+	case []int:
+		for _, e := range v {
+			add(&av.NS, strconv.Itoa(e))
+		}
+	case []int64:
+		for _, e := range v {
+			add(&av.NS, strconv.FormatInt(e, 10))
+		}
+	case []uint:
+		for _, e := range v {
+			add(&av.NS, strconv.FormatUint(uint64(e), 10))
+		}
+	case []float64:
+		for _, e := range v {
+			add(&av.NS, strconv.FormatFloat(e, 'f', -1, 64))
+		}
+	case [][]byte:
+		for _, e := range v {
+			if !seen[string(e)] {
+				seen[string(e)] = true
+				av.BS = append(av.BS, e)
+			}
+		}
+	case *dynamodb.AttributeValue:
+		if v == nil || v.SS == nil && v.NS == nil && v.BS == nil {
+			return nil, fmt.Errorf("attribute value is not a set")
+		}
+		av = v
+	default:
+		return nil, fmt.Errorf("unsupported set elements type: %T", elements)
+	}
+	if len(av.SS) == 0 && len(av.NS) == 0 && len(av.BS) == 0 {
+		return nil, nil
+	}
+	return av, nil
+}
+
+// AddToSet queues adding elements (see below) to set attribute attr of the item with keys (see Update) in tableName (optional, defaults to
+// migration table). The set is created if the item doesn't have it. Elements already in the set are ignored, and nothing is queued if
+// there are no elements (DynamoDB doesn't support empty sets).
+// elements is a []string (string set), a slice of integers or floats (number set), a [][]byte (binary set) or a raw set *dynamodb.AttributeValue.
+func (da *DrifterAction) AddToSet(keys interface{}, attr string, elements interface{}, tableName string) error {
+	av, err := setValue(elements)
+	if err != nil || av == nil {
+		return err
+	}
+	return da.UpdateItem(keys, tableName).Add(attr, av).Queue()
+}
+
+// RemoveFromSet queues removing elements (see AddToSet) from set attribute attr of the item with keys (see Update) in tableName (optional,
+// defaults to migration table). Elements not in the set are ignored, and DynamoDB removes the attribute if the set becomes empty.
+// Nothing is queued if there are no elements.
+func (da *DrifterAction) RemoveFromSet(keys interface{}, attr string, elements interface{}, tableName string) error {
+	av, err := setValue(elements)
+	if err != nil || av == nil {
+		return err
+	}
+	return da.UpdateItem(keys, tableName).Delete(attr, av).Queue()
+}
+
+// AppendToList queues appending elements (a slice, marshaled as a list, or a raw list *dynamodb.AttributeValue) to list attribute attr
+// of the item with keys (see Update) in tableName (optional, defaults to migration table). The list is created if the item doesn't have
+// it. Nothing is queued if there are no elements.
+func (da *DrifterAction) AppendToList(keys interface{}, attr string, elements interface{}, tableName string) error {
+	av, ok := elements.(*dynamodb.AttributeValue)
+	if !ok {
+		var err error
+		av, err = dynamodbattribute.Marshal(elements)
+		if err != nil {
+			return fmt.Errorf("error marshaling elements: %v", err)
+		}
+	}
+	if av == nil || av.L == nil {
+		if av != nil && av.NULL != nil {
+			return nil // nil slice
+		}
+		return fmt.Errorf("elements are not a list")
+	}
+	if len(av.L) == 0 {
+		return nil
+	}
+	mkeys, err := da.marshalKeys(keys)
+	if err != nil {
+		return err
+	}
+	names := expressionNames{}
+	p := names.placeholder(attr)
+	values := map[string]*dynamodb.AttributeValue{
+		":elements": av,
+		":empty":    &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}},
+	}
+	return da.queueUpdate(mkeys, values, fmt.Sprintf("SET %v = list_append(if_not_exists(%v, :empty), :elements)", p, p), names, "", false, tableName)
+}
+
+// RemoveFromList queues removing the elements of list attribute attr for which remove returns true from the item with keys (see Update)
+// in tableName (optional, defaults to migration table). The indexes of the elements are found in item (ex: the scanned item), and the
+// update is conditioned on the elements at those indexes being unchanged, so it is skipped if the list was modified since item was read.
+// Nothing is queued if no element is removed, or if item doesn't have the list.
+func (da *DrifterAction) RemoveFromList(item RawDynamoItem, keys interface{}, attr string, remove func(element *dynamodb.AttributeValue) bool, tableName string) error {
+	list, ok := item[attr]
+	if !ok || list.NULL != nil {
+		return nil
+	}
+	if list.L == nil {
+		return fmt.Errorf("%v is not a list", attr)
+	}
+	names := expressionNames{}
+	p := names.placeholder(attr)
+	values := map[string]*dynamodb.AttributeValue{}
+	paths, conds := []string{}, []string{}
+	for i, e := range list.L {
+		if !remove(e) {
+			continue
+		}
+		path := fmt.Sprintf("%v[%v]", p, i)
+		v := ":e" + strconv.Itoa(i)
+		values[v] = e
+		paths = append(paths, path)
+		conds = append(conds, path+" = "+v)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	mkeys, err := da.marshalKeys(keys)
+	if err != nil {
+		return err
+	}
+	return da.queueUpdate(mkeys, values, "REMOVE "+strings.Join(paths, ", "), names, strings.Join(conds, " AND "), false, tableName)
+}
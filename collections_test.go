@@ -0,0 +1,104 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestSetValue(t *testing.T) {
+	av, err := setValue([]string{"a", "b", "a"})
+	if err != nil || len(av.SS) != 2 || *av.SS[0] != "a" || *av.SS[1] != "b" {
+		t.Fatalf("bad string set: %v, %v", av, err)
+	}
+	if av, err = setValue([]int{1, 1, 2}); err != nil || len(av.NS) != 2 || *av.NS[1] != "2" {
+		t.Fatalf("bad number set: %v, %v", av, err)
+	}
+	if av, err = setValue([]float64{1.5}); err != nil || *av.NS[0] != "1.5" {
+		t.Fatalf("bad number set: %v, %v", av, err)
+	}
+	if av, err = setValue([][]byte{[]byte("x"), []byte("x")}); err != nil || len(av.BS) != 1 {
+		t.Fatalf("bad binary set: %v, %v", av, err)
+	}
+	if av, err = setValue([]string{}); err != nil || av != nil {
+		t.Fatalf("empty set should be nil: %v, %v", av, err)
+	}
+	if _, err = setValue(&dynamodb.AttributeValue{S: aws.String("a")}); err == nil {
+		t.Fatalf("non-set attribute value should fail")
+	}
+	if _, err = setValue([]bool{true}); err == nil {
+		t.Fatalf("unsupported type should fail")
+	}
+}
+
+func TestSetHelpers(t *testing.T) {
+	da := &DrifterAction{}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	if err := da.AddToSet(keys, "Members", []string{"a"}, ""); err != nil {
+		t.Fatalf("error queuing add: %v", err)
+	}
+	if err := da.RemoveFromSet(keys, "Members", []int{1}, ""); err != nil {
+		t.Fatalf("error queuing delete: %v", err)
+	}
+	if err := da.AddToSet(keys, "Members", nil, ""); err == nil {
+		t.Fatalf("nil elements should fail")
+	}
+	if err := da.RemoveFromSet(keys, "Members", [][]byte{}, ""); err != nil {
+		t.Fatalf("empty set should be ignored: %v", err)
+	}
+	actions := da.aq.actions()
+	if len(actions) != 2 {
+		t.Fatalf("bad number of actions: %v", len(actions))
+	}
+	if actions[0].updExpr != "ADD #Members :v0" || *actions[0].values[":v0"].SS[0] != "a" {
+		t.Fatalf("bad add: %v %v", actions[0].updExpr, actions[0].values)
+	}
+	if actions[1].updExpr != "DELETE #Members :v0" || *actions[1].values[":v0"].NS[0] != "1" {
+		t.Fatalf("bad delete: %v %v", actions[1].updExpr, actions[1].values)
+	}
+}
+
+func TestListHelpers(t *testing.T) {
+	da := &DrifterAction{}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	if err := da.AppendToList(keys, "Comment", []string{"a", "b"}, ""); err != nil {
+		t.Fatalf("error queuing append: %v", err)
+	}
+	if err := da.AppendToList(keys, "Comment", []string{}, ""); err != nil {
+		t.Fatalf("empty list should be ignored: %v", err)
+	}
+	if err := da.AppendToList(keys, "Comment", "a", ""); err == nil {
+		t.Fatalf("non-list elements should fail")
+	}
+	item := RawDynamoItem{
+		"ID": keys["ID"],
+		"Tags": &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{
+			&dynamodb.AttributeValue{S: aws.String("keep")},
+			&dynamodb.AttributeValue{S: aws.String("drop")},
+			&dynamodb.AttributeValue{S: aws.String("drop")},
+		}},
+	}
+	drop := func(e *dynamodb.AttributeValue) bool { return aws.StringValue(e.S) == "drop" }
+	if err := da.RemoveFromList(item, keys, "Tags", drop, ""); err != nil {
+		t.Fatalf("error queuing remove: %v", err)
+	}
+	if err := da.RemoveFromList(item, keys, "Missing", drop, ""); err != nil {
+		t.Fatalf("missing list should be ignored: %v", err)
+	}
+	if err := da.RemoveFromList(item, keys, "ID", drop, ""); err == nil {
+		t.Fatalf("non-list attribute should fail")
+	}
+	actions := da.aq.actions()
+	if len(actions) != 2 {
+		t.Fatalf("bad number of actions: %v", len(actions))
+	}
+	a := actions[0]
+	if a.updExpr != "SET #Comment = list_append(if_not_exists(#Comment, :empty), :elements)" || len(a.values[":elements"].L) != 2 {
+		t.Fatalf("bad append: %v %v", a.updExpr, a.values)
+	}
+	a = actions[1]
+	if a.updExpr != "REMOVE #Tags[1], #Tags[2]" || a.condExpr != "#Tags[1] = :e1 AND #Tags[2] = :e2" || *a.values[":e2"].S != "drop" {
+		t.Fatalf("bad remove: %v %v %v", a.updExpr, a.condExpr, a.values)
+	}
+}
@@ -0,0 +1,112 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// ErrConditionFailed is returned (wrapped in ActionErrors) for actions whose Condition failed, ex: items which changed since they were
+// scanned
+var ErrConditionFailed = errors.New("condition of the action failed")
+
+// Condition is a condition an action is applied under (see DrifterAction.Update, Insert and Delete). Unlike conditional updates queued
+// with UpdateBuilder.If, which are skipped, actions whose Condition fails fail with an ActionError wrapping ErrConditionFailed, ex: to
+// detect items which changed between their scan and the action ("Version = :v").
+type Condition struct {
+	Expression string                 // DynamoDB condition expression, reserved words used as attribute names are escaped (see IsReservedWord)
+	Names      map[string]string      // Expression attribute names of Expression (optional)
+	Values     map[string]interface{} // Values of the placeholders of Expression, marshaled individually (optional)
+}
+
+// withCondition returns the expression of the single optional condition of conds, and names and values with those of the condition
+// (copies, unless there is no condition)
+func withCondition(conds []Condition, names expressionNames, values map[string]*dynamodb.AttributeValue) (string, expressionNames, map[string]*dynamodb.AttributeValue, error) {
+	switch {
+	case len(conds) == 0:
+		return "", names, values, nil
+	case len(conds) > 1:
+		return "", nil, nil, fmt.Errorf("at most one condition may be passed")
+	case conds[0].Expression == "":
+		return "", nil, nil, fmt.Errorf("condition expression is required")
+	}
+	c := conds[0]
+	mnames := make(expressionNames, len(names)+len(c.Names))
+	for p, n := range names {
+		mnames[p] = n
+	}
+	cnames, err := newExpressionNames(c.Names)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	for p, n := range cnames {
+		if cur, ok := mnames[p]; ok && aws.StringValue(cur) != aws.StringValue(n) {
+			return "", nil, nil, fmt.Errorf("condition name %v is already defined", p)
+		}
+		mnames[p] = n
+	}
+	mvalues := make(map[string]*dynamodb.AttributeValue, len(values)+len(c.Values))
+	for p, v := range values {
+		mvalues[p] = v
+	}
+	for p, v := range c.Values {
+		if _, ok := mvalues[p]; ok {
+			return "", nil, nil, fmt.Errorf("condition value %v is already defined", p)
+		}
+		av, err := dynamodbattribute.Marshal(v)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("error marshaling condition value %v: %v", p, err)
+		}
+		mvalues[p] = av
+	}
+	if len(mnames) == 0 {
+		mnames = nil
+	}
+	if len(mvalues) == 0 {
+		mvalues = nil
+	}
+	return c.Expression, mnames, mvalues, nil
+}
+
+// writeCondition returns the condition expression, names and values of a, an insert or delete on table, including the condition of
+// inserts which must not overwrite items in safe mode. The expression is nil if a is unconditional.
+func (dd *DynamoDrifter) writeCondition(ctx context.Context, a *action, table string, da *DrifterAction) (*string, map[string]*string, map[string]*dynamodb.AttributeValue, error) {
+	cond, names := a.condExpr, expressionNames(a.expAttrNames)
+	if a.atype == insertAction && a.noOverwrite {
+		key, err := dd.hashKey(ctx, da, table)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		mnames := make(expressionNames, len(names)+1)
+		for p, n := range names {
+			mnames[p] = n
+		}
+		notExists := "attribute_not_exists(" + mnames.add("#k", key) + ")"
+		if cond == "" {
+			cond = notExists
+		} else {
+			cond = notExists + " AND (" + cond + ")"
+		}
+		names = mnames
+	}
+	if cond == "" {
+		return nil, nil, nil, nil
+	}
+	return aws.String(cond), names, a.values, nil
+}
+
+// conditionError returns the error of action a whose condition failed
+func conditionError(a *action) error {
+	unsafe := a.atype == insertAction && a.noOverwrite
+	switch {
+	case unsafe && a.condExpr != "":
+		return fmt.Errorf("%w, or %w: the item may exist and overwrites require AllowsOverwrites in safe mode", ErrConditionFailed, ErrUnsafeAction)
+	case unsafe:
+		return fmt.Errorf("%w: the item exists and overwrites require AllowsOverwrites in safe mode", ErrUnsafeAction)
+	}
+	return ErrConditionFailed
+}
@@ -0,0 +1,77 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestConditions(t *testing.T) {
+	var mtx sync.Mutex
+	conditions := map[string]string{} // condition of the last request of each operation
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if op == "DescribeTable" {
+			w.Write([]byte(`{"Table":{"TableName":"users","KeySchema":[{"AttributeName":"ID","KeyType":"HASH"}]}}`))
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		in := struct{ ConditionExpression string }{}
+		json.Unmarshal(b, &in)
+		mtx.Lock()
+		conditions[op] = in.ConditionExpression
+		mtx.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), SafeMode: true}
+	m := &DynamoDrifterMigration{TableName: "users", AllowsDeletes: true, Callback: func(RawDynamoItem, *DrifterAction) error { return nil }}
+	da := dd.newDrifterAction(m)
+	key := RawDynamoItem{"ID": {N: aws.String("1")}}
+	cond := Condition{Expression: "Version = :version", Values: map[string]interface{}{":version": 2}}
+	if err := da.Update(key, map[string]interface{}{":v": "v"}, "SET Foo = :v", nil, "", cond); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	if err := da.Insert(RawDynamoItem{"ID": key["ID"], "Name": {S: aws.String("n")}}, "", Condition{Expression: "Name <> :n", Values: map[string]interface{}{":n": "n"}}); err != nil {
+		t.Fatalf("error queuing insert: %v", err)
+	}
+	if err := da.Delete(key, "", cond); err != nil {
+		t.Fatalf("error queuing delete: %v", err)
+	}
+	da.UpdateItem(key, "").Set("Foo", "v").If("Version = :version", map[string]interface{}{":version": 2}).Queue()
+	errs := dd.executeActions(context.Background(), m, da, 1, false, nil)
+	if len(errs) != 3 {
+		t.Fatalf("failed conditions should fail their action, unless set with If: %v", errs)
+	}
+	for _, err := range errs {
+		var ae *ActionError
+		if !errors.Is(err, ErrConditionFailed) || !errors.As(err, &ae) || ae.Key["ID"] == nil {
+			t.Fatalf("bad condition error: %v", err)
+		}
+	}
+	if !errors.Is(errs[1], ErrUnsafeAction) {
+		t.Fatalf("failed inserts may have existing items in safe mode: %v", errs[1])
+	}
+	if conditions["PutItem"] != "attribute_not_exists(#k) AND (#Name <> :n)" || conditions["DeleteItem"] != "Version = :version" {
+		t.Fatalf("bad conditions: %v", conditions)
+	}
+	if err := da.Update(key, map[string]interface{}{":version": 1}, "SET Version = :version", nil, "", cond); err == nil {
+		t.Fatalf("condition values should not be redefined")
+	}
+	if err := da.Delete(key, "", cond, cond); err == nil {
+		t.Fatalf("actions should have at most one condition")
+	}
+	if err := da.Delete(key, "", Condition{}); err == nil {
+		t.Fatalf("conditions should require an expression")
+	}
+}
@@ -0,0 +1,395 @@
+package drift
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ConfigFormat is a format of configuration files
+type ConfigFormat string
+
+// Configuration formats. Both are restricted to sections of scalar settings (strings, numbers, booleans and durations such as "30s"):
+//
+//	# TOML                          # YAML
+//	[drift]                         drift:
+//	meta_table = "migrations"         meta_table: migrations
+//	region = "us-west-2"              region: us-west-2
+//
+//	[defaults]                      defaults:
+//	concurrency = 4                   concurrency: 4
+const (
+	ConfigTOML ConfigFormat = "toml"
+	ConfigYAML ConfigFormat = "yaml"
+)
+
+// Config is the configuration of a drifter and the defaults of its runs, shared between services and the CLI. Settings are named
+// "section.key" in configuration files (see the config tags) and DRIFT_KEY in the environment (see LoadEnv).
+type Config struct {
+	MetaTable         string        `config:"drift.meta_table"`
+	Region            string        `config:"drift.region"`
+	Endpoint          string        `config:"drift.endpoint"` // DynamoDB endpoint (optional, ex: DynamoDB Local)
+	Owner             string        `config:"drift.owner"`
+	ProgressTable     string        `config:"drift.progress_table"`
+	HeartbeatInterval time.Duration `config:"drift.heartbeat_interval"`
+	SnapshotInterval  time.Duration `config:"drift.snapshot_interval"`
+	SavepointInterval time.Duration `config:"drift.savepoint_interval"`
+	AutoCleanup       time.Duration `config:"drift.auto_cleanup"`
+	SafeMode          bool          `config:"drift.safe_mode"`
+	Verbosity         string        `config:"drift.verbosity"` // Log to stderr at this verbosity (optional, see ParseVerbosity)
+
+	// Defaults of runs
+	Concurrency      uint `config:"defaults.concurrency"`
+	PageSize         uint `config:"defaults.page_size"`
+	ScanSegments     uint `config:"defaults.scan_segments"`
+	FailOnFirstError bool `config:"defaults.fail_on_first_error"`
+	DryRun           bool `config:"defaults.dry_run"` // Runs should only be planned, for callers (ex: the CLI) to honor
+
+	// Pacing of table reads and writes (see Pacing), zero values disable a limit
+	TargetUtilization float64 `config:"rate_limits.target_utilization"`
+	ReadUnits         float64 `config:"rate_limits.read_units"`
+	WriteUnits        float64 `config:"rate_limits.write_units"`
+
+	// Retrying of throttled and transient errors (see RetryPolicy), zero values keep the defaults of DefaultRetryPolicy and DefaultBackoff
+	RetryMaxAttempts uint          `config:"retry.max_attempts"`
+	RetryMaxTime     time.Duration `config:"retry.max_retry_time"`
+	BackoffBase      time.Duration `config:"retry.backoff_base"`
+	BackoffCap       time.Duration `config:"retry.backoff_cap"`
+
+	// Guardrails of migrations which don't set their own (see Guardrails), zero values disable a cap
+	MaxDeletePercent float64 `config:"guardrails.max_delete_percent"`
+	MaxWritePercent  float64 `config:"guardrails.max_write_percent"`
+	MaxDeletes       uint    `config:"guardrails.max_deletes"`
+	MaxWrites        uint    `config:"guardrails.max_writes"`
+
+	// Retention policy of meta table records (see Prune), zero values disable a rule
+	KeepLast      uint          `config:"retention.keep_last"`
+	KeepNewerThan time.Duration `config:"retention.keep_newer_than"`
+
+	// Automatic rollback of failed runs (see RollbackPolicy)
+	AutoRollback      bool          `config:"rollback.enabled"`
+	RollbackMaxErrors uint          `config:"rollback.max_errors"`
+	RollbackTimeout   time.Duration `config:"rollback.timeout"`
+
+	SlackWebhookURL     string `config:"notifications.slack_webhook_url"`
+	PagerDutyRoutingKey string `config:"notifications.pagerduty_routing_key"`
+	OpsgenieAPIKey      string `config:"notifications.opsgenie_api_key"`
+
+	// Destinations of run reports (see RunReport), a local directory and/or an S3 bucket
+	ReportDir      string `config:"reports.dir"`
+	ReportS3Bucket string `config:"reports.s3_bucket"`
+	ReportS3Prefix string `config:"reports.s3_prefix"`
+	ReportOutcomes bool   `config:"reports.outcomes"` // Include the outcome of each item in reports (see OutcomeOptions)
+
+	// Destination of archived meta table records (see Archive), a table or an S3 bucket
+	ArchiveTable    string `config:"archive.table"`
+	ArchiveS3Bucket string `config:"archive.s3_bucket"`
+	ArchiveS3Prefix string `config:"archive.s3_prefix"`
+}
+
+// set parses value into the field of setting name (see the config tags)
+func (c *Config) set(name, value string) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("config") != name {
+			continue
+		}
+		var err error
+		switch p := v.Field(i).Addr().Interface().(type) {
+		case *string:
+			*p = value
+		case *uint:
+			var n uint64
+			n, err = strconv.ParseUint(value, 10, 0)
+			*p = uint(n)
+		case *bool:
+			*p, err = strconv.ParseBool(value)
+		case *float64:
+			*p, err = strconv.ParseFloat(value, 64)
+		case *time.Duration:
+			*p, err = time.ParseDuration(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value of %v: %q", name, value)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown setting %v", name)
+}
+
+// LoadEnv sets the settings of c defined in the environment, as DRIFT_ followed by the upper-cased name of the setting without its
+// section (ex: DRIFT_META_TABLE for drift.meta_table, DRIFT_CONCURRENCY for defaults.concurrency). Used after LoadConfig, the environment
+// overrides the configuration file.
+func (c *Config) LoadEnv() error {
+	t := reflect.TypeOf(c).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("config")
+		env := "DRIFT_" + strings.ToUpper(name[strings.Index(name, ".")+1:])
+		if v, ok := os.LookupEnv(env); ok {
+			if err := c.set(name, v); err != nil {
+				return fmt.Errorf("%v: %v", env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigFromEnv returns the configuration defined in the environment (see LoadEnv)
+func ConfigFromEnv() (*Config, error) {
+	c := &Config{}
+	if err := c.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// unquote strips the quotes of a string value and its trailing comment
+func unquote(v string) (string, error) {
+	end := -1
+	switch {
+	case strings.HasPrefix(v, `"`):
+		for i := 1; i < len(v); i++ {
+			if v[i] == '\\' {
+				i++ // escaped character
+			} else if v[i] == '"' {
+				end = i
+				break
+			}
+		}
+	case strings.HasPrefix(v, "'"):
+		if i := strings.Index(v[1:], "'"); i >= 0 {
+			end = i + 1 // literal string, without escapes
+		}
+	default:
+		return stripComment(v), nil
+	}
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string: %v", v)
+	}
+	if rest := strings.TrimSpace(v[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected text after string: %v", rest)
+	}
+	if v[0] == '\'' {
+		return v[1:end], nil
+	}
+	return strconv.Unquote(v[:end+1])
+}
+
+// stripComment returns the unquoted text s without its trailing comment, which starts with a # at the start of s or after whitespace
+func stripComment(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// ParseConfig reads configuration in format from r
+func ParseConfig(r io.Reader, format ConfigFormat) (*Config, error) {
+	sep := "="
+	switch format {
+	case ConfigTOML:
+	case ConfigYAML:
+		sep = ":"
+	default:
+		return nil, fmt.Errorf("unknown configuration format: %v", format)
+	}
+	c := &Config{}
+	section := ""
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		raw := s.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		head := stripComment(line) // section lines may have comments
+		switch {
+		case format == ConfigTOML && strings.HasPrefix(head, "[") && strings.HasSuffix(head, "]"):
+			section = strings.TrimSpace(head[1 : len(head)-1])
+			continue
+		case format == ConfigYAML && raw[0] != ' ' && raw[0] != '\t' && strings.HasSuffix(head, ":"):
+			section = strings.TrimSuffix(head, ":")
+			continue
+		}
+		i := strings.Index(line, sep)
+		if i <= 0 || section == "" || (format == ConfigYAML && raw[0] != ' ' && raw[0] != '\t') {
+			return nil, fmt.Errorf("line %v: expected a setting of a section: %v", n, line)
+		}
+		v, err := unquote(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", n, err)
+		}
+		if err := c.set(section+"."+strings.TrimSpace(line[:i]), v); err != nil {
+			return nil, fmt.Errorf("line %v: %v", n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %v", err)
+	}
+	return c, nil
+}
+
+// LoadConfig reads the configuration file at path, in TOML or YAML according to its extension (.toml, .yaml or .yml)
+func LoadConfig(path string) (*Config, error) {
+	var format ConfigFormat
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		format = ConfigTOML
+	case ".yaml", ".yml":
+		format = ConfigYAML
+	default:
+		return nil, fmt.Errorf("unknown configuration file extension: %v", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening configuration: %v", err)
+	}
+	defer f.Close()
+	return ParseConfig(f, format)
+}
+
+// Drifter returns a drifter configured by c, with a DynamoDB client for Region and Endpoint (credentials are read from the environment
+// as usual). Configured notifiers report to their default endpoints.
+func (c *Config) Drifter() (*DynamoDrifter, error) {
+	if c.MetaTable == "" {
+		return nil, fmt.Errorf("meta table is required")
+	}
+	var verbosity Verbosity
+	if c.Verbosity != "" {
+		var err error
+		if verbosity, err = ParseVerbosity(c.Verbosity); err != nil {
+			return nil, err
+		}
+	}
+	cfg := aws.NewConfig()
+	if c.Region != "" {
+		cfg = cfg.WithRegion(c.Region)
+	}
+	if c.Endpoint != "" {
+		cfg = cfg.WithEndpoint(c.Endpoint)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %v", err)
+	}
+	dd := &DynamoDrifter{
+		MetaTableName:     c.MetaTable,
+		DynamoDB:          dynamodb.New(sess),
+		HeartbeatInterval: c.HeartbeatInterval,
+		SnapshotInterval:  c.SnapshotInterval,
+		SavepointInterval: c.SavepointInterval,
+		ProgressTable:     c.ProgressTable,
+		Owner:             c.Owner,
+		AutoCleanup:       c.AutoCleanup,
+		SafeMode:          c.SafeMode,
+		Notifiers:         c.notifiers(),
+		ReportSinks:       c.reportSinks(sess),
+		Verbosity:         verbosity,
+		ArchiveTable:      c.ArchiveTable,
+	}
+	if c.ArchiveS3Bucket != "" {
+		dd.ArchiveS3 = &S3Archive{S3: s3.New(sess), Bucket: c.ArchiveS3Bucket, Prefix: c.ArchiveS3Prefix}
+	}
+	if c.Verbosity != "" {
+		dd.Logger = log.New(os.Stderr, "drift: ", log.LstdFlags)
+	}
+	if p := (Pacing{TargetUtilization: c.TargetUtilization, ReadUnits: c.ReadUnits, WriteUnits: c.WriteUnits}); p != (Pacing{}) {
+		dd.Pacing = &p
+	}
+	dd.RetryPolicy = c.retryPolicy()
+	g := Guardrails{
+		MaxDeletePercent: c.MaxDeletePercent,
+		MaxWritePercent:  c.MaxWritePercent,
+		MaxDeletes:       c.MaxDeletes,
+		MaxWrites:        c.MaxWrites,
+	}
+	if g != (Guardrails{}) {
+		dd.Guardrails = &g
+	}
+	if c.KeepLast != 0 || c.KeepNewerThan != 0 {
+		dd.Retention = &RetentionPolicy{KeepLast: c.KeepLast, KeepNewerThan: c.KeepNewerThan}
+	}
+	if c.ReportOutcomes {
+		dd.Outcomes = &OutcomeOptions{ReportKeys: true}
+	}
+	if c.AutoRollback {
+		dd.Rollback = &RollbackPolicy{MaxErrors: c.RollbackMaxErrors, Timeout: c.RollbackTimeout}
+	}
+	return dd, nil
+}
+
+// notifiers returns the configured notifiers
+func (c *Config) notifiers() []Notifier {
+	ns := []Notifier{}
+	if c.SlackWebhookURL != "" {
+		ns = append(ns, &SlackNotifier{WebhookURL: c.SlackWebhookURL})
+	}
+	if c.PagerDutyRoutingKey != "" {
+		ns = append(ns, &PagerDutyNotifier{RoutingKey: c.PagerDutyRoutingKey})
+	}
+	if c.OpsgenieAPIKey != "" {
+		ns = append(ns, &OpsgenieNotifier{APIKey: c.OpsgenieAPIKey})
+	}
+	return ns
+}
+
+// reportSinks returns the configured report sinks
+func (c *Config) reportSinks(sess *session.Session) []ReportSink {
+	rs := []ReportSink{}
+	if c.ReportDir != "" {
+		rs = append(rs, &FileReportSink{Dir: c.ReportDir})
+	}
+	if c.ReportS3Bucket != "" {
+		rs = append(rs, &S3ReportSink{S3: s3.New(sess), Bucket: c.ReportS3Bucket, Prefix: c.ReportS3Prefix})
+	}
+	return rs
+}
+
+// ApplyDefaults sets the page size and scan segments of migration to the configured defaults where they are not set
+func (c *Config) ApplyDefaults(migration *DynamoDrifterMigration) {
+	if migration.PageSize == 0 {
+		migration.PageSize = c.PageSize
+	}
+	if migration.ScanSegments == 0 {
+		migration.ScanSegments = c.ScanSegments
+	}
+}
+
+// retryPolicy returns the retry policy of the configuration, or nil if it keeps the defaults
+func (c *Config) retryPolicy() *RetryPolicy {
+	if c.RetryMaxAttempts == 0 && c.RetryMaxTime == 0 && c.BackoffBase == 0 && c.BackoffCap == 0 {
+		return nil
+	}
+	rp := DefaultRetryPolicy
+	if c.RetryMaxAttempts != 0 {
+		rp.Budget.MaxAttempts = c.RetryMaxAttempts
+	}
+	if c.RetryMaxTime != 0 {
+		rp.Budget.MaxRetryTime = c.RetryMaxTime
+	}
+	if c.BackoffBase != 0 || c.BackoffCap != 0 {
+		eb, _ := DefaultBackoff.(ExponentialBackoff)
+		if c.BackoffBase != 0 {
+			eb.Base = c.BackoffBase
+		}
+		if c.BackoffCap != 0 {
+			eb.Cap = c.BackoffCap
+		}
+		rp.Backoff = eb
+	}
+	return &rp
+}
@@ -0,0 +1,160 @@
+package drift
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	toml := `
+# drift settings
+[drift] # settings
+meta_table = "migrations" # the "main" table
+region = 'us-west-2'
+heartbeat_interval = "30s"
+
+[defaults]
+concurrency = 4
+fail_on_first_error = true
+
+[rate_limits]
+target_utilization = 0.25
+write_units = 50
+
+[notifications]
+slack_webhook_url = "https://hooks.slack.com/services/x"
+`
+	yaml := `---
+drift: # settings
+  meta_table: "migrations" # the "main" table
+  region: us-west-2 # comment
+  heartbeat_interval: 30s
+defaults:
+  concurrency: 4
+  fail_on_first_error: true
+rate_limits:
+  target_utilization: 0.25
+  write_units: 50
+notifications:
+  slack_webhook_url: https://hooks.slack.com/services/x
+`
+	want := &Config{
+		MetaTable:         "migrations",
+		Region:            "us-west-2",
+		HeartbeatInterval: 30 * time.Second,
+		Concurrency:       4,
+		FailOnFirstError:  true,
+		TargetUtilization: 0.25,
+		WriteUnits:        50,
+		SlackWebhookURL:   "https://hooks.slack.com/services/x",
+	}
+	for format, conf := range map[ConfigFormat]string{ConfigTOML: toml, ConfigYAML: yaml} {
+		c, err := ParseConfig(strings.NewReader(conf), format)
+		if err != nil {
+			t.Fatalf("%v: error parsing config: %v", format, err)
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Fatalf("%v: bad config: %+v", format, c)
+		}
+	}
+	c, err := ParseConfig(strings.NewReader(`[drift]
+meta_table = "a\"b#c" # "comment"
+region = 'us#1'`), ConfigTOML)
+	if err != nil || c.MetaTable != `a"b#c` || c.Region != "us#1" {
+		t.Fatalf("bad quoted values: %+v, %v", c, err)
+	}
+	for _, conf := range []string{"meta_table = \"x\"", "[drift]\nfoo = 1", "[defaults]\nconcurrency = x", "[drift]\nregion = \"x", "[drift]\nregion = \"x\\\"", "[drift]\nregion = \"x\" y"} {
+		if _, err := ParseConfig(strings.NewReader(conf), ConfigTOML); err == nil {
+			t.Fatalf("invalid config should fail: %q", conf)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "drift.yml")
+	if err := os.WriteFile(path, []byte("drift:\n  meta_table: migrations\ndefaults:\n  page_size: 50\n"), 0644); err != nil {
+		t.Fatalf("error writing config: %v", err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	m := &DynamoDrifterMigration{ScanSegments: 2}
+	c.ApplyDefaults(m)
+	if m.PageSize != 50 || m.ScanSegments != 2 {
+		t.Fatalf("bad defaults: %+v", m)
+	}
+	dd, err := c.Drifter()
+	if err != nil || dd.MetaTableName != "migrations" || dd.DynamoDB == nil {
+		t.Fatalf("bad drifter: %+v, %v", dd, err)
+	}
+	if _, err := LoadConfig(filepath.Join(dir, "drift.ini")); err == nil {
+		t.Fatalf("unknown extension should fail")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("DRIFT_META_TABLE", "migrations")
+	t.Setenv("DRIFT_ENDPOINT", "http://localhost:8000")
+	t.Setenv("DRIFT_CONCURRENCY", "8")
+	t.Setenv("DRIFT_DRY_RUN", "true")
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("error reading environment: %v", err)
+	}
+	if c.MetaTable != "migrations" || c.Endpoint != "http://localhost:8000" || c.Concurrency != 8 || !c.DryRun {
+		t.Fatalf("bad config: %+v", c)
+	}
+	c, err = ParseConfig(strings.NewReader("[defaults]\nconcurrency = 2\npage_size = 10\n"), ConfigTOML)
+	if err != nil {
+		t.Fatalf("error parsing config: %v", err)
+	}
+	if err := c.LoadEnv(); err != nil || c.Concurrency != 8 || c.PageSize != 10 {
+		t.Fatalf("environment should override the file: %+v, %v", c, err)
+	}
+	t.Setenv("DRIFT_MAX_DELETE_PERCENT", "5")
+	c, err = ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("error reading environment: %v", err)
+	}
+	if dd, err := c.Drifter(); err != nil || dd.Guardrails == nil || dd.Guardrails.MaxDeletePercent != 5 {
+		t.Fatalf("guardrails should be configured: %+v, %v", dd, err)
+	}
+	t.Setenv("DRIFT_MAX_ATTEMPTS", "8")
+	t.Setenv("DRIFT_BACKOFF_CAP", "1m")
+	c, err = ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("error reading environment: %v", err)
+	}
+	dd, err := c.Drifter()
+	if err != nil || dd.RetryPolicy == nil || dd.RetryPolicy.Budget.MaxAttempts != 8 || dd.RetryPolicy.Budget.MaxRetryTime != DefaultRetryPolicy.Budget.MaxRetryTime {
+		t.Fatalf("retry policy should be configured: %+v, %v", dd, err)
+	}
+	if eb, ok := dd.RetryPolicy.Backoff.(ExponentialBackoff); !ok || eb.Cap != time.Minute || eb.Base != DefaultBackoff.(ExponentialBackoff).Base || eb.Jitter != FullJitter {
+		t.Fatalf("bad backoff: %+v", dd.RetryPolicy.Backoff)
+	}
+	t.Setenv("DRIFT_PAGE_SIZE", "x")
+	if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "DRIFT_PAGE_SIZE") {
+		t.Fatalf("invalid variable should fail: %v", err)
+	}
+}
+
+func TestConfigVerbosity(t *testing.T) {
+	c := &Config{MetaTable: "migrations", Region: "us-west-2", Verbosity: "debug"}
+	dd, err := c.Drifter()
+	if err != nil {
+		t.Fatalf("error creating drifter: %v", err)
+	}
+	if dd.Verbosity != VerbosityDebug || dd.Logger == nil {
+		t.Fatalf("drifter should log at debug verbosity: %v, %v", dd.Verbosity, dd.Logger)
+	}
+	c.Verbosity = "loud"
+	if _, err := c.Drifter(); err == nil {
+		t.Fatalf("unknown verbosity should fail")
+	}
+}
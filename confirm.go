@@ -0,0 +1,48 @@
+package drift
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrNotConfirmed is returned by ConfirmPlan when the operator doesn't confirm a destructive plan
+var ErrNotConfirmed = errors.New("plan not confirmed")
+
+// Destructive returns whether the plan deletes items or exceeds a guardrail, in which case it should be confirmed before the migration is
+// run (see ConfirmPlan)
+func (p *Plan) Destructive() bool {
+	for _, c := range p.Actions {
+		if c.Deletes != 0 {
+			return true
+		}
+	}
+	for _, g := range p.Guardrails {
+		if g.Exceeded {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfirmPlan asks the operator to confirm a destructive plan (see Plan.Destructive) before its migration is run, similar to terraform
+// apply: the plan is written to out and the operator must type the migration number on in. It returns nil if the plan isn't destructive,
+// is confirmed or assumeYes is set (ex: by a --yes flag for automation), and ErrNotConfirmed otherwise.
+func ConfirmPlan(p *Plan, in io.Reader, out io.Writer, assumeYes bool) error {
+	if assumeYes || !p.Destructive() {
+		return nil
+	}
+	fmt.Fprintf(out, "%v\n", p)
+	fmt.Fprintf(out, "This plan deletes items or exceeds guardrails. Type the migration number (%v) to run it: ", p.Number)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return fmt.Errorf("%w: error reading confirmation: %v", ErrNotConfirmed, err)
+	}
+	if strings.TrimSpace(line) != strconv.FormatUint(uint64(p.Number), 10) {
+		return ErrNotConfirmed
+	}
+	return nil
+}
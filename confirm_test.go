@@ -0,0 +1,44 @@
+package drift
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConfirmPlan(t *testing.T) {
+	safe := &Plan{Number: 4, Actions: map[string]ActionCounts{"foo": {Updates: 3}}}
+	if safe.Destructive() {
+		t.Fatalf("plan without deletes should not be destructive")
+	}
+	if err := ConfirmPlan(safe, strings.NewReader(""), &bytes.Buffer{}, false); err != nil {
+		t.Fatalf("plan should not need confirmation: %v", err)
+	}
+	deletes := &Plan{Number: 4, TableName: "foo", Actions: map[string]ActionCounts{"foo": {Deletes: 1}}}
+	exceeded := &Plan{Number: 4, TableName: "foo", Guardrails: []GuardrailCheck{{Name: "MaxWrites", Limit: 1, Value: 2, Exceeded: true}}}
+	for _, p := range []*Plan{deletes, exceeded} {
+		if !p.Destructive() {
+			t.Fatalf("plan should be destructive: %+v", p)
+		}
+		out := &bytes.Buffer{}
+		if err := ConfirmPlan(p, strings.NewReader("4\n"), out, false); err != nil {
+			t.Fatalf("plan should be confirmed: %v", err)
+		}
+		if !strings.Contains(out.String(), "plan of migration 4") || !strings.Contains(out.String(), "Type the migration number (4)") {
+			t.Fatalf("plan should be written: %q", out.String())
+		}
+		if err := ConfirmPlan(p, strings.NewReader(" 4"), &bytes.Buffer{}, false); err != nil {
+			t.Fatalf("plan should be confirmed without newline: %v", err)
+		}
+		if err := ConfirmPlan(p, strings.NewReader("yes\n"), &bytes.Buffer{}, false); !errors.Is(err, ErrNotConfirmed) {
+			t.Fatalf("plan should not be confirmed: %v", err)
+		}
+		if err := ConfirmPlan(p, strings.NewReader(""), &bytes.Buffer{}, false); !errors.Is(err, ErrNotConfirmed) {
+			t.Fatalf("plan should not be confirmed: %v", err)
+		}
+		if err := ConfirmPlan(p, strings.NewReader(""), &bytes.Buffer{}, true); err != nil {
+			t.Fatalf("plan should be assumed confirmed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ReportKindConformance is the kind of JSON ConformanceReports, see ReportVersion
+const ReportKindConformance = "conformance"
+
+// maxConformanceSamples is the maximum number of keys of non-conforming items in a conformance report
+const maxConformanceSamples = 100
+
+// ConformanceReport is the result of checking the items of a table against its model (see CheckConformance). Reports are encoded in JSON
+// as documented by ReportVersion.
+type ConformanceReport struct {
+	Table        string                           `json:"tablename"`
+	Model        string                           `json:"model"` // Go type of the model
+	ItemsScanned uint                             `json:"items_scanned"`
+	Conforming   uint                             `json:"conforming"` // Items with their keys, and attributes of the types of the model
+	Attributes   map[string]*AttributeConformance `json:"attributes"` // Attributes of the model and of the items
+	Samples      []RawDynamoItem                  `json:"-"`          // Keys of the first non-conforming items
+}
+
+// AttributeConformance is the conformance of an attribute of the items of a table to its model
+type AttributeConformance struct {
+	InModel    bool            `json:"in_model"`
+	Present    uint            `json:"present"`    // Items with the attribute
+	Mismatched map[string]uint `json:"mismatched"` // Items with a value of another type than the model's, by type
+}
+
+// Conforms returns whether all scanned items conform to the model
+func (cr *ConformanceReport) Conforms() bool {
+	return cr.Conforming == cr.ItemsScanned
+}
+
+// MarshalJSON implements json.Marshaler, see ReportVersion
+func (cr *ConformanceReport) MarshalJSON() ([]byte, error) {
+	type report ConformanceReport // without methods
+	samples := make([]json.RawMessage, len(cr.Samples))
+	for i, s := range cr.Samples {
+		var err error
+		if samples[i], err = dynamoJSON(s); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(struct {
+		Version int    `json:"version"`
+		Kind    string `json:"kind"`
+		*report
+		Conforms bool              `json:"conforms"`
+		Samples  []json.RawMessage `json:"samples"`
+	}{ReportVersion, ReportKindConformance, (*report)(cr), cr.Conforms(), samples})
+}
+
+// CheckConformance scans table (up to sampleSize items, all of them if 0) and checks its items against the model of the table in
+// dd.Models: items conform if they have the key attributes of the model, and their attributes which are in the model have its types.
+// Attributes which aren't in the model are reported, but don't make items non-conforming.
+func (dd *DynamoDrifter) CheckConformance(ctx context.Context, table string, sampleSize uint) (*ConformanceReport, error) {
+	m := dd.Models.Model(table)
+	if m == nil {
+		return nil, fmt.Errorf("no model registered for table %v", table)
+	}
+	cr := &ConformanceReport{Table: table, Model: m.Type.String(), Attributes: map[string]*AttributeConformance{}, Samples: []RawDynamoItem{}}
+	attribute := func(name string) *AttributeConformance {
+		ac := cr.Attributes[name]
+		if ac == nil {
+			ac = &AttributeConformance{InModel: m.Attributes[name] != nil, Mismatched: map[string]uint{}}
+			cr.Attributes[name] = ac
+		}
+		return ac
+	}
+	for name := range m.Attributes {
+		attribute(name)
+	}
+	si := &dynamodb.ScanInput{TableName: aws.String(table)}
+	for {
+		if sampleSize != 0 {
+			si.Limit = aws.Int64(int64(sampleSize - cr.ItemsScanned))
+		}
+		req, so := dd.DynamoDB.ScanRequest(si)
+		if err := dd.send(ctx, req); err != nil {
+			return cr, fmt.Errorf("error scanning %v: %v", table, err)
+		}
+		for _, item := range so.Items {
+			cr.ItemsScanned++
+			conforms := true
+			keys := RawDynamoItem{}
+			for _, k := range m.keys() {
+				if item[k] == nil {
+					conforms = false
+					continue
+				}
+				keys[k] = item[k]
+			}
+			for name, av := range item {
+				ac := attribute(name)
+				ac.Present++
+				if err := m.checkAttribute(name, av); err != nil {
+					ac.Mismatched[avType(av)]++
+					conforms = false
+				}
+			}
+			if conforms {
+				cr.Conforming++
+			} else if len(cr.Samples) < maxConformanceSamples {
+				cr.Samples = append(cr.Samples, keys)
+			}
+		}
+		if len(so.LastEvaluatedKey) == 0 || sampleSize != 0 && cr.ItemsScanned >= sampleSize {
+			return cr, nil
+		}
+		si.ExclusiveStartKey = so.LastEvaluatedKey
+	}
+}
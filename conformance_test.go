@@ -0,0 +1,54 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckConformance(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte(`{"Items":[
+			{"ID":{"N":"1"},"FirstName":{"S":"Jane"},"Age":{"S":"3"}},
+			{"ID":{"N":"2"},"FirstName":{"N":"1"},"Legacy":{"S":"x"}},
+			{"FirstName":{"S":"John"}},
+			{"ID":{"N":"4"},"Nickname":{"NULL":true}}
+		]}`))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), Models: &ModelRegistry{}}
+	if _, err := dd.CheckConformance(context.Background(), "users", 0); err == nil {
+		t.Fatalf("tables without models should fail")
+	}
+	if err := RegisterModel[testModelUser](dd.Models, "users", "ID", ""); err != nil {
+		t.Fatalf("error registering model: %v", err)
+	}
+	cr, err := dd.CheckConformance(context.Background(), "users", 0)
+	if err != nil {
+		t.Fatalf("error checking conformance: %v", err)
+	}
+	if cr.ItemsScanned != 4 || cr.Conforming != 2 || cr.Conforms() || len(cr.Samples) != 2 || *cr.Samples[0]["ID"].N != "2" {
+		t.Fatalf("bad report: %+v", cr)
+	}
+	if a := cr.Attributes["FirstName"]; a.Present != 3 || a.Mismatched["N"] != 1 || !a.InModel {
+		t.Fatalf("bad attribute: %+v", a)
+	}
+	if a := cr.Attributes["Legacy"]; a.InModel || a.Present != 1 {
+		t.Fatalf("bad unknown attribute: %+v", a)
+	}
+	if a := cr.Attributes["Active"]; !a.InModel || a.Present != 0 {
+		t.Fatalf("bad missing attribute: %+v", a)
+	}
+	b, err := json.Marshal(cr)
+	if err != nil {
+		t.Fatalf("error marshaling report: %v", err)
+	}
+	doc := map[string]interface{}{}
+	json.Unmarshal(b, &doc)
+	if doc["kind"] != ReportKindConformance || doc["conforms"] != false || len(doc["samples"].([]interface{})) != 2 {
+		t.Fatalf("bad JSON report: %s", b)
+	}
+}
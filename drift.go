@@ -2,40 +2,176 @@ package drift
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/dollarshaveclub/jobmanager"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
+// ErrAlreadyApplied is returned (wrapped) by Run for migrations which have a completed meta table record
+var ErrAlreadyApplied = errors.New("migration is already applied")
+
 // RawDynamoItem models an item from DynamoDB as returned by the API
 type RawDynamoItem map[string]*dynamodb.AttributeValue
 
 // DynamoMigrationFunction is a callback run for each item in the DynamoDB table
 // item is the raw item
 // action is the DrifterAction object used to mutate/add/remove items
+//
+// The item is owned by the callback: drift does not read or reuse it once the callback is invoked, so the callback may mutate or retain it.
+// RawDynamoItems (and raw maps) passed to DrifterAction methods are queued by reference however, so they must not be mutated afterwards
+// (ex: by goroutines started by the callback) unless the migration sets CopyQueuedItems. Use item.Clone() to safely derive a modified copy.
 type DynamoMigrationFunction func(item RawDynamoItem, action *DrifterAction) error
 
+// DynamoBatchMigrationFunction is an alternative to DynamoMigrationFunction which is run once for each page of items scanned from the DynamoDB table,
+// useful for callbacks that can process many items at once (bulk lookups in external systems, batch computation, etc).
+// The items slice is reused between pages and must not be retained after the callback returns (the items themselves may be, see DynamoMigrationFunction).
+type DynamoBatchMigrationFunction func(items []RawDynamoItem, action *DrifterAction) error
+
 // DynamoDrifterMigration models an individual migration
 type DynamoDrifterMigration struct {
 	Number      uint                    `dynamodbav:"Number" json:"number"`           // Monotonic number of the migration (ascending)
 	TableName   string                  `dynamodbav:"TableName" json:"tablename"`     // DynamoDB table the migration applies to
 	Description string                  `dynamodbav:"Description" json:"description"` // Free-form description of what the migration does
 	Callback    DynamoMigrationFunction `dynamodbav:"-" json:"-"`                     // Callback for each item in the table
+
+	BatchCallback DynamoBatchMigrationFunction `dynamodbav:"-" json:"-"` // Callback for each page of items in the table (alternative to Callback)
+
+	// Optional tuning of each stage of the migration, zero values use the concurrency passed to Run/Undo
+	PageSize            uint `dynamodbav:"-" json:"-"` // Maximum items per scan page (defaults to 100 * concurrency)
+	ScanSegments        uint `dynamodbav:"-" json:"-"` // Number of parallel scan segments (defaults to 1, a sequential scan, at most 1000000)
+	CallbackConcurrency uint `dynamodbav:"-" json:"-"` // Total number of callbacks executed concurrently across all scan segments
+	ActionConcurrency   uint `dynamodbav:"-" json:"-"` // Number of queued actions executed concurrently
+
+	CopyQueuedItems bool `dynamodbav:"-" json:"-"` // Deep copy raw items/keys/values when actions are queued, so callers may keep mutating them
+
+	Versioning *Versioning `dynamodbav:"-" json:"-"` // Upgrade items to a schema version (optional)
+	Schedule   Schedule    `dynamodbav:"-" json:"-"` // Only scan pages and execute actions while the schedule is open, pausing in between (optional)
+
+	// Filter is a scan filter expression selecting the items passed to callbacks (optional), ex: "attribute_not_exists(Greeting)" for a
+	// backfill of the items which lack a new attribute. Filtered out items are still read and consume read capacity, but callbacks aren't
+	// invoked for them. Combined with the filters of Versioning and Idempotent; not applied to the items of ApplyItems.
+	Filter *Condition `dynamodbav:"-" json:"-"`
+
+	// ItemModel is the struct type callbacks unmarshal items into (optional, set by NewTypedMigration): scans only read its attributes
+	// (see Model) and the key attributes, so items passed to callbacks lack the other attributes and must not be written back whole.
+	ItemModel reflect.Type `dynamodbav:"-" json:"-"`
+
+	// CheckpointItems makes runs process the table in chunks of about CheckpointItems scanned items (callbacks, then their actions),
+	// recording the scan position in the meta table record after each chunk so an interrupted run can be resumed (see Resume) instead of
+	// restarting from the first item (optional, multi-step migrations are not checkpointed)
+	CheckpointItems uint `dynamodbav:"-" json:"-"`
+
+	// Idempotent makes updates and inserts of the migration table by the migration's actions also set the marker attribute MarkerAttribute(Number)
+	// in the same write, and scans skip items which have it, so reruns of the migration (ex: after a failure) only process items which
+	// weren't migrated yet. The marker stays on items: undo migrations should remove it (and must not be Idempotent themselves).
+	// Not supported by multi-step migrations.
+	Idempotent bool `dynamodbav:"-" json:"-"`
+
+	// ItemTransactions applies the actions queued by each invocation of Callback as one TransactWriteItems transaction, so an item is
+	// never left half-migrated by a crash between its writes. Any condition which fails cancels the transaction of the item, failing with
+	// the ActionError of its action (even for updates built with UpdateBuilder.If, which are skipped otherwise). Transactions are limited to 100 actions on distinct items, and cost twice the write capacity of
+	// individual writes. Requires Callback.
+	ItemTransactions bool `dynamodbav:"-" json:"-"`
+
+	// BatchWrites applies consecutive Insert and Delete actions (up to 25 on distinct items) as one BatchWriteItem request, retrying its
+	// unprocessed items, instead of one request per action. Updates, and Inserts which must not overwrite items in SafeMode, are still
+	// applied individually. Batches are not atomic: a failed batch fails all of its actions, though some may have been applied, and its
+	// error wraps an ActionError for each action left unapplied. Can't be combined with ItemTransactions.
+	BatchWrites bool `dynamodbav:"-" json:"-"`
+
+	// Destructive actions allowed by the migration when the drifter is in SafeMode
+	AllowsDeletes    bool `dynamodbav:"-" json:"-"` // Allow Delete actions
+	AllowsOverwrites bool `dynamodbav:"-" json:"-"` // Allow Insert actions replacing existing items
+
+	Guardrails *Guardrails `dynamodbav:"-" json:"-"` // Caps on the actions of the migration (optional, defaults to those of the drifter)
+
+	WritesTables []string `dynamodbav:"-" json:"-"` // Tables other than TableName written by the migration's actions (optional, see ImpactedTables)
+
+	// UndoMigration reverts the migration (with the same Number), run automatically when a run fails as per the drifter's Rollback policy
+	UndoMigration *DynamoDrifterMigration `dynamodbav:"-" json:"-"`
+
+	// UndoCallback reverts the changes of Callback to each item of the table (alternative to UndoMigration): the undo migration is then
+	// the migration with UndoCallback as its Callback (see UndoNumber). Not supported by multi-step migrations.
+	UndoCallback DynamoMigrationFunction `dynamodbav:"-" json:"-"`
+
+	Steps []MigrationStep `dynamodbav:"-" json:"-"` // Ordered steps of a multi-step migration (alternative to Callback and BatchCallback)
+
+	// Progress of a running (or interrupted) migration recorded in the meta table (set by drift). Applied only returns completed migrations.
+	InProgress   bool              `dynamodbav:"InProgress,omitempty" json:"in_progress,omitempty"`
+	StepProgress []StepProgress    `dynamodbav:"StepProgress,omitempty" json:"step_progress,omitempty"`
+	Heartbeat    *Heartbeat        `dynamodbav:"Heartbeat,omitempty" json:"heartbeat,omitempty"`
+	Progress     *ProgressSnapshot `dynamodbav:"Progress,omitempty" json:"progress,omitempty"`
+	Savepoint    *Savepoint        `dynamodbav:"Savepoint,omitempty" json:"savepoint,omitempty"`
+	Checkpoint   *Checkpoint       `dynamodbav:"Checkpoint,omitempty" json:"checkpoint,omitempty"`
+	AppliedAt    *time.Time        `dynamodbav:"AppliedAt,omitempty" json:"applied_at,omitempty"` // When the migration completed (unset in older records)
+
+	// Metadata of the run which applied the migration recorded in the meta table (set by drift, unset in older records). Duration and
+	// ItemsProcessed are only recorded by Run and Resume, not by RunChunk and SQS workers whose runs are split between invocations.
+	AppliedBy      string        `dynamodbav:"AppliedBy,omitempty" json:"applied_by,omitempty"`           // Owner of the run (see DynamoDrifter.Owner)
+	DriftVersion   string        `dynamodbav:"DriftVersion,omitempty" json:"drift_version,omitempty"`     // Version of the drift module of the runner
+	Duration       time.Duration `dynamodbav:"Duration,omitempty" json:"duration,omitempty"`              // Duration of the run
+	ItemsProcessed uint          `dynamodbav:"ItemsProcessed,omitempty" json:"items_processed,omitempty"` // Items passed to the callbacks of the run
+
+	clones map[string]string // tables replaced by their clone in rehearsals (see Rehearse)
 }
 
-// DynamoDrifter is the object that manages and performs migrations
+// DynamoDrifter is the object that manages and performs migrations.
+//
+// The DynamoDB client is usually a *dynamodb.DynamoDB, but any dynamodbiface.DynamoDBAPI works, so migrations can be tested against a mock.
+// drift makes its requests with the XRequest methods of the client (ex: ScanRequest), which mocks must implement: clients lacking them fail
+// validation. Mocks only implementing the methods sending requests (ex: Scan), the usual way of mocking dynamodbiface.DynamoDBAPI, can be
+// wrapped with drifttest.MockClient. Transactions and table clones also need the NewRequest method of *dynamodb.DynamoDB.
 type DynamoDrifter struct {
-	MetaTableName string             // Table to store migration tracking metadata
-	DynamoDB      *dynamodb.DynamoDB // Fully initialized and authenticated DynamoDB client
-	q             actionQueue
+	MetaTableName  string                    // Table to store migration tracking metadata
+	DynamoDB       dynamodbiface.DynamoDBAPI // Fully initialized and authenticated DynamoDB client
+	RetryPolicy    *RetryPolicy              // Retry policy for scans, actions and meta table records (optional, defaults to DefaultRetryPolicy)
+	Retryer        request.Retryer           // SDK retryer used for all DynamoDB requests made by drift (optional, defaults to the client's retryer)
+	RequestOptions []RequestOption           // Options applied to all DynamoDB requests made by drift (optional)
+	Pacing         *Pacing                   // Pace table reads and writes by consumed capacity (optional)
+	Profiling      *Profiling                // Capture CPU/heap profiles around each run (optional)
+
+	HeartbeatInterval time.Duration       // Interval of heartbeat updates in the meta table record of running migrations (optional, see Heartbeat)
+	Owner             string              // Identifies this process in heartbeats and progress snapshots (optional, defaults to DefaultOwner())
+	SnapshotInterval  time.Duration       // Interval of progress snapshots of running migrations (optional, see ProgressSnapshot)
+	ProgressFunc      func(ProgressEvent) // Called with the progress of running migrations, at their start and end and every ProgressInterval (optional)
+	ProgressInterval  time.Duration       // Interval of ProgressFunc calls (defaults to DefaultProgressInterval)
+	SavepointInterval time.Duration       // Interval of savepoints of the actions applied by running migrations (optional, see Savepoint)
+	ProgressTable     string              // Table to store progress snapshots in, instead of the meta table (optional, created by Init)
+	Notifiers         []Notifier          // Notified when runs start and end (optional)
+	ReportSinks       []ReportSink        // Receive the report of each run when it ends (optional, see RunReport)
+	Outcomes          *OutcomeOptions     // Track the outcome of each item processed by runs (optional)
+	AutoCleanup       time.Duration       // Before each rehearsal, delete the temporary resources of all runs older than this (optional, see Cleanup)
+	Logger            Logger              // Receives log output (optional, no logging if nil)
+	Verbosity         Verbosity           // Level of detail of log output (defaults to VerbosityNormal)
+
+	// SafeMode rejects destructive actions of migrations which don't explicitly allow them: Delete fails when the action is queued unless
+	// the migration sets AllowsDeletes, and unless it sets AllowsOverwrites, Inserts are conditional on the item not existing yet and fail
+	// (instead of replacing it) when it does. Rejected actions return errors wrapping ErrUnsafeAction.
+	SafeMode bool
+
+	Guardrails *Guardrails      // Caps on the actions of migrations which don't set their own (optional)
+	Models     *ModelRegistry   // Models of the tables, validating the actions queued on them (optional, see ActionFor)
+	Registry   *Registry        // Migrations of the application (optional, see Register and RunAll)
+	Retention  *RetentionPolicy // Meta table records kept by Prune (optional)
+	Rollback   *RollbackPolicy  // Undo failed runs of migrations with an UndoMigration (optional)
+	Locking    *LockPolicy      // Hold a lock during runs, so concurrent processes don't run migrations concurrently (optional)
+	ForceUndo  bool             // Undo migrations applied before other migrations (see Undo)
+
+	ArchiveTable string     // Table to move old meta table records to (optional, created by Init, see Archive)
+	ArchiveS3    *S3Archive // Alternative destination of archived records (optional, see Archive)
+	q            actionQueue
 }
 
 func (dd *DynamoDrifter) createMetaTable(pwrite, pread uint, metatable string) error {
@@ -58,8 +194,8 @@ func (dd *DynamoDrifter) createMetaTable(pwrite, pread uint, metatable string) e
 			WriteCapacityUnits: aws.Int64(int64(pwrite)),
 		},
 	}
-	_, err := dd.DynamoDB.CreateTable(cti)
-	return err
+	req, _ := dd.DynamoDB.CreateTableRequest(cti)
+	return dd.send(context.Background(), req)
 }
 
 func (dd *DynamoDrifter) findTable(table string) (bool, error) {
@@ -67,7 +203,9 @@ func (dd *DynamoDrifter) findTable(table string) (bool, error) {
 	var lto *dynamodb.ListTablesOutput
 	lti := &dynamodb.ListTablesInput{}
 	for {
-		lto, err = dd.DynamoDB.ListTables(lti)
+		var req *request.Request
+		req, lto = dd.DynamoDB.ListTablesRequest(lti)
+		err = dd.send(context.Background(), req)
 		if err != nil {
 			return false, fmt.Errorf("error listing tables: %v", err)
 		}
@@ -83,11 +221,11 @@ func (dd *DynamoDrifter) findTable(table string) (bool, error) {
 	}
 }
 
-// Init creates the metadata table if necessary. It is safe to run Init multiple times (it's a noop if metadata table already exists).
+// Init creates the metadata table (and ProgressTable if set) if necessary. It is safe to run Init multiple times (it's a noop if metadata table already exists).
 // pread and pwrite are the provisioned read and write values to use with table creation, if necessary
 func (dd *DynamoDrifter) Init(pwrite, pread uint) error {
-	if dd.DynamoDB == nil {
-		return fmt.Errorf("DynamoDB client is required")
+	if err := checkClient(dd.DynamoDB, "ListTablesRequest", "CreateTableRequest"); err != nil {
+		return err
 	}
 	extant, err := dd.findTable(dd.MetaTableName)
 	if err != nil {
@@ -99,37 +237,60 @@ func (dd *DynamoDrifter) Init(pwrite, pread uint) error {
 			return fmt.Errorf("error creating meta table: %v", err)
 		}
 	}
+	if dd.ProgressTable != "" {
+		extant, err = dd.findTable(dd.ProgressTable)
+		if err != nil {
+			return fmt.Errorf("error checking if progress table exists: %v", err)
+		}
+		if !extant {
+			err = dd.createMetaTable(pwrite, pread, dd.ProgressTable)
+			if err != nil {
+				return fmt.Errorf("error creating progress table: %v", err)
+			}
+		}
+	}
+	if dd.ArchiveTable != "" {
+		extant, err = dd.findTable(dd.ArchiveTable)
+		if err != nil {
+			return fmt.Errorf("error checking if archive table exists: %v", err)
+		}
+		if !extant {
+			err = dd.createMetaTable(pwrite, pread, dd.ArchiveTable)
+			if err != nil {
+				return fmt.Errorf("error creating archive table: %v", err)
+			}
+		}
+	}
 	return nil
 }
 
-// Applied returns all applied migrations as tracked in metadata table in ascending order
-func (dd *DynamoDrifter) Applied() ([]DynamoDrifterMigration, error) {
-	if dd.DynamoDB == nil {
-		return nil, fmt.Errorf("DynamoDB client is required")
-	}
+// metaRecords returns all migration records of the meta table in ascending order
+func (dd *DynamoDrifter) metaRecords(ctx context.Context) ([]DynamoDrifterMigration, error) {
 	in := &dynamodb.ScanInput{
 		TableName: &dd.MetaTableName,
 	}
 	ms := []DynamoDrifterMigration{}
-	var consumeErr error
-	consumePage := func(resp *dynamodb.ScanOutput, last bool) bool {
+	for {
+		req, resp := dd.DynamoDB.ScanRequest(in)
+		err := dd.send(ctx, req)
+		if err != nil {
+			return nil, err
+		}
 		for _, v := range resp.Items {
+			if n := v["Number"]; n != nil && strings.HasPrefix(aws.StringValue(n.N), "-") {
+				continue // lock or temporary resource record
+			}
 			m := DynamoDrifterMigration{}
-			consumeErr = dynamodbattribute.UnmarshalMap(v, &m)
-			if consumeErr != nil {
-				return false // stop paging
+			err = dynamodbattribute.UnmarshalMap(v, &m)
+			if err != nil {
+				return nil, err
 			}
 			ms = append(ms, m)
 		}
-		return true
-	}
-
-	err := dd.DynamoDB.ScanPages(in, consumePage)
-	if err != nil {
-		return nil, err
-	}
-	if consumeErr != nil {
-		return nil, consumeErr
+		if len(resp.LastEvaluatedKey) == 0 {
+			break
+		}
+		in.ExclusiveStartKey = resp.LastEvaluatedKey
 	}
 
 	// sort by Number
@@ -138,23 +299,22 @@ func (dd *DynamoDrifter) Applied() ([]DynamoDrifterMigration, error) {
 	return ms, nil
 }
 
-func (dd *DynamoDrifter) doCallback(ctx context.Context, params ...interface{}) error {
-	if len(params) != 3 {
-		return fmt.Errorf("bad parameter count: %v (want 3)", len(params))
-	}
-	callback, ok := params[0].(DynamoMigrationFunction)
-	if !ok {
-		return fmt.Errorf("bad type for DynamoMigrationFunction: %T", params[0])
+// Applied returns all applied migrations as tracked in metadata table in ascending order (migrations which are still in progress are excluded)
+func (dd *DynamoDrifter) Applied() ([]DynamoDrifterMigration, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
 	}
-	item, ok := params[1].(map[string]*dynamodb.AttributeValue)
-	if !ok {
-		return fmt.Errorf("bad type for RawDynamoItem: %T", params[1])
+	records, err := dd.metaRecords(context.Background())
+	if err != nil {
+		return nil, err
 	}
-	da, ok := params[2].(*DrifterAction)
-	if !ok {
-		return fmt.Errorf("bad type for *DrifterAction: %T", params[2])
+	ms := []DynamoDrifterMigration{}
+	for _, m := range records {
+		if !m.InProgress {
+			ms = append(ms, m)
+		}
 	}
-	return callback(item, da)
+	return ms, nil
 }
 
 type errorCollector struct {
@@ -162,10 +322,13 @@ type errorCollector struct {
 	errs []error
 }
 
-func (ec *errorCollector) clear() {
+// take returns the collected errors and resets the collector
+func (ec *errorCollector) take() []error {
 	ec.Lock()
-	ec.errs = []error{}
-	ec.Unlock()
+	defer ec.Unlock()
+	errs := ec.errs
+	ec.errs = nil
+	return errs
 }
 
 func (ec *errorCollector) HandleError(err error) error {
@@ -175,12 +338,13 @@ func (ec *errorCollector) HandleError(err error) error {
 	return nil
 }
 
-func (dd *DynamoDrifter) progressMsg(cp, ae uint, cerrs, aerrs []error, progressChan chan *MigrationProgress) {
+func (dd *DynamoDrifter) progressMsg(cp, ae, aq uint, cerrs, aerrs []error, progressChan chan *MigrationProgress) {
 	if progressChan != nil {
 		select {
 		case progressChan <- &MigrationProgress{
 			CallbacksProcessed: cp,
 			ActionsExecuted:    ae,
+			ActionsQueued:      aq,
 			CallbackErrors:     cerrs,
 			ActionErrors:       aerrs,
 		}:
@@ -191,68 +355,260 @@ func (dd *DynamoDrifter) progressMsg(cp, ae uint, cerrs, aerrs []error, progress
 	}
 }
 
-// runCallbacks gets items from the target table in batches of size concurrency, populates a JobManager with them and then executes all jobs in parallel
-func (dd *DynamoDrifter) runCallbacks(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, scanLimit uint, failOnFirstError bool, progressChan chan *MigrationProgress) (*DrifterAction, []error) {
+// newDrifterAction returns the DrifterAction collecting the actions of a run of migration
+func (dd *DynamoDrifter) newDrifterAction(migration *DynamoDrifterMigration) *DrifterAction {
+	var marker string
+	if migration.Idempotent {
+		marker = MarkerAttribute(migration.Number)
+	}
+	return &DrifterAction{
+		dyn:          dd.DynamoDB,
+		retry:        newRetrier(dd.RetryPolicy),
+		pace:         newPacer(dd),
+		copyItems:    migration.CopyQueuedItems,
+		version:      migration.Versioning,
+		marker:       marker,
+		clones:       migration.clones,
+		table:        migration.TableName,
+		models:       dd.Models,
+		send:         dd.send,
+		noDeletes:    dd.SafeMode && !migration.AllowsDeletes,
+		noOverwrites: dd.SafeMode && !migration.AllowsOverwrites,
+	}
+}
+
+// runCallbacks scans the table and executes the callbacks of migration. bounds optionally bounds the scan of each segment (see RunChunk),
+// segments with a nil bound are skipped.
+func (dd *DynamoDrifter) runCallbacks(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, scanLimit uint, failOnFirstError bool, bounds []*scanBounds, progressChan chan *MigrationProgress) (*DrifterAction, []error) {
+	da := dd.newDrifterAction(migration)
+	if migration.CallbackConcurrency != 0 {
+		concurrency = migration.CallbackConcurrency
+	}
+	segments := migration.ScanSegments
+	if segments == 0 {
+		segments = 1
+	}
+	parent := ctx
+	ctx, cncl := context.WithCancel(ctx)
+	defer cncl()
+	sem := make(chan struct{}, concurrency) // limits total concurrent callbacks across all segments
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	var cp uint
+	var failed bool
 	errs := []error{}
-	ec := errorCollector{}
-	da := &DrifterAction{}
-	var jm *jobmanager.JobManager
-	getnewjm := func() {
-		jm = jobmanager.New()
-		jm.ErrorHandler = &ec
-		jm.Concurrency = concurrency
-		jm.Identifier = "migration-callbacks"
-		jm.Logger = log.New(ioutil.Discard, "", log.LstdFlags)
-	}
-	getnewjm()
+	progress := func(n uint, perrs []error, fatal bool) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		errs = append(errs, perrs...)
+		if fatal {
+			failed = true
+			cncl()
+			return
+		}
+		cp += n
+		dd.progressMsg(cp, 0, 0, perrs, nil, progressChan)
+	}
+	for seg := uint(0); seg < segments; seg++ {
+		var b *scanBounds
+		if bounds != nil {
+			if b = bounds[seg]; b == nil {
+				continue
+			}
+		}
+		wg.Add(1)
+		go func(seg uint) {
+			defer wg.Done()
+			dd.scanSegment(ctx, migration, da, seg, segments, concurrency, scanLimit, failOnFirstError, b, sem, progress)
+		}(seg)
+	}
+	wg.Wait()
+	if err := parent.Err(); err != nil {
+		// segments stop once ctx is done, the scan is incomplete
+		return nil, append(errs, fmt.Errorf("scan of migration table interrupted: %w", err))
+	}
+	if failed {
+		return nil, errs
+	}
+	da.scanned = cp
+	return da, errs
+}
+
+// scanSegment scans an individual segment of the migration table (all of it if segments == 1) and runs callbacks for each page of items.
+// progress is called for each page processed, or with fatal set on unrecoverable errors.
+func (dd *DynamoDrifter) scanSegment(ctx context.Context, migration *DynamoDrifterMigration, da *DrifterAction, segment, segments, concurrency uint, scanLimit uint, failOnFirstError bool, b *scanBounds, sem chan struct{}, progress func(n uint, errs []error, fatal bool)) {
+	var pool *workerPool[RawDynamoItem]
+	var batch []RawDynamoItem
+	if migration.BatchCallback == nil {
+		pool = newWorkerPool(ctx, concurrency, func(ctx context.Context, f func(ctx context.Context) error) error {
+			return withLabels(ctx, migration, "callbacks", f, "segment", strconv.Itoa(int(segment)))
+		}, func(ctx context.Context, item RawDynamoItem) error {
+			rec := outcomesFrom(ctx)
+			if ok, err := migration.admit(item); !ok {
+				if rec != nil {
+					rec.skipped(item, err)
+				}
+				return err
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			var err error
+			switch {
+			case rec != nil:
+				ida := da.forItem()
+				err = migration.Callback(item, ida)
+				rec.processed(ida.group, item, err)
+			case migration.ItemTransactions:
+				err = migration.Callback(item, da.forItem())
+			default:
+				err = migration.Callback(item, da)
+			}
+			itemCounterFrom(ctx).add(1)
+			reporterFrom(ctx).called(err)
+			return err
+		})
+		defer pool.close()
+	}
 	si := &dynamodb.ScanInput{
-		ConsistentRead: aws.Bool(true),
-		TableName:      &migration.TableName,
-		Limit:          aws.Int64(int64(scanLimit)),
+		ConsistentRead:         aws.Bool(true),
+		TableName:              &migration.TableName,
+		Limit:                  aws.Int64(int64(scanLimit)),
+		ReturnConsumedCapacity: da.pace.returnConsumedCapacity(),
+	}
+	filter, names, values, err := migration.scanFilter()
+	if err != nil {
+		progress(0, []error{fmt.Errorf("error filtering migration table (segment %v): %w", segment, err)}, true)
+		return
+	}
+	if filter != "" {
+		si.FilterExpression = aws.String(filter)
+		si.ExpressionAttributeNames = names
+		si.ExpressionAttributeValues = values
+	}
+	projection, pnames, err := dd.projection(ctx, migration)
+	if err != nil {
+		progress(0, []error{fmt.Errorf("error projecting migration table (segment %v): %w", segment, err)}, true)
+		return
+	}
+	if projection != "" {
+		si.ProjectionExpression = aws.String(projection)
+		if si.ExpressionAttributeNames == nil {
+			si.ExpressionAttributeNames = map[string]*string{}
+		}
+		for p, name := range pnames {
+			si.ExpressionAttributeNames[p] = name
+		}
+	}
+	if segments > 1 {
+		si.Segment = aws.Int64(int64(segment))
+		si.TotalSegments = aws.Int64(int64(segments))
+	}
+	if b != nil {
+		si.ExclusiveStartKey = b.start
 	}
-	var cp uint
 	for {
-		so, err := dd.DynamoDB.Scan(si)
+		if b != nil && b.maxItems-b.scanned < scanLimit {
+			si.Limit = aws.Int64(int64(b.maxItems - b.scanned))
+		}
+		if err := waitForSchedule(ctx, migration.Schedule); err != nil {
+			if ctx.Err() == nil {
+				progress(0, []error{fmt.Errorf("error waiting for schedule (segment %v): %w", segment, err)}, true)
+			}
+			return
+		}
+		var so *dynamodb.ScanOutput
+		err := da.retry.do(ctx, func() error {
+			if err := da.pace.wait(ctx, migration.TableName, false); err != nil {
+				return err
+			}
+			var req *request.Request
+			req, so = dd.DynamoDB.ScanRequest(si)
+			err := dd.send(ctx, req)
+			da.pace.consumed(so.ConsumedCapacity, false)
+			return err
+		})
 		if err != nil {
-			return nil, []error{fmt.Errorf("error scanning migration table: %v", err)}
+			if ctx.Err() != nil {
+				return // another segment failed, or the run was cancelled (see runCallbacks)
+			}
+			progress(0, []error{fmt.Errorf("error scanning migration table (segment %v): %w", segment, err)}, true)
+			return
+		}
+		reporterFrom(ctx).scanned(aws.Int64Value(so.ScannedCount))
+		progressTrackerFrom(ctx).page()
+		var perrs []error
+		if pool != nil {
+			for _, item := range so.Items {
+				pool.submit(item)
+			}
+			perrs = pool.wait()
+			if ctx.Err() != nil {
+				progress(0, perrs, true) // callbacks of the page were skipped
+				return
+			}
+		} else {
+			batch = batch[:0]
+			for _, item := range so.Items {
+				ok, err := migration.admit(item)
+				if err != nil {
+					perrs = append(perrs, err)
+				}
+				if ok {
+					batch = append(batch, item)
+				}
+			}
 		}
-		j := &jobmanager.Job{
-			Job: dd.doCallback,
+		if pool == nil && len(batch) > 0 {
+			sem <- struct{}{}
+			err := withLabels(ctx, migration, "callbacks", func(ctx context.Context) error {
+				return migration.BatchCallback(batch, da)
+			}, "segment", strconv.Itoa(int(segment)))
+			<-sem
+			itemCounterFrom(ctx).add(len(batch))
+			reporterFrom(ctx).called(err)
+			if err != nil {
+				perrs = append(perrs, err)
+			}
 		}
-		for _, item := range so.Items {
-			jm.AddJob(j, migration.Callback, item, da)
+		if len(perrs) != 0 && failOnFirstError {
+			progress(0, perrs, true)
+			return
 		}
-		jm.Run(ctx)
-		if len(ec.errs) != 0 && failOnFirstError {
-			return nil, ec.errs
+		progress(uint(len(so.Items)), perrs, false)
+		if b != nil {
+			b.scanned += uint(aws.Int64Value(so.ScannedCount))
+			b.last, b.done = so.LastEvaluatedKey, len(so.LastEvaluatedKey) == 0
+			if b.scanned >= b.maxItems {
+				return
+			}
 		}
-		getnewjm()
-		cp += uint(len(so.Items))
-		dd.progressMsg(cp, 0, ec.errs, nil, progressChan)
-		errs = append(errs, ec.errs...)
-		ec.clear()
 		if len(so.LastEvaluatedKey) == 0 {
-			return da, errs
+			return
 		}
 		si.ExclusiveStartKey = so.LastEvaluatedKey
 	}
 }
 
-func (dd *DynamoDrifter) doAction(ctx context.Context, params ...interface{}) error {
-	if len(params) != 2 {
-		return fmt.Errorf("bad parameter length: %v (want 2)", len(params))
-	}
-	action, ok := params[0].(*action)
-	if !ok {
-		return fmt.Errorf("bad type for *action: %T", params[0])
-	}
-	tn, ok := params[1].(string)
-	if !ok {
-		return fmt.Errorf("bad type for tablename: %T", params[1])
-	}
+// actionTable returns the table of action, tn being the migration table
+func (da *DrifterAction) actionTable(action *action, tn string) (string, error) {
 	if action.tableName != "" {
 		tn = action.tableName
 	}
+	if da.clones != nil {
+		clone, ok := da.clones[tn]
+		if !ok {
+			return "", fmt.Errorf("action on table %v, which isn't cloned by the rehearsal", tn)
+		}
+		tn = clone
+	}
+	return tn, nil
+}
+
+func (dd *DynamoDrifter) doAction(ctx context.Context, action *action, tn string, da *DrifterAction) error {
+	tn, err := da.actionTable(action, tn)
+	if err != nil {
+		return err
+	}
 	switch action.atype {
 	case updateAction:
 		uii := &dynamodb.UpdateItemInput{
@@ -261,30 +617,83 @@ func (dd *DynamoDrifter) doAction(ctx context.Context, params ...interface{}) er
 			UpdateExpression:          aws.String(action.updExpr),
 			ExpressionAttributeValues: action.values,
 			ExpressionAttributeNames:  action.expAttrNames,
+			ReturnConsumedCapacity:    da.pace.returnConsumedCapacity(),
+		}
+		if action.condExpr != "" {
+			uii.ConditionExpression = aws.String(action.condExpr)
+		}
+		err := da.retry.do(ctx, func() error {
+			if err := da.pace.wait(ctx, tn, true); err != nil {
+				return err
+			}
+			req, uio := dd.DynamoDB.UpdateItemRequest(uii)
+			err := dd.send(ctx, req)
+			da.pace.consumed(uio.ConsumedCapacity, true)
+			return err
+		})
+		var aerr awserr.Error
+		if action.condExpr != "" && errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+			if action.strict {
+				return dd.actionError(ctx, action, tn, da, conditionError(action))
+			}
+			return errConditionSkipped
 		}
-		_, err := dd.DynamoDB.UpdateItem(uii)
 		if err != nil {
-			return fmt.Errorf("error updating item: %v", err)
+			return dd.actionError(ctx, action, tn, da, err)
 		}
 		return nil
 	case insertAction:
 		pii := &dynamodb.PutItemInput{
-			TableName: &tn,
-			Item:      action.item,
+			TableName:              &tn,
+			Item:                   action.item,
+			ReturnConsumedCapacity: da.pace.returnConsumedCapacity(),
+		}
+		pii.ConditionExpression, pii.ExpressionAttributeNames, pii.ExpressionAttributeValues, err = dd.writeCondition(ctx, action, tn, da)
+		if err != nil {
+			return err
+		}
+		err := da.retry.do(ctx, func() error {
+			if err := da.pace.wait(ctx, tn, true); err != nil {
+				return err
+			}
+			req, pio := dd.DynamoDB.PutItemRequest(pii)
+			err := dd.send(ctx, req)
+			da.pace.consumed(pio.ConsumedCapacity, true)
+			return err
+		})
+		var aerr awserr.Error
+		if pii.ConditionExpression != nil && errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+			return dd.actionError(ctx, action, tn, da, conditionError(action))
 		}
-		_, err := dd.DynamoDB.PutItem(pii)
 		if err != nil {
-			return fmt.Errorf("error inserting item: %v", err)
+			return dd.actionError(ctx, action, tn, da, err)
 		}
 		return nil
 	case deleteAction:
 		dii := &dynamodb.DeleteItemInput{
-			TableName: &tn,
-			Key:       action.keys,
+			TableName:              &tn,
+			Key:                    action.keys,
+			ReturnConsumedCapacity: da.pace.returnConsumedCapacity(),
 		}
-		_, err := dd.DynamoDB.DeleteItem(dii)
+		dii.ConditionExpression, dii.ExpressionAttributeNames, dii.ExpressionAttributeValues, err = dd.writeCondition(ctx, action, tn, da)
 		if err != nil {
-			return fmt.Errorf("error deleting item: %v", err)
+			return err
+		}
+		err := da.retry.do(ctx, func() error {
+			if err := da.pace.wait(ctx, tn, true); err != nil {
+				return err
+			}
+			req, dio := dd.DynamoDB.DeleteItemRequest(dii)
+			err := dd.send(ctx, req)
+			da.pace.consumed(dio.ConsumedCapacity, true)
+			return err
+		})
+		var aerr awserr.Error
+		if dii.ConditionExpression != nil && errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+			return dd.actionError(ctx, action, tn, da, conditionError(action))
+		}
+		if err != nil {
+			return dd.actionError(ctx, action, tn, da, err)
 		}
 		return nil
 	default:
@@ -293,49 +702,145 @@ func (dd *DynamoDrifter) doAction(ctx context.Context, params ...interface{}) er
 }
 
 func (dd *DynamoDrifter) executeActions(ctx context.Context, migration *DynamoDrifterMigration, da *DrifterAction, concurrency uint, failonFirstError bool, progressChan chan *MigrationProgress) []error {
-	ec := errorCollector{}
-	var jm *jobmanager.JobManager
-	getnewjm := func() { // you can only Run() a JobManager once
-		jm = jobmanager.New()
-		jm.ErrorHandler = &ec
-		jm.Concurrency = concurrency
-		jm.Identifier = "migration-actions"
-		jm.Logger = log.New(ioutil.Discard, "", log.LstdFlags)
-	}
-	getnewjm()
-	var i int
-	for i = range da.aq.q {
-		j := &jobmanager.Job{
-			Job: dd.doAction,
-		}
-		jm.AddJob(j, &(da.aq.q[i]), migration.TableName)
-		if i != 0 && i%(100*int(concurrency)) == 0 {
-			jm.Run(ctx)
-			if len(ec.errs) != 0 && failonFirstError {
-				return ec.errs
-			}
-			getnewjm()
-			dd.progressMsg(0, uint(i+1), nil, ec.errs, progressChan)
+	if migration.ActionConcurrency != 0 {
+		concurrency = migration.ActionConcurrency
+	}
+	pool := newWorkerPool(ctx, concurrency, func(ctx context.Context, f func(ctx context.Context) error) error {
+		return withLabels(ctx, migration, "actions", f)
+	}, func(ctx context.Context, unit []action) error {
+		var err error
+		if len(unit) > 1 && migration.BatchWrites && unit[0].txn == 0 {
+			err = dd.doBatch(ctx, unit, migration.TableName, da)
+		} else if len(unit) > 1 {
+			err = dd.doTransaction(ctx, unit, migration.TableName, da)
 		} else {
+			started := time.Now()
+			err = dd.doAction(ctx, &unit[0], migration.TableName, da)
+			if errors.Is(err, errConditionSkipped) {
+				dd.logAction(&unit[0], migration.TableName, time.Since(started), nil)
+			} else {
+				dd.logAction(&unit[0], migration.TableName, time.Since(started), err)
+			}
+		}
+		if rec := outcomesFrom(ctx); rec != nil {
+			rec.applied(unit, err)
+		}
+		reporterFrom(ctx).applied(unit, err)
+		if errors.Is(err, errConditionSkipped) {
+			return nil
+		}
+		return err
+	})
+	defer pool.close()
+	batch := 100 * int(concurrency)
+	errs := []error{}
+	actions := da.aq.actions()
+	unitOf := actionTransaction
+	if migration.ItemTransactions {
+		unitOf = actionGroup
+	}
+	actions = groupActions(actions, unitOf)
+	sp := savepointerFrom(ctx)
+	if sp != nil {
+		actions = orderActions(actions, unitOf)
+	}
+	rec := outcomesFrom(ctx)
+	if rec != nil {
+		rec.queued(actions)
+	}
+	reporterFrom(ctx).queued(actions)
+	start := 0
+	if sp != nil {
+		defer func() {
+			if ctx.Err() == nil {
+				sp.save() // best effort, like heartbeats
+			}
+		}()
+		var err error
+		if start, err = sp.resume(actions); err != nil {
+			dd.logf(VerbosityQuiet, "savepoint of migration %v can't be resumed, applying all %v actions: %v", migration.Number, len(actions), err)
+		} else if start != 0 {
+			dd.logf(VerbosityNormal, "migration %v resuming actions at savepoint %v/%v", migration.Number, start, len(actions))
+			dd.progressMsg(0, uint(start), uint(len(actions)), nil, nil, progressChan)
+			if rec != nil {
+				rec.applied(actions[:start], nil) // applied by the interrupted run
+			}
 		}
 	}
-	if i != 0 {
-		jm.Run(ctx)
-		dd.progressMsg(0, uint(i), nil, ec.errs, progressChan)
+	submitted := 0
+	for i := start; i < len(actions); i++ {
+		if submitted%batch == 0 {
+			if err := waitForSchedule(ctx, migration.Schedule); err != nil {
+				return append(errs, fmt.Errorf("error waiting for schedule: %w", err))
+			}
+		}
+		unit := actions[i : i+1]
+		switch {
+		case unitOf(&actions[i]) != 0:
+			unit = actions[i:unitEnd(actions, i, unitOf)]
+		case migration.BatchWrites:
+			unit = actions[i:dd.batchEnd(ctx, actions, i, migration.TableName, da)]
+		}
+		i += len(unit) - 1
+		pool.submit(unit)
+		submitted++
+		if submitted%batch != 0 && i != len(actions)-1 {
+			continue
+		}
+		berrs := pool.wait()
+		errs = append(errs, berrs...)
+		if sp != nil && len(errs) == 0 && ctx.Err() == nil {
+			sp.advance(actions, i+1) // units skipped once ctx is done fail, so all the units of the batch ran
+		}
+		if len(errs) != 0 && failonFirstError {
+			return errs
+		}
+		if err := da.retry.exhausted(); err != nil {
+			return append(errs, fmt.Errorf("aborting action execution: %w", err))
+		}
+		dd.progressMsg(0, uint(i+1), uint(len(actions)), nil, berrs, progressChan)
 	}
-	return ec.errs
+	return errs
 }
 
+// insertMetaItem records m as applied, replacing its in progress record if any, or fails with ErrAlreadyApplied if it already is
 func (dd *DynamoDrifter) insertMetaItem(m *DynamoDrifterMigration) error {
-	mi, err := dynamodbattribute.MarshalMap(m)
+	record := *m
+	now := time.Now().UTC()
+	record.AppliedAt = &now
+	record.AppliedBy, record.DriftVersion = dd.Owner, libraryVersion()
+	if record.AppliedBy == "" {
+		record.AppliedBy = DefaultOwner()
+	}
+	mi, err := dynamodbattribute.MarshalMap(&record)
 	if err != nil {
 		return fmt.Errorf("error marshaling migration: %v", err)
 	}
+	// the record of this write also matches, so a retry whose previous attempt succeeded (ex: its response was lost) doesn't fail
 	pi := &dynamodb.PutItemInput{
-		TableName: &dd.MetaTableName,
-		Item:      mi,
+		TableName:           &dd.MetaTableName,
+		Item:                mi,
+		ConditionExpression: aws.String("attribute_not_exists(#n) OR #ip = :true OR (#ab = :ab AND #at = :at)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#n":  aws.String("Number"),
+			"#ip": aws.String("InProgress"),
+			"#ab": aws.String("AppliedBy"),
+			"#at": aws.String("AppliedAt"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":true": &dynamodb.AttributeValue{BOOL: aws.Bool(true)},
+			":ab":   mi["AppliedBy"],
+			":at":   mi["AppliedAt"],
+		},
+	}
+	err = newRetrier(dd.RetryPolicy).do(context.Background(), func() error {
+		req, _ := dd.DynamoDB.PutItemRequest(pi)
+		return dd.send(context.Background(), req)
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+		return fmt.Errorf("%w: migration %v was applied by another run", ErrAlreadyApplied, m.Number)
 	}
-	_, err = dd.DynamoDB.PutItem(pi)
 	if err != nil {
 		return fmt.Errorf("error inserting migration item into meta table: %v", err)
 	}
@@ -347,20 +852,79 @@ func (dd *DynamoDrifter) deleteMetaItem(m *DynamoDrifterMigration) error {
 		TableName: &dd.MetaTableName,
 		Key: map[string]*dynamodb.AttributeValue{
 			"Number": &dynamodb.AttributeValue{
-				N: aws.String(strconv.Itoa(int(m.Number))),
+				N: aws.String(formatMigrationNumber(m.Number)),
 			},
 		},
 	}
-	_, err := dd.DynamoDB.DeleteItem(di)
+	err := newRetrier(dd.RetryPolicy).do(context.Background(), func() error {
+		req, _ := dd.DynamoDB.DeleteItemRequest(di)
+		return dd.send(context.Background(), req)
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting item from meta table: %v", err)
 	}
 	return nil
 }
 
-func (dd *DynamoDrifter) run(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) []error {
-	if migration == nil || migration.Callback == nil {
-		return []error{fmt.Errorf("migration is required")}
+// validateMigration checks migration before a run
+func validateMigration(migration *DynamoDrifterMigration) error {
+	if migration != nil && len(migration.Steps) > 0 {
+		if err := validateSteps(migration); err != nil {
+			return err
+		}
+	} else if err := validateCallbacks(migration); err != nil {
+		return err
+	}
+	if migration.TableName == "" {
+		return fmt.Errorf("TableName is required")
+	}
+	switch {
+	case migration.UndoMigration != nil && migration.UndoCallback != nil:
+		return fmt.Errorf("only one of UndoMigration and UndoCallback may be set")
+	case migration.UndoCallback != nil && len(migration.Steps) > 0:
+		return fmt.Errorf("UndoCallback isn't supported by multi-step migrations")
+	}
+	return nil
+}
+
+// maxScanSegments is the maximum TotalSegments of a parallel scan
+const maxScanSegments = 1000000
+
+// validateCallbacks checks that migration has exactly one of Callback and BatchCallback, and options of the scan
+func validateCallbacks(migration *DynamoDrifterMigration) error {
+	if migration == nil || (migration.Callback == nil && migration.BatchCallback == nil) {
+		return fmt.Errorf("migration is required")
+	}
+	if migration.Callback != nil && migration.BatchCallback != nil {
+		return fmt.Errorf("only one of Callback and BatchCallback may be set")
+	}
+	if migration.ItemTransactions && migration.BatchCallback != nil {
+		return fmt.Errorf("ItemTransactions requires Callback")
+	}
+	if migration.ItemTransactions && migration.BatchWrites {
+		return fmt.Errorf("only one of ItemTransactions and BatchWrites may be set")
+	}
+	if migration.Filter != nil && migration.Filter.Expression == "" {
+		return fmt.Errorf("Filter expression is required")
+	}
+	if migration.ScanSegments > maxScanSegments {
+		return fmt.Errorf("ScanSegments can't exceed %v, the maximum of DynamoDB", maxScanSegments)
+	}
+	return nil
+}
+
+// scanLimit returns the maximum number of items per scan page at concurrency
+func (m *DynamoDrifterMigration) scanLimit(concurrency uint) uint {
+	if m.PageSize != 0 {
+		return m.PageSize
+	}
+	return concurrency * 100
+}
+
+// run runs the callbacks and then the actions of migration, with the scan optionally bounded by bounds (see runCallbacks)
+func (dd *DynamoDrifter) run(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, bounds []*scanBounds, progressChan chan *MigrationProgress) (errs []error) {
+	if err := validateCallbacks(migration); err != nil {
+		return []error{err}
 	}
 	if concurrency == 0 {
 		concurrency = 1
@@ -375,62 +939,255 @@ func (dd *DynamoDrifter) run(ctx context.Context, migration *DynamoDrifterMigrat
 	if !extant {
 		return []error{fmt.Errorf("table %v not found", migration.TableName)}
 	}
-	defaultScanLimit := concurrency * 100
-	da, errs := dd.runCallbacks(ctx, migration, concurrency, defaultScanLimit, failOnFirstError, progressChan)
-	if len(errs) != 0 {
-		return errs
+	stopProfiling, err := dd.startProfiling()
+	if err != nil {
+		return []error{err}
+	}
+	defer func() {
+		if err := stopProfiling(); err != nil {
+			errs = append(errs, err)
+		}
+	}()
+	if rec := outcomesFrom(ctx); rec != nil && migration.Callback != nil {
+		if err := rec.scan(ctx, migration.TableName); err != nil {
+			return []error{err}
+		}
+		defer rec.flush()
+	}
+	da, cerrs := dd.runCallbacks(ctx, migration, concurrency, migration.scanLimit(concurrency), failOnFirstError, bounds, progressChan)
+	if len(cerrs) != 0 {
+		reporterFrom(ctx).failed(PhaseCallbacks, cerrs)
+		return cerrs
+	}
+	dd.logf(VerbosityVerbose, "callbacks of migration %v processed %v item(s) of table %v, queuing %v action(s)", migration.Number, da.scanned, migration.TableName, da.aq.len())
+	if err := dd.checkGuardrails(migration, da); err != nil {
+		return []error{err}
 	}
 	errs = dd.executeActions(ctx, migration, da, concurrency, failOnFirstError, progressChan)
+	errs = interruptedErrors(ctx, migration, errs)
 	if len(errs) != 0 {
+		reporterFrom(ctx).failed(PhaseActions, errs)
 		return errs
 	}
 	return []error{}
 }
 
+// interrupted returns the error of a run of migration whose context is done, which must not be recorded as complete
+func interrupted(ctx context.Context, migration *DynamoDrifterMigration) error {
+	return fmt.Errorf("migration %v interrupted: %w", migration.Number, context.Cause(ctx))
+}
+
+// interruptedErrors returns errs, the errors of a run of migration, with the interrupted error if its context is done and it has no
+// other errors, or if the lock of the run was lost (see ErrLockLost), which the errors of interrupted requests don't mention
+func interruptedErrors(ctx context.Context, migration *DynamoDrifterMigration, errs []error) []error {
+	if ctx.Err() == nil || len(errs) != 0 && !lockLost(ctx) {
+		return errs
+	}
+	for _, err := range errs {
+		if errors.Is(err, ErrLockLost) {
+			return errs
+		}
+	}
+	return append(errs, interrupted(ctx, migration))
+}
+
+// lockLost returns whether ctx was cancelled because the lock of the run was lost
+func lockLost(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrLockLost)
+}
+
 // MigrationProgress models periodic progress information communicated back to the caller
 type MigrationProgress struct {
 	CallbacksProcessed uint
 	ActionsExecuted    uint
+	ActionsQueued      uint // Total actions to execute (set with ActionsExecuted)
 	CallbackErrors     []error
 	ActionErrors       []error
 }
 
 // Run runs an individual migration at the specified concurrency and blocks until finished.
-// concurrency controls the number of table items processed concurrently (value of one will guarantee order of migration actions).
+// concurrency controls the number of table items processed concurrently (value of one will guarantee order of migration actions), unless overridden per stage by the migration.
 // failOnFirstError causes Run to abort on first error, otherwise the errors will be queued and reported only after all items have been processed.
-// progressChan is an optional channel on which periodic MigrationProgress messages will be sent
+// progressChan is an optional channel on which periodic MigrationProgress messages will be sent (it is closed when Run returns)
+// For multi-step migrations (see MigrationStep), the completion of each step is recorded so that running the migration again after a failure
+// resumes at the failed step.
+// If the drifter has a Rollback policy, failed runs of migrations with an UndoMigration (or UndoCallback) may be undone before Run returns (see RollbackPolicy).
+// Migrations with CheckpointItems are run from the start of the table, see Resume. See RunWithResult for the statistics of the run.
+// Applied migrations fail with ErrAlreadyApplied, instead of processing the table again: undo them first to run them again.
 func (dd *DynamoDrifter) Run(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) []error {
-	if dd.DynamoDB == nil {
-		return []error{fmt.Errorf("DynamoDB client is required")}
-	}
+	return dd.runMigration(ctx, migration, concurrency, failOnFirstError, progressChan, false, nil)
+}
+
+// runMigration runs migration as documented by Run, resuming at its checkpoint if resume is set (see Resume), and recording the
+// statistics of the run in res (optional, see RunWithResult)
+func (dd *DynamoDrifter) runMigration(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress, resume bool, res *MigrationResult) []error {
 	if progressChan != nil {
 		defer close(progressChan)
 	}
-	errs := dd.run(ctx, migration, concurrency, failOnFirstError, progressChan)
-	if len(errs) != 0 {
-		return errs
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return []error{err}
+	}
+	if err := validateMigration(migration); err != nil {
+		return []error{err}
 	}
-	err := dd.insertMetaItem(migration)
+	if m, err := dd.getMetaItem(migration.Number); err != nil {
+		return []error{err}
+	} else if m != nil && !m.InProgress {
+		return []error{fmt.Errorf("%w: migration %v has a completed meta table record", ErrAlreadyApplied, migration.Number)}
+	}
+	ctx, unlock, err := dd.lockRun(ctx)
 	if err != nil {
 		return []error{err}
 	}
-	return []error{}
+	defer dd.unlockRun(unlock)
+	if dd.Locking != nil {
+		if m, err := dd.getMetaItem(migration.Number); err != nil {
+			return []error{err}
+		} else if m != nil && !m.InProgress {
+			dd.logf(VerbosityNormal, "migration %v was applied while waiting for the lock, skipping", migration.Number)
+			if res != nil {
+				res.Skipped = true
+			}
+			return []error{}
+		}
+	}
+	started := time.Now()
+	logEnd := dd.logRunStart(migration, false)
+	ctx, items := countItems(ctx)
+	ctx = dd.startOutcomes(ctx, migration, false)
+	ctx, pc, writeReport := dd.startReport(ctx, migration, false, progressChan, res)
+	pc, notifyEnd := dd.startNotifications(migration, false, pc)
+	pc, stopHeartbeat := dd.startHeartbeat(migration, false, pc)
+	pc, stopSnapshots := dd.startSnapshots(migration, false, pc)
+	ctx, pc, stopProgress := dd.startProgress(ctx, migration, false, pc)
+	pc, executed := trackExecution(pc)
+	ctx = dd.startSavepoints(ctx, migration, false)
+	var errs []error
+	switch {
+	case len(migration.Steps) > 0:
+		errs = dd.runSteps(ctx, migration, concurrency, failOnFirstError, pc, true)
+	case migration.CheckpointItems != 0:
+		errs = dd.runCheckpointed(ctx, migration, concurrency, failOnFirstError, resume, pc)
+	default:
+		errs = dd.run(ctx, migration, concurrency, failOnFirstError, nil, pc)
+	}
+	actionsExecuted := executed()
+	stopProgress(errs)
+	stopSnapshots(errs)
+	stopHeartbeat()
+	errs = interruptedErrors(ctx, migration, errs)
+	if len(errs) == 0 {
+		record := *migration
+		record.Duration, record.ItemsProcessed = time.Since(started), items.count()
+		if err := dd.insertMetaItem(&record); err != nil {
+			errs = []error{err}
+		}
+	}
+	notifyEnd(errs)
+	writeReport(errs)
+	logEnd(errs)
+	return dd.rollback(ctx, migration, concurrency, failOnFirstError, errs, actionsExecuted)
 }
 
-// Undo "undoes" a migration by running the supplied migration but deletes the corresponding metadata record if successful
-func (dd *DynamoDrifter) Undo(ctx context.Context, undoMigration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) []error {
-	if dd.DynamoDB == nil {
-		return []error{fmt.Errorf("DynamoDB client is required")}
+// UndoNumber undoes migration number of dd.Registry with its undo migration (see UndoMigration and UndoCallback) as Undo does
+func (dd *DynamoDrifter) UndoNumber(ctx context.Context, number uint, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) []error {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return []error{err}
 	}
-	errs := dd.run(ctx, undoMigration, concurrency, failOnFirstError, progressChan)
-	if len(errs) != 0 {
-		return errs
+	var m *DynamoDrifterMigration
+	if dd.Registry != nil {
+		m = dd.Registry.get(number)
 	}
-	err := dd.deleteMetaItem(undoMigration)
-	if err != nil {
+	switch {
+	case m == nil:
+		return []error{fmt.Errorf("migration %v is not registered", number)}
+	case m.undoMigration() == nil:
+		return []error{fmt.Errorf("migration %v has no UndoMigration nor UndoCallback", number)}
+	}
+	return dd.Undo(ctx, m.undoMigration(), concurrency, failOnFirstError, progressChan)
+}
+
+// undoMigration returns the undo migration of m, its UndoMigration or derived from its UndoCallback, or nil
+func (m *DynamoDrifterMigration) undoMigration() *DynamoDrifterMigration {
+	if m.UndoMigration != nil || m.UndoCallback == nil {
+		return m.UndoMigration
+	}
+	return &DynamoDrifterMigration{
+		Number:              m.Number,
+		TableName:           m.TableName,
+		Description:         m.Description,
+		Callback:            m.UndoCallback,
+		PageSize:            m.PageSize,
+		ScanSegments:        m.ScanSegments,
+		CallbackConcurrency: m.CallbackConcurrency,
+		ActionConcurrency:   m.ActionConcurrency,
+		CopyQueuedItems:     m.CopyQueuedItems,
+		Schedule:            m.Schedule,
+		ItemTransactions:    m.ItemTransactions,
+		BatchWrites:         m.BatchWrites,
+		AllowsDeletes:       m.AllowsDeletes,
+		AllowsOverwrites:    m.AllowsOverwrites,
+		Guardrails:          m.Guardrails,
+		WritesTables:        m.WritesTables,
+	}
+}
+
+// Undo "undoes" a migration by running the supplied migration but deletes the corresponding metadata record if successful.
+// All steps of a multi-step undo migration are run (completion of steps is not recorded).
+// The migration must have a meta table record (see ErrNotApplied) and be the most recently applied migration unless ForceUndo is set (see
+// ErrNotLatest), so the table isn't processed for nothing, nor reverted under later migrations which may depend on it.
+func (dd *DynamoDrifter) Undo(ctx context.Context, undoMigration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) []error {
+	return dd.undo(ctx, undoMigration, concurrency, failOnFirstError, progressChan, nil, false)
+}
+
+// undo undoes undoMigration as documented by Undo, recording the statistics of the run in res (optional, see UndoWithResult). Rollbacks
+// (see RollbackPolicy) run under the lock of the failed run, and don't check the meta table record as failed runs have none.
+func (dd *DynamoDrifter) undo(ctx context.Context, undoMigration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress, res *MigrationResult, rollback bool) []error {
+	if err := checkClient(dd.DynamoDB); err != nil {
 		return []error{err}
 	}
-	return []error{}
+	if err := validateMigration(undoMigration); err != nil {
+		return []error{err}
+	}
+	if !rollback {
+		var unlock func() error
+		var err error
+		ctx, unlock, err = dd.lockRun(ctx)
+		if err != nil {
+			return []error{err}
+		}
+		defer dd.unlockRun(unlock)
+		if err := dd.checkUndo(undoMigration); err != nil {
+			return []error{err}
+		}
+	}
+	logEnd := dd.logRunStart(undoMigration, true)
+	ctx = dd.startOutcomes(ctx, undoMigration, true)
+	ctx, pc, writeReport := dd.startReport(ctx, undoMigration, true, progressChan, res)
+	pc, notifyEnd := dd.startNotifications(undoMigration, true, pc)
+	pc, stopHeartbeat := dd.startHeartbeat(undoMigration, true, pc)
+	pc, stopSnapshots := dd.startSnapshots(undoMigration, true, pc)
+	ctx, pc, stopProgress := dd.startProgress(ctx, undoMigration, true, pc)
+	ctx = dd.startSavepoints(ctx, undoMigration, true)
+	var errs []error
+	if len(undoMigration.Steps) > 0 {
+		errs = dd.runSteps(ctx, undoMigration, concurrency, failOnFirstError, pc, false)
+	} else {
+		errs = dd.run(ctx, undoMigration, concurrency, failOnFirstError, nil, pc)
+	}
+	stopProgress(errs)
+	stopSnapshots(errs)
+	stopHeartbeat()
+	errs = interruptedErrors(ctx, undoMigration, errs)
+	if len(errs) == 0 {
+		if err := dd.deleteMetaItem(undoMigration); err != nil {
+			errs = []error{err}
+		}
+	}
+	notifyEnd(errs)
+	writeReport(errs)
+	logEnd(errs)
+	return errs
 }
 
 type actionType int
@@ -439,6 +1196,7 @@ const (
 	updateAction actionType = iota
 	insertAction
 	deleteAction
+	conditionCheckAction // condition of a transaction, see TransactConditionCheck
 )
 
 type action struct {
@@ -447,50 +1205,146 @@ type action struct {
 	values       RawDynamoItem
 	item         RawDynamoItem
 	updExpr      string
+	condExpr     string // condition, updates whose condition fails are skipped unless strict
+	strict       bool   // the condition is a Condition, failing the action if it fails
+	noOverwrite  bool   // insert only if the item doesn't exist (see DynamoDrifter.SafeMode)
 	expAttrNames map[string]*string
 	tableName    string
-}
-
-type actionQueue struct {
-	sync.Mutex
-	q []action
+	seq          uint64 // position in the queue (starting at 1)
+	group        uint64 // callback invocation which queued the action, for migrations with ItemTransactions (starting at 1)
+	txn          uint64 // transaction queued by Transact (starting at 1), 0 for other actions
 }
 
 // DrifterAction is an object useful for performing actions within the migration callback. All actions performed by methods on DrifterAction are queued and performed *after* all existing items have been iterated over and callbacks performed.
 // DrifterAction can be used in multiple goroutines by the callback, but must not be retained after the callback returns.
+// Raw maps passed to its methods are queued by reference unless the migration sets CopyQueuedItems (see DynamoMigrationFunction).
 // If concurrency > 1, order of queued operations cannot be guaranteed.
 type DrifterAction struct {
-	dyn *dynamodb.DynamoDB
-	aq  actionQueue
+	dyn       dynamodbiface.DynamoDBAPI
+	aq        actionQueue
+	retry     *retrier
+	pace      *pacer
+	copyItems bool
+	version   *Versioning
+	clones    map[string]string                                     // tables replaced by their clone in rehearsals
+	marker    string                                                // idempotency marker attribute set by writes to the migration table ("" if the migration isn't Idempotent)
+	table     string                                                // migration table
+	models    *ModelRegistry                                        // models of the tables (see ActionFor)
+	send      func(ctx context.Context, req *request.Request) error // sends requests made for callbacks (DynamoDrifter.send)
+
+	noDeletes    bool     // reject Delete actions (see DynamoDrifter.SafeMode)
+	noOverwrites bool     // make Insert actions fail if the item exists (see DynamoDrifter.SafeMode)
+	keyAttrs     sync.Map // key attributes of tables, by table name (see keyAttributes)
+	scanned      uint     // items processed by callbacks, set once the scan completes (see Guardrails)
+
+	parent *DrifterAction // DrifterAction whose queue actions are pushed to (see forItem)
+	group  uint64         // group of the actions pushed to parent
+	groups uint64         // last group of child DrifterActions
+	txns   uint64         // last transaction queued by Transact
+	txn    bool           // queues the actions of a transaction (see forTransaction)
 }
 
-// Update mutates the given keys using fields and updateExpression.
-// keys and values are arbitrary structs with "dynamodbav" annotations. IMPORTANT: annotation names must match the names used in updateExpression.
-// updateExpression is the native DynamoDB update expression. Ex: "SET foo = :bar" (in this example keys must have a field annotated "foo" and values must have a field annotated ":bar").
-// expressionAttributeNames is optional but used if item attribute names are reserved keywords. For example: "SET #n = :name", expressionAttributeNames: map[string]string{"#n":"Name"}.
-//
-// Required: keys, values, updateExpression
-//
-// Optional: expressionAttributeNames, tableName (defaults to migration table)
-func (da *DrifterAction) Update(keys interface{}, values interface{}, updateExpression string, expressionAttributeNames map[string]string, tableName string) error {
-	var err error
-	var mkeys, mvals map[string]*dynamodb.AttributeValue
+// sendRequest sends a DynamoDB request made for callbacks (ex: lookups), with the request options of the drifter
+func (da *DrifterAction) sendRequest(ctx context.Context, req *request.Request) error {
+	if da.send == nil {
+		return sendContext(ctx, req)
+	}
+	return da.send(ctx, req)
+}
+
+// versioned returns whether actions on tableName must set the item version
+func (da *DrifterAction) versioned(tableName string) bool {
+	return da.version != nil && (tableName == "" || tableName == da.table)
+}
+
+// marked returns whether actions on tableName must set the idempotency marker
+func (da *DrifterAction) marked(tableName string) bool {
+	return da.marker != "" && (tableName == "" || tableName == da.table)
+}
+
+// own returns m, or a deep copy of it if raw maps must be copied when queued
+func (da *DrifterAction) own(m map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if da.copyItems {
+		return cloneAttributeMap(m)
+	}
+	return m
+}
+
+// marshalKeys returns the keys of an item, see Update
+func (da *DrifterAction) marshalKeys(keys interface{}) (map[string]*dynamodb.AttributeValue, error) {
 	switch v := keys.(type) {
 	case map[string]*dynamodb.AttributeValue:
-		mkeys = v
+		return da.own(v), nil
 	case RawDynamoItem:
-		mkeys = v
+		return da.own(v), nil
 	default:
-		mkeys, err = dynamodbattribute.MarshalMap(keys)
+		mkeys, err := dynamodbattribute.MarshalMap(keys)
 		if err != nil {
-			return fmt.Errorf("error marshaling keys: %v", err)
+			return nil, fmt.Errorf("error marshaling keys: %v", err)
+		}
+		return mkeys, nil
+	}
+}
+
+// push queues a, in the queue of the parent DrifterAction (as part of its group) if da queues the actions of an item (see forItem).
+// Actions on tables with a model are validated against it.
+func (da *DrifterAction) push(a action) error {
+	table := a.tableName
+	if table == "" {
+		table = da.table
+	}
+	if m := da.models.Model(table); m != nil {
+		if err := m.validate(&a); err != nil {
+			return fmt.Errorf("%w: %v", ErrModelMismatch, err)
 		}
 	}
+	da.enqueue(a)
+	return nil
+}
+
+// enqueue queues a, which is valid, see push
+func (da *DrifterAction) enqueue(a action) {
+	if da.parent != nil {
+		a.group = da.group
+		da.parent.aq.push(a)
+		return
+	}
+	da.aq.push(a)
+}
+
+// Update mutates the given keys using fields and updateExpression.
+// keys and values are arbitrary structs with "dynamodbav" annotations. IMPORTANT: annotation names must match the names used in updateExpression.
+// values can also be a map of placeholders to values, either raw (map[string]*dynamodb.AttributeValue or RawDynamoItem) or marshaled individually
+// (map[string]interface{}, ex: map[string]interface{}{":bar": 1}).
+// updateExpression is the native DynamoDB update expression. Ex: "SET foo = :bar" (in this example keys must have a field annotated "foo" and values must have a field annotated ":bar").
+// expressionAttributeNames is optional, ex: "SET #n = :name", expressionAttributeNames: map[string]string{"#n":"Name"}. Reserved words used as attribute names
+// in updateExpression are replaced by expression attribute names automatically (see IsReservedWord), so "SET Name = :name" works too.
+// The syntax of updateExpression is checked when queuing (see validateUpdateExpression), so mistakes are returned by the callback instead of failing the action.
+//
+// Required: keys, values, updateExpression
+//
+// Optional: expressionAttributeNames, tableName (defaults to migration table), condition (at most one, see Condition)
+//
+// See UpdateItem to build the expression instead.
+func (da *DrifterAction) Update(keys interface{}, values interface{}, updateExpression string, expressionAttributeNames map[string]string, tableName string, condition ...Condition) error {
+	mkeys, err := da.marshalKeys(keys)
+	if err != nil {
+		return err
+	}
+	var mvals map[string]*dynamodb.AttributeValue
 	switch v := values.(type) {
 	case map[string]*dynamodb.AttributeValue:
-		mvals = v
+		mvals = da.own(v)
 	case RawDynamoItem:
-		mvals = v
+		mvals = da.own(v)
+	case map[string]interface{}:
+		mvals = make(map[string]*dynamodb.AttributeValue, len(v))
+		for k, val := range v {
+			mvals[k], err = dynamodbattribute.Marshal(val)
+			if err != nil {
+				return fmt.Errorf("error marshaling value %v: %v", k, err)
+			}
+		}
 	default:
 		mvals, err = dynamodbattribute.MarshalMap(values)
 		if err != nil {
@@ -500,85 +1354,125 @@ func (da *DrifterAction) Update(keys interface{}, values interface{}, updateExpr
 	if updateExpression == "" {
 		return fmt.Errorf("updateExpression is required")
 	}
-	var ean map[string]*string
-	if expressionAttributeNames != nil && len(expressionAttributeNames) > 0 {
-		ean = map[string]*string{}
-		for k, v := range expressionAttributeNames {
-			ean[k] = &v
-		}
+	ean, err := newExpressionNames(expressionAttributeNames)
+	if err != nil {
+		return err
+	}
+	cond, ean, mvals, err := withCondition(condition, ean, mvals)
+	if err != nil {
+		return err
+	}
+	return da.queueUpdate(mkeys, mvals, updateExpression, ean, cond, len(condition) != 0, tableName)
+}
+
+// queueUpdate escapes reserved words in and validates an update expression (and its optional condition, which shares names and values),
+// and queues the update. Updates whose condition fails are skipped, unless strict.
+func (da *DrifterAction) queueUpdate(keys, values map[string]*dynamodb.AttributeValue, expr string, names expressionNames, cond string, strict bool, tableName string) error {
+	escaped, names := escapeReserved(expr, names)
+	if err := validateUpdateExpression(escaped, names, values); err != nil {
+		return fmt.Errorf("invalid update expression %q: %v", expr, err)
+	}
+	if cond != "" {
+		cond, names = escapeReserved(cond, names)
+	}
+	if da.versioned(tableName) {
+		escaped, values, names = da.version.bumpUpdate(escaped, values, names)
+	}
+	if da.marked(tableName) {
+		escaped, values, names = addSetClause(escaped, values, names, markerName, markerValue, da.marker, markerAttributeValue())
 	}
 	ua := action{
 		atype:        updateAction,
-		keys:         mkeys,
-		values:       mvals,
-		updExpr:      updateExpression,
-		expAttrNames: ean,
+		keys:         keys,
+		values:       values,
+		updExpr:      escaped,
+		condExpr:     cond,
+		strict:       strict,
+		expAttrNames: names,
 		tableName:    tableName,
 	}
-	da.aq.Lock()
-	da.aq.q = append(da.aq.q, ua)
-	da.aq.Unlock()
-	return nil
+	return da.push(ua)
 }
 
 // Insert inserts item into the specified table.
 // item is an arbitrary struct with "dynamodbav" annotations or a RawDynamoItem
-// tableName is optional (defaults to migration table).
-func (da *DrifterAction) Insert(item interface{}, tableName string) error {
+// tableName is optional (defaults to migration table), as is condition (at most one, see Condition).
+func (da *DrifterAction) Insert(item interface{}, tableName string, condition ...Condition) error {
 	var err error
 	var mitem map[string]*dynamodb.AttributeValue
 	switch v := item.(type) {
 	case RawDynamoItem:
-		mitem = v
+		mitem = da.own(v)
 	case map[string]*dynamodb.AttributeValue:
-		mitem = v
+		mitem = da.own(v)
 	default:
 		mitem, err = dynamodbattribute.MarshalMap(item)
 		if err != nil {
 			return fmt.Errorf("error marshaling item: %v", err)
 		}
 	}
+	if da.versioned(tableName) {
+		mitem = da.version.bumpItem(mitem)
+	}
+	if da.marked(tableName) {
+		mitem = withAttribute(mitem, da.marker, markerAttributeValue())
+	}
+	cond, names, values, err := da.condition(condition)
+	if err != nil {
+		return err
+	}
 	ia := action{
-		atype:     insertAction,
-		item:      mitem,
-		tableName: tableName,
+		atype:        insertAction,
+		item:         mitem,
+		condExpr:     cond,
+		strict:       cond != "",
+		expAttrNames: names,
+		values:       values,
+		tableName:    tableName,
+		noOverwrite:  da.noOverwrites,
 	}
-	da.aq.Lock()
-	da.aq.q = append(da.aq.q, ia)
-	da.aq.Unlock()
-	return nil
+	return da.push(ia)
+}
+
+// condition returns the escaped expression, names and values of the optional condition of an insert or delete
+func (da *DrifterAction) condition(conds []Condition) (string, expressionNames, map[string]*dynamodb.AttributeValue, error) {
+	cond, names, values, err := withCondition(conds, nil, nil)
+	if err != nil || cond == "" {
+		return "", nil, nil, err
+	}
+	cond, names = escapeReserved(cond, names)
+	return cond, names, values, nil
 }
 
 // Delete deletes the specified item(s).
 // keys is an arbitrary struct with "dynamodbav" annotations.
-// tableName is optional (defaults to migration table).
-func (da *DrifterAction) Delete(keys interface{}, tableName string) error {
-	var err error
-	var mkeys map[string]*dynamodb.AttributeValue
-	switch v := keys.(type) {
-	case map[string]*dynamodb.AttributeValue:
-		mkeys = v
-	case RawDynamoItem:
-		mkeys = v
-	default:
-		mkeys, err = dynamodbattribute.MarshalMap(keys)
-		if err != nil {
-			return fmt.Errorf("error marshaling keys: %v", err)
-		}
+// tableName is optional (defaults to migration table), as is condition (at most one, see Condition).
+func (da *DrifterAction) Delete(keys interface{}, tableName string, condition ...Condition) error {
+	if da.noDeletes {
+		return fmt.Errorf("%w: Delete requires AllowsDeletes in safe mode", ErrUnsafeAction)
+	}
+	mkeys, err := da.marshalKeys(keys)
+	if err != nil {
+		return err
+	}
+	cond, names, values, err := da.condition(condition)
+	if err != nil {
+		return err
 	}
 	dla := action{
-		atype:     deleteAction,
-		keys:      mkeys,
-		tableName: tableName,
+		atype:        deleteAction,
+		keys:         mkeys,
+		condExpr:     cond,
+		strict:       cond != "",
+		expAttrNames: names,
+		values:       values,
+		tableName:    tableName,
 	}
-	da.aq.Lock()
-	da.aq.q = append(da.aq.q, dla)
-	da.aq.Unlock()
-	return nil
+	return da.push(dla)
 }
 
 // DynamoDB returns the DynamoDB client object
-func (da *DrifterAction) DynamoDB() *dynamodb.DynamoDB {
+func (da *DrifterAction) DynamoDB() dynamodbiface.DynamoDBAPI {
 	return da.dyn
 }
 
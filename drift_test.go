@@ -4,20 +4,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
 // These tests all require DynamoDBLocal running on localhost:8000
@@ -56,16 +65,16 @@ func getTestDDBClient() *dynamodb.DynamoDB {
 	return dynamodb.New(sess, &aws.Config{Endpoint: aws.String("http://localhost:8000")})
 }
 
-func dropTestMetaTable(db *dynamodb.DynamoDB) {
+func dropTestMetaTable(db dynamodbiface.DynamoDBAPI) {
 	db.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(testMetaTable)})
 }
 
-func dropTestTables(db *dynamodb.DynamoDB) {
+func dropTestTables(db dynamodbiface.DynamoDBAPI) {
 	db.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(testTableA)})
 	db.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(testTableB)})
 }
 
-func setupTestMetaTable(db *dynamodb.DynamoDB) error {
+func setupTestMetaTable(db dynamodbiface.DynamoDBAPI) error {
 	dd := DynamoDrifter{
 		MetaTableName: testMetaTable,
 		DynamoDB:      db,
@@ -102,7 +111,7 @@ func setupTestMetaTable(db *dynamodb.DynamoDB) error {
 	return nil
 }
 
-func setupTestTables(db *dynamodb.DynamoDB) error {
+func setupTestTables(db dynamodbiface.DynamoDBAPI) error {
 	cti := &dynamodb.CreateTableInput{
 		TableName: aws.String(testTableA),
 		AttributeDefinitions: []*dynamodb.AttributeDefinition{
@@ -308,7 +317,7 @@ func TestRunCallbacks(t *testing.T) {
 		Description: "split up names",
 		Callback:    testMigrateUp,
 	}
-	_, errs := dd.runCallbacks(context.Background(), migration, 2, 200, false, nil)
+	_, errs := dd.runCallbacks(context.Background(), migration, 2, 200, false, nil, nil)
 	if len(errs) != 0 {
 		t.Fatalf("error running callbacks: %v", errs)
 	}
@@ -335,7 +344,7 @@ func TestRunCallbacksWithPaging(t *testing.T) {
 		Callback:    testMigrateUp,
 	}
 	// Scan limit of 1 to force paging
-	_, errs := dd.runCallbacks(context.Background(), migration, 2, 1, false, nil)
+	_, errs := dd.runCallbacks(context.Background(), migration, 2, 1, false, nil, nil)
 	if len(errs) != 0 {
 		t.Fatalf("error running callbacks: %v", errs)
 	}
@@ -361,7 +370,7 @@ func TestExecuteActions(t *testing.T) {
 		Description: "split up names",
 		Callback:    testMigrateUp,
 	}
-	da, errs := dd.runCallbacks(context.Background(), migration, 2, 200, false, nil)
+	da, errs := dd.runCallbacks(context.Background(), migration, 2, 200, false, nil, nil)
 	if len(errs) != 0 {
 		t.Fatalf("error running callbacks: %v", errs)
 	}
@@ -413,6 +422,1851 @@ func TestRunMigration(t *testing.T) {
 	}
 }
 
+func TestRunMigrationWithScanSegments(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		TableName:           testTableA,
+		Description:         "split up names",
+		Callback:            testMigrateUp,
+		ScanSegments:        4,
+		CallbackConcurrency: 2,
+		ActionConcurrency:   3,
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableB)
+	if err != nil {
+		t.Fatalf("error verifying migration in table B: %v", err)
+	}
+}
+
+func TestValidateScanSegments(t *testing.T) {
+	migration := &DynamoDrifterMigration{TableName: testTableA, Callback: testMigrateUp, ScanSegments: maxScanSegments}
+	if err := validateCallbacks(migration); err != nil {
+		t.Fatalf("error validating migration: %v", err)
+	}
+	migration.ScanSegments++
+	if err := validateCallbacks(migration); err == nil {
+		t.Fatalf("ScanSegments should be at most %v", maxScanSegments)
+	}
+}
+
+func TestRunMigrationWithBatchCallback(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var pages int
+	migration := &DynamoDrifterMigration{
+		TableName:   testTableA,
+		Description: "split up names",
+		PageSize:    2,
+		BatchCallback: func(items []RawDynamoItem, action *DrifterAction) error {
+			pages++
+			for _, item := range items {
+				if err := testMigrateUp(item, action); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	if pages < 2 {
+		t.Fatalf("batch callback should have been called once per page: %v", pages)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableB)
+	if err != nil {
+		t.Fatalf("error verifying migration in table B: %v", err)
+	}
+	migration.Callback = testMigrateUp
+	errs = dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 1 {
+		t.Fatalf("setting both callbacks should have failed: %v", errs)
+	}
+}
+
+func TestRunMigrationWithVersioning(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var calls int
+	migration := &DynamoDrifterMigration{
+		Number:      1,
+		TableName:   testTableA,
+		Description: "split up names",
+		Versioning:  &Versioning{Version: 1},
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			calls++
+			return testMigrateUp(item, action)
+		},
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+	so, err := dd.DynamoDB.Scan(&dynamodb.ScanInput{TableName: aws.String(testTableA)})
+	if err != nil {
+		t.Fatalf("error scanning table A: %v", err)
+	}
+	for _, item := range so.Items {
+		if v, err := ItemVersion(item); err != nil || v != 1 {
+			t.Fatalf("item should have been upgraded to version 1: %v", item)
+		}
+	}
+	first := calls
+	if err := dd.deleteMetaItem(migration); err != nil {
+		t.Fatalf("error deleting meta item: %v", err)
+	}
+	errs = dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors rerunning migration: %v", errs)
+	}
+	if calls != first {
+		t.Fatalf("items already at version 1 should have been skipped: %v callbacks", calls-first)
+	}
+}
+
+func TestRunMigrationWithSteps(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var prepared, verified int
+	fail := true
+	migration := &DynamoDrifterMigration{
+		Number:      1,
+		TableName:   testTableA,
+		Description: "split up names",
+		Steps: []MigrationStep{
+			{Name: "prepare", Func: func(ctx context.Context, dd *DynamoDrifter) error {
+				prepared++
+				return nil
+			}},
+			{Name: "backfill", Callback: testMigrateUp},
+			{Name: "verify", Func: func(ctx context.Context, dd *DynamoDrifter) error {
+				verified++
+				if fail {
+					return fmt.Errorf("verification failed")
+				}
+				return testVerifyMigration(dd.DynamoDB, testTableA)
+			}},
+		},
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 1 {
+		t.Fatalf("verify step should have failed: %v", errs)
+	}
+	ms, err := dd.Applied()
+	if err != nil {
+		t.Fatalf("error getting applied migrations: %v", err)
+	}
+	if len(ms) != 0 {
+		t.Fatalf("in progress migration should not be applied: %v", ms)
+	}
+	rec, err := dd.getMetaItem(1)
+	if err != nil {
+		t.Fatalf("error getting migration record: %v", err)
+	}
+	if !rec.InProgress || len(rec.StepProgress) != 3 || rec.StepProgress[1].Status != StepCompleted || rec.StepProgress[1].CallbacksProcessed != 3 ||
+		rec.StepProgress[2].Status != StepFailed || rec.StepProgress[2].Error == "" {
+		t.Fatalf("bad step progress: %+v", rec)
+	}
+	fail = false
+	errs = dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors resuming migration: %v", errs)
+	}
+	if prepared != 1 || verified != 2 {
+		t.Fatalf("completed steps should not have been rerun: prepared %v, verified %v", prepared, verified)
+	}
+	ms, err = dd.Applied()
+	if err != nil {
+		t.Fatalf("error getting applied migrations: %v", err)
+	}
+	if len(ms) != 1 || ms[0].InProgress {
+		t.Fatalf("migration should be applied: %v", ms)
+	}
+}
+
+func TestMetaTableLock(t *testing.T) {
+	dd := &DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	a := &MetaTableLock{Drifter: dd, Owner: "a", Lease: time.Second}
+	b := &MetaTableLock{Drifter: dd, Owner: "b", Lease: time.Second}
+	unlock, err := a.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("error locking: %v", err)
+	}
+	if _, err := b.Lock(context.Background()); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("lock should be held: %v", err)
+	}
+	if _, err := a.Lock(context.Background()); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("lock should not be re-entrant for its owner: %v", err)
+	}
+	ms, err := dd.Applied()
+	if err != nil || len(ms) != 0 {
+		t.Fatalf("lock record should not be an applied migration: %v, %v", ms, err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("error unlocking: %v", err)
+	}
+	unlock, err = b.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("error locking released lock: %v", err)
+	}
+	unlock()
+}
+
+// stealTestLock takes over the meta table lock for owner, as a process whose lease expired would see it
+func stealTestLock(dd *DynamoDrifter, owner string) error {
+	item := lockKey()
+	item["Owner"] = &dynamodb.AttributeValue{S: aws.String(owner)}
+	item["Expires"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(time.Now().Add(time.Hour).UnixNano(), 10))}
+	_, err := dd.DynamoDB.PutItem(&dynamodb.PutItemInput{TableName: &dd.MetaTableName, Item: item})
+	return err
+}
+
+func TestMetaTableLockLost(t *testing.T) {
+	dd := &DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	held, unlock, err := (&MetaTableLock{Drifter: dd, Owner: "a", Lease: 300 * time.Millisecond}).Hold(context.Background())
+	if err != nil {
+		t.Fatalf("error locking: %v", err)
+	}
+	if err := stealTestLock(dd, "b"); err != nil {
+		t.Fatalf("error stealing lock: %v", err)
+	}
+	select {
+	case <-held.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("context should be cancelled once the lock is lost")
+	}
+	if !errors.Is(context.Cause(held), ErrLockLost) {
+		t.Fatalf("bad cause: %v", context.Cause(held))
+	}
+	if err := unlock(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("lost lock should fail to be released: %v", err)
+	}
+	_, err = dd.DynamoDB.DeleteItem(&dynamodb.DeleteItemInput{TableName: &dd.MetaTableName, Key: lockKey()})
+	if err != nil {
+		t.Fatalf("error deleting lock: %v", err)
+	}
+	dd.Locking = &LockPolicy{Locker: &MetaTableLock{Drifter: dd, Owner: "a", Lease: 300 * time.Millisecond}}
+	var once sync.Once
+	m := &DynamoDrifterMigration{Number: 1, TableName: testTableA, Description: "split up names", Callback: func(item RawDynamoItem, da *DrifterAction) error {
+		once.Do(func() {
+			if err := stealTestLock(dd, "b"); err != nil {
+				t.Errorf("error stealing lock: %v", err)
+			}
+			time.Sleep(time.Second)
+		})
+		return testMigrateUp(item, da)
+	}}
+	errs := dd.Run(context.Background(), m, 1, false, nil)
+	if len(errs) == 0 || !errors.Is(errs[len(errs)-1], ErrLockLost) {
+		t.Fatalf("run should fail once its lock is lost: %v", errs)
+	}
+	if rec, err := dd.getMetaItem(1); err != nil || rec != nil {
+		t.Fatalf("run should not be recorded: %v, %v", rec, err)
+	}
+}
+
+func TestRunLocking(t *testing.T) {
+	dd := &DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+		Owner:         "a",
+		Locking:       &LockPolicy{},
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	m := &DynamoDrifterMigration{Number: 1, TableName: testTableA, Description: "split up names", Callback: testMigrateUp}
+	unlock, err := (&MetaTableLock{Drifter: dd, Owner: "b"}).Lock(context.Background())
+	if err != nil {
+		t.Fatalf("error locking: %v", err)
+	}
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 1 || !errors.Is(errs[0], ErrMigrationLocked) {
+		t.Fatalf("run should fail while locked: %v", errs)
+	}
+	unlock()
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+	m.Callback = func(RawDynamoItem, *DrifterAction) error { return errors.New("applied twice") }
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 1 || !errors.Is(errs[0], ErrAlreadyApplied) {
+		t.Fatalf("applied migration should fail: %v", errs)
+	}
+}
+
+func TestRunLockingSameOwner(t *testing.T) {
+	dd := &DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+		Owner:         "a",
+		Locking:       &LockPolicy{},
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	started, finished := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	first := &DynamoDrifterMigration{Number: 1, TableName: testTableA, Description: "split up names", Callback: func(item RawDynamoItem, da *DrifterAction) error {
+		once.Do(func() {
+			close(started)
+			<-finished
+		})
+		return testMigrateUp(item, da)
+	}}
+	second := &DynamoDrifterMigration{Number: 2, TableName: testTableB, Callback: func(RawDynamoItem, *DrifterAction) error { return nil }}
+	errc := make(chan []error)
+	go func() {
+		errc <- dd.Run(context.Background(), first, 1, false, nil)
+	}()
+	<-started
+	// a concurrent run of the same owner (ex: another process with the default owner on the same host) must not share the lock
+	errs := dd.Run(context.Background(), second, 1, false, nil)
+	close(finished)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrMigrationLocked) {
+		t.Fatalf("concurrent run of the same owner should fail while locked: %v", errs)
+	}
+	if errs := <-errc; len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	gio, err := dd.DynamoDB.GetItem(&dynamodb.GetItemInput{TableName: &dd.MetaTableName, Key: lockKey(), ConsistentRead: aws.Bool(true)})
+	if err != nil || len(gio.Item) != 0 {
+		t.Fatalf("the lock should be released by the run holding it: %v, %v", gio, err)
+	}
+}
+
+func TestInsertMetaItemRetried(t *testing.T) {
+	client := getTestDDBClient()
+	lost := false
+	client.Handlers.Unmarshal.PushBack(func(r *request.Request) {
+		if r.Operation.Name == "PutItem" && r.Error == nil && !lost {
+			lost = true
+			r.Error = awserr.New("RequestError", "connection reset before the response", nil)
+		}
+	})
+	dd := &DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      client,
+		Owner:         "a",
+	}
+	err := dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	m := &DynamoDrifterMigration{Number: 1, TableName: testTableA, Description: "split up names"}
+	if err := dd.insertMetaItem(m); err != nil || !lost {
+		t.Fatalf("retried insert of the record should succeed: %v (lost: %v)", err, lost)
+	}
+	if err := dd.insertMetaItem(m); !errors.Is(err, ErrAlreadyApplied) {
+		t.Fatalf("insert of another run should fail: %v", err)
+	}
+}
+
+func TestRunnerRunOnce(t *testing.T) {
+	dd := &DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	r := &Registry{}
+	r.Register(&DynamoDrifterMigration{Number: 1, TableName: testTableA, Description: "split up names", Callback: testMigrateUp})
+	runner := &Runner{
+		Drifter:  dd,
+		Registry: r,
+		Lock:     &MetaTableLock{Drifter: dd, Owner: "test"},
+		Interval: time.Minute,
+	}
+	n, err := runner.RunOnce(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("pending migration should have been applied: %v, %v", n, err)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+	n, err = runner.RunOnce(context.Background())
+	if err != nil || n != 0 {
+		t.Fatalf("no migrations should be pending: %v, %v", n, err)
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	dd := &DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	if _, err := dd.RunAll(context.Background(), RunAllOptions{}); err == nil {
+		t.Fatalf("RunAll should require registered migrations")
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var reported []uint
+	fail := func(item RawDynamoItem, action *DrifterAction) error { return fmt.Errorf("bad item") }
+	err = dd.Register(
+		&DynamoDrifterMigration{Number: 2, TableName: testTableA, Description: "fail", Callback: fail},
+		&DynamoDrifterMigration{Number: 1, TableName: testTableA, Description: "split up names", Callback: testMigrateUp},
+		&DynamoDrifterMigration{Number: 3, TableName: testTableA, Description: "not reached", Callback: testMigrateUp},
+	)
+	if err != nil {
+		t.Fatalf("error registering migrations: %v", err)
+	}
+	opts := RunAllOptions{
+		FailOnFirstError: true,
+		Lock:             &MetaTableLock{Drifter: dd, Owner: "test"},
+		Report:           func(m *DynamoDrifterMigration, errs []error) { reported = append(reported, m.Number) },
+	}
+	n, err := dd.RunAll(context.Background(), opts)
+	if err == nil || n != 1 || len(reported) != 2 || reported[0] != 1 || reported[1] != 2 {
+		t.Fatalf("RunAll should stop at the failed migration: %v, %v, %v", n, err, reported)
+	}
+	ms, err := dd.Applied()
+	if err != nil || len(ms) != 1 || ms[0].Number != 1 {
+		t.Fatalf("only the first migration should be applied: %v, %v", ms, err)
+	}
+}
+
+func TestRunMigrationWithHeartbeat(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName:     testMetaTable,
+		DynamoDB:          getTestDDBClient(),
+		HeartbeatInterval: 10 * time.Millisecond,
+		Owner:             "test",
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var running []DynamoDrifterMigration
+	migration := &DynamoDrifterMigration{
+		Number:      1,
+		TableName:   testTableA,
+		Description: "split up names",
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			if running == nil {
+				time.Sleep(50 * time.Millisecond)
+				var err error
+				if running, err = dd.Running(); err != nil {
+					return err
+				}
+			}
+			return testMigrateUp(item, action)
+		},
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	if len(running) != 1 || !running[0].InProgress || running[0].Heartbeat == nil || running[0].Heartbeat.Owner != "test" || running[0].Heartbeat.Stale(time.Second) {
+		t.Fatalf("running migration should have a heartbeat: %+v", running)
+	}
+	running, err = dd.Running()
+	if err != nil {
+		t.Fatalf("error getting running migrations: %v", err)
+	}
+	if len(running) != 0 {
+		t.Fatalf("completed migration should not be running: %+v", running)
+	}
+	ms, err := dd.Applied()
+	if err != nil || len(ms) != 1 {
+		t.Fatalf("migration should be applied: %v, %v", ms, err)
+	}
+}
+
+func TestRunMigrationWithProgressSnapshots(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName:    testMetaTable,
+		DynamoDB:         getTestDDBClient(),
+		SnapshotInterval: 10 * time.Millisecond,
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var running *ProgressSnapshot
+	migration := &DynamoDrifterMigration{
+		Number:      1,
+		TableName:   testTableA,
+		Description: "split up names",
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			if running == nil {
+				time.Sleep(50 * time.Millisecond)
+				var err error
+				if running, err = dd.Progress(1); err != nil {
+					return err
+				}
+			}
+			return testMigrateUp(item, action)
+		},
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	if running == nil || running.Status != SnapshotRunning || running.TableName != testTableA {
+		t.Fatalf("running migration should have a progress snapshot: %+v", running)
+	}
+	dd.ProgressTable = testTableB + "_progress"
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dd.DynamoDB.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(dd.ProgressTable)})
+	errs = dd.Run(context.Background(), &DynamoDrifterMigration{
+		Number:    2,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			return fmt.Errorf("foo")
+		},
+	}, 1, false, nil)
+	if len(errs) != 3 {
+		t.Fatalf("expected callback errors: %v", errs)
+	}
+	snap, err := dd.Progress(2)
+	if err != nil {
+		t.Fatalf("error getting progress snapshot: %v", err)
+	}
+	if snap == nil || snap.Status != SnapshotFailed || snap.CallbackErrors != 3 || snap.CallbacksProcessed != 3 {
+		t.Fatalf("bad final snapshot: %+v", snap)
+	}
+}
+
+func TestRunAsync(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:      1,
+		TableName:   testTableA,
+		Description: "split up names",
+		Callback:    testMigrateUp,
+	}
+	h := dd.RunAsync(context.Background(), migration, RunOptions{Concurrency: 1})
+	errs := h.Wait()
+	if len(errs) != 0 || h.Err() != nil {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	if p := h.Progress(); p.CallbacksProcessed != 3 {
+		t.Fatalf("bad progress: %+v", p)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+	h = dd.RunAsync(context.Background(), &DynamoDrifterMigration{
+		Number:    2,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			return nil
+		},
+	}, RunOptions{Concurrency: 1})
+	h.Cancel()
+	<-h.Done()
+	if h.Err() == nil {
+		t.Fatalf("cancelled migration should have failed")
+	}
+	if applied, err := dd.Applied(); err != nil || len(applied) != 1 {
+		t.Fatalf("cancelled migration should not be recorded: %v, %v", applied, err)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:      1,
+		TableName:   testTableA,
+		Description: "split up names",
+		Callback:    testMigrateUp,
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	srv := httptest.NewServer(dd.StatusHandler())
+	defer srv.Close()
+	get := func(path string, v interface{}) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("error getting %v: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("bad status for %v: %v", path, resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("error decoding %v: %v", path, err)
+		}
+	}
+	var status struct{ Running []MigrationStatus }
+	get("/migrations/status", &status)
+	if status.Running == nil || len(status.Running) != 0 {
+		t.Fatalf("no migration should be running: %+v", status)
+	}
+	var history struct{ Migrations []MigrationStatus }
+	get("/migrations/history", &history)
+	if len(history.Migrations) != 1 || history.Migrations[0].Number != 1 || history.Migrations[0].Description != "split up names" {
+		t.Fatalf("bad history: %+v", history)
+	}
+}
+
+func TestRunChunk(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var processed int
+	migration := &DynamoDrifterMigration{
+		Number:      1,
+		TableName:   testTableA,
+		Description: "split up names",
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			processed++
+			return testMigrateUp(item, action)
+		},
+	}
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+	if token, errs := dd.RunChunk(ctx, migration, "", 1, 1, false); len(errs) == 0 || token != "" || processed != 0 {
+		t.Fatalf("cancelled chunk should fail: %q, %v", token, errs)
+	}
+	if ms, err := dd.Applied(); err != nil || len(ms) != 0 {
+		t.Fatalf("cancelled chunk should not apply the migration: %v, %v", ms, err)
+	}
+	dd.Locking = &LockPolicy{Locker: &testLocker{free: 1}}
+	if token, errs := dd.RunChunk(context.Background(), migration, "", 1, 1, false); len(errs) != 1 || !errors.Is(errs[0], ErrMigrationLocked) || token != "" || processed != 0 {
+		t.Fatalf("locked chunk should fail: %q, %v", token, errs)
+	}
+	token, chunks := "", 0
+	for {
+		var errs []error
+		token, errs = dd.RunChunk(context.Background(), migration, token, 1, 1, false)
+		if len(errs) != 0 {
+			t.Fatalf("errors running chunk: %v", errs)
+		}
+		chunks++
+		if token == "" {
+			break
+		}
+		if chunks > 4 || processed != chunks {
+			t.Fatalf("each chunk should process one item: %v chunks, %v items", chunks, processed)
+		}
+		ms, err := dd.Applied()
+		if err != nil || len(ms) != 0 {
+			t.Fatalf("migration should not be applied before the last chunk: %v, %v", ms, err)
+		}
+	}
+	if processed != 3 {
+		t.Fatalf("all items should have been processed once: %v", processed)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+	ms, err := dd.Applied()
+	if err != nil || len(ms) != 1 {
+		t.Fatalf("migration should be applied: %v, %v", ms, err)
+	}
+	if _, errs := dd.RunChunk(context.Background(), migration, "", 1, 1, false); len(errs) != 1 || !errors.Is(errs[0], ErrAlreadyApplied) || processed != 3 {
+		t.Fatalf("the first chunk of an applied migration should fail: %v", errs)
+	}
+}
+
+func TestResume(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var processed int
+	migration := &DynamoDrifterMigration{
+		Number:          1,
+		TableName:       testTableA,
+		Description:     "split up names",
+		CheckpointItems: 1,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			processed++
+			if processed == 3 {
+				return fmt.Errorf("interrupted")
+			}
+			return testMigrateUp(item, action)
+		},
+	}
+	if errs := dd.Run(context.Background(), migration, 1, true, nil); len(errs) != 1 {
+		t.Fatalf("the third item should fail the run: %v", errs)
+	}
+	rec, err := dd.getMetaItem(1)
+	if err != nil || rec == nil || !rec.InProgress || rec.Checkpoint == nil || rec.Checkpoint.Scanned != 2 {
+		t.Fatalf("the run should be checkpointed after two items: %+v, %v", rec, err)
+	}
+	if errs := dd.Resume(context.Background(), migration, 1, true, nil); len(errs) != 0 {
+		t.Fatalf("errors resuming migration: %v", errs)
+	}
+	if processed != 4 {
+		t.Fatalf("only the item of the failed chunk should be processed again: %v", processed)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+	rec, err = dd.getMetaItem(1)
+	if err != nil || rec == nil || rec.InProgress || rec.Checkpoint != nil {
+		t.Fatalf("migration should be applied: %+v, %v", rec, err)
+	}
+	if errs := dd.Resume(context.Background(), migration, 1, true, nil); len(errs) != 1 || !errors.Is(errs[0], ErrAlreadyApplied) {
+		t.Fatalf("applied migrations should not be resumed: %v", errs)
+	}
+	migration.CheckpointItems = 0
+	if errs := dd.Resume(context.Background(), migration, 1, true, nil); len(errs) != 1 {
+		t.Fatalf("Resume should require CheckpointItems: %v", errs)
+	}
+}
+
+func TestSQSWorkerProcessTask(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:       1,
+		TableName:    testTableA,
+		Description:  "split up names",
+		Callback:     testMigrateUp,
+		ScanSegments: 2,
+	}
+	r := &Registry{}
+	if err := r.Register(migration); err != nil {
+		t.Fatalf("error registering migration: %v", err)
+	}
+	w := &SQSWorker{Drifter: &dd, Registry: r, ChunkSize: 1}
+	// as sent by EnqueueSegments (which requires a queue)
+	rr := &runRecord{dd: &dd, migration: migration}
+	if err := rr.set("Segments", 2); err != nil {
+		t.Fatalf("error marking migration in progress: %v", err)
+	}
+	for seg := uint(0); seg < 2; seg++ {
+		task := &SegmentTask{Number: 1, Segment: seg, Segments: 2}
+		for i := 0; task != nil; i++ {
+			if i > 3 {
+				t.Fatalf("segment %v should have been done", seg)
+			}
+			if task, err = w.processTask(context.Background(), task); err != nil {
+				t.Fatalf("error processing task: %v", err)
+			}
+		}
+		ms, err := dd.Applied()
+		if err != nil || len(ms) != int(seg) {
+			t.Fatalf("migration should only be applied once all segments are done: %v, %v", ms, err)
+		}
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+}
+
+func TestApplyStreamRecords(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	so, err := dd.DynamoDB.Scan(&dynamodb.ScanInput{TableName: aws.String(testTableA)})
+	if err != nil {
+		t.Fatalf("error scanning table: %v", err)
+	}
+	data := [][]byte{}
+	for _, item := range so.Items {
+		b, err := json.Marshal(map[string]interface{}{
+			"eventName": "MODIFY",
+			"dynamodb":  map[string]interface{}{"Keys": item, "NewImage": item},
+		})
+		if err != nil {
+			t.Fatalf("error marshaling change record: %v", err)
+		}
+		data = append(data, b)
+	}
+	migration := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		Callback:  testMigrateUp,
+	}
+	errs := dd.ApplyKinesisRecords(context.Background(), migration, data, 1, false)
+	if len(errs) != 0 {
+		t.Fatalf("errors applying records: %v", errs)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err != nil {
+		t.Fatalf("error verifying migration in table A: %v", err)
+	}
+}
+
+func TestExportHistory(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:      1,
+		TableName:   testTableA,
+		Description: "split up names",
+		Callback:    testMigrateUp,
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	b := &bytes.Buffer{}
+	if err := dd.ExportHistory(context.Background(), b, HistoryJSON); err != nil {
+		t.Fatalf("error exporting history: %v", err)
+	}
+	var h struct {
+		Version    int
+		Migrations []DynamoDrifterMigration
+	}
+	if err := json.Unmarshal(b.Bytes(), &h); err != nil {
+		t.Fatalf("error decoding history: %v", err)
+	}
+	if h.Version != HistoryVersion || len(h.Migrations) != 1 || h.Migrations[0].Description != "split up names" {
+		t.Fatalf("bad JSON history: %+v", h)
+	}
+	b.Reset()
+	if err := dd.ExportHistory(context.Background(), b, HistoryCSV); err != nil {
+		t.Fatalf("error exporting history: %v", err)
+	}
+	if want := "number,tablename,description,in_progress,heartbeat,step_progress,progress\n1," + testTableA + ",split up names,false,,,\n"; b.String() != want {
+		t.Fatalf("bad CSV history: %q", b.String())
+	}
+}
+
+func TestImportHistory(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	history := "number,tablename,description,in_progress,heartbeat,step_progress,progress\n1,foo,bar,false,,,\n2,foo,,false,,,\n"
+	if err := dd.ImportHistory(context.Background(), strings.NewReader(history)); err != nil {
+		t.Fatalf("error importing history: %v", err)
+	}
+	ms, err := dd.Applied()
+	if err != nil || len(ms) != 2 || ms[0].Description != "bar" {
+		t.Fatalf("imported migrations should be applied: %+v, %v", ms, err)
+	}
+	history = `{"version": 1, "migrations": [{"number": 2, "tablename": "foo"}, {"number": 3, "tablename": "foo"}]}`
+	if err := dd.ImportHistory(context.Background(), strings.NewReader(history)); err == nil || !strings.Contains(err.Error(), ": 2") {
+		t.Fatalf("existing migration should be reported: %v", err)
+	}
+	if ms, err = dd.Applied(); err != nil || len(ms) != 3 {
+		t.Fatalf("new migrations should have been imported: %+v, %v", ms, err)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	// table A stands in for a homegrown tracking table: ID is the migration number, items with ID 0 aren't migrations
+	adopt := func(item RawDynamoItem) (*DynamoDrifterMigration, error) {
+		id, err := GetNumberAttribute(item, "ID")
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		name, _ := GetStringAttribute(item, "Name")
+		return &DynamoDrifterMigration{Number: uint(n), TableName: testTableB, Description: name}, nil
+	}
+	n, err := dd.Adopt(context.Background(), testTableA, adopt)
+	if err != nil || n != 2 {
+		t.Fatalf("two migrations should have been adopted: %v, %v", n, err)
+	}
+	if n, err = dd.Adopt(context.Background(), testTableA, adopt); err != nil || n != 0 {
+		t.Fatalf("adopted migrations should not be adopted again: %v, %v", n, err)
+	}
+	ms, err := dd.Applied()
+	if err != nil || len(ms) != 2 || ms[0].Number != 1 || ms[0].TableName != testTableB {
+		t.Fatalf("adopted migrations should be applied: %+v, %v", ms, err)
+	}
+}
+
+func TestRunMigrationWithUpdateBuilder(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			return action.UpdateItem(RawDynamoItem{"ID": item["ID"]}, "").
+				Set("Status", "migrated").
+				Add("Count", 1).
+				Remove("Name").
+				If("ID <> :zero", map[string]interface{}{":zero": 0}).
+				Queue()
+		},
+	}
+	if errs := dd.Run(context.Background(), migration, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	out, err := dd.DynamoDB.Scan(&dynamodb.ScanInput{TableName: aws.String(testTableA)})
+	if err != nil {
+		t.Fatalf("error scanning table: %v", err)
+	}
+	for _, item := range out.Items {
+		_, migrated := item["Status"]
+		_, named := item["Name"]
+		if id := *item["ID"].N; (id == "0") == migrated || migrated == named {
+			t.Fatalf("only items matching the condition should be updated: %v", item)
+		}
+		if migrated && *item["Count"].N != "1" {
+			t.Fatalf("bad count: %v", item)
+		}
+	}
+}
+
+func TestRunMigrationWithEnrichment(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	for _, id := range []string{"1", "2"} {
+		_, err := dd.DynamoDB.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String(testTableB),
+			Item: map[string]*dynamodb.AttributeValue{
+				"ID":   &dynamodb.AttributeValue{N: aws.String(id)},
+				"Tier": &dynamodb.AttributeValue{S: aws.String("tier" + id)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("error inserting related item: %v", err)
+		}
+	}
+	migration := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		BatchCallback: EnrichedCallback(Enrichment{Table: testTableB, KeyMap: map[string]string{"ID": "ID"}, CacheSize: 10},
+			func(item, related RawDynamoItem, action *DrifterAction) error {
+				if related == nil {
+					return nil
+				}
+				return action.UpdateItem(RawDynamoItem{"ID": item["ID"]}, "").Set("Tier", *related["Tier"].S).Queue()
+			}),
+	}
+	if errs := dd.Run(context.Background(), migration, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	out, err := dd.DynamoDB.Scan(&dynamodb.ScanInput{TableName: aws.String(testTableA)})
+	if err != nil {
+		t.Fatalf("error scanning table: %v", err)
+	}
+	for _, item := range out.Items {
+		id := *item["ID"].N
+		tier, ok := item["Tier"]
+		if (id == "0") == ok || ok && *tier.S != "tier"+id {
+			t.Fatalf("items should be enriched from their related item: %v", item)
+		}
+	}
+}
+
+func TestRunMigrationWithLookupCache(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	_, err = dd.DynamoDB.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(testTableB),
+		Item: map[string]*dynamodb.AttributeValue{
+			"ID":   &dynamodb.AttributeValue{N: aws.String("100")},
+			"Tier": &dynamodb.AttributeValue{S: aws.String("gold")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error inserting reference item: %v", err)
+	}
+	lc := NewLookupCache(testTableB, 10)
+	migration := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			ref, err := lc.Get(action, TestDynamoKey{ID: 100})
+			if err != nil || ref == nil {
+				return fmt.Errorf("bad reference item: %v, %v", ref, err)
+			}
+			if missing, err := action.GetItem(TestDynamoKey{ID: 101}, testTableB); missing != nil || err != nil {
+				return fmt.Errorf("missing item should be nil: %v, %v", missing, err)
+			}
+			return action.UpdateItem(RawDynamoItem{"ID": item["ID"]}, "").Set("Tier", *ref["Tier"].S).Queue()
+		},
+	}
+	if errs := dd.Run(context.Background(), migration, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	if _, ok := lc.cache.get(keyString(RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("100")}})); !ok {
+		t.Fatalf("reference item should be cached")
+	}
+}
+
+func TestRunIdempotentMigration(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	var calls int32
+	migration := &DynamoDrifterMigration{
+		Number:     1,
+		TableName:  testTableA,
+		Idempotent: true,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			atomic.AddInt32(&calls, 1)
+			if *item["ID"].N == "0" {
+				return nil // not migrated, so processed again by reruns
+			}
+			return action.UpdateItem(RawDynamoItem{"ID": item["ID"]}, "").Set("Status", "migrated").Queue()
+		},
+	}
+	if errs := dd.Run(context.Background(), migration, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	if calls != 3 {
+		t.Fatalf("all items should be processed: %v", calls)
+	}
+	if err := dd.deleteMetaItem(migration); err != nil {
+		t.Fatalf("error deleting meta item: %v", err)
+	}
+	if errs := dd.Run(context.Background(), migration, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors rerunning migration: %v", errs)
+	}
+	if calls != 4 {
+		t.Fatalf("only items not migrated should be processed by the rerun: %v", calls)
+	}
+}
+
+func TestRehearse(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			return action.UpdateItem(RawDynamoItem{"ID": item["ID"]}, testTableA).Set("Status", "migrated").Queue()
+		},
+	}
+	report, err := dd.Rehearse(context.Background(), migration, RehearsalOptions{SampleSize: 2})
+	if err != nil {
+		t.Fatalf("error rehearsing migration: %v", err)
+	}
+	if len(report.Errors) != 0 || report.ItemsCopied != 2 || report.ItemsAfter != 2 || report.CallbacksProcessed != 2 || report.ActionsExecuted != 2 {
+		t.Fatalf("bad report: %+v", report)
+	}
+	if ok, err := dd.findTable(report.Clone); ok || err != nil {
+		t.Fatalf("clone should be deleted: %v, %v", ok, err)
+	}
+	out, err := dd.DynamoDB.Scan(&dynamodb.ScanInput{TableName: aws.String(testTableA)})
+	if err != nil {
+		t.Fatalf("error scanning table: %v", err)
+	}
+	for _, item := range out.Items {
+		if _, ok := item["Status"]; ok {
+			t.Fatalf("migration table should not be modified: %v", item)
+		}
+	}
+	if ms, err := dd.Applied(); err != nil || len(ms) != 0 {
+		t.Fatalf("rehearsal should not be recorded: %v, %v", ms, err)
+	}
+}
+
+func TestCloneTable(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	clone := testTableA + "-clone"
+	defer dd.DynamoDB.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(clone)})
+	var progress uint32
+	copied, err := dd.CloneTable(context.Background(), testTableA, clone, CloneOptions{
+		CopyItems: true,
+		Segments:  2,
+		Progress:  func(uint) { atomic.AddUint32(&progress, 1) },
+	})
+	if err != nil {
+		t.Fatalf("error cloning table: %v", err)
+	}
+	if copied != 3 || atomic.LoadUint32(&progress) == 0 {
+		t.Fatalf("bad copy: %v items, %v progress calls", copied, progress)
+	}
+	if count, err := dd.countItems(context.Background(), clone); err != nil || count != 3 {
+		t.Fatalf("bad clone item count: %v, %v", count, err)
+	}
+	sample := testTableA + "-sample"
+	defer dd.DynamoDB.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(sample)})
+	copied, err = dd.CloneTable(context.Background(), testTableA, sample, CloneOptions{CopyItems: true, SampleSize: 1})
+	if err != nil {
+		t.Fatalf("error cloning table: %v", err)
+	}
+	if count, err := dd.countItems(context.Background(), sample); err != nil || copied != 1 || count != 1 {
+		t.Fatalf("bad sample: %v copied, %v items, %v", copied, count, err)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{Number: 1, TableName: testTableA, Callback: testMigrateUp}
+	report, err := dd.Rehearse(context.Background(), migration, RehearsalOptions{KeepClone: true, RunID: "kept"})
+	if err != nil {
+		t.Fatalf("error rehearsing migration: %v", err)
+	}
+	rs, err := dd.TempResources(context.Background(), "kept")
+	if err != nil || len(rs) != 1 || rs[0].Kind != ResourceTable || rs[0].Name != report.Clone {
+		t.Fatalf("clone should be tracked: %+v, %v", rs, err)
+	}
+	if ms, err := dd.Applied(); err != nil || len(ms) != 0 {
+		t.Fatalf("temporary resources should not be migrations: %v, %v", ms, err)
+	}
+	if err := dd.Cleanup(context.Background(), "other"); err != nil {
+		t.Fatalf("error cleaning up: %v", err)
+	}
+	if ok, err := dd.findTable(report.Clone); !ok || err != nil {
+		t.Fatalf("clone of another run should be kept: %v, %v", ok, err)
+	}
+	if err := dd.Cleanup(context.Background(), "kept"); err != nil {
+		t.Fatalf("error cleaning up: %v", err)
+	}
+	if ok, err := dd.findTable(report.Clone); ok || err != nil {
+		t.Fatalf("clone should be deleted: %v, %v", ok, err)
+	}
+	if rs, err := dd.TempResources(context.Background(), ""); err != nil || len(rs) != 0 {
+		t.Fatalf("clone should not be tracked anymore: %+v, %v", rs, err)
+	}
+}
+
+func TestRunMigrationInSafeMode(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+		SafeMode:      true,
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			if err := action.Insert(item, testTableB); err != nil {
+				return err
+			}
+			return action.Insert(item, "") // overwrites item
+		},
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 3 {
+		t.Fatalf("overwrites should fail: %v", errs)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, ErrUnsafeAction) {
+			t.Fatalf("bad error: %v", err)
+		}
+	}
+	if count, err := dd.countItems(context.Background(), testTableB); err != nil || count != 3 {
+		t.Fatalf("new items should be inserted: %v, %v", count, err)
+	}
+}
+
+func TestRunMigrationWithGuardrails(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+		Guardrails:    &Guardrails{MaxDeletePercent: 50},
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			return action.Delete(RawDynamoItem{"ID": item["ID"]}, "")
+		},
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrGuardrailExceeded) {
+		t.Fatalf("guardrail should be exceeded: %v", errs)
+	}
+	if count, err := dd.countItems(context.Background(), testTableA); err != nil || count != 3 {
+		t.Fatalf("no item should be deleted: %v, %v", count, err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+		Guardrails:    &Guardrails{MaxWrites: 10},
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: testTableA,
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			if err := action.Insert(item, testTableB); err != nil {
+				return err
+			}
+			return action.UpdateItem(RawDynamoItem{"ID": item["ID"]}, "").Set("Status", "migrated").Queue()
+		},
+	}
+	plan, err := dd.Plan(context.Background(), migration, PlanOptions{SampleSize: 2, Operations: true})
+	if err != nil {
+		t.Fatalf("error planning migration: %v", err)
+	}
+	if plan.ItemsScanned != 3 || plan.Actions[testTableA] != (ActionCounts{Updates: 3}) || plan.Actions[testTableB] != (ActionCounts{Inserts: 3}) {
+		t.Fatalf("bad plan: %+v", plan)
+	}
+	if len(plan.Guardrails) != 1 || plan.Guardrails[0].Exceeded {
+		t.Fatalf("bad guardrails: %+v", plan.Guardrails)
+	}
+	if len(plan.Diffs) != 2 || len(plan.Diffs[0].Changes) != 1 || !strings.Contains(plan.Diffs[0].String(), `+ Status: "migrated"`) {
+		t.Fatalf("bad diffs: %v", plan.Diffs)
+	}
+	if len(plan.Operations) != 6 || plan.Operations[0].Type != "insert" || plan.Operations[0].TableName != testTableB ||
+		plan.Operations[1].Type != "update" || plan.Operations[1].TableName != testTableA {
+		t.Fatalf("bad operations: %v", plan.Operations)
+	}
+	if count, err := dd.countItems(context.Background(), testTableB); err != nil || count != 0 {
+		t.Fatalf("nothing should be written: %v, %v", count, err)
+	}
+}
+
+func TestImpactedTables(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	r := &Registry{}
+	err = r.Register(
+		&DynamoDrifterMigration{Number: 1, TableName: testTableA, Callback: testMigrateUp},
+		&DynamoDrifterMigration{Number: 2, TableName: testTableA, Callback: testMigrateUp, WritesTables: []string{testTableB}},
+		&DynamoDrifterMigration{Number: 3, TableName: "missing", Callback: testMigrateUp},
+	)
+	if err != nil {
+		t.Fatalf("error registering migrations: %v", err)
+	}
+	if errs := dd.Run(context.Background(), r.get(1), 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	tables, err := dd.ImpactedTables(context.Background(), r)
+	if err != nil {
+		t.Fatalf("error getting impacted tables: %v", err)
+	}
+	if len(tables) != 3 {
+		t.Fatalf("bad tables: %+v", tables)
+	}
+	missing, a, b := tables[0], tables[1], tables[2]
+	if a.TableName != testTableA || !reflect.DeepEqual(a.Migrations, []uint{2}) || !a.Scanned || !a.Exists || a.Status != dynamodb.TableStatusActive || a.ReadCapacityUnits != 10 {
+		t.Fatalf("bad table A: %+v", a)
+	}
+	if b.TableName != testTableB || b.Scanned || !b.Exists {
+		t.Fatalf("bad table B: %+v", b)
+	}
+	if missing.TableName != "missing" || missing.Exists || missing.Status != "" {
+		t.Fatalf("bad missing table: %+v", missing)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+		Owner:         "test",
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{Number: 1, TableName: testTableA, Callback: testMigrateUp, WritesTables: []string{testTableB}}
+	pr, err := dd.Preflight(context.Background(), migration)
+	if err != nil {
+		t.Fatalf("preflight should pass: %v", err)
+	}
+	if len(pr.Checks) != 15 {
+		t.Fatalf("bad checks: %v", pr)
+	}
+	if c, err := dd.countItems(context.Background(), testTableA); err != nil || c != 3 {
+		t.Fatalf("preflight should not write items: %v, %v", c, err)
+	}
+	unlock, err := (&MetaTableLock{Drifter: &dd, Owner: "other"}).Lock(context.Background())
+	if err != nil {
+		t.Fatalf("error locking: %v", err)
+	}
+	defer unlock()
+	migration.WritesTables = []string{"missing"}
+	pr, err = dd.Preflight(context.Background(), migration)
+	if !errors.Is(err, ErrPreflightFailed) {
+		t.Fatalf("preflight should fail: %v", err)
+	}
+	failed := []string{}
+	for _, c := range pr.Checks {
+		if !c.Passed {
+			failed = append(failed, c.Name)
+		}
+	}
+	if !reflect.DeepEqual(failed, []string{"missing is ACTIVE", "migration lock is free"}) {
+		t.Fatalf("bad failed checks: %v", pr)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	if _, err := dd.Prune(context.Background(), nil); err == nil {
+		t.Fatalf("prune should require a retention policy")
+	}
+	history := "number,tablename,description,in_progress,heartbeat,step_progress,progress\n1,foo,,false,,,\n2,foo,,false,,,\n3,foo,,false,,,\n"
+	if err := dd.ImportHistory(context.Background(), strings.NewReader(history)); err != nil {
+		t.Fatalf("error importing history: %v", err)
+	}
+	dd.Retention = &RetentionPolicy{KeepLast: 1}
+	b := &bytes.Buffer{}
+	pruned, err := dd.Prune(context.Background(), b)
+	if err != nil {
+		t.Fatalf("error pruning: %v", err)
+	}
+	if len(pruned) != 2 || pruned[0].Number != 1 || pruned[1].Number != 2 {
+		t.Fatalf("bad pruned records: %+v", pruned)
+	}
+	exported, err := readHistory(b)
+	if err != nil || len(exported) != 2 {
+		t.Fatalf("pruned records should be exported: %+v, %v", exported, err)
+	}
+	if ms, err := dd.Applied(); err != nil || len(ms) != 1 || ms[0].Number != 3 {
+		t.Fatalf("only the last record should be kept: %+v, %v", ms, err)
+	}
+	if ns, err := dd.Pruned(context.Background()); err != nil || !reflect.DeepEqual(ns, []uint{1, 2}) {
+		t.Fatalf("bad pruned numbers: %v, %v", ns, err)
+	}
+	r := &Registry{}
+	for n := uint(1); n <= 4; n++ {
+		if err := r.Register(&DynamoDrifterMigration{Number: n, TableName: "foo", Callback: testMigrateUp}); err != nil {
+			t.Fatalf("error registering migration: %v", err)
+		}
+	}
+	if pending, err := dd.Pending(r); err != nil || len(pending) != 1 || pending[0].Number != 4 {
+		t.Fatalf("pruned migrations should not be pending: %+v, %v", pending, err)
+	}
+	if pruned, err := dd.Prune(context.Background(), nil); err != nil || len(pruned) != 0 {
+		t.Fatalf("nothing should be pruned: %+v, %v", pruned, err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	if _, err := dd.Archive(context.Background(), 3); err == nil {
+		t.Fatalf("archive should require an archive table or S3 archive")
+	}
+	dd.ArchiveTable = testMetaTable + "-archive"
+	err := dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	defer dd.DynamoDB.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(dd.ArchiveTable)})
+	history := "number,tablename,description,in_progress,heartbeat,step_progress,progress\n1,foo,,false,,,\n2,foo,,false,,,\n3,foo,,false,,,\n"
+	if err := dd.ImportHistory(context.Background(), strings.NewReader(history)); err != nil {
+		t.Fatalf("error importing history: %v", err)
+	}
+	summary, err := dd.Archive(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("error archiving: %v", err)
+	}
+	if summary == nil || summary.Location != dd.ArchiveTable || summary.First != 1 || summary.Last != 2 || summary.Count != 2 {
+		t.Fatalf("bad archive summary: %+v", summary)
+	}
+	if n, err := dd.countItems(context.Background(), dd.ArchiveTable); err != nil || n != 2 {
+		t.Fatalf("archive table should have 2 records: %v, %v", n, err)
+	}
+	if ms, err := dd.Applied(); err != nil || len(ms) != 1 || ms[0].Number != 3 {
+		t.Fatalf("only the last record should be kept: %+v, %v", ms, err)
+	}
+	if ns, err := dd.Pruned(context.Background()); err != nil || !reflect.DeepEqual(ns, []uint{1, 2}) {
+		t.Fatalf("archived migrations should remain applied: %v, %v", ns, err)
+	}
+	archives, err := dd.Archives(context.Background())
+	if err != nil || len(archives) != 1 || archives[0].Count != 2 || archives[0].Location != dd.ArchiveTable {
+		t.Fatalf("bad archives: %+v, %v", archives, err)
+	}
+	if summary, err := dd.Archive(context.Background(), 3); err != nil || summary != nil {
+		t.Fatalf("nothing should be archived: %+v, %v", summary, err)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	metaB := testMetaTable + "-b"
+	if err := dd.createMetaTable(10, 10, metaB); err != nil {
+		t.Fatalf("error creating meta table: %v", err)
+	}
+	defer dd.DynamoDB.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(metaB)})
+	fo := &FanOut{
+		Drifter:     &dd,
+		Targets:     []FanOutTarget{{TableName: testTableA}, {TableName: testTableB, MetaTableName: metaB}},
+		Parallelism: 2,
+	}
+	// the run on table A inserts migrated items into table B, which its run may scan as targets run in parallel
+	migration := &DynamoDrifterMigration{Number: 1, TableName: "placeholder", Callback: func(item RawDynamoItem, da *DrifterAction) error {
+		if item["Name"] == nil {
+			return nil
+		}
+		return testMigrateUp(item, da)
+	}}
+	fr, err := fo.Run(context.Background(), migration, 1, false)
+	if err != nil {
+		t.Fatalf("error running fan-out: %v", err)
+	}
+	if !fr.Succeeded() || len(fr.Results) != 2 {
+		t.Fatalf("fan-out should succeed: %v", fr)
+	}
+	if rr := fr.Results[0].Report; rr == nil || rr.TableName != testTableA || rr.CallbacksProcessed != 3 {
+		t.Fatalf("bad report of target A: %+v", rr)
+	}
+	for _, mt := range []string{testMetaTable, metaB} {
+		tdd := DynamoDrifter{MetaTableName: mt, DynamoDB: dd.DynamoDB}
+		if ms, err := tdd.Applied(); err != nil || len(ms) != 1 {
+			t.Fatalf("migration should be applied in %v: %+v, %v", mt, ms, err)
+		}
+	}
+	fo.Targets = []FanOutTarget{{TableName: "missing"}, {TableName: testTableB, MetaTableName: metaB}}
+	fo.Parallelism, fo.StopOnFailure = 1, true
+	fr, err = fo.Run(context.Background(), migration, 1, false)
+	if err != nil {
+		t.Fatalf("error running fan-out: %v", err)
+	}
+	if fr.Succeeded() || len(fr.Results[0].Errors) == 0 || !fr.Results[1].Skipped {
+		t.Fatalf("second target should be skipped after the first failed: %v", fr)
+	}
+}
+
+func TestAutoRollback(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+		Rollback:      &RollbackPolicy{},
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		TableName:     testTableA,
+		Description:   "split up names",
+		Callback:      testMigrateUpWithActionErrors,
+		UndoMigration: &DynamoDrifterMigration{TableName: testTableA, Description: "put names back together", Callback: testMigrateDown},
+	}
+	errs := dd.Run(context.Background(), migration, 1, false, nil)
+	if len(errs) == 0 || !errors.Is(errs[len(errs)-1], ErrRolledBack) {
+		t.Fatalf("failed run should be rolled back: %v", errs)
+	}
+	if err := testVerifyMigration(dd.DynamoDB, testTableA); err == nil {
+		t.Fatalf("updates of table A should be rolled back")
+	}
+	if ms, err := dd.Applied(); err != nil || len(ms) != 0 {
+		t.Fatalf("rolled back migration should not be applied: %+v, %v", ms, err)
+	}
+}
+
+func TestRunOutcomes(t *testing.T) {
+	log := &bytes.Buffer{}
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+		Outcomes:      &OutcomeOptions{ReportKeys: true, Log: log},
+	}
+	sink := &captureReportSink{}
+	dd.ReportSinks = []ReportSink{sink}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	err = dd.Init(10, 10)
+	if err != nil {
+		t.Fatalf("error in Init: %v", err)
+	}
+	defer dropTestMetaTable(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		TableName:   testTableA,
+		Description: "split up names",
+		Callback:    testMigrateUp,
+	}
+	if errs := dd.Run(context.Background(), migration, 2, false, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	n, err := dd.countItems(context.Background(), testTableA)
+	if err != nil {
+		t.Fatalf("error counting items: %v", err)
+	}
+	or := sink.rr.Outcomes
+	if or == nil || or.Totals[OutcomeMigrated] != uint(n) || len(or.Keys) != int(n) || or.Keys[`{"ID":{"N":"1"}}`] != OutcomeMigrated {
+		t.Fatalf("bad outcomes: %+v", or)
+	}
+	if lines := strings.Count(log.String(), "\n"); lines != int(n) {
+		t.Fatalf("bad outcome log: %v", log.String())
+	}
+}
+
 func TestRunMigrationWithActionErrors(t *testing.T) {
 	dd := DynamoDrifter{
 		MetaTableName: testMetaTable,
@@ -710,7 +2564,7 @@ func TestGetAttributeWrongType(t *testing.T) {
 	}
 }
 
-func testVerifyMigration(db *dynamodb.DynamoDB, tn string) error {
+func testVerifyMigration(db dynamodbiface.DynamoDBAPI, tn string) error {
 	table := []TestTableItem{}
 	out, err := db.Scan(&dynamodb.ScanInput{TableName: &tn})
 	if err != nil {
@@ -0,0 +1,1026 @@
+package drifttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// DB is an in-memory DynamoDB, serving the DynamoDB API to the clients returned by Client without network access. It supports:
+//
+//	tables:       CreateTable (with secondary indexes), DeleteTable, DescribeTable, ListTables, DescribeTimeToLive, UpdateTimeToLive
+//	items:        GetItem, PutItem, UpdateItem, DeleteItem, BatchGetItem, BatchWriteItem, TransactWriteItems
+//	reads:        Scan (with segments), Query (on tables and indexes)
+//	expressions:  condition, filter, key condition, projection and update expressions (see drift.ApplyUpdate)
+//
+// Legacy parameters (ex: AttributeUpdates, ScanFilter) aren't supported. Requests are served one at a time and consume nominal capacity
+// (a unit per item written, half a unit per item read). Scans and queries return items in key order, without the 1 MB page limit.
+type DB struct {
+	mtx    sync.Mutex
+	tables map[string]*table
+}
+
+// table is a table of a DB
+type table struct {
+	desc    *dynamodb.TableDescription
+	keys    []string            // hash and range key attributes
+	indexes map[string][]string // key attributes of the secondary indexes
+	items   map[string]drift.RawDynamoItem
+	ttl     *string // TTL attribute (not enforced)
+}
+
+// apiError is an error returned to clients as a DynamoDB error
+type apiError struct {
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func validationError(format string, args ...interface{}) error {
+	return &apiError{code: "ValidationException", message: fmt.Sprintf(format, args...)}
+}
+
+var errConditionalCheckFailed = &apiError{code: "ConditionalCheckFailedException", message: "The conditional request failed"}
+
+// New returns an empty DB
+func New() *DB {
+	return &DB{tables: map[string]*table{}}
+}
+
+// Client returns a DynamoDB client of db
+func (db *DB) Client() *dynamodb.DynamoDB {
+	return client(db)
+}
+
+// client returns a DynamoDB client sending its requests to transport
+func client(transport http.RoundTripper) *dynamodb.DynamoDB {
+	cfg := aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint("http://drifttest.invalid").
+		WithCredentials(credentials.NewStaticCredentials("drifttest", "drifttest", "")).
+		WithHTTPClient(&http.Client{Transport: transport}).
+		WithMaxRetries(0)
+	return dynamodb.New(session.New(cfg))
+}
+
+// RoundTrip serves a DynamoDB API request, so db can be the transport of an HTTP client
+func (db *DB) RoundTrip(r *http.Request) (*http.Response, error) {
+	op, body, err := readRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	out, err := db.serve(op, body)
+	return response(r, out, err), nil
+}
+
+// readRequest returns the operation and JSON input body of a DynamoDB API request
+func readRequest(r *http.Request) (string, []byte, error) {
+	if err := r.Context().Err(); err != nil {
+		return "", nil, err
+	}
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return "", nil, err
+		}
+		r.Body.Close()
+	}
+	return strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810."), body, nil
+}
+
+// response returns the response of request r, with output out or the DynamoDB error of err
+func response(r *http.Request, out interface{}, err error) *http.Response {
+	var body []byte
+	status := http.StatusOK
+	if err == nil {
+		body, err = jsonutil.BuildJSON(out)
+	}
+	if err != nil {
+		aerr, ok := err.(*apiError)
+		if !ok {
+			aerr = &apiError{code: "InternalServerError", message: err.Error()}
+		}
+		status = http.StatusBadRequest
+		body, _ = json.Marshal(map[string]string{"__type": "com.amazonaws.dynamodb.v20120810#" + aerr.code, "message": aerr.message})
+	}
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/x-amz-json-1.0"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+// serve serves operation op with the JSON input body
+func (db *DB) serve(op string, body []byte) (interface{}, error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	var in, out interface{}
+	var f func() error
+	switch op {
+	case "CreateTable":
+		i, o := &dynamodb.CreateTableInput{}, &dynamodb.CreateTableOutput{}
+		in, out, f = i, o, func() error { return db.createTable(i, o) }
+	case "DeleteTable":
+		i, o := &dynamodb.DeleteTableInput{}, &dynamodb.DeleteTableOutput{}
+		in, out, f = i, o, func() error { return db.deleteTable(i, o) }
+	case "DescribeTable":
+		i, o := &dynamodb.DescribeTableInput{}, &dynamodb.DescribeTableOutput{}
+		in, out, f = i, o, func() error { return db.describeTable(i, o) }
+	case "ListTables":
+		i, o := &dynamodb.ListTablesInput{}, &dynamodb.ListTablesOutput{}
+		in, out, f = i, o, func() error { return db.listTables(i, o) }
+	case "DescribeTimeToLive":
+		i, o := &describeTimeToLiveInput{}, &describeTimeToLiveOutput{}
+		in, out, f = i, o, func() error { return db.describeTimeToLive(i, o) }
+	case "UpdateTimeToLive":
+		i, o := &updateTimeToLiveInput{}, &updateTimeToLiveOutput{}
+		in, out, f = i, o, func() error { return db.updateTimeToLive(i, o) }
+	case "GetItem":
+		i, o := &dynamodb.GetItemInput{}, &dynamodb.GetItemOutput{}
+		in, out, f = i, o, func() error { return db.getItem(i, o) }
+	case "PutItem":
+		i, o := &dynamodb.PutItemInput{}, &dynamodb.PutItemOutput{}
+		in, out, f = i, o, func() error { return db.putItem(i, o) }
+	case "UpdateItem":
+		i, o := &dynamodb.UpdateItemInput{}, &dynamodb.UpdateItemOutput{}
+		in, out, f = i, o, func() error { return db.updateItem(i, o) }
+	case "DeleteItem":
+		i, o := &dynamodb.DeleteItemInput{}, &dynamodb.DeleteItemOutput{}
+		in, out, f = i, o, func() error { return db.deleteItem(i, o) }
+	case "BatchGetItem":
+		i, o := &dynamodb.BatchGetItemInput{}, &dynamodb.BatchGetItemOutput{}
+		in, out, f = i, o, func() error { return db.batchGetItem(i, o) }
+	case "BatchWriteItem":
+		i, o := &dynamodb.BatchWriteItemInput{}, &dynamodb.BatchWriteItemOutput{}
+		in, out, f = i, o, func() error { return db.batchWriteItem(i, o) }
+	case "TransactWriteItems":
+		i, o := &transactWriteItemsInput{}, &transactWriteItemsOutput{}
+		in, out, f = i, o, func() error { return db.transactWriteItems(i, o) }
+	case "Scan":
+		i, o := &dynamodb.ScanInput{}, &dynamodb.ScanOutput{}
+		in, out, f = i, o, func() error { return db.scan(i, o) }
+	case "Query":
+		i, o := &dynamodb.QueryInput{}, &dynamodb.QueryOutput{}
+		in, out, f = i, o, func() error { return db.query(i, o) }
+	default:
+		return nil, &apiError{code: "UnknownOperationException", message: fmt.Sprintf("unsupported operation %q", op)}
+	}
+	if err := jsonutil.UnmarshalJSON(in, bytes.NewReader(body)); err != nil {
+		return nil, &apiError{code: "SerializationException", message: err.Error()}
+	}
+	if err := f(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// table returns table name
+func (db *DB) table(name *string) (*table, error) {
+	t := db.tables[aws.StringValue(name)]
+	if t == nil {
+		return nil, &apiError{code: "ResourceNotFoundException", message: fmt.Sprintf("Requested resource not found: Table: %v not found", aws.StringValue(name))}
+	}
+	return t, nil
+}
+
+// keySchema returns the hash and range key attributes of a key schema
+func keySchema(ks []*dynamodb.KeySchemaElement) ([]string, error) {
+	keys := make([]string, 2)
+	for _, k := range ks {
+		switch aws.StringValue(k.KeyType) {
+		case dynamodb.KeyTypeHash:
+			keys[0] = aws.StringValue(k.AttributeName)
+		case dynamodb.KeyTypeRange:
+			keys[1] = aws.StringValue(k.AttributeName)
+		}
+	}
+	if keys[0] == "" {
+		return nil, validationError("a hash key is required")
+	}
+	if keys[1] == "" {
+		return keys[:1], nil
+	}
+	return keys, nil
+}
+
+func (db *DB) createTable(in *dynamodb.CreateTableInput, out *dynamodb.CreateTableOutput) error {
+	name := aws.StringValue(in.TableName)
+	if name == "" {
+		return validationError("TableName is required")
+	}
+	if db.tables[name] != nil {
+		return &apiError{code: "ResourceInUseException", message: fmt.Sprintf("Table already exists: %v", name)}
+	}
+	keys, err := keySchema(in.KeySchema)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	pt := &dynamodb.ProvisionedThroughputDescription{NumberOfDecreasesToday: aws.Int64(0)}
+	if in.ProvisionedThroughput != nil {
+		pt.ReadCapacityUnits, pt.WriteCapacityUnits = in.ProvisionedThroughput.ReadCapacityUnits, in.ProvisionedThroughput.WriteCapacityUnits
+	}
+	t := &table{
+		desc: &dynamodb.TableDescription{
+			TableName:             aws.String(name),
+			TableArn:              aws.String("arn:aws:dynamodb:us-east-1:000000000000:table/" + name),
+			TableStatus:           aws.String(dynamodb.TableStatusActive),
+			CreationDateTime:      &now,
+			KeySchema:             in.KeySchema,
+			AttributeDefinitions:  in.AttributeDefinitions,
+			ProvisionedThroughput: pt,
+			StreamSpecification:   in.StreamSpecification,
+		},
+		keys:    keys,
+		indexes: map[string][]string{},
+		items:   map[string]drift.RawDynamoItem{},
+	}
+	for _, gsi := range in.GlobalSecondaryIndexes {
+		ik, err := keySchema(gsi.KeySchema)
+		if err != nil {
+			return err
+		}
+		t.indexes[aws.StringValue(gsi.IndexName)] = ik
+		d := &dynamodb.GlobalSecondaryIndexDescription{
+			IndexName:   gsi.IndexName,
+			IndexStatus: aws.String(dynamodb.IndexStatusActive),
+			KeySchema:   gsi.KeySchema,
+			Projection:  gsi.Projection,
+		}
+		if gsi.ProvisionedThroughput != nil {
+			d.ProvisionedThroughput = &dynamodb.ProvisionedThroughputDescription{
+				ReadCapacityUnits:  gsi.ProvisionedThroughput.ReadCapacityUnits,
+				WriteCapacityUnits: gsi.ProvisionedThroughput.WriteCapacityUnits,
+			}
+		}
+		t.desc.GlobalSecondaryIndexes = append(t.desc.GlobalSecondaryIndexes, d)
+	}
+	for _, lsi := range in.LocalSecondaryIndexes {
+		ik, err := keySchema(lsi.KeySchema)
+		if err != nil {
+			return err
+		}
+		t.indexes[aws.StringValue(lsi.IndexName)] = ik
+		t.desc.LocalSecondaryIndexes = append(t.desc.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndexDescription{
+			IndexName:  lsi.IndexName,
+			KeySchema:  lsi.KeySchema,
+			Projection: lsi.Projection,
+		})
+	}
+	db.tables[name] = t
+	out.TableDescription = t.description()
+	return nil
+}
+
+// description returns the description of t, with its current item count
+func (t *table) description() *dynamodb.TableDescription {
+	d := *t.desc
+	d.ItemCount = aws.Int64(int64(len(t.items)))
+	return &d
+}
+
+func (db *DB) deleteTable(in *dynamodb.DeleteTableInput, out *dynamodb.DeleteTableOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	delete(db.tables, *in.TableName)
+	out.TableDescription = t.description()
+	out.TableDescription.TableStatus = aws.String(dynamodb.TableStatusDeleting)
+	return nil
+}
+
+func (db *DB) describeTable(in *dynamodb.DescribeTableInput, out *dynamodb.DescribeTableOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	out.Table = t.description()
+	return nil
+}
+
+func (db *DB) listTables(in *dynamodb.ListTablesInput, out *dynamodb.ListTablesOutput) error {
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		if name > aws.StringValue(in.ExclusiveStartTableName) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if limit := int(aws.Int64Value(in.Limit)); limit > 0 && len(names) > limit {
+		names = names[:limit]
+		out.LastEvaluatedTableName = aws.String(names[limit-1])
+	}
+	out.TableNames = aws.StringSlice(names)
+	return nil
+}
+
+// TTL types, which the vendored SDK predates
+
+type timeToLiveSpecification struct {
+	AttributeName *string
+	Enabled       *bool
+}
+
+type describeTimeToLiveInput struct {
+	TableName *string
+}
+
+type describeTimeToLiveOutput struct {
+	TimeToLiveDescription *struct {
+		AttributeName    *string
+		TimeToLiveStatus *string
+	}
+}
+
+type updateTimeToLiveInput struct {
+	TableName               *string
+	TimeToLiveSpecification *timeToLiveSpecification
+}
+
+type updateTimeToLiveOutput struct {
+	TimeToLiveSpecification *timeToLiveSpecification
+}
+
+func (db *DB) describeTimeToLive(in *describeTimeToLiveInput, out *describeTimeToLiveOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	out.TimeToLiveDescription = &struct {
+		AttributeName    *string
+		TimeToLiveStatus *string
+	}{AttributeName: t.ttl, TimeToLiveStatus: aws.String("DISABLED")}
+	if t.ttl != nil {
+		out.TimeToLiveDescription.TimeToLiveStatus = aws.String("ENABLED")
+	}
+	return nil
+}
+
+func (db *DB) updateTimeToLive(in *updateTimeToLiveInput, out *updateTimeToLiveOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	spec := in.TimeToLiveSpecification
+	if spec == nil || aws.StringValue(spec.AttributeName) == "" {
+		return validationError("TimeToLiveSpecification is required")
+	}
+	t.ttl = nil
+	if aws.BoolValue(spec.Enabled) {
+		t.ttl = spec.AttributeName
+	}
+	out.TimeToLiveSpecification = spec
+	return nil
+}
+
+// encodeKey returns the key of item for attributes keys, which must be strings, numbers or binaries
+func encodeKey(item map[string]*dynamodb.AttributeValue, keys []string) (string, error) {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		v := item[k]
+		switch {
+		case v == nil:
+			return "", validationError("One of the required keys was not given a value: %v", k)
+		case v.S != nil:
+			parts[i] = "S" + *v.S
+		case v.N != nil:
+			n, ok := parseNumber(*v.N)
+			if !ok {
+				return "", validationError("invalid number %q", *v.N)
+			}
+			parts[i] = "N" + n.RatString()
+		case v.B != nil:
+			parts[i] = "B" + string(v.B)
+		default:
+			return "", validationError("key attribute %v must be a string, number or binary", k)
+		}
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+// key returns the key of item in t
+func (t *table) key(item map[string]*dynamodb.AttributeValue) (string, error) {
+	return encodeKey(item, t.keys)
+}
+
+// lookupKey returns the key of a Key parameter, which must only have the key attributes of t
+func (t *table) lookupKey(key map[string]*dynamodb.AttributeValue) (string, error) {
+	if len(key) != len(t.keys) {
+		return "", validationError("The provided key element does not match the schema")
+	}
+	return t.key(key)
+}
+
+// keyOf returns the key attributes of item in t (and in index keys if set)
+func keyOf(item drift.RawDynamoItem, keys ...[]string) map[string]*dynamodb.AttributeValue {
+	key := map[string]*dynamodb.AttributeValue{}
+	for _, ks := range keys {
+		for _, k := range ks {
+			key[k] = drift.CloneAttributeValue(item[k])
+		}
+	}
+	return key
+}
+
+// consumed returns the consumed capacity of a request of t, or nil if it wasn't requested
+func consumed(t *table, units float64, rcc *string) *dynamodb.ConsumedCapacity {
+	if aws.StringValue(rcc) == "" || aws.StringValue(rcc) == dynamodb.ReturnConsumedCapacityNone {
+		return nil
+	}
+	return &dynamodb.ConsumedCapacity{TableName: t.desc.TableName, CapacityUnits: aws.Float64(units)}
+}
+
+// readUnits returns the nominal read capacity of reading n items
+func readUnits(n int) float64 {
+	return float64(max(n, 1)) / 2
+}
+
+// check evaluates condition expr against the item of key in t (nil if it doesn't exist)
+func (t *table) check(key string, expr *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) error {
+	c, err := parseCondition(expr, names, values)
+	if err != nil || c == nil {
+		return err
+	}
+	item := t.items[key]
+	if item == nil {
+		item = drift.RawDynamoItem{}
+	}
+	ok, err := c.eval(item)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	if !ok {
+		return errConditionalCheckFailed
+	}
+	return nil
+}
+
+func (db *DB) getItem(in *dynamodb.GetItemInput, out *dynamodb.GetItemOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	key, err := t.lookupKey(in.Key)
+	if err != nil {
+		return err
+	}
+	paths, err := parseProjection(in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	if item := t.items[key]; item != nil {
+		out.Item = project(item, paths)
+	}
+	out.ConsumedCapacity = consumed(t, readUnits(1), in.ReturnConsumedCapacity)
+	return nil
+}
+
+// put validates and stores item in t, returning the item it replaced
+func (t *table) put(item drift.RawDynamoItem) (drift.RawDynamoItem, error) {
+	key, err := t.key(item)
+	if err != nil {
+		return nil, err
+	}
+	for _, ks := range t.indexes {
+		for _, k := range ks {
+			if v := item[k]; v != nil && v.S == nil && v.N == nil && v.B == nil {
+				return nil, validationError("index key attribute %v must be a string, number or binary", k)
+			}
+		}
+	}
+	old := t.items[key]
+	t.items[key] = item.Clone()
+	return old, nil
+}
+
+func (db *DB) putItem(in *dynamodb.PutItemInput, out *dynamodb.PutItemOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	key, err := t.key(in.Item)
+	if err != nil {
+		return err
+	}
+	if err := t.check(key, in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return err
+	}
+	old, err := t.put(in.Item)
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(in.ReturnValues) == dynamodb.ReturnValueAllOld {
+		out.Attributes = old
+	}
+	out.ConsumedCapacity = consumed(t, 1, in.ReturnConsumedCapacity)
+	return nil
+}
+
+// update applies an update expression to the item of key in t (creating it if necessary), returning the items before and after
+func (t *table) update(key map[string]*dynamodb.AttributeValue, expr *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (drift.RawDynamoItem, drift.RawDynamoItem, error) {
+	k, err := t.lookupKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	before := t.items[k]
+	after := before.Clone()
+	if after == nil {
+		after = drift.RawDynamoItem(keyOf(key, t.keys))
+	}
+	if aws.StringValue(expr) != "" {
+		if after, err = drift.ApplyUpdate(after, *expr, names, values); err != nil {
+			return nil, nil, validationError("invalid UpdateExpression: %v", err)
+		}
+	}
+	if nk, err := t.key(after); err != nil || nk != k {
+		return nil, nil, validationError("Cannot update attribute of the key")
+	}
+	if _, err := t.put(after); err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+func (db *DB) updateItem(in *dynamodb.UpdateItemInput, out *dynamodb.UpdateItemOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	key, err := t.lookupKey(in.Key)
+	if err != nil {
+		return err
+	}
+	if in.AttributeUpdates != nil || in.Expected != nil {
+		return validationError("legacy parameters aren't supported, use UpdateExpression and ConditionExpression")
+	}
+	if err := t.check(key, in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return err
+	}
+	before, after, err := t.update(in.Key, in.UpdateExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return err
+	}
+	switch aws.StringValue(in.ReturnValues) {
+	case dynamodb.ReturnValueAllOld, dynamodb.ReturnValueUpdatedOld:
+		out.Attributes = before
+	case dynamodb.ReturnValueAllNew, dynamodb.ReturnValueUpdatedNew:
+		out.Attributes = after
+	}
+	out.ConsumedCapacity = consumed(t, 1, in.ReturnConsumedCapacity)
+	return nil
+}
+
+func (db *DB) deleteItem(in *dynamodb.DeleteItemInput, out *dynamodb.DeleteItemOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	key, err := t.lookupKey(in.Key)
+	if err != nil {
+		return err
+	}
+	if err := t.check(key, in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return err
+	}
+	if aws.StringValue(in.ReturnValues) == dynamodb.ReturnValueAllOld {
+		out.Attributes = t.items[key]
+	}
+	delete(t.items, key)
+	out.ConsumedCapacity = consumed(t, 1, in.ReturnConsumedCapacity)
+	return nil
+}
+
+func (db *DB) batchGetItem(in *dynamodb.BatchGetItemInput, out *dynamodb.BatchGetItemOutput) error {
+	out.Responses = map[string][]map[string]*dynamodb.AttributeValue{}
+	for name, ka := range in.RequestItems {
+		t, err := db.table(aws.String(name))
+		if err != nil {
+			return err
+		}
+		paths, err := parseProjection(ka.ProjectionExpression, ka.ExpressionAttributeNames)
+		if err != nil {
+			return validationError("%v", err)
+		}
+		items := []map[string]*dynamodb.AttributeValue{}
+		for _, k := range ka.Keys {
+			key, err := t.lookupKey(k)
+			if err != nil {
+				return err
+			}
+			if item := t.items[key]; item != nil {
+				items = append(items, project(item, paths))
+			}
+		}
+		out.Responses[name] = items
+		if cc := consumed(t, readUnits(len(ka.Keys)), in.ReturnConsumedCapacity); cc != nil {
+			out.ConsumedCapacity = append(out.ConsumedCapacity, cc)
+		}
+	}
+	return nil
+}
+
+func (db *DB) batchWriteItem(in *dynamodb.BatchWriteItemInput, out *dynamodb.BatchWriteItemOutput) error {
+	for name, wrs := range in.RequestItems {
+		t, err := db.table(aws.String(name))
+		if err != nil {
+			return err
+		}
+		for _, wr := range wrs {
+			switch {
+			case wr.PutRequest != nil:
+				if _, err := t.put(wr.PutRequest.Item); err != nil {
+					return err
+				}
+			case wr.DeleteRequest != nil:
+				key, err := t.lookupKey(wr.DeleteRequest.Key)
+				if err != nil {
+					return err
+				}
+				delete(t.items, key)
+			}
+		}
+		if cc := consumed(t, float64(len(wrs)), in.ReturnConsumedCapacity); cc != nil {
+			out.ConsumedCapacity = append(out.ConsumedCapacity, cc)
+		}
+	}
+	out.UnprocessedItems = map[string][]*dynamodb.WriteRequest{}
+	return nil
+}
+
+// TransactWriteItems types, which the vendored SDK predates
+
+type transactWrite struct {
+	TableName                 *string
+	Key                       map[string]*dynamodb.AttributeValue
+	Item                      map[string]*dynamodb.AttributeValue
+	UpdateExpression          *string
+	ConditionExpression       *string
+	ExpressionAttributeNames  map[string]*string
+	ExpressionAttributeValues map[string]*dynamodb.AttributeValue
+}
+
+type transactWriteItem struct {
+	ConditionCheck *transactWrite
+	Put            *transactWrite
+	Update         *transactWrite
+	Delete         *transactWrite
+}
+
+type transactWriteItemsInput struct {
+	TransactItems          []*transactWriteItem
+	ReturnConsumedCapacity *string
+	ClientRequestToken     *string
+}
+
+type transactWriteItemsOutput struct {
+	ConsumedCapacity []*dynamodb.ConsumedCapacity
+}
+
+// transactWriteItems checks the conditions of all the writes before applying them, cancelling the transaction with the reason of each
+// write if one fails
+func (db *DB) transactWriteItems(in *transactWriteItemsInput, out *transactWriteItemsOutput) error {
+	if len(in.TransactItems) == 0 || len(in.TransactItems) > 100 {
+		return validationError("a transaction has 1 to 100 writes")
+	}
+	type write struct {
+		t   *table
+		w   *transactWrite
+		key string
+		op  string
+	}
+	writes := make([]write, len(in.TransactItems))
+	keys := map[string]bool{}
+	for i, ti := range in.TransactItems {
+		switch {
+		case ti.ConditionCheck != nil:
+			writes[i] = write{w: ti.ConditionCheck, op: "ConditionCheck"}
+		case ti.Put != nil:
+			writes[i] = write{w: ti.Put, op: "Put"}
+		case ti.Update != nil:
+			writes[i] = write{w: ti.Update, op: "Update"}
+		case ti.Delete != nil:
+			writes[i] = write{w: ti.Delete, op: "Delete"}
+		default:
+			return validationError("a transaction write requires an operation")
+		}
+		w := &writes[i]
+		var err error
+		if w.t, err = db.table(w.w.TableName); err != nil {
+			return err
+		}
+		if w.op == "Put" {
+			w.key, err = w.t.key(w.w.Item)
+		} else {
+			w.key, err = w.t.lookupKey(w.w.Key)
+		}
+		if err != nil {
+			return err
+		}
+		id := *w.w.TableName + "\x00" + w.key
+		if keys[id] {
+			return validationError("Transaction request cannot include multiple operations on one item")
+		}
+		keys[id] = true
+	}
+	reasons := make([]string, len(writes))
+	cancelled := false
+	for i, w := range writes {
+		reasons[i] = "None"
+		err := w.t.check(w.key, w.w.ConditionExpression, w.w.ExpressionAttributeNames, w.w.ExpressionAttributeValues)
+		switch {
+		case err == errConditionalCheckFailed:
+			reasons[i], cancelled = "ConditionalCheckFailed", true
+		case err != nil:
+			return err
+		}
+	}
+	if cancelled {
+		return &apiError{
+			code:    "TransactionCanceledException",
+			message: fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%v]", strings.Join(reasons, ", ")),
+		}
+	}
+	// Validate updates before writing anything
+	updated := make([]drift.RawDynamoItem, len(writes))
+	for i, w := range writes {
+		if w.op != "Update" {
+			continue
+		}
+		after := w.t.items[w.key].Clone()
+		if after == nil {
+			after = drift.RawDynamoItem(keyOf(w.w.Key, w.t.keys))
+		}
+		var err error
+		if after, err = drift.ApplyUpdate(after, aws.StringValue(w.w.UpdateExpression), w.w.ExpressionAttributeNames, w.w.ExpressionAttributeValues); err != nil {
+			return validationError("invalid UpdateExpression: %v", err)
+		}
+		if nk, err := w.t.key(after); err != nil || nk != w.key {
+			return validationError("Cannot update attribute of the key")
+		}
+		updated[i] = after
+	}
+	units := map[*table]float64{}
+	for i, w := range writes {
+		switch w.op {
+		case "Put":
+			if _, err := w.t.put(w.w.Item); err != nil {
+				return err
+			}
+		case "Update":
+			w.t.items[w.key] = updated[i]
+		case "Delete":
+			delete(w.t.items, w.key)
+		}
+		units[w.t] += 2
+	}
+	for t, u := range units {
+		if cc := consumed(t, u, in.ReturnConsumedCapacity); cc != nil {
+			out.ConsumedCapacity = append(out.ConsumedCapacity, cc)
+		}
+	}
+	return nil
+}
+
+// segment returns the scan segment of key value v among total segments
+func segment(v string, total int64) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(v))
+	return int64(h.Sum32() % uint32(total))
+}
+
+// sorted returns the items of t with the key attributes of order, sorted by them (in descending order if desc is set)
+func (t *table) sorted(order []string, desc bool) []drift.RawDynamoItem {
+	items := make([]drift.RawDynamoItem, 0, len(t.items))
+	for _, item := range t.items {
+		if _, err := encodeKey(item, order); err == nil {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		c := compareKeys(items[i], items[j], order)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return items
+}
+
+// compareKeys orders items a and b by the key attributes of order
+func compareKeys(a, b map[string]*dynamodb.AttributeValue, order []string) int {
+	for _, k := range order {
+		if c, _ := compare(a[k], b[k]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// page returns the items of sorted after start (if set) up to limit (if not 0), and the key of the last returned item if items remain
+func page(sorted []drift.RawDynamoItem, order []string, desc bool, start map[string]*dynamodb.AttributeValue, limit int64) ([]drift.RawDynamoItem, map[string]*dynamodb.AttributeValue) {
+	i := 0
+	if start != nil {
+		i = sort.Search(len(sorted), func(i int) bool {
+			c := compareKeys(sorted[i], start, order)
+			if desc {
+				return c < 0
+			}
+			return c > 0
+		})
+	}
+	items := sorted[i:]
+	if limit > 0 && int64(len(items)) > limit {
+		items = items[:limit]
+		return items, keyOf(items[len(items)-1], order)
+	}
+	return items, nil
+}
+
+// read returns the items (and count) of a page of a scan or query after filtering and projection
+func read(items []drift.RawDynamoItem, filter condition, paths [][]pathElement, count bool) ([]map[string]*dynamodb.AttributeValue, int64, error) {
+	out := []map[string]*dynamodb.AttributeValue{}
+	var n int64
+	for _, item := range items {
+		if filter != nil {
+			ok, err := filter.eval(item)
+			if err != nil {
+				return nil, 0, validationError("%v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		n++
+		if !count {
+			out = append(out, project(item, paths))
+		}
+	}
+	if count {
+		return nil, n, nil
+	}
+	return out, n, nil
+}
+
+// order returns the key attributes ordering the items of index (the table if "") of t
+func (t *table) order(index *string) ([]string, error) {
+	if aws.StringValue(index) == "" {
+		return t.keys, nil
+	}
+	ik, ok := t.indexes[*index]
+	if !ok {
+		return nil, validationError("The table does not have the specified index: %v", *index)
+	}
+	order := append([]string{}, ik...)
+	for _, k := range t.keys {
+		if !containsString(order, k) {
+			order = append(order, k)
+		}
+	}
+	return order, nil
+}
+
+func (db *DB) scan(in *dynamodb.ScanInput, out *dynamodb.ScanOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	if in.ScanFilter != nil || in.AttributesToGet != nil {
+		return validationError("legacy parameters aren't supported, use FilterExpression and ProjectionExpression")
+	}
+	order, err := t.order(in.IndexName)
+	if err != nil {
+		return err
+	}
+	filter, err := parseCondition(in.FilterExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	paths, err := parseProjection(in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	sorted := t.sorted(order, false)
+	if total := aws.Int64Value(in.TotalSegments); total > 1 {
+		seg := aws.Int64Value(in.Segment)
+		if seg < 0 || seg >= total {
+			return validationError("Segment must be less than TotalSegments")
+		}
+		segItems := sorted[:0:0]
+		for _, item := range sorted {
+			if hk, _ := encodeKey(item, order[:1]); segment(hk, total) == seg {
+				segItems = append(segItems, item)
+			}
+		}
+		sorted = segItems
+	}
+	items, last := page(sorted, order, false, in.ExclusiveStartKey, aws.Int64Value(in.Limit))
+	var n int64
+	if out.Items, n, err = read(items, filter, paths, aws.StringValue(in.Select) == dynamodb.SelectCount); err != nil {
+		return err
+	}
+	out.Count, out.ScannedCount = aws.Int64(n), aws.Int64(int64(len(items)))
+	out.LastEvaluatedKey = last
+	out.ConsumedCapacity = consumed(t, readUnits(len(items)), in.ReturnConsumedCapacity)
+	return nil
+}
+
+func (db *DB) query(in *dynamodb.QueryInput, out *dynamodb.QueryOutput) error {
+	t, err := db.table(in.TableName)
+	if err != nil {
+		return err
+	}
+	if in.KeyConditions != nil || in.QueryFilter != nil || in.AttributesToGet != nil {
+		return validationError("legacy parameters aren't supported, use KeyConditionExpression, FilterExpression and ProjectionExpression")
+	}
+	order, err := t.order(in.IndexName)
+	if err != nil {
+		return err
+	}
+	keyCond, err := parseCondition(in.KeyConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	if keyCond == nil {
+		return validationError("KeyConditionExpression is required")
+	}
+	filter, err := parseCondition(in.FilterExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	paths, err := parseProjection(in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	desc := in.ScanIndexForward != nil && !*in.ScanIndexForward
+	matching := []drift.RawDynamoItem{}
+	for _, item := range t.sorted(order, desc) {
+		ok, err := keyCond.eval(item)
+		if err != nil {
+			return validationError("%v", err)
+		}
+		if ok {
+			matching = append(matching, item)
+		}
+	}
+	items, last := page(matching, order, desc, in.ExclusiveStartKey, aws.Int64Value(in.Limit))
+	var n int64
+	if out.Items, n, err = read(items, filter, paths, aws.StringValue(in.Select) == dynamodb.SelectCount); err != nil {
+		return err
+	}
+	out.Count, out.ScannedCount = aws.Int64(n), aws.Int64(int64(len(items)))
+	out.LastEvaluatedKey = last
+	out.ConsumedCapacity = consumed(t, readUnits(len(items)), in.ReturnConsumedCapacity)
+	return nil
+}
+
+// Items returns a copy of the items of table name in key order, or nil if it doesn't exist
+func (db *DB) Items(name string) []drift.RawDynamoItem {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	t := db.tables[name]
+	if t == nil {
+		return nil
+	}
+	items := t.sorted(t.keys, false)
+	for i, item := range items {
+		items[i] = item.Clone()
+	}
+	return items
+}
+
+// Tables returns the names of the tables of db in ascending order
+func (db *DB) Tables() []string {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
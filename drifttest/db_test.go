@@ -0,0 +1,192 @@
+package drifttest
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func errorCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+func TestItemOperations(t *testing.T) {
+	db := New()
+	c := db.Client()
+	if _, err := c.GetItem(&dynamodb.GetItemInput{TableName: aws.String("users"), Key: map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("1")}}}); errorCode(err) != "ResourceNotFoundException" {
+		t.Fatalf("missing table: %v", err)
+	}
+	if err := db.Load(Fixture{Table: "users", HashKey: "ID"}); err != nil {
+		t.Fatalf("error loading fixture: %v", err)
+	}
+	key := map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("1")}}
+	put := &dynamodb.PutItemInput{
+		TableName:                aws.String("users"),
+		Item:                     map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("1")}, "Name": {S: aws.String("Jane")}},
+		ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{"#id": aws.String("ID")},
+	}
+	if _, err := c.PutItem(put); err != nil {
+		t.Fatalf("error putting item: %v", err)
+	}
+	if _, err := c.PutItem(put); errorCode(err) != "ConditionalCheckFailedException" {
+		t.Fatalf("conditional put should have failed: %v", err)
+	}
+	uo, err := c.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String("users"),
+		Key:                       key,
+		UpdateExpression:          aws.String("SET Visits = if_not_exists(Visits, :zero) + :one"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":zero": {N: aws.String("0")}, ":one": {N: aws.String("1")}},
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+		ReturnConsumedCapacity:    aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	})
+	if err != nil || *uo.Attributes["Visits"].N != "1" || *uo.Attributes["Name"].S != "Jane" || *uo.ConsumedCapacity.CapacityUnits != 1 {
+		t.Fatalf("bad update: %v, %v", uo, err)
+	}
+	if _, err := c.UpdateItem(&dynamodb.UpdateItemInput{TableName: aws.String("users"), Key: key, UpdateExpression: aws.String("SET ID = Name")}); errorCode(err) != "ValidationException" {
+		t.Fatalf("key update should have failed: %v", err)
+	}
+	gi := &dynamodb.GetItemInput{TableName: aws.String("users"), Key: key, ProjectionExpression: aws.String("Visits")}
+	if out, err := c.GetItem(gi); err != nil || len(out.Item) != 1 || *out.Item["Visits"].N != "1" {
+		t.Fatalf("bad item: %v, %v", out, err)
+	}
+	if _, err := c.DeleteItem(&dynamodb.DeleteItemInput{TableName: aws.String("users"), Key: key}); err != nil {
+		t.Fatalf("error deleting item: %v", err)
+	}
+	if out, err := c.GetItem(gi); err != nil || out.Item != nil {
+		t.Fatalf("item should have been deleted: %v, %v", out, err)
+	}
+	if _, err := c.GetItem(&dynamodb.GetItemInput{TableName: aws.String("users"), Key: map[string]*dynamodb.AttributeValue{"Name": {S: aws.String("Jane")}}}); errorCode(err) != "ValidationException" {
+		t.Fatalf("bad key should have failed: %v", err)
+	}
+}
+
+func TestScanAndQuery(t *testing.T) {
+	db := New()
+	c := db.Client()
+	_, err := c.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String("visits"),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("UserID"), AttributeType: aws.String("N")},
+			{AttributeName: aws.String("Day"), AttributeType: aws.String("N")},
+			{AttributeName: aws.String("Page"), AttributeType: aws.String("S")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("UserID"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("Day"), KeyType: aws.String("RANGE")},
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{{
+			IndexName:             aws.String("ByPage"),
+			KeySchema:             []*dynamodb.KeySchemaElement{{AttributeName: aws.String("Page"), KeyType: aws.String("HASH")}},
+			Projection:            &dynamodb.Projection{ProjectionType: aws.String("ALL")},
+			ProvisionedThroughput: &dynamodb.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(1), WriteCapacityUnits: aws.Int64(1)},
+		}},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(1), WriteCapacityUnits: aws.Int64(1)},
+	})
+	if err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	wrs := []*dynamodb.WriteRequest{}
+	for i := 0; i < 20; i++ {
+		item := map[string]*dynamodb.AttributeValue{
+			"UserID": {N: aws.String(strconv.Itoa(i % 4))},
+			"Day":    {N: aws.String(strconv.Itoa(i))},
+		}
+		if i%2 == 0 {
+			item["Page"] = &dynamodb.AttributeValue{S: aws.String("home")}
+		}
+		wrs = append(wrs, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}})
+	}
+	if _, err := c.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"visits": wrs}}); err != nil {
+		t.Fatalf("error writing items: %v", err)
+	}
+
+	scanned, filtered := 0, 0
+	for seg := int64(0); seg < 3; seg++ {
+		err := c.ScanPages(&dynamodb.ScanInput{
+			TableName:                 aws.String("visits"),
+			Segment:                   aws.Int64(seg),
+			TotalSegments:             aws.Int64(3),
+			Limit:                     aws.Int64(3),
+			FilterExpression:          aws.String("attribute_exists(Page) AND #d >= :ten"),
+			ExpressionAttributeNames:  map[string]*string{"#d": aws.String("Day")},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":ten": {N: aws.String("10")}},
+		}, func(out *dynamodb.ScanOutput, last bool) bool {
+			scanned += int(*out.ScannedCount)
+			filtered += len(out.Items)
+			return true
+		})
+		if err != nil {
+			t.Fatalf("error scanning: %v", err)
+		}
+	}
+	if scanned != 20 || filtered != 5 {
+		t.Fatalf("%v items scanned, %v returned", scanned, filtered)
+	}
+
+	days := []string{}
+	err = c.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String("visits"),
+		KeyConditionExpression:    aws.String("UserID = :u AND #d BETWEEN :from AND :to"),
+		ExpressionAttributeNames:  map[string]*string{"#d": aws.String("Day")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":u": {N: aws.String("1")}, ":from": {N: aws.String("2")}, ":to": {N: aws.String("17")}},
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int64(2),
+	}, func(out *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range out.Items {
+			days = append(days, *item["Day"].N)
+		}
+		return true
+	})
+	if err != nil || strings.Join(days, ",") != "17,13,9,5" {
+		t.Fatalf("bad query: %v, %v", days, err)
+	}
+	out, err := c.Query(&dynamodb.QueryInput{
+		TableName:                 aws.String("visits"),
+		IndexName:                 aws.String("ByPage"),
+		KeyConditionExpression:    aws.String("Page = :p"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":p": {S: aws.String("home")}},
+		Select:                    aws.String(dynamodb.SelectCount),
+	})
+	if err != nil || *out.Count != 10 || len(out.Items) != 0 {
+		t.Fatalf("bad index query: %v, %v", out, err)
+	}
+}
+
+func TestTransactWriteItems(t *testing.T) {
+	db, err := LoadFixtures(Fixture{Table: "users", HashKey: "ID", Items: []interface{}{user{ID: 1, Name: "Jane", Visits: 1}}})
+	if err != nil {
+		t.Fatalf("error loading fixtures: %v", err)
+	}
+	c := db.Client()
+	transact := func(cond string) error {
+		in := &transactWriteItemsInput{TransactItems: []*transactWriteItem{
+			{Put: &transactWrite{TableName: aws.String("users"), Item: map[string]*dynamodb.AttributeValue{"ID": {N: aws.String("2")}, "Name": {S: aws.String("John")}}}},
+			{Update: &transactWrite{
+				TableName:                 aws.String("users"),
+				Key:                       map[string]*dynamodb.AttributeValue{"ID": {N: aws.String("1")}},
+				UpdateExpression:          aws.String("ADD Visits :one"),
+				ConditionExpression:       aws.String(cond),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":one": {N: aws.String("1")}},
+			}},
+		}}
+		return c.NewRequest(&request.Operation{Name: "TransactWriteItems", HTTPMethod: "POST", HTTPPath: "/"}, in, &transactWriteItemsOutput{}).Send()
+	}
+	err = transact("Visits > :one")
+	if errorCode(err) != "TransactionCanceledException" || !strings.Contains(err.Error(), "[None, ConditionalCheckFailed]") {
+		t.Fatalf("transaction should have been cancelled: %v", err)
+	}
+	AssertItems(t, db, "users", user{ID: 1, Name: "Jane", Visits: 1})
+	if err := transact("Visits = :one"); err != nil {
+		t.Fatalf("error applying transaction: %v", err)
+	}
+	AssertItems(t, db, "users", user{ID: 1, Name: "Jane", Visits: 2}, user{ID: 2, Name: "John"})
+}
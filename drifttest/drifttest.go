@@ -0,0 +1,179 @@
+// Package drifttest runs drift migrations against an in-memory DynamoDB (see DB), so migrations can be tested without DynamoDB Local or
+// network access. Tests load fixtures, run the migration and assert the items of tables after the run:
+//
+//	func TestAddGreeting(t *testing.T) {
+//		db := drifttest.RunMigration(t, migrations.AddGreeting, drifttest.Fixture{
+//			Table:   "users",
+//			HashKey: "ID",
+//			Items:   []interface{}{User{ID: 1, Name: "Jane"}},
+//		})
+//		drifttest.AssertItems(t, db, "users", User{ID: 1, Name: "Jane", Greeting: "Hello Jane"})
+//	}
+package drifttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// MetaTableName is the meta table of the drifters returned by DB.Drifter
+const MetaTableName = "drift_migrations"
+
+// Fixture is a table and its initial items
+type Fixture struct {
+	Table    string
+	HashKey  string
+	RangeKey string        // Optional
+	Items    []interface{} // drift.RawDynamoItems, or values marshaled with dynamodbattribute.MarshalMap (ex: structs)
+}
+
+// marshalItems returns items as DynamoDB items
+func marshalItems(items []interface{}) ([]drift.RawDynamoItem, error) {
+	out := make([]drift.RawDynamoItem, len(items))
+	for i, item := range items {
+		switch v := item.(type) {
+		case drift.RawDynamoItem:
+			out[i] = v
+		case map[string]*dynamodb.AttributeValue:
+			out[i] = v
+		default:
+			m, err := dynamodbattribute.MarshalMap(item)
+			if err != nil {
+				return nil, fmt.Errorf("error marshaling item %v: %v", i, err)
+			}
+			out[i] = m
+		}
+	}
+	return out, nil
+}
+
+// LoadFixtures returns a new DB with the tables and items of fixtures
+func LoadFixtures(fixtures ...Fixture) (*DB, error) {
+	db := New()
+	return db, db.Load(fixtures...)
+}
+
+// Load creates the tables of fixtures which don't exist in db and puts their items. The types of key attributes are those of the items
+// (strings if there are none).
+func (db *DB) Load(fixtures ...Fixture) error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	for _, f := range fixtures {
+		items, err := marshalItems(f.Items)
+		if err != nil {
+			return fmt.Errorf("error loading fixture of table %v: %v", f.Table, err)
+		}
+		if db.tables[f.Table] == nil {
+			in := &dynamodb.CreateTableInput{
+				TableName:             aws.String(f.Table),
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(1), WriteCapacityUnits: aws.Int64(1)},
+			}
+			for _, k := range []struct{ name, keyType string }{{f.HashKey, dynamodb.KeyTypeHash}, {f.RangeKey, dynamodb.KeyTypeRange}} {
+				if k.name == "" {
+					continue
+				}
+				in.KeySchema = append(in.KeySchema, &dynamodb.KeySchemaElement{AttributeName: aws.String(k.name), KeyType: aws.String(k.keyType)})
+				in.AttributeDefinitions = append(in.AttributeDefinitions, &dynamodb.AttributeDefinition{
+					AttributeName: aws.String(k.name),
+					AttributeType: aws.String(keyType(items, k.name)),
+				})
+			}
+			if err := db.createTable(in, &dynamodb.CreateTableOutput{}); err != nil {
+				return fmt.Errorf("error creating table %v: %v", f.Table, err)
+			}
+		}
+		for i, item := range items {
+			if _, err := db.tables[f.Table].put(item); err != nil {
+				return fmt.Errorf("error loading item %v of table %v: %v", i, f.Table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// keyType returns the type of key attribute name in items
+func keyType(items []drift.RawDynamoItem, name string) string {
+	for _, item := range items {
+		if v := item[name]; v != nil {
+			return attributeType(v)
+		}
+	}
+	return dynamodb.ScalarAttributeTypeS
+}
+
+// Drifter returns a DynamoDrifter using db, whose meta table (MetaTableName) is initialized
+func (db *DB) Drifter() (*drift.DynamoDrifter, error) {
+	dd := &drift.DynamoDrifter{MetaTableName: MetaTableName, DynamoDB: db.Client()}
+	if err := dd.Init(1, 1); err != nil {
+		return nil, err
+	}
+	return dd, nil
+}
+
+// RunMigration runs m against a new DB loaded with fixtures, failing t if the fixtures can't be loaded or the run fails, and returns the
+// DB to assert the items of tables after the run (see AssertItems)
+func RunMigration(t testing.TB, m *drift.DynamoDrifterMigration, fixtures ...Fixture) *DB {
+	t.Helper()
+	db, err := LoadFixtures(fixtures...)
+	if err != nil {
+		t.Fatalf("error loading fixtures: %v", err)
+	}
+	dd, err := db.Drifter()
+	if err != nil {
+		t.Fatalf("error initializing drifter: %v", err)
+	}
+	if errs := dd.Run(context.Background(), m, 1, true, nil); len(errs) != 0 {
+		t.Fatalf("migration %v failed with %v error(s), first: %v", m.Number, len(errs), errs[0])
+	}
+	return db
+}
+
+// AssertItems fails t unless the items of table in db are want, in any order. Items of want are marshaled as those of fixtures.
+func AssertItems(t testing.TB, db *DB, table string, want ...interface{}) {
+	t.Helper()
+	wantItems, err := marshalItems(want)
+	if err != nil {
+		t.Fatalf("error marshaling expected items: %v", err)
+	}
+	db.mtx.Lock()
+	tbl := db.tables[table]
+	db.mtx.Unlock()
+	if tbl == nil {
+		t.Fatalf("table %v doesn't exist", table)
+	}
+	got := db.Items(table)
+	sort.SliceStable(wantItems, func(i, j int) bool { return compareKeys(wantItems[i], wantItems[j], tbl.keys) < 0 })
+	same := len(got) == len(wantItems)
+	for i := 0; same && i < len(got); i++ {
+		same = equal(&dynamodb.AttributeValue{M: got[i]}, &dynamodb.AttributeValue{M: wantItems[i]})
+	}
+	if !same {
+		t.Errorf("items of table %v:\n%v\nexpected:\n%v", table, itemsString(got), itemsString(wantItems))
+	}
+}
+
+// itemsString returns items as JSON, one line per item
+func itemsString(items []drift.RawDynamoItem) string {
+	s := ""
+	for _, item := range items {
+		var v interface{}
+		var b []byte
+		err := dynamodbattribute.UnmarshalMap(item, &v)
+		if err == nil {
+			b, err = json.Marshal(v)
+		}
+		if err != nil {
+			b = []byte(fmt.Sprintf("%v", item))
+		}
+		s += "\t" + string(b) + "\n"
+	}
+	return s
+}
@@ -0,0 +1,268 @@
+package drifttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+type user struct {
+	ID       int
+	Name     string
+	Greeting string `dynamodbav:",omitempty"`
+	Visits   int    `dynamodbav:",omitempty"`
+}
+
+type visit struct {
+	UserID int
+	Day    string
+}
+
+func TestRunMigration(t *testing.T) {
+	m := &drift.DynamoDrifterMigration{
+		Number:    1,
+		TableName: "users",
+		Callback: func(item drift.RawDynamoItem, action *drift.DrifterAction) error {
+			name := aws.StringValue(item["Name"].S)
+			if name == "Gone" {
+				return action.Delete(drift.RawDynamoItem{"ID": item["ID"]}, "")
+			}
+			if err := action.UpdateItem(drift.RawDynamoItem{"ID": item["ID"]}, "").Set("Greeting", "Hello "+name).Queue(); err != nil {
+				return err
+			}
+			return action.Insert(visit{UserID: 1, Day: "2020-01-0" + aws.StringValue(item["ID"].N)}, "visits")
+		},
+	}
+	db := RunMigration(t, m,
+		Fixture{Table: "users", HashKey: "ID", Items: []interface{}{
+			user{ID: 1, Name: "Jane"},
+			user{ID: 2, Name: "John"},
+			user{ID: 3, Name: "Gone"},
+		}},
+		Fixture{Table: "visits", HashKey: "UserID", RangeKey: "Day"},
+	)
+	AssertItems(t, db, "users", user{ID: 2, Name: "John", Greeting: "Hello John"}, user{ID: 1, Name: "Jane", Greeting: "Hello Jane"})
+	AssertItems(t, db, "visits", visit{UserID: 1, Day: "2020-01-01"}, visit{UserID: 1, Day: "2020-01-02"})
+	meta := db.Items(MetaTableName)
+	if len(meta) != 1 || aws.StringValue(meta[0]["Number"].N) != "1" || meta[0]["InProgress"] != nil && *meta[0]["InProgress"].BOOL {
+		t.Fatalf("bad meta table records: %v", meta)
+	}
+
+	ft := &fakeT{TB: t}
+	AssertItems(ft, db, "users", user{ID: 1, Name: "Jane"})
+	if !strings.Contains(ft.errors, `{"Greeting":"Hello Jane","ID":1,"Name":"Jane"}`) {
+		t.Fatalf("bad assertion failure: %v", ft.errors)
+	}
+}
+
+// fakeT records the errors of assertions
+type fakeT struct {
+	testing.TB
+	errors string
+}
+
+func (ft *fakeT) Helper() {}
+
+func (ft *fakeT) Errorf(format string, args ...interface{}) {
+	ft.errors += fmt.Sprintf(format, args...)
+}
+
+func TestRunMigrationTransactions(t *testing.T) {
+	db, err := LoadFixtures(Fixture{Table: "users", HashKey: "ID", Items: []interface{}{
+		user{ID: 1, Name: "Jane", Visits: 3},
+		user{ID: 2, Name: "John"},
+	}})
+	if err != nil {
+		t.Fatalf("error loading fixtures: %v", err)
+	}
+	dd, err := db.Drifter()
+	if err != nil {
+		t.Fatalf("error initializing drifter: %v", err)
+	}
+	m := &drift.DynamoDrifterMigration{
+		Number:           2,
+		TableName:        "users",
+		ItemTransactions: true,
+		Callback: func(item drift.RawDynamoItem, action *drift.DrifterAction) error {
+			if item["Visits"] == nil {
+				return nil
+			}
+			// move the visits of Jane to John
+			return action.Transact(
+				drift.TransactUpdate(map[string]int{"ID": 2}, map[string]interface{}{":v": 3}, "ADD Visits :v", nil, ""),
+				drift.TransactUpdate(map[string]int{"ID": 1}, nil, "REMOVE Visits", nil, ""),
+			)
+		},
+	}
+	if errs := dd.Run(context.Background(), m, 2, true, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	AssertItems(t, db, "users", user{ID: 1, Name: "Jane"}, user{ID: 2, Name: "John", Visits: 3})
+	if errs := dd.Run(context.Background(), m, 1, true, nil); len(errs) != 1 {
+		t.Fatalf("rerun should have failed: %v", errs)
+	}
+}
+
+func TestRunMigrationConditionCheck(t *testing.T) {
+	m := &drift.DynamoDrifterMigration{
+		Number:    2,
+		TableName: "users",
+		Callback: func(item drift.RawDynamoItem, action *drift.DrifterAction) error {
+			if *item["ID"].N != "2" {
+				return nil
+			}
+			// greet John only if Jane has visited
+			return action.Transact(
+				drift.TransactConditionCheck(map[string]int{"ID": 1}, "", drift.Condition{Expression: "Visits > :v", Values: map[string]interface{}{":v": 0}}),
+				drift.TransactUpdate(map[string]int{"ID": 2}, map[string]interface{}{":g": "Hi"}, "SET Greeting = :g", nil, ""),
+			)
+		},
+	}
+	for _, visits := range []int{0, 3} {
+		db, err := LoadFixtures(Fixture{Table: "users", HashKey: "ID", Items: []interface{}{
+			user{ID: 1, Name: "Jane", Visits: visits},
+			user{ID: 2, Name: "John"},
+		}})
+		if err != nil {
+			t.Fatalf("error loading fixtures: %v", err)
+		}
+		dd, err := db.Drifter()
+		if err != nil {
+			t.Fatalf("error initializing drifter: %v", err)
+		}
+		errs := dd.Run(context.Background(), m, 1, true, nil)
+		if visits == 0 {
+			if len(errs) != 1 || !errors.Is(errs[0], drift.ErrConditionFailed) {
+				t.Fatalf("failed condition checks should fail the transaction: %v", errs)
+			}
+			AssertItems(t, db, "users", user{ID: 1, Name: "Jane"}, user{ID: 2, Name: "John"})
+			continue
+		}
+		if len(errs) != 0 {
+			t.Fatalf("errors running migration: %v", errs)
+		}
+		AssertItems(t, db, "users", user{ID: 1, Name: "Jane", Visits: 3}, user{ID: 2, Name: "John", Greeting: "Hi"})
+	}
+}
+
+func TestRunMigrationTransactionConditionalUpdate(t *testing.T) {
+	db, err := LoadFixtures(Fixture{Table: "users", HashKey: "ID", Items: []interface{}{
+		user{ID: 1, Name: "Jane", Visits: 3},
+		user{ID: 2, Name: "John"},
+	}})
+	if err != nil {
+		t.Fatalf("error loading fixtures: %v", err)
+	}
+	dd, err := db.Drifter()
+	if err != nil {
+		t.Fatalf("error initializing drifter: %v", err)
+	}
+	m := &drift.DynamoDrifterMigration{
+		Number:    2,
+		TableName: "users",
+		Callback: func(item drift.RawDynamoItem, action *drift.DrifterAction) error {
+			if *item["ID"].N != "1" {
+				return nil
+			}
+			// move the visits of Jane to John, whose update is conditional on a greeting he doesn't have
+			return action.Transact(
+				drift.TransactUpdate(map[string]int{"ID": 1}, nil, "REMOVE Visits", nil, ""),
+				func(da *drift.DrifterAction) error {
+					return da.UpdateItem(map[string]int{"ID": 2}, "").Add("Visits", 3).If("attribute_exists(Greeting)", nil).Queue()
+				},
+			)
+		},
+	}
+	errs := dd.Run(context.Background(), m, 1, true, nil)
+	var aerr *drift.ActionError
+	if len(errs) != 1 || !errors.As(errs[0], &aerr) || !errors.Is(errs[0], drift.ErrConditionFailed) {
+		t.Fatalf("failed conditional updates should fail the transaction: %v", errs)
+	}
+	AssertItems(t, db, "users", user{ID: 1, Name: "Jane", Visits: 3}, user{ID: 2, Name: "John"})
+}
+
+func TestLoadFixtures(t *testing.T) {
+	db, err := LoadFixtures(Fixture{Table: "visits", HashKey: "UserID", RangeKey: "Day", Items: []interface{}{
+		visit{UserID: 1, Day: "2020-01-02"},
+		drift.RawDynamoItem{"UserID": {N: aws.String("1")}, "Day": {S: aws.String("2020-01-01")}},
+	}})
+	if err != nil {
+		t.Fatalf("error loading fixtures: %v", err)
+	}
+	out, err := db.Client().DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("visits")})
+	if err != nil {
+		t.Fatalf("error describing table: %v", err)
+	}
+	if ad := out.Table.AttributeDefinitions; len(ad) != 2 || *ad[0].AttributeType != "N" || *ad[1].AttributeType != "S" || *out.Table.ItemCount != 2 {
+		t.Fatalf("bad table description: %v", out.Table)
+	}
+	if items := db.Items("visits"); *items[0]["Day"].S != "2020-01-01" {
+		t.Fatalf("items should be in key order: %v", items)
+	}
+	if _, err := LoadFixtures(Fixture{Table: "visits", HashKey: "UserID", Items: []interface{}{user{ID: 1}}}); err == nil {
+		t.Fatalf("items without key should fail")
+	}
+}
+
+func TestRunMigrationFilter(t *testing.T) {
+	called := 0
+	m := &drift.DynamoDrifterMigration{
+		Number:    3,
+		TableName: "users",
+		Filter:    &drift.Condition{Expression: "attribute_not_exists(Greeting)"},
+		Callback: func(item drift.RawDynamoItem, action *drift.DrifterAction) error {
+			called++
+			return action.UpdateItem(drift.RawDynamoItem{"ID": item["ID"]}, "").Set("Greeting", "Hello "+aws.StringValue(item["Name"].S)).Queue()
+		},
+	}
+	db := RunMigration(t, m, Fixture{Table: "users", HashKey: "ID", Items: []interface{}{
+		user{ID: 1, Name: "Jane"},
+		user{ID: 2, Name: "John", Greeting: "Hi John"},
+	}})
+	if called != 1 {
+		t.Fatalf("callback should only be invoked for unfiltered items: %v", called)
+	}
+	AssertItems(t, db, "users", user{ID: 1, Name: "Jane", Greeting: "Hello Jane"}, user{ID: 2, Name: "John", Greeting: "Hi John"})
+}
+
+func TestRunCancelled(t *testing.T) {
+	db, err := LoadFixtures(Fixture{Table: "users", HashKey: "ID", Items: []interface{}{user{ID: 1, Name: "Jane"}}})
+	if err != nil {
+		t.Fatalf("error loading fixtures: %v", err)
+	}
+	dd, err := db.Drifter()
+	if err != nil {
+		t.Fatalf("error initializing drifter: %v", err)
+	}
+	m := &drift.DynamoDrifterMigration{
+		Number:    4,
+		TableName: "users",
+		Callback: func(item drift.RawDynamoItem, action *drift.DrifterAction) error {
+			return action.UpdateItem(drift.RawDynamoItem{"ID": item["ID"]}, "").Set("Greeting", "Hello").Queue()
+		},
+	}
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+	if errs := dd.Run(ctx, m, 1, true, nil); len(errs) == 0 || !errors.Is(errs[0], context.Canceled) {
+		t.Fatalf("cancelled run should have failed: %v", errs)
+	}
+	if applied, err := dd.Applied(); err != nil || len(applied) != 0 {
+		t.Fatalf("cancelled run should not be recorded: %v, %v", applied, err)
+	}
+	AssertItems(t, db, "users", user{ID: 1, Name: "Jane"})
+	if errs := dd.Run(context.Background(), m, 1, true, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	if errs := dd.Undo(ctx, m, 1, true, nil); len(errs) == 0 {
+		t.Fatalf("cancelled undo should have failed")
+	}
+	if applied, err := dd.Applied(); err != nil || len(applied) != 1 {
+		t.Fatalf("cancelled undo should not delete the record: %v, %v", applied, err)
+	}
+}
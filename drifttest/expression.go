@@ -0,0 +1,717 @@
+package drifttest
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// pathElement is an element of a document path: an attribute name, or a list index if name is empty
+type pathElement struct {
+	name  string
+	index int
+}
+
+// condition is a parsed condition expression (ConditionExpression, FilterExpression or KeyConditionExpression)
+type condition interface {
+	eval(item drift.RawDynamoItem) (bool, error)
+}
+
+// operand is an operand of a condition: a document path, an expression attribute value or size(path). Missing paths evaluate to nil.
+type operand interface {
+	value(item drift.RawDynamoItem) (*dynamodb.AttributeValue, error)
+}
+
+type pathOperand []pathElement
+
+func (p pathOperand) value(item drift.RawDynamoItem) (*dynamodb.AttributeValue, error) {
+	return getPath(item, p), nil
+}
+
+type valueOperand struct {
+	v *dynamodb.AttributeValue
+}
+
+func (v valueOperand) value(drift.RawDynamoItem) (*dynamodb.AttributeValue, error) {
+	return v.v, nil
+}
+
+type sizeOperand []pathElement
+
+func (p sizeOperand) value(item drift.RawDynamoItem) (*dynamodb.AttributeValue, error) {
+	v := getPath(item, p)
+	if v == nil {
+		return nil, nil
+	}
+	var n int
+	switch {
+	case v.S != nil:
+		n = utf8.RuneCountInString(*v.S)
+	case v.B != nil:
+		n = len(v.B)
+	case v.SS != nil:
+		n = len(v.SS)
+	case v.NS != nil:
+		n = len(v.NS)
+	case v.BS != nil:
+		n = len(v.BS)
+	case v.L != nil:
+		n = len(v.L)
+	case v.M != nil:
+		n = len(v.M)
+	default:
+		return nil, fmt.Errorf("invalid operand type for size: %v", attributeType(v))
+	}
+	return &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(n))}, nil
+}
+
+type andCondition [2]condition
+
+func (c andCondition) eval(item drift.RawDynamoItem) (bool, error) {
+	ok, err := c[0].eval(item)
+	if err != nil || !ok {
+		return false, err
+	}
+	return c[1].eval(item)
+}
+
+type orCondition [2]condition
+
+func (c orCondition) eval(item drift.RawDynamoItem) (bool, error) {
+	ok, err := c[0].eval(item)
+	if err != nil || ok {
+		return ok, err
+	}
+	return c[1].eval(item)
+}
+
+type notCondition struct {
+	c condition
+}
+
+func (c notCondition) eval(item drift.RawDynamoItem) (bool, error) {
+	ok, err := c.c.eval(item)
+	return !ok, err
+}
+
+// comparison compares two operands. As in DynamoDB, a missing attribute is unequal to any value, and not ordered.
+type comparison struct {
+	op   string
+	a, b operand
+}
+
+func (c comparison) eval(item drift.RawDynamoItem) (bool, error) {
+	a, err := c.a.value(item)
+	if err != nil {
+		return false, err
+	}
+	b, err := c.b.value(item)
+	if err != nil {
+		return false, err
+	}
+	switch c.op {
+	case "=":
+		return equal(a, b), nil
+	case "<>":
+		return !equal(a, b), nil
+	}
+	cmp, ok := compare(a, b)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type between struct {
+	a, lo, hi operand
+}
+
+func (c between) eval(item drift.RawDynamoItem) (bool, error) {
+	ge, err := comparison{op: ">=", a: c.a, b: c.lo}.eval(item)
+	if err != nil || !ge {
+		return false, err
+	}
+	return comparison{op: "<=", a: c.a, b: c.hi}.eval(item)
+}
+
+type inList struct {
+	a    operand
+	list []operand
+}
+
+func (c inList) eval(item drift.RawDynamoItem) (bool, error) {
+	for _, o := range c.list {
+		if ok, err := (comparison{op: "=", a: c.a, b: o}).eval(item); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// function is a call of a condition function (attribute_exists, attribute_not_exists, attribute_type, begins_with or contains)
+type function struct {
+	name string
+	path []pathElement
+	arg  operand
+}
+
+func (f function) eval(item drift.RawDynamoItem) (bool, error) {
+	v := getPath(item, f.path)
+	var arg *dynamodb.AttributeValue
+	if f.arg != nil {
+		var err error
+		if arg, err = f.arg.value(item); err != nil {
+			return false, err
+		}
+	}
+	switch f.name {
+	case "attribute_exists":
+		return v != nil, nil
+	case "attribute_not_exists":
+		return v == nil, nil
+	case "attribute_type":
+		if arg == nil || arg.S == nil {
+			return false, fmt.Errorf("the type operand of attribute_type must be a string")
+		}
+		return v != nil && attributeType(v) == *arg.S, nil
+	case "begins_with":
+		switch {
+		case v == nil || arg == nil:
+			return false, nil
+		case v.S != nil && arg.S != nil:
+			return strings.HasPrefix(*v.S, *arg.S), nil
+		case v.B != nil && arg.B != nil:
+			return bytes.HasPrefix(v.B, arg.B), nil
+		}
+		return false, nil
+	}
+	if v == nil || arg == nil {
+		return false, nil
+	}
+	switch {
+	case v.S != nil && arg.S != nil:
+		return strings.Contains(*v.S, *arg.S), nil
+	case v.B != nil && arg.B != nil:
+		return bytes.Contains(v.B, arg.B), nil
+	case v.SS != nil && arg.S != nil:
+		return containsString(aws.StringValueSlice(v.SS), *arg.S), nil
+	case v.NS != nil && arg.N != nil:
+		for _, n := range v.NS {
+			if equal(&dynamodb.AttributeValue{N: n}, arg) {
+				return true, nil
+			}
+		}
+	case v.BS != nil && arg.B != nil:
+		for _, b := range v.BS {
+			if bytes.Equal(b, arg.B) {
+				return true, nil
+			}
+		}
+	case v.L != nil:
+		for _, e := range v.L {
+			if equal(e, arg) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// parser parses condition and projection expressions
+type parser struct {
+	tokens []string
+	pos    int
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+}
+
+func newParser(expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*parser, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{tokens: tokens, names: names, values: values}, nil
+}
+
+// parseCondition parses a condition expression, returning nil if expr is empty
+func parseCondition(expr *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (condition, error) {
+	if aws.StringValue(expr) == "" {
+		return nil, nil
+	}
+	p, err := newParser(*expr, names, values)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", *expr, err)
+	}
+	c, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", *expr, err)
+	}
+	return c, nil
+}
+
+// parseProjection parses a projection expression, returning nil if expr is empty
+func parseProjection(expr *string, names map[string]*string) ([][]pathElement, error) {
+	if aws.StringValue(expr) == "" {
+		return nil, nil
+	}
+	p, err := newParser(*expr, names, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid projection %q: %v", *expr, err)
+	}
+	paths := [][]pathElement{}
+	for {
+		path, err := p.path()
+		if err != nil {
+			return nil, fmt.Errorf("invalid projection %q: %v", *expr, err)
+		}
+		paths = append(paths, path)
+		if p.peek() == "" {
+			return paths, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, fmt.Errorf("invalid projection %q: %v", *expr, err)
+		}
+	}
+}
+
+// tokenize splits an expression into names (including #names and :values), numbers, comparators and punctuation
+func tokenize(expr string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#' || c == ':' || isNameChar(c):
+			j := i + 1
+			for j < len(expr) && isNameChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		case strings.HasPrefix(expr[i:], "<>") || strings.HasPrefix(expr[i:], "<=") || strings.HasPrefix(expr[i:], ">="):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case strings.IndexByte("(),=<>[].", c) >= 0:
+			tokens = append(tokens, expr[i:i+1])
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %v", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) expect(t string) error {
+	if got := p.next(); got != t {
+		return fmt.Errorf("unexpected %q, expecting %q", got, t)
+	}
+	return nil
+}
+
+// keyword returns whether the next token is keyword kw (case insensitive), consuming it if so
+func (p *parser) keyword(kw string) bool {
+	if strings.EqualFold(p.peek(), kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (condition, error) {
+	c, err := p.and()
+	for err == nil && p.keyword("OR") {
+		var d condition
+		if d, err = p.and(); err == nil {
+			c = orCondition{c, d}
+		}
+	}
+	return c, err
+}
+
+func (p *parser) and() (condition, error) {
+	c, err := p.not()
+	for err == nil && p.keyword("AND") {
+		var d condition
+		if d, err = p.not(); err == nil {
+			c = andCondition{c, d}
+		}
+	}
+	return c, err
+}
+
+func (p *parser) not() (condition, error) {
+	if p.keyword("NOT") {
+		c, err := p.not()
+		return notCondition{c}, err
+	}
+	return p.primary()
+}
+
+// primary parses a parenthesized condition, a function call or a comparison
+func (p *parser) primary() (condition, error) {
+	if p.peek() == "(" {
+		p.next()
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+	if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == "(" {
+		switch name := p.peek(); name {
+		case "attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains":
+			p.pos += 2
+			path, err := p.path()
+			if err != nil {
+				return nil, err
+			}
+			f := function{name: name, path: path}
+			if name != "attribute_exists" && name != "attribute_not_exists" {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+				if f.arg, err = p.operand(); err != nil {
+					return nil, err
+				}
+			}
+			return f, p.expect(")")
+		}
+	}
+	a, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	switch t := p.peek(); {
+	case t == "=" || t == "<>" || t == "<" || t == "<=" || t == ">" || t == ">=":
+		p.next()
+		b, err := p.operand()
+		return comparison{op: t, a: a, b: b}, err
+	case p.keyword("BETWEEN"):
+		lo, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, fmt.Errorf("unexpected %q, expecting AND", p.peek())
+		}
+		hi, err := p.operand()
+		return between{a: a, lo: lo, hi: hi}, err
+	case p.keyword("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		c := inList{a: a}
+		for {
+			o, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			c.list = append(c.list, o)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		return c, p.expect(")")
+	default:
+		return nil, fmt.Errorf("unexpected %q, expecting a comparator, BETWEEN or IN", t)
+	}
+}
+
+// operand parses a :value, size(path) or a document path
+func (p *parser) operand() (operand, error) {
+	t := p.peek()
+	if strings.HasPrefix(t, ":") {
+		p.next()
+		v, ok := p.values[t]
+		if !ok {
+			return nil, fmt.Errorf("expression attribute value %v is not defined", t)
+		}
+		return valueOperand{v}, nil
+	}
+	if t == "size" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == "(" {
+		p.pos += 2
+		path, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		return sizeOperand(path), p.expect(")")
+	}
+	path, err := p.path()
+	return pathOperand(path), err
+}
+
+// path parses a document path
+func (p *parser) path() ([]pathElement, error) {
+	name, err := p.name(p.next())
+	if err != nil {
+		return nil, err
+	}
+	path := []pathElement{{name: name}}
+	for {
+		switch p.peek() {
+		case ".":
+			p.next()
+			name, err := p.name(p.next())
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElement{name: name})
+		case "[":
+			p.next()
+			i, err := strconv.Atoi(p.next())
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("bad list index in document path")
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, pathElement{index: i})
+		default:
+			return path, nil
+		}
+	}
+}
+
+// name resolves an attribute name token
+func (p *parser) name(t string) (string, error) {
+	switch {
+	case strings.HasPrefix(t, "#"):
+		n, ok := p.names[t]
+		if !ok {
+			return "", fmt.Errorf("expression attribute name %v is not defined", t)
+		}
+		return aws.StringValue(n), nil
+	case t == "" || strings.HasPrefix(t, ":") || !isNameChar(t[0]) || t[0] >= '0' && t[0] <= '9':
+		return "", fmt.Errorf("unexpected %q, expecting an attribute name", t)
+	}
+	return t, nil
+}
+
+// getPath returns the value at path in item, or nil if it doesn't exist
+func getPath(item drift.RawDynamoItem, path []pathElement) *dynamodb.AttributeValue {
+	v := item[path[0].name]
+	for _, pe := range path[1:] {
+		switch {
+		case v == nil:
+			return nil
+		case pe.name != "":
+			v = v.M[pe.name]
+		case pe.index < len(v.L):
+			v = v.L[pe.index]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// project returns a copy of item with only the attributes of paths. Projected list elements are kept in the order of paths.
+func project(item drift.RawDynamoItem, paths [][]pathElement) drift.RawDynamoItem {
+	if paths == nil {
+		return item.Clone()
+	}
+	out := drift.RawDynamoItem{}
+	positions := map[*dynamodb.AttributeValue]map[int]int{} // positions of the projected elements of lists
+	for _, path := range paths {
+		v := getPath(item, path)
+		if v == nil {
+			continue
+		}
+		parent := &dynamodb.AttributeValue{M: out}
+		for i, pe := range path {
+			last := i == len(path)-1
+			var child *dynamodb.AttributeValue
+			if pe.name != "" {
+				child = parent.M[pe.name]
+			} else if j, ok := positions[parent][pe.index]; ok {
+				child = parent.L[j]
+			}
+			switch {
+			case last:
+				child = drift.CloneAttributeValue(v)
+			case child != nil:
+			case path[i+1].name != "":
+				child = &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{}}
+			default:
+				child = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+			}
+			if pe.name != "" {
+				parent.M[pe.name] = child
+			} else if j, ok := positions[parent][pe.index]; ok {
+				parent.L[j] = child
+			} else {
+				if positions[parent] == nil {
+					positions[parent] = map[int]int{}
+				}
+				positions[parent][pe.index] = len(parent.L)
+				parent.L = append(parent.L, child)
+			}
+			parent = child
+		}
+	}
+	return out
+}
+
+// attributeType returns the DynamoDB type of v (ex: "S")
+func attributeType(v *dynamodb.AttributeValue) string {
+	switch {
+	case v.S != nil:
+		return "S"
+	case v.N != nil:
+		return "N"
+	case v.B != nil:
+		return "B"
+	case v.BOOL != nil:
+		return "BOOL"
+	case v.NULL != nil:
+		return "NULL"
+	case v.SS != nil:
+		return "SS"
+	case v.NS != nil:
+		return "NS"
+	case v.BS != nil:
+		return "BS"
+	case v.M != nil:
+		return "M"
+	case v.L != nil:
+		return "L"
+	}
+	return ""
+}
+
+// parseNumber parses a number attribute value
+func parseNumber(s string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(s)
+}
+
+// compare orders scalar values of the same type (S, N or B), returning false if they can't be ordered
+func compare(a, b *dynamodb.AttributeValue) (int, bool) {
+	switch {
+	case a == nil || b == nil:
+		return 0, false
+	case a.S != nil && b.S != nil:
+		return strings.Compare(*a.S, *b.S), true
+	case a.N != nil && b.N != nil:
+		x, ok := parseNumber(*a.N)
+		y, ok2 := parseNumber(*b.N)
+		if !ok || !ok2 {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case a.B != nil && b.B != nil:
+		return bytes.Compare(a.B, b.B), true
+	}
+	return 0, false
+}
+
+// equal returns whether a and b are equal values: numbers are compared numerically and sets regardless of their order
+func equal(a, b *dynamodb.AttributeValue) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if cmp, ok := compare(a, b); ok {
+		return cmp == 0
+	}
+	if attributeType(a) != attributeType(b) {
+		return false
+	}
+	switch {
+	case a.BOOL != nil:
+		return *a.BOOL == *b.BOOL
+	case a.NULL != nil:
+		return true
+	case a.SS != nil:
+		return equalSets(aws.StringValueSlice(a.SS), aws.StringValueSlice(b.SS), strings.Compare)
+	case a.NS != nil:
+		return equalSets(aws.StringValueSlice(a.NS), aws.StringValueSlice(b.NS), func(x, y string) int {
+			c, _ := compare(&dynamodb.AttributeValue{N: &x}, &dynamodb.AttributeValue{N: &y})
+			return c
+		})
+	case a.BS != nil:
+		return equalSets(a.BS, b.BS, bytes.Compare)
+	case a.L != nil:
+		if len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !equal(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	case a.M != nil:
+		if len(a.M) != len(b.M) {
+			return false
+		}
+		for k, v := range a.M {
+			if !equal(v, b.M[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func equalSets[T any](a, b []T, cmp func(x, y T) int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]T{}, a...), append([]T{}, b...)
+	sort.Slice(a, func(i, j int) bool { return cmp(a[i], a[j]) < 0 })
+	sort.Slice(b, func(i, j int) bool { return cmp(b[i], b[j]) < 0 })
+	for i := range a {
+		if cmp(a[i], b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package drifttest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+func TestConditions(t *testing.T) {
+	item := drift.RawDynamoItem{
+		"ID":    {N: aws.String("10")},
+		"Name":  {S: aws.String("Jane")},
+		"Tags":  {SS: aws.StringSlice([]string{"a", "b"})},
+		"Admin": {BOOL: aws.Bool(true)},
+		"Address": {M: map[string]*dynamodb.AttributeValue{
+			"City":  {S: aws.String("Paris")},
+			"Lines": {L: []*dynamodb.AttributeValue{{S: aws.String("1 rue")}, {S: aws.String("2e")}}},
+		}},
+	}
+	names := map[string]*string{"#n": aws.String("Name"), "#a": aws.String("Address")}
+	values := map[string]*dynamodb.AttributeValue{
+		":ten":   {N: aws.String("10.0")},
+		":five":  {N: aws.String("5")},
+		":jane":  {S: aws.String("Jane")},
+		":ja":    {S: aws.String("Ja")},
+		":a":     {S: aws.String("a")},
+		":true":  {BOOL: aws.Bool(true)},
+		":paris": {S: aws.String("Paris")},
+		":ss":    {S: aws.String("SS")},
+		":tags":  {SS: aws.StringSlice([]string{"b", "a"})},
+	}
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"ID = :ten", true},
+		{"ID <> :ten", false},
+		{"ID > :five AND ID >= :ten AND NOT ID < :ten", true},
+		{"ID BETWEEN :five AND :ten", true},
+		{"ID IN (:five, :jane)", false},
+		{"#n IN (:five, :jane)", true},
+		{"#n < :five", false},
+		{"Missing = :ten OR Missing <> :ten", true},
+		{"Missing > :five", false},
+		{"attribute_exists(#a.City) and attribute_not_exists(#a.Zip)", true},
+		{"#a.City = :paris AND begins_with(#a.Lines[0], :jane)", false},
+		{"begins_with(#n, :ja) AND contains(Tags, :a) AND contains(#n, :a)", true},
+		{"attribute_type(Tags, :ss) AND Tags = :tags", true},
+		{"size(#a.Lines) = :five OR (Admin = :true AND size(#n) < :five)", true},
+	}
+	for _, c := range cases {
+		cond, err := parseCondition(aws.String(c.expr), names, values)
+		if err != nil {
+			t.Fatalf("error parsing %q: %v", c.expr, err)
+		}
+		if got, err := cond.eval(item); err != nil || got != c.want {
+			t.Errorf("%q: %v (%v), expected %v", c.expr, got, err, c.want)
+		}
+	}
+	for _, expr := range []string{"ID = ", "ID = :undefined", "#undefined = :ten", "ID == :ten", "ID BETWEEN :five", "(ID = :ten", "ID = :ten ID"} {
+		if _, err := parseCondition(aws.String(expr), names, values); err == nil {
+			t.Errorf("%q should fail", expr)
+		}
+	}
+}
+
+func TestProject(t *testing.T) {
+	item := drift.RawDynamoItem{
+		"ID":   {N: aws.String("1")},
+		"Name": {S: aws.String("Jane")},
+		"Address": {M: map[string]*dynamodb.AttributeValue{
+			"City":  {S: aws.String("Paris")},
+			"Zip":   {S: aws.String("75001")},
+			"Lines": {L: []*dynamodb.AttributeValue{{S: aws.String("a")}, {S: aws.String("b")}, {S: aws.String("c")}}},
+		}},
+	}
+	paths, err := parseProjection(aws.String("ID, #a.City, #a.Lines[2], #a.Lines[0], Missing"), map[string]*string{"#a": aws.String("Address")})
+	if err != nil {
+		t.Fatalf("error parsing projection: %v", err)
+	}
+	want := drift.RawDynamoItem{
+		"ID": {N: aws.String("1")},
+		"Address": {M: map[string]*dynamodb.AttributeValue{
+			"City":  {S: aws.String("Paris")},
+			"Lines": {L: []*dynamodb.AttributeValue{{S: aws.String("c")}, {S: aws.String("a")}}},
+		}},
+	}
+	if got := project(item, paths); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad projection: %v", got)
+	}
+}
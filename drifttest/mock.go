@@ -0,0 +1,77 @@
+package drifttest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// MockClient returns a DynamoDB client serving its requests with the methods of mock sending requests (ex: Scan, PutItem), so the usual
+// mocks embedding dynamodbiface.DynamoDBAPI can be the client of a drifter. drift makes its requests with the request methods of its client
+// (ex: ScanRequest), which these mocks don't implement, and needs the requests they return for its retryer, request options and run
+// reports:
+//
+//	type scanMock struct {
+//		dynamodbiface.DynamoDBAPI
+//	}
+//
+//	func (m *scanMock) Scan(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) { ... }
+//
+//	dd := &drift.DynamoDrifter{MetaTableName: "migrations", DynamoDB: drifttest.MockClient(&scanMock{})}
+//
+// awserr.Error errors returned by mock are returned with their code. Operations mock doesn't implement (including those the vendored SDK
+// predates, such as TransactWriteItems) fail with an UnknownOperationException.
+func MockClient(mock dynamodbiface.DynamoDBAPI) *dynamodb.DynamoDB {
+	return client(&mockTransport{mock: mock})
+}
+
+// mockTransport serves DynamoDB API requests with the methods of a mock
+type mockTransport struct {
+	mock dynamodbiface.DynamoDBAPI
+}
+
+func (t *mockTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	op, body, err := readRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	out, err := t.serve(op, body)
+	return response(r, out, err), nil
+}
+
+// serve calls the method of operation op of the mock with the JSON input body
+func (t *mockTransport) serve(op string, body []byte) (out interface{}, err error) {
+	unknown := func(reason interface{}) error {
+		return &apiError{code: "UnknownOperationException", message: fmt.Sprintf("mock %T doesn't implement %v: %v", t.mock, op, reason)}
+	}
+	m := reflect.ValueOf(t.mock).MethodByName(op)
+	if !m.IsValid() || m.Type().NumIn() != 1 || m.Type().NumOut() != 2 || m.Type().In(0).Kind() != reflect.Ptr {
+		return nil, unknown("no such method")
+	}
+	in := reflect.New(m.Type().In(0).Elem())
+	if err := jsonutil.UnmarshalJSON(in.Interface(), bytes.NewReader(body)); err != nil {
+		return nil, &apiError{code: "SerializationException", message: err.Error()}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, unknown(r) // the embedded interface of the mock is nil
+		}
+	}()
+	res := m.Call([]reflect.Value{in})
+	if e, _ := res[1].Interface().(error); e != nil {
+		if aerr, ok := e.(awserr.Error); ok {
+			return nil, &apiError{code: aerr.Code(), message: aerr.Message()}
+		}
+		return nil, e
+	}
+	if res[0].IsNil() {
+		return reflect.New(res[0].Type().Elem()).Interface(), nil
+	}
+	return res[0].Interface(), nil
+}
@@ -0,0 +1,83 @@
+package drifttest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// itemMock is the usual mock of a DynamoDB client, implementing the methods sending the requests drift runs need (with the client of a DB)
+type itemMock struct {
+	dynamodbiface.DynamoDBAPI
+	db    *dynamodb.DynamoDB
+	scans int
+}
+
+func (m *itemMock) Scan(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	m.scans++
+	return m.db.Scan(in)
+}
+
+func (m *itemMock) GetItem(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return m.db.GetItem(in)
+}
+
+func (m *itemMock) PutItem(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	return m.db.PutItem(in)
+}
+
+func (m *itemMock) UpdateItem(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	return m.db.UpdateItem(in)
+}
+
+func (m *itemMock) ListTables(in *dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error) {
+	return m.db.ListTables(in)
+}
+
+func (m *itemMock) DescribeTable(in *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	return m.db.DescribeTable(in)
+}
+
+func TestMockClient(t *testing.T) {
+	db, err := LoadFixtures(
+		Fixture{Table: "users", HashKey: "ID", Items: []interface{}{user{ID: 1, Name: "Jane"}, user{ID: 2, Name: "John"}}},
+		Fixture{Table: MetaTableName, HashKey: "Number"},
+	)
+	if err != nil {
+		t.Fatalf("error loading fixtures: %v", err)
+	}
+	mock := &itemMock{db: db.Client()}
+	dd := &drift.DynamoDrifter{MetaTableName: MetaTableName, DynamoDB: MockClient(mock)}
+	m := &drift.DynamoDrifterMigration{
+		Number:    1,
+		TableName: "users",
+		Callback: func(item drift.RawDynamoItem, action *drift.DrifterAction) error {
+			return action.UpdateItem(drift.RawDynamoItem{"ID": item["ID"]}, "").Set("Greeting", "Hello "+aws.StringValue(item["Name"].S)).Queue()
+		},
+	}
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration with a mock: %v", errs)
+	}
+	if mock.scans == 0 {
+		t.Fatalf("the mock should serve the scans of the run")
+	}
+	AssertItems(t, db, "users", user{ID: 1, Name: "Jane", Greeting: "Hello Jane"}, user{ID: 2, Name: "John", Greeting: "Hello John"})
+
+	c := MockClient(mock)
+	put := &dynamodb.PutItemInput{
+		TableName:           aws.String("users"),
+		Item:                map[string]*dynamodb.AttributeValue{"ID": {N: aws.String("1")}},
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	}
+	if _, err := c.PutItem(put); errorCode(err) != "ConditionalCheckFailedException" {
+		t.Fatalf("errors of the mock should keep their code: %v", err)
+	}
+	if _, err := c.DeleteItem(&dynamodb.DeleteItemInput{TableName: aws.String("users"), Key: put.Item}); errorCode(err) != "UnknownOperationException" || !strings.Contains(err.Error(), "DeleteItem") {
+		t.Fatalf("operations the mock doesn't implement should fail: %v", err)
+	}
+}
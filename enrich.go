@@ -0,0 +1,204 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// batchGetLimit is the maximum number of keys of a BatchGetItem request
+const batchGetLimit = 100
+
+// Enrichment declares the related item of each scanned item, in another table, see EnrichedCallback
+type Enrichment struct {
+	Table  string            // Table of the related items
+	KeyMap map[string]string // Key attributes of the related item to the attributes of the scanned item holding them (items missing one have no related item)
+
+	// Alternative to KeyMap: returns the key of the related item of item, or nil if it has none
+	Key func(item RawDynamoItem) (RawDynamoItem, error)
+
+	ConsistentRead bool // Use strongly consistent reads
+	CacheSize      int  // Maximum number of related items cached across pages (optional), useful when many items share related items
+}
+
+// key returns the key of the related item of item, or nil if it has none
+func (e *Enrichment) key(item RawDynamoItem) (RawDynamoItem, error) {
+	if e.Key != nil {
+		return e.Key(item)
+	}
+	k := RawDynamoItem{}
+	for ka, ia := range e.KeyMap {
+		v, ok := item[ia]
+		if !ok {
+			return nil, nil
+		}
+		k[ka] = v
+	}
+	return k, nil
+}
+
+// EnrichedMigrationFunction is a migration callback which is passed the related item of each item (see Enrichment), or nil if it has
+// none or it doesn't exist
+type EnrichedMigrationFunction func(item, related RawDynamoItem, action *DrifterAction) error
+
+// EnrichedCallback returns a migration batch callback (see DynamoDrifterMigration.BatchCallback) which fetches the related items of each
+// page of the scan with BatchGetItem (retried and paced like other requests of the run) and calls f for each item of the page, instead
+// of callbacks getting related items one at a time. Errors of f for the items of a page are joined.
+func EnrichedCallback(e Enrichment, f EnrichedMigrationFunction) DynamoBatchMigrationFunction {
+	var cache *lru[RawDynamoItem]
+	if e.CacheSize > 0 {
+		cache = newLRU[RawDynamoItem](e.CacheSize)
+	}
+	return func(items []RawDynamoItem, da *DrifterAction) error {
+		if e.Table == "" || (e.KeyMap == nil && e.Key == nil) {
+			return fmt.Errorf("enrichment Table and KeyMap or Key are required")
+		}
+		keys := make([]string, len(items)) // key of the related item of each item ("" if none)
+		related := map[string]RawDynamoItem{}
+		missing := []RawDynamoItem{}
+		for i, item := range items {
+			k, err := e.key(item)
+			if err != nil {
+				return fmt.Errorf("error getting key of related item: %w", err)
+			}
+			if len(k) == 0 {
+				continue
+			}
+			keys[i] = keyString(k)
+			if _, ok := related[keys[i]]; ok {
+				continue
+			}
+			if cache != nil {
+				if ri, ok := cache.get(keys[i]); ok {
+					related[keys[i]] = ri
+					continue
+				}
+			}
+			related[keys[i]] = nil
+			missing = append(missing, k)
+		}
+		for i := 0; i < len(missing); i += batchGetLimit {
+			batch := missing[i:min(i+batchGetLimit, len(missing))]
+			found, err := da.batchGet(context.Background(), e.Table, batch, e.ConsistentRead)
+			if err != nil {
+				return fmt.Errorf("error getting related items: %w", err)
+			}
+			for _, ri := range found {
+				k := RawDynamoItem{}
+				for ka := range batch[0] {
+					k[ka] = ri[ka]
+				}
+				related[keyString(k)] = ri
+			}
+			if cache != nil {
+				for _, k := range batch {
+					cache.put(keyString(k), related[keyString(k)]) // missing related items are cached too
+				}
+			}
+		}
+		var errs []error
+		for i, item := range items {
+			var ri RawDynamoItem
+			if keys[i] != "" {
+				ri = related[keys[i]]
+			}
+			if err := f(item, ri, da); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// retrier returns the retrier of the run (or a default one outside of runs)
+func (da *DrifterAction) retrier() *retrier {
+	if da.retry == nil {
+		return newRetrier(nil)
+	}
+	return da.retry
+}
+
+// batchGet gets the items with keys (at most batchGetLimit) from table, retrying unprocessed keys as throttled requests
+func (da *DrifterAction) batchGet(ctx context.Context, table string, keys []RawDynamoItem, consistent bool) ([]RawDynamoItem, error) {
+	pending := make([]map[string]*dynamodb.AttributeValue, len(keys))
+	for i, k := range keys {
+		pending[i] = k
+	}
+	items := []RawDynamoItem{}
+	err := da.retrier().do(ctx, func() error {
+		if err := da.pace.wait(ctx, table, false); err != nil {
+			return err
+		}
+		req, out := da.dyn.BatchGetItemRequest(&dynamodb.BatchGetItemInput{
+			RequestItems: map[string]*dynamodb.KeysAndAttributes{
+				table: &dynamodb.KeysAndAttributes{Keys: pending, ConsistentRead: aws.Bool(consistent)},
+			},
+			ReturnConsumedCapacity: da.pace.returnConsumedCapacity(),
+		})
+		if err := da.sendRequest(ctx, req); err != nil {
+			return err
+		}
+		for _, cc := range out.ConsumedCapacity {
+			da.pace.consumed(cc, false)
+		}
+		for _, item := range out.Responses[table] {
+			items = append(items, item)
+		}
+		pending = nil
+		if ka := out.UnprocessedKeys[table]; ka != nil {
+			pending = ka.Keys
+		}
+		if len(pending) > 0 {
+			return awserr.New("ProvisionedThroughputExceededException", fmt.Sprintf("%v keys unprocessed", len(pending)), nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetItem reads the item with key (see Update) from tableName (optional, defaults to migration table), retried and paced like other
+// requests of the run. It returns nil if the item doesn't exist. See LookupCache to cache reads of reference items.
+func (da *DrifterAction) GetItem(key interface{}, tableName string) (RawDynamoItem, error) {
+	mkey, err := da.marshalKeys(key)
+	if err != nil {
+		return nil, err
+	}
+	if tableName == "" {
+		tableName = da.table
+	}
+	return da.getItem(context.Background(), tableName, mkey, false)
+}
+
+// getItem reads the item with key from table, or returns nil if it doesn't exist
+func (da *DrifterAction) getItem(ctx context.Context, table string, key map[string]*dynamodb.AttributeValue, consistent bool) (RawDynamoItem, error) {
+	var item RawDynamoItem
+	err := da.retrier().do(ctx, func() error {
+		if err := da.pace.wait(ctx, table, false); err != nil {
+			return err
+		}
+		req, out := da.dyn.GetItemRequest(&dynamodb.GetItemInput{
+			TableName:              aws.String(table),
+			Key:                    key,
+			ConsistentRead:         aws.Bool(consistent),
+			ReturnConsumedCapacity: da.pace.returnConsumedCapacity(),
+		})
+		err := da.sendRequest(ctx, req)
+		da.pace.consumed(out.ConsumedCapacity, false)
+		item = out.Item
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting item: %w", err)
+	}
+	if len(item) == 0 {
+		return nil, nil
+	}
+	return item, nil
+}
@@ -0,0 +1,45 @@
+package drift
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestEnrichmentKey(t *testing.T) {
+	e := &Enrichment{KeyMap: map[string]string{"TenantID": "Tenant"}}
+	k, err := e.key(RawDynamoItem{"Tenant": &dynamodb.AttributeValue{S: aws.String("t1")}})
+	if err != nil || len(k) != 1 || *k["TenantID"].S != "t1" {
+		t.Fatalf("bad key: %v, %v", k, err)
+	}
+	if k, err = e.key(RawDynamoItem{}); k != nil || err != nil {
+		t.Fatalf("items missing key attributes should have no related item: %v, %v", k, err)
+	}
+}
+
+func TestEnrichedCallback(t *testing.T) {
+	items := []RawDynamoItem{
+		RawDynamoItem{"Tenant": &dynamodb.AttributeValue{S: aws.String("t1")}},
+		RawDynamoItem{"Fail": &dynamodb.AttributeValue{BOOL: aws.Bool(true)}},
+	}
+	if err := EnrichedCallback(Enrichment{}, nil)(items, &DrifterAction{}); err == nil {
+		t.Fatalf("enrichment without Table should fail")
+	}
+	calls := 0
+	cb := EnrichedCallback(Enrichment{Table: "tenants", KeyMap: map[string]string{"TenantID": "Missing"}}, func(item, related RawDynamoItem, da *DrifterAction) error {
+		calls++
+		if related != nil {
+			t.Fatalf("items without related key should have no related item")
+		}
+		if item["Fail"] != nil {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	// no item has a related key, so DynamoDB isn't called
+	if err := cb(items, &DrifterAction{}); err == nil || err.Error() != "failed" || calls != 2 {
+		t.Fatalf("callback errors should be returned: %v, %v", err, calls)
+	}
+}
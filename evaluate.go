@@ -0,0 +1,463 @@
+package drift
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// pathElement is an element of a document path: an attribute name, or a list index if name is empty
+type pathElement struct {
+	name  string
+	index int
+}
+
+// updateEvaluator applies an update expression to a copy of an item locally, following DynamoDB semantics: operands are evaluated
+// against the item before the update. It supports the SET, REMOVE, ADD and DELETE clauses with nested paths, + and -, and the
+// if_not_exists and list_append functions.
+type updateEvaluator struct {
+	tokens []string
+	pos    int
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+	before RawDynamoItem
+	after  RawDynamoItem
+}
+
+// ApplyUpdate returns a copy of item with the update expression expr applied as DynamoDB would (see updateEvaluator), with expression
+// attribute names and values names and values. item may be nil, as for updates creating items.
+func ApplyUpdate(item RawDynamoItem, expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (RawDynamoItem, error) {
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	e := &updateEvaluator{tokens: tokens, names: names, values: values, before: item, after: item.Clone()}
+	if e.after == nil {
+		e.after = RawDynamoItem{}
+	}
+	for e.pos < len(e.tokens) {
+		clause := strings.ToUpper(e.next())
+		for {
+			var err error
+			switch clause {
+			case "SET":
+				err = e.set()
+			case "REMOVE":
+				err = e.remove()
+			case "ADD", "DELETE":
+				err = e.addOrDelete(clause == "ADD")
+			default:
+				return nil, fmt.Errorf("unexpected %q, expecting SET, REMOVE, ADD or DELETE", clause)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if e.peek() != "," {
+				break
+			}
+			e.next()
+		}
+	}
+	for k, v := range e.after {
+		e.after[k] = compactLists(v)
+	}
+	return e.after, nil
+}
+
+// tokenizeExpression splits an expression into names (including #names and :values), numbers and punctuation
+func tokenizeExpression(expr string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#' || c == ':' || isNameChar(c):
+			j := i + 1
+			for j < len(expr) && isNameChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		case strings.IndexByte("(),=+-[].", c) >= 0:
+			tokens = append(tokens, expr[i:i+1])
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %v", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+func (e *updateEvaluator) peek() string {
+	if e.pos < len(e.tokens) {
+		return e.tokens[e.pos]
+	}
+	return ""
+}
+
+func (e *updateEvaluator) next() string {
+	t := e.peek()
+	e.pos++
+	return t
+}
+
+func (e *updateEvaluator) expect(t string) error {
+	if got := e.next(); got != t {
+		return fmt.Errorf("unexpected %q, expecting %q", got, t)
+	}
+	return nil
+}
+
+// path parses a document path
+func (e *updateEvaluator) path() ([]pathElement, error) {
+	name, err := e.name(e.next())
+	if err != nil {
+		return nil, err
+	}
+	path := []pathElement{{name: name}}
+	for {
+		switch e.peek() {
+		case ".":
+			e.next()
+			name, err := e.name(e.next())
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElement{name: name})
+		case "[":
+			e.next()
+			i, err := strconv.Atoi(e.next())
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("bad list index in document path")
+			}
+			if err := e.expect("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, pathElement{index: i})
+		default:
+			return path, nil
+		}
+	}
+}
+
+// name resolves an attribute name token
+func (e *updateEvaluator) name(t string) (string, error) {
+	switch {
+	case strings.HasPrefix(t, "#"):
+		n, ok := e.names[t]
+		if !ok {
+			return "", fmt.Errorf("expression attribute name %v is not defined", t)
+		}
+		return aws.StringValue(n), nil
+	case t == "" || strings.HasPrefix(t, ":") || !isNameChar(t[0]):
+		return "", fmt.Errorf("unexpected %q, expecting an attribute name", t)
+	}
+	return t, nil
+}
+
+// operand evaluates a :value, a document path (nil if it doesn't exist) or a function call
+func (e *updateEvaluator) operand() (*dynamodb.AttributeValue, error) {
+	t := e.peek()
+	if strings.HasPrefix(t, ":") {
+		e.next()
+		v, ok := e.values[t]
+		if !ok {
+			return nil, fmt.Errorf("expression attribute value %v is not defined", t)
+		}
+		return v, nil
+	}
+	if e.pos+1 < len(e.tokens) && e.tokens[e.pos+1] == "(" {
+		e.pos += 2
+		var v *dynamodb.AttributeValue
+		switch t {
+		case "if_not_exists":
+			path, err := e.path()
+			if err != nil {
+				return nil, err
+			}
+			if err := e.expect(","); err != nil {
+				return nil, err
+			}
+			def, err := e.operand()
+			if err != nil {
+				return nil, err
+			}
+			if v = getPath(e.before, path); v == nil {
+				v = def
+			}
+		case "list_append":
+			a, err := e.operand()
+			if err != nil {
+				return nil, err
+			}
+			if err := e.expect(","); err != nil {
+				return nil, err
+			}
+			b, err := e.operand()
+			if err != nil {
+				return nil, err
+			}
+			if a == nil || b == nil || a.L == nil || b.L == nil {
+				return nil, fmt.Errorf("list_append operands must be lists")
+			}
+			v = &dynamodb.AttributeValue{L: append(append([]*dynamodb.AttributeValue{}, a.L...), b.L...)}
+		default:
+			return nil, fmt.Errorf("unsupported function %v", t)
+		}
+		return v, e.expect(")")
+	}
+	path, err := e.path()
+	if err != nil {
+		return nil, err
+	}
+	return getPath(e.before, path), nil
+}
+
+// set evaluates an action of a SET clause
+func (e *updateEvaluator) set() error {
+	path, err := e.path()
+	if err != nil {
+		return err
+	}
+	if err := e.expect("="); err != nil {
+		return err
+	}
+	v, err := e.operand()
+	if err != nil {
+		return err
+	}
+	if op := e.peek(); op == "+" || op == "-" {
+		e.next()
+		w, err := e.operand()
+		if err != nil {
+			return err
+		}
+		if v, err = addNumbers(v, w, op == "-"); err != nil {
+			return err
+		}
+	}
+	if v == nil {
+		return fmt.Errorf("the document path of an operand doesn't exist")
+	}
+	return setPath(e.after, path, CloneAttributeValue(v))
+}
+
+// remove evaluates an action of a REMOVE clause. Removed list elements are replaced by nil and compacted at the end, so list indexes
+// of other actions keep referring to the item before the update.
+func (e *updateEvaluator) remove() error {
+	path, err := e.path()
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	if len(path) == 1 {
+		delete(e.after, last.name)
+		return nil
+	}
+	parent := getPath(e.after, path[:len(path)-1])
+	switch {
+	case parent == nil:
+	case last.name != "" && parent.M != nil:
+		delete(parent.M, last.name)
+	case last.name == "" && parent.L != nil && last.index < len(parent.L):
+		parent.L[last.index] = nil
+	}
+	return nil
+}
+
+// addOrDelete evaluates an action of an ADD or DELETE clause
+func (e *updateEvaluator) addOrDelete(add bool) error {
+	path, err := e.path()
+	if err != nil {
+		return err
+	}
+	v, err := e.operand()
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("the document path of an operand doesn't exist")
+	}
+	cur := getPath(e.before, path)
+	switch {
+	case add && v.N != nil:
+		if cur != nil {
+			if v, err = addNumbers(cur, v, false); err != nil {
+				return err
+			}
+		}
+	case v.SS != nil || v.NS != nil || v.BS != nil:
+		if cur == nil {
+			if !add {
+				return nil
+			}
+		} else if v, err = combineSets(cur, v, add); err != nil {
+			return err
+		}
+		if v == nil {
+			return e.removePath(path)
+		}
+	default:
+		return fmt.Errorf("ADD and DELETE operands must be numbers or sets")
+	}
+	return setPath(e.after, path, v)
+}
+
+func (e *updateEvaluator) removePath(path []pathElement) error {
+	if len(path) == 1 {
+		delete(e.after, path[0].name)
+		return nil
+	}
+	if parent := getPath(e.after, path[:len(path)-1]); parent != nil && parent.M != nil {
+		delete(parent.M, path[len(path)-1].name)
+	}
+	return nil
+}
+
+// getPath returns the value at path in item, or nil if it doesn't exist
+func getPath(item RawDynamoItem, path []pathElement) *dynamodb.AttributeValue {
+	v := item[path[0].name]
+	for _, pe := range path[1:] {
+		switch {
+		case v == nil:
+			return nil
+		case pe.name != "":
+			v = v.M[pe.name]
+		case pe.index < len(v.L):
+			v = v.L[pe.index]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// setPath sets the value at path in item: the parent of the last element must exist, list elements past the end are appended
+func setPath(item RawDynamoItem, path []pathElement, v *dynamodb.AttributeValue) error {
+	if len(path) == 1 {
+		item[path[0].name] = v
+		return nil
+	}
+	parent := getPath(item, path[:len(path)-1])
+	last := path[len(path)-1]
+	switch {
+	case parent != nil && last.name != "" && parent.M != nil:
+		parent.M[last.name] = v
+	case parent != nil && last.name == "" && parent.L != nil:
+		if last.index < len(parent.L) {
+			parent.L[last.index] = v
+		} else {
+			parent.L = append(parent.L, v)
+		}
+	default:
+		return fmt.Errorf("the document path to update doesn't exist")
+	}
+	return nil
+}
+
+// compactLists removes the list elements removed by REMOVE actions (nil) from v
+func compactLists(v *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if v == nil {
+		return nil
+	}
+	if v.L != nil {
+		l := []*dynamodb.AttributeValue{}
+		for _, e := range v.L {
+			if e != nil {
+				l = append(l, compactLists(e))
+			}
+		}
+		v.L = l
+	}
+	for k, e := range v.M {
+		v.M[k] = compactLists(e)
+	}
+	return v
+}
+
+// addNumbers returns a + b (or a - b)
+func addNumbers(a, b *dynamodb.AttributeValue, subtract bool) (*dynamodb.AttributeValue, error) {
+	if a == nil || b == nil || a.N == nil || b.N == nil {
+		return nil, fmt.Errorf("arithmetic operands must be numbers")
+	}
+	x, ok := new(big.Rat).SetString(*a.N)
+	y, ok2 := new(big.Rat).SetString(*b.N)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("bad numbers %v, %v", *a.N, *b.N)
+	}
+	if subtract {
+		y.Neg(y)
+	}
+	return &dynamodb.AttributeValue{N: aws.String(formatRat(x.Add(x, y)))}, nil
+}
+
+// formatRat formats a decimal number exactly
+func formatRat(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	ten := big.NewInt(10)
+	p := big.NewInt(1)
+	for digits := 1; ; digits++ {
+		p.Mul(p, ten)
+		if new(big.Int).Mod(p, r.Denom()).Sign() == 0 {
+			return r.FloatString(digits)
+		}
+	}
+}
+
+// combineSets returns the union (or difference) of sets a and b, or nil if it is empty
+func combineSets(a, b *dynamodb.AttributeValue, union bool) (*dynamodb.AttributeValue, error) {
+	var as, bs []string
+	var typ string
+	switch {
+	case a.SS != nil && b.SS != nil:
+		as, bs, typ = aws.StringValueSlice(a.SS), aws.StringValueSlice(b.SS), "SS"
+	case a.NS != nil && b.NS != nil:
+		as, bs, typ = aws.StringValueSlice(a.NS), aws.StringValueSlice(b.NS), "NS"
+	case a.BS != nil && b.BS != nil:
+		for _, x := range a.BS {
+			as = append(as, string(x))
+		}
+		for _, x := range b.BS {
+			bs = append(bs, string(x))
+		}
+		typ = "BS"
+	default:
+		return nil, fmt.Errorf("mismatched set types")
+	}
+	set := map[string]bool{}
+	for _, x := range as {
+		set[x] = true
+	}
+	for _, x := range bs {
+		set[x] = union
+	}
+	elements := []string{}
+	for x, in := range set {
+		if in {
+			elements = append(elements, x)
+		}
+	}
+	if len(elements) == 0 {
+		return nil, nil
+	}
+	sort.Strings(elements)
+	switch typ {
+	case "SS":
+		return &dynamodb.AttributeValue{SS: aws.StringSlice(elements)}, nil
+	case "NS":
+		return &dynamodb.AttributeValue{NS: aws.StringSlice(elements)}, nil
+	}
+	v := &dynamodb.AttributeValue{}
+	for _, x := range elements {
+		v.BS = append(v.BS, []byte(x))
+	}
+	return v, nil
+}
@@ -0,0 +1,75 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestApplyUpdate(t *testing.T) {
+	n := func(s string) *dynamodb.AttributeValue { return &dynamodb.AttributeValue{N: aws.String(s)} }
+	s := func(s string) *dynamodb.AttributeValue { return &dynamodb.AttributeValue{S: aws.String(s)} }
+	item := RawDynamoItem{
+		"ID":    n("1"),
+		"Count": n("1.5"),
+		"Tags":  &dynamodb.AttributeValue{SS: aws.StringSlice([]string{"a", "b"})},
+		"Doc":   &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{"L": {L: []*dynamodb.AttributeValue{n("0"), n("1"), n("2")}}}},
+		"Old":   s("x"),
+	}
+	names := map[string]*string{"#c": aws.String("Count"), "#n": aws.String("Name")}
+	values := map[string]*dynamodb.AttributeValue{
+		":one":  n("1"),
+		":half": n("0.25"),
+		":name": s("new"),
+		":tags": {SS: aws.StringSlice([]string{"b", "c"})},
+		":a":    {SS: aws.StringSlice([]string{"a"})},
+		":l":    {L: []*dynamodb.AttributeValue{n("3")}},
+	}
+	tests := []struct {
+		expr  string
+		check func(after RawDynamoItem) bool
+	}{
+		{"SET #c = #c + :one", func(a RawDynamoItem) bool { return *a["Count"].N == "2.5" }},
+		{"SET #c = #c - :half, #n = :name", func(a RawDynamoItem) bool { return *a["Count"].N == "1.25" && *a["Name"].S == "new" }},
+		{"SET #n = if_not_exists(#n, :name), Old = if_not_exists(Old, :name)", func(a RawDynamoItem) bool { return *a["Name"].S == "new" && *a["Old"].S == "x" }},
+		{"SET Doc.L = list_append(Doc.L, :l)", func(a RawDynamoItem) bool { return len(a["Doc"].M["L"].L) == 4 }},
+		{"SET Doc.L[1] = :one", func(a RawDynamoItem) bool { return *a["Doc"].M["L"].L[1].N == "1" }},
+		{"REMOVE Old, Doc.L[0], Doc.L[2]", func(a RawDynamoItem) bool {
+			l := a["Doc"].M["L"].L
+			return a["Old"] == nil && len(l) == 1 && *l[0].N == "1"
+		}},
+		{"ADD Tags :tags, #c :one", func(a RawDynamoItem) bool { return len(a["Tags"].SS) == 3 && *a["Count"].N == "2.5" }},
+		{"ADD New :one", func(a RawDynamoItem) bool { return *a["New"].N == "1" }},
+		{"DELETE Tags :tags", func(a RawDynamoItem) bool { return len(a["Tags"].SS) == 1 && *a["Tags"].SS[0] == "a" }},
+		{"DELETE Tags :tags SET #n = :name", func(a RawDynamoItem) bool { return len(a["Tags"].SS) == 1 && a["Name"] != nil }},
+	}
+	for _, test := range tests {
+		after, err := ApplyUpdate(item, test.expr, names, values)
+		if err != nil {
+			t.Fatalf("error applying %q: %v", test.expr, err)
+		}
+		if !test.check(after) {
+			t.Fatalf("bad result of %q: %v", test.expr, formatItem(after))
+		}
+	}
+	if *item["Count"].N != "1.5" || len(item["Doc"].M["L"].L) != 3 || item["Old"] == nil {
+		t.Fatalf("item should not be modified: %v", formatItem(item))
+	}
+	after, err := ApplyUpdate(item, "DELETE Tags :a, Tags :tags", nil, values)
+	if err != nil || after["Tags"] == nil {
+		t.Fatalf("operands are evaluated against the item before the update: %v, %v", after, err)
+	}
+	after, err = ApplyUpdate(RawDynamoItem{"Tags": values[":a"]}, "DELETE Tags :a", nil, values)
+	if err != nil || len(after) != 0 {
+		t.Fatalf("empty sets should be removed: %v, %v", after, err)
+	}
+	if after, err := ApplyUpdate(nil, "SET #n = :name", names, values); err != nil || *after["Name"].S != "new" {
+		t.Fatalf("updates should create items: %v, %v", after, err)
+	}
+	for _, expr := range []string{"SET #x = :one", "SET Count = :x", "SET a = size(Tags)", "SET Missing.A = :one", "ADD Old :one", "SET a = Old + :one", "FOO a"} {
+		if _, err := ApplyUpdate(item, expr, names, values); err == nil {
+			t.Fatalf("%q should fail", expr)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package drift
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// updateClauses are the clauses of update expressions
+var updateClauses = map[string]bool{"SET": true, "REMOVE": true, "ADD": true, "DELETE": true}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// validateUpdateExpression checks the syntax of an update expression: it must be made of SET, REMOVE, ADD or DELETE clauses (each at most
+// once and not empty) with balanced parentheses, and #names and :values must be defined in names and values. It doesn't check the
+// grammar of clauses, which is left to DynamoDB.
+func validateUpdateExpression(expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) error {
+	clause := ""  // current clause
+	empty := true // current clause has no operand yet
+	seen := map[string]bool{}
+	depth := 0
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(expr) && isNameChar(expr[j]) {
+				j++
+			}
+			if j == i+1 {
+				return fmt.Errorf("%q at offset %v is not followed by a placeholder name", c, i)
+			}
+			p := expr[i:j]
+			if c == '#' {
+				if _, ok := names[p]; !ok {
+					return fmt.Errorf("expression attribute name %v is not defined", p)
+				}
+			} else if _, ok := values[p]; !ok {
+				return fmt.Errorf("expression attribute value %v is not defined", p)
+			}
+			if clause == "" {
+				return fmt.Errorf("expression must start with SET, REMOVE, ADD or DELETE")
+			}
+			empty = false
+			i = j
+		case isNameChar(c):
+			j := i + 1
+			for j < len(expr) && isNameChar(expr[j]) {
+				j++
+			}
+			word := strings.ToUpper(expr[i:j])
+			if depth == 0 && updateClauses[word] {
+				if clause != "" && empty {
+					return fmt.Errorf("empty %v clause", clause)
+				}
+				if seen[word] {
+					return fmt.Errorf("duplicate %v clause", word)
+				}
+				seen[word] = true
+				clause = word
+				empty = true
+			} else {
+				if clause == "" {
+					return fmt.Errorf("expression must start with SET, REMOVE, ADD or DELETE")
+				}
+				empty = false
+			}
+			i = j
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("unbalanced ')' at offset %v", i)
+			}
+			i++
+		case strings.IndexByte(" \t\r\n,=+-[].", c) >= 0:
+			i++
+		default:
+			return fmt.Errorf("unexpected character %q at offset %v", c, i)
+		}
+	}
+	switch {
+	case depth != 0:
+		return fmt.Errorf("unbalanced '('")
+	case clause == "":
+		return fmt.Errorf("expression must start with SET, REMOVE, ADD or DELETE")
+	case empty:
+		return fmt.Errorf("empty %v clause", clause)
+	}
+	return nil
+}
+
+// expressionNames are the expression attribute names (placeholders to attribute names) of an expression
+type expressionNames map[string]*string
+
+// newExpressionNames copies names passed by users, or returns nil if there are none
+func newExpressionNames(names map[string]string) (expressionNames, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	en := make(expressionNames, len(names))
+	for p, name := range names {
+		if len(p) < 2 || p[0] != '#' {
+			return nil, fmt.Errorf("bad expression attribute name placeholder %q: must start with #", p)
+		}
+		en[p] = aws.String(name)
+	}
+	return en, nil
+}
+
+// add returns a placeholder for attribute name: p if it is free or already names name, otherwise p followed by the first number
+// making it unique, so generated placeholders never collide with those passed by users
+func (en expressionNames) add(p, name string) string {
+	c := p
+	for i := 2; ; i++ {
+		n, ok := en[c]
+		if !ok {
+			en[c] = aws.String(name)
+			return c
+		}
+		if aws.StringValue(n) == name {
+			return c
+		}
+		c = p + strconv.Itoa(i)
+	}
+}
+
+// placeholder returns a placeholder for attribute name, reusing one already defined for it or generating one from the name
+func (en expressionNames) placeholder(name string) string {
+	existing := []string{}
+	for p, n := range en {
+		if aws.StringValue(n) == name {
+			existing = append(existing, p)
+		}
+	}
+	if len(existing) > 0 {
+		sort.Strings(existing)
+		return existing[0]
+	}
+	p := "#"
+	for i := 0; i < len(name); i++ {
+		if isNameChar(name[i]) {
+			p += name[i : i+1]
+		}
+	}
+	if p == "#" {
+		p = "#attr"
+	}
+	return en.add(p, name)
+}
+
+// uniqueValue returns p, or p followed by the first number making it unique if it is already a placeholder of values
+func uniqueValue(values map[string]*dynamodb.AttributeValue, p string) string {
+	c := p
+	for i := 2; values[c] != nil; i++ {
+		c = p + strconv.Itoa(i)
+	}
+	return c
+}
+
+var setClause = regexp.MustCompile(`(?i)\bSET\s`)
+
+// addSetClause adds setting attribute attr to av to an update expression, returning the new expression and (copied) attribute values and
+// names. The placeholders name and value are renamed if they collide with those of the expression.
+func addSetClause(expr string, values map[string]*dynamodb.AttributeValue, names map[string]*string, name, value, attr string, av *dynamodb.AttributeValue) (string, map[string]*dynamodb.AttributeValue, map[string]*string) {
+	nnames := make(expressionNames, len(names)+1)
+	for k, n := range names {
+		nnames[k] = n
+	}
+	vp := uniqueValue(values, value)
+	set := fmt.Sprintf("%v = %v", nnames.add(name, attr), vp)
+	if loc := setClause.FindStringIndex(expr); loc != nil {
+		expr = expr[:loc[1]] + set + ", " + expr[loc[1]:]
+	} else {
+		expr = "SET " + set + " " + expr
+	}
+	nvalues := make(map[string]*dynamodb.AttributeValue, len(values)+1)
+	for k, v := range values {
+		nvalues[k] = v
+	}
+	nvalues[vp] = av
+	return expr, nvalues, nnames
+}
+
+// withAttribute returns a copy of item with attribute attr set to av (the attribute values are shared with item)
+func withAttribute(item map[string]*dynamodb.AttributeValue, attr string, av *dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	out := make(map[string]*dynamodb.AttributeValue, len(item)+1)
+	for k, v := range item {
+		out[k] = v
+	}
+	out[attr] = av
+	return out
+}
@@ -0,0 +1,140 @@
+package drift
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestValidateUpdateExpression(t *testing.T) {
+	names := map[string]*string{"#n": aws.String("Name")}
+	values := map[string]*dynamodb.AttributeValue{
+		":n": &dynamodb.AttributeValue{S: aws.String("a")},
+		":l": &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}},
+	}
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{"SET #n = :n", ""},
+		{"set #n = if_not_exists(#n, :n), List[0] = list_append(List, :l) remove Old.Field ADD Count :n DELETE Tags :n", ""},
+		{"REMOVE a, b", ""},
+		{"", "must start with"},
+		{"#n = :n", "must start with"},
+		{"Name = :n", "must start with"},
+		{"SET #x = :n", "#x is not defined"},
+		{"SET #n = :x", ":x is not defined"},
+		{"SET #n = : n", "not followed by a placeholder name"},
+		{"SET #n = list_append(#n, :l", "unbalanced '('"},
+		{"SET #n = :n)", "unbalanced ')'"},
+		{"SET REMOVE a", "empty SET clause"},
+		{"SET #n = :n REMOVE", "empty REMOVE clause"},
+		{"SET a = :n SET b = :n", "duplicate SET clause"},
+		{"SET a = :n; REMOVE b", "unexpected character"},
+	}
+	for _, c := range cases {
+		err := validateUpdateExpression(c.expr, names, values)
+		if c.err == "" && err != nil {
+			t.Fatalf("%q: unexpected error: %v", c.expr, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Fatalf("%q: expected error containing %q: %v", c.expr, c.err, err)
+		}
+	}
+	da := &DrifterAction{}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	if err := da.Update(keys, RawDynamoItem{":v": values[":n"]}, "SET #n = :v", nil, ""); err == nil || !strings.Contains(err.Error(), "#n is not defined") {
+		t.Fatalf("Update should validate the expression: %v", err)
+	}
+	if len(da.aq.actions()) != 0 {
+		t.Fatalf("invalid update should not be queued")
+	}
+}
+
+func TestUpdateValuesMap(t *testing.T) {
+	da := &DrifterAction{}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	values := map[string]interface{}{":n": "a", ":c": 2, ":t": []string{"x"}}
+	if err := da.Update(keys, values, "SET #n = :n, Tags = :t ADD #c :c", map[string]string{"#n": "Name", "#c": "Count"}, ""); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	a := da.aq.actions()[0]
+	if *a.values[":n"].S != "a" || *a.values[":c"].N != "2" || len(a.values[":t"].L) != 1 {
+		t.Fatalf("bad values: %v", a.values)
+	}
+}
+
+func TestExpressionNames(t *testing.T) {
+	en, err := newExpressionNames(map[string]string{"#Name": "FullName", "#t": "Tags"})
+	if err != nil {
+		t.Fatalf("error copying names: %v", err)
+	}
+	if p := en.placeholder("Name"); p != "#Name2" || *en[p] != "Name" {
+		t.Fatalf("placeholder should not collide with user names: %v", p)
+	}
+	if p := en.placeholder("Tags"); p != "#t" {
+		t.Fatalf("placeholder should reuse user names: %v", p)
+	}
+	if p := en.placeholder("first-name"); p != "#firstname" {
+		t.Fatalf("bad generated placeholder: %v", p)
+	}
+	if p := en.placeholder("é"); p != "#attr" {
+		t.Fatalf("bad generated placeholder: %v", p)
+	}
+	if *en["#Name"] != "FullName" {
+		t.Fatalf("user names should not be modified: %v", *en["#Name"])
+	}
+	if en, err := newExpressionNames(nil); en != nil || err != nil {
+		t.Fatalf("no names should be nil: %v, %v", en, err)
+	}
+	if _, err := newExpressionNames(map[string]string{"Name": "Name"}); err == nil {
+		t.Fatalf("placeholder without # should fail")
+	}
+	if p := uniqueValue(map[string]*dynamodb.AttributeValue{":v": &dynamodb.AttributeValue{}, ":v2": &dynamodb.AttributeValue{}}, ":v"); p != ":v3" {
+		t.Fatalf("bad unique value: %v", p)
+	}
+}
+
+func TestVersioningBumpCollision(t *testing.T) {
+	da := &DrifterAction{version: &Versioning{Version: 2}, table: "users"}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	values := RawDynamoItem{":drift_v": &dynamodb.AttributeValue{S: aws.String("a")}}
+	if err := da.Update(keys, values, "SET #drift_v = :drift_v", map[string]string{"#drift_v": "Name"}, ""); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	a := da.aq.actions()[0]
+	if a.updExpr != "SET #drift_v2 = :drift_v2, #drift_v = :drift_v" || *a.expAttrNames["#drift_v"] != "Name" || *a.expAttrNames["#drift_v2"] != VersionAttribute ||
+		*a.values[":drift_v"].S != "a" || *a.values[":drift_v2"].N != "2" {
+		t.Fatalf("bad update: %v %v %v", a.updExpr, a.expAttrNames, a.values)
+	}
+}
+
+func TestEscapeReserved(t *testing.T) {
+	if !IsReservedWord("name") || IsReservedWord("FirstName") {
+		t.Fatalf("bad reserved words")
+	}
+	expr, names := escapeReserved("SET Name = if_not_exists(Name, :n), Data.Status = size(Tags) REMOVE FirstName, Items[0]", nil)
+	if expr != "SET #Name = if_not_exists(#Name, :n), #Data.#Status = size(Tags) REMOVE FirstName, #Items[0]" {
+		t.Fatalf("bad expression: %v", expr)
+	}
+	if len(names) != 4 || *names["#Name"] != "Name" || *names["#Status"] != "Status" {
+		t.Fatalf("bad names: %v", names)
+	}
+	expr, names = escapeReserved("SET Comment = :c", expressionNames{"#Comment": aws.String("Other")})
+	if expr != "SET #Comment2 = :c" || *names["#Comment2"] != "Comment" {
+		t.Fatalf("generated names should not collide: %v %v", expr, names)
+	}
+	if expr, names := escapeReserved("SET #n = :n", nil); expr != "SET #n = :n" || names != nil {
+		t.Fatalf("expression without reserved words should be unchanged: %v %v", expr, names)
+	}
+	da := &DrifterAction{}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	if err := da.Update(keys, map[string]interface{}{":n": "a"}, "SET Name = :n", nil, ""); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	if a := da.aq.actions()[0]; a.updExpr != "SET #Name = :n" || *a.expAttrNames["#Name"] != "Name" {
+		t.Fatalf("reserved words should be escaped: %v %v", a.updExpr, a.expAttrNames)
+	}
+}
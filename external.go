@@ -0,0 +1,139 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Enricher fetches data about key from an external system (ex: an HTTP API or another AWS service), see ExternalLookup
+type Enricher interface {
+	Enrich(ctx context.Context, key string) (interface{}, error)
+}
+
+// EnricherFunc is a function implementing Enricher
+type EnricherFunc func(ctx context.Context, key string) (interface{}, error)
+
+// Enrich calls f
+func (f EnricherFunc) Enrich(ctx context.Context, key string) (interface{}, error) {
+	return f(ctx, key)
+}
+
+// ExternalLookup wraps an Enricher with rate limiting, a concurrency cap, retries and caching, so callbacks can call external systems
+// without overloading them. It is safe for concurrent use, and should be created once for a migration (outside of its callback) so its
+// limits apply to all callbacks. Concurrent lookups of the same key share a single call.
+type ExternalLookup struct {
+	Enricher    Enricher
+	Rate        float64       // Maximum calls per second (optional, defaults to no limit)
+	Concurrency uint          // Maximum concurrent calls (optional, defaults to no limit)
+	Retries     uint          // Retries of failed calls (optional), after DefaultBackoff delays
+	CacheSize   int           // Maximum number of results cached (optional, errors are not cached)
+	Timeout     time.Duration // Timeout of each call (optional)
+
+	once     sync.Once
+	bucket   *tokenBucket
+	sem      chan struct{}
+	cache    *lru[interface{}]
+	mtx      sync.Mutex
+	inflight map[string]*lookupCall
+}
+
+// lookupCall is a call in progress, shared by concurrent lookups of the same key
+type lookupCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func (el *ExternalLookup) init() {
+	if el.Rate > 0 {
+		el.bucket = newTokenBucket(el.Rate)
+	}
+	if el.Concurrency > 0 {
+		el.sem = make(chan struct{}, el.Concurrency)
+	}
+	if el.CacheSize > 0 {
+		el.cache = newLRU[interface{}](el.CacheSize)
+	}
+	el.inflight = map[string]*lookupCall{}
+}
+
+// Get returns the data about key, from the cache or by calling the Enricher
+func (el *ExternalLookup) Get(ctx context.Context, key string) (interface{}, error) {
+	if el.Enricher == nil {
+		return nil, fmt.Errorf("Enricher is required")
+	}
+	el.once.Do(el.init)
+	el.mtx.Lock()
+	if el.cache != nil {
+		if v, ok := el.cache.get(key); ok {
+			el.mtx.Unlock()
+			return v, nil
+		}
+	}
+	if c, ok := el.inflight[key]; ok {
+		el.mtx.Unlock()
+		select {
+		case <-c.done:
+			return c.value, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &lookupCall{done: make(chan struct{})}
+	el.inflight[key] = c
+	el.mtx.Unlock()
+	c.value, c.err = el.call(ctx, key)
+	el.mtx.Lock()
+	if c.err == nil && el.cache != nil {
+		el.cache.put(key, c.value)
+	}
+	delete(el.inflight, key)
+	el.mtx.Unlock()
+	close(c.done)
+	return c.value, c.err
+}
+
+// call calls the Enricher within the limits, retrying failures
+func (el *ExternalLookup) call(ctx context.Context, key string) (interface{}, error) {
+	var attempt uint
+	for {
+		v, err := el.callOnce(ctx, key)
+		if err == nil || attempt >= el.Retries || ctx.Err() != nil {
+			if err != nil {
+				return nil, fmt.Errorf("error enriching %v: %w", key, err)
+			}
+			return v, nil
+		}
+		attempt++
+		select {
+		case <-time.After(DefaultBackoff.Delay(attempt)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (el *ExternalLookup) callOnce(ctx context.Context, key string) (interface{}, error) {
+	if el.sem != nil {
+		select {
+		case el.sem <- struct{}{}:
+			defer func() { <-el.sem }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if el.bucket != nil {
+		if err := el.bucket.wait(ctx); err != nil {
+			return nil, err
+		}
+		el.bucket.take(1)
+	}
+	if el.Timeout > 0 {
+		var cncl context.CancelFunc
+		ctx, cncl = context.WithTimeout(ctx, el.Timeout)
+		defer cncl()
+	}
+	return el.Enricher.Enrich(ctx, key)
+}
@@ -0,0 +1,90 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExternalLookup(t *testing.T) {
+	var calls, running, maxRunning int32
+	el := &ExternalLookup{
+		Enricher: EnricherFunc(func(ctx context.Context, key string) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return "data-" + key, nil
+		}),
+		Concurrency: 2,
+		CacheSize:   10,
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := string(rune('a' + i%5))
+			if v, err := el.Get(context.Background(), key); err != nil || v != "data-"+key {
+				t.Errorf("bad lookup: %v, %v", v, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if calls != 5 {
+		t.Fatalf("each key should be fetched once: %v", calls)
+	}
+	if maxRunning > 2 {
+		t.Fatalf("concurrency should be capped: %v", maxRunning)
+	}
+}
+
+func TestExternalLookupRetries(t *testing.T) {
+	calls := 0
+	el := &ExternalLookup{
+		Enricher: EnricherFunc(func(ctx context.Context, key string) (interface{}, error) {
+			calls++
+			if calls < 2 {
+				return nil, errors.New("unavailable")
+			}
+			return 1, nil
+		}),
+		Retries: 1,
+	}
+	if v, err := el.Get(context.Background(), "k"); err != nil || v != 1 {
+		t.Fatalf("failure should be retried: %v, %v", v, err)
+	}
+	el = &ExternalLookup{Enricher: EnricherFunc(func(ctx context.Context, key string) (interface{}, error) {
+		return nil, errors.New("unavailable")
+	})}
+	if _, err := el.Get(context.Background(), "k"); err == nil {
+		t.Fatalf("error should be returned")
+	}
+	if _, err := (&ExternalLookup{}).Get(context.Background(), "k"); err == nil {
+		t.Fatalf("lookup without Enricher should fail")
+	}
+}
+
+func TestExternalLookupRate(t *testing.T) {
+	el := &ExternalLookup{
+		Enricher: EnricherFunc(func(ctx context.Context, key string) (interface{}, error) { return nil, nil }),
+		Rate:     20,
+	}
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		el.Get(context.Background(), string(rune('a'+i)))
+	}
+	// the bucket starts with one second worth of calls
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("calls should be rate limited: %v", d)
+	}
+}
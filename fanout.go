@@ -0,0 +1,280 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// ReportKindFanOut is the kind of JSON FanOutReports, see ReportVersion
+const ReportKindFanOut = "fanout"
+
+// FanOutTarget is a table a FanOut runs migrations against
+type FanOutTarget struct {
+	Name          string `json:"name"`                    // Identifies the target in reports (optional, defaults to "<region>/<table>")
+	RoleARN       string `json:"role_arn,omitempty"`      // IAM role assumed to access the account of the table (optional)
+	Region        string `json:"region,omitempty"`        // Region of the table (optional, defaults to the region of FanOut.Session)
+	TableName     string `json:"tablename"`               // Table the migration runs against, instead of its TableName
+	MetaTableName string `json:"metatablename,omitempty"` // Meta table of the target (optional, defaults to the drifter's)
+}
+
+// String returns the name of the target
+func (t FanOutTarget) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	if t.Region != "" {
+		return t.Region + "/" + t.TableName
+	}
+	return t.TableName
+}
+
+// FanOut runs the same migration against many tables with the same shape, which may live in other accounts (by assuming a role) and
+// regions, for platform teams owning a table in many accounts. Each target is run by a copy of Drifter with its own DynamoDB client and
+// meta table, so targets are tracked (and can be undone) independently. With Drifter.Locking, concurrent targets sharing a meta table
+// contend for its lock like runs of different processes.
+type FanOut struct {
+	Drifter *DynamoDrifter   // Settings of the runs, and DynamoDB client of targets without RoleARN and Region
+	Session *session.Session // Session of the clients of targets with RoleARN or Region (required if any target sets them)
+	Targets []FanOutTarget
+
+	Parallelism   uint // Targets run concurrently (optional, defaults to 1: targets run sequentially in order)
+	StopOnFailure bool // Skip the targets not started yet once a target fails
+}
+
+// FanOutResult is the result of a run against a target
+type FanOutResult struct {
+	Target   FanOutTarget `json:"target"`
+	Skipped  bool         `json:"skipped"` // Not run because another target failed (see StopOnFailure) or the context was done
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Errors   []error      `json:"-"`
+	Report   *RunReport   `json:"report,omitempty"` // Report of the run
+}
+
+// Succeeded returns whether the target was run without errors
+func (fr *FanOutResult) Succeeded() bool {
+	return !fr.Skipped && len(fr.Errors) == 0
+}
+
+// MarshalJSON implements json.Marshaler, see ReportVersion
+func (fr FanOutResult) MarshalJSON() ([]byte, error) {
+	type result FanOutResult // without methods
+	return json.Marshal(struct {
+		result
+		Succeeded bool     `json:"succeeded"`
+		Errors    []string `json:"errors"`
+	}{result(fr), fr.Succeeded(), errorStrings(fr.Errors)})
+}
+
+// FanOutReport aggregates the results of a FanOut run, in the order of its targets. Reports are encoded in JSON as documented by
+// ReportVersion.
+type FanOutReport struct {
+	Number   uint           `json:"number"`
+	Undo     bool           `json:"undo"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Results  []FanOutResult `json:"results"`
+}
+
+// Succeeded returns whether all targets were run without errors
+func (fr *FanOutReport) Succeeded() bool {
+	return len(fr.Failed()) == 0
+}
+
+// Failed returns the results of the targets which failed or were skipped
+func (fr *FanOutReport) Failed() []FanOutResult {
+	out := []FanOutResult{}
+	for _, r := range fr.Results {
+		if !r.Succeeded() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// String summarizes the report, one target per line
+func (fr *FanOutReport) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "migration %v on %v targets: %v failed\n", fr.Number, len(fr.Results), len(fr.Failed()))
+	for _, r := range fr.Results {
+		switch {
+		case r.Skipped:
+			fmt.Fprintf(b, "  %v: skipped\n", r.Target)
+		case len(r.Errors) != 0:
+			fmt.Fprintf(b, "  %v: %v errors (first: %v)\n", r.Target, len(r.Errors), r.Errors[0])
+		default:
+			fmt.Fprintf(b, "  %v: ok in %v\n", r.Target, r.Finished.Sub(r.Started).Round(time.Millisecond))
+		}
+	}
+	return b.String()
+}
+
+// MarshalJSON implements json.Marshaler, see ReportVersion
+func (fr *FanOutReport) MarshalJSON() ([]byte, error) {
+	type report FanOutReport // without methods
+	return json.Marshal(struct {
+		Version int    `json:"version"`
+		Kind    string `json:"kind"`
+		*report
+		Succeeded bool    `json:"succeeded"`
+		Duration  float64 `json:"duration_seconds"`
+	}{ReportVersion, ReportKindFanOut, (*report)(fr), fr.Succeeded(), fr.Finished.Sub(fr.Started).Seconds()})
+}
+
+// Run runs migration against all targets (see DynamoDrifter.Run) and returns the results. The error is only set if the fan-out couldn't
+// start, errors of targets are in their results.
+func (fo *FanOut) Run(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool) (*FanOutReport, error) {
+	return fo.fanOut(ctx, migration, false, func(dd *DynamoDrifter, m *DynamoDrifterMigration) []error {
+		return dd.Run(ctx, m, concurrency, failOnFirstError, nil)
+	})
+}
+
+// Undo runs undoMigration against all targets (see DynamoDrifter.Undo) and returns the results. The error is only set if the fan-out
+// couldn't start, errors of targets are in their results.
+func (fo *FanOut) Undo(ctx context.Context, undoMigration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool) (*FanOutReport, error) {
+	return fo.fanOut(ctx, undoMigration, true, func(dd *DynamoDrifter, m *DynamoDrifterMigration) []error {
+		return dd.Undo(ctx, m, concurrency, failOnFirstError, nil)
+	})
+}
+
+func (fo *FanOut) fanOut(ctx context.Context, migration *DynamoDrifterMigration, undo bool, run func(*DynamoDrifter, *DynamoDrifterMigration) []error) (*FanOutReport, error) {
+	if fo.Drifter == nil {
+		return nil, fmt.Errorf("drifter is required")
+	}
+	if err := validateMigration(migration); err != nil {
+		return nil, err
+	}
+	if len(fo.Targets) == 0 {
+		return nil, fmt.Errorf("at least one target is required")
+	}
+	drifters := make([]*DynamoDrifter, len(fo.Targets))
+	sinks := make([]*captureReportSink, len(fo.Targets))
+	for i, t := range fo.Targets {
+		if t.TableName == "" {
+			return nil, fmt.Errorf("target %v: table name is required", i)
+		}
+		db, err := fo.client(t)
+		if err != nil {
+			return nil, fmt.Errorf("target %v: %v", t, err)
+		}
+		sinks[i] = &captureReportSink{}
+		drifters[i] = fo.Drifter.forTarget(db, t.MetaTableName, sinks[i])
+	}
+	fr := &FanOutReport{Number: migration.Number, Undo: undo, Started: time.Now().UTC(), Results: make([]FanOutResult, len(fo.Targets))}
+	parallelism := max(fo.Parallelism, 1)
+	sem := make(chan struct{}, parallelism)
+	var failed bool
+	var mtx sync.Mutex
+	wg := sync.WaitGroup{}
+	for i, t := range fo.Targets {
+		fr.Results[i].Target = t
+		sem <- struct{}{}
+		mtx.Lock()
+		skip := failed && fo.StopOnFailure || ctx.Err() != nil
+		mtx.Unlock()
+		if skip {
+			fr.Results[i].Skipped = true
+			<-sem
+			continue
+		}
+		wg.Add(1)
+		go func(i int, t FanOutTarget) {
+			defer func() { <-sem; wg.Done() }()
+			m := *migration
+			m.TableName = t.TableName
+			res := &fr.Results[i]
+			res.Started = time.Now().UTC()
+			res.Errors = run(drifters[i], &m)
+			res.Finished = time.Now().UTC()
+			res.Report = sinks[i].rr
+			if len(res.Errors) != 0 {
+				mtx.Lock()
+				failed = true
+				mtx.Unlock()
+			}
+		}(i, t)
+	}
+	wg.Wait()
+	fr.Finished = time.Now().UTC()
+	return fr, nil
+}
+
+// client returns the DynamoDB client of target t
+func (fo *FanOut) client(t FanOutTarget) (dynamodbiface.DynamoDBAPI, error) {
+	if t.RoleARN == "" && t.Region == "" {
+		if err := checkClient(fo.Drifter.DynamoDB); err != nil {
+			return nil, err
+		}
+		return fo.Drifter.DynamoDB, nil
+	}
+	if fo.Session == nil {
+		return nil, fmt.Errorf("session is required for targets with a role or region")
+	}
+	cfg := aws.NewConfig()
+	if t.Region != "" {
+		cfg = cfg.WithRegion(t.Region)
+	}
+	if t.RoleARN != "" {
+		cfg = cfg.WithCredentials(stscreds.NewCredentials(fo.Session, t.RoleARN))
+	}
+	return dynamodb.New(fo.Session, cfg), nil
+}
+
+// forTarget returns a copy of the settings of dd with client db and meta table metaTable (if set), which also writes run reports to capture
+func (dd *DynamoDrifter) forTarget(db dynamodbiface.DynamoDBAPI, metaTable string, capture ReportSink) *DynamoDrifter {
+	if metaTable == "" {
+		metaTable = dd.MetaTableName
+	}
+	return &DynamoDrifter{
+		MetaTableName:     metaTable,
+		DynamoDB:          db,
+		RetryPolicy:       dd.RetryPolicy,
+		Retryer:           dd.Retryer,
+		RequestOptions:    dd.RequestOptions,
+		Pacing:            dd.Pacing,
+		Profiling:         dd.Profiling,
+		HeartbeatInterval: dd.HeartbeatInterval,
+		Owner:             dd.Owner,
+		SnapshotInterval:  dd.SnapshotInterval,
+		SavepointInterval: dd.SavepointInterval,
+		ProgressFunc:      dd.ProgressFunc,
+		ProgressInterval:  dd.ProgressInterval,
+		ProgressTable:     dd.ProgressTable,
+		Notifiers:         dd.Notifiers,
+		ReportSinks:       append(append([]ReportSink{}, dd.ReportSinks...), capture),
+		Outcomes:          dd.Outcomes,
+		AutoCleanup:       dd.AutoCleanup,
+		Logger:            dd.Logger,
+		Verbosity:         dd.Verbosity,
+		SafeMode:          dd.SafeMode,
+		Guardrails:        dd.Guardrails,
+		Models:            dd.Models,
+		Retention:         dd.Retention,
+		Rollback:          dd.Rollback,
+		Locking:           dd.Locking,
+		ForceUndo:         dd.ForceUndo,
+		ArchiveTable:      dd.ArchiveTable,
+		ArchiveS3:         dd.ArchiveS3,
+	}
+}
+
+// captureReportSink keeps the report of a run
+type captureReportSink struct {
+	rr *RunReport
+}
+
+// WriteReport implements ReportSink
+func (cs *captureReportSink) WriteReport(ctx context.Context, rr *RunReport) error {
+	cs.rr = rr
+	return nil
+}
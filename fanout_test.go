@@ -0,0 +1,73 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFanOutReport(t *testing.T) {
+	started := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fr := &FanOutReport{
+		Number:   3,
+		Started:  started,
+		Finished: started.Add(2 * time.Second),
+		Results: []FanOutResult{
+			{Target: FanOutTarget{Region: "us-east-1", TableName: "users"}, Started: started, Finished: started.Add(time.Second)},
+			{Target: FanOutTarget{Name: "prod", TableName: "users"}, Errors: []error{errors.New("boom")}},
+			{Target: FanOutTarget{TableName: "users"}, Skipped: true},
+		},
+	}
+	if fr.Succeeded() || len(fr.Failed()) != 2 {
+		t.Fatalf("bad failed results: %+v", fr.Failed())
+	}
+	expected := "migration 3 on 3 targets: 2 failed\n  us-east-1/users: ok in 1s\n  prod: 1 errors (first: boom)\n  users: skipped\n"
+	if s := fr.String(); s != expected {
+		t.Fatalf("bad summary: %q", s)
+	}
+	b, err := json.Marshal(fr)
+	if err != nil {
+		t.Fatalf("error marshaling report: %v", err)
+	}
+	var decoded struct {
+		Version   int     `json:"version"`
+		Kind      string  `json:"kind"`
+		Succeeded bool    `json:"succeeded"`
+		Duration  float64 `json:"duration_seconds"`
+		Results   []struct {
+			Target    FanOutTarget `json:"target"`
+			Succeeded bool         `json:"succeeded"`
+			Errors    []string     `json:"errors"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("error unmarshaling report: %v", err)
+	}
+	if decoded.Version != ReportVersion || decoded.Kind != ReportKindFanOut || decoded.Succeeded || decoded.Duration != 2 || len(decoded.Results) != 3 {
+		t.Fatalf("bad report JSON: %s", b)
+	}
+	if !decoded.Results[0].Succeeded || decoded.Results[1].Errors[0] != "boom" || decoded.Results[1].Target.Name != "prod" {
+		t.Fatalf("bad results JSON: %s", b)
+	}
+}
+
+func TestFanOutValidation(t *testing.T) {
+	m := &DynamoDrifterMigration{Number: 1, TableName: "users", Callback: testMigrateUp}
+	for _, c := range []struct {
+		fo  *FanOut
+		err string
+	}{
+		{&FanOut{Targets: []FanOutTarget{{TableName: "users"}}}, "drifter is required"},
+		{&FanOut{Drifter: &DynamoDrifter{}}, "at least one target is required"},
+		{&FanOut{Drifter: &DynamoDrifter{}, Targets: []FanOutTarget{{}}}, "table name is required"},
+		{&FanOut{Drifter: &DynamoDrifter{}, Targets: []FanOutTarget{{TableName: "users"}}}, "DynamoDB client is required"},
+		{&FanOut{Drifter: &DynamoDrifter{}, Targets: []FanOutTarget{{TableName: "users", Region: "eu-west-1"}}}, "session is required"},
+	} {
+		if _, err := c.fo.Run(context.Background(), m, 1, false); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("expected error %q: %v", c.err, err)
+		}
+	}
+}
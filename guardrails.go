@@ -0,0 +1,122 @@
+package drift
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrGuardrailExceeded is returned (wrapped) when the actions queued by a migration exceed its guardrails, see Guardrails
+var ErrGuardrailExceeded = errors.New("guardrail exceeded")
+
+// Guardrails cap the blast radius of a migration, to stop runaway migrations (ex: caused by a bad filter). They are evaluated once the
+// table has been scanned and all actions queued, before any action is executed, and the run is aborted if any cap is exceeded.
+// Caps apply to each scan (each step of multi-step migrations, each chunk of RunChunk). Zero values disable a cap.
+type Guardrails struct {
+	MaxDeletePercent float64 // Maximum deletes of items of the migration table, as a percentage of the items scanned
+	MaxWritePercent  float64 // Maximum actions on the migration table, as a percentage of the items scanned
+	MaxDeletes       uint    // Maximum deletes, in all tables
+	MaxWrites        uint    // Maximum actions (updates, inserts and deletes), in all tables
+}
+
+// ActionCounts are numbers of queued actions by type
+type ActionCounts struct {
+	Updates uint `json:"updates"`
+	Inserts uint `json:"inserts"`
+	Deletes uint `json:"deletes"`
+}
+
+// Total returns the number of actions of all types
+func (ac ActionCounts) Total() uint {
+	return ac.Updates + ac.Inserts + ac.Deletes
+}
+
+// countActions returns the numbers of actions by table, actions without a table being counted for table
+func countActions(actions []action, table string) map[string]ActionCounts {
+	counts := map[string]ActionCounts{}
+	for _, a := range actions {
+		tn := a.tableName
+		if tn == "" {
+			tn = table
+		}
+		ac := counts[tn]
+		switch a.atype {
+		case updateAction:
+			ac.Updates++
+		case insertAction:
+			ac.Inserts++
+		case deleteAction:
+			ac.Deletes++
+		}
+		counts[tn] = ac
+	}
+	return counts
+}
+
+// GuardrailCheck is the evaluation of a cap of Guardrails
+type GuardrailCheck struct {
+	Name     string  `json:"name"` // Name of the Guardrails field
+	Limit    float64 `json:"limit"`
+	Value    float64 `json:"value"`
+	Exceeded bool    `json:"exceeded"`
+}
+
+func (gc GuardrailCheck) String() string {
+	return fmt.Sprintf("%v %v (would be %v)", gc.Name, gc.Limit, gc.Value)
+}
+
+// Evaluate evaluates the enabled caps of g for a scan of scanned items of table which queued counts actions (by table)
+func (g *Guardrails) Evaluate(table string, scanned uint, counts map[string]ActionCounts) []GuardrailCheck {
+	if g == nil {
+		return nil
+	}
+	var all ActionCounts
+	for _, ac := range counts {
+		all.Updates += ac.Updates
+		all.Inserts += ac.Inserts
+		all.Deletes += ac.Deletes
+	}
+	percent := func(n uint) float64 {
+		if scanned == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(scanned)
+	}
+	checks := []GuardrailCheck{}
+	check := func(name string, limit, value float64) {
+		if limit > 0 {
+			checks = append(checks, GuardrailCheck{Name: name, Limit: limit, Value: value, Exceeded: value > limit})
+		}
+	}
+	check("MaxDeletePercent", g.MaxDeletePercent, percent(counts[table].Deletes))
+	check("MaxWritePercent", g.MaxWritePercent, percent(counts[table].Total()))
+	check("MaxDeletes", float64(g.MaxDeletes), float64(all.Deletes))
+	check("MaxWrites", float64(g.MaxWrites), float64(all.Total()))
+	return checks
+}
+
+// guardrails returns the guardrails of migration: its own, or those of the drifter
+func (dd *DynamoDrifter) guardrails(migration *DynamoDrifterMigration) *Guardrails {
+	if migration.Guardrails != nil {
+		return migration.Guardrails
+	}
+	return dd.Guardrails
+}
+
+// checkGuardrails returns an error wrapping ErrGuardrailExceeded if the actions queued in da exceed the guardrails of migration
+func (dd *DynamoDrifter) checkGuardrails(migration *DynamoDrifterMigration, da *DrifterAction) error {
+	g := dd.guardrails(migration)
+	if g == nil {
+		return nil
+	}
+	exceeded := []string{}
+	for _, gc := range g.Evaluate(migration.TableName, da.scanned, countActions(da.aq.actions(), migration.TableName)) {
+		if gc.Exceeded {
+			exceeded = append(exceeded, gc.String())
+		}
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w, no action executed: %v", ErrGuardrailExceeded, strings.Join(exceeded, ", "))
+}
@@ -0,0 +1,65 @@
+package drift
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestCountActions(t *testing.T) {
+	counts := countActions([]action{
+		{atype: updateAction},
+		{atype: deleteAction},
+		{atype: deleteAction, tableName: "users"},
+		{atype: insertAction, tableName: "orders"},
+	}, "users")
+	if counts["users"] != (ActionCounts{Updates: 1, Deletes: 2}) || counts["orders"] != (ActionCounts{Inserts: 1}) || len(counts) != 2 {
+		t.Fatalf("bad counts: %+v", counts)
+	}
+}
+
+func TestEvaluateGuardrails(t *testing.T) {
+	counts := map[string]ActionCounts{"users": {Updates: 2, Deletes: 3}, "orders": {Deletes: 5}}
+	g := &Guardrails{MaxDeletePercent: 25, MaxWrites: 20}
+	checks := g.Evaluate("users", 10, counts)
+	if len(checks) != 2 {
+		t.Fatalf("only enabled caps should be evaluated: %+v", checks)
+	}
+	if c := checks[0]; c.Name != "MaxDeletePercent" || c.Value != 30 || !c.Exceeded {
+		t.Fatalf("bad check: %+v", c)
+	}
+	if c := checks[1]; c.Name != "MaxWrites" || c.Value != 10 || c.Exceeded {
+		t.Fatalf("bad check: %+v", c)
+	}
+	checks = (&Guardrails{MaxWritePercent: 10, MaxDeletes: 8}).Evaluate("users", 0, counts)
+	if checks[0].Value != 0 || checks[0].Exceeded || checks[1].Value != 8 || checks[1].Exceeded {
+		t.Fatalf("bad checks: %+v", checks)
+	}
+	if checks := (*Guardrails)(nil).Evaluate("users", 10, counts); checks != nil {
+		t.Fatalf("nil guardrails should have no checks: %+v", checks)
+	}
+}
+
+func TestCheckGuardrails(t *testing.T) {
+	dd := &DynamoDrifter{Guardrails: &Guardrails{MaxDeletes: 1}}
+	m := &DynamoDrifterMigration{TableName: "users"}
+	da := dd.newDrifterAction(m)
+	da.scanned = 2
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	da.Delete(keys, "")
+	if err := dd.checkGuardrails(m, da); err != nil {
+		t.Fatalf("guardrails should pass: %v", err)
+	}
+	da.Delete(keys, "")
+	err := dd.checkGuardrails(m, da)
+	if !errors.Is(err, ErrGuardrailExceeded) || !strings.Contains(err.Error(), "MaxDeletes 1 (would be 2)") {
+		t.Fatalf("guardrails should fail: %v", err)
+	}
+	m.Guardrails = &Guardrails{MaxDeletes: 5}
+	if err := dd.checkGuardrails(m, da); err != nil {
+		t.Fatalf("migration guardrails should override those of the drifter: %v", err)
+	}
+}
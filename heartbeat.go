@@ -0,0 +1,206 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Heartbeat is the liveness record of a running migration, stored in its meta table record while it runs (see DynamoDrifter.HeartbeatInterval).
+// Counters are those of the current scan (for multi-step migrations, of the current scan step) except Errors, which covers the whole run.
+type Heartbeat struct {
+	Owner              string    `dynamodbav:"Owner" json:"owner"`
+	Undo               bool      `dynamodbav:"Undo,omitempty" json:"undo,omitempty"`
+	Started            time.Time `dynamodbav:"Started" json:"started"`
+	Last               time.Time `dynamodbav:"Last" json:"last"`
+	CallbacksProcessed uint      `dynamodbav:"CallbacksProcessed" json:"callbacks_processed"`
+	ActionsExecuted    uint      `dynamodbav:"ActionsExecuted" json:"actions_executed"`
+	Errors             uint      `dynamodbav:"Errors" json:"errors"`
+}
+
+// Stale returns whether the last heartbeat is older than maxAge, which suggests the run died (ex: maxAge of a few heartbeat intervals)
+func (hb *Heartbeat) Stale(maxAge time.Duration) bool {
+	return time.Since(hb.Last) > maxAge
+}
+
+// DefaultOwner returns the default identifier of this process in heartbeats: hostname:pid
+func DefaultOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + ":" + strconv.Itoa(os.Getpid())
+}
+
+// tapProgress returns a channel to be used in place of progressChan: messages sent on it are passed to f and forwarded to progressChan
+// (if not nil, dropped if it is full as in progressMsg), and tick is called every interval. stop closes the channel and waits until
+// all messages have been handled.
+func tapProgress(progressChan chan *MigrationProgress, interval time.Duration, f func(mp *MigrationProgress), tick func()) (chan *MigrationProgress, func()) {
+	pc := make(chan *MigrationProgress, 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case mp, ok := <-pc:
+				if !ok {
+					return
+				}
+				f(mp)
+				if progressChan != nil {
+					select {
+					case progressChan <- mp:
+					default:
+					}
+				}
+			case <-ticker.C:
+				tick()
+			}
+		}
+	}()
+	return pc, func() {
+		close(pc)
+		<-done
+	}
+}
+
+// runRecord updates attributes of the meta table record of a running migration. For runs of migrations without a completed record,
+// the record is created (or updated) and marked InProgress, otherwise only the attributes are updated.
+type runRecord struct {
+	sync.Mutex
+	dd        *DynamoDrifter
+	migration *DynamoDrifterMigration
+	undo      bool
+	applied   bool // the migration has a completed meta table record, which must not be marked InProgress
+}
+
+// set sets attribute attr of the record to v
+func (rr *runRecord) set(attr string, v interface{}) error {
+	av, err := dynamodbattribute.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshaling %v: %v", attr, err)
+	}
+	rr.Lock()
+	applied := rr.applied || rr.undo
+	rr.Unlock()
+	ui := &dynamodb.UpdateItemInput{
+		TableName: &rr.dd.MetaTableName,
+		Key: map[string]*dynamodb.AttributeValue{
+			"Number": &dynamodb.AttributeValue{N: aws.String(strconv.FormatUint(uint64(rr.migration.Number), 10))},
+		},
+		ExpressionAttributeNames:  map[string]*string{"#n": aws.String("Number"), "#a": aws.String(attr)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":a": av},
+	}
+	if applied {
+		ui.UpdateExpression = aws.String("SET #a = :a")
+		ui.ConditionExpression = aws.String("attribute_exists(#n)")
+	} else {
+		ui.UpdateExpression = aws.String("SET #a = :a, #tn = :tn, #d = :d, #ip = :true")
+		ui.ConditionExpression = aws.String("attribute_not_exists(#n) OR #ip = :true")
+		ui.ExpressionAttributeNames["#tn"] = aws.String("TableName")
+		ui.ExpressionAttributeNames["#d"] = aws.String("Description")
+		ui.ExpressionAttributeNames["#ip"] = aws.String("InProgress")
+		ui.ExpressionAttributeValues[":tn"] = &dynamodb.AttributeValue{S: aws.String(rr.migration.TableName)}
+		ui.ExpressionAttributeValues[":d"] = &dynamodb.AttributeValue{S: aws.String(rr.migration.Description)}
+		ui.ExpressionAttributeValues[":true"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+	}
+	req, _ := rr.dd.DynamoDB.UpdateItemRequest(ui)
+	err = rr.dd.send(context.Background(), req)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+		if applied {
+			return nil // no record to update
+		}
+		rr.Lock()
+		rr.applied = true
+		rr.Unlock()
+		return rr.set(attr, v)
+	}
+	if err != nil {
+		return fmt.Errorf("error updating %v: %v", attr, err)
+	}
+	return nil
+}
+
+// heartbeater periodically updates the heartbeat of a running migration
+type heartbeater struct {
+	sync.Mutex
+	rr       *runRecord
+	hb       Heartbeat
+	applying bool // last progress message was from the action phase
+}
+
+// observe updates the counters from a progress message
+func (h *heartbeater) observe(mp *MigrationProgress) {
+	h.Lock()
+	defer h.Unlock()
+	if mp.CallbacksProcessed != 0 {
+		if h.applying { // a new scan started
+			h.hb.ActionsExecuted = 0
+			h.applying = false
+		}
+		h.hb.CallbacksProcessed = mp.CallbacksProcessed
+	}
+	if mp.ActionsExecuted != 0 {
+		h.hb.ActionsExecuted = mp.ActionsExecuted
+		h.applying = true
+	}
+	h.hb.Errors += uint(len(mp.CallbackErrors) + len(mp.ActionErrors))
+}
+
+// beat writes the heartbeat
+func (h *heartbeater) beat() error {
+	h.Lock()
+	h.hb.Last = time.Now().UTC()
+	hb := h.hb
+	h.Unlock()
+	return h.rr.set("Heartbeat", hb)
+}
+
+// startHeartbeat starts heartbeats for a run of migration if enabled, returning the progress channel to use for the run in place of
+// progressChan and a function stopping the heartbeats.
+func (dd *DynamoDrifter) startHeartbeat(migration *DynamoDrifterMigration, undo bool, progressChan chan *MigrationProgress) (chan *MigrationProgress, func()) {
+	if dd.HeartbeatInterval <= 0 || migration == nil {
+		return progressChan, func() {}
+	}
+	owner := dd.Owner
+	if owner == "" {
+		owner = DefaultOwner()
+	}
+	h := &heartbeater{
+		rr: &runRecord{dd: dd, migration: migration, undo: undo},
+		hb: Heartbeat{Owner: owner, Undo: undo, Started: time.Now().UTC()},
+	}
+	h.beat() // heartbeats are best effort
+	return tapProgress(progressChan, dd.HeartbeatInterval, h.observe, func() { h.beat() })
+}
+
+// Running returns the meta table records of migrations which are in progress or have a heartbeat, in ascending order.
+// A record with a stale heartbeat (see Heartbeat.Stale) is likely a run which died or was interrupted.
+func (dd *DynamoDrifter) Running() ([]DynamoDrifterMigration, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	records, err := dd.metaRecords(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	ms := []DynamoDrifterMigration{}
+	for _, m := range records {
+		if m.InProgress || m.Heartbeat != nil {
+			ms = append(ms, m)
+		}
+	}
+	return ms, nil
+}
@@ -0,0 +1,46 @@
+package drift
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTapProgress(t *testing.T) {
+	out := make(chan *MigrationProgress, 10)
+	var seen, ticks int32
+	pc, stop := tapProgress(out, time.Millisecond, func(mp *MigrationProgress) {
+		atomic.AddInt32(&seen, 1)
+	}, func() {
+		atomic.AddInt32(&ticks, 1)
+	})
+	for i := 0; i < 3; i++ {
+		pc <- &MigrationProgress{CallbacksProcessed: uint(i)}
+	}
+	time.Sleep(10 * time.Millisecond)
+	stop()
+	if seen != 3 || len(out) != 3 {
+		t.Fatalf("all messages should have been handled and forwarded: %v, %v", seen, len(out))
+	}
+	if atomic.LoadInt32(&ticks) == 0 {
+		t.Fatalf("tick should have been called")
+	}
+}
+
+func TestHeartbeatObserve(t *testing.T) {
+	h := &heartbeater{}
+	h.observe(&MigrationProgress{CallbacksProcessed: 10, CallbackErrors: []error{fmt.Errorf("foo")}})
+	h.observe(&MigrationProgress{ActionsExecuted: 5})
+	if h.hb.CallbacksProcessed != 10 || h.hb.ActionsExecuted != 5 || h.hb.Errors != 1 {
+		t.Fatalf("bad counters: %+v", h.hb)
+	}
+	h.observe(&MigrationProgress{CallbacksProcessed: 2, CallbackErrors: []error{fmt.Errorf("bar")}})
+	if h.hb.CallbacksProcessed != 2 || h.hb.ActionsExecuted != 0 || h.hb.Errors != 2 {
+		t.Fatalf("counters should have been reset by a new scan: %+v", h.hb)
+	}
+	hb := &Heartbeat{Last: time.Now().Add(-time.Minute)}
+	if !hb.Stale(30*time.Second) || hb.Stale(2*time.Minute) {
+		t.Fatalf("bad staleness")
+	}
+}
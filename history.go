@@ -0,0 +1,217 @@
+package drift
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// HistoryFormat is a format of exported migration history
+type HistoryFormat string
+
+// History formats
+const (
+	// HistoryJSON is a JSON object {"version": 1, "migrations": [...]} with the migrations encoded as DynamoDrifterMigration
+	// (with their JSON names, ex: "number", "tablename", "in_progress", "heartbeat", "progress")
+	HistoryJSON HistoryFormat = "json"
+	// HistoryCSV is CSV with a header row and one row per migration, with the columns in historyColumns order. Run metadata columns
+	// (heartbeat, step_progress, progress) are JSON encoded, empty if absent.
+	HistoryCSV HistoryFormat = "csv"
+)
+
+// HistoryVersion is the version of the schema of exported migration history. It changes only when the schema changes incompatibly.
+const HistoryVersion = 1
+
+// historyColumns are the columns of HistoryCSV
+var historyColumns = []string{"number", "tablename", "description", "in_progress", "heartbeat", "step_progress", "progress"}
+
+// historyFile is the HistoryJSON document
+type historyFile struct {
+	Version    int                      `json:"version"`
+	Migrations []DynamoDrifterMigration `json:"migrations"`
+}
+
+// ExportHistory writes all meta table records (completed and in progress, see History) to w in format, in ascending order, for archival
+// or analysis. The export can be restored with ImportHistory.
+func (dd *DynamoDrifter) ExportHistory(ctx context.Context, w io.Writer, format HistoryFormat) error {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return err
+	}
+	if format != HistoryJSON && format != HistoryCSV {
+		return fmt.Errorf("unknown history format: %v", format)
+	}
+	ms, err := dd.metaRecords(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting migration history: %v", err)
+	}
+	if format == HistoryJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(historyFile{Version: HistoryVersion, Migrations: ms}); err != nil {
+			return fmt.Errorf("error writing history: %v", err)
+		}
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(historyColumns)
+	for _, m := range ms {
+		row, err := historyRow(&m)
+		if err != nil {
+			return err
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("error writing history: %v", err)
+	}
+	return nil
+}
+
+// historyRow returns the HistoryCSV row of m
+func historyRow(m *DynamoDrifterMigration) ([]string, error) {
+	row := []string{strconv.FormatUint(uint64(m.Number), 10), m.TableName, m.Description, strconv.FormatBool(m.InProgress)}
+	for _, c := range []struct {
+		v     interface{}
+		empty bool
+	}{
+		{m.Heartbeat, m.Heartbeat == nil},
+		{m.StepProgress, len(m.StepProgress) == 0},
+		{m.Progress, m.Progress == nil},
+	} {
+		if c.empty {
+			row = append(row, "")
+			continue
+		}
+		b, err := json.Marshal(c.v)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling run metadata of migration %v: %v", m.Number, err)
+		}
+		row = append(row, string(b))
+	}
+	return row, nil
+}
+
+// parseHistoryRow returns the migration of a HistoryCSV row
+func parseHistoryRow(row []string) (DynamoDrifterMigration, error) {
+	m := DynamoDrifterMigration{TableName: row[1], Description: row[2]}
+	n, err := strconv.ParseUint(row[0], 10, 64)
+	if err != nil {
+		return m, fmt.Errorf("invalid number %q: %v", row[0], err)
+	}
+	m.Number = uint(n)
+	if m.InProgress, err = strconv.ParseBool(row[3]); err != nil {
+		return m, fmt.Errorf("migration %v: invalid in_progress %q: %v", m.Number, row[3], err)
+	}
+	for i, v := range []interface{}{&m.Heartbeat, &m.StepProgress, &m.Progress} {
+		if row[4+i] == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(row[4+i]), v); err != nil {
+			return m, fmt.Errorf("migration %v: invalid %v: %v", m.Number, historyColumns[4+i], err)
+		}
+	}
+	return m, nil
+}
+
+// readHistory reads migrations exported by ExportHistory in either format
+func readHistory(r io.Reader) ([]DynamoDrifterMigration, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil, fmt.Errorf("error reading history: %v", err)
+		}
+		if !strings.ContainsAny(string(b), " \t\r\n") {
+			break
+		}
+		br.ReadByte()
+	}
+	if b, _ := br.Peek(1); b[0] == '{' {
+		var h historyFile
+		if err := json.NewDecoder(br).Decode(&h); err != nil {
+			return nil, fmt.Errorf("error decoding history: %v", err)
+		}
+		if h.Version != HistoryVersion {
+			return nil, fmt.Errorf("unsupported history version: %v", h.Version)
+		}
+		return h.Migrations, nil
+	}
+	rows, err := csv.NewReader(br).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding history: %v", err)
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(historyColumns, ",") {
+		return nil, fmt.Errorf("history is neither JSON nor CSV with the expected header")
+	}
+	ms := []DynamoDrifterMigration{}
+	for _, row := range rows[1:] {
+		m, err := parseHistoryRow(row)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// ImportHistory writes the meta table records of a history exported by ExportHistory (in either format) to the meta table, ex: to move
+// the meta table to another account or region, or to rebuild it. Records already in the meta table are not overwritten: the others are
+// imported, and an error listing their numbers is returned.
+func (dd *DynamoDrifter) ImportHistory(ctx context.Context, r io.Reader) error {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return err
+	}
+	ms, err := readHistory(r)
+	if err != nil {
+		return err
+	}
+	existing := []string{}
+	for i := range ms {
+		added, err := dd.addMetaRecord(ctx, &ms[i])
+		if err != nil {
+			return err
+		}
+		if !added {
+			existing = append(existing, strconv.FormatUint(uint64(ms[i].Number), 10))
+		}
+	}
+	if len(existing) != 0 {
+		return fmt.Errorf("migrations already in the meta table were not imported: %v", strings.Join(existing, ", "))
+	}
+	return nil
+}
+
+// addMetaRecord writes m to the meta table unless it already has a record of the migration, returning whether it was written
+func (dd *DynamoDrifter) addMetaRecord(ctx context.Context, m *DynamoDrifterMigration) (bool, error) {
+	item, err := dynamodbattribute.MarshalMap(m)
+	if err != nil {
+		return false, fmt.Errorf("error marshaling migration %v: %v", m.Number, err)
+	}
+	req, _ := dd.DynamoDB.PutItemRequest(&dynamodb.PutItemInput{
+		TableName:                &dd.MetaTableName,
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#n)"),
+		ExpressionAttributeNames: map[string]*string{"#n": aws.String("Number")},
+	})
+	err = dd.send(ctx, req)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error writing migration %v to meta table: %v", m.Number, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+package drift
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryRow(t *testing.T) {
+	m := &DynamoDrifterMigration{Number: 2, TableName: "foo", Description: "bar, baz", InProgress: true}
+	row, err := historyRow(m)
+	if err != nil {
+		t.Fatalf("error getting row: %v", err)
+	}
+	if len(row) != len(historyColumns) || strings.Join(row, "|") != "2|foo|bar, baz|true|||" {
+		t.Fatalf("bad row: %q", row)
+	}
+	m.Heartbeat = &Heartbeat{Owner: "host:1", Started: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	m.StepProgress = []StepProgress{{Name: "backfill", Status: StepCompleted}}
+	if row, err = historyRow(m); err != nil {
+		t.Fatalf("error getting row: %v", err)
+	}
+	if !strings.Contains(row[4], `"owner":"host:1"`) || !strings.Contains(row[5], `"backfill"`) || row[6] != "" {
+		t.Fatalf("bad run metadata columns: %q", row)
+	}
+}
+
+func TestReadHistory(t *testing.T) {
+	csvHistory := "number,tablename,description,in_progress,heartbeat,step_progress,progress\n" +
+		"1,foo,\"bar, baz\",false,,\"[{\"\"name\"\":\"\"backfill\"\",\"\"status\"\":\"\"completed\"\"}]\",\n" +
+		"2,foo,,true,\"{\"\"owner\"\":\"\"host:1\"\"}\",,\n"
+	jsonHistory := `
+	{"version": 1, "migrations": [
+		{"number": 1, "tablename": "foo", "description": "bar, baz", "step_progress": [{"name": "backfill", "status": "completed"}]},
+		{"number": 2, "tablename": "foo", "in_progress": true, "heartbeat": {"owner": "host:1"}}
+	]}`
+	for _, h := range []string{csvHistory, jsonHistory} {
+		ms, err := readHistory(strings.NewReader(h))
+		if err != nil {
+			t.Fatalf("error reading history: %v", err)
+		}
+		if len(ms) != 2 || ms[0].Number != 1 || ms[0].Description != "bar, baz" || len(ms[0].StepProgress) != 1 ||
+			ms[0].StepProgress[0].Status != StepCompleted || ms[0].InProgress || ms[0].Heartbeat != nil {
+			t.Fatalf("bad first migration: %+v", ms)
+		}
+		if !ms[1].InProgress || ms[1].Heartbeat == nil || ms[1].Heartbeat.Owner != "host:1" {
+			t.Fatalf("bad second migration: %+v", ms[1])
+		}
+	}
+	for _, h := range []string{"", `{"version": 2, "migrations": []}`, "a,b\n1,2\n", "number,tablename,description,in_progress,heartbeat,step_progress,progress\nx,foo,,false,,,\n"} {
+		if _, err := readHistory(strings.NewReader(h)); err == nil {
+			t.Fatalf("invalid history should fail: %q", h)
+		}
+	}
+}
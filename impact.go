@@ -0,0 +1,94 @@
+package drift
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// ImpactedTable is a table read or written by pending migrations (see ImpactedTables), with its current settings if it exists
+type ImpactedTable struct {
+	TableName  string `json:"tablename"`
+	Migrations []uint `json:"migrations"` // Pending migrations reading or writing the table, in ascending order
+	Scanned    bool   `json:"scanned"`    // The table of a migration (scanned and written), otherwise only written (see WritesTables)
+	Exists     bool   `json:"exists"`
+
+	Status             string   `json:"status,omitempty"`
+	BillingMode        string   `json:"billing_mode,omitempty"`
+	ReadCapacityUnits  int64    `json:"read_capacity_units"`
+	WriteCapacityUnits int64    `json:"write_capacity_units"`
+	ItemCount          int64    `json:"item_count"`
+	SizeBytes          int64    `json:"size_bytes"`
+	Indexes            []string `json:"indexes,omitempty"` // Global and local secondary indexes, whose items are written along with the table's
+	StreamEnabled      bool     `json:"stream_enabled"`
+}
+
+// impactedTables returns the tables of migrations and the tables they declare writing, in ascending order of name
+func impactedTables(migrations []*DynamoDrifterMigration) []ImpactedTable {
+	tables := map[string]*ImpactedTable{}
+	add := func(name string, number uint, scanned bool) {
+		t := tables[name]
+		if t == nil {
+			t = &ImpactedTable{TableName: name}
+			tables[name] = t
+		}
+		if n := len(t.Migrations); n == 0 || t.Migrations[n-1] != number {
+			t.Migrations = append(t.Migrations, number)
+		}
+		t.Scanned = t.Scanned || scanned
+	}
+	for _, m := range migrations {
+		add(m.TableName, m.Number, true)
+		for _, tn := range m.WritesTables {
+			add(tn, m.Number, false)
+		}
+	}
+	out := make([]ImpactedTable, 0, len(tables))
+	for _, t := range tables {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TableName < out[j].TableName })
+	return out
+}
+
+// ImpactedTables returns the tables which the pending migrations of r will read or write, with their current settings, so deployment
+// pipelines can warn the owners of those tables before a run. Tables written by actions are only known if migrations declare them
+// (see DynamoDrifterMigration.WritesTables), and steps running functions are not inspected. The meta and progress tables of the drifter
+// aren't included.
+func (dd *DynamoDrifter) ImpactedTables(ctx context.Context, r *Registry) ([]ImpactedTable, error) {
+	pending, err := dd.Pending(r)
+	if err != nil {
+		return nil, err
+	}
+	tables := impactedTables(pending)
+	for i := range tables {
+		t := &tables[i]
+		if t.Exists, err = dd.findTable(t.TableName); err != nil {
+			return nil, err
+		}
+		if !t.Exists {
+			continue
+		}
+		desc, mode, err := dd.describeTable(ctx, t.TableName)
+		if err != nil {
+			return nil, err
+		}
+		t.Status = aws.StringValue(desc.TableStatus)
+		t.BillingMode = mode
+		if pt := desc.ProvisionedThroughput; pt != nil {
+			t.ReadCapacityUnits = aws.Int64Value(pt.ReadCapacityUnits)
+			t.WriteCapacityUnits = aws.Int64Value(pt.WriteCapacityUnits)
+		}
+		t.ItemCount = aws.Int64Value(desc.ItemCount)
+		t.SizeBytes = aws.Int64Value(desc.TableSizeBytes)
+		for _, gsi := range desc.GlobalSecondaryIndexes {
+			t.Indexes = append(t.Indexes, aws.StringValue(gsi.IndexName))
+		}
+		for _, lsi := range desc.LocalSecondaryIndexes {
+			t.Indexes = append(t.Indexes, aws.StringValue(lsi.IndexName))
+		}
+		t.StreamEnabled = desc.StreamSpecification != nil && aws.BoolValue(desc.StreamSpecification.StreamEnabled)
+	}
+	return tables, nil
+}
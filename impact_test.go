@@ -0,0 +1,26 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImpactedTablesOfMigrations(t *testing.T) {
+	ms := []*DynamoDrifterMigration{
+		{Number: 1, TableName: "foo", WritesTables: []string{"bar", "foo"}},
+		{Number: 2, TableName: "baz"},
+		{Number: 3, TableName: "bar"},
+	}
+	tables := impactedTables(ms)
+	expected := []ImpactedTable{
+		{TableName: "bar", Migrations: []uint{1, 3}, Scanned: true},
+		{TableName: "baz", Migrations: []uint{2}, Scanned: true},
+		{TableName: "foo", Migrations: []uint{1}, Scanned: true},
+	}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Fatalf("bad tables: %+v", tables)
+	}
+	if tables := impactedTables(ms[:1]); tables[0].TableName != "bar" || tables[0].Scanned {
+		t.Fatalf("bar should only be written: %+v", tables)
+	}
+}
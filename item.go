@@ -0,0 +1,88 @@
+package drift
+
+import (
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Clone returns a deep copy of the item which shares no maps, slices or pointers with the original
+func (ri RawDynamoItem) Clone() RawDynamoItem {
+	if ri == nil {
+		return nil
+	}
+	return RawDynamoItem(cloneAttributeMap(ri))
+}
+
+func cloneAttributeMap(m map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]*dynamodb.AttributeValue, len(m))
+	for k, v := range m {
+		out[k] = CloneAttributeValue(v)
+	}
+	return out
+}
+
+func cloneString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	return &c
+}
+
+func cloneBool(b *bool) *bool {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	return &c
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func cloneStrings(ss []*string) []*string {
+	if ss == nil {
+		return nil
+	}
+	out := make([]*string, len(ss))
+	for i, s := range ss {
+		out[i] = cloneString(s)
+	}
+	return out
+}
+
+// CloneAttributeValue returns a deep copy of av
+func CloneAttributeValue(av *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if av == nil {
+		return nil
+	}
+	c := &dynamodb.AttributeValue{
+		S:    cloneString(av.S),
+		N:    cloneString(av.N),
+		B:    cloneBytes(av.B),
+		BOOL: cloneBool(av.BOOL),
+		NULL: cloneBool(av.NULL),
+		SS:   cloneStrings(av.SS),
+		NS:   cloneStrings(av.NS),
+		M:    cloneAttributeMap(av.M),
+	}
+	if av.BS != nil {
+		c.BS = make([][]byte, len(av.BS))
+		for i, b := range av.BS {
+			c.BS[i] = cloneBytes(b)
+		}
+	}
+	if av.L != nil {
+		c.L = make([]*dynamodb.AttributeValue, len(av.L))
+		for i, v := range av.L {
+			c.L[i] = CloneAttributeValue(v)
+		}
+	}
+	return c
+}
@@ -0,0 +1,67 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func testItem() RawDynamoItem {
+	return RawDynamoItem{
+		"Name":  &dynamodb.AttributeValue{S: aws.String("foo")},
+		"Count": &dynamodb.AttributeValue{N: aws.String("1")},
+		"Data":  &dynamodb.AttributeValue{B: []byte("bar")},
+		"Tags":  &dynamodb.AttributeValue{SS: []*string{aws.String("a"), aws.String("b")}},
+		"List": &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{
+			&dynamodb.AttributeValue{BOOL: aws.Bool(true)},
+			&dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+				"Nested": &dynamodb.AttributeValue{S: aws.String("baz")},
+			}},
+		}},
+	}
+}
+
+func TestClone(t *testing.T) {
+	item := testItem()
+	c := item.Clone()
+	if !reflect.DeepEqual(item, c) {
+		t.Fatalf("clone should be equal to the original")
+	}
+	*c["Name"].S = "changed"
+	c["Data"].B[0] = 'x'
+	*c["Tags"].SS[0] = "changed"
+	*c["List"].L[1].M["Nested"].S = "changed"
+	c["New"] = &dynamodb.AttributeValue{S: aws.String("new")}
+	if !reflect.DeepEqual(item, testItem()) {
+		t.Fatalf("original should not have been modified by changes to the clone")
+	}
+	if RawDynamoItem(nil).Clone() != nil {
+		t.Fatalf("clone of nil item should be nil")
+	}
+}
+
+func TestCopyQueuedItems(t *testing.T) {
+	for _, copyItems := range []bool{false, true} {
+		da := &DrifterAction{copyItems: copyItems}
+		item := testItem()
+		if err := da.Insert(item, ""); err != nil {
+			t.Fatalf("error queuing insert: %v", err)
+		}
+		if err := da.Update(item, RawDynamoItem{":v": &dynamodb.AttributeValue{S: aws.String("v")}}, "SET foo = :v", nil, ""); err != nil {
+			t.Fatalf("error queuing update: %v", err)
+		}
+		*item["Name"].S = "changed"
+		for _, a := range da.aq.actions() {
+			m := a.item
+			if m == nil {
+				m = a.keys
+			}
+			changed := *m["Name"].S == "changed"
+			if changed == copyItems {
+				t.Fatalf("copyItems %v: unexpected queued value: %v", copyItems, *m["Name"].S)
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package drift
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// lockNumber is the Number of the meta table record holding the migration lock. It can't collide with migrations, which have unsigned numbers.
+const lockNumber = "-1"
+
+// ErrMigrationLocked is returned (wrapped) when the migration lock is held by another owner
+var ErrMigrationLocked = errors.New("migration lock is held by another owner")
+
+// ErrLockLost is the cause of the cancellation of runs whose lock was lost while held (ex: its lease could not be renewed in time)
+var ErrLockLost = errors.New("migration lock was lost")
+
+// Locker is a lock serializing migrations between processes
+type Locker interface {
+	// Lock acquires the lock or fails (wrapping ErrMigrationLocked if it is held by someone else). The returned function releases it.
+	Lock(ctx context.Context) (unlock func() error, err error)
+}
+
+// holder is implemented by Lockers whose lock can be lost while held, see MetaTableLock.Hold
+type holder interface {
+	Hold(ctx context.Context) (held context.Context, unlock func() error, err error)
+}
+
+// holdLock acquires the lock of locker, returning a context derived from ctx which is cancelled with ErrLockLost if the lock is lost
+// (if locker supports it, see MetaTableLock.Hold)
+func holdLock(ctx context.Context, locker Locker) (context.Context, func() error, error) {
+	if h, ok := locker.(holder); ok {
+		return h.Hold(ctx)
+	}
+	unlock, err := locker.Lock(ctx)
+	return ctx, unlock, err
+}
+
+// MetaTableLock is a Locker implemented as a lease on a record of the meta table. While held, the lease is renewed every Lease/3,
+// so if the owner dies the lock expires after at most Lease. Each acquisition is identified by a random token: the lock isn't re-entrant,
+// acquisitions of the same Owner exclude each other like those of different owners. If the lease is taken over or can't be renewed before it expires, the
+// context returned by Hold is cancelled with ErrLockLost.
+type MetaTableLock struct {
+	Drifter *DynamoDrifter
+	Owner   string        // Identifier of the lock owner recorded with the lease (ex: hostname and pid)
+	Lease   time.Duration // Duration of the lease (defaults to one minute)
+}
+
+func (ml *MetaTableLock) lease() time.Duration {
+	if ml.Lease == 0 {
+		return time.Minute
+	}
+	return ml.Lease
+}
+
+func lockKey() map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"Number": &dynamodb.AttributeValue{N: aws.String(lockNumber)}}
+}
+
+// lockToken returns a random token identifying an acquisition of the lock, so holders sharing an Owner (ex: concurrent runs of a process,
+// or of processes with the default owner on the same host) don't renew or release each other's lease
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating lock token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// acquire creates the lease of acquisition token if the lock is free or its lease expired, or renews it if renew is set
+func (ml *MetaTableLock) acquire(ctx context.Context, token string, renew bool) error {
+	now := time.Now().UTC()
+	item := lockKey()
+	item["Owner"] = &dynamodb.AttributeValue{S: aws.String(ml.Owner)}
+	item["Token"] = &dynamodb.AttributeValue{S: aws.String(token)}
+	item["Expires"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(now.Add(ml.lease()).UnixNano(), 10))}
+	pi := &dynamodb.PutItemInput{
+		TableName:           &ml.Drifter.MetaTableName,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#n) OR #e < :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#n": aws.String("Number"),
+			"#e": aws.String("Expires"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(now.UnixNano(), 10))},
+		},
+	}
+	if renew {
+		pi.ConditionExpression = aws.String("attribute_not_exists(#n) OR #t = :t OR #e < :now")
+		pi.ExpressionAttributeNames["#t"] = aws.String("Token")
+		pi.ExpressionAttributeValues[":t"] = &dynamodb.AttributeValue{S: aws.String(token)}
+	}
+	req, _ := ml.Drifter.DynamoDB.PutItemRequest(pi)
+	err := ml.Drifter.send(ctx, req)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+		return ErrMigrationLocked
+	}
+	if err != nil {
+		return fmt.Errorf("error acquiring migration lock: %v", err)
+	}
+	return nil
+}
+
+// release deletes the lease of acquisition token if still held
+func (ml *MetaTableLock) release(token string) error {
+	di := &dynamodb.DeleteItemInput{
+		TableName:                &ml.Drifter.MetaTableName,
+		Key:                      lockKey(),
+		ConditionExpression:      aws.String("#t = :t"),
+		ExpressionAttributeNames: map[string]*string{"#t": aws.String("Token")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": &dynamodb.AttributeValue{S: aws.String(token)},
+		},
+	}
+	req, _ := ml.Drifter.DynamoDB.DeleteItemRequest(di)
+	err := ml.Drifter.send(context.Background(), req)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+		return fmt.Errorf("%w before being released", ErrLockLost)
+	}
+	if err != nil {
+		return fmt.Errorf("error releasing migration lock: %v", err)
+	}
+	return nil
+}
+
+// Lock implements Locker. Losses of the lock while held are only reported by unlock, see Hold.
+func (ml *MetaTableLock) Lock(ctx context.Context) (func() error, error) {
+	_, unlock, err := ml.Hold(ctx)
+	return unlock, err
+}
+
+// Hold acquires the lock as Lock does, also returning a context derived from ctx which is cancelled with a cause wrapping ErrLockLost
+// (see context.Cause) if the lease is taken over or can't be renewed before it expires
+func (ml *MetaTableLock) Hold(ctx context.Context) (context.Context, func() error, error) {
+	if ml.Owner == "" {
+		return nil, nil, fmt.Errorf("lock owner is required")
+	}
+	token, err := lockToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	renewed := time.Now()
+	if err := ml.acquire(ctx, token, false); err != nil {
+		return nil, nil, err
+	}
+	held, lose := context.WithCancelCause(ctx)
+	stop, cncl := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		interval := ml.lease() / 3
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop.Done():
+				return
+			case <-ticker.C:
+			}
+			expires := renewed.Add(ml.lease())
+			now := time.Now()
+			actx, acncl := context.WithDeadline(stop, expires)
+			err := ml.acquire(actx, token, true)
+			acncl()
+			switch {
+			case err == nil:
+				renewed = now
+			case stop.Err() != nil:
+				return
+			case errors.Is(err, ErrMigrationLocked):
+				lose(fmt.Errorf("%w: lease was taken over", ErrLockLost))
+				return
+			case !time.Now().Add(interval).Before(expires):
+				// failures are retried on the next tick unless the lease expires before
+				lose(fmt.Errorf("%w: lease could not be renewed before expiring: %v", ErrLockLost, err))
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return held, func() error {
+		once.Do(func() {
+			cncl()
+			wg.Wait()
+			lose(nil)
+			err = ml.release(token)
+		})
+		return err
+	}, nil
+}
+
+// defaultLockPoll is the default interval of attempts to acquire a held lock, see LockPolicy
+const defaultLockPoll = time.Second
+
+// LockPolicy makes Run and Undo hold a lock serializing runs between processes (ex: instances of a service migrating on startup), see
+// DynamoDrifter.Locking. Runs which don't get the lock fail with an error wrapping ErrMigrationLocked, after waiting up to Wait for it.
+// Once a run of a migration gets the lock, it is skipped if the migration was applied in the meantime (ex: by the process which held it).
+type LockPolicy struct {
+	Locker Locker        // Lock to hold (optional, defaults to a MetaTableLock of the drifter owned by its Owner), losing it fails the run
+	Wait   time.Duration // Maximum time to wait for a lock held by another process (optional, zero fails fast)
+	Poll   time.Duration // Interval of attempts to acquire a held lock while waiting (optional, defaults to one second)
+}
+
+// lockRun acquires the lock of dd.Locking if set, returning the context of the run (cancelled if the lock is lost) and the release
+// function of the lock
+func (dd *DynamoDrifter) lockRun(ctx context.Context) (context.Context, func() error, error) {
+	lp := dd.Locking
+	if lp == nil {
+		return ctx, func() error { return nil }, nil
+	}
+	locker := lp.Locker
+	if locker == nil {
+		owner := dd.Owner
+		if owner == "" {
+			owner = DefaultOwner()
+		}
+		locker = &MetaTableLock{Drifter: dd, Owner: owner}
+	}
+	poll := lp.Poll
+	if poll <= 0 {
+		poll = defaultLockPoll
+	}
+	deadline := time.Now().Add(lp.Wait)
+	for {
+		held, unlock, err := holdLock(ctx, locker)
+		if !errors.Is(err, ErrMigrationLocked) || !time.Now().Add(poll).Before(deadline) {
+			return held, unlock, err
+		}
+		timer := time.NewTimer(poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, fmt.Errorf("%w: %v", ErrMigrationLocked, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// unlockRun releases the lock of a run, logging failures (ex: the lease was lost)
+func (dd *DynamoDrifter) unlockRun(unlock func() error) {
+	if err := unlock(); err != nil {
+		dd.logf(VerbosityQuiet, "error releasing the run lock: %v", err)
+	}
+}
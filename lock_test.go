@@ -0,0 +1,51 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testLocker is held for its first free attempts
+type testLocker struct {
+	free  int
+	tries int
+}
+
+func (tl *testLocker) Lock(ctx context.Context) (func() error, error) {
+	tl.tries++
+	if tl.tries <= tl.free {
+		return nil, ErrMigrationLocked
+	}
+	return func() error { return nil }, nil
+}
+
+func TestLockRun(t *testing.T) {
+	dd := &DynamoDrifter{}
+	ctx, unlock, err := dd.lockRun(context.Background())
+	if err != nil || unlock() != nil || ctx != context.Background() {
+		t.Fatalf("runs should not be locked without a policy: %v", err)
+	}
+	tl := &testLocker{free: 1}
+	dd.Locking = &LockPolicy{Locker: tl}
+	if _, _, err := dd.lockRun(context.Background()); !errors.Is(err, ErrMigrationLocked) || tl.tries != 1 {
+		t.Fatalf("run should fail fast: %v (%v tries)", err, tl.tries)
+	}
+	tl = &testLocker{free: 3}
+	dd.Locking = &LockPolicy{Locker: tl, Wait: time.Second, Poll: time.Millisecond}
+	if _, _, err := dd.lockRun(context.Background()); err != nil || tl.tries != 4 {
+		t.Fatalf("run should wait for the lock: %v (%v tries)", err, tl.tries)
+	}
+	tl = &testLocker{free: 1000}
+	dd.Locking = &LockPolicy{Locker: tl, Wait: 20 * time.Millisecond, Poll: 5 * time.Millisecond}
+	if _, _, err := dd.lockRun(context.Background()); !errors.Is(err, ErrMigrationLocked) || tl.tries > 5 {
+		t.Fatalf("run should stop waiting: %v (%v tries)", err, tl.tries)
+	}
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+	dd.Locking = &LockPolicy{Locker: &testLocker{free: 1000}, Wait: time.Minute, Poll: time.Millisecond}
+	if _, _, err := dd.lockRun(ctx); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("run should stop waiting when cancelled: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package drift
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Verbosity is the level of detail of the log output of drift (see DynamoDrifter.Logger). Each level includes the output of the levels
+// below it.
+type Verbosity int
+
+// Verbosity levels
+const (
+	VerbosityQuiet   Verbosity = -1 // Failed runs only
+	VerbosityNormal  Verbosity = 0  // Start and end of runs
+	VerbosityVerbose Verbosity = 1  // Phases and steps of runs
+	VerbosityDebug   Verbosity = 2  // Every executed action and its latency
+)
+
+var verbosityNames = map[Verbosity]string{
+	VerbosityQuiet:   "quiet",
+	VerbosityNormal:  "normal",
+	VerbosityVerbose: "verbose",
+	VerbosityDebug:   "debug",
+}
+
+func (v Verbosity) String() string {
+	if name, ok := verbosityNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("Verbosity(%d)", int(v))
+}
+
+// ParseVerbosity parses the name of a verbosity level ("quiet", "normal", "verbose" or "debug")
+func ParseVerbosity(s string) (Verbosity, error) {
+	for v, name := range verbosityNames {
+		if strings.EqualFold(s, name) {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown verbosity: %q (must be quiet, normal, verbose or debug)", s)
+}
+
+// Logger receives the log output of drift (a *log.Logger satisfies it). It must be safe for concurrent use.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logf logs a message at level v if a logger is configured and its verbosity includes v
+func (dd *DynamoDrifter) logf(v Verbosity, format string, args ...interface{}) {
+	if dd.Logger == nil || v > dd.Verbosity {
+		return
+	}
+	dd.Logger.Printf(format, args...)
+}
+
+// runName names a run of migration in log messages
+func runName(migration *DynamoDrifterMigration, undo bool) string {
+	if undo {
+		return fmt.Sprintf("undo of migration %v", migration.Number)
+	}
+	return fmt.Sprintf("migration %v", migration.Number)
+}
+
+// logRunStart logs the start of a run of migration, returning a function logging its end, which must be passed the errors of the run
+func (dd *DynamoDrifter) logRunStart(migration *DynamoDrifterMigration, undo bool) func(errs []error) {
+	started := time.Now()
+	name := runName(migration, undo)
+	if migration.Description != "" {
+		name += fmt.Sprintf(" (%v)", migration.Description)
+	}
+	dd.logf(VerbosityNormal, "%v started on table %v", name, migration.TableName)
+	return func(errs []error) {
+		d := time.Since(started).Round(time.Millisecond)
+		if len(errs) == 0 {
+			dd.logf(VerbosityNormal, "%v succeeded in %v", name, d)
+			return
+		}
+		dd.logf(VerbosityQuiet, "%v failed after %v with %v error(s), first: %v", name, d, len(errs), errs[0])
+	}
+}
+
+// logAction logs an executed action (see VerbosityDebug)
+func (dd *DynamoDrifter) logAction(a *action, tn string, latency time.Duration, err error) {
+	if dd.Logger == nil || dd.Verbosity < VerbosityDebug {
+		return
+	}
+	if a.tableName != "" {
+		tn = a.tableName
+	}
+	op, key := a.atype.String(), formatItem(a.keys)
+	if a.atype == insertAction {
+		key = formatItem(a.item)
+	}
+	if err != nil {
+		dd.logf(VerbosityDebug, "action %v: %v %v on table %v failed in %v: %v", a.seq, op, key, tn, latency, err)
+		return
+	}
+	dd.logf(VerbosityDebug, "action %v: %v %v on table %v in %v", a.seq, op, key, tn, latency)
+}
@@ -0,0 +1,73 @@
+package drift
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type testLogger struct {
+	sync.Mutex
+	lines []string
+}
+
+func (tl *testLogger) Printf(format string, v ...interface{}) {
+	tl.Lock()
+	defer tl.Unlock()
+	tl.lines = append(tl.lines, fmt.Sprintf(format, v...))
+}
+
+func TestParseVerbosity(t *testing.T) {
+	for _, v := range []Verbosity{VerbosityQuiet, VerbosityNormal, VerbosityVerbose, VerbosityDebug} {
+		pv, err := ParseVerbosity(strings.ToUpper(v.String()))
+		if err != nil || pv != v {
+			t.Fatalf("bad parsed verbosity %v: %v, %v", v, pv, err)
+		}
+	}
+	if _, err := ParseVerbosity("loud"); err == nil {
+		t.Fatalf("unknown verbosity should fail")
+	}
+	if s := Verbosity(5).String(); s != "Verbosity(5)" {
+		t.Fatalf("bad string: %v", s)
+	}
+}
+
+func TestLogRun(t *testing.T) {
+	tl := &testLogger{}
+	dd := &DynamoDrifter{Logger: tl}
+	m := &DynamoDrifterMigration{Number: 3, TableName: "foo", Description: "bar"}
+	dd.logRunStart(m, false)(nil)
+	if len(tl.lines) != 2 || tl.lines[0] != "migration 3 (bar) started on table foo" || !strings.HasPrefix(tl.lines[1], "migration 3 (bar) succeeded in ") {
+		t.Fatalf("bad log: %q", tl.lines)
+	}
+	tl.lines = nil
+	dd.Verbosity = VerbosityQuiet
+	dd.logRunStart(m, true)([]error{fmt.Errorf("oops")})
+	if len(tl.lines) != 1 || !strings.HasPrefix(tl.lines[0], "undo of migration 3 (bar) failed after ") || !strings.HasSuffix(tl.lines[0], "with 1 error(s), first: oops") {
+		t.Fatalf("bad log: %q", tl.lines)
+	}
+	dd.Logger = nil
+	dd.logRunStart(m, false)([]error{fmt.Errorf("oops")}) // no logger
+}
+
+func TestLogAction(t *testing.T) {
+	tl := &testLogger{}
+	dd := &DynamoDrifter{Logger: tl, Verbosity: VerbosityVerbose}
+	a := &action{atype: deleteAction, keys: RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}, seq: 7}
+	dd.logAction(a, "foo", time.Millisecond, nil)
+	if len(tl.lines) != 0 {
+		t.Fatalf("actions should only be logged at debug verbosity: %q", tl.lines)
+	}
+	dd.Verbosity = VerbosityDebug
+	dd.logAction(a, "foo", time.Millisecond, nil)
+	a.tableName = "bar"
+	dd.logAction(a, "foo", 2*time.Millisecond, fmt.Errorf("oops"))
+	if len(tl.lines) != 2 || tl.lines[0] != "action 7: delete {ID: 1} on table foo in 1ms" || tl.lines[1] != "action 7: delete {ID: 1} on table bar failed in 2ms: oops" {
+		t.Fatalf("bad log: %q", tl.lines)
+	}
+}
@@ -0,0 +1,80 @@
+package drift
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// expression placeholders used for the marker attribute in scan filters and update expressions
+const (
+	markerName  = "#drift_m"
+	markerValue = ":drift_m"
+)
+
+// MarkerAttribute returns the name of the idempotency marker attribute of migration number (see DynamoDrifterMigration.Idempotent)
+func MarkerAttribute(number uint) string {
+	return "migrated_by_" + strconv.FormatUint(uint64(number), 10)
+}
+
+func markerAttributeValue() *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+}
+
+// admit returns whether item should be passed to the callback of migration, or an error for rejected items
+func (m *DynamoDrifterMigration) admit(item RawDynamoItem) (bool, error) {
+	if m.Idempotent {
+		if _, ok := item[MarkerAttribute(m.Number)]; ok {
+			return false, nil
+		}
+	}
+	return m.Versioning.admit(item)
+}
+
+// scanFilter returns the scan filter expression selecting the items migration may process, or "" if it processes all items
+func (m *DynamoDrifterMigration) scanFilter() (string, map[string]*string, map[string]*dynamodb.AttributeValue, error) {
+	filters := []string{}
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{}
+	if m.Versioning != nil {
+		filter, vnames, vvalues := m.Versioning.filter()
+		filters = append(filters, filter)
+		for k, v := range vnames {
+			names[k] = v
+		}
+		for k, v := range vvalues {
+			values[k] = v
+		}
+	}
+	if m.Idempotent {
+		filters = append(filters, "attribute_not_exists("+markerName+")")
+		names[markerName] = aws.String(MarkerAttribute(m.Number))
+	}
+	if m.Filter != nil {
+		filter, fnames, fvalues, err := withCondition([]Condition{*m.Filter}, names, values)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("invalid Filter: %w", err)
+		}
+		filters = append(filters, filter)
+		names, values = fnames, fvalues
+	}
+	switch len(filters) {
+	case 0:
+		return "", nil, nil, nil
+	case 1:
+	default:
+		for i, f := range filters {
+			filters[i] = "(" + f + ")"
+		}
+	}
+	if len(names) == 0 {
+		names = nil // DynamoDB rejects empty maps
+	}
+	if len(values) == 0 {
+		values = nil
+	}
+	return strings.Join(filters, " AND "), names, values, nil
+}
@@ -0,0 +1,73 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestScanFilter(t *testing.T) {
+	m := &DynamoDrifterMigration{Number: 7}
+	if f, _, _, _ := m.scanFilter(); f != "" {
+		t.Fatalf("migration should not filter: %v", f)
+	}
+	m.Idempotent = true
+	f, names, values, _ := m.scanFilter()
+	if f != "attribute_not_exists(#drift_m)" || *names["#drift_m"] != "migrated_by_7" || values != nil {
+		t.Fatalf("bad idempotent filter: %v %v %v", f, names, values)
+	}
+	m.Versioning = &Versioning{Version: 2}
+	f, names, values, _ = m.scanFilter()
+	if f != "(attribute_not_exists(#drift_v) OR #drift_v < :drift_v) AND (attribute_not_exists(#drift_m))" || len(names) != 2 || len(values) != 1 {
+		t.Fatalf("bad combined filter: %v %v %v", f, names, values)
+	}
+	if ok, _ := m.admit(RawDynamoItem{"migrated_by_7": markerAttributeValue()}); ok {
+		t.Fatalf("marked items should not be admitted")
+	}
+	if ok, _ := m.admit(RawDynamoItem{"migrated_by_6": markerAttributeValue()}); !ok {
+		t.Fatalf("items marked by other migrations should be admitted")
+	}
+}
+
+func TestScanFilterCondition(t *testing.T) {
+	m := &DynamoDrifterMigration{Number: 7, Filter: &Condition{Expression: "attribute_not_exists(Greeting)"}}
+	f, names, values, err := m.scanFilter()
+	if err != nil || f != "attribute_not_exists(Greeting)" || names != nil || values != nil {
+		t.Fatalf("bad filter: %v %v %v %v", f, names, values, err)
+	}
+	m.Idempotent = true
+	m.Filter = &Condition{Expression: "#s = :s", Names: map[string]string{"#s": "Status"}, Values: map[string]interface{}{":s": "active"}}
+	f, names, values, err = m.scanFilter()
+	if err != nil || f != "(attribute_not_exists(#drift_m)) AND (#s = :s)" || len(names) != 2 || *values[":s"].S != "active" {
+		t.Fatalf("bad combined filter: %v %v %v %v", f, names, values, err)
+	}
+	m.Filter = &Condition{Expression: "#drift_m = :s", Names: map[string]string{"#drift_m": "Status"}}
+	if _, _, _, err := m.scanFilter(); err == nil {
+		t.Fatalf("conflicting names should fail")
+	}
+}
+
+func TestMarkerActions(t *testing.T) {
+	da := &DrifterAction{marker: MarkerAttribute(3), table: "users"}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	if err := da.UpdateItem(keys, "").Set("Name", "a").Queue(); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	if err := da.Update(keys, nil, "REMOVE Legacy", nil, "other"); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	if err := da.Insert(keys, "users"); err != nil {
+		t.Fatalf("error queuing insert: %v", err)
+	}
+	actions := da.aq.actions()
+	if a := actions[0]; a.updExpr != "SET #drift_m = :drift_m, #Name = :v0" || *a.expAttrNames["#drift_m"] != "migrated_by_3" || !*a.values[":drift_m"].BOOL {
+		t.Fatalf("bad update: %v %v %v", a.updExpr, a.expAttrNames, a.values)
+	}
+	if a := actions[1]; a.updExpr != "REMOVE Legacy" {
+		t.Fatalf("updates of other tables should not be marked: %v", a.updExpr)
+	}
+	if _, ok := actions[2].item["migrated_by_3"]; !ok || len(keys) != 1 {
+		t.Fatalf("inserted item should be marked (and keys unmodified): %v", actions[2].item)
+	}
+}
@@ -0,0 +1,311 @@
+package drift
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// ErrModelMismatch is returned (wrapped) for actions which don't match the model of their table, see ModelRegistry
+var ErrModelMismatch = errors.New("action doesn't match the model of its table")
+
+// Model is the shape of the items of a table, derived from a Go struct with "dynamodbav" annotations (see RegisterModel)
+type Model struct {
+	Table      string
+	Type       reflect.Type
+	HashKey    string
+	RangeKey   string                     // "" if the table has no range key
+	Attributes map[string]*ModelAttribute // By attribute name
+}
+
+// ModelAttribute is an attribute of a model
+type ModelAttribute struct {
+	Name  string
+	Field string // Go field, ex: "Address.City" for fields of embedded structs
+	Type  string // DynamoDB type ("S", "N", "B", "BOOL", "SS", "NS", "BS", "L" or "M"), "" if it can't be known (ex: interface{} fields)
+
+	offset   uintptr // offset of the field in the struct
+	indirect bool    // field of an embedded struct pointer, which has no offset
+	gotype   reflect.Type
+}
+
+// keys returns the key attributes of the model
+func (m *Model) keys() []string {
+	if m.RangeKey == "" {
+		return []string{m.HashKey}
+	}
+	return []string{m.HashKey, m.RangeKey}
+}
+
+// ModelRegistry maps tables to the models of their items, the single source of truth of table shapes: actions queued on tables with a
+// model are validated against it (see DynamoDrifter.Models), and tables can be checked for conformance to their model (see
+// CheckConformance). The zero value is an empty registry.
+type ModelRegistry struct {
+	sync.Mutex
+	models map[string]*Model
+}
+
+// RegisterModel registers struct T as the model of table, with key attributes hashKey and rangeKey (optional) which must be attributes of T
+func RegisterModel[T any](r *ModelRegistry, table, hashKey, rangeKey string) error {
+	if table == "" {
+		return fmt.Errorf("table is required")
+	}
+	m, err := newModel(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return fmt.Errorf("model of table %v: %v", table, err)
+	}
+	m.Table, m.HashKey, m.RangeKey = table, hashKey, rangeKey
+	for _, k := range m.keys() {
+		if m.Attributes[k] == nil {
+			return fmt.Errorf("model of table %v: key %q is not an attribute of %v", table, k, m.Type)
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	if r.models == nil {
+		r.models = map[string]*Model{}
+	}
+	if _, ok := r.models[table]; ok {
+		return fmt.Errorf("duplicate model of table %v", table)
+	}
+	r.models[table] = m
+	return nil
+}
+
+// Model returns the model of table, or nil
+func (r *ModelRegistry) Model(table string) *Model {
+	if r == nil {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	return r.models[table]
+}
+
+// Tables returns the tables with models, sorted
+func (r *ModelRegistry) Tables() []string {
+	r.Lock()
+	defer r.Unlock()
+	out := make([]string, 0, len(r.models))
+	for t := range r.models {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// newModel returns the model of struct type t, whose attributes are named as by dynamodbattribute.MarshalMap. Fields of embedded structs
+// are attributes of the model, unless shadowed by fields of the outer struct.
+func newModel(t reflect.Type) (*Model, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not a struct", t)
+	}
+	m := &Model{Type: t, Attributes: map[string]*ModelAttribute{}}
+	var walk func(t reflect.Type, offset uintptr, indirect bool, prefix string)
+	walk = func(t reflect.Type, offset uintptr, indirect bool, prefix string) {
+		embedded := []reflect.StructField{}
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, opts := parseAVTag(sf.Tag.Get("dynamodbav"))
+			if name == "-" || sf.PkgPath != "" && !sf.Anonymous {
+				continue
+			}
+			if sf.Anonymous && name == "" && (sf.Type.Kind() == reflect.Struct || sf.Type.Kind() == reflect.Ptr && sf.Type.Elem().Kind() == reflect.Struct) {
+				embedded = append(embedded, sf)
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			if _, ok := m.Attributes[name]; ok {
+				continue // shadowed
+			}
+			m.Attributes[name] = &ModelAttribute{
+				Name:     name,
+				Field:    prefix + sf.Name,
+				Type:     attributeType(sf.Type, opts),
+				offset:   offset + sf.Offset,
+				indirect: indirect,
+				gotype:   sf.Type,
+			}
+		}
+		for _, sf := range embedded {
+			if sf.Type.Kind() == reflect.Ptr {
+				walk(sf.Type.Elem(), 0, true, prefix+sf.Name+".")
+				continue
+			}
+			walk(sf.Type, offset+sf.Offset, indirect, prefix+sf.Name+".")
+		}
+	}
+	walk(t, 0, false, "")
+	return m, nil
+}
+
+// parseAVTag returns the name and options of a "dynamodbav" annotation
+func parseAVTag(tag string) (string, map[string]bool) {
+	parts := strings.Split(tag, ",")
+	opts := map[string]bool{}
+	for _, o := range parts[1:] {
+		opts[o] = true
+	}
+	return parts[0], opts
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*dynamodbattribute.Marshaler)(nil)).Elem()
+)
+
+// attributeType returns the DynamoDB type of values of Go type t marshaled with dynamodbattribute, "" if it depends on the value
+func attributeType(t reflect.Type, opts map[string]bool) string {
+	switch {
+	case opts["string"]:
+		return "S"
+	case opts["stringset"]:
+		return "SS"
+	case opts["numberset"]:
+		return "NS"
+	case opts["binaryset"]:
+		return "BS"
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return ""
+	}
+	if t == timeType {
+		return "S"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "S"
+	case reflect.Bool:
+		return "BOOL"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "N"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "B"
+		}
+		return "L"
+	case reflect.Map, reflect.Struct:
+		return "M"
+	}
+	return ""
+}
+
+// avType returns the DynamoDB type of av
+func avType(av *dynamodb.AttributeValue) string {
+	switch {
+	case av == nil:
+		return ""
+	case av.S != nil:
+		return "S"
+	case av.N != nil:
+		return "N"
+	case av.B != nil:
+		return "B"
+	case av.BOOL != nil:
+		return "BOOL"
+	case av.NULL != nil:
+		return "NULL"
+	case av.SS != nil:
+		return "SS"
+	case av.NS != nil:
+		return "NS"
+	case av.BS != nil:
+		return "BS"
+	case av.L != nil:
+		return "L"
+	case av.M != nil:
+		return "M"
+	}
+	return ""
+}
+
+// checkAttribute returns an error if av isn't a valid value of attribute attr of the model (attributes not in the model are valid)
+func (m *Model) checkAttribute(attr string, av *dynamodb.AttributeValue) error {
+	ma := m.Attributes[attr]
+	if ma == nil || ma.Type == "" {
+		return nil
+	}
+	if t := avType(av); t != ma.Type && t != "NULL" {
+		return fmt.Errorf("attribute %v of table %v is %v, not %v (see %v.%v)", attr, m.Table, t, ma.Type, m.Type, ma.Field)
+	}
+	return nil
+}
+
+// checkKeys returns an error if keys aren't the key attributes of the model
+func (m *Model) checkKeys(keys RawDynamoItem) error {
+	for _, k := range m.keys() {
+		if keys[k] == nil {
+			return fmt.Errorf("key %v of table %v is missing", k, m.Table)
+		}
+		if t := avType(keys[k]); t != m.Attributes[k].Type && m.Attributes[k].Type != "" {
+			return fmt.Errorf("key %v of table %v is %v, not %v", k, m.Table, t, m.Attributes[k].Type)
+		}
+	}
+	for k := range keys {
+		if k != m.HashKey && k != m.RangeKey {
+			return fmt.Errorf("attribute %v is not a key of table %v", k, m.Table)
+		}
+	}
+	return nil
+}
+
+// validate checks an action on the table of the model: its key attributes must be present, and the attributes it writes must have the
+// types of the model. The attributes written by updates are evaluated from the update expression when possible (ex: not for updates of
+// attributes relative to their current value).
+func (m *Model) validate(a *action) error {
+	switch a.atype {
+	case insertAction:
+		keys := RawDynamoItem{}
+		for _, k := range m.keys() {
+			if a.item[k] != nil {
+				keys[k] = a.item[k]
+			}
+		}
+		if err := m.checkKeys(keys); err != nil {
+			return err
+		}
+		for attr, av := range a.item {
+			if err := m.checkAttribute(attr, av); err != nil {
+				return err
+			}
+		}
+	case updateAction:
+		if err := m.checkKeys(a.keys); err != nil {
+			return err
+		}
+		after, err := ApplyUpdate(a.keys, a.updExpr, a.expAttrNames, a.values)
+		if err != nil {
+			return nil // depends on the item
+		}
+		for attr, av := range after {
+			if k := a.keys[attr]; k != nil {
+				if !reflect.DeepEqual(k, av) {
+					return fmt.Errorf("key %v of table %v can't be updated", attr, m.Table)
+				}
+				continue
+			}
+			if err := m.checkAttribute(attr, av); err != nil {
+				return err
+			}
+		}
+	case deleteAction, conditionCheckAction:
+		return m.checkKeys(a.keys)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package drift
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testModelBase struct {
+	Created time.Time
+	Tags    []string `dynamodbav:",stringset"`
+}
+
+type testModelUser struct {
+	testModelBase
+	ID        int    `dynamodbav:"ID"`
+	FirstName string `dynamodbav:"FirstName"`
+	Age       int    `dynamodbav:"Age,string"`
+	Address   map[string]string
+	Avatar    []byte
+	Active    bool
+	Nickname  string `dynamodbav:",omitempty"`
+	Ignored   string `dynamodbav:"-"`
+	internal  string
+}
+
+func TestModel(t *testing.T) {
+	r := &ModelRegistry{}
+	if err := RegisterModel[testModelUser](r, "users", "ID", ""); err != nil {
+		t.Fatalf("error registering model: %v", err)
+	}
+	m := r.Model("users")
+	types := map[string]string{}
+	for name, a := range m.Attributes {
+		types[name] = a.Type
+	}
+	expected := map[string]string{"Created": "S", "Tags": "SS", "ID": "N", "FirstName": "S", "Age": "S", "Address": "M", "Avatar": "B", "Active": "BOOL", "Nickname": "S"}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("bad attributes: %v", types)
+	}
+	if m.Attributes["Tags"].Field != "testModelBase.Tags" || m.Type != reflect.TypeOf(testModelUser{}) {
+		t.Fatalf("bad model: %+v", m)
+	}
+	if err := RegisterModel[testModelUser](r, "users", "ID", ""); err == nil {
+		t.Fatalf("duplicate models should fail")
+	}
+	if err := RegisterModel[testModelUser](r, "other", "Id", ""); err == nil {
+		t.Fatalf("unknown keys should fail")
+	}
+	if err := RegisterModel[string](r, "other", "ID", ""); err == nil {
+		t.Fatalf("models should be structs")
+	}
+	if tables := r.Tables(); len(tables) != 1 || tables[0] != "users" {
+		t.Fatalf("bad tables: %v", tables)
+	}
+}
+
+func TestModelValidation(t *testing.T) {
+	dd := &DynamoDrifter{Models: &ModelRegistry{}}
+	if err := RegisterModel[testModelUser](dd.Models, "users", "ID", ""); err != nil {
+		t.Fatalf("error registering model: %v", err)
+	}
+	da := dd.newDrifterAction(&DynamoDrifterMigration{TableName: "users"})
+	key := map[string]interface{}{"ID": 1}
+	for _, c := range []struct {
+		name  string
+		queue func() error
+		ok    bool
+	}{
+		{"update", func() error { return da.UpdateItem(key, "").Set("FirstName", "Jane").Add("Age", 1).Queue() }, false},
+		{"update with the model's types", func() error { return da.UpdateItem(key, "").Set("FirstName", "Jane").Set("Age", "3").Queue() }, true},
+		{"update of unknown attributes", func() error { return da.UpdateItem(key, "").Set("Other", 1).Queue() }, true},
+		{"relative update", func() error {
+			return da.Update(key, map[string]interface{}{":n": 1}, "SET Visits = Visits + :n", nil, "")
+		}, true},
+		{"update of the key", func() error { return da.UpdateItem(key, "").Set("ID", 2).Queue() }, false},
+		{"update without key", func() error {
+			return da.UpdateItem(map[string]interface{}{"Id": 1}, "").Set("FirstName", "Jane").Queue()
+		}, false},
+		{"insert", func() error { return da.Insert(testModelUser{ID: 1}, "") }, true},
+		{"insert without key", func() error { return da.Insert(map[string]interface{}{"FirstName": "Jane"}, "") }, false},
+		{"insert with a bad type", func() error { return da.Insert(map[string]interface{}{"ID": "1"}, "") }, false},
+		{"delete", func() error { return da.Delete(key, "") }, true},
+		{"delete with extra attributes", func() error { return da.Delete(map[string]interface{}{"ID": 1, "Age": 1}, "") }, false},
+		{"action on a table without model", func() error { return da.Delete(map[string]interface{}{"Foo": 1}, "other") }, true},
+	} {
+		err := c.queue()
+		if c.ok && err != nil || !c.ok && !errors.Is(err, ErrModelMismatch) {
+			t.Fatalf("%v: bad validation: %v", c.name, err)
+		}
+	}
+}
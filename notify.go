@@ -0,0 +1,126 @@
+package drift
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// notifyTimeout bounds each Notify call, which isn't cancelled with the run so that failures of cancelled runs are notified
+const notifyTimeout = 10 * time.Second
+
+// NotificationEvent is the kind of a Notification
+type NotificationEvent string
+
+// Notification events
+const (
+	NotifyStarted   NotificationEvent = "started"
+	NotifySucceeded NotificationEvent = "succeeded"
+	NotifyFailed    NotificationEvent = "failed"
+)
+
+// Notification describes the start or the end of a run of a migration (Run/Undo)
+type Notification struct {
+	Event       NotificationEvent
+	Number      uint
+	TableName   string
+	Description string
+	Undo        bool
+	Owner       string // See DynamoDrifter.Owner
+
+	// Totals of the run (across all scans of multi-step migrations), zero when started
+	CallbacksProcessed uint
+	ActionsExecuted    uint
+	Errors             []error
+
+	Started  time.Time
+	Duration time.Duration // Zero when started
+}
+
+// Notifier is notified when migration runs start and end (see DynamoDrifter.Notifiers).
+// Notify is called synchronously by Run/Undo with a context bounded by a timeout. Notifications are best effort: errors are ignored.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// notification tracks the totals of a run for notifications
+type notification struct {
+	sync.Mutex
+	n        Notification
+	cp, ae   uint // counters of the current scan
+	applying bool // last progress message was from the action phase
+}
+
+// observe updates the totals from a progress message
+func (nt *notification) observe(mp *MigrationProgress) {
+	nt.Lock()
+	defer nt.Unlock()
+	if mp.CallbacksProcessed != 0 {
+		if nt.applying { // a new scan started
+			nt.n.CallbacksProcessed += nt.cp
+			nt.n.ActionsExecuted += nt.ae
+			nt.cp, nt.ae = 0, 0
+			nt.applying = false
+		}
+		nt.cp = mp.CallbacksProcessed
+	}
+	if mp.ActionsExecuted != 0 {
+		nt.ae = mp.ActionsExecuted
+		nt.applying = true
+	}
+}
+
+// finish returns the final notification of the run
+func (nt *notification) finish(errs []error) *Notification {
+	nt.Lock()
+	defer nt.Unlock()
+	n := nt.n
+	n.Event = NotifySucceeded
+	if len(errs) != 0 {
+		n.Event = NotifyFailed
+	}
+	n.CallbacksProcessed += nt.cp
+	n.ActionsExecuted += nt.ae
+	n.Errors = errs
+	n.Duration = time.Since(n.Started)
+	return &n
+}
+
+// notify sends n to all notifiers
+func (dd *DynamoDrifter) notify(n *Notification) {
+	for _, nf := range dd.Notifiers {
+		ctx, cncl := context.WithTimeout(context.Background(), notifyTimeout)
+		nf.Notify(ctx, n)
+		cncl()
+	}
+}
+
+// startNotifications notifies notifiers of the start of a run of migration, returning the progress channel to use for the run in place of
+// progressChan and a function notifying the end of the run, which must be passed its errors.
+func (dd *DynamoDrifter) startNotifications(migration *DynamoDrifterMigration, undo bool, progressChan chan *MigrationProgress) (chan *MigrationProgress, func(errs []error)) {
+	if len(dd.Notifiers) == 0 || migration == nil {
+		return progressChan, func([]error) {}
+	}
+	owner := dd.Owner
+	if owner == "" {
+		owner = DefaultOwner()
+	}
+	nt := &notification{
+		n: Notification{
+			Event:       NotifyStarted,
+			Number:      migration.Number,
+			TableName:   migration.TableName,
+			Description: migration.Description,
+			Undo:        undo,
+			Owner:       owner,
+			Started:     time.Now().UTC(),
+		},
+	}
+	start := nt.n
+	dd.notify(&start)
+	pc, stop := tapProgress(progressChan, time.Hour, nt.observe, func() {})
+	return pc, func(errs []error) {
+		stop()
+		dd.notify(nt.finish(errs))
+	}
+}
@@ -0,0 +1,41 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+type testNotifier struct {
+	ns []*Notification
+}
+
+func (tn *testNotifier) Notify(ctx context.Context, n *Notification) error {
+	tn.ns = append(tn.ns, n)
+	return fmt.Errorf("errors are ignored")
+}
+
+func TestNotifications(t *testing.T) {
+	tn := &testNotifier{}
+	dd := &DynamoDrifter{Notifiers: []Notifier{tn}, Owner: "test"}
+	out := make(chan *MigrationProgress, 10)
+	pc, notifyEnd := dd.startNotifications(&DynamoDrifterMigration{Number: 2, TableName: "foo"}, false, out)
+	if len(tn.ns) != 1 || tn.ns[0].Event != NotifyStarted || tn.ns[0].Number != 2 || tn.ns[0].Owner != "test" {
+		t.Fatalf("start should have been notified: %+v", tn.ns)
+	}
+	pc <- &MigrationProgress{CallbacksProcessed: 10}
+	pc <- &MigrationProgress{ActionsExecuted: 4}
+	pc <- &MigrationProgress{CallbacksProcessed: 3} // second scan
+	notifyEnd([]error{fmt.Errorf("bar")})
+	if len(out) != 3 {
+		t.Fatalf("progress should have been forwarded: %v", len(out))
+	}
+	n := tn.ns[1]
+	if n.Event != NotifyFailed || n.CallbacksProcessed != 13 || n.ActionsExecuted != 4 || len(n.Errors) != 1 || n.Duration <= 0 {
+		t.Fatalf("bad end notification: %+v", n)
+	}
+	nt := &notification{}
+	if n := nt.finish([]error{}); n.Event != NotifySucceeded {
+		t.Fatalf("bad event: %v", n.Event)
+	}
+}
@@ -0,0 +1,59 @@
+package drift
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrNumberCollision is returned (wrapped) when two different migrations have the same number, see Registry
+var ErrNumberCollision = errors.New("migration number collision")
+
+// timestampNumberLayout is the layout of timestamp migration numbers
+const timestampNumberLayout = "20060102150405"
+
+// TimestampNumber returns the timestamp migration number of t (in UTC), ex: 20240515123000 for 2024-05-15 12:30:00. Timestamp numbers are
+// assigned when migrations are written, so migrations written in parallel (ex: on feature branches) rarely collide, unlike sequential
+// numbers. They require 64-bit migration numbers, as uint is on 64-bit platforms: on 32-bit platforms, TimestampNumber fails instead of
+// returning a truncated number. Times before year 0 have no timestamp number.
+func TimestampNumber(t time.Time) (uint, error) {
+	n, err := strconv.ParseUint(t.UTC().Format(timestampNumberLayout), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%v has no timestamp number", t)
+	}
+	if n > uint64(^uint(0)) {
+		return 0, fmt.Errorf("timestamp number %v of %v overflows the %v-bit migration numbers of this platform", n, t, strconv.IntSize)
+	}
+	return uint(n), nil
+}
+
+// NumberTime returns the time of timestamp migration number n (see TimestampNumber), or false if n isn't a timestamp number
+func NumberTime(n uint) (time.Time, bool) {
+	s := strconv.FormatUint(uint64(n), 10)
+	if len(s) != len(timestampNumberLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timestampNumberLayout, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// formatMigrationNumber formats migration number n as the N value of meta table keys
+func formatMigrationNumber(n uint) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+// checkCollision returns an error wrapping ErrNumberCollision if the applied record of migration number m.Number (which may lack a
+// table or description, ex: adopted records) is of another migration than m: its table or description differs
+func checkCollision(m *DynamoDrifterMigration, applied *DynamoDrifterMigration) error {
+	switch {
+	case applied.TableName != "" && applied.TableName != m.TableName:
+		return fmt.Errorf("%w: migration %v of table %v is applied to table %v", ErrNumberCollision, m.Number, m.TableName, applied.TableName)
+	case applied.Description != "" && m.Description != "" && applied.Description != m.Description:
+		return fmt.Errorf("%w: migration %v (%q) is applied as %q", ErrNumberCollision, m.Number, m.Description, applied.Description)
+	}
+	return nil
+}
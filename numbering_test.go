@@ -0,0 +1,28 @@
+package drift
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestampNumber(t *testing.T) {
+	ts := time.Date(2024, 5, 15, 14, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	n, err := TimestampNumber(ts)
+	if err != nil || n != 20240515123000 {
+		t.Fatalf("bad timestamp number: %v, %v", n, err)
+	}
+	if n, err := TimestampNumber(time.Date(-1, 1, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatalf("times before year 0 should have no timestamp number: %v", n)
+	}
+	if nt, ok := NumberTime(n); !ok || !nt.Equal(ts) {
+		t.Fatalf("bad time of %v: %v, %v", n, nt, ok)
+	}
+	for _, n := range []uint{0, 42, 20241315123000, 120240515123000} {
+		if _, ok := NumberTime(n); ok {
+			t.Fatalf("%v should not be a timestamp number", n)
+		}
+	}
+	if formatMigrationNumber(^uint(0)) != "18446744073709551615" {
+		t.Fatalf("bad formatting of the greatest number: %v", formatMigrationNumber(^uint(0)))
+	}
+}
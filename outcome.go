@@ -0,0 +1,260 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// maxReportOutcomes is the maximum number of keys in the outcomes of a run report
+const maxReportOutcomes = 100000
+
+// errConditionSkipped is returned by doAction and doTransaction when conditional updates were skipped because their condition failed
+var errConditionSkipped = errors.New("condition failed")
+
+// Outcome is the outcome of an item processed by a run
+type Outcome string
+
+const (
+	OutcomeMigrated   Outcome = "migrated"   // All actions queued for the item were applied
+	OutcomeSkipped    Outcome = "skipped"    // No actions were queued for the item
+	OutcomeFailed     Outcome = "failed"     // The callback or an action of the item failed, or its actions weren't executed
+	OutcomeConflicted Outcome = "conflicted" // Conditional updates of the item were skipped because their condition failed
+)
+
+// OutcomeOptions enable accounting of the outcome of each item processed by runs, for reconciliation jobs which need exact results:
+// totals are included in run reports (see RunReport.Outcomes), along with the outcome of each key if ReportKeys is set, and outcomes may be
+// streamed to Log as soon as they are known, for tables too large for reports.
+// Outcomes are only tracked for migrations with Callback, items of BatchCallback migrations can't be told apart.
+type OutcomeOptions struct {
+	ReportKeys bool      // Include the outcome of each key in run reports (up to 100000 keys)
+	Log        io.Writer // Receives outcomes as JSON lines (see OutcomeRecord) (optional)
+}
+
+// OutcomeRecord is the outcome of an item, as written to OutcomeOptions.Log. Keys are encoded in DynamoDB JSON (ex: {"ID":{"S":"a"}}).
+type OutcomeRecord struct {
+	Number  uint                   `json:"number"`
+	Undo    bool                   `json:"undo,omitempty"`
+	Key     map[string]interface{} `json:"key"`
+	Outcome Outcome                `json:"outcome"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// OutcomeReport are the outcomes of the items processed by a run
+type OutcomeReport struct {
+	Totals    map[Outcome]uint   `json:"totals"`
+	Keys      map[string]Outcome `json:"keys,omitempty"` // By key, encoded in DynamoDB JSON (see OutcomeOptions.ReportKeys)
+	Truncated bool               `json:"truncated"`      // Keys beyond the limit of reports were omitted
+}
+
+type outcomesKey struct{}
+
+// pendingOutcome is an item whose actions are queued
+type pendingOutcome struct {
+	key        map[string]interface{}
+	remaining  int
+	conflicted bool
+	err        error
+}
+
+// outcomeRecorder tracks the outcomes of the items of a run. Items are identified by the group of their actions (see forItem).
+type outcomeRecorder struct {
+	sync.Mutex
+	dd      *DynamoDrifter
+	opts    *OutcomeOptions
+	number  uint
+	undo    bool
+	attrs   []string // key attributes of the migration table
+	pending map[uint64]*pendingOutcome
+	report  *OutcomeReport
+	logErr  bool
+}
+
+// startOutcomes returns ctx carrying the outcome recorder of a run of migration if enabled
+func (dd *DynamoDrifter) startOutcomes(ctx context.Context, migration *DynamoDrifterMigration, undo bool) context.Context {
+	if dd.Outcomes == nil || migration == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, outcomesKey{}, &outcomeRecorder{
+		dd:      dd,
+		opts:    dd.Outcomes,
+		number:  migration.Number,
+		undo:    undo,
+		pending: map[uint64]*pendingOutcome{},
+		report:  &OutcomeReport{Totals: map[Outcome]uint{}, Keys: map[string]Outcome{}},
+	})
+}
+
+// outcomesFrom returns the outcome recorder carried by ctx, or nil
+func outcomesFrom(ctx context.Context) *outcomeRecorder {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(outcomesKey{}).(*outcomeRecorder)
+	return r
+}
+
+// scan starts recording the outcomes of a scan of table
+func (r *outcomeRecorder) scan(ctx context.Context, table string) error {
+	td, _, err := r.dd.describeTable(ctx, table)
+	if err != nil {
+		return fmt.Errorf("error describing table: %v", err)
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.attrs = r.attrs[:0]
+	for _, kse := range td.KeySchema {
+		r.attrs = append(r.attrs, aws.StringValue(kse.AttributeName))
+	}
+	return nil
+}
+
+// key returns the key attributes of item in DynamoDB JSON (key attributes are strings, numbers or binary)
+func (r *outcomeRecorder) key(item RawDynamoItem) map[string]interface{} {
+	key := map[string]interface{}{}
+	for _, attr := range r.attrs {
+		av := item[attr]
+		switch {
+		case av == nil:
+		case av.S != nil:
+			key[attr] = map[string]string{"S": *av.S}
+		case av.N != nil:
+			key[attr] = map[string]string{"N": *av.N}
+		case av.B != nil:
+			key[attr] = map[string][]byte{"B": av.B}
+		}
+	}
+	return key
+}
+
+// processed records the callback of item, which queued its actions in group
+func (r *outcomeRecorder) processed(group uint64, item RawDynamoItem, err error) {
+	r.Lock()
+	defer r.Unlock()
+	key := r.key(item)
+	if err != nil {
+		r.emit(key, OutcomeFailed, err)
+		return
+	}
+	r.pending[group] = &pendingOutcome{key: key}
+}
+
+// skipped records an item which wasn't passed to the callback
+func (r *outcomeRecorder) skipped(item RawDynamoItem, err error) {
+	r.Lock()
+	defer r.Unlock()
+	if err != nil {
+		r.emit(r.key(item), OutcomeFailed, err)
+		return
+	}
+	r.emit(r.key(item), OutcomeSkipped, nil)
+}
+
+// queued records the actions queued by the callbacks, items without actions being skipped
+func (r *outcomeRecorder) queued(actions []action) {
+	r.Lock()
+	defer r.Unlock()
+	for _, a := range actions {
+		if po := r.pending[a.group]; po != nil {
+			po.remaining++
+		}
+	}
+	for group, po := range r.pending {
+		if po.remaining == 0 {
+			r.emit(po.key, OutcomeSkipped, nil)
+			delete(r.pending, group)
+		}
+	}
+}
+
+// applied records the result of applying actions
+func (r *outcomeRecorder) applied(actions []action, err error) {
+	r.Lock()
+	defer r.Unlock()
+	for _, a := range actions {
+		po := r.pending[a.group]
+		if po == nil {
+			continue
+		}
+		po.remaining--
+		switch {
+		case errors.Is(err, errConditionSkipped):
+			po.conflicted = true
+		case err != nil && po.err == nil:
+			po.err = err
+		}
+		if po.remaining != 0 {
+			continue
+		}
+		switch {
+		case po.err != nil:
+			r.emit(po.key, OutcomeFailed, po.err)
+		case po.conflicted:
+			r.emit(po.key, OutcomeConflicted, nil)
+		default:
+			r.emit(po.key, OutcomeMigrated, nil)
+		}
+		delete(r.pending, a.group)
+	}
+}
+
+// flush records the items whose actions weren't all applied as failed
+func (r *outcomeRecorder) flush() {
+	r.Lock()
+	defer r.Unlock()
+	for group, po := range r.pending {
+		err := po.err
+		if err == nil {
+			err = fmt.Errorf("actions not executed")
+		}
+		r.emit(po.key, OutcomeFailed, err)
+		delete(r.pending, group)
+	}
+}
+
+// emit records the outcome of key, r must be locked
+func (r *outcomeRecorder) emit(key map[string]interface{}, o Outcome, err error) {
+	r.report.Totals[o]++
+	if r.opts.ReportKeys {
+		if len(r.report.Keys) < maxReportOutcomes {
+			b, _ := json.Marshal(key)
+			r.report.Keys[string(b)] = o
+		} else {
+			r.report.Truncated = true
+		}
+	}
+	if r.opts.Log == nil || r.logErr {
+		return
+	}
+	rec := OutcomeRecord{Number: r.number, Undo: r.undo, Key: key, Outcome: o}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	b, _ := json.Marshal(rec)
+	if _, err := r.opts.Log.Write(append(b, '\n')); err != nil {
+		r.logErr = true // best effort, like reports
+		r.dd.logf(VerbosityQuiet, "error writing outcomes of migration %v, no longer writing them: %v", r.number, err)
+	}
+}
+
+// summary returns the outcomes recorded so far
+func (r *outcomeRecorder) summary() *OutcomeReport {
+	r.Lock()
+	defer r.Unlock()
+	or := &OutcomeReport{Totals: map[Outcome]uint{}, Truncated: r.report.Truncated}
+	for o, n := range r.report.Totals {
+		or.Totals[o] = n
+	}
+	if r.opts.ReportKeys {
+		or.Keys = make(map[string]Outcome, len(r.report.Keys))
+		for k, o := range r.report.Keys {
+			or.Keys[k] = o
+		}
+	}
+	return or
+}
@@ -0,0 +1,95 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestOutcomeRecorder(t *testing.T) {
+	log := &bytes.Buffer{}
+	dd := &DynamoDrifter{Outcomes: &OutcomeOptions{ReportKeys: true, Log: log}}
+	r := outcomesFrom(dd.startOutcomes(context.Background(), &DynamoDrifterMigration{Number: 3}, false))
+	r.attrs = []string{"ID"}
+	item := func(id string) RawDynamoItem {
+		return RawDynamoItem{"ID": {S: aws.String(id)}, "Name": {S: aws.String("foo")}}
+	}
+	r.processed(1, item("migrated"), nil)
+	r.processed(2, item("conflicted"), nil)
+	r.processed(3, item("skipped"), nil)
+	r.processed(4, item("failed"), errors.New("callback error"))
+	r.processed(5, item("not executed"), nil)
+	r.skipped(item("filtered"), nil)
+	actions := []action{{group: 1}, {group: 2}, {group: 1}, {group: 2}, {group: 5}}
+	r.queued(actions)
+	r.applied(actions[:1], nil)
+	r.applied(actions[1:2], errConditionSkipped)
+	r.applied(actions[2:4], nil)
+	r.flush()
+	or := r.summary()
+	expected := map[string]Outcome{
+		`{"ID":{"S":"migrated"}}`:     OutcomeMigrated,
+		`{"ID":{"S":"conflicted"}}`:   OutcomeConflicted,
+		`{"ID":{"S":"skipped"}}`:      OutcomeSkipped,
+		`{"ID":{"S":"failed"}}`:       OutcomeFailed,
+		`{"ID":{"S":"not executed"}}`: OutcomeFailed,
+		`{"ID":{"S":"filtered"}}`:     OutcomeSkipped,
+	}
+	for k, o := range expected {
+		if or.Keys[k] != o {
+			t.Fatalf("bad outcome of %v: %v (expected %v)", k, or.Keys[k], o)
+		}
+	}
+	if or.Totals[OutcomeFailed] != 2 || or.Totals[OutcomeSkipped] != 2 || or.Truncated {
+		t.Fatalf("bad outcome report: %+v", or)
+	}
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("bad outcome log: %v", log.String())
+	}
+	rec := OutcomeRecord{}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil || rec.Number != 3 || rec.Outcome != OutcomeFailed || rec.Error != "callback error" {
+		t.Fatalf("bad outcome record: %+v, %v", rec, err)
+	}
+}
+
+func TestOutcomesOfActions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if r.Header.Get("X-Amz-Target") == "DynamoDB_20120810.UpdateItem" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), Outcomes: &OutcomeOptions{}}
+	m := &DynamoDrifterMigration{TableName: "foo"}
+	ctx := dd.startOutcomes(context.Background(), m, false)
+	r := outcomesFrom(ctx)
+	da := dd.newDrifterAction(m)
+	for _, id := range []string{"a", "b"} {
+		ida := da.forItem()
+		key := RawDynamoItem{"ID": {S: aws.String(id)}}
+		if id == "a" {
+			ida.UpdateItem(key, "").Set("Foo", "v").If("attribute_exists(ID)", nil).Queue()
+		} else {
+			ida.Insert(key, "")
+		}
+		r.processed(ida.group, key, nil)
+	}
+	if errs := dd.executeActions(ctx, m, da, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("errors executing actions: %v", errs)
+	}
+	if or := r.summary(); or.Totals[OutcomeConflicted] != 1 || or.Totals[OutcomeMigrated] != 1 || or.Keys != nil {
+		t.Fatalf("bad outcomes: %+v", or)
+	}
+}
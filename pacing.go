@@ -0,0 +1,266 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Table billing modes
+const (
+	BillingModeProvisioned   = "PROVISIONED"
+	BillingModePayPerRequest = "PAY_PER_REQUEST"
+)
+
+// Pacing configures pacing of the table reads (scan pages) and writes (actions) performed by drift so that they consume
+// roughly a target fraction of each table's provisioned throughput, leaving the rest for the application.
+// Consumption is measured using the ConsumedCapacity returned by DynamoDB for each request.
+// Tables using on-demand (PAY_PER_REQUEST) billing have no provisioned throughput and are never paced by TargetUtilization, throttling on those tables is still handled by the RetryPolicy.
+//
+// ReadUnits and WriteUnits cap the capacity consumed per second on each table regardless of its billing mode, so they also pace on-demand
+// tables. With TargetUtilization, the lower of both rates applies.
+type Pacing struct {
+	TargetUtilization float64 // Target fraction of provisioned capacity to consume (0 < TargetUtilization <= 1), ex: 0.25
+	ReadUnits         float64 // Read capacity units consumed per second on each table (optional), ex: 100
+	WriteUnits        float64 // Write capacity units consumed per second on each table (optional)
+}
+
+// tokenBucket is a capacity token bucket that refills at rate units per second, up to a burst of one second worth of units.
+// Units are debited after the fact (once the consumed capacity is known) so the balance may go negative, in which case callers wait until it recovers.
+type tokenBucket struct {
+	sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now().UTC(),
+	}
+}
+
+func (tb *tokenBucket) refill() {
+	now := time.Now().UTC()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.rate {
+		tb.tokens = tb.rate
+	}
+	tb.last = now
+}
+
+// wait blocks until the bucket has a positive balance
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	for {
+		tb.Lock()
+		tb.refill()
+		if tb.tokens > 0 {
+			tb.Unlock()
+			return nil
+		}
+		d := time.Duration((-tb.tokens/tb.rate)*float64(time.Second)) + time.Millisecond
+		tb.Unlock()
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// take debits units from the bucket
+func (tb *tokenBucket) take(units float64) {
+	tb.Lock()
+	tb.refill()
+	tb.tokens -= units
+	tb.Unlock()
+}
+
+// pacer holds the read and write token buckets for all tables touched during a run
+type pacer struct {
+	sync.Mutex
+	dd      *DynamoDrifter
+	target  float64
+	limits  [2]float64 // read and write units per second, 0 if unlimited
+	buckets map[string]*tokenBucket
+
+	describing map[string]*describeCall // tables being described to create their buckets
+}
+
+// describeCall is the description of a table in progress, shared by concurrent callers of pacer.bucket
+type describeCall struct {
+	done chan struct{}
+	err  error
+}
+
+func newPacer(dd *DynamoDrifter) *pacer {
+	if dd.Pacing == nil || dd.Pacing.TargetUtilization <= 0 && dd.Pacing.ReadUnits <= 0 && dd.Pacing.WriteUnits <= 0 {
+		return nil
+	}
+	return &pacer{
+		dd:         dd,
+		target:     max(dd.Pacing.TargetUtilization, 0),
+		limits:     [2]float64{max(dd.Pacing.ReadUnits, 0), max(dd.Pacing.WriteUnits, 0)},
+		buckets:    map[string]*tokenBucket{},
+		describing: map[string]*describeCall{},
+	}
+}
+
+func bucketKey(table string, write bool) string {
+	if write {
+		return table + "/write"
+	}
+	return table + "/read"
+}
+
+// bucket returns the token bucket for table, creating it from the table's provisioned throughput and the limits if necessary.
+// A nil bucket means the table is not paced. The table is described without holding the lock of p, concurrent callers of a table being
+// described wait for its description.
+func (p *pacer) bucket(ctx context.Context, table string, write bool) (*tokenBucket, error) {
+	for {
+		p.Lock()
+		if tb, ok := p.buckets[bucketKey(table, write)]; ok {
+			p.Unlock()
+			return tb, nil
+		}
+		if c, ok := p.describing[table]; ok {
+			p.Unlock()
+			select {
+			case <-c.done:
+				if c.err != nil {
+					return nil, c.err
+				}
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		c := &describeCall{done: make(chan struct{})}
+		p.describing[table] = c
+		p.Unlock()
+		c.err = p.newBuckets(ctx, table)
+		p.Lock()
+		delete(p.describing, table)
+		p.Unlock()
+		close(c.done)
+		if c.err != nil {
+			return nil, c.err
+		}
+	}
+}
+
+// newBuckets creates the read and write token buckets of table
+func (p *pacer) newBuckets(ctx context.Context, table string) error {
+	var rcu, wcu float64
+	if p.target > 0 {
+		td, mode, err := p.dd.describeTable(ctx, table)
+		if err != nil {
+			return err
+		}
+		if mode == BillingModeProvisioned && td.ProvisionedThroughput != nil {
+			rcu = float64(aws.Int64Value(td.ProvisionedThroughput.ReadCapacityUnits))
+			wcu = float64(aws.Int64Value(td.ProvisionedThroughput.WriteCapacityUnits))
+		}
+	}
+	p.Lock()
+	defer p.Unlock()
+	for _, b := range []struct {
+		write bool
+		units float64
+		limit float64
+	}{{false, rcu, p.limits[0]}, {true, wcu, p.limits[1]}} {
+		rate := b.units * p.target
+		if b.limit > 0 && (rate <= 0 || b.limit < rate) {
+			rate = b.limit
+		}
+		var tb *tokenBucket
+		if rate > 0 {
+			tb = newTokenBucket(rate)
+		}
+		p.buckets[bucketKey(table, b.write)] = tb
+	}
+	return nil
+}
+
+// wait blocks until a request against table is permitted
+func (p *pacer) wait(ctx context.Context, table string, write bool) error {
+	if p == nil {
+		return nil
+	}
+	tb, err := p.bucket(ctx, table, write)
+	if err != nil || tb == nil {
+		return err
+	}
+	return tb.wait(ctx)
+}
+
+// consumed records the capacity consumed by a request
+func (p *pacer) consumed(cc *dynamodb.ConsumedCapacity, write bool) {
+	if p == nil || cc == nil || cc.TableName == nil {
+		return
+	}
+	p.Lock()
+	tb := p.buckets[bucketKey(*cc.TableName, write)]
+	p.Unlock()
+	if tb != nil {
+		tb.take(aws.Float64Value(cc.CapacityUnits))
+	}
+}
+
+// returnConsumedCapacity returns the ReturnConsumedCapacity value to use for requests
+func (p *pacer) returnConsumedCapacity() *string {
+	if p == nil {
+		return nil
+	}
+	return aws.String(dynamodb.ReturnConsumedCapacityTotal)
+}
+
+// describeTable returns the description and billing mode of table.
+// The billing mode is read from the raw response since the vendored SDK predates BillingModeSummary. If absent the table is provisioned,
+// unless it reports zero provisioned throughput which only on-demand tables do.
+func (dd *DynamoDrifter) describeTable(ctx context.Context, table string) (*dynamodb.TableDescription, string, error) {
+	var raw struct {
+		Table struct {
+			BillingModeSummary struct {
+				BillingMode string
+			}
+		}
+	}
+	req, out := dd.DynamoDB.DescribeTableRequest(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	req.Handlers.Unmarshal.PushFront(func(r *request.Request) {
+		if r.HTTPResponse == nil || r.HTTPResponse.Body == nil {
+			return // not sent over HTTP (mock client)
+		}
+		b, err := ioutil.ReadAll(r.HTTPResponse.Body)
+		if err != nil {
+			return
+		}
+		r.HTTPResponse.Body = ioutil.NopCloser(bytes.NewReader(b))
+		json.Unmarshal(b, &raw)
+	})
+	if err := dd.send(ctx, req); err != nil {
+		return nil, "", fmt.Errorf("error describing table %v: %v", table, err)
+	}
+	if out.Table == nil {
+		return nil, "", fmt.Errorf("table %v: empty description", table)
+	}
+	mode := raw.Table.BillingModeSummary.BillingMode
+	if mode == "" {
+		mode = BillingModeProvisioned
+		pt := out.Table.ProvisionedThroughput
+		if pt == nil || (aws.Int64Value(pt.ReadCapacityUnits) == 0 && aws.Int64Value(pt.WriteCapacityUnits) == 0) {
+			mode = BillingModePayPerRequest
+		}
+	}
+	return out.Table, mode, nil
+}
@@ -0,0 +1,178 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tb := newTokenBucket(100)
+	if err := tb.wait(context.Background()); err != nil {
+		t.Fatalf("error waiting: %v", err)
+	}
+	// go 10 units into debt: at 100 units/sec that's ~100ms to recover
+	tb.take(110)
+	start := time.Now()
+	if err := tb.wait(context.Background()); err != nil {
+		t.Fatalf("error waiting: %v", err)
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Fatalf("bucket did not pace: %v", d)
+	}
+	tb.take(1000)
+	ctx, cncl := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cncl()
+	if err := tb.wait(ctx); err == nil {
+		t.Fatalf("expected context error")
+	}
+}
+
+func TestPacerConsumed(t *testing.T) {
+	p := newPacer(&DynamoDrifter{Pacing: &Pacing{TargetUtilization: 0.5}})
+	p.buckets[bucketKey("foo", true)] = newTokenBucket(10)
+	p.buckets[bucketKey("foo", false)] = nil
+	p.consumed(&dynamodb.ConsumedCapacity{TableName: aws.String("foo"), CapacityUnits: aws.Float64(15)}, true)
+	p.consumed(&dynamodb.ConsumedCapacity{TableName: aws.String("foo"), CapacityUnits: aws.Float64(15)}, false)
+	if tb := p.buckets[bucketKey("foo", true)]; tb.tokens > -4 {
+		t.Fatalf("consumption not recorded: %v", tb.tokens)
+	}
+	// unpaced reads never wait
+	if err := p.wait(context.Background(), "foo", false); err != nil {
+		t.Fatalf("error waiting: %v", err)
+	}
+	var np *pacer
+	if np.returnConsumedCapacity() != nil || np.wait(context.Background(), "foo", true) != nil {
+		t.Fatalf("nil pacer should be a noop")
+	}
+}
+
+func TestPacerLimits(t *testing.T) {
+	described := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		described++
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte(`{"Table":{"TableName":"foo","ProvisionedThroughput":{"ReadCapacityUnits":100,"WriteCapacityUnits":10}}}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	// limits alone pace tables without describing them
+	p := newPacer(&DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), Pacing: &Pacing{WriteUnits: 20}})
+	if tb, err := p.bucket(ctx, "foo", true); err != nil || tb == nil || tb.rate != 20 {
+		t.Fatalf("bad write bucket: %+v, %v", tb, err)
+	}
+	if tb, err := p.bucket(ctx, "foo", false); err != nil || tb != nil || described != 0 {
+		t.Fatalf("reads should not be paced: %+v, %v (%v described)", tb, err, described)
+	}
+	// the lower of the limit and the target utilization applies
+	p = newPacer(&DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), Pacing: &Pacing{TargetUtilization: 0.5, ReadUnits: 20, WriteUnits: 20}})
+	if tb, err := p.bucket(ctx, "foo", false); err != nil || tb.rate != 20 {
+		t.Fatalf("bad read bucket: %+v, %v", tb, err)
+	}
+	if tb, err := p.bucket(ctx, "foo", true); err != nil || tb.rate != 5 {
+		t.Fatalf("bad write bucket: %+v, %v", tb, err)
+	}
+	if newPacer(&DynamoDrifter{Pacing: &Pacing{}}) != nil {
+		t.Fatalf("pacing without target nor limits should be disabled")
+	}
+}
+
+func TestPacerDescribing(t *testing.T) {
+	var mtx sync.Mutex
+	described := map[string]int{}
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in := dynamodb.DescribeTableInput{}
+		json.NewDecoder(r.Body).Decode(&in)
+		mtx.Lock()
+		described[aws.StringValue(in.TableName)]++
+		mtx.Unlock()
+		if aws.StringValue(in.TableName) == "slow" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte(`{"Table":{"TableName":"foo","ProvisionedThroughput":{"ReadCapacityUnits":100,"WriteCapacityUnits":10}}}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	p := newPacer(&DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), Pacing: &Pacing{TargetUtilization: 0.5}})
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tb, err := p.bucket(ctx, "slow", i%2 == 0); err != nil || tb == nil {
+				t.Errorf("bad bucket of slow: %+v, %v", tb, err)
+			}
+		}()
+	}
+	// other tables are paced while slow is being described
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if tb, err := p.bucket(ctx, "foo", true); err != nil || tb.rate != 5 {
+			t.Errorf("bad bucket of foo: %+v, %v", tb, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("describing a table should not block the buckets of others")
+	}
+	close(release)
+	wg.Wait()
+	if described["slow"] != 1 || described["foo"] != 1 {
+		t.Fatalf("each table should be described once: %v", described)
+	}
+	cctx, cncl := context.WithCancel(ctx)
+	cncl()
+	if _, err := p.bucket(cctx, "gone", true); err == nil {
+		t.Fatalf("cancelled description should fail")
+	}
+	if tb, err := p.bucket(ctx, "gone", true); err != nil || tb == nil {
+		t.Fatalf("failed descriptions should not be cached: %+v, %v", tb, err)
+	}
+}
+
+func TestDescribeTableBillingMode(t *testing.T) {
+	responses := map[string]string{
+		"ondemand":    `{"Table":{"TableName":"ondemand","BillingModeSummary":{"BillingMode":"PAY_PER_REQUEST"},"ProvisionedThroughput":{"ReadCapacityUnits":0,"WriteCapacityUnits":0}}}`,
+		"legacy":      `{"Table":{"TableName":"legacy","ProvisionedThroughput":{"ReadCapacityUnits":0,"WriteCapacityUnits":0}}}`,
+		"provisioned": `{"Table":{"TableName":"provisioned","ProvisionedThroughput":{"ReadCapacityUnits":10,"WriteCapacityUnits":4}}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in := struct{ TableName string }{}
+		json.NewDecoder(r.Body).Decode(&in)
+		w.Write([]byte(responses[in.TableName]))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{
+		DynamoDB: getTestHTTPDDBClient(srv.URL),
+		Pacing:   &Pacing{TargetUtilization: 0.5},
+	}
+	for table, mode := range map[string]string{"ondemand": BillingModePayPerRequest, "legacy": BillingModePayPerRequest, "provisioned": BillingModeProvisioned} {
+		_, m, err := dd.describeTable(context.Background(), table)
+		if err != nil {
+			t.Fatalf("error describing table: %v", err)
+		}
+		if m != mode {
+			t.Fatalf("bad billing mode for %v: %v", table, m)
+		}
+	}
+	p := newPacer(dd)
+	tb, err := p.bucket(context.Background(), "ondemand", true)
+	if err != nil || tb != nil {
+		t.Fatalf("on-demand table should not be paced: %v, %v", tb, err)
+	}
+	tb, err = p.bucket(context.Background(), "provisioned", true)
+	if err != nil || tb == nil || tb.rate != 2 {
+		t.Fatalf("bad bucket for provisioned table: %v, %v", tb, err)
+	}
+}
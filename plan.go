@@ -0,0 +1,462 @@
+package drift
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	defaultPlanSampleSize = 10 // default number of items previewed by a plan
+	maxPlanExpressions    = 5  // number of most frequent update expressions of a plan
+)
+
+// PlanOptions are the options of DynamoDrifter.Plan
+type PlanOptions struct {
+	Concurrency uint // See DynamoDrifter.Run
+	SampleSize  uint // Number of scanned items whose state after the actions is previewed (optional, defaults to 10)
+	Operations  bool // Record every queued action in Plan.Operations, for reviews of the exact writes of a migration (plans may get large)
+}
+
+// Plan is the result of a dry run of a migration: the table is scanned and the callbacks executed, but the actions they queue aren't.
+// Plans are encoded in JSON as documented by ReportVersion.
+type Plan struct {
+	Number       uint                    `json:"number"`
+	TableName    string                  `json:"tablename"`
+	Description  string                  `json:"description"`
+	ItemsScanned uint                    `json:"items_scanned"` // Items processed by callbacks
+	Actions      map[string]ActionCounts `json:"actions"`       // Queued actions by table
+	Expressions  []PlanExpression        `json:"expressions"`   // Most frequent update expressions, by descending count
+	Guardrails   []GuardrailCheck        `json:"guardrails"`    // Evaluation of the guardrails of the migration (see Guardrails)
+	Diffs        []ItemDiff              `json:"diffs"`         // State of sampled items before and after the actions
+	Operations   []PlannedAction         `json:"operations"`    // Queued actions in queue order (see PlanOptions.Operations)
+	Errors       []error                 `json:"-"`             // Errors of callbacks
+}
+
+// PlannedAction is an action queued by the callbacks of a planned migration, which a run would execute
+type PlannedAction struct {
+	Type                      string             `json:"type"` // "update", "insert", "delete" or "condition check"
+	TableName                 string             `json:"tablename"`
+	Key                       RawDynamoItem      `json:"-"` // Updates and deletes
+	Item                      RawDynamoItem      `json:"-"` // Inserts
+	UpdateExpression          string             `json:"update_expression,omitempty"`
+	ConditionExpression       string             `json:"condition_expression,omitempty"` // Updates are skipped if it fails
+	NoOverwrite               bool               `json:"no_overwrite,omitempty"`         // Inserts fail if the item exists (see SafeMode)
+	ExpressionAttributeNames  map[string]*string `json:"expression_attribute_names,omitempty"`
+	ExpressionAttributeValues RawDynamoItem      `json:"-"`
+}
+
+// String renders the action in human readable form, ex: update users {ID: 1}: SET #n = :n
+func (pa PlannedAction) String() string {
+	var s string
+	switch pa.Type {
+	case "insert":
+		s = fmt.Sprintf("insert %v %v", pa.TableName, formatItem(pa.Item))
+	case "update":
+		s = fmt.Sprintf("update %v %v: %v", pa.TableName, formatItem(pa.Key), pa.UpdateExpression)
+	default:
+		s = fmt.Sprintf("%v %v %v", pa.Type, pa.TableName, formatItem(pa.Key))
+	}
+	if pa.ConditionExpression != "" {
+		s += " if " + pa.ConditionExpression
+	}
+	if len(pa.ExpressionAttributeValues) > 0 {
+		s += " with " + formatItem(pa.ExpressionAttributeValues)
+	}
+	return s
+}
+
+// plannedActions returns the PlannedActions of actions, actions without a table being on table
+func plannedActions(actions []action, table string) []PlannedAction {
+	pas := make([]PlannedAction, len(actions))
+	for i, a := range actions {
+		pa := PlannedAction{TableName: a.tableName}
+		if pa.TableName == "" {
+			pa.TableName = table
+		}
+		switch a.atype {
+		case updateAction:
+			pa.Type, pa.Key, pa.UpdateExpression, pa.ConditionExpression = "update", a.keys, a.updExpr, a.condExpr
+			pa.ExpressionAttributeNames, pa.ExpressionAttributeValues = a.expAttrNames, a.values
+		case insertAction:
+			pa.Type, pa.Item, pa.NoOverwrite, pa.ConditionExpression = "insert", a.item, a.noOverwrite, a.condExpr
+			pa.ExpressionAttributeNames, pa.ExpressionAttributeValues = a.expAttrNames, a.values
+		case deleteAction:
+			pa.Type, pa.Key, pa.ConditionExpression = "delete", a.keys, a.condExpr
+			pa.ExpressionAttributeNames, pa.ExpressionAttributeValues = a.expAttrNames, a.values
+		case conditionCheckAction:
+			pa.Type, pa.Key, pa.ConditionExpression = "condition check", a.keys, a.condExpr
+			pa.ExpressionAttributeNames, pa.ExpressionAttributeValues = a.expAttrNames, a.values
+		}
+		pas[i] = pa
+	}
+	return pas
+}
+
+// PlanExpression is an update expression queued by a migration
+type PlanExpression struct {
+	TableName  string `json:"tablename"`
+	Expression string `json:"expression"`
+	Count      uint   `json:"count"` // Number of updates with the expression
+}
+
+// topExpressions returns the n most frequent update expressions of actions, actions without a table being counted for table
+func topExpressions(actions []action, table string, n int) []PlanExpression {
+	counts := map[PlanExpression]uint{}
+	for _, a := range actions {
+		if a.atype != updateAction {
+			continue
+		}
+		pe := PlanExpression{TableName: a.tableName, Expression: a.updExpr}
+		if pe.TableName == "" {
+			pe.TableName = table
+		}
+		counts[pe]++
+	}
+	pes := make([]PlanExpression, 0, len(counts))
+	for pe, c := range counts {
+		pe.Count = c
+		pes = append(pes, pe)
+	}
+	sort.Slice(pes, func(i, j int) bool {
+		if pes[i].Count != pes[j].Count {
+			return pes[i].Count > pes[j].Count
+		}
+		if pes[i].TableName != pes[j].TableName {
+			return pes[i].TableName < pes[j].TableName
+		}
+		return pes[i].Expression < pes[j].Expression
+	})
+	return pes[:min(n, len(pes))]
+}
+
+// String renders the plan in human readable form, suitable for change reviews: a summary table of the actions by table, the most
+// frequent update expressions, the evaluation of guardrails, callback errors, the diffs of sampled items and the recorded actions.
+func (p *Plan) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "plan of migration %v on table %v", p.Number, p.TableName)
+	if p.Description != "" {
+		fmt.Fprintf(b, " (%v)", p.Description)
+	}
+	fmt.Fprintf(b, ": %v items scanned\n\n", p.ItemsScanned)
+	tables := make([]string, 0, len(p.Actions))
+	var total ActionCounts
+	for tn, ac := range p.Actions {
+		tables = append(tables, tn)
+		total.Updates += ac.Updates
+		total.Inserts += ac.Inserts
+		total.Deletes += ac.Deletes
+	}
+	sort.Strings(tables)
+	w := tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "table\tupdates\tinserts\tdeletes\n")
+	for _, tn := range tables {
+		ac := p.Actions[tn]
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", tn, ac.Updates, ac.Inserts, ac.Deletes)
+	}
+	fmt.Fprintf(w, "total\t%v\t%v\t%v\n", total.Updates, total.Inserts, total.Deletes)
+	w.Flush()
+	if len(p.Expressions) > 0 {
+		b.WriteString("\nupdate expressions\n")
+		w = tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+		for _, pe := range p.Expressions {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", pe.Count, pe.TableName, pe.Expression)
+		}
+		w.Flush()
+	}
+	if len(p.Guardrails) > 0 {
+		b.WriteString("\nguardrails\n")
+		w = tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+		for _, gc := range p.Guardrails {
+			status := "ok"
+			if gc.Exceeded {
+				status = "EXCEEDED"
+			}
+			fmt.Fprintf(w, "%v\tlimit %v\tvalue %v\t%v\n", gc.Name, formatNumber(gc.Limit), formatNumber(gc.Value), status)
+		}
+		w.Flush()
+	}
+	if len(p.Errors) > 0 {
+		fmt.Fprintf(b, "\n%v callback errors, first: %v\n", len(p.Errors), p.Errors[0])
+	}
+	if len(p.Diffs) > 0 {
+		b.WriteString("\nsampled items\n")
+		for _, d := range p.Diffs {
+			b.WriteString(d.String())
+		}
+	}
+	if len(p.Operations) > 0 {
+		b.WriteString("\nactions\n")
+		for _, pa := range p.Operations {
+			b.WriteString(pa.String() + "\n")
+		}
+	}
+	return b.String()
+}
+
+// formatNumber formats integers as such and other numbers with two decimals
+func formatNumber(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// AttributeChange is a change of a top-level attribute of an item (Before is nil for added attributes, After for removed ones)
+type AttributeChange struct {
+	Attribute string
+	Before    *dynamodb.AttributeValue
+	After     *dynamodb.AttributeValue
+}
+
+// ItemDiff is the state of an item of the migration table before and after the actions queued for it (on the migration table)
+type ItemDiff struct {
+	Key         RawDynamoItem
+	Before      RawDynamoItem
+	After       RawDynamoItem // nil if the item is deleted
+	Changes     []AttributeChange
+	Conditional bool   // Some actions are conditional: After assumes their conditions pass
+	Error       string // Why After couldn't be computed (ex: unsupported update expression)
+}
+
+// String renders the diff in human readable form: the key, then one line per changed attribute
+func (d ItemDiff) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "item %v", formatItem(d.Key))
+	switch {
+	case d.Error != "":
+		fmt.Fprintf(b, ": can't preview: %v\n", d.Error)
+		return b.String()
+	case d.After == nil:
+		b.WriteString(": deleted")
+	case len(d.Changes) == 0:
+		b.WriteString(": unchanged")
+	}
+	if d.Conditional {
+		b.WriteString(" (if conditions pass)")
+	}
+	b.WriteString("\n")
+	for _, c := range d.Changes {
+		switch {
+		case d.After == nil:
+		case c.Before == nil:
+			fmt.Fprintf(b, "  + %v: %v\n", c.Attribute, formatAttributeValue(c.After))
+		case c.After == nil:
+			fmt.Fprintf(b, "  - %v: %v\n", c.Attribute, formatAttributeValue(c.Before))
+		default:
+			fmt.Fprintf(b, "  ~ %v: %v -> %v\n", c.Attribute, formatAttributeValue(c.Before), formatAttributeValue(c.After))
+		}
+	}
+	return b.String()
+}
+
+// formatItem formats an item as {attr: value, ...} with sorted attributes
+func formatItem(item map[string]*dynamodb.AttributeValue) string {
+	keys := make([]string, 0, len(item))
+	for k := range item {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + ": " + formatAttributeValue(item[k])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// formatAttributeValue formats an attribute value concisely: strings quoted, binaries in base64, sets in <<>>
+func formatAttributeValue(av *dynamodb.AttributeValue) string {
+	switch {
+	case av == nil:
+		return "<none>"
+	case av.S != nil:
+		return strconv.Quote(*av.S)
+	case av.N != nil:
+		return *av.N
+	case av.B != nil:
+		return base64.StdEncoding.EncodeToString(av.B)
+	case av.BOOL != nil:
+		return strconv.FormatBool(*av.BOOL)
+	case av.NULL != nil:
+		return "null"
+	case av.M != nil:
+		return formatItem(av.M)
+	case av.L != nil:
+		parts := make([]string, len(av.L))
+		for i, v := range av.L {
+			parts[i] = formatAttributeValue(v)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case av.SS != nil:
+		parts := make([]string, len(av.SS))
+		for i, s := range av.SS {
+			parts[i] = strconv.Quote(aws.StringValue(s))
+		}
+		return "<<" + strings.Join(parts, ", ") + ">>"
+	case av.NS != nil:
+		return "<<" + strings.Join(aws.StringValueSlice(av.NS), ", ") + ">>"
+	case av.BS != nil:
+		parts := make([]string, len(av.BS))
+		for i, b := range av.BS {
+			parts[i] = base64.StdEncoding.EncodeToString(b)
+		}
+		return "<<" + strings.Join(parts, ", ") + ">>"
+	}
+	return "{}"
+}
+
+// equalAttributeValues returns whether a and b are the same value
+func equalAttributeValues(a, b *dynamodb.AttributeValue) bool {
+	return formatAttributeValue(a) == formatAttributeValue(b) && (a == nil) == (b == nil)
+}
+
+// diffItems returns the changes of the top-level attributes of before into after, sorted by attribute
+func diffItems(before, after RawDynamoItem) []AttributeChange {
+	changes := []AttributeChange{}
+	for k, v := range before {
+		if w := after[k]; !equalAttributeValues(v, w) {
+			changes = append(changes, AttributeChange{Attribute: k, Before: v, After: w})
+		}
+	}
+	for k, w := range after {
+		if _, ok := before[k]; !ok {
+			changes = append(changes, AttributeChange{Attribute: k, After: w})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Attribute < changes[j].Attribute })
+	return changes
+}
+
+// previewItem applies the actions queued for item (those on table with its key) to a copy of it, in queue order
+func previewItem(item RawDynamoItem, keyAttrs []string, table string, actions []action) ItemDiff {
+	key := RawDynamoItem{}
+	for _, k := range keyAttrs {
+		key[k] = item[k]
+	}
+	ks := keyString(key)
+	d := ItemDiff{Key: key, Before: item, After: item.Clone()}
+	for _, a := range actions {
+		if a.tableName != "" && a.tableName != table {
+			continue
+		}
+		switch a.atype {
+		case updateAction:
+			if keyString(a.keys) != ks {
+				continue
+			}
+			after, err := ApplyUpdate(d.After, a.updExpr, a.expAttrNames, a.values)
+			if err != nil {
+				d.Error = fmt.Sprintf("update %q: %v", a.updExpr, err)
+				d.After = nil
+				return d
+			}
+			d.After = after
+			d.Conditional = d.Conditional || a.condExpr != ""
+		case insertAction:
+			ikey := RawDynamoItem{}
+			for _, k := range keyAttrs {
+				ikey[k] = a.item[k]
+			}
+			if keyString(ikey) != ks {
+				continue
+			}
+			d.After = RawDynamoItem(a.item).Clone()
+			d.Conditional = d.Conditional || a.noOverwrite || a.condExpr != ""
+		case deleteAction:
+			if keyString(a.keys) != ks {
+				continue
+			}
+			d.After = nil
+			d.Conditional = d.Conditional || a.condExpr != ""
+		}
+	}
+	d.Changes = diffItems(d.Before, d.After)
+	return d
+}
+
+// Plan performs a dry run of migration: the table is scanned and the callbacks executed, but the actions they queue are only counted
+// (and evaluated against the guardrails of the migration), and applied locally to a sample of items to preview their state after the
+// migration. Every queued action is recorded if opts.Operations is set. Nothing is written. Multi-step migrations can't be planned.
+// Undo migrations are planned like any migration.
+func (dd *DynamoDrifter) Plan(ctx context.Context, migration *DynamoDrifterMigration, opts PlanOptions) (*Plan, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	if migration != nil && len(migration.Steps) > 0 {
+		return nil, fmt.Errorf("multi-step migrations can't be planned")
+	}
+	if err := validateMigration(migration); err != nil {
+		return nil, err
+	}
+	td, _, err := dd.describeTable(ctx, migration.TableName)
+	if err != nil {
+		return nil, err
+	}
+	keyAttrs := []string{}
+	for _, kse := range td.KeySchema {
+		keyAttrs = append(keyAttrs, aws.StringValue(kse.AttributeName))
+	}
+	sampleSize := opts.SampleSize
+	if sampleSize == 0 {
+		sampleSize = defaultPlanSampleSize
+	}
+	var mtx sync.Mutex
+	samples := []RawDynamoItem{}
+	sample := func(items ...RawDynamoItem) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, item := range items {
+			if uint(len(samples)) < sampleSize {
+				samples = append(samples, item.Clone()) // before callbacks may mutate it
+			}
+		}
+	}
+	m := *migration
+	if m.BatchCallback != nil {
+		m.BatchCallback = func(items []RawDynamoItem, action *DrifterAction) error {
+			sample(items...)
+			return migration.BatchCallback(items, action)
+		}
+	} else {
+		m.Callback = func(item RawDynamoItem, action *DrifterAction) error {
+			sample(item)
+			return migration.Callback(item, action)
+		}
+	}
+	concurrency := opts.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	da, errs := dd.runCallbacks(ctx, &m, concurrency, m.scanLimit(concurrency), false, nil, nil)
+	if da == nil {
+		return nil, errors.Join(errs...)
+	}
+	actions := da.aq.actions()
+	plan := &Plan{
+		Number:       migration.Number,
+		TableName:    migration.TableName,
+		Description:  migration.Description,
+		ItemsScanned: da.scanned,
+		Actions:      countActions(actions, migration.TableName),
+		Expressions:  topExpressions(actions, migration.TableName, maxPlanExpressions),
+		Errors:       errs,
+	}
+	if opts.Operations {
+		plan.Operations = plannedActions(actions, migration.TableName)
+	}
+	plan.Guardrails = dd.guardrails(migration).Evaluate(migration.TableName, da.scanned, plan.Actions)
+	for _, item := range samples {
+		plan.Diffs = append(plan.Diffs, previewItem(item, keyAttrs, migration.TableName, actions))
+	}
+	return plan, nil
+}
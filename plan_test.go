@@ -0,0 +1,131 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestPreviewItem(t *testing.T) {
+	id := func(n string) RawDynamoItem { return RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String(n)}} }
+	item := RawDynamoItem{"ID": id("1")["ID"], "Name": &dynamodb.AttributeValue{S: aws.String("a")}, "Old": &dynamodb.AttributeValue{BOOL: aws.Bool(true)}}
+	actions := []action{
+		{atype: updateAction, keys: id("1"), updExpr: "SET #n = :n REMOVE Old", expAttrNames: map[string]*string{"#n": aws.String("Name")},
+			values: RawDynamoItem{":n": &dynamodb.AttributeValue{S: aws.String("b")}}},
+		{atype: updateAction, keys: id("2"), updExpr: "REMOVE Name"},
+		{atype: deleteAction, keys: id("1"), tableName: "other"},
+		{atype: updateAction, keys: id("1"), updExpr: "SET Tags = :t", condExpr: "attribute_exists(ID)",
+			values: RawDynamoItem{":t": &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"1", "2"})}}},
+	}
+	d := previewItem(item, []string{"ID"}, "users", actions)
+	if d.Error != "" || len(d.Changes) != 3 || !d.Conditional {
+		t.Fatalf("bad diff: %+v", d)
+	}
+	expected := "item {ID: 1} (if conditions pass)\n  ~ Name: \"a\" -> \"b\"\n  - Old: true\n  + Tags: <<1, 2>>\n"
+	if s := d.String(); s != expected {
+		t.Fatalf("bad rendering:\n%v", s)
+	}
+	if *item["Name"].S != "a" {
+		t.Fatalf("item should not be modified")
+	}
+
+	d = previewItem(item, []string{"ID"}, "users", append(actions, action{atype: deleteAction, keys: id("1")}))
+	if d.After != nil || d.String() != "item {ID: 1}: deleted (if conditions pass)\n" {
+		t.Fatalf("bad diff: %v", d)
+	}
+	d = previewItem(item, []string{"ID"}, "users", []action{{atype: insertAction, item: RawDynamoItem{"ID": id("1")["ID"]}, tableName: "users"}})
+	if len(d.Changes) != 2 || d.Conditional {
+		t.Fatalf("bad diff: %v", d)
+	}
+	d = previewItem(item, []string{"ID"}, "users", []action{{atype: updateAction, keys: id("1"), updExpr: "SET a = size(b)"}})
+	if d.Error == "" || d.String() != "item {ID: 1}: can't preview: update \"SET a = size(b)\": unsupported function size\n" {
+		t.Fatalf("bad diff: %v", d)
+	}
+	if d := previewItem(item, []string{"ID"}, "users", nil); d.String() != "item {ID: 1}: unchanged\n" {
+		t.Fatalf("bad diff: %v", d)
+	}
+}
+
+func TestFormatAttributeValue(t *testing.T) {
+	av := &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+		"b": {L: []*dynamodb.AttributeValue{{NULL: aws.Bool(true)}, {B: []byte("hi")}}},
+		"a": {SS: aws.StringSlice([]string{"x"})},
+	}}
+	if s := formatAttributeValue(av); s != `{a: <<"x">>, b: [null, aGk=]}` {
+		t.Fatalf("bad rendering: %v", s)
+	}
+}
+
+func TestTopExpressions(t *testing.T) {
+	actions := []action{
+		{atype: updateAction, updExpr: "SET a = :a"},
+		{atype: updateAction, updExpr: "SET b = :b"},
+		{atype: updateAction, updExpr: "SET b = :b"},
+		{atype: updateAction, updExpr: "SET b = :b", tableName: "other"},
+		{atype: deleteAction},
+	}
+	pes := topExpressions(actions, "users", 2)
+	if len(pes) != 2 || pes[0] != (PlanExpression{"users", "SET b = :b", 2}) || pes[1] != (PlanExpression{"other", "SET b = :b", 1}) {
+		t.Fatalf("bad expressions: %+v", pes)
+	}
+}
+
+func TestPlannedActions(t *testing.T) {
+	key := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	pas := plannedActions([]action{
+		{atype: insertAction, item: key, noOverwrite: true, tableName: "other"},
+		{atype: updateAction, keys: key, updExpr: "SET a = :a", condExpr: "attribute_exists(ID)",
+			values: RawDynamoItem{":a": &dynamodb.AttributeValue{S: aws.String("x")}}},
+		{atype: deleteAction, keys: key},
+	}, "users")
+	expected := []string{
+		"insert other {ID: 1}",
+		`update users {ID: 1}: SET a = :a if attribute_exists(ID) with {:a: "x"}`,
+		"delete users {ID: 1}",
+	}
+	if len(pas) != len(expected) || !pas[0].NoOverwrite {
+		t.Fatalf("bad planned actions: %+v", pas)
+	}
+	for i, pa := range pas {
+		if pa.String() != expected[i] {
+			t.Fatalf("bad planned action: %v (expected %v)", pa, expected[i])
+		}
+	}
+}
+
+func TestPlanString(t *testing.T) {
+	p := &Plan{
+		Number:       3,
+		TableName:    "users",
+		Description:  "Add status",
+		ItemsScanned: 3,
+		Actions:      map[string]ActionCounts{"users": {Updates: 3}, "archive": {Inserts: 1, Deletes: 2}},
+		Expressions:  []PlanExpression{{"users", "SET #Status = :v0", 3}},
+		Guardrails: []GuardrailCheck{
+			{Name: "MaxWrites", Limit: 10, Value: 6},
+			{Name: "MaxDeletePercent", Limit: 50, Value: 200.0 / 3, Exceeded: true},
+		},
+		Diffs: []ItemDiff{{Key: RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}, After: RawDynamoItem{}}},
+	}
+	expected := `plan of migration 3 on table users (Add status): 3 items scanned
+
+table    updates  inserts  deletes
+archive  0        1        2
+users    3        0        0
+total    3        1        2
+
+update expressions
+3  users  SET #Status = :v0
+
+guardrails
+MaxWrites         limit 10  value 6      ok
+MaxDeletePercent  limit 50  value 66.67  EXCEEDED
+
+sampled items
+item {ID: 1}: unchanged
+`
+	if s := p.String(); s != expected {
+		t.Fatalf("bad rendering:\n%v", s)
+	}
+}
@@ -0,0 +1,162 @@
+package drift
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PolicyVersion is the version of the IAM policy language of generated policies
+const PolicyVersion = "2012-10-17"
+
+// PolicyOptions scope the resources of policies generated by DynamoDrifter.Policy
+type PolicyOptions struct {
+	Region     string // Region of the tables (optional, defaults to any region)
+	AccountID  string // AWS account of the tables (optional, defaults to any account)
+	Init       bool   // Allow creating the meta and progress tables (see Init)
+	Rehearsals bool   // Allow rehearsing the migrations (see Rehearse)
+}
+
+// PolicyStatement is a statement of an IAM policy
+type PolicyStatement struct {
+	Sid      string   `json:"Sid"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource []string `json:"Resource"`
+}
+
+// Policy is an IAM policy document, which can be encoded with encoding/json
+type Policy struct {
+	Version   string            `json:"Version"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// policyActions is a set of IAM actions
+type policyActions map[string]bool
+
+func (pa policyActions) add(actions ...string) {
+	for _, a := range actions {
+		pa[a] = true
+	}
+}
+
+func (pa policyActions) sorted() []string {
+	out := make([]string, 0, len(pa))
+	for a := range pa {
+		out = append(out, a)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// statementID returns an IAM statement ID (alphanumeric) made of prefix and the alphanumeric characters of name
+func statementID(prefix, name string) string {
+	b := &strings.Builder{}
+	b.WriteString(prefix)
+	for _, c := range name {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Policy generates the minimal IAM policy allowing the drifter to run the migrations of r (and undo migrations with the same tables):
+// reading and writing the meta, progress and archive tables, scanning and writing the migration tables and writing the tables migrations declare
+// writing (see DynamoDrifterMigration.WritesTables). Deletes are only allowed if a migration of the table may delete items, which it may
+// unless the drifter is in SafeMode and the migration doesn't set AllowsDeletes. Writing the objects of ArchiveS3 and
+// S3ReportSinks is allowed.
+// Tables read by callbacks and tables used by steps running functions aren't known to drift, and must be added to the policy.
+func (dd *DynamoDrifter) Policy(r *Registry, opts PolicyOptions) *Policy {
+	region, account := opts.Region, opts.AccountID
+	if region == "" {
+		region = "*"
+	}
+	if account == "" {
+		account = "*"
+	}
+	arn := func(table string) string {
+		return fmt.Sprintf("arn:aws:dynamodb:%v:%v:table/%v", region, account, table)
+	}
+	p := &Policy{Version: PolicyVersion}
+	statement := func(sid string, actions policyActions, resources ...string) {
+		sort.Strings(resources)
+		p.Statement = append(p.Statement, PolicyStatement{Sid: sid, Effect: "Allow", Action: actions.sorted(), Resource: resources})
+	}
+	statement("DriftListTables", policyActions{"dynamodb:ListTables": true}, "*")
+	meta := policyActions{}
+	meta.add("dynamodb:DescribeTable", "dynamodb:GetItem", "dynamodb:PutItem", "dynamodb:UpdateItem", "dynamodb:DeleteItem", "dynamodb:Scan")
+	if opts.Init {
+		meta.add("dynamodb:CreateTable")
+	}
+	statement("DriftMetaTable", meta, arn(dd.MetaTableName))
+	if dd.ProgressTable != "" {
+		progress := policyActions{}
+		progress.add("dynamodb:DescribeTable", "dynamodb:GetItem", "dynamodb:PutItem")
+		if opts.Init {
+			progress.add("dynamodb:CreateTable")
+		}
+		statement("DriftProgressTable", progress, arn(dd.ProgressTable))
+	}
+	if dd.ArchiveTable != "" {
+		archive := policyActions{}
+		archive.add("dynamodb:PutItem")
+		if opts.Init {
+			archive.add("dynamodb:CreateTable")
+		}
+		statement("DriftArchiveTable", archive, arn(dd.ArchiveTable))
+	}
+	tables := map[string]policyActions{}
+	write := func(table string, m *DynamoDrifterMigration) policyActions {
+		if tables[table] == nil {
+			tables[table] = policyActions{}
+		}
+		tables[table].add("dynamodb:DescribeTable", "dynamodb:PutItem", "dynamodb:UpdateItem")
+		if !dd.SafeMode || m.AllowsDeletes {
+			tables[table].add("dynamodb:DeleteItem")
+		}
+		return tables[table]
+	}
+	rehearsed := map[string]bool{}
+	for _, m := range r.Migrations() {
+		write(m.TableName, m).add("dynamodb:Scan")
+		for _, tn := range m.WritesTables {
+			write(tn, m)
+		}
+		if opts.Rehearsals {
+			tables[m.TableName].add("dynamodb:DescribeTimeToLive")
+			rehearsed[m.TableName] = true
+		}
+	}
+	names := make([]string, 0, len(tables))
+	for tn := range tables {
+		names = append(names, tn)
+	}
+	sort.Strings(names)
+	for _, tn := range names {
+		statement(statementID("DriftTable", tn), tables[tn], arn(tn))
+	}
+	if len(rehearsed) != 0 {
+		clones := []string{}
+		for tn := range rehearsed {
+			clones = append(clones, arn(tn+"-rehearsal-*"))
+		}
+		rehearsal := policyActions{}
+		rehearsal.add("dynamodb:CreateTable", "dynamodb:DeleteTable", "dynamodb:DescribeTable", "dynamodb:DescribeTimeToLive",
+			"dynamodb:UpdateTimeToLive", "dynamodb:BatchWriteItem", "dynamodb:Scan", "dynamodb:PutItem", "dynamodb:UpdateItem", "dynamodb:DeleteItem")
+		statement("DriftRehearsals", rehearsal, clones...)
+	}
+	if dd.ArchiveS3 != nil && dd.ArchiveTable == "" {
+		statement("DriftArchive", policyActions{"s3:PutObject": true}, fmt.Sprintf("arn:aws:s3:::%v/%v*", dd.ArchiveS3.Bucket, dd.ArchiveS3.Prefix))
+	}
+	objects := []string{}
+	for _, rs := range dd.ReportSinks {
+		if ss, ok := rs.(*S3ReportSink); ok {
+			objects = append(objects, fmt.Sprintf("arn:aws:s3:::%v/%v*", ss.Bucket, ss.Prefix))
+		}
+	}
+	if len(objects) != 0 {
+		statement("DriftReports", policyActions{"s3:PutObject": true}, objects...)
+	}
+	return p
+}
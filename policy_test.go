@@ -0,0 +1,73 @@
+package drift
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	r := &Registry{}
+	err := r.Register(
+		&DynamoDrifterMigration{Number: 1, TableName: "users", Callback: testMigrateUp, WritesTables: []string{"audit-log"}},
+		&DynamoDrifterMigration{Number: 2, TableName: "users", Callback: testMigrateUp, AllowsDeletes: true},
+	)
+	if err != nil {
+		t.Fatalf("error registering migrations: %v", err)
+	}
+	dd := &DynamoDrifter{
+		MetaTableName: "migrations",
+		SafeMode:      true,
+		ReportSinks:   []ReportSink{&FileReportSink{Dir: "reports"}, &S3ReportSink{Bucket: "bucket", Prefix: "drift/"}},
+	}
+	p := dd.Policy(r, PolicyOptions{Region: "us-west-2", AccountID: "123", Rehearsals: true})
+	statements := map[string]PolicyStatement{}
+	for _, s := range p.Statement {
+		statements[s.Sid] = s
+	}
+	expected := map[string]PolicyStatement{
+		"DriftListTables": {"DriftListTables", "Allow", []string{"dynamodb:ListTables"}, []string{"*"}},
+		"DriftMetaTable": {"DriftMetaTable", "Allow", []string{"dynamodb:DeleteItem", "dynamodb:DescribeTable", "dynamodb:GetItem", "dynamodb:PutItem",
+			"dynamodb:Scan", "dynamodb:UpdateItem"}, []string{"arn:aws:dynamodb:us-west-2:123:table/migrations"}},
+		"DriftTableauditlog": {"DriftTableauditlog", "Allow", []string{"dynamodb:DescribeTable", "dynamodb:PutItem", "dynamodb:UpdateItem"},
+			[]string{"arn:aws:dynamodb:us-west-2:123:table/audit-log"}},
+		"DriftTableusers": {"DriftTableusers", "Allow", []string{"dynamodb:DeleteItem", "dynamodb:DescribeTable", "dynamodb:DescribeTimeToLive",
+			"dynamodb:PutItem", "dynamodb:Scan", "dynamodb:UpdateItem"}, []string{"arn:aws:dynamodb:us-west-2:123:table/users"}},
+		"DriftRehearsals": {"DriftRehearsals", "Allow", []string{"dynamodb:BatchWriteItem", "dynamodb:CreateTable", "dynamodb:DeleteItem",
+			"dynamodb:DeleteTable", "dynamodb:DescribeTable", "dynamodb:DescribeTimeToLive", "dynamodb:PutItem", "dynamodb:Scan", "dynamodb:UpdateItem",
+			"dynamodb:UpdateTimeToLive"}, []string{"arn:aws:dynamodb:us-west-2:123:table/users-rehearsal-*"}},
+		"DriftReports": {"DriftReports", "Allow", []string{"s3:PutObject"}, []string{"arn:aws:s3:::bucket/drift/*"}},
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Fatalf("bad policy: %+v", p)
+	}
+	dd = &DynamoDrifter{MetaTableName: "migrations", ProgressTable: "progress"}
+	p = dd.Policy(&Registry{}, PolicyOptions{Init: true})
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("error marshaling policy: %v", err)
+	}
+	expectedJSON := `{"Version":"2012-10-17","Statement":[` +
+		`{"Sid":"DriftListTables","Effect":"Allow","Action":["dynamodb:ListTables"],"Resource":["*"]},` +
+		`{"Sid":"DriftMetaTable","Effect":"Allow","Action":["dynamodb:CreateTable","dynamodb:DeleteItem","dynamodb:DescribeTable","dynamodb:GetItem",` +
+		`"dynamodb:PutItem","dynamodb:Scan","dynamodb:UpdateItem"],"Resource":["arn:aws:dynamodb:*:*:table/migrations"]},` +
+		`{"Sid":"DriftProgressTable","Effect":"Allow","Action":["dynamodb:CreateTable","dynamodb:DescribeTable","dynamodb:GetItem","dynamodb:PutItem"],` +
+		`"Resource":["arn:aws:dynamodb:*:*:table/progress"]}]}`
+	if string(b) != expectedJSON {
+		t.Fatalf("bad policy JSON: %s", b)
+	}
+	dd = &DynamoDrifter{MetaTableName: "migrations", ArchiveTable: "archive", ArchiveS3: &S3Archive{Bucket: "bucket", Prefix: "archive/"}}
+	for _, s := range dd.Policy(&Registry{}, PolicyOptions{}).Statement {
+		if s.Sid == "DriftArchive" {
+			t.Fatalf("archive objects should not be allowed when archiving to a table: %+v", s)
+		}
+		if s.Sid == "DriftArchiveTable" && !reflect.DeepEqual(s.Action, []string{"dynamodb:PutItem"}) {
+			t.Fatalf("bad archive table statement: %+v", s)
+		}
+	}
+	dd.ArchiveTable = ""
+	p = dd.Policy(&Registry{}, PolicyOptions{})
+	if s := p.Statement[len(p.Statement)-1]; s.Sid != "DriftArchive" || !reflect.DeepEqual(s.Resource, []string{"arn:aws:s3:::bucket/archive/*"}) {
+		t.Fatalf("bad archive statement: %+v", s)
+	}
+}
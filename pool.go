@@ -0,0 +1,69 @@
+package drift
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool executes jobs of type T on a fixed set of goroutines which live for an entire stage of a run (a scan segment, action execution).
+// Jobs are submitted in batches (ex: a scan page) and wait blocks until the current batch completes.
+// Unlike a JobManager, job parameters are not packed into interface{} slices and goroutines are not spawned per batch.
+type workerPool[T any] struct {
+	jobs    chan T
+	batch   sync.WaitGroup
+	workers sync.WaitGroup
+	ec      errorCollector
+}
+
+// newWorkerPool starts workers goroutines executing f for each submitted job. Jobs submitted after ctx is cancelled are skipped, failing
+// with ctx.Err() so batches are never reported as complete.
+// If labels is not nil, each worker goroutine runs inside it (used to set pprof labels once per worker instead of once per job).
+func newWorkerPool[T any](ctx context.Context, workers uint, labels func(ctx context.Context, f func(ctx context.Context) error) error, f func(ctx context.Context, job T) error) *workerPool[T] {
+	if workers == 0 {
+		workers = 1
+	}
+	p := &workerPool[T]{
+		jobs: make(chan T, workers),
+	}
+	loop := func(ctx context.Context) error {
+		for job := range p.jobs {
+			if err := ctx.Err(); err != nil {
+				p.ec.HandleError(err)
+			} else if err := f(ctx, job); err != nil {
+				p.ec.HandleError(err)
+			}
+			p.batch.Done()
+		}
+		return nil
+	}
+	p.workers.Add(int(workers))
+	for i := uint(0); i < workers; i++ {
+		go func() {
+			defer p.workers.Done()
+			if labels != nil {
+				labels(ctx, loop)
+				return
+			}
+			loop(ctx)
+		}()
+	}
+	return p
+}
+
+// submit queues job for execution, blocking while all workers are busy
+func (p *workerPool[T]) submit(job T) {
+	p.batch.Add(1)
+	p.jobs <- job
+}
+
+// wait blocks until all submitted jobs have completed and returns the errors of the batch
+func (p *workerPool[T]) wait() []error {
+	p.batch.Wait()
+	return p.ec.take()
+}
+
+// close stops the workers, it must be called after the final wait
+func (p *workerPool[T]) close() {
+	close(p.jobs)
+	p.workers.Wait()
+}
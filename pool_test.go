@@ -0,0 +1,129 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/dollarshaveclub/jobmanager"
+)
+
+func TestWorkerPool(t *testing.T) {
+	order := []int{}
+	p := newWorkerPool(context.Background(), 1, nil, func(ctx context.Context, n int) error {
+		order = append(order, n)
+		if n%2 == 1 {
+			return fmt.Errorf("odd: %v", n)
+		}
+		return nil
+	})
+	for i := 0; i < 10; i++ {
+		p.submit(i)
+	}
+	if errs := p.wait(); len(errs) != 5 {
+		t.Fatalf("should have returned 5 errors: %v", errs)
+	}
+	p.submit(10)
+	if errs := p.wait(); len(errs) != 0 {
+		t.Fatalf("errors should be reset per batch: %v", errs)
+	}
+	p.close()
+	for i, n := range order {
+		if n != i {
+			t.Fatalf("jobs executed out of order: %v", order)
+		}
+	}
+}
+
+func TestWorkerPoolCancelled(t *testing.T) {
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+	var ran bool
+	p := newWorkerPool(ctx, 4, nil, func(ctx context.Context, n int) error {
+		ran = true
+		return nil
+	})
+	for i := 0; i < 100; i++ {
+		p.submit(i)
+	}
+	errs := p.wait()
+	p.close()
+	if ran {
+		t.Fatalf("jobs should have been skipped")
+	}
+	if len(errs) != 100 || !errors.Is(errs[0], context.Canceled) {
+		t.Fatalf("skipped jobs should fail with the context error: %v", errs)
+	}
+}
+
+const benchmarkPageSize = 1000
+
+func benchmarkPage() []map[string]*dynamodb.AttributeValue {
+	items := make([]map[string]*dynamodb.AttributeValue, benchmarkPageSize)
+	for i := range items {
+		items[i] = map[string]*dynamodb.AttributeValue{
+			"Name": &dynamodb.AttributeValue{S: aws.String(strconv.Itoa(i))},
+		}
+	}
+	return items
+}
+
+func benchmarkCallback(item RawDynamoItem, da *DrifterAction) error {
+	return nil
+}
+
+// BenchmarkCallbackPage measures dispatching a page of items to callbacks as done by scanSegment
+func BenchmarkCallbackPage(b *testing.B) {
+	m := &DynamoDrifterMigration{Callback: benchmarkCallback}
+	da := &DrifterAction{}
+	items := benchmarkPage()
+	ctx := context.Background()
+	p := newWorkerPool(ctx, 10, func(ctx context.Context, f func(ctx context.Context) error) error {
+		return withLabels(ctx, m, "callbacks", f, "segment", "0")
+	}, func(ctx context.Context, item RawDynamoItem) error {
+		return m.Callback(item, da)
+	})
+	defer p.close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, item := range items {
+			p.submit(item)
+		}
+		p.wait()
+	}
+}
+
+// BenchmarkCallbackPageJobManager measures the previous JobManager based dispatch, for comparison with BenchmarkCallbackPage
+func BenchmarkCallbackPageJobManager(b *testing.B) {
+	m := &DynamoDrifterMigration{Callback: benchmarkCallback}
+	da := &DrifterAction{}
+	items := benchmarkPage()
+	ctx := context.Background()
+	ec := errorCollector{}
+	j := &jobmanager.Job{
+		Job: func(ctx context.Context, params ...interface{}) error {
+			return withLabels(ctx, m, "callbacks", func(ctx context.Context) error {
+				return params[0].(DynamoMigrationFunction)(params[1].(map[string]*dynamodb.AttributeValue), params[2].(*DrifterAction))
+			}, "segment", "0")
+		},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jm := jobmanager.New()
+		jm.ErrorHandler = &ec
+		jm.Concurrency = 10
+		jm.Logger = log.New(ioutil.Discard, "", log.LstdFlags)
+		for _, item := range items {
+			jm.AddJob(j, m.Callback, item, da)
+		}
+		jm.Run(ctx)
+	}
+}
@@ -0,0 +1,251 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ErrPreflightFailed is returned (wrapped) by Preflight when a check fails
+var ErrPreflightFailed = errors.New("preflight checks failed")
+
+// preflightKey is the value of key attributes in the conditional no-op writes of Preflight
+const preflightKey = "drift-preflight"
+
+// PreflightCheck is the result of a check of Preflight
+type PreflightCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"` // What the check found, or why it failed
+}
+
+// PreflightReport is the checklist of Preflight
+type PreflightReport struct {
+	Number    uint             `json:"number"`
+	TableName string           `json:"tablename"`
+	Checks    []PreflightCheck `json:"checks"`
+}
+
+// Passed returns whether all checks passed
+func (pr *PreflightReport) Passed() bool {
+	for _, c := range pr.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the checklist, one check per line
+func (pr *PreflightReport) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "preflight of migration %v on table %v\n", pr.Number, pr.TableName)
+	for _, c := range pr.Checks {
+		status := "ok"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(b, "  [%v] %v", status, c.Name)
+		if c.Detail != "" {
+			fmt.Fprintf(b, ": %v", c.Detail)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// check adds the result of a check, failed if err is not nil
+func (pr *PreflightReport) check(name string, detail string, err error) bool {
+	c := PreflightCheck{Name: name, Passed: err == nil, Detail: detail}
+	if err != nil {
+		c.Detail = err.Error()
+	}
+	pr.Checks = append(pr.Checks, c)
+	return err == nil
+}
+
+// Preflight checks that migration can run before running it, so runs fail fast instead of partway through:
+//
+//   - the migration is valid
+//   - the meta table, the migration table and the tables it declares writing (see WritesTables) exist and are ACTIVE, with their indexes
+//   - the drifter is allowed to read and write them, which is checked with a one-item scan and a conditional no-op update (its condition
+//     never holds, so no item is written)
+//   - no run holds the migration lock (see MetaTableLock), even of the same owner, or is running the migration (it has a record in progress
+//     whose heartbeat isn't stale)
+//   - the write capacity of the indexes of provisioned tables isn't lower than their table's, which would throttle writes
+//
+// It returns the checklist, and an error wrapping ErrPreflightFailed if a check failed. Checks of a table are skipped if it doesn't exist.
+func (dd *DynamoDrifter) Preflight(ctx context.Context, migration *DynamoDrifterMigration) (*PreflightReport, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	if migration == nil {
+		return nil, fmt.Errorf("migration is required")
+	}
+	pr := &PreflightReport{Number: migration.Number, TableName: migration.TableName}
+	pr.check("migration is valid", "", validateMigration(migration))
+	tables := append([]string{dd.MetaTableName}, migration.TableName)
+	for _, tn := range migration.WritesTables {
+		if tn != migration.TableName {
+			tables = append(tables, tn)
+		}
+	}
+	for _, tn := range tables {
+		if tn == "" {
+			continue
+		}
+		desc, ok := dd.preflightTable(ctx, pr, tn)
+		if !ok {
+			continue
+		}
+		pr.check(fmt.Sprintf("can read %v", tn), "", dd.preflightRead(ctx, tn))
+		pr.check(fmt.Sprintf("can write %v", tn), "", dd.preflightWrite(ctx, desc))
+	}
+	detail, err := dd.preflightLock(ctx)
+	pr.check("migration lock is free", detail, err)
+	detail, err = dd.preflightRun(migration)
+	pr.check("migration isn't running", detail, err)
+	if !pr.Passed() {
+		return pr, fmt.Errorf("%w: %v", ErrPreflightFailed, pr)
+	}
+	return pr, nil
+}
+
+// preflightTable checks that table tn and its indexes are ACTIVE and that their capacity is plausible, returning its description if it
+// exists
+func (dd *DynamoDrifter) preflightTable(ctx context.Context, pr *PreflightReport, tn string) (*dynamodb.TableDescription, bool) {
+	name := fmt.Sprintf("%v is ACTIVE", tn)
+	ok, err := dd.findTable(tn)
+	if err == nil && !ok {
+		err = fmt.Errorf("table %v not found", tn)
+	}
+	if err != nil {
+		pr.check(name, "", err)
+		return nil, false
+	}
+	desc, mode, err := dd.describeTable(ctx, tn)
+	if err != nil {
+		pr.check(name, "", err)
+		return nil, false
+	}
+	if status := aws.StringValue(desc.TableStatus); status != dynamodb.TableStatusActive {
+		err = fmt.Errorf("table is %v", status)
+	}
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		if status := aws.StringValue(gsi.IndexStatus); err == nil && status != dynamodb.IndexStatusActive {
+			err = fmt.Errorf("index %v is %v", aws.StringValue(gsi.IndexName), status)
+		}
+	}
+	pr.check(name, mode, err)
+	if mode != BillingModeProvisioned || desc.ProvisionedThroughput == nil {
+		return desc, true
+	}
+	wcu := aws.Int64Value(desc.ProvisionedThroughput.WriteCapacityUnits)
+	low := []string{}
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		if gsi.ProvisionedThroughput != nil && aws.Int64Value(gsi.ProvisionedThroughput.WriteCapacityUnits) < wcu {
+			low = append(low, fmt.Sprintf("%v (%v WCU)", aws.StringValue(gsi.IndexName), aws.Int64Value(gsi.ProvisionedThroughput.WriteCapacityUnits)))
+		}
+	}
+	err = nil
+	if len(low) != 0 {
+		err = fmt.Errorf("indexes have less write capacity than the table (%v WCU), writes would be throttled: %v", wcu, strings.Join(low, ", "))
+	}
+	pr.check(fmt.Sprintf("capacity of %v", tn), fmt.Sprintf("%v RCU, %v WCU", aws.Int64Value(desc.ProvisionedThroughput.ReadCapacityUnits), wcu), err)
+	return desc, true
+}
+
+// preflightRead checks that table tn can be scanned
+func (dd *DynamoDrifter) preflightRead(ctx context.Context, tn string) error {
+	req, _ := dd.DynamoDB.ScanRequest(&dynamodb.ScanInput{TableName: aws.String(tn), Limit: aws.Int64(1)})
+	if err := dd.send(ctx, req); err != nil {
+		return fmt.Errorf("error scanning table: %v", err)
+	}
+	return nil
+}
+
+// preflightWrite checks that the table of desc can be written, with an update whose condition never holds
+func (dd *DynamoDrifter) preflightWrite(ctx context.Context, desc *dynamodb.TableDescription) error {
+	types := map[string]string{}
+	for _, ad := range desc.AttributeDefinitions {
+		types[aws.StringValue(ad.AttributeName)] = aws.StringValue(ad.AttributeType)
+	}
+	key := RawDynamoItem{}
+	for _, ks := range desc.KeySchema {
+		name := aws.StringValue(ks.AttributeName)
+		switch types[name] {
+		case dynamodb.ScalarAttributeTypeN:
+			key[name] = &dynamodb.AttributeValue{N: aws.String("-1")}
+		case dynamodb.ScalarAttributeTypeB:
+			key[name] = &dynamodb.AttributeValue{B: []byte(preflightKey)}
+		default:
+			key[name] = &dynamodb.AttributeValue{S: aws.String(preflightKey)}
+		}
+	}
+	req, _ := dd.DynamoDB.UpdateItemRequest(&dynamodb.UpdateItemInput{
+		TableName:                 desc.TableName,
+		Key:                       key,
+		UpdateExpression:          aws.String("SET #p = :p"),
+		ConditionExpression:       aws.String("attribute_exists(#p) AND attribute_not_exists(#p)"),
+		ExpressionAttributeNames:  map[string]*string{"#p": aws.String("DriftPreflight")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":p": &dynamodb.AttributeValue{BOOL: aws.Bool(true)}},
+	})
+	err := dd.send(ctx, req)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error updating item: %v", err)
+	}
+	return fmt.Errorf("no-op update unexpectedly succeeded")
+}
+
+// preflightLock checks that the migration lock (see MetaTableLock) isn't held, the lock not being re-entrant for its owner
+func (dd *DynamoDrifter) preflightLock(ctx context.Context) (string, error) {
+	req, gio := dd.DynamoDB.GetItemRequest(&dynamodb.GetItemInput{TableName: &dd.MetaTableName, Key: lockKey(), ConsistentRead: aws.Bool(true)})
+	if err := dd.send(ctx, req); err != nil {
+		return "", fmt.Errorf("error getting migration lock: %v", err)
+	}
+	if len(gio.Item) == 0 {
+		return "not held", nil
+	}
+	holder := aws.StringValue(gio.Item["Owner"].S)
+	var expires int64
+	if gio.Item["Expires"] != nil {
+		expires, _ = strconv.ParseInt(aws.StringValue(gio.Item["Expires"].N), 10, 64)
+	}
+	if expires < time.Now().UnixNano() {
+		return fmt.Sprintf("lease of %v expired", holder), nil
+	}
+	return "", fmt.Errorf("%w: %v until %v", ErrMigrationLocked, holder, time.Unix(0, expires).UTC().Format(time.RFC3339))
+}
+
+// preflightRun checks that migration doesn't have a record in progress with a live heartbeat, nor a record of another migration
+func (dd *DynamoDrifter) preflightRun(migration *DynamoDrifterMigration) (string, error) {
+	m, err := dd.getMetaItem(migration.Number)
+	if err != nil {
+		return "", err
+	}
+	if m != nil {
+		if err := checkCollision(migration, m); err != nil {
+			return "", err
+		}
+	}
+	switch {
+	case m == nil:
+		return "not applied", nil
+	case m.Heartbeat != nil && (dd.HeartbeatInterval == 0 || !m.Heartbeat.Stale(3*dd.HeartbeatInterval)):
+		return "", fmt.Errorf("run by %v since %v (last heartbeat %v)", m.Heartbeat.Owner, m.Heartbeat.Started.Format(time.RFC3339), m.Heartbeat.Last.Format(time.RFC3339))
+	case m.InProgress:
+		return "interrupted run in progress", nil
+	}
+	return "already applied", nil
+}
@@ -0,0 +1,30 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestPreflightReport(t *testing.T) {
+	pr := &PreflightReport{Number: 3, TableName: "foo"}
+	if !pr.check("foo is ACTIVE", "PROVISIONED", nil) || !pr.Passed() {
+		t.Fatalf("check should pass")
+	}
+	if pr.check("can read foo", "ignored", fmt.Errorf("access denied")) || pr.Passed() {
+		t.Fatalf("check should fail")
+	}
+	expected := "preflight of migration 3 on table foo\n  [ok] foo is ACTIVE: PROVISIONED\n  [FAIL] can read foo: access denied\n"
+	if s := pr.String(); s != expected {
+		t.Fatalf("bad report: %q", s)
+	}
+}
+
+func TestPreflightValidation(t *testing.T) {
+	if _, err := (&DynamoDrifter{}).Preflight(context.Background(), &DynamoDrifterMigration{}); err == nil {
+		t.Fatalf("preflight should require a client")
+	}
+	if _, err := (&DynamoDrifter{DynamoDB: getTestHTTPDDBClient("http://localhost:1")}).Preflight(context.Background(), nil); err == nil {
+		t.Fatalf("preflight should require a migration")
+	}
+}
@@ -0,0 +1,53 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+)
+
+// Profiling configures optional profile capture around a migration run (Run/Undo).
+// Additionally, callback and action goroutines are always tagged with pprof labels "migration", "phase" ("callbacks" or "actions") and
+// (for callbacks) "segment", so profiles of slow migrations can be filtered by label.
+type Profiling struct {
+	CPUProfile  io.Writer // If set, a CPU profile covering the entire run is written here
+	HeapProfile io.Writer // If set, a heap profile is written here when the run completes
+}
+
+// withLabels runs f with pprof labels identifying the migration and phase
+func withLabels(ctx context.Context, migration *DynamoDrifterMigration, phase string, f func(ctx context.Context) error, kv ...string) error {
+	var err error
+	labels := append([]string{"migration", strconv.FormatUint(uint64(migration.Number), 10), "phase", phase}, kv...)
+	pprof.Do(ctx, pprof.Labels(labels...), func(ctx context.Context) {
+		err = f(ctx)
+	})
+	return err
+}
+
+// startProfiling starts any configured profiles and returns a function that stops them
+func (dd *DynamoDrifter) startProfiling() (func() error, error) {
+	p := dd.Profiling
+	if p == nil {
+		return func() error { return nil }, nil
+	}
+	if p.CPUProfile != nil {
+		if err := pprof.StartCPUProfile(p.CPUProfile); err != nil {
+			return nil, fmt.Errorf("error starting CPU profile: %v", err)
+		}
+	}
+	return func() error {
+		if p.CPUProfile != nil {
+			pprof.StopCPUProfile()
+		}
+		if p.HeapProfile != nil {
+			runtime.GC() // up to date statistics
+			if err := pprof.WriteHeapProfile(p.HeapProfile); err != nil {
+				return fmt.Errorf("error writing heap profile: %v", err)
+			}
+		}
+		return nil
+	}, nil
+}
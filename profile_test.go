@@ -0,0 +1,45 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestWithLabels(t *testing.T) {
+	m := &DynamoDrifterMigration{Number: 7}
+	err := withLabels(context.Background(), m, "callbacks", func(ctx context.Context) error {
+		n, ok := pprof.Label(ctx, "migration")
+		if !ok || n != "7" {
+			t.Fatalf("bad migration label: %v", n)
+		}
+		p, ok := pprof.Label(ctx, "phase")
+		if !ok || p != "callbacks" {
+			t.Fatalf("bad phase label: %v", p)
+		}
+		s, ok := pprof.Label(ctx, "segment")
+		if !ok || s != "2" {
+			t.Fatalf("bad segment label: %v", s)
+		}
+		return nil
+	}, "segment", "2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProfiling(t *testing.T) {
+	cpu, heap := &bytes.Buffer{}, &bytes.Buffer{}
+	dd := DynamoDrifter{Profiling: &Profiling{CPUProfile: cpu, HeapProfile: heap}}
+	stop, err := dd.startProfiling()
+	if err != nil {
+		t.Fatalf("error starting profiling: %v", err)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("error stopping profiling: %v", err)
+	}
+	if cpu.Len() == 0 || heap.Len() == 0 {
+		t.Fatalf("profiles not written: %v, %v", cpu.Len(), heap.Len())
+	}
+}
@@ -0,0 +1,120 @@
+package drift
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// DefaultProgressInterval is the default interval of ProgressFunc calls
+const DefaultProgressInterval = 10 * time.Second
+
+// ProgressEvent is the progress of a running migration, passed to DynamoDrifter.ProgressFunc. As in ProgressSnapshot, counters are those
+// of the current scan (for multi-step migrations, of the current scan step) except PagesScanned and error counts, which cover the whole run,
+// and PercentComplete is that of the current phase.
+type ProgressEvent struct {
+	Number          uint
+	TableName       string
+	Undo            bool
+	Phase           string // PhaseCallbacks or PhaseActions
+	ItemsProcessed  uint   // Items passed to the callback
+	PagesScanned    uint
+	ActionsQueued   uint
+	ActionsExecuted uint
+	CallbackErrors  uint
+	ActionErrors    uint
+	EstimatedTotal  int64   // Approximate item count of the table, as reported by DescribeTable (0 if unknown)
+	PercentComplete float64 // Capped at 100
+	Elapsed         time.Duration
+	Final           bool // Last event of the run, after it ended (successfully unless Err is set)
+	Err             error
+}
+
+// progressTracker tracks the progress of a run for ProgressFunc
+type progressTracker struct {
+	s     snapshotter
+	pages uint64
+}
+
+type progressTrackerKey struct{}
+
+// progressTrackerFrom returns the progress tracker of the run of ctx, or nil
+func progressTrackerFrom(ctx context.Context) *progressTracker {
+	if ctx == nil {
+		return nil
+	}
+	pt, _ := ctx.Value(progressTrackerKey{}).(*progressTracker)
+	return pt
+}
+
+// page counts a scanned page
+func (pt *progressTracker) page() {
+	if pt == nil {
+		return
+	}
+	atomic.AddUint64(&pt.pages, 1)
+}
+
+// event returns the current progress event
+func (pt *progressTracker) event() ProgressEvent {
+	snap := pt.s.snapshot()
+	return ProgressEvent{
+		Number:          snap.Number,
+		TableName:       snap.TableName,
+		Undo:            snap.Undo,
+		Phase:           snap.Phase,
+		ItemsProcessed:  snap.CallbacksProcessed,
+		PagesScanned:    uint(atomic.LoadUint64(&pt.pages)),
+		ActionsQueued:   snap.ActionsQueued,
+		ActionsExecuted: snap.ActionsExecuted,
+		CallbackErrors:  snap.CallbackErrors,
+		ActionErrors:    snap.ActionErrors,
+		EstimatedTotal:  snap.ItemsEstimated,
+		PercentComplete: snap.PercentComplete,
+		Elapsed:         snap.Updated.Sub(snap.Started),
+	}
+}
+
+// startProgress starts calling dd.ProgressFunc for a run of migration if set, returning the context and progress channel to use for the
+// run in place of ctx and progressChan, and a function making the final call, which must be passed the errors of the run.
+func (dd *DynamoDrifter) startProgress(ctx context.Context, migration *DynamoDrifterMigration, undo bool, progressChan chan *MigrationProgress) (context.Context, chan *MigrationProgress, func(errs []error)) {
+	if dd.ProgressFunc == nil || migration == nil {
+		if progressTrackerFrom(ctx) != nil {
+			ctx = context.WithValue(ctx, progressTrackerKey{}, (*progressTracker)(nil)) // not part of the progress of the enclosing run
+		}
+		return ctx, progressChan, func([]error) {}
+	}
+	interval := dd.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	now := time.Now().UTC()
+	pt := &progressTracker{s: snapshotter{
+		snap: ProgressSnapshot{
+			Number:    migration.Number,
+			TableName: migration.TableName,
+			Undo:      undo,
+			Status:    SnapshotRunning,
+			Phase:     PhaseCallbacks,
+			Started:   now,
+		},
+		phaseStarted: now,
+	}}
+	if td, _, err := dd.describeTable(ctx, migration.TableName); err == nil {
+		pt.s.snap.ItemsEstimated = aws.Int64Value(td.ItemCount)
+	}
+	dd.ProgressFunc(pt.event())
+	pc, stop := tapProgress(progressChan, interval, pt.s.observe, func() { dd.ProgressFunc(pt.event()) })
+	return context.WithValue(ctx, progressTrackerKey{}, pt), pc, func(errs []error) {
+		stop()
+		pt.s.finish(errs)
+		ev := pt.event()
+		ev.Final = true
+		if len(errs) != 0 {
+			ev.Err = errs[0]
+		}
+		dd.ProgressFunc(ev)
+	}
+}
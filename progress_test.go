@@ -0,0 +1,61 @@
+package drift
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressFunc(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+		case "ListTables":
+			w.Write([]byte(`{"TableNames":["foo"]}`))
+		case "DescribeTable":
+			w.Write([]byte(`{"Table":{"TableName":"foo","ItemCount":4,"KeySchema":[{"AttributeName":"ID","KeyType":"HASH"}]}}`))
+		case "Scan":
+			time.Sleep(30 * time.Millisecond)
+			w.Write([]byte(`{"Items":[{"ID":{"S":"1"}},{"ID":{"S":"2"}}],"Count":2,"ScannedCount":2}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	var mu sync.Mutex
+	events := []ProgressEvent{}
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), MetaTableName: "migrations", ProgressInterval: 5 * time.Millisecond,
+		ProgressFunc: func(ev ProgressEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, ev)
+		}}
+	m := &DynamoDrifterMigration{Number: 1, TableName: "foo", Callback: func(item RawDynamoItem, da *DrifterAction) error {
+		return da.UpdateItem(item, "").Set("Foo", "v").Queue()
+	}}
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("error running migration: %v", errs)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) < 3 {
+		t.Fatalf("expected periodic events: %+v", events)
+	}
+	first, last := events[0], events[len(events)-1]
+	if first.Number != 1 || first.Final || first.EstimatedTotal != 4 || first.Phase != PhaseCallbacks || first.ItemsProcessed != 0 {
+		t.Fatalf("bad first event: %+v", first)
+	}
+	if !last.Final || last.Err != nil || last.PagesScanned != 1 || last.ItemsProcessed != 2 || last.ActionsQueued != 2 || last.ActionsExecuted != 2 ||
+		last.PercentComplete != 100 {
+		t.Fatalf("bad last event: %+v", last)
+	}
+	for _, ev := range events[:len(events)-1] {
+		if ev.Final {
+			t.Fatalf("final event before the end of the run: %+v", ev)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package drift
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Default settings of ProgressBar
+const (
+	DefaultProgressBarWidth       = 30
+	DefaultProgressBarLogInterval = 10 * time.Second
+	progressBarRefresh            = 200 * time.Millisecond
+)
+
+// ProgressBar renders the progress of a run (see MigrationProgress) to a terminal as a live progress bar with rate and ETA. When Out is
+// not a terminal, progress is written as a line every LogInterval instead. Usage:
+//
+//	pc, wait := (&drift.ProgressBar{TotalItems: count}).Start()
+//	errs := dd.Run(ctx, migration, 4, false, pc)
+//	wait()
+type ProgressBar struct {
+	Out         io.Writer     // Defaults to os.Stderr
+	TotalItems  uint          // Expected number of items processed by callbacks, for their bar and ETA (optional, ex: the ItemCount of the table)
+	Width       int           // Width of the bar in characters (defaults to DefaultProgressBarWidth)
+	LogInterval time.Duration // Interval of progress lines when Out is not a terminal (defaults to DefaultProgressBarLogInterval)
+}
+
+// progressBarState is the progress of the current phase of a run
+type progressBarState struct {
+	phase   string // PhaseCallbacks or PhaseActions
+	started time.Time
+	done    uint
+	total   uint // 0 if unknown
+	errors  uint // errors of the run so far
+}
+
+// isTerminal returns whether w is a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Start starts rendering progress, returning the channel to pass to Run/Undo and a function waiting for the final render once the run
+// has returned (Run and Undo close the channel).
+func (pb *ProgressBar) Start() (chan *MigrationProgress, func()) {
+	pc := make(chan *MigrationProgress, 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pb.track(pc)
+	}()
+	return pc, func() { <-done }
+}
+
+// track renders the progress messages of pc until it is closed
+func (pb *ProgressBar) track(pc chan *MigrationProgress) {
+	out := pb.Out
+	if out == nil {
+		out = os.Stderr
+	}
+	tty := isTerminal(out)
+	interval := progressBarRefresh
+	if !tty {
+		interval = pb.LogInterval
+		if interval == 0 {
+			interval = DefaultProgressBarLogInterval
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var st *progressBarState
+	errors := uint(0)
+	render := func(final bool) {
+		if st == nil {
+			return
+		}
+		line := pb.render(st, time.Now())
+		switch {
+		case tty && final:
+			fmt.Fprintf(out, "\r%v\x1b[K\n", line)
+		case tty:
+			fmt.Fprintf(out, "\r%v\x1b[K", line)
+		default:
+			fmt.Fprintln(out, line)
+		}
+	}
+	for {
+		select {
+		case mp, ok := <-pc:
+			if !ok {
+				render(true)
+				return
+			}
+			errors += uint(len(mp.CallbackErrors) + len(mp.ActionErrors))
+			phase, done, total := PhaseCallbacks, mp.CallbacksProcessed, pb.TotalItems
+			if mp.ActionsExecuted != 0 {
+				phase, done, total = PhaseActions, mp.ActionsExecuted, mp.ActionsQueued
+			} else if mp.CallbacksProcessed == 0 && st != nil {
+				phase, done, total = st.phase, st.done, st.total // errors only
+			}
+			if st == nil || st.phase != phase || done < st.done {
+				render(true) // the previous phase is complete
+				st = &progressBarState{phase: phase, started: time.Now()}
+			}
+			st.done, st.total, st.errors = done, total, errors
+		case <-ticker.C:
+			render(false)
+		}
+	}
+}
+
+// render returns the progress line of st at now, ex: "actions [=======>      ] 53% 530/1000 120/s ETA 4s 2 errors"
+func (pb *ProgressBar) render(st *progressBarState, now time.Time) string {
+	b := &strings.Builder{}
+	b.WriteString(st.phase)
+	if st.total != 0 {
+		width := pb.Width
+		if width <= 0 {
+			width = DefaultProgressBarWidth
+		}
+		frac := min(float64(st.done)/float64(st.total), 1)
+		filled := int(frac * float64(width))
+		bar := strings.Repeat("=", filled)
+		if filled < width {
+			bar += ">" + strings.Repeat(" ", width-filled-1)
+		}
+		fmt.Fprintf(b, " [%v] %3.0f%% %v/%v", bar, frac*100, st.done, st.total)
+	} else {
+		fmt.Fprintf(b, " %v", st.done)
+	}
+	elapsed := now.Sub(st.started).Seconds()
+	if elapsed > 0 {
+		rate := float64(st.done) / elapsed
+		fmt.Fprintf(b, " %.0f/s", rate)
+		if st.total > st.done && rate > 0 {
+			eta := time.Duration(float64(st.total-st.done) / rate * float64(time.Second))
+			fmt.Fprintf(b, " ETA %v", eta.Round(time.Second))
+		}
+	}
+	if st.errors != 0 {
+		fmt.Fprintf(b, " %v errors", st.errors)
+	}
+	return b.String()
+}
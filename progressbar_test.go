@@ -0,0 +1,42 @@
+package drift
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressBarRender(t *testing.T) {
+	pb := &ProgressBar{Width: 10}
+	now := time.Now()
+	st := &progressBarState{phase: PhaseActions, started: now.Add(-10 * time.Second), done: 500, total: 1000, errors: 2}
+	if s := pb.render(st, now); s != "actions [=====>    ]  50% 500/1000 50/s ETA 10s 2 errors" {
+		t.Fatalf("bad line: %q", s)
+	}
+	st = &progressBarState{phase: PhaseCallbacks, started: now.Add(-2 * time.Second), done: 40}
+	if s := pb.render(st, now); s != "callbacks 40 20/s" {
+		t.Fatalf("bad line: %q", s)
+	}
+	st.total = 40
+	if s := pb.render(st, now); s != "callbacks [==========] 100% 40/40 20/s" {
+		t.Fatalf("bad line: %q", s)
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	out := &bytes.Buffer{}
+	pb := &ProgressBar{Out: out, TotalItems: 20, Width: 4, LogInterval: time.Hour}
+	pc, wait := pb.Start()
+	pc <- &MigrationProgress{CallbacksProcessed: 10}
+	pc <- &MigrationProgress{CallbacksProcessed: 20, CallbackErrors: []error{fmt.Errorf("foo")}}
+	pc <- &MigrationProgress{ActionsExecuted: 3, ActionsQueued: 6}
+	close(pc)
+	wait()
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "callbacks [====] 100% 20/20 ") || !strings.HasSuffix(lines[0], " 1 errors") ||
+		!strings.HasPrefix(lines[1], "actions [==> ]  50% 3/6 ") {
+		t.Fatalf("bad output: %q", lines)
+	}
+}
@@ -0,0 +1,143 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// prunedNumber is the Number of the meta table record holding the numbers of pruned and archived migrations, and the summaries of
+// archives (see Prune and Archive)
+const prunedNumber = "-2"
+
+// RetentionPolicy selects the records of applied migrations kept in the meta table by Prune. A record is kept if either rule keeps it,
+// zero values disable a rule. Records of migrations in progress are always kept.
+type RetentionPolicy struct {
+	KeepLast      uint          // Keep the records of the KeepLast applied migrations with the highest numbers
+	KeepNewerThan time.Duration // Keep the records of migrations applied within this duration (records without AppliedAt are older)
+}
+
+// prunable returns the records of applied migrations not kept by rp at now, in ascending order
+func (rp *RetentionPolicy) prunable(records []DynamoDrifterMigration, now time.Time) []DynamoDrifterMigration {
+	applied := []DynamoDrifterMigration{}
+	for _, m := range records {
+		if !m.InProgress {
+			applied = append(applied, m)
+		}
+	}
+	sort.Slice(applied, func(i, j int) bool { return applied[i].Number < applied[j].Number })
+	out := []DynamoDrifterMigration{}
+	for i, m := range applied {
+		if rp.KeepLast != 0 && uint(len(applied)-i) <= rp.KeepLast {
+			continue
+		}
+		if rp.KeepNewerThan != 0 && m.AppliedAt != nil && now.Sub(*m.AppliedAt) < rp.KeepNewerThan {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func prunedKey() map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"Number": &dynamodb.AttributeValue{N: aws.String(prunedNumber)}}
+}
+
+// Pruned returns the numbers of migrations whose records were pruned or archived (see Prune and Archive), in ascending order. They remain
+// applied: Pending doesn't return them.
+func (dd *DynamoDrifter) Pruned(ctx context.Context) ([]uint, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	req, out := dd.DynamoDB.GetItemRequest(&dynamodb.GetItemInput{TableName: &dd.MetaTableName, Key: prunedKey(), ConsistentRead: aws.Bool(true)})
+	if err := dd.send(ctx, req); err != nil {
+		return nil, fmt.Errorf("error getting pruned migrations: %v", err)
+	}
+	numbers := []uint{}
+	if av := out.Item["Pruned"]; av != nil {
+		for _, n := range av.NS {
+			v, err := strconv.ParseUint(aws.StringValue(n), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pruned migration number %q: %v", aws.StringValue(n), err)
+			}
+			numbers = append(numbers, uint(v))
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers, nil
+}
+
+// Prune deletes the records of applied migrations from the meta table according to the drifter's Retention policy, for long-lived
+// services whose meta table has accumulated years of records, and returns them. If export is not nil, the records are first written to
+// it as HistoryJSON, so they can be archived (and restored with ImportHistory). The numbers of pruned migrations are recorded before their
+// records are deleted (see Pruned), so they are never considered pending again.
+func (dd *DynamoDrifter) Prune(ctx context.Context, export io.Writer) ([]DynamoDrifterMigration, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	if dd.Retention == nil || *dd.Retention == (RetentionPolicy{}) {
+		return nil, fmt.Errorf("retention policy is required")
+	}
+	records, err := dd.metaRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting migration history: %v", err)
+	}
+	pruned := dd.Retention.prunable(records, time.Now())
+	if len(pruned) == 0 {
+		return pruned, nil
+	}
+	if export != nil {
+		enc := json.NewEncoder(export)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(historyFile{Version: HistoryVersion, Migrations: pruned}); err != nil {
+			return nil, fmt.Errorf("error exporting pruned migrations: %v", err)
+		}
+	}
+	if err := dd.removeMetaRecords(ctx, pruned, nil); err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
+
+// removeMetaRecords records the numbers of ms as pruned, along with summary if not nil (see Archive), then deletes their records
+func (dd *DynamoDrifter) removeMetaRecords(ctx context.Context, ms []DynamoDrifterMigration, summary *ArchiveSummary) error {
+	numbers := make([]*string, len(ms))
+	for i, m := range ms {
+		numbers[i] = aws.String(strconv.FormatUint(uint64(m.Number), 10))
+	}
+	ui := &dynamodb.UpdateItemInput{
+		TableName:                 &dd.MetaTableName,
+		Key:                       prunedKey(),
+		UpdateExpression:          aws.String("ADD #p :p"),
+		ExpressionAttributeNames:  map[string]*string{"#p": aws.String("Pruned")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":p": &dynamodb.AttributeValue{NS: numbers}},
+	}
+	if summary != nil {
+		av, err := dynamodbattribute.Marshal(summary)
+		if err != nil {
+			return fmt.Errorf("error marshaling archive summary: %v", err)
+		}
+		ui.UpdateExpression = aws.String("ADD #p :p SET #a = list_append(if_not_exists(#a, :empty), :a)")
+		ui.ExpressionAttributeNames["#a"] = aws.String("Archives")
+		ui.ExpressionAttributeValues[":a"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{av}}
+		ui.ExpressionAttributeValues[":empty"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+	}
+	req, _ := dd.DynamoDB.UpdateItemRequest(ui)
+	if err := dd.send(ctx, req); err != nil {
+		return fmt.Errorf("error recording removed migrations: %v", err)
+	}
+	for i := range ms {
+		if err := dd.deleteMetaItem(&ms[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	records := []DynamoDrifterMigration{
+		{Number: 4, AppliedAt: at(time.Hour)},
+		{Number: 1},
+		{Number: 2, AppliedAt: at(48 * time.Hour)},
+		{Number: 3, AppliedAt: at(72 * time.Hour)},
+		{Number: 5, InProgress: true},
+	}
+	numbers := func(ms []DynamoDrifterMigration) []uint {
+		out := []uint{}
+		for _, m := range ms {
+			out = append(out, m.Number)
+		}
+		return out
+	}
+	for _, c := range []struct {
+		rp       RetentionPolicy
+		expected []uint
+	}{
+		{RetentionPolicy{KeepLast: 2}, []uint{1, 2}},
+		{RetentionPolicy{KeepNewerThan: 50 * time.Hour}, []uint{1, 3}},
+		{RetentionPolicy{KeepLast: 1, KeepNewerThan: 50 * time.Hour}, []uint{1, 3}},
+		{RetentionPolicy{KeepLast: 3, KeepNewerThan: 24 * time.Hour}, []uint{1}},
+		{RetentionPolicy{KeepLast: 10}, []uint{}},
+	} {
+		if pruned := numbers(c.rp.prunable(records, now)); !reflect.DeepEqual(pruned, c.expected) {
+			t.Fatalf("%+v: bad pruned records: %v (expected %v)", c.rp, pruned, c.expected)
+		}
+	}
+}
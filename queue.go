@@ -0,0 +1,48 @@
+package drift
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const actionQueueShards = 32
+
+// actionShard is padded to a cache line so that shards locked by different goroutines don't contend via false sharing
+type actionShard struct {
+	sync.Mutex
+	q []action
+	_ [32]byte
+}
+
+// actionQueue is a queue of actions safe for concurrent use by many callbacks.
+// Each queued action is assigned a global sequence number and stored in one of several shards (round robin by sequence) so
+// concurrent callbacks rarely contend on the same lock. actions merges the shards back into queue order.
+type actionQueue struct {
+	seq    uint64
+	shards [actionQueueShards]actionShard
+}
+
+// push adds a to the end of the queue
+func (aq *actionQueue) push(a action) {
+	a.seq = atomic.AddUint64(&aq.seq, 1)
+	s := &aq.shards[a.seq%actionQueueShards]
+	s.Lock()
+	s.q = append(s.q, a)
+	s.Unlock()
+}
+
+// len returns the number of queued actions
+func (aq *actionQueue) len() int {
+	return int(atomic.LoadUint64(&aq.seq))
+}
+
+// actions returns all queued actions in the order they were queued. It must not be called concurrently with push.
+func (aq *actionQueue) actions() []action {
+	out := make([]action, aq.len())
+	for i := range aq.shards {
+		for _, a := range aq.shards[i].q {
+			out[a.seq-1] = a // sequence numbers are dense, so each action has a unique slot
+		}
+	}
+	return out
+}
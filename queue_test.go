@@ -0,0 +1,81 @@
+package drift
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestActionQueueOrder(t *testing.T) {
+	aq := actionQueue{}
+	for i := 0; i < 1000; i++ {
+		aq.push(action{tableName: strconv.Itoa(i)})
+	}
+	actions := aq.actions()
+	if len(actions) != 1000 || aq.len() != 1000 {
+		t.Fatalf("bad length: %v", len(actions))
+	}
+	for i, a := range actions {
+		if a.tableName != strconv.Itoa(i) {
+			t.Fatalf("action %v out of order: %v", i, a.tableName)
+		}
+	}
+}
+
+func TestActionQueueConcurrent(t *testing.T) {
+	aq := actionQueue{}
+	var wg sync.WaitGroup
+	for w := 0; w < 64; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				aq.push(action{tableName: strconv.Itoa(w), updExpr: strconv.Itoa(i)})
+			}
+		}(w)
+	}
+	wg.Wait()
+	actions := aq.actions()
+	if len(actions) != 6400 {
+		t.Fatalf("bad length: %v", len(actions))
+	}
+	// actions queued by each goroutine must retain their relative order
+	next := map[string]int{}
+	for _, a := range actions {
+		if a.updExpr != strconv.Itoa(next[a.tableName]) {
+			t.Fatalf("actions of worker %v out of order", a.tableName)
+		}
+		next[a.tableName]++
+	}
+}
+
+// mutexQueue is the previous single lock queue, for comparison
+type mutexQueue struct {
+	sync.Mutex
+	q []action
+}
+
+func benchmarkQueue(b *testing.B, push func(action)) {
+	b.SetParallelism(64) // 64 * GOMAXPROCS goroutines
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			push(action{atype: insertAction})
+		}
+	})
+}
+
+func BenchmarkActionQueue(b *testing.B) {
+	aq := &actionQueue{}
+	benchmarkQueue(b, aq.push)
+}
+
+func BenchmarkActionQueueSingleMutex(b *testing.B) {
+	mq := &mutexQueue{}
+	benchmarkQueue(b, func(a action) {
+		mq.Lock()
+		mq.q = append(mq.q, a)
+		mq.Unlock()
+	})
+}
@@ -0,0 +1,160 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry is a set of migrations known to an application, used to determine which are pending. The zero value is an empty registry.
+//
+// Migrations are applied in ascending Number order. Numbers are either small sequential numbers or timestamps (see TimestampNumber),
+// which sort after them. A migration numbered below applied migrations (ex: merged from a branch after later migrations were applied) is
+// still pending, and applied before the other pending migrations: the order only holds among pending migrations, so migrations written in
+// parallel must not depend on each other. Numbers of different migrations must differ: two registered migrations with the same number, or a
+// registered migration whose number was applied with another table or description (see Pending), are a collision (see ErrNumberCollision).
+type Registry struct {
+	sync.Mutex
+	migrations map[uint]*DynamoDrifterMigration
+}
+
+// Register adds migrations to the registry. Migration numbers must be unique.
+func (r *Registry) Register(migrations ...*DynamoDrifterMigration) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.migrations == nil {
+		r.migrations = map[uint]*DynamoDrifterMigration{}
+	}
+	for _, m := range migrations {
+		if m == nil {
+			return fmt.Errorf("migration is required")
+		}
+		if m.TableName == "" {
+			return fmt.Errorf("migration %v: TableName is required", m.Number)
+		}
+		if len(m.Steps) == 0 {
+			if err := validateCallbacks(m); err != nil {
+				return fmt.Errorf("migration %v: %v", m.Number, err)
+			}
+		}
+		if prev, ok := r.migrations[m.Number]; ok {
+			return fmt.Errorf("%w: migrations %v of tables %v (%q) and %v (%q)", ErrNumberCollision, m.Number, prev.TableName, prev.Description,
+				m.TableName, m.Description)
+		}
+		r.migrations[m.Number] = m
+	}
+	return nil
+}
+
+// Migrations returns the registered migrations in ascending order
+func (r *Registry) Migrations() []*DynamoDrifterMigration {
+	r.Lock()
+	defer r.Unlock()
+	ms := make([]*DynamoDrifterMigration, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Number < ms[j].Number })
+	return ms
+}
+
+// get returns the registered migration number, or nil
+func (r *Registry) get(number uint) *DynamoDrifterMigration {
+	r.Lock()
+	defer r.Unlock()
+	return r.migrations[number]
+}
+
+// pending returns the migrations of r not in applied, in ascending order, or an error if a migration of r collides with its applied record
+func (r *Registry) pending(applied []DynamoDrifterMigration) ([]*DynamoDrifterMigration, error) {
+	done := map[uint]*DynamoDrifterMigration{}
+	for i := range applied {
+		done[applied[i].Number] = &applied[i]
+	}
+	ms := []*DynamoDrifterMigration{}
+	for _, m := range r.Migrations() {
+		rec := done[m.Number]
+		if rec == nil {
+			ms = append(ms, m)
+			continue
+		}
+		if err := checkCollision(m, rec); err != nil {
+			return nil, err
+		}
+	}
+	return ms, nil
+}
+
+// Register adds migrations to dd.Registry (created if nil) for RunAll. Migration numbers must be unique. Register migrations before running
+// them (ex: at startup), Register isn't safe for concurrent use with RunAll.
+func (dd *DynamoDrifter) Register(migrations ...*DynamoDrifterMigration) error {
+	if dd.Registry == nil {
+		dd.Registry = &Registry{}
+	}
+	return dd.Registry.Register(migrations...)
+}
+
+// RunAllOptions are the options of DynamoDrifter.RunAll
+type RunAllOptions struct {
+	Concurrency      uint   // See DynamoDrifter.Run
+	FailOnFirstError bool   // See DynamoDrifter.Run
+	Lock             Locker // Lock held while the migrations run (optional, see MetaTableLock, not to be combined with DynamoDrifter.Locking)
+
+	// Report is called (if set) after each migration is run, with the errors from DynamoDrifter.Run
+	Report func(migration *DynamoDrifterMigration, errs []error)
+}
+
+// RunAll runs the pending migrations of dd.Registry (see Pending) in ascending order, stopping at the first one that fails, and returns
+// the number of migrations applied. The error of a failed migration wraps its first error.
+func (dd *DynamoDrifter) RunAll(ctx context.Context, opts RunAllOptions) (int, error) {
+	if dd.Registry == nil {
+		return 0, fmt.Errorf("no migrations are registered")
+	}
+	if opts.Lock != nil {
+		var unlock func() error
+		var err error
+		ctx, unlock, err = holdLock(ctx, opts.Lock)
+		if err != nil {
+			return 0, err
+		}
+		defer unlock()
+	}
+	return dd.runPending(ctx, dd.Registry, opts)
+}
+
+// runPending runs the pending migrations of r in ascending order until one fails, returning the number of migrations applied
+func (dd *DynamoDrifter) runPending(ctx context.Context, r *Registry, opts RunAllOptions) (int, error) {
+	pending, err := dd.Pending(r)
+	if err != nil {
+		return 0, err
+	}
+	for i, m := range pending {
+		errs := dd.Run(ctx, m, opts.Concurrency, opts.FailOnFirstError, nil)
+		if opts.Report != nil {
+			opts.Report(m, errs)
+		}
+		if len(errs) != 0 {
+			return i, fmt.Errorf("migration %v failed: %w", m.Number, errs[0])
+		}
+	}
+	return len(pending), nil
+}
+
+// Pending returns the migrations of r which have not been applied, in ascending order. Migrations whose records were pruned (see Prune)
+// are applied. An error wrapping ErrNumberCollision is returned if the record of an applied migration has another table or description
+// than the registered migration of its number.
+func (dd *DynamoDrifter) Pending(r *Registry) ([]*DynamoDrifterMigration, error) {
+	applied, err := dd.Applied()
+	if err != nil {
+		return nil, fmt.Errorf("error getting applied migrations: %v", err)
+	}
+	pruned, err := dd.Pruned(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range pruned {
+		applied = append(applied, DynamoDrifterMigration{Number: n})
+	}
+	return r.pending(applied)
+}
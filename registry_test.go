@@ -0,0 +1,69 @@
+package drift
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	cb := func(item RawDynamoItem, action *DrifterAction) error { return nil }
+	r := &Registry{}
+	err := r.Register(
+		&DynamoDrifterMigration{Number: 2, TableName: "a", Callback: cb},
+		&DynamoDrifterMigration{Number: 0, TableName: "a", Callback: cb},
+		&DynamoDrifterMigration{Number: 1, TableName: "b", Steps: []MigrationStep{{Name: "s", Callback: cb}}},
+	)
+	if err != nil {
+		t.Fatalf("error registering: %v", err)
+	}
+	for _, m := range []*DynamoDrifterMigration{
+		nil,
+		&DynamoDrifterMigration{Number: 3, Callback: cb},
+		&DynamoDrifterMigration{Number: 3, TableName: "a"},
+		&DynamoDrifterMigration{Number: 2, TableName: "a", Callback: cb},
+	} {
+		if err := r.Register(m); err == nil {
+			t.Fatalf("registering %+v should have failed", m)
+		}
+	}
+	ms := r.Migrations()
+	if len(ms) != 3 || ms[0].Number != 0 || ms[1].Number != 1 || ms[2].Number != 2 {
+		t.Fatalf("bad migrations: %v", ms)
+	}
+	pending, err := r.pending([]DynamoDrifterMigration{{Number: 0}, {Number: 5}})
+	if err != nil || len(pending) != 2 || pending[0].Number != 1 || pending[1].Number != 2 {
+		t.Fatalf("bad pending migrations: %v, %v", pending, err)
+	}
+}
+
+func TestRegistryCollisions(t *testing.T) {
+	cb := func(item RawDynamoItem, action *DrifterAction) error { return nil }
+	r := &Registry{}
+	first, err := TimestampNumber(time.Date(2024, 5, 15, 12, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("error numbering migration: %v", err)
+	}
+	if err := r.Register(&DynamoDrifterMigration{Number: first, TableName: "a", Description: "add foo", Callback: cb}); err != nil {
+		t.Fatalf("error registering: %v", err)
+	}
+	err = r.Register(&DynamoDrifterMigration{Number: first, TableName: "b", Description: "add bar", Callback: cb})
+	if !errors.Is(err, ErrNumberCollision) {
+		t.Fatalf("duplicate numbers should collide: %v", err)
+	}
+	if err := r.Register(&DynamoDrifterMigration{Number: 1, TableName: "b", Callback: cb}); err != nil {
+		t.Fatalf("error registering: %v", err)
+	}
+	for _, applied := range [][]DynamoDrifterMigration{
+		{{Number: first, TableName: "b"}},
+		{{Number: first, TableName: "a", Description: "add bar"}},
+	} {
+		if _, err := r.pending(applied); !errors.Is(err, ErrNumberCollision) {
+			t.Fatalf("%+v should collide: %v", applied, err)
+		}
+	}
+	pending, err := r.pending([]DynamoDrifterMigration{{Number: first, TableName: "a"}, {Number: 2}})
+	if err != nil || len(pending) != 1 || pending[0].Number != 1 {
+		t.Fatalf("migrations numbered below applied ones should be pending: %v, %v", pending, err)
+	}
+}
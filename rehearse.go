@@ -0,0 +1,108 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// RehearsalOptions are the options of a rehearsal, see DynamoDrifter.Rehearse
+type RehearsalOptions struct {
+	SampleSize       uint   // Number of items of the migration table copied into the clone (optional, defaults to none)
+	Concurrency      uint   // See DynamoDrifter.Run
+	FailOnFirstError bool   // See DynamoDrifter.Run
+	ReadCapacity     int64  // Provisioned read capacity of the clone and its indexes (optional, defaults to 10)
+	WriteCapacity    int64  // Provisioned write capacity of the clone and its indexes (optional, defaults to 10)
+	KeepClone        bool   // Don't delete the clone after the rehearsal (ex: to inspect the migrated items), it can be deleted later with Cleanup
+	RunID            string // Run ID under which the clone is tracked (optional, defaults to NewRunID())
+}
+
+// RehearsalReport is the result of a rehearsal. Reports are encoded in JSON as documented by ReportVersion.
+type RehearsalReport struct {
+	RunID              string        `json:"run_id"`              // Run ID under which the clone is tracked, see DynamoDrifter.Cleanup
+	Clone              string        `json:"clone"`               // Name of the clone table
+	ItemsCopied        uint          `json:"items_copied"`        // Items copied from the migration table into the clone
+	ItemsAfter         int64         `json:"items_after"`         // Items in the clone after the migration
+	CallbacksProcessed uint          `json:"callbacks_processed"` // Items processed by callbacks
+	ActionsExecuted    uint          `json:"actions_executed"`    // Actions executed on the clone
+	Errors             []error       `json:"-"`                   // Errors of the migration (as returned by Run)
+	Duration           time.Duration `json:"-"`                   // Duration of the migration (excluding cloning)
+}
+
+// Rehearse runs migration for real against a temporary clone of its table: the table is cloned (see CloneTable) with opts.SampleSize
+// of its items, then the migration is run on the clone (its actions
+// on the migration table are applied to the clone instead, and actions on other tables fail) and the clone is deleted.
+// The migration isn't recorded in the meta table, only the clone is while it exists (see Cleanup). Callbacks may still read other tables.
+// Multi-step migrations can't be rehearsed.
+// The returned error is about the rehearsal itself (ex: cloning), errors of the migration are in the report.
+func (dd *DynamoDrifter) Rehearse(ctx context.Context, migration *DynamoDrifterMigration, opts RehearsalOptions) (*RehearsalReport, error) {
+	if err := checkClient(dd.DynamoDB, "CreateTableRequest", "DeleteTableRequest"); err != nil {
+		return nil, err
+	}
+	if migration != nil && len(migration.Steps) > 0 {
+		return nil, fmt.Errorf("multi-step migrations can't be rehearsed")
+	}
+	if err := validateMigration(migration); err != nil {
+		return nil, err
+	}
+	if dd.AutoCleanup > 0 {
+		dd.cleanup(ctx, "", dd.AutoCleanup) // best effort, resources which can't be deleted are retried next time
+	}
+	report := &RehearsalReport{RunID: opts.RunID, Clone: fmt.Sprintf("%v-rehearsal-%v", migration.TableName, time.Now().UTC().UnixNano())}
+	if report.RunID == "" {
+		report.RunID = NewRunID()
+	}
+	clone, err := dd.trackResource(ctx, report.RunID, ResourceTable, report.Clone)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.KeepClone {
+		defer dd.releaseResource(context.Background(), *clone) // best effort (ctx may be done), the clone stays tracked if it fails
+	}
+	report.ItemsCopied, err = dd.CloneTable(ctx, migration.TableName, report.Clone, CloneOptions{
+		CopyItems:     opts.SampleSize > 0,
+		SampleSize:    opts.SampleSize,
+		ReadCapacity:  opts.ReadCapacity,
+		WriteCapacity: opts.WriteCapacity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := *migration
+	m.TableName = report.Clone
+	m.clones = map[string]string{migration.TableName: report.Clone, report.Clone: report.Clone}
+	pc, stop := tapProgress(nil, time.Hour, func(mp *MigrationProgress) {
+		if mp.CallbacksProcessed != 0 {
+			report.CallbacksProcessed = mp.CallbacksProcessed
+		}
+		if mp.ActionsExecuted != 0 {
+			report.ActionsExecuted = mp.ActionsExecuted
+		}
+	}, func() {})
+	start := time.Now()
+	report.Errors = dd.run(ctx, &m, opts.Concurrency, opts.FailOnFirstError, nil, pc)
+	report.Duration = time.Since(start)
+	stop()
+	report.ItemsAfter, err = dd.countItems(ctx, report.Clone)
+	return report, err
+}
+
+// countItems counts the items of table with a scan
+func (dd *DynamoDrifter) countItems(ctx context.Context, table string) (int64, error) {
+	var count int64
+	si := &dynamodb.ScanInput{TableName: aws.String(table), Select: aws.String(dynamodb.SelectCount)}
+	for {
+		req, so := dd.DynamoDB.ScanRequest(si)
+		if err := dd.send(ctx, req); err != nil {
+			return count, fmt.Errorf("error counting items of %v: %v", table, err)
+		}
+		count += aws.Int64Value(so.Count)
+		if len(so.LastEvaluatedKey) == 0 {
+			return count, nil
+		}
+		si.ExclusiveStartKey = so.LastEvaluatedKey
+	}
+}
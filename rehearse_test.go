@@ -0,0 +1,30 @@
+package drift
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestRehearsalActions(t *testing.T) {
+	dd := &DynamoDrifter{}
+	da := &DrifterAction{clones: map[string]string{"users": "users-rehearsal", "users-rehearsal": "users-rehearsal"}}
+	a := &action{atype: deleteAction, keys: RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}, tableName: "orders"}
+	if err := dd.doAction(context.Background(), a, "users-rehearsal", da); err == nil || !strings.Contains(err.Error(), "isn't cloned") {
+		t.Fatalf("actions on other tables should fail: %v", err)
+	}
+}
+
+func TestRehearseValidation(t *testing.T) {
+	dd := &DynamoDrifter{DynamoDB: getTestDDBClient()}
+	m := &DynamoDrifterMigration{Number: 1, TableName: "users", Steps: []MigrationStep{{Name: "a", Callback: testMigrateUp}}}
+	if _, err := dd.Rehearse(context.Background(), m, RehearsalOptions{}); err == nil || !strings.Contains(err.Error(), "multi-step") {
+		t.Fatalf("multi-step migrations should be rejected: %v", err)
+	}
+	if _, err := dd.Rehearse(context.Background(), nil, RehearsalOptions{}); err == nil {
+		t.Fatalf("nil migration should be rejected")
+	}
+}
@@ -0,0 +1,151 @@
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ReportVersion is the version of the JSON schema of plans and reports. It changes only when the schema changes incompatibly: fields may
+// be added within a version, so parsers should ignore unknown fields.
+//
+// Plans and reports are JSON objects with a "version" (ReportVersion) and a "kind" (ReportKindPlan, ...), followed by the fields of the
+// plan or report with their JSON names (ex: "items_scanned"). Errors are encoded as their messages, durations as fractional seconds,
+// and items and attribute values in the DynamoDB JSON format (ex: {"ID": {"N": "1"}}).
+const ReportVersion = 1
+
+// Kinds of JSON plans and reports
+const (
+	ReportKindPlan      = "plan"      // Plan
+	ReportKindRehearsal = "rehearsal" // RehearsalReport
+)
+
+// dynamoJSON encodes v (an item or attribute value) in the DynamoDB JSON format, or null if it is nil
+func dynamoJSON(v interface{}) (json.RawMessage, error) {
+	switch v := v.(type) {
+	case RawDynamoItem:
+		if v == nil {
+			return json.RawMessage("null"), nil
+		}
+	case *dynamodb.AttributeValue:
+		if v == nil {
+			return json.RawMessage("null"), nil
+		}
+	}
+	b, err := jsonutil.BuildJSON(v)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %T: %v", v, err)
+	}
+	return json.RawMessage(b), nil
+}
+
+// errorStrings returns the messages of errs
+func errorStrings(errs []error) []string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return msgs
+}
+
+// MarshalJSON implements json.Marshaler
+func (ac AttributeChange) MarshalJSON() ([]byte, error) {
+	before, err := dynamoJSON(ac.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := dynamoJSON(ac.After)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Attribute string          `json:"attribute"`
+		Before    json.RawMessage `json:"before"`
+		After     json.RawMessage `json:"after"`
+	}{ac.Attribute, before, after})
+}
+
+// MarshalJSON implements json.Marshaler
+func (d ItemDiff) MarshalJSON() ([]byte, error) {
+	items := make([]json.RawMessage, 3)
+	for i, item := range []RawDynamoItem{d.Key, d.Before, d.After} {
+		var err error
+		if items[i], err = dynamoJSON(item); err != nil {
+			return nil, err
+		}
+	}
+	changes := d.Changes
+	if changes == nil {
+		changes = []AttributeChange{}
+	}
+	return json.Marshal(struct {
+		Key         json.RawMessage   `json:"key"`
+		Before      json.RawMessage   `json:"before"`
+		After       json.RawMessage   `json:"after"`
+		Changes     []AttributeChange `json:"changes"`
+		Conditional bool              `json:"conditional"`
+		Error       string            `json:"error,omitempty"`
+	}{items[0], items[1], items[2], changes, d.Conditional, d.Error})
+}
+
+// MarshalJSON implements json.Marshaler
+func (pa PlannedAction) MarshalJSON() ([]byte, error) {
+	type planned PlannedAction // without methods
+	items := map[string]json.RawMessage{}
+	for name, item := range map[string]RawDynamoItem{"key": pa.Key, "item": pa.Item, "expression_attribute_values": pa.ExpressionAttributeValues} {
+		if item == nil {
+			continue
+		}
+		var err error
+		if items[name], err = dynamoJSON(item); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(struct {
+		planned
+		Key    json.RawMessage `json:"key,omitempty"`
+		Item   json.RawMessage `json:"item,omitempty"`
+		Values json.RawMessage `json:"expression_attribute_values,omitempty"`
+	}{planned(pa), items["key"], items["item"], items["expression_attribute_values"]})
+}
+
+// MarshalJSON implements json.Marshaler, see ReportVersion
+func (p *Plan) MarshalJSON() ([]byte, error) {
+	type plan Plan // without methods
+	cp := plan(*p)
+	if cp.Actions == nil {
+		cp.Actions = map[string]ActionCounts{}
+	}
+	if cp.Expressions == nil {
+		cp.Expressions = []PlanExpression{}
+	}
+	if cp.Guardrails == nil {
+		cp.Guardrails = []GuardrailCheck{}
+	}
+	if cp.Diffs == nil {
+		cp.Diffs = []ItemDiff{}
+	}
+	if cp.Operations == nil {
+		cp.Operations = []PlannedAction{}
+	}
+	return json.Marshal(struct {
+		Version int    `json:"version"`
+		Kind    string `json:"kind"`
+		*plan
+		Errors []string `json:"errors"`
+	}{ReportVersion, ReportKindPlan, &cp, errorStrings(p.Errors)})
+}
+
+// MarshalJSON implements json.Marshaler, see ReportVersion
+func (rr *RehearsalReport) MarshalJSON() ([]byte, error) {
+	type report RehearsalReport // without methods
+	return json.Marshal(struct {
+		Version int    `json:"version"`
+		Kind    string `json:"kind"`
+		*report
+		Errors   []string `json:"errors"`
+		Duration float64  `json:"duration_seconds"`
+	}{ReportVersion, ReportKindRehearsal, (*report)(rr), errorStrings(rr.Errors), rr.Duration.Seconds()})
+}
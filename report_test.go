@@ -0,0 +1,71 @@
+package drift
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestPlanJSON(t *testing.T) {
+	key := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	name := &dynamodb.AttributeValue{S: aws.String("a")}
+	p := &Plan{
+		Number:       3,
+		TableName:    "users",
+		ItemsScanned: 2,
+		Actions:      map[string]ActionCounts{"users": {Updates: 1, Deletes: 1}},
+		Expressions:  []PlanExpression{{"users", "SET #n = :n", 1}},
+		Guardrails:   []GuardrailCheck{{Name: "MaxDeletes", Limit: 1, Value: 1}},
+		Diffs: []ItemDiff{
+			{Key: key, Before: RawDynamoItem{"ID": key["ID"]}, After: RawDynamoItem{"ID": key["ID"], "Name": name},
+				Changes: []AttributeChange{{Attribute: "Name", After: name}}},
+			{Key: key, Before: RawDynamoItem{"ID": key["ID"]}, Error: "unsupported function size"},
+		},
+		Operations: []PlannedAction{
+			{Type: "update", TableName: "users", Key: key, UpdateExpression: "SET #n = :n", ExpressionAttributeNames: map[string]*string{"#n": aws.String("Name")},
+				ExpressionAttributeValues: RawDynamoItem{":n": name}},
+			{Type: "delete", TableName: "users", Key: key},
+		},
+		Errors: []error{errors.New("bad item")},
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		t.Fatalf("error marshaling plan: %v", err)
+	}
+	expected, err := os.ReadFile("testdata/plan.json")
+	if err != nil {
+		t.Fatalf("error reading golden plan: %v", err)
+	}
+	if !bytes.Equal(append(b, '\n'), expected) {
+		t.Fatalf("bad JSON plan:\n%s", b)
+	}
+}
+
+func TestRehearsalReportJSON(t *testing.T) {
+	rr := &RehearsalReport{RunID: "r", Clone: "users-rehearsal-1", ItemsCopied: 2, Duration: 1500 * time.Millisecond}
+	b, err := json.Marshal(rr)
+	if err != nil {
+		t.Fatalf("error marshaling report: %v", err)
+	}
+	expected := `{"version":1,"kind":"rehearsal","run_id":"r","clone":"users-rehearsal-1","items_copied":2,"items_after":0,"callbacks_processed":0,"actions_executed":0,"errors":[],"duration_seconds":1.5}`
+	if string(b) != expected {
+		t.Fatalf("bad JSON report: %s", b)
+	}
+}
+
+func TestEmptyPlanJSON(t *testing.T) {
+	b, err := json.Marshal(&Plan{Number: 1, TableName: "users"})
+	if err != nil {
+		t.Fatalf("error marshaling plan: %v", err)
+	}
+	expected := `{"version":1,"kind":"plan","number":1,"tablename":"users","description":"","items_scanned":0,"actions":{},"expressions":[],"guardrails":[],"diffs":[],"operations":[],"errors":[]}`
+	if string(b) != expected {
+		t.Fatalf("bad JSON plan: %s", b)
+	}
+}
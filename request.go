@@ -0,0 +1,143 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// RequestOption customizes a DynamoDB request made by drift before it is sent. It can be used to add headers, add handlers (custom signing, logging, routing through a proxy), etc.
+type RequestOption func(*request.Request)
+
+// WithRequestHeader returns a RequestOption that sets an HTTP header on every request
+func WithRequestHeader(key, value string) RequestOption {
+	return func(r *request.Request) {
+		r.HTTPRequest.Header.Set(key, value)
+	}
+}
+
+// send applies the configured retryer and request options to req and sends it, bound to ctx. If ctx carries the reporter of a run, the
+// consumed capacity and failed attempts of req are recorded in the run report.
+func (dd *DynamoDrifter) send(ctx context.Context, req *request.Request) error {
+	if ctx != nil && req.HTTPRequest != nil {
+		req.HTTPRequest = req.HTTPRequest.WithContext(ctx)
+	}
+	if dd.Retryer != nil {
+		req.Retryer = dd.Retryer
+	}
+	for _, opt := range dd.RequestOptions {
+		opt(req)
+	}
+	r := reporterFrom(ctx)
+	if r == nil {
+		return req.Send()
+	}
+	r.attach(req)
+	if err := req.Send(); err != nil {
+		return err
+	}
+	r.record(req)
+	return nil
+}
+
+// operationRequester is implemented by DynamoDB clients making requests of any operation, such as *dynamodb.DynamoDB. drift needs it for
+// the operations the vendored SDK predates (TransactWriteItems and TTL).
+type operationRequester interface {
+	NewRequest(operation *request.Operation, params interface{}, data interface{}) *request.Request
+}
+
+// newRequest returns a request of operation name made by the DynamoDB client, which must be an operationRequester
+func (dd *DynamoDrifter) newRequest(name string, params, data interface{}) (*request.Request, error) {
+	c, ok := dd.DynamoDB.(operationRequester)
+	if !ok {
+		return nil, fmt.Errorf("%v requires a DynamoDB client implementing NewRequest (ex: *dynamodb.DynamoDB), not %T", name, dd.DynamoDB)
+	}
+	return c.NewRequest(&request.Operation{Name: name, HTTPMethod: "POST", HTTPPath: "/"}, params, data), nil
+}
+
+// requestMethods call the request methods of the DynamoDB client drift makes its requests with, by name, see checkClient
+var requestMethods = map[string]func(c dynamodbiface.DynamoDBAPI) *request.Request{
+	"BatchWriteItemRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.BatchWriteItemRequest(&dynamodb.BatchWriteItemInput{})
+		return req
+	},
+	"CreateTableRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.CreateTableRequest(&dynamodb.CreateTableInput{})
+		return req
+	},
+	"DeleteItemRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.DeleteItemRequest(&dynamodb.DeleteItemInput{})
+		return req
+	},
+	"DeleteTableRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.DeleteTableRequest(&dynamodb.DeleteTableInput{})
+		return req
+	},
+	"DescribeTableRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.DescribeTableRequest(&dynamodb.DescribeTableInput{})
+		return req
+	},
+	"GetItemRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.GetItemRequest(&dynamodb.GetItemInput{})
+		return req
+	},
+	"ListTablesRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.ListTablesRequest(&dynamodb.ListTablesInput{})
+		return req
+	},
+	"PutItemRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.PutItemRequest(&dynamodb.PutItemInput{})
+		return req
+	},
+	"ScanRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.ScanRequest(&dynamodb.ScanInput{})
+		return req
+	},
+	"UpdateItemRequest": func(c dynamodbiface.DynamoDBAPI) *request.Request {
+		req, _ := c.UpdateItemRequest(&dynamodb.UpdateItemInput{})
+		return req
+	},
+}
+
+// clientRequestMethods are the request methods every DynamoDB client must implement, those of item operations and DescribeTable
+var clientRequestMethods = []string{"GetItemRequest", "PutItemRequest", "UpdateItemRequest", "DeleteItemRequest", "BatchWriteItemRequest", "ScanRequest", "DescribeTableRequest"}
+
+// checkClient checks that c is set and implements clientRequestMethods and methods (those of table operations, ex: "CreateTableRequest").
+// Mocks embedding dynamodbiface.DynamoDBAPI often only implement the methods sending requests (ex: Scan), the others would panic in the
+// middle of a run.
+func checkClient(c dynamodbiface.DynamoDBAPI, methods ...string) error {
+	if c == nil {
+		return fmt.Errorf("DynamoDB client is required")
+	}
+	for _, name := range append(clientRequestMethods, methods...) {
+		if err := checkRequestMethod(c, name, requestMethods[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRequestMethod checks that the request method name of c, called by f, returns a request (without sending it)
+func checkRequestMethod(c dynamodbiface.DynamoDBAPI, name string, f func(c dynamodbiface.DynamoDBAPI) *request.Request) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("DynamoDB client %T doesn't implement %v, which drift makes its requests with (mocks implementing the methods "+
+				"sending requests can be wrapped with drifttest.MockClient): %v", c, name, r)
+		}
+	}()
+	if req := f(c); req == nil || req.HTTPRequest == nil {
+		return fmt.Errorf("DynamoDB client %T returned no request from %v, which drift makes its requests with", c, name)
+	}
+	return nil
+}
+
+// sendContext sends req bound to ctx, for requests of other services than DynamoDB (see DynamoDrifter.send)
+func sendContext(ctx context.Context, req *request.Request) error {
+	if ctx != nil && req.HTTPRequest != nil {
+		req.HTTPRequest = req.HTTPRequest.WithContext(ctx)
+	}
+	return req.Send()
+}
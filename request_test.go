@@ -0,0 +1,236 @@
+package drift
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+func getTestHTTPDDBClient(url string) *dynamodb.DynamoDB {
+	creds := credentials.NewStaticCredentials("foo", "bar", "")
+	sess := session.New(aws.NewConfig().WithRegion("us-west-2").WithMaxRetries(0).WithCredentials(creds))
+	return dynamodb.New(sess, &aws.Config{Endpoint: aws.String(url)})
+}
+
+type testRetryer struct {
+	retries int32
+}
+
+func (tr *testRetryer) RetryRules(*request.Request) time.Duration { return 0 }
+func (tr *testRetryer) ShouldRetry(r *request.Request) bool {
+	atomic.AddInt32(&tr.retries, 1)
+	return r.HTTPResponse != nil && r.HTTPResponse.StatusCode >= 500
+}
+func (tr *testRetryer) MaxRetries() int { return 1 }
+
+func TestRequestOptions(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Migration-Job") != "test" {
+			t.Errorf("missing header: %v", r.Header)
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"__type":"InternalFailure","message":"oops"}`))
+			return
+		}
+		w.Write([]byte(`{"TableNames":["foo"]}`))
+	}))
+	defer srv.Close()
+	tr := &testRetryer{}
+	dd := DynamoDrifter{
+		MetaTableName:  testMetaTable,
+		DynamoDB:       getTestHTTPDDBClient(srv.URL),
+		Retryer:        tr,
+		RequestOptions: []RequestOption{WithRequestHeader("X-Migration-Job", "test")},
+	}
+	ok, err := dd.findTable("foo")
+	if err != nil {
+		t.Fatalf("error finding table: %v", err)
+	}
+	if !ok {
+		t.Fatalf("table should have been found")
+	}
+	if atomic.LoadInt32(&tr.retries) != 1 || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("custom retryer not used: %v retries, %v calls", tr.retries, calls)
+	}
+}
+
+// mockDDB is a DynamoDB mock answering the requests of a migration of a table of items with a string hash key "ID"
+type mockDDB struct {
+	dynamodbiface.DynamoDBAPI
+	sync.Mutex
+	tables map[string]map[string]RawDynamoItem
+}
+
+// mockRequest returns a request of operation name which calls f when sent
+func mockRequest(name string, in, out interface{}, f func()) *request.Request {
+	req := request.New(aws.Config{}, metadata.ClientInfo{}, request.Handlers{}, nil, &request.Operation{Name: name}, in, out)
+	req.Handlers.Send.PushBack(func(*request.Request) { f() })
+	return req
+}
+
+// mockUnsupported returns a request of operation name which fails when sent
+func mockUnsupported(name string, in, out interface{}) *request.Request {
+	req := mockRequest(name, in, out, func() {})
+	req.Handlers.Send.PushBack(func(r *request.Request) { r.Error = awserr.New("UnsupportedOperation", name+" isn't mocked", nil) })
+	return req
+}
+
+func (m *mockDDB) table(name *string) map[string]RawDynamoItem {
+	if m.tables[*name] == nil {
+		m.tables[*name] = map[string]RawDynamoItem{}
+	}
+	return m.tables[*name]
+}
+
+func (m *mockDDB) ListTablesRequest(in *dynamodb.ListTablesInput) (*request.Request, *dynamodb.ListTablesOutput) {
+	out := &dynamodb.ListTablesOutput{}
+	return mockRequest("ListTables", in, out, func() {
+		m.Lock()
+		defer m.Unlock()
+		for name := range m.tables {
+			out.TableNames = append(out.TableNames, aws.String(name))
+		}
+	}), out
+}
+
+func (m *mockDDB) GetItemRequest(in *dynamodb.GetItemInput) (*request.Request, *dynamodb.GetItemOutput) {
+	out := &dynamodb.GetItemOutput{}
+	return mockRequest("GetItem", in, out, func() {
+		m.Lock()
+		defer m.Unlock()
+		for _, v := range in.Key {
+			out.Item = m.table(in.TableName)[v.String()]
+		}
+	}), out
+}
+
+func (m *mockDDB) PutItemRequest(in *dynamodb.PutItemInput) (*request.Request, *dynamodb.PutItemOutput) {
+	out := &dynamodb.PutItemOutput{}
+	return mockRequest("PutItem", in, out, func() {
+		m.Lock()
+		defer m.Unlock()
+		key := in.Item["ID"]
+		if key == nil {
+			key = in.Item["Number"] // meta table
+		}
+		m.table(in.TableName)[key.String()] = in.Item
+	}), out
+}
+
+func (m *mockDDB) DeleteItemRequest(in *dynamodb.DeleteItemInput) (*request.Request, *dynamodb.DeleteItemOutput) {
+	out := &dynamodb.DeleteItemOutput{}
+	return mockRequest("DeleteItem", in, out, func() {
+		m.Lock()
+		defer m.Unlock()
+		for _, v := range in.Key {
+			delete(m.table(in.TableName), v.String())
+		}
+	}), out
+}
+
+// UpdateItemRequest, BatchWriteItemRequest and DescribeTableRequest fail, the mocked migration doesn't need them
+func (m *mockDDB) UpdateItemRequest(in *dynamodb.UpdateItemInput) (*request.Request, *dynamodb.UpdateItemOutput) {
+	out := &dynamodb.UpdateItemOutput{}
+	return mockUnsupported("UpdateItem", in, out), out
+}
+
+func (m *mockDDB) BatchWriteItemRequest(in *dynamodb.BatchWriteItemInput) (*request.Request, *dynamodb.BatchWriteItemOutput) {
+	out := &dynamodb.BatchWriteItemOutput{}
+	return mockUnsupported("BatchWriteItem", in, out), out
+}
+
+func (m *mockDDB) DescribeTableRequest(in *dynamodb.DescribeTableInput) (*request.Request, *dynamodb.DescribeTableOutput) {
+	out := &dynamodb.DescribeTableOutput{}
+	return mockUnsupported("DescribeTable", in, out), out
+}
+
+func (m *mockDDB) ScanRequest(in *dynamodb.ScanInput) (*request.Request, *dynamodb.ScanOutput) {
+	out := &dynamodb.ScanOutput{}
+	return mockRequest("Scan", in, out, func() {
+		m.Lock()
+		defer m.Unlock()
+		if aws.Int64Value(in.Segment) != 0 {
+			return
+		}
+		for _, item := range m.table(in.TableName) {
+			out.Items = append(out.Items, item)
+		}
+	}), out
+}
+
+func TestMockDynamoDB(t *testing.T) {
+	db := &mockDDB{tables: map[string]map[string]RawDynamoItem{
+		testMetaTable: {},
+		"users": {
+			"1": {"ID": {S: aws.String("1")}, "Name": {S: aws.String("Jane")}},
+			"2": {"ID": {S: aws.String("2")}, "Name": {S: aws.String("John")}},
+		},
+	}}
+	dd := DynamoDrifter{MetaTableName: testMetaTable, DynamoDB: db}
+	m := &DynamoDrifterMigration{
+		Number:    1,
+		TableName: "users",
+		Callback: func(item RawDynamoItem, action *DrifterAction) error {
+			item["Greeting"] = &dynamodb.AttributeValue{S: aws.String("Hello " + aws.StringValue(item["Name"].S))}
+			return action.Insert(item, "")
+		},
+	}
+	if errs := dd.Run(context.Background(), m, 1, true, nil); len(errs) != 0 {
+		t.Fatalf("errors running migration: %v", errs)
+	}
+	if g := aws.StringValue(db.tables["users"]["2"]["Greeting"].S); g != "Hello John" {
+		t.Fatalf("bad greeting: %v", g)
+	}
+	rec, err := dd.getMetaItem(1)
+	if err != nil {
+		t.Fatalf("error getting meta record: %v", err)
+	}
+	if rec == nil || rec.InProgress || rec.ItemsProcessed != 2 {
+		t.Fatalf("bad meta record: %+v", rec)
+	}
+	if _, err := dd.newRequest("TransactWriteItems", &transactWriteItemsInput{}, &transactWriteItemsOutput{}); err == nil {
+		t.Fatalf("transactions should require NewRequest")
+	}
+}
+
+// scanOnlyDDB is a mock implementing Scan only, not the request methods drift makes its requests with
+type scanOnlyDDB struct {
+	dynamodbiface.DynamoDBAPI
+}
+
+func (scanOnlyDDB) Scan(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func TestCheckClient(t *testing.T) {
+	dd := DynamoDrifter{MetaTableName: testMetaTable, DynamoDB: scanOnlyDDB{}}
+	m := &DynamoDrifterMigration{Number: 1, TableName: "users", Callback: testMigrateUp}
+	if errs := dd.Run(context.Background(), m, 1, true, nil); len(errs) != 1 || !strings.Contains(errs[0].Error(), "doesn't implement GetItemRequest") {
+		t.Fatalf("run with a client lacking request methods should fail: %v", errs)
+	}
+	if err := checkClient(&mockDDB{}); err != nil {
+		t.Fatalf("mock should implement the request methods of runs: %v", err)
+	}
+	if err := checkClient(&mockDDB{}, "CreateTableRequest"); err == nil || !strings.Contains(err.Error(), "CreateTableRequest") {
+		t.Fatalf("mock should not implement CreateTableRequest: %v", err)
+	}
+	if err := checkClient(nil); err == nil {
+		t.Fatalf("nil client should fail")
+	}
+}
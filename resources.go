@@ -0,0 +1,146 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Kinds of temporary resources
+const (
+	ResourceTable = "table" // DynamoDB table (ex: the clone of a rehearsal)
+)
+
+// TempResource is a temporary resource created by a run (ex: the clone table of a rehearsal). Temporary resources are tracked in the meta table
+// until they are deleted, so those left behind by failed or interrupted runs can be cleaned up (see DynamoDrifter.Cleanup).
+type TempResource struct {
+	Number  int64     `dynamodbav:"Number" json:"-"` // Key of the tracking record, negative so it can't collide with migrations
+	RunID   string    `dynamodbav:"RunID" json:"run_id"`
+	Kind    string    `dynamodbav:"Kind" json:"kind"`
+	Name    string    `dynamodbav:"Name" json:"name"`
+	Created time.Time `dynamodbav:"Created" json:"created"`
+}
+
+// NewRunID returns a new identifier for the temporary resources of a run
+func NewRunID() string {
+	return strconv.FormatInt(time.Now().UTC().UnixNano(), 36)
+}
+
+// trackResource records a temporary resource of run runID, before it is created
+func (dd *DynamoDrifter) trackResource(ctx context.Context, runID, kind, name string) (*TempResource, error) {
+	r := &TempResource{Number: -time.Now().UTC().UnixNano(), RunID: runID, Kind: kind, Name: name, Created: time.Now().UTC()}
+	for {
+		item, err := dynamodbattribute.MarshalMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling temporary resource: %v", err)
+		}
+		req, _ := dd.DynamoDB.PutItemRequest(&dynamodb.PutItemInput{
+			TableName:                &dd.MetaTableName,
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(#n)"),
+			ExpressionAttributeNames: map[string]*string{"#n": aws.String("Number")},
+		})
+		err = dd.send(ctx, req)
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+			r.Number-- // taken by a concurrent run
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error tracking temporary %v %v: %v", kind, name, err)
+		}
+		return r, nil
+	}
+}
+
+// releaseResource deletes a temporary resource (if it still exists) and its tracking record
+func (dd *DynamoDrifter) releaseResource(ctx context.Context, r TempResource) error {
+	switch r.Kind {
+	case ResourceTable:
+		req, _ := dd.DynamoDB.DeleteTableRequest(&dynamodb.DeleteTableInput{TableName: aws.String(r.Name)})
+		err := dd.send(ctx, req)
+		var aerr awserr.Error
+		if err != nil && !(errors.As(err, &aerr) && aerr.Code() == "ResourceNotFoundException") {
+			return fmt.Errorf("error deleting temporary table %v: %v", r.Name, err)
+		}
+	default:
+		return fmt.Errorf("unknown kind of temporary resource %v: %v", r.Name, r.Kind)
+	}
+	req, _ := dd.DynamoDB.DeleteItemRequest(&dynamodb.DeleteItemInput{
+		TableName: &dd.MetaTableName,
+		Key:       map[string]*dynamodb.AttributeValue{"Number": &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(r.Number, 10))}},
+	})
+	if err := dd.send(ctx, req); err != nil {
+		return fmt.Errorf("error deleting tracking record of temporary %v %v: %v", r.Kind, r.Name, err)
+	}
+	return nil
+}
+
+// TempResources returns the temporary resources of run runID (or of all runs if runID is empty) which haven't been deleted
+func (dd *DynamoDrifter) TempResources(ctx context.Context, runID string) ([]TempResource, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	si := &dynamodb.ScanInput{
+		TableName:                 &dd.MetaTableName,
+		FilterExpression:          aws.String("#n < :zero AND attribute_exists(#r)"),
+		ExpressionAttributeNames:  map[string]*string{"#n": aws.String("Number"), "#r": aws.String("RunID")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":zero": &dynamodb.AttributeValue{N: aws.String("0")}},
+	}
+	if runID != "" {
+		si.FilterExpression = aws.String("#n < :zero AND #r = :r")
+		si.ExpressionAttributeValues[":r"] = &dynamodb.AttributeValue{S: aws.String(runID)}
+	}
+	rs := []TempResource{}
+	for {
+		req, out := dd.DynamoDB.ScanRequest(si)
+		if err := dd.send(ctx, req); err != nil {
+			return nil, fmt.Errorf("error listing temporary resources: %v", err)
+		}
+		for _, item := range out.Items {
+			r := TempResource{}
+			if err := dynamodbattribute.UnmarshalMap(item, &r); err != nil {
+				return nil, fmt.Errorf("error unmarshaling temporary resource: %v", err)
+			}
+			rs = append(rs, r)
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return rs, nil
+		}
+		si.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// Cleanup deletes the temporary resources of run runID (or of all runs if runID is empty), such as the clones of failed rehearsals
+// or those kept with RehearsalOptions.KeepClone. Resources which can't be deleted remain tracked, and their errors are joined.
+func (dd *DynamoDrifter) Cleanup(ctx context.Context, runID string) error {
+	return dd.cleanup(ctx, runID, 0)
+}
+
+// cleanup deletes the temporary resources of run runID (or of all runs if runID is empty) created more than minAge ago
+func (dd *DynamoDrifter) cleanup(ctx context.Context, runID string, minAge time.Duration) error {
+	if err := checkClient(dd.DynamoDB, "DeleteTableRequest"); err != nil {
+		return err
+	}
+	rs, err := dd.TempResources(ctx, runID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range rs {
+		if time.Since(r.Created) < minAge {
+			continue
+		}
+		if err := dd.releaseResource(ctx, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,23 @@
+package drift
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewRunID(t *testing.T) {
+	a, b := NewRunID(), NewRunID()
+	if a == "" || a == b {
+		t.Fatalf("run IDs should be unique: %v, %v", a, b)
+	}
+}
+
+func TestTempResourcesValidation(t *testing.T) {
+	dd := &DynamoDrifter{}
+	if _, err := dd.TempResources(context.Background(), ""); err == nil {
+		t.Fatalf("missing client should fail")
+	}
+	if err := dd.Cleanup(context.Background(), "run"); err == nil {
+		t.Fatalf("missing client should fail")
+	}
+}
@@ -0,0 +1,199 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// MigrationResult is the result of a run of a migration (see RunWithResult and UndoWithResult), with the statistics of the run
+type MigrationResult struct {
+	Number   uint
+	Undo     bool
+	Skipped  bool // The migration was applied by another process while the run waited for the lock (see LockPolicy)
+	Started  time.Time
+	Finished time.Time
+
+	// Totals of the run (across all scans of multi-step migrations)
+	ItemsScanned       uint            // Items read by scans, including those skipped by Idempotent migrations
+	CallbacksSucceeded uint            // Items (or pages, for BatchCallback) processed by callbacks without error
+	CallbacksFailed    uint            // Items (or pages) whose callback failed
+	ActionsQueued      map[string]uint // Actions queued by callbacks, by type ("update", "insert", "delete" or "condition check")
+	ActionsExecuted    map[string]uint // Actions applied (or skipped because their UpdateBuilder.If condition failed), by type
+
+	Tables map[string]*TableReport // DynamoDB requests of the run and their consumed capacity, by table
+	Errors []*ResultError          // Errors of the run, in the order Run/Undo returns them
+
+	phaseErrors []*ResultError // errors of the phases of the run, see reporter.failed
+}
+
+// ResultError is an error of a run, see MigrationResult
+type ResultError struct {
+	Phase string     // PhaseCallbacks or PhaseActions, "" for errors of the run itself (ex: the table doesn't exist)
+	Class ErrorClass // See ClassifyError
+	Err   error      // Errors of actions are ActionErrors (use errors.As)
+}
+
+func (re *ResultError) Error() string {
+	return re.Err.Error()
+}
+
+// Unwrap returns the error of the run
+func (re *ResultError) Unwrap() error {
+	return re.Err
+}
+
+// Duration returns the duration of the run
+func (mr *MigrationResult) Duration() time.Duration {
+	return mr.Finished.Sub(mr.Started)
+}
+
+// Succeeded returns whether the run succeeded
+func (mr *MigrationResult) Succeeded() bool {
+	return len(mr.Errors) == 0
+}
+
+// Errs returns the errors of the run, as returned by Run/Undo
+func (mr *MigrationResult) Errs() []error {
+	errs := make([]error, len(mr.Errors))
+	for i, re := range mr.Errors {
+		errs[i] = re.Err
+	}
+	return errs
+}
+
+// ActionErrors returns the errors of the actions which failed
+func (mr *MigrationResult) ActionErrors() []*ActionError {
+	out := []*ActionError{}
+	for _, re := range mr.Errors {
+		var ae *ActionError
+		if errors.As(re.Err, &ae) {
+			out = append(out, ae)
+		}
+	}
+	return out
+}
+
+// CapacityUnits returns the read and write capacity consumed by the run, on all tables
+func (mr *MigrationResult) CapacityUnits() (float64, float64) {
+	var rcu, wcu float64
+	for _, tr := range mr.Tables {
+		rcu += tr.ReadCapacityUnits
+		wcu += tr.WriteCapacityUnits
+	}
+	return rcu, wcu
+}
+
+// RunWithResult runs migration like Run, returning the result of the run instead of its errors
+func (dd *DynamoDrifter) RunWithResult(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) *MigrationResult {
+	res := newMigrationResult(migration, false)
+	errs := dd.runMigration(ctx, migration, concurrency, failOnFirstError, progressChan, false, res)
+	return res.finish(errs)
+}
+
+// UndoWithResult undoes migration like Undo, returning the result of the run instead of its errors
+func (dd *DynamoDrifter) UndoWithResult(ctx context.Context, undoMigration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress) *MigrationResult {
+	res := newMigrationResult(undoMigration, true)
+	errs := dd.undo(ctx, undoMigration, concurrency, failOnFirstError, progressChan, res, false)
+	return res.finish(errs)
+}
+
+// newMigrationResult returns the empty result of a run of migration, started now
+func newMigrationResult(migration *DynamoDrifterMigration, undo bool) *MigrationResult {
+	res := &MigrationResult{
+		Undo:            undo,
+		Started:         time.Now().UTC(),
+		ActionsQueued:   map[string]uint{},
+		ActionsExecuted: map[string]uint{},
+		Tables:          map[string]*TableReport{},
+		Errors:          []*ResultError{},
+	}
+	if migration != nil {
+		res.Number = migration.Number
+	}
+	return res
+}
+
+// finish completes the result with errs, the errors of the run. The errors of phases (see reporter.failed) are returned by runs as is.
+func (mr *MigrationResult) finish(errs []error) *MigrationResult {
+	mr.Finished = time.Now().UTC()
+	mr.Errors = make([]*ResultError, len(errs))
+	for i, err := range errs {
+		mr.Errors[i] = &ResultError{Class: ClassifyError(err), Err: err}
+		for _, pe := range mr.phaseErrors {
+			if sameError(pe.Err, err) {
+				mr.Errors[i].Phase = pe.Phase
+				break
+			}
+		}
+	}
+	return mr
+}
+
+// sameError returns whether a and b are the same error value
+func sameError(a, b error) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.TypeOf(a).Comparable() && a == b
+}
+
+// The statistics of MigrationResults are recorded by the reporter of the run, whose methods are no-ops without a result
+
+// scanned records items read by a scan
+func (r *reporter) scanned(n int64) {
+	if r == nil || r.res == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.res.ItemsScanned += uint(n)
+}
+
+// called records an item (or a page) processed by a callback, which returned err
+func (r *reporter) called(err error) {
+	if r == nil || r.res == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	if err != nil {
+		r.res.CallbacksFailed++
+	} else {
+		r.res.CallbacksSucceeded++
+	}
+}
+
+// queued records the actions queued by callbacks
+func (r *reporter) queued(actions []action) {
+	if r == nil || r.res == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	for i := range actions {
+		r.res.ActionsQueued[actions[i].atype.String()]++
+	}
+}
+
+// applied records the execution of a unit of actions, which returned err
+func (r *reporter) applied(unit []action, err error) {
+	if r == nil || r.res == nil || err != nil && !errors.Is(err, errConditionSkipped) {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	for i := range unit {
+		r.res.ActionsExecuted[unit[i].atype.String()]++
+	}
+}
+
+// failed records the errors of phase, which runs return as is
+func (r *reporter) failed(phase string, errs []error) {
+	if r == nil || r.res == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	for _, err := range errs {
+		r.res.phaseErrors = append(r.res.phaseErrors, &ResultError{Phase: phase, Err: err})
+	}
+}
@@ -0,0 +1,72 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunWithResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+		case "ListTables":
+			w.Write([]byte(`{"TableNames":["foo"]}`))
+		case "Scan":
+			w.Write([]byte(`{"Items":[{"ID":{"S":"1"}},{"ID":{"S":"2"}},{"ID":{"S":"3"}}],"Count":3,"ScannedCount":4,"ConsumedCapacity":{"TableName":"foo","CapacityUnits":2}}`))
+		case "UpdateItem":
+			if strings.Contains(string(b), `"S":"2"`) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ValidationException","message":"bad update"}`))
+				return
+			}
+			w.Write([]byte(`{"ConsumedCapacity":{"TableName":"foo","CapacityUnits":1}}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), MetaTableName: "migrations"}
+	m := &DynamoDrifterMigration{Number: 1, TableName: "foo", Callback: func(item RawDynamoItem, da *DrifterAction) error {
+		if *item["ID"].S == "3" {
+			return da.Delete(item, "")
+		}
+		return da.UpdateItem(item, "").Set("Foo", "v").Queue()
+	}}
+	res := dd.RunWithResult(context.Background(), m, 1, false, nil)
+	if res.Number != 1 || res.Succeeded() || res.ItemsScanned != 4 || res.CallbacksSucceeded != 3 || res.CallbacksFailed != 0 {
+		t.Fatalf("bad result: %+v", res)
+	}
+	if res.ActionsQueued["update"] != 2 || res.ActionsQueued["delete"] != 1 || res.ActionsExecuted["update"] != 1 || res.ActionsExecuted["delete"] != 1 {
+		t.Fatalf("bad actions: %v, %v", res.ActionsQueued, res.ActionsExecuted)
+	}
+	if rcu, wcu := res.CapacityUnits(); rcu != 2 || wcu != 1 {
+		t.Fatalf("bad consumed capacity: %v, %v", rcu, wcu)
+	}
+	if len(res.Errors) != 1 || res.Errors[0].Phase != PhaseActions || res.Errors[0].Class != ErrorClassPermanent || len(res.ActionErrors()) != 1 {
+		t.Fatalf("bad errors: %v", res.Errors)
+	}
+	if errs := res.Errs(); len(errs) != 1 || !errors.As(errs[0], new(*ActionError)) || res.Duration() < 0 {
+		t.Fatalf("bad run errors: %v", errs)
+	}
+	m.Callback = func(item RawDynamoItem, da *DrifterAction) error {
+		if *item["ID"].S == "2" {
+			return errors.New("bad item")
+		}
+		return nil
+	}
+	res = dd.RunWithResult(context.Background(), m, 1, false, nil)
+	if res.CallbacksSucceeded != 2 || res.CallbacksFailed != 1 || len(res.ActionsQueued) != 0 || len(res.Errors) != 1 || res.Errors[0].Phase != PhaseCallbacks {
+		t.Fatalf("bad result of failed callbacks: %+v", res)
+	}
+	m.TableName = "bar"
+	res = dd.UndoWithResult(context.Background(), m, 1, false, nil)
+	if !res.Undo || len(res.Errors) != 1 || res.Errors[0].Phase != "" {
+		t.Fatalf("bad result of failed run: %+v", res)
+	}
+}
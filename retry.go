@@ -0,0 +1,195 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// ErrRetryBudgetExhausted is returned (wrapped) once a run-wide retry budget has been used up. Once this happens the run is aborted.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// ErrorClass categorizes errors returned by DynamoDB calls for retry purposes
+type ErrorClass string
+
+const (
+	// ErrorClassThrottling is a request rejected due to exceeded table or account throughput
+	ErrorClassThrottling ErrorClass = "throttling"
+	// ErrorClassTransient is a network error, timeout or 5xx response
+	ErrorClassTransient ErrorClass = "transient"
+	// ErrorClassPermanent is any other error. Permanent errors are never retried.
+	ErrorClassPermanent ErrorClass = "permanent"
+)
+
+var throttlingCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"Throttling":                             true,
+	"RequestLimitExceeded":                   true,
+}
+
+var transientCodes = map[string]bool{
+	"RequestError":                 true,
+	"RequestTimeout":               true,
+	"RequestTimeoutException":      true,
+	"InternalServerError":          true,
+	"ServiceUnavailable":           true,
+	"ServiceUnavailableException":  true,
+	"TransactionConflictException": true,
+}
+
+// ClassifyError returns the ErrorClass for an error returned by a DynamoDB call
+func ClassifyError(err error) ErrorClass {
+	var rf awserr.RequestFailure
+	if errors.As(err, &rf) && rf.StatusCode() >= 500 {
+		return ErrorClassTransient
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch {
+		case throttlingCodes[aerr.Code()]:
+			return ErrorClassThrottling
+		case transientCodes[aerr.Code()]:
+			return ErrorClassTransient
+		}
+	}
+	return ErrorClassPermanent
+}
+
+// RetryBudget limits the amount of retrying performed. Zero values mean no limit.
+type RetryBudget struct {
+	MaxAttempts  uint          // Maximum attempts for an individual call, including the first
+	MaxRetries   uint          // Maximum total number of retries over the whole run
+	MaxRetryTime time.Duration // Maximum cumulative time spent waiting to retry over the whole run
+}
+
+// RetryPolicy controls retrying of failed DynamoDB calls made by drift (table scans and action writes).
+// This is in addition to any retrying performed by the DynamoDB client itself.
+// Budget applies to all retryable errors, ClassBudgets (optional) apply additionally to errors of that class.
+// Transient errors are retried as long as both budgets allow it, but once any run-wide limit (MaxRetries or MaxRetryTime) is reached the run is aborted with ErrRetryBudgetExhausted.
+// Backoff controls the delay between retries (optional, defaults to DefaultBackoff).
+type RetryPolicy struct {
+	Budget       RetryBudget
+	ClassBudgets map[ErrorClass]RetryBudget
+	Backoff      Backoff
+}
+
+// DefaultRetryPolicy is the RetryPolicy used if none is specified
+var DefaultRetryPolicy = RetryPolicy{
+	Budget: RetryBudget{
+		MaxAttempts:  5,
+		MaxRetryTime: 10 * time.Minute,
+	},
+}
+
+// retrier tracks retry budget consumption over a single run
+type retrier struct {
+	sync.Mutex
+	policy     RetryPolicy
+	retries    uint
+	waited     time.Duration
+	cretries   map[ErrorClass]uint
+	cwaited    map[ErrorClass]time.Duration
+	exhaustErr error
+}
+
+func newRetrier(policy *RetryPolicy) *retrier {
+	if policy == nil {
+		policy = &DefaultRetryPolicy
+	}
+	return &retrier{
+		policy:   *policy,
+		cretries: map[ErrorClass]uint{},
+		cwaited:  map[ErrorClass]time.Duration{},
+	}
+}
+
+func (r *retrier) delay(attempt uint) time.Duration {
+	if r.policy.Backoff == nil {
+		return DefaultBackoff.Delay(attempt)
+	}
+	return r.policy.Backoff.Delay(attempt)
+}
+
+// exhausted returns a non-nil error if a run-wide budget has been used up
+func (r *retrier) exhausted() error {
+	if r == nil {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	return r.exhaustErr
+}
+
+// reserve checks whether a retry of the given class is permitted after attempt attempts and if so records it
+func (r *retrier) reserve(class ErrorClass, attempt uint, d time.Duration) (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.exhaustErr != nil {
+		return false, r.exhaustErr
+	}
+	check := func(b RetryBudget, retries uint, waited time.Duration, scope string) error {
+		switch {
+		case b.MaxRetries != 0 && retries+1 > b.MaxRetries:
+			return fmt.Errorf("%w: %v max retries (%v) reached", ErrRetryBudgetExhausted, scope, b.MaxRetries)
+		case b.MaxRetryTime != 0 && waited+d > b.MaxRetryTime:
+			return fmt.Errorf("%w: %v max retry time (%v) reached", ErrRetryBudgetExhausted, scope, b.MaxRetryTime)
+		}
+		return nil
+	}
+	cb, hascb := r.policy.ClassBudgets[class]
+	if err := check(r.policy.Budget, r.retries, r.waited, "global"); err != nil {
+		r.exhaustErr = err
+		return false, err
+	}
+	if hascb {
+		if err := check(cb, r.cretries[class], r.cwaited[class], string(class)); err != nil {
+			r.exhaustErr = err
+			return false, err
+		}
+	}
+	if r.policy.Budget.MaxAttempts != 0 && attempt >= r.policy.Budget.MaxAttempts {
+		return false, nil
+	}
+	if hascb && cb.MaxAttempts != 0 && attempt >= cb.MaxAttempts {
+		return false, nil
+	}
+	r.retries++
+	r.waited += d
+	r.cretries[class]++
+	r.cwaited[class] += d
+	return true, nil
+}
+
+// do executes f, retrying retryable errors as permitted by the policy
+func (r *retrier) do(ctx context.Context, f func() error) error {
+	var attempt uint
+	for {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		attempt++
+		class := ClassifyError(err)
+		if class == ErrorClassPermanent {
+			return err
+		}
+		d := r.delay(attempt)
+		ok, berr := r.reserve(class, attempt, d)
+		if berr != nil {
+			return fmt.Errorf("%w (%w)", err, berr)
+		}
+		if !ok {
+			return err
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{awserr.New("ProvisionedThroughputExceededException", "slow down", nil), ErrorClassThrottling},
+		{awserr.New("RequestError", "connection reset", nil), ErrorClassTransient},
+		{awserr.NewRequestFailure(awserr.New("InternalFailure", "oops", nil), 500, "1"), ErrorClassTransient},
+		{awserr.New("ValidationException", "bad expression", nil), ErrorClassPermanent},
+		{fmt.Errorf("error updating item: %w", awserr.New("ThrottlingException", "", nil)), ErrorClassThrottling},
+		{fmt.Errorf("something else"), ErrorClassPermanent},
+	}
+	for _, c := range cases {
+		if ClassifyError(c.err) != c.class {
+			t.Fatalf("bad class for %v: %v (wanted %v)", c.err, ClassifyError(c.err), c.class)
+		}
+	}
+}
+
+func TestRetrierRecovers(t *testing.T) {
+	rt := newRetrier(&RetryPolicy{Budget: RetryBudget{MaxAttempts: 3}})
+	var calls int
+	err := rt.do(context.Background(), func() error {
+		calls++
+		if calls < 2 {
+			return awserr.New("ThrottlingException", "", nil)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("should have succeeded: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("bad call count: %v", calls)
+	}
+}
+
+func TestRetrierPermanentError(t *testing.T) {
+	rt := newRetrier(nil)
+	var calls int
+	err := rt.do(context.Background(), func() error {
+		calls++
+		return awserr.New("ValidationException", "", nil)
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if calls != 1 {
+		t.Fatalf("permanent errors should not be retried: %v", calls)
+	}
+}
+
+func TestRetrierMaxAttempts(t *testing.T) {
+	rt := newRetrier(&RetryPolicy{Budget: RetryBudget{MaxAttempts: 2}})
+	var calls int
+	err := rt.do(context.Background(), func() error {
+		calls++
+		return awserr.New("RequestError", "", nil)
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if calls != 2 {
+		t.Fatalf("bad call count: %v", calls)
+	}
+	if rt.exhausted() != nil {
+		t.Fatalf("per-call attempt limit should not exhaust the run budget")
+	}
+}
+
+func TestRetrierClassBudgetExhausted(t *testing.T) {
+	rt := newRetrier(&RetryPolicy{
+		ClassBudgets: map[ErrorClass]RetryBudget{
+			ErrorClassThrottling: RetryBudget{MaxRetries: 1},
+		},
+	})
+	var calls int
+	err := rt.do(context.Background(), func() error {
+		calls++
+		return awserr.New("ThrottlingException", "", nil)
+	})
+	var aerr awserr.Error
+	if !errors.Is(err, ErrRetryBudgetExhausted) || !errors.As(err, &aerr) || aerr.Code() != "ThrottlingException" {
+		t.Fatalf("expected budget exhausted error wrapping the last error: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("bad call count: %v", calls)
+	}
+	if rt.exhausted() == nil {
+		t.Fatalf("retrier should be exhausted")
+	}
+	// once exhausted, subsequent failures are not retried
+	calls = 0
+	err = rt.do(context.Background(), func() error {
+		calls++
+		return awserr.New("RequestError", "", nil)
+	})
+	if !errors.Is(err, ErrRetryBudgetExhausted) || calls != 1 {
+		t.Fatalf("expected fail fast: %v (calls: %v)", err, calls)
+	}
+}
+
+func TestRetrierMaxRetryTime(t *testing.T) {
+	rt := newRetrier(&RetryPolicy{Budget: RetryBudget{MaxRetryTime: 50 * time.Millisecond}})
+	err := rt.do(context.Background(), func() error {
+		return awserr.New("RequestError", "", nil)
+	})
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("expected budget exhausted error: %v", err)
+	}
+}
+
+func TestRetrierCustomBackoff(t *testing.T) {
+	var attempts []uint
+	rt := newRetrier(&RetryPolicy{
+		Budget: RetryBudget{MaxAttempts: 3},
+		Backoff: BackoffFunc(func(attempt uint) time.Duration {
+			attempts = append(attempts, attempt)
+			return 0
+		}),
+	})
+	rt.do(context.Background(), func() error {
+		return awserr.New("RequestError", "", nil)
+	})
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[2] != 3 {
+		t.Fatalf("bad backoff attempts: %v", attempts)
+	}
+}
+
+func TestMetaItemRetries(t *testing.T) {
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		calls[op]++
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if calls[op] == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException","message":"slow down"}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), MetaTableName: "migrations", RetryPolicy: &RetryPolicy{
+		Budget:  RetryBudget{MaxAttempts: 3},
+		Backoff: BackoffFunc(func(uint) time.Duration { return time.Millisecond }),
+	}}
+	m := &DynamoDrifterMigration{Number: 1, TableName: "foo"}
+	if err := dd.insertMetaItem(m); err != nil {
+		t.Fatalf("error inserting meta item: %v", err)
+	}
+	if err := dd.deleteMetaItem(m); err != nil {
+		t.Fatalf("error deleting meta item: %v", err)
+	}
+	if calls["PutItem"] != 2 || calls["DeleteItem"] != 2 {
+		t.Fatalf("throttled meta table writes should be retried: %v", calls)
+	}
+}
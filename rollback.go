@@ -0,0 +1,69 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRolledBack is returned (wrapped, after the errors of the run) by Run when a failed run was rolled back, see RollbackPolicy
+var ErrRolledBack = errors.New("migration rolled back")
+
+// defaultRollbackTimeout bounds rollbacks of runs whose context is done
+const defaultRollbackTimeout = time.Hour
+
+// RollbackPolicy makes Run undo failed runs automatically, restoring the table without a human having to remember the undo procedure:
+// when a run of a migration with an UndoMigration (or UndoCallback) fails with more than MaxErrors errors after executing actions, its
+// undo migration is run (see Undo) with the same settings. Runs failing before executing actions (ex: callback errors or exceeded guardrails) didn't
+// change the table and aren't rolled back. Multi-step migrations are always rolled back, as their function steps may have changed it.
+type RollbackPolicy struct {
+	MaxErrors uint          // Errors tolerated without rolling back (0 rolls back on any error)
+	Timeout   time.Duration // Bound of the rollback if the context of the run is done (optional, defaults to an hour)
+}
+
+// trackExecution returns a channel to be used in place of progressChan, and a function returning whether actions were executed
+// once the run returned
+func trackExecution(progressChan chan *MigrationProgress) (chan *MigrationProgress, func() bool) {
+	var executed int32
+	pc, stop := tapProgress(progressChan, time.Hour, func(mp *MigrationProgress) {
+		if mp.ActionsExecuted != 0 {
+			atomic.StoreInt32(&executed, 1)
+		}
+	}, func() {})
+	return pc, func() bool {
+		stop()
+		return atomic.LoadInt32(&executed) == 1
+	}
+}
+
+// rollback undoes migration if its run failed with errs beyond the drifter's RollbackPolicy, returning the errors of the run followed by
+// the outcome of the rollback
+func (dd *DynamoDrifter) rollback(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, errs []error, executed bool) []error {
+	rp := dd.Rollback
+	if rp == nil || migration.undoMigration() == nil || uint(len(errs)) <= rp.MaxErrors || !(executed || len(migration.Steps) > 0) {
+		return errs
+	}
+	if lockLost(ctx) {
+		dd.logf(VerbosityQuiet, "migration %v lost its lock, not rolling back", migration.Number)
+		return errs
+	}
+	if ctx.Err() != nil {
+		timeout := rp.Timeout
+		if timeout == 0 {
+			timeout = defaultRollbackTimeout
+		}
+		var cncl context.CancelFunc
+		ctx, cncl = context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cncl()
+	}
+	dd.logf(VerbosityQuiet, "migration %v failed with %v error(s), rolling back", migration.Number, len(errs))
+	if uerrs := dd.undo(ctx, migration.undoMigration(), concurrency, failOnFirstError, nil, nil, true); len(uerrs) != 0 {
+		for _, err := range uerrs {
+			errs = append(errs, fmt.Errorf("rollback of migration %v failed: %w", migration.Number, err))
+		}
+		return errs
+	}
+	return append(errs, fmt.Errorf("%w: migration %v failed with %v error(s)", ErrRolledBack, migration.Number, len(errs)))
+}
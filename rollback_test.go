@@ -0,0 +1,119 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRollbackNotNeeded(t *testing.T) {
+	errs := []error{errors.New("boom"), errors.New("bang")}
+	undo := &DynamoDrifterMigration{TableName: "foo", Callback: testMigrateDown}
+	for _, c := range []struct {
+		rp       *RollbackPolicy
+		m        *DynamoDrifterMigration
+		errs     []error
+		executed bool
+	}{
+		{nil, &DynamoDrifterMigration{UndoMigration: undo}, errs, true},
+		{&RollbackPolicy{}, &DynamoDrifterMigration{}, errs, true},
+		{&RollbackPolicy{MaxErrors: 2}, &DynamoDrifterMigration{UndoMigration: undo}, errs, true},
+		{&RollbackPolicy{}, &DynamoDrifterMigration{UndoMigration: undo}, errs, false},
+		{&RollbackPolicy{}, &DynamoDrifterMigration{UndoMigration: undo}, []error{}, true},
+	} {
+		dd := &DynamoDrifter{Rollback: c.rp} // Undo would fail without a client
+		if out := dd.rollback(context.Background(), c.m, 1, false, c.errs, c.executed); !reflect.DeepEqual(out, c.errs) {
+			t.Fatalf("%+v: run should not be rolled back: %v", c.rp, out)
+		}
+	}
+	dd := &DynamoDrifter{Rollback: &RollbackPolicy{}}
+	out := dd.rollback(context.Background(), &DynamoDrifterMigration{UndoMigration: undo}, 1, false, errs, true)
+	if len(out) != 3 || errors.Is(out[2], ErrRolledBack) {
+		t.Fatalf("failed rollback should be reported: %v", out)
+	}
+}
+
+func TestTrackExecution(t *testing.T) {
+	out := make(chan *MigrationProgress, 10)
+	pc, executed := trackExecution(out)
+	pc <- &MigrationProgress{CallbacksProcessed: 1}
+	if executed() {
+		t.Fatalf("no actions were executed")
+	}
+	if len(out) != 1 {
+		t.Fatalf("progress should be forwarded")
+	}
+	pc, executed = trackExecution(nil)
+	pc <- &MigrationProgress{ActionsExecuted: 1}
+	if !executed() {
+		t.Fatalf("actions were executed")
+	}
+}
+
+func TestUndoNumber(t *testing.T) {
+	var updates []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+		case "ListTables":
+			w.Write([]byte(`{"TableNames":["foo"]}`))
+		case "GetItem":
+			if strings.Contains(string(b), `"N":"1"`) {
+				w.Write([]byte(`{"Item":{"Number":{"N":"1"},"TableName":{"S":"foo"},"Description":{"S":"up"}}}`))
+				return
+			}
+			w.Write([]byte(`{}`))
+		case "Scan":
+			if strings.Contains(string(b), `"migrations"`) {
+				w.Write([]byte(`{"Items":[{"Number":{"N":"1"},"TableName":{"S":"foo"}}],"Count":1,"ScannedCount":1}`))
+				return
+			}
+			w.Write([]byte(`{"Items":[{"ID":{"S":"1"}}],"Count":1,"ScannedCount":1}`))
+		case "UpdateItem":
+			updates = append(updates, string(b))
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), MetaTableName: "migrations"}
+	ctx := context.Background()
+	if errs := dd.UndoNumber(ctx, 1, 1, false, nil); len(errs) != 1 || !strings.Contains(errs[0].Error(), "not registered") {
+		t.Fatalf("undo without registry should fail: %v", errs)
+	}
+	up := func(item RawDynamoItem, da *DrifterAction) error {
+		return da.UpdateItem(item, "").Set("Up", true).Queue()
+	}
+	down := func(item RawDynamoItem, da *DrifterAction) error { return da.UpdateItem(item, "").Remove("Up").Queue() }
+	err := dd.Register(
+		&DynamoDrifterMigration{Number: 1, TableName: "foo", Description: "up", Callback: up, UndoCallback: down},
+		&DynamoDrifterMigration{Number: 2, TableName: "foo", Callback: up, UndoCallback: down},
+		&DynamoDrifterMigration{Number: 3, TableName: "foo", Callback: up},
+	)
+	if err != nil {
+		t.Fatalf("error registering: %v", err)
+	}
+	if errs := dd.UndoNumber(ctx, 3, 1, false, nil); len(errs) != 1 || !strings.Contains(errs[0].Error(), "no UndoMigration") {
+		t.Fatalf("undo without undo migration should fail: %v", errs)
+	}
+	if errs := dd.UndoNumber(ctx, 2, 1, false, nil); len(errs) != 1 || !errors.Is(errs[0], ErrNotApplied) {
+		t.Fatalf("undo of a pending migration should fail: %v", errs)
+	}
+	if errs := dd.UndoNumber(ctx, 1, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("error undoing migration: %v", errs)
+	}
+	if len(updates) != 1 || !strings.Contains(updates[0], "REMOVE") {
+		t.Fatalf("the undo callback should have run: %v", updates)
+	}
+	m := &DynamoDrifterMigration{Number: 4, TableName: "foo", Callback: up, UndoCallback: down, UndoMigration: &DynamoDrifterMigration{}}
+	if err := validateMigration(m); err == nil {
+		t.Fatalf("UndoMigration and UndoCallback should be exclusive")
+	}
+}
@@ -0,0 +1,70 @@
+package drift
+
+import (
+	"context"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// modulePath is the path of the drift module
+const modulePath = "github.com/dollarshaveclub/dynamo-drift"
+
+// libraryVersion returns the version of the drift module built into the binary, "(devel)" if it is built from a working tree, or
+// "unknown" if the binary has no module information (ex: built in GOPATH mode)
+func libraryVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if bi.Main.Path == modulePath {
+		return bi.Main.Version
+	}
+	for _, d := range bi.Deps {
+		if d.Path != modulePath {
+			continue
+		}
+		if d.Replace != nil && d.Replace.Version != "" {
+			return d.Replace.Version
+		}
+		return d.Version
+	}
+	return "unknown"
+}
+
+// itemCounter counts the items processed by the callbacks of a run, see DynamoDrifterMigration.ItemsProcessed
+type itemCounter struct {
+	n uint64
+}
+
+type itemCounterKey struct{}
+
+// countItems returns ctx carrying a new item counter, and the counter
+func countItems(ctx context.Context) (context.Context, *itemCounter) {
+	ic := &itemCounter{}
+	return context.WithValue(ctx, itemCounterKey{}, ic), ic
+}
+
+// itemCounterFrom returns the item counter of the run of ctx, or nil
+func itemCounterFrom(ctx context.Context) *itemCounter {
+	if ctx == nil {
+		return nil
+	}
+	ic, _ := ctx.Value(itemCounterKey{}).(*itemCounter)
+	return ic
+}
+
+// add counts n processed items
+func (ic *itemCounter) add(n int) {
+	if ic == nil {
+		return
+	}
+	atomic.AddUint64(&ic.n, uint64(n))
+}
+
+// count returns the number of processed items
+func (ic *itemCounter) count() uint {
+	if ic == nil {
+		return 0
+	}
+	return uint(atomic.LoadUint64(&ic.n))
+}
@@ -0,0 +1,113 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+func TestRunMetadata(t *testing.T) {
+	var record map[string]*dynamodb.AttributeValue
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+		case "ListTables":
+			w.Write([]byte(`{"TableNames":["foo"]}`))
+		case "Scan":
+			w.Write([]byte(`{"Items":[{"ID":{"S":"1"}},{"ID":{"S":"2"}},{"ID":{"S":"3"}}],"Count":3,"ScannedCount":3}`))
+		case "PutItem":
+			in := &dynamodb.PutItemInput{}
+			json.Unmarshal(b, in)
+			record = in.Item
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), MetaTableName: "migrations", Owner: "tester"}
+	m := &DynamoDrifterMigration{Number: 1, TableName: "foo", Callback: func(item RawDynamoItem, da *DrifterAction) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}}
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("error running migration: %v", errs)
+	}
+	rec := &DynamoDrifterMigration{}
+	if err := dynamodbattribute.UnmarshalMap(record, rec); err != nil {
+		t.Fatalf("error unmarshaling record: %v", err)
+	}
+	if rec.AppliedAt == nil || rec.AppliedBy != "tester" || rec.DriftVersion == "" || rec.ItemsProcessed != 3 || rec.Duration < 3*time.Millisecond {
+		t.Fatalf("bad run metadata: %+v", rec)
+	}
+	if m.Duration != 0 || m.ItemsProcessed != 0 {
+		t.Fatalf("the migration should not be modified: %+v", m)
+	}
+	m.Callback, m.BatchCallback = nil, func(items []RawDynamoItem, da *DrifterAction) error { return nil }
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 0 {
+		t.Fatalf("error running batch migration: %v", errs)
+	}
+	if err := dynamodbattribute.UnmarshalMap(record, rec); err != nil || rec.ItemsProcessed != 3 {
+		t.Fatalf("items of batches should be counted: %+v, %v", rec, err)
+	}
+}
+
+func TestRunAlreadyApplied(t *testing.T) {
+	record, conflict, scans := "", false, 0
+	var put *dynamodb.PutItemInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+		case "ListTables":
+			w.Write([]byte(`{"TableNames":["foo"]}`))
+		case "GetItem":
+			w.Write([]byte(`{` + record + `}`))
+		case "Scan":
+			scans++
+			w.Write([]byte(`{"Items":[],"Count":0,"ScannedCount":0}`))
+		case "PutItem":
+			put = &dynamodb.PutItemInput{}
+			json.Unmarshal(b, put)
+			if conflict {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`))
+				return
+			}
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), MetaTableName: "migrations"}
+	m := &DynamoDrifterMigration{Number: 1, TableName: "foo", Callback: func(item RawDynamoItem, da *DrifterAction) error { return nil }}
+	record = `"Item":{"Number":{"N":"1"},"TableName":{"S":"foo"}}`
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 1 || !errors.Is(errs[0], ErrAlreadyApplied) || scans != 0 {
+		t.Fatalf("applied migration should fail without scanning: %v (%v scans)", errs, scans)
+	}
+	record = `"Item":{"Number":{"N":"1"},"TableName":{"S":"foo"},"InProgress":{"BOOL":true}}`
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 0 || scans != 1 {
+		t.Fatalf("in progress migration should run: %v (%v scans)", errs, scans)
+	}
+	if put == nil || aws.StringValue(put.ConditionExpression) != "attribute_not_exists(#n) OR #ip = :true OR (#ab = :ab AND #at = :at)" ||
+		!reflect.DeepEqual(put.ExpressionAttributeValues[":at"], put.Item["AppliedAt"]) {
+		t.Fatalf("meta table record should be conditional: %+v", put)
+	}
+	record, conflict = "", true
+	if errs := dd.Run(context.Background(), m, 1, false, nil); len(errs) != 1 || !errors.Is(errs[0], ErrAlreadyApplied) || scans != 2 {
+		t.Fatalf("migration applied by another run should fail: %v (%v scans)", errs, scans)
+	}
+}
@@ -0,0 +1,75 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Runner periodically applies the pending migrations of a registry, so long-lived services can migrate themselves on deploy.
+// Each round acquires Lock (if set), then runs the pending migrations in ascending order, stopping at the first one that fails
+// (it is retried on the next round). Rounds where the lock is held by another process are skipped.
+type Runner struct {
+	Drifter  *DynamoDrifter
+	Registry *Registry
+	Lock     Locker // Lock serializing rounds between processes (optional, required if several processes run the same migrations)
+
+	Interval time.Duration   // Time between rounds
+	Cron     *CronExpression // Alternative to Interval: rounds start at times matching the expression (UTC)
+
+	Concurrency      uint // See DynamoDrifter.Run
+	FailOnFirstError bool // See DynamoDrifter.Run
+
+	// Report is called (if set) after each migration is run, with the errors from DynamoDrifter.Run
+	Report func(migration *DynamoDrifterMigration, errs []error)
+}
+
+// next returns the time of the round after t
+func (r *Runner) next(t time.Time) time.Time {
+	if r.Cron != nil {
+		return r.Cron.Next(t.UTC())
+	}
+	return t.Add(r.Interval)
+}
+
+// RunOnce runs a single round, returning the number of migrations applied. A round skipped because the lock is held returns an
+// error wrapping ErrMigrationLocked.
+func (r *Runner) RunOnce(ctx context.Context) (int, error) {
+	if r.Drifter == nil || r.Registry == nil {
+		return 0, fmt.Errorf("Drifter and Registry are required")
+	}
+	if r.Lock != nil {
+		var unlock func() error
+		var err error
+		ctx, unlock, err = holdLock(ctx, r.Lock)
+		if err != nil {
+			return 0, err
+		}
+		defer unlock()
+	}
+	return r.Drifter.runPending(ctx, r.Registry, RunAllOptions{Concurrency: r.Concurrency, FailOnFirstError: r.FailOnFirstError, Report: r.Report})
+}
+
+// Run runs a round immediately and then on schedule until ctx is cancelled, returning ctx.Err().
+// Errors of individual rounds are passed to onError (optional).
+func (r *Runner) Run(ctx context.Context, onError func(error)) error {
+	if r.Interval <= 0 && r.Cron == nil {
+		return fmt.Errorf("Interval or Cron is required")
+	}
+	for {
+		if _, err := r.RunOnce(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		next := r.next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("cron expression never matches")
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package drift
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunnerSchedule(t *testing.T) {
+	now := date("2024-05-15 12:07")
+	r := &Runner{Interval: time.Minute}
+	if next := r.next(now); !next.Equal(now.Add(time.Minute)) {
+		t.Fatalf("bad interval round: %v", next)
+	}
+	r.Cron, _ = ParseCron("0 * * * *")
+	if next := r.next(now); !next.Equal(date("2024-05-15 13:00")) {
+		t.Fatalf("bad cron round: %v", next)
+	}
+	if err := (&Runner{}).Run(context.Background(), nil); err == nil {
+		t.Fatalf("runner without a schedule should fail")
+	}
+	if _, err := (&Runner{Interval: time.Minute}).RunOnce(context.Background()); err == nil {
+		t.Fatalf("runner without drifter and registry should fail")
+	}
+}
@@ -0,0 +1,347 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ReportKindRun is the kind of JSON RunReports, see ReportVersion
+const ReportKindRun = "run"
+
+// maxReportErrors is the maximum number of error messages in a run report
+const maxReportErrors = 100
+
+// reportTimeout bounds writing a run report to each sink
+const reportTimeout = 30 * time.Second
+
+// RunReport is the report of a run of a migration (Run/Undo), written to DynamoDrifter.ReportSinks when the run ends. Reports are encoded
+// in JSON as documented by ReportVersion.
+type RunReport struct {
+	Number      uint      `json:"number"`
+	TableName   string    `json:"tablename"`
+	Description string    `json:"description"`
+	Undo        bool      `json:"undo"`
+	Owner       string    `json:"owner"` // See DynamoDrifter.Owner
+	Succeeded   bool      `json:"succeeded"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+
+	// Totals of the run (across all scans of multi-step migrations)
+	CallbacksProcessed uint `json:"callbacks_processed"`
+	ActionsQueued      uint `json:"actions_queued"`
+	ActionsExecuted    uint `json:"actions_executed"`
+
+	Phases []PhaseReport           `json:"phases"` // Phases of the run in order (callbacks then actions, for each scan)
+	Tables map[string]*TableReport `json:"tables"` // DynamoDB requests of the run by table
+	Errors ErrorReport             `json:"errors"`
+	Steps  []StepProgress          `json:"steps,omitempty"` // Checkpoints of the steps of multi-step migrations
+
+	Outcomes *OutcomeReport `json:"outcomes,omitempty"` // Outcomes of the items processed (see DynamoDrifter.Outcomes)
+}
+
+// PhaseReport is a phase of a run (PhaseCallbacks or PhaseActions). Phases are tracked from progress messages, so their timings are approximate.
+type PhaseReport struct {
+	Phase    string        `json:"phase"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"-"`
+	Items    uint          `json:"items"`  // Callbacks processed or actions executed
+	Queued   uint          `json:"queued"` // Actions queued (action phases only)
+	Errors   uint          `json:"errors"`
+}
+
+// MarshalJSON implements json.Marshaler, encoding the duration in fractional seconds
+func (pr PhaseReport) MarshalJSON() ([]byte, error) {
+	type phase PhaseReport // without methods
+	return json.Marshal(struct {
+		phase
+		Duration float64 `json:"duration_seconds"`
+	}{phase(pr), pr.Duration.Seconds()})
+}
+
+// TableReport are the DynamoDB requests of a run against a table (successful requests which returned their consumed capacity)
+type TableReport struct {
+	Requests           map[string]uint `json:"requests"` // By operation (ex: "Scan", "UpdateItem")
+	ReadCapacityUnits  float64         `json:"read_capacity_units"`
+	WriteCapacityUnits float64         `json:"write_capacity_units"`
+}
+
+// ErrorReport are the errors of a run
+type ErrorReport struct {
+	Total         uint                `json:"total"`          // Errors of the run (as returned by Run/Undo)
+	ByClass       map[ErrorClass]uint `json:"by_class"`       // Errors of the run by class (see ClassifyError)
+	RequestErrors map[ErrorClass]uint `json:"request_errors"` // Failed DynamoDB requests by class, including those retried
+	Messages      []string            `json:"messages"`       // Messages of the first errors of the run
+}
+
+// MarshalJSON implements json.Marshaler, see ReportVersion
+func (rr *RunReport) MarshalJSON() ([]byte, error) {
+	type report RunReport // without methods
+	return json.Marshal(struct {
+		Version int    `json:"version"`
+		Kind    string `json:"kind"`
+		*report
+		Duration float64 `json:"duration_seconds"`
+	}{ReportVersion, ReportKindRun, (*report)(rr), rr.Finished.Sub(rr.Started).Seconds()})
+}
+
+// fileName returns the name of the report file: migration-<number>[-undo]-<start time>.json
+func (rr *RunReport) fileName() string {
+	undo := ""
+	if rr.Undo {
+		undo = "-undo"
+	}
+	return fmt.Sprintf("migration-%v%v-%v.json", rr.Number, undo, rr.Started.UTC().Format("20060102T150405Z"))
+}
+
+// ReportSink receives the reports of runs (see DynamoDrifter.ReportSinks).
+// WriteReport is called synchronously by Run/Undo with a context bounded by a timeout. Reports are best effort: errors are ignored.
+type ReportSink interface {
+	WriteReport(ctx context.Context, rr *RunReport) error
+}
+
+// FileReportSink writes reports as JSON files in a directory (see RunReport for file names)
+type FileReportSink struct {
+	Dir string
+}
+
+// WriteReport implements ReportSink
+func (fs *FileReportSink) WriteReport(ctx context.Context, rr *RunReport) error {
+	b, err := json.MarshalIndent(rr, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling run report: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(fs.Dir, rr.fileName()), append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing run report: %v", err)
+	}
+	return nil
+}
+
+// S3ReportSink writes reports as JSON objects in an S3 bucket, with keys Prefix followed by the file name (see RunReport)
+type S3ReportSink struct {
+	S3     *s3.S3
+	Bucket string
+	Prefix string // ex: "drift/reports/"
+}
+
+// WriteReport implements ReportSink
+func (ss *S3ReportSink) WriteReport(ctx context.Context, rr *RunReport) error {
+	b, err := json.Marshal(rr)
+	if err != nil {
+		return fmt.Errorf("error marshaling run report: %v", err)
+	}
+	req, _ := ss.S3.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(ss.Bucket),
+		Key:         aws.String(ss.Prefix + rr.fileName()),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/json"),
+	})
+	if err := sendContext(ctx, req); err != nil {
+		return fmt.Errorf("error uploading run report: %v", err)
+	}
+	return nil
+}
+
+// reporter builds the report of a run, and its result if requested (see RunWithResult)
+type reporter struct {
+	sync.Mutex
+	rr  *RunReport
+	res *MigrationResult
+}
+
+type reporterKey struct{}
+
+// reporterFrom returns the reporter of the run of ctx, or nil
+func reporterFrom(ctx context.Context) *reporter {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(reporterKey{}).(*reporter)
+	return r
+}
+
+// observe tracks phases from a progress message
+func (r *reporter) observe(mp *MigrationProgress) {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now().UTC()
+	phase := func(name string) *PhaseReport {
+		if n := len(r.rr.Phases); n > 0 && r.rr.Phases[n-1].Phase == name {
+			return &r.rr.Phases[n-1]
+		}
+		if n := len(r.rr.Phases); n > 0 {
+			r.rr.Phases[n-1].Duration = now.Sub(r.rr.Phases[n-1].Started)
+		}
+		r.rr.Phases = append(r.rr.Phases, PhaseReport{Phase: name, Started: now})
+		return &r.rr.Phases[len(r.rr.Phases)-1]
+	}
+	var p *PhaseReport
+	switch {
+	case mp.ActionsExecuted != 0:
+		p = phase(PhaseActions)
+		p.Items = mp.ActionsExecuted
+		p.Queued = mp.ActionsQueued
+	case mp.CallbacksProcessed != 0 || len(r.rr.Phases) == 0:
+		p = phase(PhaseCallbacks)
+		p.Items = max(p.Items, mp.CallbacksProcessed)
+	default:
+		p = &r.rr.Phases[len(r.rr.Phases)-1]
+	}
+	p.Errors += uint(len(mp.CallbackErrors) + len(mp.ActionErrors))
+}
+
+// attach makes req return its consumed capacity and counts its failed attempts (see record)
+func (r *reporter) attach(req *request.Request) {
+	total := aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	switch in := req.Params.(type) {
+	case *dynamodb.ScanInput:
+		in.ReturnConsumedCapacity = total
+	case *dynamodb.QueryInput:
+		in.ReturnConsumedCapacity = total
+	case *dynamodb.GetItemInput:
+		in.ReturnConsumedCapacity = total
+	case *dynamodb.PutItemInput:
+		in.ReturnConsumedCapacity = total
+	case *dynamodb.UpdateItemInput:
+		in.ReturnConsumedCapacity = total
+	case *dynamodb.DeleteItemInput:
+		in.ReturnConsumedCapacity = total
+	case *dynamodb.BatchGetItemInput:
+		in.ReturnConsumedCapacity = total
+	case *dynamodb.BatchWriteItemInput:
+		in.ReturnConsumedCapacity = total
+	}
+	req.Handlers.Retry.PushFront(func(req *request.Request) {
+		r.Lock()
+		defer r.Unlock()
+		r.rr.Errors.RequestErrors[ClassifyError(req.Error)]++
+	})
+}
+
+// record records the consumed capacity of a successful request
+func (r *reporter) record(req *request.Request) {
+	r.Lock()
+	defer r.Unlock()
+	var ccs []*dynamodb.ConsumedCapacity
+	write := false
+	switch out := req.Data.(type) {
+	case *dynamodb.ScanOutput:
+		ccs = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+	case *dynamodb.QueryOutput:
+		ccs = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+	case *dynamodb.GetItemOutput:
+		ccs = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+	case *dynamodb.BatchGetItemOutput:
+		ccs = out.ConsumedCapacity
+	case *dynamodb.PutItemOutput:
+		ccs, write = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}, true
+	case *dynamodb.UpdateItemOutput:
+		ccs, write = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}, true
+	case *dynamodb.DeleteItemOutput:
+		ccs, write = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}, true
+	case *dynamodb.BatchWriteItemOutput:
+		ccs, write = out.ConsumedCapacity, true
+	}
+	for _, cc := range ccs {
+		if cc == nil || cc.TableName == nil {
+			continue
+		}
+		tr := r.rr.Tables[*cc.TableName]
+		if tr == nil {
+			tr = &TableReport{Requests: map[string]uint{}}
+			r.rr.Tables[*cc.TableName] = tr
+		}
+		tr.Requests[req.Operation.Name]++
+		if write {
+			tr.WriteCapacityUnits += aws.Float64Value(cc.CapacityUnits)
+		} else {
+			tr.ReadCapacityUnits += aws.Float64Value(cc.CapacityUnits)
+		}
+	}
+}
+
+// finish completes the report with the errors of the run
+func (r *reporter) finish(errs []error) *RunReport {
+	r.Lock()
+	defer r.Unlock()
+	rr := r.rr
+	rr.Finished = time.Now().UTC()
+	rr.Succeeded = len(errs) == 0
+	if n := len(rr.Phases); n > 0 {
+		rr.Phases[n-1].Duration = rr.Finished.Sub(rr.Phases[n-1].Started)
+	}
+	for _, p := range rr.Phases {
+		if p.Phase == PhaseActions {
+			rr.ActionsExecuted += p.Items
+			rr.ActionsQueued += p.Queued
+		} else {
+			rr.CallbacksProcessed += p.Items
+		}
+	}
+	rr.Errors.Total = uint(len(errs))
+	for i, err := range errs {
+		rr.Errors.ByClass[ClassifyError(err)]++
+		if i < maxReportErrors {
+			rr.Errors.Messages = append(rr.Errors.Messages, err.Error())
+		}
+	}
+	return rr
+}
+
+// startReport starts building the report of a run of migration if there are report sinks or res (optional) must be filled in, returning
+// the context and progress channel to use for the run in place of ctx and progressChan, and a function writing the report, which must be
+// passed the errors of the run.
+func (dd *DynamoDrifter) startReport(ctx context.Context, migration *DynamoDrifterMigration, undo bool, progressChan chan *MigrationProgress, res *MigrationResult) (context.Context, chan *MigrationProgress, func(errs []error)) {
+	if len(dd.ReportSinks) == 0 && res == nil || migration == nil {
+		if reporterFrom(ctx) != nil {
+			ctx = context.WithValue(ctx, reporterKey{}, (*reporter)(nil)) // not part of the report of the enclosing run (ex: rollbacks)
+		}
+		return ctx, progressChan, func([]error) {}
+	}
+	owner := dd.Owner
+	if owner == "" {
+		owner = DefaultOwner()
+	}
+	r := &reporter{rr: &RunReport{
+		Number:      migration.Number,
+		TableName:   migration.TableName,
+		Description: migration.Description,
+		Undo:        undo,
+		Owner:       owner,
+		Started:     time.Now().UTC(),
+		Phases:      []PhaseReport{},
+		Tables:      map[string]*TableReport{},
+		Errors:      ErrorReport{ByClass: map[ErrorClass]uint{}, RequestErrors: map[ErrorClass]uint{}, Messages: []string{}},
+	}, res: res}
+	pc, stop := tapProgress(progressChan, time.Hour, r.observe, func() {})
+	return context.WithValue(ctx, reporterKey{}, r), pc, func(errs []error) {
+		stop()
+		rr := r.finish(errs)
+		if res != nil {
+			res.Tables = rr.Tables
+		}
+		if rec := outcomesFrom(ctx); rec != nil {
+			rr.Outcomes = rec.summary()
+		}
+		if len(migration.Steps) > 0 && !undo {
+			if m, err := dd.getMetaItem(migration.Number); err == nil && m != nil {
+				rr.Steps = m.StepProgress
+			}
+		}
+		for _, rs := range dd.ReportSinks {
+			ctx, cncl := context.WithTimeout(context.Background(), reportTimeout)
+			rs.WriteReport(ctx, rr)
+			cncl()
+		}
+	}
+}
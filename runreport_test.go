@@ -0,0 +1,107 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type testReportSink struct {
+	reports []*RunReport
+}
+
+func (ts *testReportSink) WriteReport(ctx context.Context, rr *RunReport) error {
+	ts.reports = append(ts.reports, rr)
+	return fmt.Errorf("errors are ignored")
+}
+
+func TestRunReport(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"ReturnConsumedCapacity":"TOTAL"`) {
+			t.Errorf("consumed capacity should be requested: %s", body)
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"__type":"InternalFailure","message":"oops"}`))
+			return
+		}
+		w.Write([]byte(`{"Items":[],"Count":0,"ConsumedCapacity":{"TableName":"foo","CapacityUnits":1.5}}`))
+	}))
+	defer srv.Close()
+	ts := &testReportSink{}
+	dir := t.TempDir()
+	dd := &DynamoDrifter{
+		DynamoDB:    getTestHTTPDDBClient(srv.URL),
+		Retryer:     &testRetryer{},
+		ReportSinks: []ReportSink{ts, &FileReportSink{Dir: dir}},
+		Owner:       "test",
+	}
+	out := make(chan *MigrationProgress, 10)
+	ctx, pc, writeReport := dd.startReport(context.Background(), &DynamoDrifterMigration{Number: 2, TableName: "foo"}, false, out, nil)
+	req, _ := dd.DynamoDB.ScanRequest(&dynamodb.ScanInput{TableName: aws.String("foo")})
+	if err := dd.send(ctx, req); err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	pc <- &MigrationProgress{CallbacksProcessed: 10}
+	pc <- &MigrationProgress{ActionsExecuted: 4, ActionsQueued: 5, ActionErrors: []error{fmt.Errorf("foo")}}
+	pc <- &MigrationProgress{CallbacksProcessed: 3} // second scan
+	writeReport([]error{fmt.Errorf("bar"), awserr.New("ThrottlingException", "slow down", nil)})
+	if len(out) != 3 {
+		t.Fatalf("progress should have been forwarded: %v", len(out))
+	}
+	if len(ts.reports) != 1 {
+		t.Fatalf("report should have been written: %v", len(ts.reports))
+	}
+	rr := ts.reports[0]
+	if rr.Number != 2 || rr.Owner != "test" || rr.Succeeded || rr.CallbacksProcessed != 13 || rr.ActionsExecuted != 4 || rr.ActionsQueued != 5 {
+		t.Fatalf("bad report: %+v", rr)
+	}
+	if len(rr.Phases) != 3 || rr.Phases[0].Phase != PhaseCallbacks || rr.Phases[1].Phase != PhaseActions || rr.Phases[1].Errors != 1 || rr.Phases[2].Items != 3 {
+		t.Fatalf("bad phases: %+v", rr.Phases)
+	}
+	tr := rr.Tables["foo"]
+	if tr == nil || tr.Requests["Scan"] != 1 || tr.ReadCapacityUnits != 1.5 || tr.WriteCapacityUnits != 0 {
+		t.Fatalf("bad table report: %+v", tr)
+	}
+	if rr.Errors.Total != 2 || rr.Errors.ByClass[ErrorClassThrottling] != 1 || rr.Errors.ByClass[ErrorClassPermanent] != 1 || rr.Errors.RequestErrors[ErrorClassTransient] != 1 || len(rr.Errors.Messages) != 2 {
+		t.Fatalf("bad errors: %+v", rr.Errors)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, rr.fileName()))
+	if err != nil {
+		t.Fatalf("error reading report file: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("error unmarshaling report: %v", err)
+	}
+	if doc["version"] != float64(ReportVersion) || doc["kind"] != ReportKindRun || doc["duration_seconds"] == nil {
+		t.Fatalf("bad report document: %s", b)
+	}
+	if !strings.HasPrefix(rr.fileName(), "migration-2-") {
+		t.Fatalf("bad file name: %v", rr.fileName())
+	}
+}
+
+func TestStartReportWithoutSinks(t *testing.T) {
+	dd := &DynamoDrifter{}
+	out := make(chan *MigrationProgress)
+	ctx, pc, writeReport := dd.startReport(context.Background(), &DynamoDrifterMigration{Number: 1}, true, out, nil)
+	if pc != out || ctx.Value(reporterKey{}) != nil {
+		t.Fatalf("run should not be reported without sinks")
+	}
+	writeReport(nil)
+}
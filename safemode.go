@@ -0,0 +1,50 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ErrUnsafeAction is returned (wrapped) for destructive actions rejected in safe mode, see DynamoDrifter.SafeMode
+var ErrUnsafeAction = errors.New("destructive action rejected in safe mode")
+
+// hashKey returns the hash key attribute of table, described once per run
+func (dd *DynamoDrifter) hashKey(ctx context.Context, da *DrifterAction, table string) (string, error) {
+	attrs, err := dd.keyAttributes(ctx, da, table)
+	if err != nil {
+		return "", err
+	}
+	return attrs[0], nil
+}
+
+// keyAttributes returns the key attributes of table (the hash key, then the range key if any), described once per run
+func (dd *DynamoDrifter) keyAttributes(ctx context.Context, da *DrifterAction, table string) ([]string, error) {
+	if attrs, ok := da.keyAttrs.Load(table); ok {
+		return attrs.([]string), nil
+	}
+	td, _, err := dd.describeTable(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	var hash, rng string
+	for _, kse := range td.KeySchema {
+		if aws.StringValue(kse.KeyType) == dynamodb.KeyTypeHash {
+			hash = aws.StringValue(kse.AttributeName)
+		} else {
+			rng = aws.StringValue(kse.AttributeName)
+		}
+	}
+	if hash == "" {
+		return nil, fmt.Errorf("table %v has no hash key", table)
+	}
+	attrs := []string{hash}
+	if rng != "" {
+		attrs = append(attrs, rng)
+	}
+	da.keyAttrs.Store(table, attrs)
+	return attrs, nil
+}
@@ -0,0 +1,41 @@
+package drift
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestSafeMode(t *testing.T) {
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	dd := &DynamoDrifter{SafeMode: true}
+	da := dd.newDrifterAction(&DynamoDrifterMigration{TableName: "users"})
+	if err := da.Delete(keys, ""); !errors.Is(err, ErrUnsafeAction) {
+		t.Fatalf("Delete should be rejected: %v", err)
+	}
+	if err := da.Insert(keys, ""); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if as := da.aq.actions(); len(as) != 1 || !as[0].noOverwrite {
+		t.Fatalf("Insert should not overwrite: %+v", as)
+	}
+
+	da = dd.newDrifterAction(&DynamoDrifterMigration{TableName: "users", AllowsDeletes: true, AllowsOverwrites: true})
+	if err := da.Delete(keys, ""); err != nil {
+		t.Fatalf("Delete should be allowed: %v", err)
+	}
+	if err := da.Insert(keys, ""); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if as := da.aq.actions(); len(as) != 2 || as[1].noOverwrite {
+		t.Fatalf("Insert should overwrite: %+v", as)
+	}
+
+	dd.SafeMode = false
+	da = dd.newDrifterAction(&DynamoDrifterMigration{TableName: "users"})
+	if err := da.Delete(keys, ""); err != nil {
+		t.Fatalf("Delete should be allowed outside safe mode: %v", err)
+	}
+}
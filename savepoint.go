@@ -0,0 +1,173 @@
+package drift
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Savepoint records the progress of the action phase of a running migration in its meta table record, so a run interrupted while
+// executing actions (ex: by a crash) resumes after the last savepoint instead of re-applying an unknown prefix of its actions (see
+// DynamoDrifter.SavepointInterval). Actions are executed in batches, and a savepoint covers the actions of the batches which completed
+// without errors. Cancelled runs don't save savepoints.
+//
+// As the queue order depends on scheduling (with several callbacks or scan segments), runs with savepoints apply actions sorted by table
+// and key (the actions of a transaction or item group staying together) instead of in queue order. When the migration is run again, its
+// callbacks queue actions again: the savepoint is only used if the same actions are queued (same count, and the applied prefix has the
+// same digest), otherwise all are executed and the mismatch is logged. Callbacks must therefore queue the same actions from the
+// partially migrated table, ex: by computing them from attributes they don't write.
+type Savepoint struct {
+	Applied uint      `dynamodbav:"Applied" json:"applied"` // Actions applied, in queue order
+	Queued  uint      `dynamodbav:"Queued" json:"queued"`   // Actions queued by the scan
+	Digest  string    `dynamodbav:"Digest" json:"digest"`   // SHA-256 of the applied actions
+	Undo    bool      `dynamodbav:"Undo,omitempty" json:"undo,omitempty"`
+	Updated time.Time `dynamodbav:"Updated" json:"updated"`
+}
+
+// actionDigest accumulates the digest of a sequence of actions
+type actionDigest struct {
+	h hash.Hash
+	n int // actions written
+}
+
+func newActionDigest() *actionDigest {
+	return &actionDigest{h: sha256.New()}
+}
+
+// add adds actions to the digest
+func (ad *actionDigest) add(actions []action) {
+	enc := json.NewEncoder(ad.h)
+	for _, a := range actions {
+		enc.Encode([]interface{}{a.atype, a.tableName, a.keys, a.values, a.item, a.updExpr, a.condExpr, a.noOverwrite, a.expAttrNames})
+	}
+	ad.n += len(actions)
+}
+
+// orderActions returns grouped actions (see groupActions) with their units sorted by table and key, so the same actions are in the same
+// order whatever the order they were queued in
+func orderActions(actions []action, unit func(a *action) uint64) []action {
+	type sortedUnit struct {
+		key     string
+		actions []action
+	}
+	units := []sortedUnit{}
+	for i := 0; i < len(actions); {
+		j := unitEnd(actions, i, unit)
+		b, _ := json.Marshal(sortKeys(actions[i:j]))
+		units = append(units, sortedUnit{key: string(b), actions: actions[i:j]})
+		i = j
+	}
+	sort.SliceStable(units, func(i, j int) bool { return units[i].key < units[j].key })
+	out := make([]action, 0, len(actions))
+	for _, u := range units {
+		out = append(out, u.actions...)
+	}
+	return out
+}
+
+// sortKeys returns the fields of actions orderActions sorts them by, table and key first
+func sortKeys(actions []action) [][]interface{} {
+	keys := make([][]interface{}, len(actions))
+	for i, a := range actions {
+		keys[i] = []interface{}{a.tableName, a.keys, a.item, a.atype, a.values, a.updExpr, a.condExpr, a.noOverwrite, a.expAttrNames}
+	}
+	return keys
+}
+
+// sum returns the digest of the actions added
+func (ad *actionDigest) sum() string {
+	return hex.EncodeToString(ad.h.Sum(nil))
+}
+
+type savepointerKey struct{}
+
+// savepointer records the savepoints of a run
+type savepointer struct {
+	sync.Mutex
+	rr       *runRecord
+	prev     *Savepoint // savepoint of the interrupted run
+	interval time.Duration
+	digest   *actionDigest
+	sp       Savepoint
+	saved    time.Time
+	dirty    bool
+}
+
+// startSavepoints returns ctx carrying the savepointer of a run of migration if enabled
+func (dd *DynamoDrifter) startSavepoints(ctx context.Context, migration *DynamoDrifterMigration, undo bool) context.Context {
+	if dd.SavepointInterval <= 0 || migration == nil {
+		return ctx
+	}
+	s := &savepointer{rr: &runRecord{dd: dd, migration: migration, undo: undo}, interval: dd.SavepointInterval, sp: Savepoint{Undo: undo}}
+	if m, err := dd.getMetaItem(migration.Number); err == nil && m != nil && m.Savepoint != nil && m.Savepoint.Undo == undo {
+		s.prev = m.Savepoint
+	}
+	return context.WithValue(ctx, savepointerKey{}, s)
+}
+
+// savepointerFrom returns the savepointer carried by ctx, or nil
+func savepointerFrom(ctx context.Context) *savepointer {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(savepointerKey{}).(*savepointer)
+	return s
+}
+
+// resume starts recording savepoints of actions (ordered by orderActions), returning the number of actions applied by the interrupted
+// run if it queued the same actions, or an error if its savepoint can't be resumed
+func (s *savepointer) resume(actions []action) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.digest = newActionDigest()
+	s.sp = Savepoint{Queued: uint(len(actions)), Undo: s.sp.Undo}
+	prev := s.prev
+	s.prev = nil // only the first scan resumes
+	switch {
+	case prev == nil:
+		return 0, nil
+	case prev.Queued != uint(len(actions)) || prev.Applied > prev.Queued:
+		return 0, fmt.Errorf("the interrupted run queued %v actions, not %v", prev.Queued, len(actions))
+	}
+	d := newActionDigest()
+	d.add(actions[:prev.Applied])
+	if d.sum() != prev.Digest {
+		return 0, fmt.Errorf("the %v actions applied by the interrupted run differ from those queued", prev.Applied)
+	}
+	s.digest = d
+	s.sp.Applied, s.sp.Digest = prev.Applied, prev.Digest
+	return int(prev.Applied), nil
+}
+
+// advance records that the actions up to applied were applied, saving a savepoint if the interval elapsed
+func (s *savepointer) advance(actions []action, applied int) {
+	s.Lock()
+	s.digest.add(actions[s.digest.n:applied])
+	s.sp.Applied, s.sp.Digest = uint(applied), s.digest.sum()
+	s.dirty = true
+	due := time.Since(s.saved) >= s.interval
+	s.Unlock()
+	if due {
+		s.save()
+	}
+}
+
+// save writes the last savepoint if it wasn't saved yet
+func (s *savepointer) save() error {
+	s.Lock()
+	if !s.dirty {
+		s.Unlock()
+		return nil
+	}
+	s.sp.Updated = time.Now().UTC()
+	sp := s.sp
+	s.saved, s.dirty = time.Now(), false
+	s.Unlock()
+	return s.rr.set("Savepoint", sp)
+}
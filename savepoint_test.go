@@ -0,0 +1,223 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func testSavepointActions(n int) []action {
+	actions := make([]action, n)
+	for i := range actions {
+		actions[i] = action{
+			atype:   updateAction,
+			keys:    RawDynamoItem{"ID": {N: aws.String(strconv.Itoa(i))}},
+			values:  RawDynamoItem{":v": {S: aws.String("v")}},
+			updExpr: "SET Foo = :v",
+		}
+	}
+	return actions
+}
+
+func TestActionDigest(t *testing.T) {
+	actions := testSavepointActions(4)
+	a, b := newActionDigest(), newActionDigest()
+	a.add(actions)
+	b.add(actions[:1])
+	b.add(actions[1:])
+	if a.sum() != b.sum() || a.n != 4 {
+		t.Fatalf("digests of the same actions should match")
+	}
+	other := testSavepointActions(4)
+	other[3].values = RawDynamoItem{":v": {S: aws.String("w")}}
+	c := newActionDigest()
+	c.add(other)
+	if c.sum() == a.sum() {
+		t.Fatalf("digests of different actions should differ")
+	}
+}
+
+func TestSavepointResume(t *testing.T) {
+	actions := testSavepointActions(4)
+	d := newActionDigest()
+	d.add(actions[:2])
+	prev := &Savepoint{Applied: 2, Queued: 4, Digest: d.sum()}
+	for _, c := range []struct {
+		prev     *Savepoint
+		actions  []action
+		expected int
+		fails    bool
+	}{
+		{nil, actions, 0, false},
+		{prev, actions, 2, false},
+		{prev, testSavepointActions(5), 0, true},
+		{&Savepoint{Applied: 2, Queued: 4, Digest: "other"}, actions, 0, true},
+	} {
+		s := &savepointer{prev: c.prev}
+		if n, err := s.resume(c.actions); n != c.expected || (err != nil) != c.fails {
+			t.Fatalf("%+v: bad resumed actions: %v, %v (expected %v)", c.prev, n, err, c.expected)
+		}
+		if n, err := s.resume(c.actions); n != 0 || err != nil {
+			t.Fatalf("only the first scan should resume")
+		}
+	}
+}
+
+func TestOrderActions(t *testing.T) {
+	actions := testSavepointActions(12)
+	actions[3].txn, actions[7].txn = 1, 1
+	// queued in another order by concurrent callbacks, the actions of a transaction keep theirs
+	reversed := make([]action, len(actions))
+	for i := range actions {
+		reversed[len(actions)-1-i] = actions[i]
+	}
+	reversed[4], reversed[8] = reversed[8], reversed[4]
+	a := orderActions(groupActions(actions, actionTransaction), actionTransaction)
+	b := orderActions(groupActions(reversed, actionTransaction), actionTransaction)
+	da, db := newActionDigest(), newActionDigest()
+	da.add(a)
+	db.add(b)
+	if da.sum() != db.sum() {
+		t.Fatalf("actions should be ordered whatever their queue order")
+	}
+	for i := range a {
+		if a[i].txn == 1 {
+			if a[i+1].txn != 1 {
+				t.Fatalf("the actions of a transaction should stay together")
+			}
+			break
+		}
+	}
+}
+
+func TestSavepointResumeConcurrency(t *testing.T) {
+	var mtx sync.Mutex
+	updated := map[string]int{}
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if !strings.Contains(string(b), `"TableName":"foo"`) {
+			w.Write([]byte("{}"))
+			return
+		}
+		in := struct{ Key RawDynamoItem }{}
+		json.Unmarshal(b, &in)
+		id := aws.StringValue(in.Key["ID"].N)
+		mtx.Lock()
+		updated[id]++
+		requests++
+		n := updated[id]
+		mtx.Unlock()
+		if id == "99" && n == 1 { // last action in table and key order, the first run fails on it
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ValidationException","message":"bad"}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{MetaTableName: "migrations", DynamoDB: getTestHTTPDDBClient(srv.URL), SavepointInterval: time.Hour}
+	m := &DynamoDrifterMigration{Number: 7, TableName: "foo"}
+	actions := testSavepointActions(300)
+	run := func(actions []action, prev *Savepoint) (*savepointer, []error) {
+		da := dd.newDrifterAction(m)
+		for _, a := range actions {
+			da.aq.push(a)
+		}
+		s := &savepointer{rr: &runRecord{dd: dd, migration: m}, interval: dd.SavepointInterval, prev: prev}
+		ctx := context.WithValue(context.Background(), savepointerKey{}, s)
+		return s, dd.executeActions(ctx, m, da, 2, false, nil)
+	}
+	s, errs := run(actions, nil)
+	if len(errs) != 1 || s.sp.Applied != 200 {
+		t.Fatalf("first run should fail after its first batch: %v, %+v", errs, s.sp)
+	}
+	// callbacks of the resumed run queue the same actions in another order
+	reversed := make([]action, len(actions))
+	for i := range actions {
+		reversed[len(actions)-1-i] = actions[i]
+	}
+	prev := s.sp
+	requests = 0
+	if _, errs = run(reversed, &prev); len(errs) != 0 {
+		t.Fatalf("errors resuming actions: %v", errs)
+	}
+	if requests != 100 {
+		t.Fatalf("the resumed run should only apply the last 100 actions: %v", requests)
+	}
+	if len(updated) != 300 {
+		t.Fatalf("all actions should be applied: %v", len(updated))
+	}
+}
+
+func TestSavepointSave(t *testing.T) {
+	var mtx sync.Mutex
+	bodies := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mtx.Lock()
+		bodies = append(bodies, string(b))
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{MetaTableName: "migrations", DynamoDB: getTestHTTPDDBClient(srv.URL), SavepointInterval: time.Hour}
+	m := &DynamoDrifterMigration{Number: 7, TableName: "foo"}
+	s := &savepointer{rr: &runRecord{dd: dd, migration: m}, interval: dd.SavepointInterval}
+	actions := testSavepointActions(4)
+	s.resume(actions)
+	s.advance(actions, 2) // saved, the interval elapsed since the start
+	s.advance(actions, 4) // not saved until the interval elapses
+	if len(bodies) != 1 || !strings.Contains(bodies[0], `"Applied":{"N":"2"}`) {
+		t.Fatalf("bad savepoint writes: %v", bodies)
+	}
+	if err := s.save(); err != nil {
+		t.Fatalf("error saving savepoint: %v", err)
+	}
+	s.save()
+	if len(bodies) != 2 || !strings.Contains(bodies[1], `"Applied":{"N":"4"}`) {
+		t.Fatalf("bad savepoint writes: %v", bodies)
+	}
+	if ctx := (&DynamoDrifter{}).startSavepoints(context.Background(), m, false); savepointerFrom(ctx) != nil {
+		t.Fatalf("savepoints should be disabled without an interval")
+	}
+}
+
+func TestSavepointCancelled(t *testing.T) {
+	var mtx sync.Mutex
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		requests = append(requests, r.Header.Get("X-Amz-Target"))
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{MetaTableName: "migrations", DynamoDB: getTestHTTPDDBClient(srv.URL), SavepointInterval: time.Nanosecond}
+	m := &DynamoDrifterMigration{Number: 7, TableName: "foo"}
+	da := dd.newDrifterAction(m)
+	for _, a := range testSavepointActions(4) {
+		da.aq.push(a)
+	}
+	s := &savepointer{rr: &runRecord{dd: dd, migration: m}, interval: dd.SavepointInterval}
+	ctx, cncl := context.WithCancel(context.WithValue(context.Background(), savepointerKey{}, s))
+	cncl()
+	if errs := dd.executeActions(ctx, m, da, 2, false, nil); len(errs) == 0 {
+		t.Fatalf("cancelled actions should fail")
+	}
+	if len(requests) != 0 || s.sp.Applied != 0 {
+		t.Fatalf("cancelled runs should not save savepoints: %v, %+v", requests, s.sp)
+	}
+}
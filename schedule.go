@@ -0,0 +1,249 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule restricts when a migration may process items (ex: a maintenance window).
+// Window returns whether the schedule is open at t, and the time after t at which that changes (the zero time if it never does).
+type Schedule interface {
+	Window(t time.Time) (open bool, change time.Time)
+}
+
+// waitForSchedule blocks until s is open (s may be nil)
+func waitForSchedule(ctx context.Context, s Schedule) error {
+	if s == nil {
+		return nil
+	}
+	for {
+		open, change := s.Window(time.Now())
+		if open {
+			return nil
+		}
+		if change.IsZero() {
+			return fmt.Errorf("schedule never opens")
+		}
+		timer := time.NewTimer(time.Until(change))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TimeWindow is a daily window from Start to End (offsets from midnight in Location, UTC if nil). If End is before Start the window ends the next day.
+// Days are the days of the week the window starts on (every day if empty).
+type TimeWindow struct {
+	Days     []time.Weekday
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// starts returns whether the window starts on day d
+func (tw TimeWindow) starts(d time.Weekday) bool {
+	if len(tw.Days) == 0 {
+		return true
+	}
+	for _, wd := range tw.Days {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrence returns the start and end of the window starting on the day of t (which must be in tw's location)
+func (tw TimeWindow) occurrence(t time.Time) (time.Time, time.Time) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := tw.End
+	if end <= tw.Start {
+		end += 24 * time.Hour
+	}
+	return midnight.Add(tw.Start), midnight.Add(end)
+}
+
+// TimeWindows is a Schedule which is open during any of its windows
+type TimeWindows []TimeWindow
+
+// Window implements Schedule. If t is inside several overlapping windows, the change returned is the latest end.
+func (tws TimeWindows) Window(t time.Time) (bool, time.Time) {
+	open := false
+	var end, next time.Time
+	for _, tw := range tws {
+		loc := tw.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		// a window starting yesterday may still be open, otherwise the next opening is within a week
+		for d := -1; d <= 7; d++ {
+			day := t.In(loc).AddDate(0, 0, d)
+			if !tw.starts(day.Weekday()) {
+				continue
+			}
+			s, e := tw.occurrence(day)
+			switch {
+			case !t.Before(s) && t.Before(e):
+				open = true
+				if e.After(end) {
+					end = e
+				}
+			case s.After(t) && (next.IsZero() || s.Before(next)):
+				next = s
+			}
+		}
+	}
+	if open {
+		return true, end
+	}
+	return false, next
+}
+
+// cronField is the set of allowed values of a cron expression field
+type cronField map[int]bool
+
+func parseCronField(f string, min, max int) (cronField, error) {
+	cf := cronField{}
+	for _, part := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("bad step: %q", part)
+			}
+			step = s
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			var err error
+			bounds := strings.SplitN(part, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("bad value: %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("bad value: %q", part)
+				}
+			} else if step != 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("value out of range [%v, %v]: %q", min, max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			cf[v] = true
+		}
+	}
+	return cf, nil
+}
+
+// CronExpression is a parsed standard 5 field cron expression (minute hour day-of-month month day-of-week)
+type CronExpression struct {
+	minute, hour, dom, month, dow cronField
+	domAny, dowAny                bool
+}
+
+// ParseCron parses a 5 field cron expression, ex: "0 2 * * 1-5". Fields support *, values, ranges, lists and steps.
+// Day of week is 0-6 (Sunday is 0, 7 is accepted as Sunday). As in cron, if both day fields are restricted a day matching either matches.
+func ParseCron(expr string) (*CronExpression, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields: %q", expr)
+	}
+	ce := &CronExpression{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	specs := []struct {
+		cf       *cronField
+		min, max int
+	}{{&ce.minute, 0, 59}, {&ce.hour, 0, 23}, {&ce.dom, 1, 31}, {&ce.month, 1, 12}, {&ce.dow, 0, 7}}
+	for i, s := range specs {
+		if *s.cf, err = parseCronField(fields[i], s.min, s.max); err != nil {
+			return nil, fmt.Errorf("bad cron expression %q: %v", expr, err)
+		}
+	}
+	if ce.dow[7] {
+		ce.dow[0] = true
+	}
+	return ce, nil
+}
+
+func (ce *CronExpression) dayMatches(t time.Time) bool {
+	dom, dow := ce.dom[t.Day()], ce.dow[int(t.Weekday())]
+	switch {
+	case ce.domAny && ce.dowAny:
+		return true
+	case ce.domAny:
+		return dow
+	case ce.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Next returns the first time after t matching the expression (in t's location), or the zero time if there is none within 5 years
+func (ce *CronExpression) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !ce.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !ce.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !ce.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !ce.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// CronWindow is a Schedule which opens at each time matching Cron (evaluated in Location, UTC if nil) and stays open for Duration
+type CronWindow struct {
+	Cron     *CronExpression
+	Duration time.Duration
+	Location *time.Location
+}
+
+// NewCronWindow returns a CronWindow for a cron expression, see ParseCron
+func NewCronWindow(expr string, duration time.Duration, loc *time.Location) (*CronWindow, error) {
+	ce, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	return &CronWindow{Cron: ce, Duration: duration, Location: loc}, nil
+}
+
+// Window implements Schedule. If t is inside several overlapping windows, the change returned is the end of the earliest.
+func (cw *CronWindow) Window(t time.Time) (bool, time.Time) {
+	loc := cw.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	// the window is open if it opened after t - Duration
+	start := cw.Cron.Next(t.In(loc).Add(-cw.Duration))
+	switch {
+	case start.IsZero():
+		return false, time.Time{}
+	case start.After(t):
+		return false, start
+	default:
+		return true, start.Add(cw.Duration)
+	}
+}
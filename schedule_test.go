@@ -0,0 +1,110 @@
+package drift
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseCron(t *testing.T) {
+	cases := []struct {
+		expr string
+		from string
+		next string
+	}{
+		{"0 2 * * *", "2024-05-15 12:00", "2024-05-16 02:00"},
+		{"*/15 * * * *", "2024-05-15 12:07", "2024-05-15 12:15"},
+		{"30 22 * * 1-5", "2024-05-17 23:00", "2024-05-20 22:30"}, // Friday night to Monday
+		{"0 0 1 * 0", "2024-05-15 12:00", "2024-05-19 00:00"},     // Sunday or the 1st
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 12 * * 7", "2024-05-15 12:00", "2024-05-19 12:00"},
+	}
+	for _, c := range cases {
+		ce, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("%v: error parsing: %v", c.expr, err)
+		}
+		if next := ce.Next(date(c.from)); !next.Equal(date(c.next)) {
+			t.Fatalf("%v: bad next time after %v: %v", c.expr, c.from, next)
+		}
+	}
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("%v: should have failed", expr)
+		}
+	}
+}
+
+func TestCronWindow(t *testing.T) {
+	cw, err := NewCronWindow("0 22 * * *", 4*time.Hour, nil)
+	if err != nil {
+		t.Fatalf("error creating window: %v", err)
+	}
+	if open, change := cw.Window(date("2024-05-15 23:30")); !open || !change.Equal(date("2024-05-16 02:00")) {
+		t.Fatalf("window should be open: %v, %v", open, change)
+	}
+	if open, change := cw.Window(date("2024-05-16 02:00")); open || !change.Equal(date("2024-05-16 22:00")) {
+		t.Fatalf("window should be closed: %v, %v", open, change)
+	}
+	if open, _ := cw.Window(date("2024-05-16 22:00")); !open {
+		t.Fatalf("window should be open at its start")
+	}
+}
+
+func TestTimeWindows(t *testing.T) {
+	tws := TimeWindows{
+		{Days: []time.Weekday{time.Saturday, time.Sunday}, Start: 0, End: 24 * time.Hour},
+		{Start: 22 * time.Hour, End: 2 * time.Hour},
+	}
+	cases := []struct {
+		at     string
+		open   bool
+		change string
+	}{
+		{"2024-05-15 12:00", false, "2024-05-15 22:00"},
+		{"2024-05-15 23:00", true, "2024-05-16 02:00"},
+		{"2024-05-16 01:00", true, "2024-05-16 02:00"},
+		{"2024-05-18 12:00", true, "2024-05-19 00:00"}, // saturday
+		{"2024-05-20 01:00", true, "2024-05-20 02:00"}, // sunday night window
+	}
+	for _, c := range cases {
+		open, change := tws.Window(date(c.at))
+		if open != c.open || !change.Equal(date(c.change)) {
+			t.Fatalf("%v: bad window: %v, %v", c.at, open, change)
+		}
+	}
+}
+
+type testSchedule struct {
+	open   bool
+	change time.Time
+}
+
+func (ts testSchedule) Window(t time.Time) (bool, time.Time) {
+	return ts.open, ts.change
+}
+
+func TestWaitForSchedule(t *testing.T) {
+	if err := waitForSchedule(context.Background(), nil); err != nil {
+		t.Fatalf("nil schedule should not wait: %v", err)
+	}
+	if err := waitForSchedule(context.Background(), testSchedule{open: true}); err != nil {
+		t.Fatalf("open schedule should not wait: %v", err)
+	}
+	if err := waitForSchedule(context.Background(), testSchedule{}); err == nil {
+		t.Fatalf("schedule that never opens should fail")
+	}
+	ctx, cncl := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cncl()
+	if err := waitForSchedule(ctx, testSchedule{change: time.Now().Add(time.Hour)}); err != context.DeadlineExceeded {
+		t.Fatalf("wait should have been cancelled: %v", err)
+	}
+}
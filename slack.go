@@ -0,0 +1,96 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SlackNotifier is a Notifier posting messages to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client        // HTTP client (optional, defaults to http.DefaultClient)
+	Events     []NotificationEvent // Events to post (optional, defaults to all)
+
+	// ReportURL returns the URL of the failure report of a failed run, linked in the failure message (optional)
+	ReportURL func(n *Notification) string
+}
+
+// Notify implements Notifier
+func (sn *SlackNotifier) Notify(ctx context.Context, n *Notification) error {
+	if len(sn.Events) != 0 {
+		wanted := false
+		for _, e := range sn.Events {
+			wanted = wanted || e == n.Event
+		}
+		if !wanted {
+			return nil
+		}
+	}
+	body, err := json.Marshal(map[string]string{"text": sn.message(n)})
+	if err != nil {
+		return fmt.Errorf("error marshaling slack message: %v", err)
+	}
+	return postJSON(ctx, sn.Client, sn.WebhookURL, body, nil)
+}
+
+// message returns the text of the Slack message for n
+func (sn *SlackNotifier) message(n *Notification) string {
+	kind := "Migration"
+	if n.Undo {
+		kind = "Undo of migration"
+	}
+	subject := fmt.Sprintf("%v %v on table %v", kind, n.Number, n.TableName)
+	if n.Description != "" {
+		subject += fmt.Sprintf(" (%v)", n.Description)
+	}
+	counts := fmt.Sprintf("%v items processed, %v actions executed", n.CallbacksProcessed, n.ActionsExecuted)
+	switch n.Event {
+	case NotifyStarted:
+		return fmt.Sprintf(":arrow_forward: %v started on %v", subject, n.Owner)
+	case NotifySucceeded:
+		return fmt.Sprintf(":white_check_mark: %v succeeded in %v: %v", subject, n.Duration.Round(time.Second), counts)
+	}
+	msg := fmt.Sprintf(":x: %v failed after %v: %v, %v errors", subject, n.Duration.Round(time.Second), counts, len(n.Errors))
+	if len(n.Errors) != 0 {
+		msg += fmt.Sprintf("\n> %v", strings.Replace(n.Errors[0].Error(), "\n", " ", -1))
+	}
+	if sn.ReportURL != nil {
+		if u := sn.ReportURL(n); u != "" {
+			msg += fmt.Sprintf("\n<%v|Failure report>", u)
+		}
+	}
+	return msg
+}
+
+// postJSON posts body to url and fails on non-2xx statuses. header sets additional request headers.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header map[string]string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting notification: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error posting notification: status %v: %s", resp.StatusCode, b)
+	}
+	return nil
+}
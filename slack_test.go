@@ -0,0 +1,58 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackNotifier(t *testing.T) {
+	var msgs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Text string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		msgs = append(msgs, body.Text)
+	}))
+	defer srv.Close()
+	sn := &SlackNotifier{
+		WebhookURL: srv.URL,
+		Events:     []NotificationEvent{NotifySucceeded, NotifyFailed},
+		ReportURL: func(n *Notification) string {
+			return fmt.Sprintf("https://example.com/reports/%v", n.Number)
+		},
+	}
+	n := &Notification{Event: NotifyStarted, Number: 3, TableName: "users", Description: "split names"}
+	if err := sn.Notify(context.Background(), n); err != nil || len(msgs) != 0 {
+		t.Fatalf("start should not have been posted: %v, %v", err, msgs)
+	}
+	n.Event = NotifySucceeded
+	n.CallbacksProcessed = 10
+	n.Duration = 90 * time.Second
+	if err := sn.Notify(context.Background(), n); err != nil {
+		t.Fatalf("error notifying: %v", err)
+	}
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "Migration 3 on table users (split names) succeeded in 1m30s: 10 items processed") {
+		t.Fatalf("bad success message: %v", msgs)
+	}
+	n.Event = NotifyFailed
+	n.Errors = []error{fmt.Errorf("foo")}
+	if err := sn.Notify(context.Background(), n); err != nil {
+		t.Fatalf("error notifying: %v", err)
+	}
+	if len(msgs) != 2 || !strings.Contains(msgs[1], "failed after 1m30s") || !strings.Contains(msgs[1], "> foo") || !strings.Contains(msgs[1], "<https://example.com/reports/3|Failure report>") {
+		t.Fatalf("bad failure message: %v", msgs)
+	}
+	sn.WebhookURL = srv.URL + "/missing"
+	srv.Config.Handler = http.NotFoundHandler()
+	if err := sn.Notify(context.Background(), n); err == nil {
+		t.Fatalf("non-2xx status should fail")
+	}
+}
@@ -0,0 +1,226 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Phases of a migration run in progress snapshots
+const (
+	PhaseCallbacks = "callbacks" // Scanning the table and executing callbacks
+	PhaseActions   = "actions"   // Executing queued actions
+)
+
+// SnapshotStatus is the status of a migration run in progress snapshots
+type SnapshotStatus string
+
+// Snapshot statuses
+const (
+	SnapshotRunning   SnapshotStatus = "running"
+	SnapshotCompleted SnapshotStatus = "completed"
+	SnapshotFailed    SnapshotStatus = "failed"
+)
+
+// ProgressSnapshot is a point-in-time view of a running migration, written periodically while it runs (see DynamoDrifter.SnapshotInterval)
+// so dashboards and runbooks can poll it without linking drift. Snapshots are stored with the attribute names below (the JSON names are used
+// by the JSON encoding):
+//
+//   - in the "Progress" map attribute of the meta table record of the migration (the default), until it completes and the record is replaced
+//     by the completed migration (failed runs keep their last snapshot), or
+//   - as the items of DynamoDrifter.ProgressTable (hash key "Number", of type N), one per migration, overwritten by each snapshot and kept
+//     after the run with its final status.
+//
+// Counters, percentages and rates are those of the current scan (for multi-step migrations, of the current scan step) except error counts,
+// which cover the whole run. PercentComplete is that of the current phase: callbacks processed out of the approximate item count of the table
+// (as reported by DescribeTable, so it may be off, and is capped at 100), then actions executed out of those queued.
+type ProgressSnapshot struct {
+	Number             uint           `dynamodbav:"Number" json:"number"`
+	TableName          string         `dynamodbav:"TableName" json:"tablename"`
+	Undo               bool           `dynamodbav:"Undo,omitempty" json:"undo,omitempty"`
+	Owner              string         `dynamodbav:"Owner" json:"owner"`
+	Status             SnapshotStatus `dynamodbav:"Status" json:"status"`
+	Phase              string         `dynamodbav:"Phase" json:"phase"` // PhaseCallbacks or PhaseActions
+	ItemsEstimated     int64          `dynamodbav:"ItemsEstimated" json:"items_estimated"`
+	CallbacksProcessed uint           `dynamodbav:"CallbacksProcessed" json:"callbacks_processed"`
+	ActionsQueued      uint           `dynamodbav:"ActionsQueued" json:"actions_queued"`
+	ActionsExecuted    uint           `dynamodbav:"ActionsExecuted" json:"actions_executed"`
+	CallbackErrors     uint           `dynamodbav:"CallbackErrors" json:"callback_errors"`
+	ActionErrors       uint           `dynamodbav:"ActionErrors" json:"action_errors"`
+	PercentComplete    float64        `dynamodbav:"PercentComplete" json:"percent_complete"`
+	ItemsPerSecond     float64        `dynamodbav:"ItemsPerSecond" json:"items_per_second"`
+	ActionsPerSecond   float64        `dynamodbav:"ActionsPerSecond" json:"actions_per_second"`
+	Error              string         `dynamodbav:"Error,omitempty" json:"error,omitempty"` // First error of a failed run
+	Started            time.Time      `dynamodbav:"Started" json:"started"`
+	Updated            time.Time      `dynamodbav:"Updated" json:"updated"`
+}
+
+// snapshotter tracks the progress of a run and periodically writes snapshots
+type snapshotter struct {
+	sync.Mutex
+	snap         ProgressSnapshot
+	phaseStarted time.Time
+	write        func(snap ProgressSnapshot) error
+}
+
+// observe updates the snapshot from a progress message
+func (s *snapshotter) observe(mp *MigrationProgress) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().UTC()
+	if mp.CallbacksProcessed != 0 {
+		if s.snap.Phase != PhaseCallbacks { // a new scan started
+			s.snap.Phase = PhaseCallbacks
+			s.snap.ActionsQueued = 0
+			s.snap.ActionsExecuted = 0
+			s.phaseStarted = now
+		}
+		s.snap.CallbacksProcessed = mp.CallbacksProcessed
+	}
+	if mp.ActionsExecuted != 0 {
+		if s.snap.Phase != PhaseActions {
+			s.snap.Phase = PhaseActions
+			s.phaseStarted = now
+		}
+		s.snap.ActionsExecuted = mp.ActionsExecuted
+		s.snap.ActionsQueued = mp.ActionsQueued
+	}
+	s.snap.CallbackErrors += uint(len(mp.CallbackErrors))
+	s.snap.ActionErrors += uint(len(mp.ActionErrors))
+}
+
+// snapshot returns the current snapshot with computed percentage and rates
+func (s *snapshotter) snapshot() ProgressSnapshot {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().UTC()
+	snap := s.snap
+	snap.Updated = now
+	elapsed := now.Sub(s.phaseStarted).Seconds()
+	switch snap.Phase {
+	case PhaseCallbacks:
+		if snap.ItemsEstimated > 0 {
+			snap.PercentComplete = 100 * float64(snap.CallbacksProcessed) / float64(snap.ItemsEstimated)
+		}
+		if elapsed > 0 {
+			snap.ItemsPerSecond = float64(snap.CallbacksProcessed) / elapsed
+		}
+	case PhaseActions:
+		if snap.ActionsQueued > 0 {
+			snap.PercentComplete = 100 * float64(snap.ActionsExecuted) / float64(snap.ActionsQueued)
+		}
+		if elapsed > 0 {
+			snap.ActionsPerSecond = float64(snap.ActionsExecuted) / elapsed
+		}
+	}
+	if snap.PercentComplete > 100 || snap.Status == SnapshotCompleted {
+		snap.PercentComplete = 100
+	}
+	return snap
+}
+
+// finish sets the final status of the run from its errors
+func (s *snapshotter) finish(errs []error) {
+	s.Lock()
+	defer s.Unlock()
+	if len(errs) != 0 {
+		s.snap.Status = SnapshotFailed
+		s.snap.Error = errs[0].Error()
+		return
+	}
+	s.snap.Status = SnapshotCompleted
+}
+
+// putSnapshot writes snap as an item of the progress table
+func (dd *DynamoDrifter) putSnapshot(snap ProgressSnapshot) error {
+	item, err := dynamodbattribute.MarshalMap(snap)
+	if err != nil {
+		return fmt.Errorf("error marshaling progress snapshot: %v", err)
+	}
+	req, _ := dd.DynamoDB.PutItemRequest(&dynamodb.PutItemInput{
+		TableName: aws.String(dd.ProgressTable),
+		Item:      item,
+	})
+	if err := dd.send(context.Background(), req); err != nil {
+		return fmt.Errorf("error writing progress snapshot: %v", err)
+	}
+	return nil
+}
+
+// startSnapshots starts progress snapshots for a run of migration if enabled, returning the progress channel to use for the run in place of
+// progressChan and a function stopping the snapshots, which must be passed the errors of the run.
+func (dd *DynamoDrifter) startSnapshots(migration *DynamoDrifterMigration, undo bool, progressChan chan *MigrationProgress) (chan *MigrationProgress, func(errs []error)) {
+	if dd.SnapshotInterval <= 0 || migration == nil {
+		return progressChan, func([]error) {}
+	}
+	owner := dd.Owner
+	if owner == "" {
+		owner = DefaultOwner()
+	}
+	now := time.Now().UTC()
+	s := &snapshotter{
+		snap: ProgressSnapshot{
+			Number:    migration.Number,
+			TableName: migration.TableName,
+			Undo:      undo,
+			Owner:     owner,
+			Status:    SnapshotRunning,
+			Phase:     PhaseCallbacks,
+			Started:   now,
+		},
+		phaseStarted: now,
+		write:        dd.putSnapshot,
+	}
+	if dd.ProgressTable == "" {
+		rr := &runRecord{dd: dd, migration: migration, undo: undo}
+		s.write = func(snap ProgressSnapshot) error { return rr.set("Progress", snap) }
+	}
+	if td, _, err := dd.describeTable(context.Background(), migration.TableName); err == nil {
+		s.snap.ItemsEstimated = aws.Int64Value(td.ItemCount)
+	}
+	s.write(s.snapshot()) // snapshots are best effort
+	pc, stop := tapProgress(progressChan, dd.SnapshotInterval, s.observe, func() { s.write(s.snapshot()) })
+	return pc, func(errs []error) {
+		stop()
+		s.finish(errs)
+		if dd.ProgressTable != "" || len(errs) != 0 { // completed meta table records are replaced
+			s.write(s.snapshot())
+		}
+	}
+}
+
+// Progress returns the latest progress snapshot of migration number, or nil if there is none
+func (dd *DynamoDrifter) Progress(number uint) (*ProgressSnapshot, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	if dd.ProgressTable == "" {
+		m, err := dd.getMetaItem(number)
+		if err != nil || m == nil {
+			return nil, err
+		}
+		return m.Progress, nil
+	}
+	req, out := dd.DynamoDB.GetItemRequest(&dynamodb.GetItemInput{
+		TableName:      aws.String(dd.ProgressTable),
+		Key:            map[string]*dynamodb.AttributeValue{"Number": &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(int(number)))}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err := dd.send(context.Background(), req); err != nil {
+		return nil, fmt.Errorf("error getting progress snapshot: %v", err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	snap := &ProgressSnapshot{}
+	if err := dynamodbattribute.UnmarshalMap(out.Item, snap); err != nil {
+		return nil, fmt.Errorf("error unmarshaling progress snapshot: %v", err)
+	}
+	return snap, nil
+}
@@ -0,0 +1,40 @@
+package drift
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnapshotter(t *testing.T) {
+	s := &snapshotter{
+		snap:         ProgressSnapshot{Status: SnapshotRunning, Phase: PhaseCallbacks, ItemsEstimated: 10},
+		phaseStarted: time.Now().Add(-time.Second),
+	}
+	s.observe(&MigrationProgress{CallbacksProcessed: 5, CallbackErrors: []error{fmt.Errorf("foo")}})
+	snap := s.snapshot()
+	if snap.PercentComplete != 50 || snap.ItemsPerSecond <= 0 || snap.ItemsPerSecond > 5 || snap.CallbackErrors != 1 {
+		t.Fatalf("bad callbacks snapshot: %+v", snap)
+	}
+	s.observe(&MigrationProgress{CallbacksProcessed: 20})
+	if snap = s.snapshot(); snap.PercentComplete != 100 {
+		t.Fatalf("percent complete should be capped: %+v", snap)
+	}
+	s.observe(&MigrationProgress{ActionsExecuted: 1, ActionsQueued: 4, ActionErrors: []error{fmt.Errorf("bar")}})
+	snap = s.snapshot()
+	if snap.Phase != PhaseActions || snap.PercentComplete != 25 || snap.ActionsPerSecond <= 0 || snap.ActionErrors != 1 || snap.CallbacksProcessed != 20 {
+		t.Fatalf("bad actions snapshot: %+v", snap)
+	}
+	s.observe(&MigrationProgress{CallbacksProcessed: 1})
+	if snap = s.snapshot(); snap.Phase != PhaseCallbacks || snap.ActionsExecuted != 0 || snap.ActionsQueued != 0 || snap.CallbackErrors != 1 {
+		t.Fatalf("counters should have been reset by a new scan: %+v", snap)
+	}
+	s.finish([]error{fmt.Errorf("baz")})
+	if snap = s.snapshot(); snap.Status != SnapshotFailed || snap.Error != "baz" {
+		t.Fatalf("bad failed snapshot: %+v", snap)
+	}
+	s.finish(nil)
+	if snap = s.snapshot(); snap.Status != SnapshotCompleted || snap.PercentComplete != 100 {
+		t.Fatalf("bad completed snapshot: %+v", snap)
+	}
+}
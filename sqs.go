@@ -0,0 +1,244 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SQS distribution mode: a coordinator (EnqueueSegments) sends a task per scan segment of a migration to an SQS queue, and any number of
+// stateless SQSWorkers process them. Workers process a task a chunk at a time: after each chunk they checkpoint it by sending a task
+// resuming after the last item scanned, and ack the processed one. A worker dying mid-chunk leaves its task in the queue, to be processed
+// again by another worker once its visibility timeout expires (callbacks must be idempotent). Completed segments are recorded in the meta
+// table record of the migration, and the worker completing the last one records the migration as applied.
+
+// SegmentTask is a task of the SQS distribution mode, sent as a JSON message body: a scan segment of a migration, resumed after Key if set
+type SegmentTask struct {
+	Number   uint                                `json:"number"`
+	Segment  uint                                `json:"segment"`
+	Segments uint                                `json:"segments"`
+	Key      map[string]*dynamodb.AttributeValue `json:"key,omitempty"`
+}
+
+func sendTask(ctx context.Context, svc *sqs.SQS, queueURL string, task *SegmentTask) error {
+	b, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("error marshaling task: %v", err)
+	}
+	req, _ := svc.SendMessageRequest(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(b)),
+	})
+	if err := sendContext(ctx, req); err != nil {
+		return fmt.Errorf("error sending task of segment %v: %v", task.Segment, err)
+	}
+	return nil
+}
+
+// EnqueueSegments is the coordinator of the SQS distribution mode: it marks migration in progress in the meta table and sends a task per
+// scan segment (see ScanSegments) to the queue, to be processed by SQSWorkers registering the migration. Enqueueing a migration again
+// (ex: after purging the queue of a failed run) restarts it from scratch.
+func (dd *DynamoDrifter) EnqueueSegments(ctx context.Context, svc *sqs.SQS, queueURL string, migration *DynamoDrifterMigration) error {
+	if dd.DynamoDB == nil || svc == nil {
+		return fmt.Errorf("DynamoDB and SQS clients are required")
+	}
+	if err := validateCallbacks(migration); err != nil {
+		return err
+	}
+	if migration.TableName == "" {
+		return fmt.Errorf("TableName is required")
+	}
+	segments := migration.ScanSegments
+	if segments == 0 {
+		segments = 1
+	}
+	ui := &dynamodb.UpdateItemInput{
+		TableName:           &dd.MetaTableName,
+		Key:                 metaKey(migration.Number),
+		UpdateExpression:    aws.String("SET #s = :s, #tn = :tn, #d = :d, #ip = :true REMOVE #sd"),
+		ConditionExpression: aws.String("attribute_not_exists(#n) OR #ip = :true"),
+		ExpressionAttributeNames: map[string]*string{
+			"#n":  aws.String("Number"),
+			"#s":  aws.String("Segments"),
+			"#sd": aws.String("SegmentsDone"),
+			"#tn": aws.String("TableName"),
+			"#d":  aws.String("Description"),
+			"#ip": aws.String("InProgress"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":s":    &dynamodb.AttributeValue{N: aws.String(strconv.FormatUint(uint64(segments), 10))},
+			":tn":   &dynamodb.AttributeValue{S: aws.String(migration.TableName)},
+			":d":    &dynamodb.AttributeValue{S: aws.String(migration.Description)},
+			":true": &dynamodb.AttributeValue{BOOL: aws.Bool(true)},
+		},
+	}
+	req, _ := dd.DynamoDB.UpdateItemRequest(ui)
+	err := dd.send(ctx, req)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+		return fmt.Errorf("migration %v is already applied", migration.Number)
+	}
+	if err != nil {
+		return fmt.Errorf("error marking migration in progress: %v", err)
+	}
+	for seg := uint(0); seg < segments; seg++ {
+		if err := sendTask(ctx, svc, queueURL, &SegmentTask{Number: migration.Number, Segment: seg, Segments: segments}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metaKey returns the meta table key of migration number
+func metaKey(number uint) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Number": &dynamodb.AttributeValue{N: aws.String(strconv.FormatUint(uint64(number), 10))},
+	}
+}
+
+// SQSWorker is a stateless worker of the SQS distribution mode, processing the tasks of the migrations of Registry
+type SQSWorker struct {
+	Drifter  *DynamoDrifter
+	SQS      *sqs.SQS
+	QueueURL string
+	Registry *Registry
+
+	// Items scanned per chunk (defaults to 1000). Chunks must be processed within the visibility timeout of the queue.
+	ChunkSize        uint
+	Concurrency      uint // See DynamoDrifter.Run
+	FailOnFirstError bool // See DynamoDrifter.Run
+
+	WaitTime time.Duration // Long polling wait time of receives (defaults to 20s, the maximum)
+}
+
+// processTask processes a chunk of task, returning the task resuming it or nil if the segment is done
+func (w *SQSWorker) processTask(ctx context.Context, task *SegmentTask) (*SegmentTask, error) {
+	m := w.Registry.get(task.Number)
+	if m == nil {
+		return nil, fmt.Errorf("migration %v is not registered", task.Number)
+	}
+	if err := validateCallbacks(m); err != nil {
+		return nil, fmt.Errorf("migration %v: %v", task.Number, err)
+	}
+	if task.Segments == 0 || task.Segment >= task.Segments {
+		return nil, fmt.Errorf("invalid segment %v of %v", task.Segment, task.Segments)
+	}
+	chunk := w.ChunkSize
+	if chunk == 0 {
+		chunk = 1000
+	}
+	sm := *m
+	sm.ScanSegments = task.Segments
+	bounds := make([]*scanBounds, task.Segments)
+	bounds[task.Segment] = &scanBounds{start: task.Key, last: task.Key, maxItems: chunk}
+	if errs := w.Drifter.run(ctx, &sm, w.Concurrency, w.FailOnFirstError, bounds, nil); len(errs) != 0 {
+		return nil, fmt.Errorf("migration %v segment %v: %w", task.Number, task.Segment, errors.Join(errs...))
+	}
+	if b := bounds[task.Segment]; !b.done {
+		next := *task
+		next.Key = b.last
+		return &next, nil
+	}
+	return nil, w.segmentDone(ctx, m, task)
+}
+
+// segmentDone records the completion of the segment of task, and the completion of the migration if it was the last one
+func (w *SQSWorker) segmentDone(ctx context.Context, m *DynamoDrifterMigration, task *SegmentTask) error {
+	dd := w.Drifter
+	ui := &dynamodb.UpdateItemInput{
+		TableName:                &dd.MetaTableName,
+		Key:                      metaKey(task.Number),
+		UpdateExpression:         aws.String("ADD #sd :seg"),
+		ConditionExpression:      aws.String("#ip = :true"),
+		ExpressionAttributeNames: map[string]*string{"#sd": aws.String("SegmentsDone"), "#ip": aws.String("InProgress")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":seg":  &dynamodb.AttributeValue{NS: []*string{aws.String(strconv.FormatUint(uint64(task.Segment), 10))}},
+			":true": &dynamodb.AttributeValue{BOOL: aws.Bool(true)},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	}
+	req, out := dd.DynamoDB.UpdateItemRequest(ui)
+	err := dd.send(ctx, req)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "ConditionalCheckFailedException" {
+		return nil // the migration was already completed (redelivered task)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording completion of segment %v: %v", task.Segment, err)
+	}
+	if done := out.Attributes["SegmentsDone"]; done == nil || uint(len(done.NS)) < task.Segments {
+		return nil
+	}
+	return dd.insertMetaItem(m)
+}
+
+// ProcessOne receives a task and processes a chunk of it, returning whether a task was received. Failed tasks are left in the queue to be
+// retried after their visibility timeout (configure a redrive policy to dead-letter repeatedly failing tasks).
+func (w *SQSWorker) ProcessOne(ctx context.Context) (bool, error) {
+	if w.Drifter == nil || w.Drifter.DynamoDB == nil || w.SQS == nil || w.Registry == nil {
+		return false, fmt.Errorf("Drifter (with a DynamoDB client), SQS and Registry are required")
+	}
+	wait := w.WaitTime
+	if wait == 0 {
+		wait = 20 * time.Second
+	}
+	req, out := w.SQS.ReceiveMessageRequest(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(w.QueueURL),
+		MaxNumberOfMessages: aws.Int64(1),
+		WaitTimeSeconds:     aws.Int64(int64(wait / time.Second)),
+	})
+	if err := sendContext(ctx, req); err != nil {
+		return false, fmt.Errorf("error receiving task: %v", err)
+	}
+	if len(out.Messages) == 0 {
+		return false, nil
+	}
+	msg := out.Messages[0]
+	task := &SegmentTask{}
+	if err := json.Unmarshal([]byte(aws.StringValue(msg.Body)), task); err != nil {
+		return true, fmt.Errorf("invalid task %v: %v", aws.StringValue(msg.MessageId), err)
+	}
+	next, err := w.processTask(ctx, task)
+	if err != nil {
+		return true, err
+	}
+	if next != nil {
+		if err := sendTask(ctx, w.SQS, w.QueueURL, next); err != nil {
+			return true, err
+		}
+	}
+	req, _ = w.SQS.DeleteMessageRequest(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(w.QueueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err := sendContext(ctx, req); err != nil {
+		return true, fmt.Errorf("error deleting task %v: %v", aws.StringValue(msg.MessageId), err)
+	}
+	return true, nil
+}
+
+// Run processes tasks until ctx is cancelled, returning ctx.Err(). Errors of individual tasks are passed to onError (optional).
+func (w *SQSWorker) Run(ctx context.Context, onError func(error)) error {
+	for ctx.Err() == nil {
+		_, err := w.ProcessOne(ctx)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		if onError != nil {
+			onError(err)
+		}
+		select { // avoid spinning on persistent errors (ex: an unreachable queue)
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,48 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestSegmentTaskJSON(t *testing.T) {
+	task := &SegmentTask{
+		Number:   2,
+		Segment:  1,
+		Segments: 4,
+		Key:      map[string]*dynamodb.AttributeValue{"id": &dynamodb.AttributeValue{N: aws.String("10")}},
+	}
+	b, err := json.Marshal(task)
+	if err != nil {
+		t.Fatalf("error marshaling task: %v", err)
+	}
+	decoded := &SegmentTask{}
+	if err := json.Unmarshal(b, decoded); err != nil {
+		t.Fatalf("error unmarshaling task: %v", err)
+	}
+	if decoded.Number != 2 || decoded.Segment != 1 || decoded.Segments != 4 || aws.StringValue(decoded.Key["id"].N) != "10" {
+		t.Fatalf("bad decoded task: %+v", decoded)
+	}
+}
+
+func TestSQSWorkerInvalidTasks(t *testing.T) {
+	r := &Registry{}
+	err := r.Register(&DynamoDrifterMigration{Number: 1, TableName: "foo", Callback: func(RawDynamoItem, *DrifterAction) error { return nil }})
+	if err != nil {
+		t.Fatalf("error registering migration: %v", err)
+	}
+	w := &SQSWorker{Drifter: &DynamoDrifter{}, Registry: r}
+	if _, err := w.processTask(context.Background(), &SegmentTask{Number: 2, Segments: 1}); err == nil {
+		t.Fatalf("task of an unregistered migration should fail")
+	}
+	if _, err := w.processTask(context.Background(), &SegmentTask{Number: 1, Segment: 1, Segments: 1}); err == nil {
+		t.Fatalf("task of an invalid segment should fail")
+	}
+	if _, err := w.ProcessOne(context.Background()); err == nil {
+		t.Fatalf("worker without clients should fail")
+	}
+}
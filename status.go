@@ -0,0 +1,82 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// MigrationStatus is a meta table record as served by StatusHandler
+type MigrationStatus struct {
+	DynamoDrifterMigration
+	Stale bool `json:"stale,omitempty"` // The heartbeat is older than three heartbeat intervals (only if DynamoDrifter.HeartbeatInterval is set)
+}
+
+// History returns all meta table records (completed and in progress) in ascending order
+func (dd *DynamoDrifter) History() ([]DynamoDrifterMigration, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	return dd.metaRecords(context.Background())
+}
+
+// StatusHandler returns an http.Handler serving the state of migrations as JSON, to check on migrations from a browser or curl
+// (ex: http.ListenAndServe(":8080", dd.StatusHandler())). Mount it at the root, or strip any prefix with http.StripPrefix.
+//
+//	GET /migrations/status:  {"running": [MigrationStatus...]} migrations in progress, with their heartbeat and progress snapshot if enabled
+//	GET /migrations/history: {"migrations": [MigrationStatus...]} all meta table records (completed and in progress) in ascending order
+//
+// Errors are served with status 500 as {"error": "..."}.
+func (dd *DynamoDrifter) StatusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/migrations/status", func(w http.ResponseWriter, r *http.Request) {
+		dd.serveStatus(w, r, "running", dd.Running)
+	})
+	mux.HandleFunc("/migrations/history", func(w http.ResponseWriter, r *http.Request) {
+		dd.serveStatus(w, r, "migrations", dd.History)
+	})
+	return mux
+}
+
+func (dd *DynamoDrifter) serveStatus(w http.ResponseWriter, r *http.Request, key string, records func() ([]DynamoDrifterMigration, error)) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	ms, err := records()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	statuses, err := dd.statuses(ms)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]MigrationStatus{key: statuses})
+}
+
+// statuses returns the status of meta table records, with their progress snapshot if they are running and snapshots are enabled
+func (dd *DynamoDrifter) statuses(ms []DynamoDrifterMigration) ([]MigrationStatus, error) {
+	statuses := make([]MigrationStatus, len(ms))
+	for i, m := range ms {
+		if dd.ProgressTable != "" && (m.InProgress || m.Heartbeat != nil) {
+			var err error
+			if m.Progress, err = dd.Progress(m.Number); err != nil {
+				return nil, err
+			}
+		}
+		statuses[i] = MigrationStatus{DynamoDrifterMigration: m}
+		if m.Heartbeat != nil && dd.HeartbeatInterval > 0 {
+			statuses[i].Stale = m.Heartbeat.Stale(3 * dd.HeartbeatInterval)
+		}
+	}
+	return statuses, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
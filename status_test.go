@@ -0,0 +1,34 @@
+package drift
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusHandlerErrors(t *testing.T) {
+	dd := &DynamoDrifter{}
+	h := dd.StatusHandler()
+	for _, path := range []string{"/migrations/status", "/migrations/history"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("%v: error decoding body: %v", path, err)
+		}
+		if rec.Code != http.StatusInternalServerError || body["error"] == "" {
+			t.Fatalf("%v: expected an error without a client: %v %v", path, rec.Code, body)
+		}
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", path, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("%v: POST should not be allowed: %v", path, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/foo", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown path should not be found: %v", rec.Code)
+	}
+}
@@ -0,0 +1,236 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// MigrationStep is a step of a multi-step migration: either a function (ex: create an index, wait for it to become active, verify the result)
+// or a scan of the migration table running Callback or BatchCallback for the items (ex: a backfill), using the migration's settings.
+// Exactly one of Func, Callback and BatchCallback must be set.
+type MigrationStep struct {
+	Name          string                                             // Name of the step, unique within the migration (used to record its completion)
+	Func          func(ctx context.Context, dd *DynamoDrifter) error // Function step
+	Callback      DynamoMigrationFunction                            // Scan step callback for each item
+	BatchCallback DynamoBatchMigrationFunction                       // Scan step callback for each page of items
+}
+
+// validateSteps checks the steps of a multi-step migration
+func validateSteps(migration *DynamoDrifterMigration) error {
+	if migration.Callback != nil || migration.BatchCallback != nil {
+		return fmt.Errorf("Callback and BatchCallback may not be set on multi-step migrations")
+	}
+	if migration.Idempotent {
+		return fmt.Errorf("multi-step migrations may not be Idempotent")
+	}
+	names := map[string]bool{}
+	for i, s := range migration.Steps {
+		if s.Name == "" {
+			return fmt.Errorf("step %v: name is required", i)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("duplicate step name: %v", s.Name)
+		}
+		names[s.Name] = true
+		n := 0
+		for _, set := range []bool{s.Func != nil, s.Callback != nil, s.BatchCallback != nil} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("step %v: exactly one of Func, Callback and BatchCallback must be set", s.Name)
+		}
+	}
+	return nil
+}
+
+// getMetaItem returns the meta table record of migration number, or nil if there is none
+func (dd *DynamoDrifter) getMetaItem(number uint) (*DynamoDrifterMigration, error) {
+	gi := &dynamodb.GetItemInput{
+		TableName:      &dd.MetaTableName,
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Number": &dynamodb.AttributeValue{
+				N: aws.String(formatMigrationNumber(number)),
+			},
+		},
+	}
+	req, gio := dd.DynamoDB.GetItemRequest(gi)
+	if err := dd.send(context.Background(), req); err != nil {
+		return nil, fmt.Errorf("error getting migration item from meta table: %v", err)
+	}
+	if len(gio.Item) == 0 {
+		return nil, nil
+	}
+	m := &DynamoDrifterMigration{}
+	if err := dynamodbattribute.UnmarshalMap(gio.Item, m); err != nil {
+		return nil, fmt.Errorf("error unmarshaling migration item: %v", err)
+	}
+	return m, nil
+}
+
+// StepStatus is the status of a step of a multi-step migration
+type StepStatus string
+
+// Step statuses
+const (
+	StepRunning   StepStatus = "running"
+	StepCompleted StepStatus = "completed"
+	StepFailed    StepStatus = "failed"
+)
+
+// StepProgressInterval is how often the progress record of a running scan step is updated in the meta table
+var StepProgressInterval = 10 * time.Second
+
+// StepProgress is the progress record of a step of a multi-step migration, stored in the migration's meta table record.
+// Counts are only recorded for scan steps and may lag slightly behind the actual progress of a running step.
+type StepProgress struct {
+	Name               string     `dynamodbav:"Name" json:"name"`
+	Status             StepStatus `dynamodbav:"Status" json:"status"`
+	CallbacksProcessed uint       `dynamodbav:"CallbacksProcessed" json:"callbacks_processed"`
+	ActionsExecuted    uint       `dynamodbav:"ActionsExecuted" json:"actions_executed"`
+	Errors             uint       `dynamodbav:"Errors" json:"errors"`                   // Callback and action errors
+	Error              string     `dynamodbav:"Error,omitempty" json:"error,omitempty"` // First error of a failed step
+	Started            time.Time  `dynamodbav:"Started" json:"started"`
+	Updated            time.Time  `dynamodbav:"Updated" json:"updated"`
+}
+
+// stepRecorder maintains the meta table record of a running multi-step migration
+type stepRecorder struct {
+	sync.Mutex
+	dd     *DynamoDrifter
+	record DynamoDrifterMigration
+}
+
+// completed returns whether step name was completed by a previous run
+func (sr *stepRecorder) completed(name string) bool {
+	sr.Lock()
+	defer sr.Unlock()
+	for _, p := range sr.record.StepProgress {
+		if p.Name == name {
+			return p.Status == StepCompleted
+		}
+	}
+	return false
+}
+
+// update calls f with the progress record of step name (adding it if necessary)
+func (sr *stepRecorder) update(name string, f func(p *StepProgress)) {
+	sr.Lock()
+	defer sr.Unlock()
+	i := 0
+	for i < len(sr.record.StepProgress) && sr.record.StepProgress[i].Name != name {
+		i++
+	}
+	if i == len(sr.record.StepProgress) {
+		sr.record.StepProgress = append(sr.record.StepProgress, StepProgress{Name: name})
+	}
+	f(&sr.record.StepProgress[i])
+	sr.record.StepProgress[i].Updated = time.Now().UTC()
+}
+
+// save writes the record to the meta table
+func (sr *stepRecorder) save() error {
+	sr.Lock()
+	record := sr.record
+	record.StepProgress = append([]StepProgress{}, sr.record.StepProgress...)
+	sr.Unlock()
+	return sr.dd.insertMetaItem(&record)
+}
+
+// runSteps runs the steps of a multi-step migration in order. If checkpoint is set, the progress of each step is recorded in the
+// migration's meta table record (marked InProgress until all steps complete), and steps completed by a previous run are skipped.
+func (dd *DynamoDrifter) runSteps(ctx context.Context, migration *DynamoDrifterMigration, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress, checkpoint bool) []error {
+	if err := validateSteps(migration); err != nil {
+		return []error{err}
+	}
+	var sr *stepRecorder
+	if checkpoint {
+		sr = &stepRecorder{dd: dd, record: *migration}
+		sr.record.InProgress = true
+		sr.record.StepProgress = nil
+		prev, err := dd.getMetaItem(migration.Number)
+		if err != nil {
+			return []error{err}
+		}
+		if prev != nil && prev.InProgress {
+			sr.record.StepProgress = prev.StepProgress
+		}
+	}
+	for _, s := range migration.Steps {
+		if sr != nil && sr.completed(s.Name) {
+			dd.logf(VerbosityVerbose, "step %v of migration %v already completed", s.Name, migration.Number)
+			continue
+		}
+		dd.logf(VerbosityVerbose, "step %v of migration %v started", s.Name, migration.Number)
+		errs := dd.runStep(ctx, migration, s, concurrency, failOnFirstError, progressChan, sr)
+		if sr != nil {
+			sr.update(s.Name, func(p *StepProgress) {
+				p.Status = StepCompleted
+				if len(errs) != 0 {
+					p.Status = StepFailed
+					p.Error = errs[0].Error()
+				}
+			})
+			if err := sr.save(); err != nil {
+				errs = append(errs, fmt.Errorf("error recording progress of step %v: %w", s.Name, err))
+			}
+		}
+		if len(errs) != 0 {
+			return errs
+		}
+	}
+	return []error{}
+}
+
+// runStep runs an individual step, recording its progress with sr if not nil
+func (dd *DynamoDrifter) runStep(ctx context.Context, migration *DynamoDrifterMigration, s MigrationStep, concurrency uint, failOnFirstError bool, progressChan chan *MigrationProgress, sr *stepRecorder) []error {
+	if sr != nil {
+		sr.update(s.Name, func(p *StepProgress) {
+			*p = StepProgress{Name: s.Name, Status: StepRunning, Started: time.Now().UTC()}
+		})
+		if err := sr.save(); err != nil {
+			return []error{fmt.Errorf("error recording progress of step %v: %w", s.Name, err)}
+		}
+	}
+	if s.Func != nil {
+		if err := s.Func(ctx, dd); err != nil {
+			return []error{fmt.Errorf("step %v: %w", s.Name, err)}
+		}
+		return nil
+	}
+	sm := *migration
+	sm.Steps = nil
+	sm.Callback = s.Callback
+	sm.BatchCallback = s.BatchCallback
+	pc, stop := progressChan, func() {}
+	if sr != nil {
+		// track progress messages in the step record
+		pc, stop = tapProgress(progressChan, StepProgressInterval, func(mp *MigrationProgress) {
+			sr.update(s.Name, func(p *StepProgress) {
+				if mp.CallbacksProcessed > p.CallbacksProcessed {
+					p.CallbacksProcessed = mp.CallbacksProcessed
+				}
+				if mp.ActionsExecuted > p.ActionsExecuted {
+					p.ActionsExecuted = mp.ActionsExecuted
+				}
+				p.Errors += uint(len(mp.CallbackErrors) + len(mp.ActionErrors))
+			})
+		}, func() {
+			sr.save() // best effort, the final status is saved by runSteps
+		})
+	}
+	errs := dd.run(ctx, &sm, concurrency, failOnFirstError, nil, pc)
+	stop()
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("step %v: %w", s.Name, err)
+	}
+	return errs
+}
@@ -0,0 +1,41 @@
+package drift
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValidateSteps(t *testing.T) {
+	f := func(ctx context.Context, dd *DynamoDrifter) error { return nil }
+	cb := func(item RawDynamoItem, action *DrifterAction) error { return nil }
+	cases := []struct {
+		name  string
+		m     DynamoDrifterMigration
+		valid bool
+	}{
+		{"valid", DynamoDrifterMigration{Steps: []MigrationStep{{Name: "a", Func: f}, {Name: "b", Callback: cb}}}, true},
+		{"missing name", DynamoDrifterMigration{Steps: []MigrationStep{{Func: f}}}, false},
+		{"duplicate name", DynamoDrifterMigration{Steps: []MigrationStep{{Name: "a", Func: f}, {Name: "a", Callback: cb}}}, false},
+		{"no step type", DynamoDrifterMigration{Steps: []MigrationStep{{Name: "a"}}}, false},
+		{"two step types", DynamoDrifterMigration{Steps: []MigrationStep{{Name: "a", Func: f, Callback: cb}}}, false},
+		{"migration callback", DynamoDrifterMigration{Callback: cb, Steps: []MigrationStep{{Name: "a", Func: f}}}, false},
+	}
+	for _, c := range cases {
+		if err := validateSteps(&c.m); (err == nil) != c.valid {
+			t.Fatalf("%v: bad validation result: %v", c.name, err)
+		}
+	}
+}
+
+func TestStepRecorder(t *testing.T) {
+	sr := &stepRecorder{record: DynamoDrifterMigration{StepProgress: []StepProgress{{Name: "a", Status: StepCompleted}, {Name: "b", Status: StepFailed}}}}
+	if !sr.completed("a") || sr.completed("b") || sr.completed("c") {
+		t.Fatalf("bad completed steps: %+v", sr.record.StepProgress)
+	}
+	sr.update("b", func(p *StepProgress) { p.Status = StepRunning })
+	sr.update("c", func(p *StepProgress) { p.CallbacksProcessed = 10 })
+	ps := sr.record.StepProgress
+	if len(ps) != 3 || ps[1].Status != StepRunning || ps[2].Name != "c" || ps[2].CallbacksProcessed != 10 || ps[2].Updated.IsZero() {
+		t.Fatalf("bad step progress: %+v", ps)
+	}
+}
@@ -0,0 +1,296 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+)
+
+// Incremental migrations apply a migration to items as they change, from a DynamoDB stream or a Kinesis Data Stream of the table, instead
+// of scanning it ("migrate going forward"). Writes of the migration itself appear in the stream, so callbacks must be idempotent and should
+// not queue actions for items which are already migrated (ex: use Versioning, which skips them).
+
+// ApplyItems runs the callbacks of migration for items instead of scanning its table, and then executes the queued actions. Unlike Run,
+// the migration is not recorded in the meta table.
+func (dd *DynamoDrifter) ApplyItems(ctx context.Context, migration *DynamoDrifterMigration, items []RawDynamoItem, concurrency uint, failOnFirstError bool) []error {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return []error{err}
+	}
+	if err := validateCallbacks(migration); err != nil {
+		return []error{err}
+	}
+	if migration.CallbackConcurrency != 0 {
+		concurrency = migration.CallbackConcurrency
+	}
+	da := dd.newDrifterAction(migration)
+	var errs []error
+	if migration.BatchCallback != nil {
+		batch := make([]RawDynamoItem, 0, len(items))
+		for _, item := range items {
+			ok, err := migration.admit(item)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if ok {
+				batch = append(batch, item)
+			}
+		}
+		if len(batch) > 0 {
+			if err := withLabels(ctx, migration, "callbacks", func(ctx context.Context) error {
+				return migration.BatchCallback(batch, da)
+			}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	} else {
+		pool := newWorkerPool(ctx, concurrency, func(ctx context.Context, f func(ctx context.Context) error) error {
+			return withLabels(ctx, migration, "callbacks", f)
+		}, func(ctx context.Context, item RawDynamoItem) error {
+			if ok, err := migration.admit(item); !ok {
+				return err
+			}
+			if migration.ItemTransactions {
+				return migration.Callback(item, da.forItem())
+			}
+			return migration.Callback(item, da)
+		})
+		for _, item := range items {
+			pool.submit(item)
+		}
+		errs = pool.wait()
+		pool.close()
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return dd.executeActions(ctx, migration, da, concurrency, failOnFirstError, nil)
+}
+
+// changedItems returns the new images of inserted and modified items of records, keeping only the latest image of each item
+func changedItems(records []*dynamodbstreams.Record) ([]RawDynamoItem, error) {
+	items := []RawDynamoItem{}
+	byKey := map[string]int{}
+	for _, r := range records {
+		if r.Dynamodb == nil {
+			continue
+		}
+		switch aws.StringValue(r.EventName) {
+		case dynamodbstreams.OperationTypeInsert, dynamodbstreams.OperationTypeModify:
+		default:
+			continue // removed items
+		}
+		if r.Dynamodb.NewImage == nil {
+			return nil, fmt.Errorf("record %v has no new image (the stream view type must include new images)", aws.StringValue(r.EventID))
+		}
+		k, err := json.Marshal(r.Dynamodb.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling keys of record %v: %v", aws.StringValue(r.EventID), err)
+		}
+		if i, ok := byKey[string(k)]; ok {
+			items[i] = r.Dynamodb.NewImage
+			continue
+		}
+		byKey[string(k)] = len(items)
+		items = append(items, r.Dynamodb.NewImage)
+	}
+	return items, nil
+}
+
+// ApplyStreamRecords applies migration (see ApplyItems) to the items inserted or modified by records of a DynamoDB stream of its table,
+// ex: from a Lambda function triggered by the stream. The stream view type must include new images.
+func (dd *DynamoDrifter) ApplyStreamRecords(ctx context.Context, migration *DynamoDrifterMigration, records []*dynamodbstreams.Record, concurrency uint, failOnFirstError bool) []error {
+	items, err := changedItems(records)
+	if err != nil {
+		return []error{err}
+	}
+	if len(items) == 0 {
+		return []error{}
+	}
+	return dd.ApplyItems(ctx, migration, items, concurrency, failOnFirstError)
+}
+
+// ApplyKinesisRecords applies migration (see ApplyItems) to the items inserted or modified by the change records of a Kinesis Data Stream
+// of its table (the JSON data of the Kinesis records).
+func (dd *DynamoDrifter) ApplyKinesisRecords(ctx context.Context, migration *DynamoDrifterMigration, data [][]byte, concurrency uint, failOnFirstError bool) []error {
+	records := make([]*dynamodbstreams.Record, 0, len(data))
+	for i, d := range data {
+		var cr struct {
+			EventID   *string                       `json:"eventID"`
+			EventName *string                       `json:"eventName"`
+			Dynamodb  *dynamodbstreams.StreamRecord `json:"dynamodb"`
+		}
+		if err := json.Unmarshal(d, &cr); err != nil {
+			return []error{fmt.Errorf("error unmarshaling change record %v: %v", i, err)}
+		}
+		records = append(records, &dynamodbstreams.Record{EventID: cr.EventID, EventName: cr.EventName, Dynamodb: cr.Dynamodb})
+	}
+	return dd.ApplyStreamRecords(ctx, migration, records, concurrency, failOnFirstError)
+}
+
+// StreamConsumer applies a migration to items as they change by consuming a DynamoDB stream of its table (see ApplyStreamRecords), or
+// passes the records to Apply.
+// Shards are read concurrently, child shards once their parent is done. Positions are kept in memory: a restarted consumer starts reading
+// its shards again at the latest record (or the oldest, see StartAtOldest).
+type StreamConsumer struct {
+	Drifter   *DynamoDrifter
+	Streams   *dynamodbstreams.DynamoDBStreams
+	StreamARN string
+	Migration *DynamoDrifterMigration
+
+	// Apply handles the records read from a shard, in order, instead of applying Migration (optional)
+	Apply func(ctx context.Context, records []*dynamodbstreams.Record) []error
+
+	StartAtOldest    bool          // Start reading shards at their oldest record (TRIM_HORIZON) instead of the latest
+	PollInterval     time.Duration // Time between reads of a shard without new records, and between discoveries of new shards (defaults to 1s)
+	Concurrency      uint          // See DynamoDrifter.Run
+	FailOnFirstError bool          // See DynamoDrifter.Run
+
+	polled func(shard string, at time.Time, records []*dynamodbstreams.Record, closed bool) // called once the records of a read of shard at are applied (see BlueGreen)
+}
+
+func (sc *StreamConsumer) pollInterval() time.Duration {
+	if sc.PollInterval == 0 {
+		return time.Second
+	}
+	return sc.PollInterval
+}
+
+// shards returns the shards of the stream
+func (sc *StreamConsumer) shards(ctx context.Context) ([]*dynamodbstreams.Shard, error) {
+	shards := []*dynamodbstreams.Shard{}
+	in := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(sc.StreamARN)}
+	for {
+		req, out := sc.Streams.DescribeStreamRequest(in)
+		if err := sendContext(ctx, req); err != nil {
+			return nil, fmt.Errorf("error describing stream: %v", err)
+		}
+		if out.StreamDescription == nil {
+			return shards, nil
+		}
+		shards = append(shards, out.StreamDescription.Shards...)
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		in.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// apply applies records
+func (sc *StreamConsumer) apply(ctx context.Context, records []*dynamodbstreams.Record) []error {
+	if sc.Apply != nil {
+		return sc.Apply(ctx, records)
+	}
+	return sc.Drifter.ApplyStreamRecords(ctx, sc.Migration, records, sc.Concurrency, sc.FailOnFirstError)
+}
+
+// consumeShard applies the records of shard until it is closed or ctx is cancelled
+func (sc *StreamConsumer) consumeShard(ctx context.Context, shard *dynamodbstreams.Shard, onError func(error)) error {
+	it := dynamodbstreams.ShardIteratorTypeLatest
+	if sc.StartAtOldest {
+		it = dynamodbstreams.ShardIteratorTypeTrimHorizon
+	}
+	req, out := sc.Streams.GetShardIteratorRequest(&dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(sc.StreamARN),
+		ShardId:           shard.ShardId,
+		ShardIteratorType: aws.String(it),
+	})
+	if err := sendContext(ctx, req); err != nil {
+		return fmt.Errorf("error getting iterator of shard %v: %v", aws.StringValue(shard.ShardId), err)
+	}
+	iterator := out.ShardIterator
+	for iterator != nil {
+		at := time.Now()
+		req, gro := sc.Streams.GetRecordsRequest(&dynamodbstreams.GetRecordsInput{ShardIterator: iterator})
+		if err := sendContext(ctx, req); err != nil {
+			return fmt.Errorf("error getting records of shard %v: %v", aws.StringValue(shard.ShardId), err)
+		}
+		if len(gro.Records) != 0 {
+			if errs := sc.apply(ctx, gro.Records); len(errs) != 0 && onError != nil {
+				for _, err := range errs {
+					onError(fmt.Errorf("shard %v: %w", aws.StringValue(shard.ShardId), err))
+				}
+			}
+		}
+		iterator = gro.NextShardIterator
+		if sc.polled != nil {
+			sc.polled(aws.StringValue(shard.ShardId), at, gro.Records, iterator == nil)
+		}
+		if len(gro.Records) == 0 && iterator != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(sc.pollInterval()):
+			}
+		}
+	}
+	return nil // the shard is closed
+}
+
+// Run consumes the stream until ctx is cancelled, returning ctx.Err(). Errors are passed to onError (optional): records whose callbacks or
+// actions fail are skipped, shards failing to be read are retried.
+func (sc *StreamConsumer) Run(ctx context.Context, onError func(error)) error {
+	if sc.Drifter == nil || sc.Streams == nil || (sc.Migration == nil && sc.Apply == nil) {
+		return fmt.Errorf("Drifter, Streams and Migration (or Apply) are required")
+	}
+	if sc.Apply == nil {
+		if err := validateCallbacks(sc.Migration); err != nil {
+			return err
+		}
+	}
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	reading := map[string]bool{}
+	done := map[string]bool{}
+	report := func(err error) {
+		if onError != nil && ctx.Err() == nil {
+			mtx.Lock()
+			defer mtx.Unlock()
+			onError(err)
+		}
+	}
+	for {
+		shards, err := sc.shards(ctx)
+		if err != nil {
+			report(err)
+		}
+		known := map[string]bool{}
+		for _, s := range shards {
+			known[aws.StringValue(s.ShardId)] = true
+		}
+		for _, s := range shards {
+			id, parent := aws.StringValue(s.ShardId), aws.StringValue(s.ParentShardId)
+			mtx.Lock()
+			ready := !reading[id] && !done[id] && (parent == "" || !known[parent] || done[parent])
+			if ready {
+				reading[id] = true
+			}
+			mtx.Unlock()
+			if !ready {
+				continue
+			}
+			wg.Add(1)
+			go func(s *dynamodbstreams.Shard) {
+				defer wg.Done()
+				err := sc.consumeShard(ctx, s, report)
+				if err != nil && ctx.Err() == nil {
+					report(err)
+				}
+				mtx.Lock()
+				defer mtx.Unlock()
+				reading[id] = false
+				done[id] = err == nil
+			}(s)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sc.pollInterval()):
+		}
+	}
+}
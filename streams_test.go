@@ -0,0 +1,55 @@
+package drift
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+)
+
+func streamRecord(event, id, name string) *dynamodbstreams.Record {
+	key := map[string]*dynamodb.AttributeValue{"id": &dynamodb.AttributeValue{S: aws.String(id)}}
+	r := &dynamodbstreams.Record{
+		EventName: aws.String(event),
+		Dynamodb:  &dynamodbstreams.StreamRecord{Keys: key},
+	}
+	if name != "" {
+		r.Dynamodb.NewImage = map[string]*dynamodb.AttributeValue{
+			"id":   key["id"],
+			"name": &dynamodb.AttributeValue{S: aws.String(name)},
+		}
+	}
+	return r
+}
+
+func TestChangedItems(t *testing.T) {
+	items, err := changedItems([]*dynamodbstreams.Record{
+		streamRecord("INSERT", "1", "foo"),
+		streamRecord("INSERT", "2", "bar"),
+		streamRecord("MODIFY", "1", "baz"),
+		streamRecord("REMOVE", "2", ""),
+	})
+	if err != nil {
+		t.Fatalf("error getting changed items: %v", err)
+	}
+	if len(items) != 2 || aws.StringValue(items[0]["name"].S) != "baz" || aws.StringValue(items[1]["name"].S) != "bar" {
+		t.Fatalf("bad changed items: %v", items)
+	}
+	if _, err := changedItems([]*dynamodbstreams.Record{streamRecord("MODIFY", "1", "")}); err == nil {
+		t.Fatalf("records without new images should fail")
+	}
+}
+
+func TestApplyKinesisRecords(t *testing.T) {
+	dd := &DynamoDrifter{}
+	errs := dd.ApplyKinesisRecords(context.Background(), &DynamoDrifterMigration{}, [][]byte{[]byte("{")}, 1, false)
+	if len(errs) != 1 {
+		t.Fatalf("invalid records should fail: %v", errs)
+	}
+	data := []byte(`{"eventName":"REMOVE","dynamodb":{"Keys":{"id":{"S":"1"}}}}`)
+	if errs := dd.ApplyKinesisRecords(context.Background(), &DynamoDrifterMigration{}, [][]byte{data}, 1, false); len(errs) != 0 {
+		t.Fatalf("batch without changed items should be a noop: %v", errs)
+	}
+}
@@ -0,0 +1,377 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// maxTransactionActions is the maximum number of actions of a TransactWriteItems request
+const maxTransactionActions = 100
+
+// TransactWriteItems types, which the vendored SDK predates
+
+type transactWrite struct {
+	TableName                 *string
+	Key                       map[string]*dynamodb.AttributeValue
+	Item                      map[string]*dynamodb.AttributeValue
+	UpdateExpression          *string
+	ConditionExpression       *string
+	ExpressionAttributeNames  map[string]*string
+	ExpressionAttributeValues map[string]*dynamodb.AttributeValue
+}
+
+type transactWriteItem struct {
+	ConditionCheck *transactWrite
+	Put            *transactWrite
+	Update         *transactWrite
+	Delete         *transactWrite
+}
+
+type transactWriteItemsInput struct {
+	TransactItems          []transactWriteItem
+	ReturnConsumedCapacity *string
+}
+
+type transactWriteItemsOutput struct {
+	ConsumedCapacity []*dynamodb.ConsumedCapacity
+}
+
+// forItem returns a DrifterAction queuing the actions of a single callback invocation as a new group of the queue of da, see
+// ItemTransactions
+func (da *DrifterAction) forItem() *DrifterAction {
+	return &DrifterAction{
+		dyn:          da.dyn,
+		retry:        da.retry,
+		pace:         da.pace,
+		copyItems:    da.copyItems,
+		version:      da.version,
+		clones:       da.clones,
+		marker:       da.marker,
+		table:        da.table,
+		models:       da.models,
+		send:         da.send,
+		noDeletes:    da.noDeletes,
+		noOverwrites: da.noOverwrites,
+		parent:       da,
+		group:        atomic.AddUint64(&da.groups, 1),
+	}
+}
+
+// forTransaction returns a DrifterAction collecting the actions of a transaction in a queue of its own, see Transact
+func (da *DrifterAction) forTransaction() *DrifterAction {
+	return &DrifterAction{
+		dyn:          da.dyn,
+		retry:        da.retry,
+		pace:         da.pace,
+		copyItems:    da.copyItems,
+		version:      da.version,
+		clones:       da.clones,
+		marker:       da.marker,
+		table:        da.table,
+		models:       da.models,
+		send:         da.send,
+		noDeletes:    da.noDeletes,
+		noOverwrites: da.noOverwrites,
+		txn:          true,
+	}
+}
+
+// TransactOp is a write of a transaction, which queues it with da (see DrifterAction.Transact). Any function queuing actions works, ex:
+//
+//	func(da *drift.DrifterAction) error { return da.UpdateItem(key, "").Add("Count", 1).Queue() }
+type TransactOp func(da *DrifterAction) error
+
+// TransactInsert returns a TransactOp inserting item, see DrifterAction.Insert
+func TransactInsert(item interface{}, tableName string, condition ...Condition) TransactOp {
+	return func(da *DrifterAction) error {
+		return da.Insert(item, tableName, condition...)
+	}
+}
+
+// TransactUpdate returns a TransactOp updating the item with keys, see DrifterAction.Update
+func TransactUpdate(keys interface{}, values interface{}, updateExpression string, expressionAttributeNames map[string]string, tableName string, condition ...Condition) TransactOp {
+	return func(da *DrifterAction) error {
+		return da.Update(keys, values, updateExpression, expressionAttributeNames, tableName, condition...)
+	}
+}
+
+// TransactDelete returns a TransactOp deleting the item with keys, see DrifterAction.Delete
+func TransactDelete(keys interface{}, tableName string, condition ...Condition) TransactOp {
+	return func(da *DrifterAction) error {
+		return da.Delete(keys, tableName, condition...)
+	}
+}
+
+// TransactConditionCheck returns a TransactOp checking condition on the item with keys without writing it, cancelling the transaction
+// if the condition fails (ex: writing an item only if a related item exists). Transactions require at least one write besides their
+// condition checks.
+func TransactConditionCheck(keys interface{}, tableName string, condition Condition) TransactOp {
+	return func(da *DrifterAction) error {
+		return da.conditionCheck(keys, tableName, condition)
+	}
+}
+
+// conditionCheck queues the condition check of a transaction, see TransactConditionCheck
+func (da *DrifterAction) conditionCheck(keys interface{}, tableName string, condition Condition) error {
+	if !da.txn {
+		return fmt.Errorf("condition checks must be part of a transaction (see Transact)")
+	}
+	if condition.Expression == "" {
+		return fmt.Errorf("condition check requires a condition expression")
+	}
+	mkeys, err := da.marshalKeys(keys)
+	if err != nil {
+		return err
+	}
+	cond, names, values, err := da.condition([]Condition{condition})
+	if err != nil {
+		return err
+	}
+	return da.push(action{
+		atype:        conditionCheckAction,
+		keys:         mkeys,
+		condExpr:     cond,
+		strict:       true,
+		expAttrNames: names,
+		values:       values,
+		tableName:    tableName,
+	})
+}
+
+// Transact queues the writes of ops as one TransactWriteItems transaction, so they are applied atomically (ex: moving an attribute from
+// an item to a related item). Writes are queued as by the other methods of DrifterAction (versioning, safe mode, models...), and none of
+// them is queued if one of ops fails. Transactions are limited to 100 writes on distinct items. Any condition which fails (including those of
+// updates built with UpdateBuilder.If, which are skipped outside of transactions) cancels the transaction, which fails with the
+// ActionError of its action. With ItemTransactions, the writes are part of the transaction of the item.
+func (da *DrifterAction) Transact(ops ...TransactOp) error {
+	if len(ops) == 0 {
+		return fmt.Errorf("at least one transaction operation is required")
+	}
+	tda := da.forTransaction()
+	for _, op := range ops {
+		if err := op(tda); err != nil {
+			return err
+		}
+	}
+	actions := tda.aq.actions()
+	if !hasWrites(actions) {
+		return fmt.Errorf("at least one transaction write is required besides condition checks")
+	}
+	if len(actions) > maxTransactionActions {
+		return fmt.Errorf("%v transaction operations, more than the %v of a transaction", len(actions), maxTransactionActions)
+	}
+	root := da
+	if da.parent != nil {
+		root = da.parent
+	}
+	txn := atomic.AddUint64(&root.txns, 1)
+	for _, a := range actions {
+		a.txn = txn
+		da.enqueue(a)
+	}
+	return nil
+}
+
+// hasWrites returns whether actions include writes, and not only condition checks
+func hasWrites(actions []action) bool {
+	for i := range actions {
+		if actions[i].atype != conditionCheckAction {
+			return true
+		}
+	}
+	return false
+}
+
+// actionGroup returns the group of a, see ItemTransactions
+func actionGroup(a *action) uint64 {
+	return a.group
+}
+
+// actionTransaction returns the transaction of a, see Transact
+func actionTransaction(a *action) uint64 {
+	return a.txn
+}
+
+// groupActions returns actions reordered so the actions of each unit (see actionGroup and actionTransaction) are contiguous, units being
+// ordered by their first action. Actions without a unit stay on their own.
+func groupActions(actions []action, unit func(a *action) uint64) []action {
+	units := [][]action{}
+	idx := map[uint64]int{} // position of each unit
+	for i := range actions {
+		a := &actions[i]
+		id := unit(a)
+		if j, ok := idx[id]; ok && id != 0 {
+			units[j] = append(units[j], *a)
+			continue
+		}
+		idx[id] = len(units)
+		units = append(units, []action{*a})
+	}
+	out := make([]action, 0, len(actions))
+	for _, u := range units {
+		out = append(out, u...)
+	}
+	return out
+}
+
+// unitEnd returns the end of the unit of grouped actions starting at i
+func unitEnd(actions []action, i int, unit func(a *action) uint64) int {
+	j := i + 1
+	for unit(&actions[i]) != 0 && j < len(actions) && unit(&actions[j]) == unit(&actions[i]) {
+		j++
+	}
+	return j
+}
+
+// doTransaction applies actions (the group of an item, or a transaction queued by Transact) as one TransactWriteItems transaction.
+// Unlike individual actions, conditional updates whose condition fails aren't skipped: any failed condition cancels the transaction,
+// which fails with the ActionError of the action, so none of its writes is applied.
+func (dd *DynamoDrifter) doTransaction(ctx context.Context, actions []action, tn string, da *DrifterAction) error {
+	started := time.Now()
+	err := dd.transact(ctx, actions, tn, da)
+	for i := range actions {
+		dd.logAction(&actions[i], tn, time.Since(started), err)
+	}
+	return err
+}
+
+func (dd *DynamoDrifter) transact(ctx context.Context, actions []action, tn string, da *DrifterAction) error {
+	if len(actions) > maxTransactionActions {
+		return fmt.Errorf("error applying item transaction: %v actions, more than the %v of a transaction", len(actions), maxTransactionActions)
+	}
+	items := make([]transactWriteItem, 0, len(actions))
+	queued := make([]*action, 0, len(actions))
+	tables := map[string]bool{}
+	for i := range actions {
+		a := &actions[i]
+		table, err := da.actionTable(a, tn)
+		if err != nil {
+			return err
+		}
+		tables[table] = true
+		w := &transactWrite{TableName: aws.String(table)}
+		if len(a.expAttrNames) != 0 {
+			w.ExpressionAttributeNames = a.expAttrNames
+		}
+		switch a.atype {
+		case updateAction:
+			w.Key, w.UpdateExpression = a.keys, aws.String(a.updExpr)
+			if len(a.values) != 0 {
+				w.ExpressionAttributeValues = a.values
+			}
+			if a.condExpr != "" {
+				w.ConditionExpression = aws.String(a.condExpr)
+			}
+			items = append(items, transactWriteItem{Update: w})
+		case insertAction:
+			w.Item = a.item
+			if w.ConditionExpression, w.ExpressionAttributeNames, w.ExpressionAttributeValues, err = dd.writeCondition(ctx, a, table, da); err != nil {
+				return err
+			}
+			items = append(items, transactWriteItem{Put: w})
+		case deleteAction:
+			w.Key = a.keys
+			if w.ConditionExpression, w.ExpressionAttributeNames, w.ExpressionAttributeValues, err = dd.writeCondition(ctx, a, table, da); err != nil {
+				return err
+			}
+			items = append(items, transactWriteItem{Delete: w})
+		case conditionCheckAction:
+			w.Key, w.ConditionExpression = a.keys, aws.String(a.condExpr)
+			if len(a.values) != 0 {
+				w.ExpressionAttributeValues = a.values
+			}
+			items = append(items, transactWriteItem{ConditionCheck: w})
+		default:
+			return fmt.Errorf("unknown action type: %v", a.atype)
+		}
+		queued = append(queued, a)
+	}
+	in := &transactWriteItemsInput{TransactItems: items, ReturnConsumedCapacity: da.pace.returnConsumedCapacity()}
+	err := da.retry.do(ctx, func() error {
+		for table := range tables {
+			if err := da.pace.wait(ctx, table, true); err != nil {
+				return err
+			}
+		}
+		out := &transactWriteItemsOutput{}
+		req, err := dd.newRequest("TransactWriteItems", in, out)
+		if err != nil {
+			return err
+		}
+		err = dd.send(ctx, req)
+		for _, cc := range out.ConsumedCapacity {
+			da.pace.consumed(cc, true)
+		}
+		return retryableCancellation(err)
+	})
+	if err == nil {
+		return nil
+	}
+	reasons := cancellationReasons(err)
+	if len(reasons) == len(items) {
+		for i, r := range reasons {
+			if r == "ConditionalCheckFailed" {
+				a := queued[i]
+				table, _ := da.actionTable(a, tn)
+				return fmt.Errorf("error applying item transaction: %w", dd.actionError(ctx, a, table, da, conditionError(a)))
+			}
+		}
+	}
+	return fmt.Errorf("error applying item transaction: %w", err)
+}
+
+// cancellationReasons returns the cancellation reason of each action of a cancelled transaction, parsed from the message of err since
+// the vendored SDK doesn't unmarshal them
+func cancellationReasons(err error) []string {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != "TransactionCanceledException" {
+		return nil
+	}
+	msg := aerr.Message()
+	i, j := strings.LastIndex(msg, "["), strings.LastIndex(msg, "]")
+	if i < 0 || j < i {
+		return nil
+	}
+	reasons := strings.Split(msg[i+1:j], ",")
+	for k := range reasons {
+		reasons[k] = strings.TrimSpace(reasons[k])
+	}
+	return reasons
+}
+
+// retryableCancellation returns err as a throttling or transient error if it cancelled a transaction only because of throttling or
+// conflicting transactions, so it is retried (see ClassifyError)
+func retryableCancellation(err error) error {
+	reasons := cancellationReasons(err)
+	if len(reasons) == 0 {
+		return err
+	}
+	code := ""
+	for _, r := range reasons {
+		switch r {
+		case "None", "":
+		case "ThrottlingError", "ProvisionedThroughputExceeded":
+			code = "ThrottlingException"
+		case "TransactionConflict":
+			if code == "" {
+				code = "TransactionConflictException"
+			}
+		default:
+			return err
+		}
+	}
+	if code == "" {
+		return err
+	}
+	var aerr awserr.Error
+	errors.As(err, &aerr)
+	return awserr.New(code, aerr.Message(), err)
+}
@@ -0,0 +1,161 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestGroupActions(t *testing.T) {
+	da := (&DynamoDrifter{}).newDrifterAction(&DynamoDrifterMigration{TableName: "foo"})
+	a, b := da.forItem(), da.forItem()
+	key := func(id string) RawDynamoItem { return RawDynamoItem{"ID": {S: aws.String(id)}} }
+	a.Insert(key("a1"), "")
+	b.Insert(key("b1"), "")
+	da.Delete(key("x"), "")
+	a.Insert(key("a2"), "")
+	b.Insert(key("b2"), "")
+	actions := groupActions(da.aq.actions(), actionGroup)
+	ids := []string{}
+	for _, a := range actions {
+		if a.atype == deleteAction {
+			ids = append(ids, *a.keys["ID"].S)
+			continue
+		}
+		ids = append(ids, *a.item["ID"].S)
+	}
+	if strings.Join(ids, ",") != "a1,a2,b1,b2,x" {
+		t.Fatalf("bad grouped actions: %v", ids)
+	}
+	if unitEnd(actions, 0, actionGroup) != 2 || unitEnd(actions, 2, actionGroup) != 4 || unitEnd(actions, 4, actionGroup) != 5 {
+		t.Fatalf("bad units")
+	}
+}
+
+func TestCancellationReasons(t *testing.T) {
+	err := awserr.New("TransactionCanceledException", "Transaction cancelled, please refer cancellation reasons for specific reasons [ConditionalCheckFailed, None]", nil)
+	if r := cancellationReasons(err); len(r) != 2 || r[0] != "ConditionalCheckFailed" || r[1] != "None" {
+		t.Fatalf("bad reasons: %v", r)
+	}
+	if cancellationReasons(errors.New("foo")) != nil {
+		t.Fatalf("other errors should have no reasons")
+	}
+	err = awserr.New("TransactionCanceledException", "Transaction cancelled [None, TransactionConflict]", nil)
+	if ClassifyError(retryableCancellation(err)) != ErrorClassTransient {
+		t.Fatalf("conflicts should be transient")
+	}
+	err = awserr.New("TransactionCanceledException", "Transaction cancelled [ThrottlingError, TransactionConflict]", nil)
+	if ClassifyError(retryableCancellation(err)) != ErrorClassThrottling {
+		t.Fatalf("throttled transactions should be throttling errors")
+	}
+	err = awserr.New("TransactionCanceledException", "Transaction cancelled [ConditionalCheckFailed, TransactionConflict]", nil)
+	if ClassifyError(retryableCancellation(err)) != ErrorClassPermanent {
+		t.Fatalf("failed conditions should be permanent")
+	}
+}
+
+func TestItemTransactions(t *testing.T) {
+	var mtx sync.Mutex
+	requests := map[string][]int{} // sizes of the transactions of each operation
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		b, _ := io.ReadAll(r.Body)
+		in := transactWriteItemsInput{}
+		json.Unmarshal(b, &in)
+		mtx.Lock()
+		requests[op] = append(requests[op], len(in.TransactItems))
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if op == "TransactWriteItems" && len(in.TransactItems) == 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#TransactionCanceledException","message":"Transaction cancelled, please refer cancellation reasons for specific reasons [None, ConditionalCheckFailed, None]"}`))
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL)}
+	m := &DynamoDrifterMigration{TableName: "foo", ItemTransactions: true, Callback: func(RawDynamoItem, *DrifterAction) error { return nil }}
+	da := dd.newDrifterAction(m)
+	key := RawDynamoItem{"ID": {S: aws.String("a")}}
+	a := da.forItem()
+	a.Update(key, map[string]*dynamodb.AttributeValue{":v": {S: aws.String("v")}}, "SET Foo = :v", nil, "")
+	a.UpdateItem(key, "bar").Set("Foo", "v").If("attribute_exists(ID)", nil).Queue()
+	a.Insert(key, "baz")
+	da.forItem().Delete(key, "")
+	errs := dd.executeActions(context.Background(), m, da, 2, false, nil)
+	var aerr *ActionError
+	if len(errs) != 1 || !errors.As(errs[0], &aerr) || aerr.Table != "bar" || !errors.Is(errs[0], ErrConditionFailed) {
+		t.Fatalf("the failed conditional update should fail the transaction: %v", errs)
+	}
+	if len(requests["TransactWriteItems"]) != 1 || len(requests["DeleteItem"]) != 1 {
+		t.Fatalf("the transaction should not be retried without the failed conditional update: %v", requests)
+	}
+	if err := validateCallbacks(&DynamoDrifterMigration{ItemTransactions: true, BatchCallback: func([]RawDynamoItem, *DrifterAction) error { return nil }}); err == nil {
+		t.Fatalf("ItemTransactions should require Callback")
+	}
+}
+
+func TestTransact(t *testing.T) {
+	var mtx sync.Mutex
+	requests := map[string][]int{} // sizes of the transactions of each operation
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		b, _ := io.ReadAll(r.Body)
+		in := transactWriteItemsInput{}
+		json.Unmarshal(b, &in)
+		mtx.Lock()
+		requests[op] = append(requests[op], len(in.TransactItems))
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), SafeMode: true}
+	m := &DynamoDrifterMigration{TableName: "foo", AllowsOverwrites: true, Callback: func(RawDynamoItem, *DrifterAction) error { return nil }}
+	da := dd.newDrifterAction(m)
+	key := func(id string) RawDynamoItem { return RawDynamoItem{"ID": {S: aws.String(id)}} }
+	if err := da.Transact(); err == nil {
+		t.Fatalf("transactions should require operations")
+	}
+	if err := da.Transact(TransactInsert(key("a"), "bar"), TransactDelete(key("b"), "")); !errors.Is(err, ErrUnsafeAction) {
+		t.Fatalf("unsafe operations should fail the transaction: %v", err)
+	}
+	check := TransactConditionCheck(key("a"), "", Condition{Expression: "attribute_exists(ID)"})
+	if err := da.Transact(check); err == nil {
+		t.Fatalf("transactions should require writes besides condition checks")
+	}
+	if err := check(da); err == nil {
+		t.Fatalf("condition checks should require a transaction")
+	}
+	if da.aq.len() != 0 {
+		t.Fatalf("operations of failed transactions should not be queued")
+	}
+	da.Insert(key("x"), "")
+	err := da.Transact(
+		TransactUpdate(key("a"), map[string]interface{}{":v": "w"}, "SET Bar = :v", nil, ""),
+		TransactUpdate(key("b"), map[string]interface{}{":v": "v"}, "SET Foo = :v", nil, "bar"),
+		func(da *DrifterAction) error { return da.UpdateItem(key("c"), "").Set("Foo", "v").Queue() },
+	)
+	if err != nil {
+		t.Fatalf("error queuing transaction: %v", err)
+	}
+	da.forItem().Transact(TransactInsert(key("d"), ""), TransactInsert(key("e"), "bar"))
+	if errs := dd.executeActions(context.Background(), m, da, 2, false, nil); len(errs) != 0 {
+		t.Fatalf("errors executing actions: %v", errs)
+	}
+	if fmt.Sprint(requests["TransactWriteItems"]) != "[2 3]" && fmt.Sprint(requests["TransactWriteItems"]) != "[3 2]" || len(requests["PutItem"]) != 1 {
+		t.Fatalf("bad requests: %v", requests)
+	}
+}
@@ -0,0 +1,103 @@
+package drift
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ActionType is the type of an Action
+type ActionType int
+
+// Action types
+const (
+	ActionUpdate ActionType = iota
+	ActionInsert
+	ActionDelete
+)
+
+// Action describes an action to be queued, see the DrifterAction method of the corresponding type for the meaning of each field.
+type Action struct {
+	Type                     ActionType
+	Keys                     interface{}       // Update, Delete
+	Values                   interface{}       // Update
+	UpdateExpression         string            // Update
+	ExpressionAttributeNames map[string]string // Update (optional)
+	Item                     interface{}       // Insert
+	TableName                string            // Optional (defaults to migration table)
+}
+
+// Queue queues action
+func (da *DrifterAction) Queue(action Action) error {
+	switch action.Type {
+	case ActionUpdate:
+		return da.Update(action.Keys, action.Values, action.UpdateExpression, action.ExpressionAttributeNames, action.TableName)
+	case ActionInsert:
+		return da.Insert(action.Item, action.TableName)
+	case ActionDelete:
+		return da.Delete(action.Keys, action.TableName)
+	default:
+		return fmt.Errorf("unknown action type: %v", action.Type)
+	}
+}
+
+// Transformer is a reusable step of a migration which transforms an item.
+// It returns the transformed item (which may be the item passed in, modified in place), or nil to stop processing the item, and any additional actions to queue.
+type Transformer interface {
+	Transform(item RawDynamoItem) (RawDynamoItem, []Action, error)
+}
+
+// TransformerFunc is a function implementing Transformer
+type TransformerFunc func(item RawDynamoItem) (RawDynamoItem, []Action, error)
+
+// Transform calls f
+func (f TransformerFunc) Transform(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+	return f(item)
+}
+
+type chain []Transformer
+
+func (c chain) Transform(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+	var actions []Action
+	for i, t := range c {
+		var a []Action
+		var err error
+		item, a, err = t.Transform(item)
+		if err != nil {
+			return nil, nil, fmt.Errorf("transformer %v: %w", i, err)
+		}
+		actions = append(actions, a...)
+		if item == nil {
+			break
+		}
+	}
+	return item, actions, nil
+}
+
+// Chain returns a Transformer that applies transformers in order, each to the item returned by the previous one.
+// The chain stops at the first error (no actions are returned) or when a transformer returns a nil item.
+func Chain(transformers ...Transformer) Transformer {
+	return chain(transformers)
+}
+
+// TransformerCallback returns a migration callback that runs t on a copy of each item and queues the actions it returns.
+// If the transformed item differs from the original it is written back to the migration table (replacing the original item;
+// transformers that modify key attributes should also return an ActionDelete for the original keys).
+func TransformerCallback(t Transformer) DynamoMigrationFunction {
+	return func(item RawDynamoItem, da *DrifterAction) error {
+		out, actions, err := t.Transform(item.Clone())
+		if err != nil {
+			return fmt.Errorf("error transforming item: %w", err)
+		}
+		for _, a := range actions {
+			if err := da.Queue(a); err != nil {
+				return fmt.Errorf("error queuing action: %v", err)
+			}
+		}
+		if out != nil && !reflect.DeepEqual(item, out) {
+			if err := da.Insert(out, ""); err != nil {
+				return fmt.Errorf("error queuing transformed item: %v", err)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package drift
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func setAttribute(name, value string) Transformer {
+	return TransformerFunc(func(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+		item[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+		return item, nil, nil
+	})
+}
+
+func TestChain(t *testing.T) {
+	var ran bool
+	c := Chain(
+		setAttribute("foo", "1"),
+		TransformerFunc(func(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+			return item, []Action{Action{Type: ActionDelete, Keys: RawDynamoItem{"Name": item["Name"]}, TableName: "other"}}, nil
+		}),
+		setAttribute("foo", "2"),
+		TransformerFunc(func(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+			return nil, nil, nil
+		}),
+		TransformerFunc(func(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+			ran = true
+			return item, nil, nil
+		}),
+	)
+	item := RawDynamoItem{"Name": &dynamodb.AttributeValue{S: aws.String("a")}}
+	out, actions, err := c.Transform(item)
+	if err != nil {
+		t.Fatalf("error transforming: %v", err)
+	}
+	if out != nil || ran {
+		t.Fatalf("chain should have stopped at nil item")
+	}
+	if len(actions) != 1 || *item["foo"].S != "2" {
+		t.Fatalf("bad result: %v, %v", actions, item)
+	}
+	c = Chain(setAttribute("foo", "1"), TransformerFunc(func(item RawDynamoItem) (RawDynamoItem, []Action, error) {
+		return nil, nil, fmt.Errorf("bad item")
+	}))
+	if _, _, err := c.Transform(item); err == nil {
+		t.Fatalf("should have returned error")
+	}
+}
+
+func TestTransformerCallback(t *testing.T) {
+	cb := TransformerCallback(Chain(setAttribute("foo", "bar")))
+	item := RawDynamoItem{"Name": &dynamodb.AttributeValue{S: aws.String("a")}}
+	da := &DrifterAction{}
+	if err := cb(item, da); err != nil {
+		t.Fatalf("error in callback: %v", err)
+	}
+	if _, ok := item["foo"]; ok {
+		t.Fatalf("original item should not be modified")
+	}
+	actions := da.aq.actions()
+	if len(actions) != 1 || actions[0].atype != insertAction || *actions[0].item["foo"].S != "bar" {
+		t.Fatalf("transformed item should have been queued: %v", actions)
+	}
+	// unchanged items are not written back
+	item["foo"] = &dynamodb.AttributeValue{S: aws.String("bar")}
+	if err := cb(item, da); err != nil {
+		t.Fatalf("error in callback: %v", err)
+	}
+	if da.aq.len() != 1 {
+		t.Fatalf("unchanged item should not have been queued")
+	}
+}
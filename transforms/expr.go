@@ -0,0 +1,834 @@
+package transforms
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// Expression is a compiled item expression, in drift's own expression language. Its syntax looks like CEL's, but it isn't CEL and CEL
+// expressions may not compile or evaluate alike (ex: number, lower and upper aren't CEL functions, missing attributes aren't errors):
+//
+//	literals:  "str", 'str', 12, 1.5, 1e3, 2.5E-4, true, false, null
+//	item:      item.attr, item["attr"], item.map.attr, item.list[0]
+//	operators: ?: || && == != < <= > >= + - * / % ! (unary -)
+//	functions: has(item.attr), size(x), string(x), number(x), lower(s), upper(s), startsWith(s, prefix), contains(s, sub)
+//
+// Attributes evaluate to string (S), number (N, as an exact *big.Rat), bool (BOOL), null (NULL or missing), map (M) or list (L).
+// Missing attributes and list indexes out of range evaluate to null, use has() to distinguish them. + concatenates strings. Arithmetic is
+// exact, number results are rounded to the 38 significant digits of DynamoDB numbers (ex: 1 / 3) and fail if they are out of its range.
+type Expression struct {
+	src  string
+	root node
+}
+
+// Compile parses an expression
+func Compile(src string) (*Expression, error) {
+	p := &parser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, fmt.Errorf("error parsing expression %q: %v", src, err)
+	}
+	n, err := p.ternary()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing expression %q: %v", src, err)
+	}
+	return &Expression{src: src, root: n}, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against item
+func (e *Expression) Eval(item drift.RawDynamoItem) (interface{}, error) {
+	v, err := e.root.eval(item)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating %q: %v", e.src, err)
+	}
+	return v, nil
+}
+
+// EvalBool evaluates the expression against item, which must result in a bool
+func (e *Expression) EvalBool(item drift.RawDynamoItem) (bool, error) {
+	v, err := e.Eval(item)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q: expected bool result, got %v", e.src, typeName(v))
+	}
+	return b, nil
+}
+
+// Set sets attr to the result of e, or removes it if the result is null
+func Set(attr string, e *Expression) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		v, err := e.Eval(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		if v == nil {
+			delete(item, attr)
+			return item, nil, nil
+		}
+		av, err := toAttributeValue(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("expression %q: %v", e.src, err)
+		}
+		item[attr] = av
+		return item, nil, nil
+	})
+}
+
+// When applies t only to items for which cond is true, other items are passed through unchanged
+func When(cond *Expression, t drift.Transformer) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		ok, err := cond.EvalBool(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			return item, nil, nil
+		}
+		return t.Transform(item)
+	})
+}
+
+// values
+
+type list []*dynamodb.AttributeValue
+
+func fromAttributeValue(av *dynamodb.AttributeValue) (interface{}, error) {
+	if av == nil {
+		return nil, nil
+	}
+	switch attributeType(av) {
+	case TypeString:
+		return *av.S, nil
+	case TypeNumber:
+		r, ok := parseNumber(*av.N)
+		if !ok {
+			return nil, fmt.Errorf("bad number: %q", *av.N)
+		}
+		return r, nil
+	case TypeBool:
+		return *av.BOOL, nil
+	case TypeNull:
+		return nil, nil
+	case TypeMap:
+		return drift.RawDynamoItem(av.M), nil
+	case TypeList:
+		return list(av.L), nil
+	default:
+		return nil, fmt.Errorf("unsupported attribute type: %v", attributeType(av))
+	}
+}
+
+func toAttributeValue(v interface{}) (*dynamodb.AttributeValue, error) {
+	switch x := v.(type) {
+	case string:
+		return &dynamodb.AttributeValue{S: aws.String(x)}, nil
+	case *big.Rat:
+		n, err := formatNumber(x)
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{N: aws.String(n)}, nil
+	case bool:
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(x)}, nil
+	case drift.RawDynamoItem:
+		return &dynamodb.AttributeValue{M: x.Clone()}, nil
+	case list:
+		return drift.CloneAttributeValue(&dynamodb.AttributeValue{L: x}), nil
+	default:
+		return nil, fmt.Errorf("unsupported result type: %v", typeName(v))
+	}
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case *big.Rat:
+		return "number"
+	case bool:
+		return "bool"
+	case drift.RawDynamoItem:
+		return "map"
+	case list:
+		return "list"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// numbers
+
+// maxDigits is the precision of DynamoDB numbers, in significant digits
+const maxDigits = 38
+
+// parseNumber parses the decimal number s exactly (ex: "12", "-0.5", "1.5E3")
+func parseNumber(s string) (*big.Rat, bool) {
+	if strings.ContainsRune(s, '/') {
+		return nil, false // fractions are accepted by SetString, not by DynamoDB
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// formatNumber returns r as a DynamoDB number rounded to maxDigits significant digits, or an error if it is out of the range of DynamoDB
+func formatNumber(r *big.Rat) (string, error) {
+	if r.Sign() == 0 {
+		return "0", nil
+	}
+	// exponent of the most significant digit: 10^e <= |r| < 10^(e+1)
+	abs := new(big.Rat).Abs(r)
+	e := len(abs.Num().String()) - len(abs.Denom().String())
+	if abs.Cmp(pow10(e)) < 0 {
+		e--
+	}
+	if e < -130 || e > 125 {
+		return "", fmt.Errorf("number result %v is out of range", r.RatString())
+	}
+	decimals := maxDigits - 1 - e
+	if decimals <= 0 {
+		// round the integer part to maxDigits digits
+		return new(big.Rat).Mul(r, pow10(decimals)).FloatString(0) + strings.Repeat("0", -decimals), nil
+	}
+	n := r.FloatString(decimals)
+	return strings.TrimRight(strings.TrimRight(n, "0"), "."), nil
+}
+
+// pow10 returns 10^e
+func pow10(e int) *big.Rat {
+	n := e
+	if n < 0 {
+		n = -n
+	}
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	if e < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+	return new(big.Rat).SetInt(p)
+}
+
+// AST
+
+type node interface {
+	eval(item drift.RawDynamoItem) (interface{}, error)
+}
+
+type literal struct{ v interface{} }
+
+func (l literal) eval(drift.RawDynamoItem) (interface{}, error) { return l.v, nil }
+
+type itemRef struct{}
+
+func (itemRef) eval(item drift.RawDynamoItem) (interface{}, error) { return item, nil }
+
+type index struct {
+	obj node
+	key node
+}
+
+// lookup returns the value of the member and whether it exists
+func (ix index) lookup(item drift.RawDynamoItem) (interface{}, bool, error) {
+	o, err := ix.obj.eval(item)
+	if err != nil {
+		return nil, false, err
+	}
+	k, err := ix.key.eval(item)
+	if err != nil {
+		return nil, false, err
+	}
+	switch obj := o.(type) {
+	case drift.RawDynamoItem:
+		ks, ok := k.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("map key must be a string, got %v", typeName(k))
+		}
+		av, ok := obj[ks]
+		if !ok {
+			return nil, false, nil
+		}
+		v, err := fromAttributeValue(av)
+		return v, true, err
+	case list:
+		r, ok := k.(*big.Rat)
+		if !ok || !r.IsInt() {
+			return nil, false, fmt.Errorf("list index must be an integer, got %v", k)
+		}
+		if r.Sign() < 0 || r.Num().Cmp(big.NewInt(int64(len(obj)))) >= 0 {
+			return nil, false, nil
+		}
+		v, err := fromAttributeValue(obj[r.Num().Int64()])
+		return v, true, err
+	case nil:
+		return nil, false, nil
+	default:
+		return nil, false, fmt.Errorf("cannot index %v", typeName(o))
+	}
+}
+
+func (ix index) eval(item drift.RawDynamoItem) (interface{}, error) {
+	v, _, err := ix.lookup(item)
+	return v, err
+}
+
+type unary struct {
+	op string
+	x  node
+}
+
+func (u unary) eval(item drift.RawDynamoItem) (interface{}, error) {
+	v, err := u.x.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	switch u.op {
+	case "!":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! requires bool, got %v", typeName(v))
+		}
+		return !b, nil
+	default: // -
+		r, ok := v.(*big.Rat)
+		if !ok {
+			return nil, fmt.Errorf("- requires number, got %v", typeName(v))
+		}
+		return new(big.Rat).Neg(r), nil
+	}
+}
+
+type logical struct {
+	op   string
+	x, y node
+}
+
+func (l logical) eval(item drift.RawDynamoItem) (interface{}, error) {
+	for i, n := range []node{l.x, l.y} {
+		v, err := n.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v requires bool operands, got %v", l.op, typeName(v))
+		}
+		if i == 0 && b == (l.op == "||") { // short circuit
+			return b, nil
+		}
+		if i == 1 {
+			return b, nil
+		}
+	}
+	return nil, nil // unreachable
+}
+
+type conditional struct {
+	cond, x, y node
+}
+
+func (c conditional) eval(item drift.RawDynamoItem) (interface{}, error) {
+	v, err := c.cond.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("?: requires bool condition, got %v", typeName(v))
+	}
+	if b {
+		return c.x.eval(item)
+	}
+	return c.y.eval(item)
+}
+
+type binary struct {
+	op   string
+	x, y node
+}
+
+func (b binary) eval(item drift.RawDynamoItem) (interface{}, error) {
+	x, err := b.x.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	y, err := b.y.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	switch b.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	}
+	if xs, ok := x.(string); ok {
+		ys, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v: mismatched types string and %v", b.op, typeName(y))
+		}
+		switch b.op {
+		case "+":
+			return xs + ys, nil
+		case "<":
+			return xs < ys, nil
+		case "<=":
+			return xs <= ys, nil
+		case ">":
+			return xs > ys, nil
+		case ">=":
+			return xs >= ys, nil
+		}
+		return nil, fmt.Errorf("%v not supported for strings", b.op)
+	}
+	xr, xok := x.(*big.Rat)
+	yr, yok := y.(*big.Rat)
+	if !xok || !yok {
+		return nil, fmt.Errorf("%v: unsupported types %v and %v", b.op, typeName(x), typeName(y))
+	}
+	switch b.op {
+	case "+":
+		return new(big.Rat).Add(xr, yr), nil
+	case "-":
+		return new(big.Rat).Sub(xr, yr), nil
+	case "*":
+		return new(big.Rat).Mul(xr, yr), nil
+	case "/":
+		if yr.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return new(big.Rat).Quo(xr, yr), nil
+	case "%":
+		if yr.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		// x - y * trunc(x / y), the sign of the result is that of x
+		q := new(big.Rat).Quo(xr, yr)
+		t := new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom()))
+		return new(big.Rat).Sub(xr, t.Mul(t, yr)), nil
+	case "<":
+		return xr.Cmp(yr) < 0, nil
+	case "<=":
+		return xr.Cmp(yr) <= 0, nil
+	case ">":
+		return xr.Cmp(yr) > 0, nil
+	default: // >=
+		return xr.Cmp(yr) >= 0, nil
+	}
+}
+
+func equal(x, y interface{}) bool {
+	switch xv := x.(type) {
+	case nil, string, bool:
+		return x == y
+	case *big.Rat:
+		yv, ok := y.(*big.Rat)
+		return ok && xv.Cmp(yv) == 0
+	case drift.RawDynamoItem:
+		yv, ok := y.(drift.RawDynamoItem)
+		return ok && fmt.Sprint(xv) == fmt.Sprint(yv)
+	case list:
+		yv, ok := y.(list)
+		return ok && fmt.Sprint(xv) == fmt.Sprint(yv)
+	default:
+		return false
+	}
+}
+
+type call struct {
+	fn   string
+	args []node
+}
+
+var functions = map[string]int{ // name: number of arguments
+	"has":        1,
+	"size":       1,
+	"string":     1,
+	"number":     1,
+	"lower":      1,
+	"upper":      1,
+	"startsWith": 2,
+	"contains":   2,
+}
+
+func (c call) eval(item drift.RawDynamoItem) (interface{}, error) {
+	if c.fn == "has" {
+		_, ok, err := c.args[0].(index).lookup(item)
+		return ok, err
+	}
+	args := make([]interface{}, len(c.args))
+	for i, a := range c.args {
+		v, err := a.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	strs := func() ([]string, error) {
+		out := make([]string, len(args))
+		for i, a := range args {
+			s, ok := a.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v requires string arguments, got %v", c.fn, typeName(a))
+			}
+			out[i] = s
+		}
+		return out, nil
+	}
+	switch c.fn {
+	case "size":
+		switch v := args[0].(type) {
+		case string:
+			return big.NewRat(int64(utf8.RuneCountInString(v)), 1), nil
+		case drift.RawDynamoItem:
+			return big.NewRat(int64(len(v)), 1), nil
+		case list:
+			return big.NewRat(int64(len(v)), 1), nil
+		default:
+			return nil, fmt.Errorf("size not supported for %v", typeName(v))
+		}
+	case "string":
+		switch v := args[0].(type) {
+		case string:
+			return v, nil
+		case *big.Rat:
+			return formatNumber(v)
+		case bool:
+			return strconv.FormatBool(v), nil
+		default:
+			return nil, fmt.Errorf("string not supported for %v", typeName(v))
+		}
+	case "number":
+		switch v := args[0].(type) {
+		case *big.Rat:
+			return v, nil
+		case string:
+			r, ok := parseNumber(strings.TrimSpace(v))
+			if !ok {
+				return nil, fmt.Errorf("not a number: %q", v)
+			}
+			return r, nil
+		default:
+			return nil, fmt.Errorf("number not supported for %v", typeName(v))
+		}
+	}
+	s, err := strs()
+	if err != nil {
+		return nil, err
+	}
+	switch c.fn {
+	case "lower":
+		return strings.ToLower(s[0]), nil
+	case "upper":
+		return strings.ToUpper(s[0]), nil
+	case "startsWith":
+		return strings.HasPrefix(s[0], s[1]), nil
+	default: // contains
+		return strings.Contains(s[0], s[1]), nil
+	}
+}
+
+// parser
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "!", "?", ":", "(", ")", "[", "]", ".", ","}
+
+func (p *parser) tokenize() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokIdent, s[i:j], i})
+			i = j
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < len(s) && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < len(s) && unicode.IsDigit(rune(s[k])) {
+					for j = k; j < len(s) && unicode.IsDigit(rune(s[j])); j++ {
+					}
+				}
+			}
+			p.tokens = append(p.tokens, token{tokNumber, s[i:j], i})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != s[i] {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return fmt.Errorf("unterminated string at %v", i)
+			}
+			raw := s[i+1 : j]
+			if c == '\'' {
+				raw = strings.Replace(strings.Replace(raw, `\'`, `'`, -1), `"`, `\"`, -1)
+			}
+			v, err := strconv.Unquote(`"` + raw + `"`)
+			if err != nil {
+				return fmt.Errorf("bad string at %v: %v", i, err)
+			}
+			p.tokens = append(p.tokens, token{tokString, v, i})
+			i = j + 1
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, token{tokOp, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("unexpected character %q at %v", c, i)
+			}
+		}
+	}
+	p.tokens = append(p.tokens, token{tokEOF, "end of expression", len(s)})
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return fmt.Errorf("expected %q at %v, got %q", op, p.peek().pos, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) ternary() (node, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	x, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	y, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	return conditional{cond, x, y}, nil
+}
+
+// binary operator precedence levels, lowest first
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	x, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		matched := false
+		for _, op := range precedence[level] {
+			if t.kind == tokOp && t.text == op {
+				matched = true
+			}
+		}
+		if !matched {
+			return x, nil
+		}
+		p.next()
+		y, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "&&" || t.text == "||" {
+			x = logical{t.text, x, y}
+		} else {
+			x = binary{t.text, x, y}
+		}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	for _, op := range []string{"!", "-"} {
+		if p.accept(op) {
+			x, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return unary{op, x}, nil
+		}
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("expected attribute name at %v, got %q", t.pos, t.text)
+			}
+			x = index{x, literal{t.text}}
+		case p.accept("["):
+			k, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = index{x, k}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		r, ok := parseNumber(t.text)
+		if !ok {
+			return nil, fmt.Errorf("bad number %q at %v", t.text, t.pos)
+		}
+		return literal{r}, nil
+	case tokString:
+		return literal{t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		case "item":
+			return itemRef{}, nil
+		}
+		n, ok := functions[t.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown identifier %q at %v", t.text, t.pos)
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		args := []node{}
+		for !p.accept(")") {
+			if len(args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			a, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+		}
+		if len(args) != n {
+			return nil, fmt.Errorf("%v takes %v argument(s), got %v", t.text, n, len(args))
+		}
+		if _, ok := args[0].(index); t.text == "has" && !ok {
+			return nil, fmt.Errorf("has requires an attribute argument, ex: has(item.foo)")
+		}
+		return call{t.text, args}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %v", t.text, t.pos)
+}
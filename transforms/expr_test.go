@@ -0,0 +1,168 @@
+package transforms
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+func exprItem() drift.RawDynamoItem {
+	return drift.RawDynamoItem{
+		"status": s(""),
+		"name":   s("Jane Doe"),
+		"count":  n("3"),
+		"active": b(true),
+		"address": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+			"city": s("Los Angeles"),
+		}},
+		"tags": &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{s("a"), s("b")}},
+	}
+}
+
+func num(s string) *big.Rat {
+	r, _ := parseNumber(s)
+	return r
+}
+
+func TestExpressionEval(t *testing.T) {
+	cases := []struct {
+		expr string
+		want interface{}
+	}{
+		{`item.status == "" ? "active" : item.status`, "active"},
+		{`item.count * 2 + 1`, num("7")},
+		{`-item.count`, num("-3")},
+		{`item.count % 2 == 1 && item.active`, true},
+		{`!item.active || item.missing == null`, true},
+		{`has(item.missing)`, false},
+		{`has(item.address.city)`, true},
+		{`item.address.city`, "Los Angeles"},
+		{`item["address"]["city"]`, "Los Angeles"},
+		{`item.tags[1]`, "b"},
+		{`item.tags[5]`, nil},
+		{`size(item.tags) + size(item.name)`, num("10")},
+		{`upper(item.name) + '!'`, "JANE DOE!"},
+		{`string(item.count) + "x"`, "3x"},
+		{`number("4.5") > item.count`, true},
+		{`startsWith(item.name, "Jane") && contains(lower(item.name), "doe")`, true},
+		{`(1 + 2) * 3`, num("9")},
+		{`"b" > "a" ? 1 : 2`, num("1")},
+	}
+	for _, c := range cases {
+		e, err := Compile(c.expr)
+		if err != nil {
+			t.Fatalf("error compiling %v: %v", c.expr, err)
+		}
+		v, err := e.Eval(exprItem())
+		if err != nil {
+			t.Fatalf("error evaluating %v: %v", c.expr, err)
+		}
+		if !equal(v, c.want) {
+			t.Fatalf("%v: got %v (%T), want %v", c.expr, v, v, c.want)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, src := range []string{`item.`, `1 +`, `foo`, `has(1)`, `size(1, 2)`, `"abc`, `item.count ? 1 : 2 :`, `1 # 2`, `1e`, `1e+`} {
+		if _, err := Compile(src); err == nil {
+			t.Fatalf("compiling %v should have failed", src)
+		}
+	}
+	for _, src := range []string{`item.name - 1`, `item.count / 0`, `!item.name`, `item.name < 1`, `item.name ? 1 : 2`} {
+		e, err := Compile(src)
+		if err != nil {
+			t.Fatalf("error compiling %v: %v", src, err)
+		}
+		if _, err := e.Eval(exprItem()); err == nil {
+			t.Fatalf("evaluating %v should have failed", src)
+		}
+	}
+}
+
+func TestSetAndWhen(t *testing.T) {
+	e, _ := Compile(`item.status == "" ? "active" : item.status`)
+	cond, _ := Compile(`item.count > 2`)
+	out, _ := transform(t, When(cond, Set("status", e)), exprItem())
+	if *out["status"].S != "active" {
+		t.Fatalf("status should have been set: %v", out["status"])
+	}
+	cond, _ = Compile(`item.count > 5`)
+	out, _ = transform(t, When(cond, Set("status", e)), exprItem())
+	if *out["status"].S != "" {
+		t.Fatalf("step should not have applied: %v", out["status"])
+	}
+	e, _ = Compile(`null`)
+	out, _ = transform(t, Set("status", e), exprItem())
+	if _, ok := out["status"]; ok {
+		t.Fatalf("null result should remove the attribute")
+	}
+	e, _ = Compile(`item.count + 0.5`)
+	out, _ = transform(t, Set("count", e), exprItem())
+	if *out["count"].N != "3.5" {
+		t.Fatalf("bad number result: %v", *out["count"].N)
+	}
+}
+
+func TestExactNumbers(t *testing.T) {
+	item := drift.RawDynamoItem{"id": n("12345678901234567891"), "tiny": n("1E-130"), "big": n("9.9999999999999999999999999999999999999E+125")}
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{`item.id`, "12345678901234567891"},
+		{`item.id + 1`, "12345678901234567892"},
+		{`0.1 + 0.2`, "0.3"},
+		{`1 / 3`, "0.33333333333333333333333333333333333333"},
+		{`-2 / 3`, "-0.66666666666666666666666666666666666667"},
+		{`item.id * item.id`, "152415787532388367526596557677488187880"},
+		{`7.5 % 2`, "1.5"},
+		{`-7 % 2`, "-1"},
+		{`item.tiny`, "0." + strings.Repeat("0", 129) + "1"},
+		{`item.big`, "99999999999999999999999999999999999999" + strings.Repeat("0", 88)},
+		{`number("1.50e2")`, "150"},
+		{`1e3 + 1.5E-2`, "1000.015"},
+		{`2.5e+2`, "250"},
+		{`1e400 / 1e300`, "10000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"},
+	}
+	for _, c := range cases {
+		e, err := Compile(c.expr)
+		if err != nil {
+			t.Fatalf("error compiling %v: %v", c.expr, err)
+		}
+		out, _ := transform(t, Set("out", e), item)
+		if got := *out["out"].N; got != c.want {
+			t.Fatalf("%v: got %v, want %v", c.expr, got, c.want)
+		}
+	}
+	for _, src := range []string{`item.tiny / 10`, `item.big * 10`, `1e400`} {
+		e, _ := Compile(src)
+		if _, _, err := Set("out", e).Transform(item.Clone()); err == nil {
+			t.Fatalf("%v should be out of range", src)
+		}
+	}
+}
+
+func TestSpecExpressionStep(t *testing.T) {
+	spec, err := LoadSpec(strings.NewReader(`{"tablename": "Users", "steps": [
+		{"op": "set", "attribute": "status", "expression": "item.status == \"\" ? \"active\" : item.status", "when": "has(item.status)"}
+	]}`))
+	if err != nil {
+		t.Fatalf("error loading spec: %v", err)
+	}
+	tr, err := spec.Transformer()
+	if err != nil {
+		t.Fatalf("error creating transformer: %v", err)
+	}
+	out, _ := transform(t, tr, exprItem())
+	if *out["status"].S != "active" {
+		t.Fatalf("bad status: %v", out["status"])
+	}
+	out, _ = transform(t, tr, drift.RawDynamoItem{})
+	if _, ok := out["status"]; ok {
+		t.Fatalf("when condition should have skipped the step")
+	}
+}
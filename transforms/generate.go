@@ -0,0 +1,288 @@
+package transforms
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DefaultTag is the struct tag containing the default value of an added field, ex: `driftdefault:"true"`
+const DefaultTag = "driftdefault"
+
+// StructField is a DynamoDB attribute of a model struct
+type StructField struct {
+	Field       string // Go field name
+	Attribute   string // Attribute name
+	Type        reflect.Type
+	Default     string // Value of the driftdefault tag
+	HasDefault  bool   // Whether the field has a driftdefault tag
+	RenamedFrom string // Value of the driftrename tag
+}
+
+// StructDiff is the difference between two versions of a model struct, as DynamoDB attributes
+type StructDiff struct {
+	Renamed [][2]string   // [old, new] attribute names of fields with the same Go name
+	Retyped []StructField // Fields whose attribute type changed (new version)
+	Added   []StructField
+	Removed []StructField
+	Todo    []string // Changes that could not be inferred
+}
+
+// structFields returns the attributes of struct type t, and TODOs for fields that are not compared
+func structFields(t reflect.Type) ([]StructField, []string, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("%v is not a struct", t)
+	}
+	fields := []StructField{}
+	todo := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			todo = append(todo, fmt.Sprintf("embedded field %v of %v is not compared", f.Name, t))
+			continue
+		}
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		tag := f.Tag.Get("dynamodbav")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		d, ok := f.Tag.Lookup(DefaultTag)
+		fields = append(fields, StructField{Field: f.Name, Attribute: name, Type: f.Type, Default: d, HasDefault: ok, RenamedFrom: f.Tag.Get(RenameTag)})
+	}
+	return fields, todo, nil
+}
+
+// attributeKind returns the DynamoDB type a Go type is marshaled as (for the types relevant to Retype/Default), or "" if unknown
+func attributeKind(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return TypeString
+	case reflect.Bool:
+		return TypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return TypeNumber
+	default:
+		return typeUnknown
+	}
+}
+
+// Diff compares two versions of a model struct (or pointers to them).
+// Fields are matched by Go field name, or by driftrename tag for renamed Go fields: a changed dynamodbav name is a rename and a changed type
+// between string, number and bool kinds is a retype.
+func Diff(oldModel, newModel interface{}) (*StructDiff, error) {
+	of, otodo, err := structFields(reflect.TypeOf(oldModel))
+	if err != nil {
+		return nil, err
+	}
+	nf, ntodo, err := structFields(reflect.TypeOf(newModel))
+	if err != nil {
+		return nil, err
+	}
+	d := &StructDiff{Todo: append(otodo, ntodo...)}
+	byField := map[string]StructField{}
+	byAttr := map[string]StructField{}
+	oldAttrs := map[string]bool{}
+	for _, f := range of {
+		byField[f.Field] = f
+		byAttr[f.Attribute] = f
+		oldAttrs[f.Attribute] = true
+	}
+	newAttrs := map[string]bool{}
+	matched := map[string]bool{}
+	for _, f := range nf {
+		newAttrs[f.Attribute] = true
+	}
+	for _, f := range nf {
+		o, ok := byField[f.Field]
+		if !ok && f.RenamedFrom != "" && !newAttrs[f.RenamedFrom] {
+			o, ok = byAttr[f.RenamedFrom]
+		}
+		if !ok {
+			continue
+		}
+		matched[o.Attribute] = true
+		if o.Attribute != f.Attribute {
+			d.Renamed = append(d.Renamed, [2]string{o.Attribute, f.Attribute})
+		}
+		if o.Type != f.Type {
+			okind, nkind := attributeKind(o.Type), attributeKind(f.Type)
+			switch {
+			case okind == nkind && okind != typeUnknown:
+			case okind != typeUnknown && nkind != typeUnknown:
+				d.Retyped = append(d.Retyped, f)
+			default:
+				d.Todo = append(d.Todo, fmt.Sprintf("attribute %v changed type from %v to %v", f.Attribute, o.Type, f.Type))
+			}
+		}
+	}
+	renamedTo := map[string]bool{}
+	for _, r := range d.Renamed {
+		renamedTo[r[1]] = true
+	}
+	for _, f := range nf {
+		if !oldAttrs[f.Attribute] && !renamedTo[f.Attribute] {
+			d.Added = append(d.Added, f)
+		}
+	}
+	for _, f := range of {
+		if !newAttrs[f.Attribute] && !matched[f.Attribute] {
+			d.Removed = append(d.Removed, f)
+		}
+	}
+	return d, nil
+}
+
+// defaultValue parses the driftdefault tag of f
+func defaultValue(f StructField) (*dynamodb.AttributeValue, error) {
+	switch attributeKind(f.Type) {
+	case TypeString:
+		return &dynamodb.AttributeValue{S: aws.String(f.Default)}, nil
+	case TypeNumber:
+		if _, err := strconv.ParseFloat(f.Default, 64); err != nil {
+			return nil, fmt.Errorf("bad number default for %v: %q", f.Field, f.Default)
+		}
+		return &dynamodb.AttributeValue{N: aws.String(f.Default)}, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(f.Default)
+		if err != nil {
+			return nil, fmt.Errorf("bad bool default for %v: %q", f.Field, f.Default)
+		}
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(b)}, nil
+	default:
+		return nil, fmt.Errorf("defaults are not supported for %v (%v)", f.Field, f.Type)
+	}
+}
+
+// Steps returns the declarative steps implementing the diff, and TODOs for the changes they don't cover
+func (d *StructDiff) Steps() ([]Step, []string) {
+	steps := []Step{}
+	todo := append([]string{}, d.Todo...)
+	for _, r := range d.Renamed {
+		steps = append(steps, Step{Op: OpRename, Attribute: r[0], To: r[1]})
+	}
+	for _, f := range d.Retyped {
+		steps = append(steps, Step{Op: OpRetype, Attribute: f.Attribute, Type: attributeKind(f.Type)})
+	}
+	for _, f := range d.Added {
+		if !f.HasDefault {
+			todo = append(todo, fmt.Sprintf("choose a default for added attribute %v (%v), or tag the field %v:\"...\"", f.Attribute, f.Type, DefaultTag))
+			continue
+		}
+		v, err := defaultValue(f)
+		if err != nil {
+			todo = append(todo, err.Error())
+			continue
+		}
+		steps = append(steps, Step{Op: OpDefault, Attribute: f.Attribute, Value: v})
+	}
+	if len(d.Removed) > 0 {
+		attrs := []string{}
+		for _, f := range d.Removed {
+			attrs = append(attrs, f.Attribute)
+		}
+		steps = append(steps, Step{Op: OpDelete, Attributes: attrs})
+	}
+	return steps, todo
+}
+
+// GenerateOptions configures GenerateMigration
+type GenerateOptions struct {
+	Package     string // Package of the generated file (defaults to "migrations")
+	Func        string // Name of the generated function (defaults to "Migration<Number>")
+	Number      uint
+	TableName   string
+	Description string
+}
+
+func goValue(v *dynamodb.AttributeValue) string {
+	switch {
+	case v.S != nil:
+		return fmt.Sprintf("&dynamodb.AttributeValue{S: aws.String(%q)}", *v.S)
+	case v.N != nil:
+		return fmt.Sprintf("&dynamodb.AttributeValue{N: aws.String(%q)}", *v.N)
+	default:
+		return fmt.Sprintf("&dynamodb.AttributeValue{BOOL: aws.Bool(%v)}", *v.BOOL)
+	}
+}
+
+func goStrings(ss []string) string {
+	q := make([]string, len(ss))
+	for i, s := range ss {
+		q[i] = strconv.Quote(s)
+	}
+	return strings.Join(q, ", ")
+}
+
+// GenerateMigration returns the Go source of a skeleton migration from the old to the new version of a model struct, implementing the changes
+// Diff can infer using transforms and leaving TODO comments for the rest. The output is meant to be reviewed and edited.
+func GenerateMigration(oldModel, newModel interface{}, opts GenerateOptions) ([]byte, error) {
+	d, err := Diff(oldModel, newModel)
+	if err != nil {
+		return nil, err
+	}
+	steps, todo := d.Steps()
+	if opts.Package == "" {
+		opts.Package = "migrations"
+	}
+	if opts.Func == "" {
+		opts.Func = fmt.Sprintf("Migration%v", opts.Number)
+	}
+	if opts.Description == "" {
+		opts.Description = fmt.Sprintf("migrate %v to %v", reflect.TypeOf(oldModel), reflect.TypeOf(newModel))
+	}
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "package %v\n\nimport (\n", opts.Package)
+	usesValues := false
+	for _, s := range steps {
+		usesValues = usesValues || s.Value != nil
+	}
+	if usesValues {
+		fmt.Fprintf(b, "\"github.com/aws/aws-sdk-go/aws\"\n\"github.com/aws/aws-sdk-go/service/dynamodb\"\n")
+	}
+	fmt.Fprintf(b, "drift \"github.com/dollarshaveclub/dynamo-drift\"\n\"github.com/dollarshaveclub/dynamo-drift/transforms\"\n)\n\n")
+	fmt.Fprintf(b, "// %v returns migration %v: %v\n", opts.Func, opts.Number, opts.Description)
+	fmt.Fprintf(b, "func %v() *drift.DynamoDrifterMigration {\n", opts.Func)
+	fmt.Fprintf(b, "return &drift.DynamoDrifterMigration{\nNumber: %v,\nTableName: %q,\nDescription: %q,\n", opts.Number, opts.TableName, opts.Description)
+	fmt.Fprintf(b, "Callback: drift.TransformerCallback(drift.Chain(\n")
+	for _, t := range todo {
+		fmt.Fprintf(b, "// TODO: %v\n", t)
+	}
+	for _, s := range steps {
+		switch s.Op {
+		case OpRename:
+			fmt.Fprintf(b, "transforms.Rename(%q, %q),\n", s.Attribute, s.To)
+		case OpRetype:
+			fmt.Fprintf(b, "transforms.Retype(%q, %q),\n", s.Attribute, s.Type)
+		case OpDefault:
+			fmt.Fprintf(b, "transforms.Default(%q, %v),\n", s.Attribute, goValue(s.Value))
+		case OpDelete:
+			fmt.Fprintf(b, "transforms.Delete(%v),\n", goStrings(s.Attributes))
+		}
+	}
+	fmt.Fprintf(b, ")),\n}\n}\n")
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error formatting generated source: %v", err)
+	}
+	return src, nil
+}
@@ -0,0 +1,73 @@
+package transforms
+
+import (
+	goparser "go/parser"
+	gotoken "go/token"
+	"strings"
+	"testing"
+)
+
+type userV1 struct {
+	ID       string `dynamodbav:"id"`
+	Name     string `dynamodbav:"name"`
+	Age      string `dynamodbav:"age"`
+	Legacy   string `dynamodbav:"legacy"`
+	Internal string `dynamodbav:"-"`
+}
+
+type userV2 struct {
+	ID     string            `dynamodbav:"id"`
+	Name   string            `dynamodbav:"full_name"`
+	Age    int               `dynamodbav:"age"`
+	Active bool              `dynamodbav:"active" driftdefault:"true"`
+	Email  string            `dynamodbav:"email"`
+	Tags   map[string]string `dynamodbav:"tags"`
+}
+
+func TestDiff(t *testing.T) {
+	d, err := Diff(userV1{}, &userV2{})
+	if err != nil {
+		t.Fatalf("error diffing: %v", err)
+	}
+	if len(d.Renamed) != 1 || d.Renamed[0] != [2]string{"name", "full_name"} {
+		t.Fatalf("bad renames: %v", d.Renamed)
+	}
+	if len(d.Retyped) != 1 || d.Retyped[0].Attribute != "age" {
+		t.Fatalf("bad retypes: %v", d.Retyped)
+	}
+	if len(d.Added) != 3 || len(d.Removed) != 1 || d.Removed[0].Attribute != "legacy" {
+		t.Fatalf("bad added/removed: %v, %v", d.Added, d.Removed)
+	}
+	steps, todo := d.Steps()
+	if len(steps) != 4 {
+		t.Fatalf("bad steps: %+v", steps)
+	}
+	if len(todo) != 2 {
+		t.Fatalf("email and tags should need defaults: %v", todo)
+	}
+	if _, err := Diff(1, userV2{}); err == nil {
+		t.Fatalf("non-struct should fail")
+	}
+}
+
+func TestGenerateMigration(t *testing.T) {
+	src, err := GenerateMigration(userV1{}, userV2{}, GenerateOptions{Number: 4, TableName: "Users"})
+	if err != nil {
+		t.Fatalf("error generating: %v", err)
+	}
+	if _, err := goparser.ParseFile(gotoken.NewFileSet(), "gen.go", src, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	for _, s := range []string{
+		"func Migration4() *drift.DynamoDrifterMigration",
+		`transforms.Rename("name", "full_name")`,
+		`transforms.Retype("age", "N")`,
+		`transforms.Default("active", &dynamodb.AttributeValue{BOOL: aws.Bool(true)})`,
+		`transforms.Delete("legacy")`,
+		"// TODO: choose a default for added attribute email",
+	} {
+		if !strings.Contains(string(src), s) {
+			t.Fatalf("generated source should contain %q:\n%s", s, src)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package transforms
+
+import (
+	"fmt"
+	"reflect"
+
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// RenameTag is the struct tag containing the previous attribute name of a renamed field, ex: `dynamodbav:"full_name" driftrename:"name"`
+const RenameTag = "driftrename"
+
+// Renames returns the [old, new] attribute names of the fields of model (a struct or pointer to one) with a driftrename tag
+func Renames(model interface{}) ([][2]string, error) {
+	fields, _, err := structFields(reflect.TypeOf(model))
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]bool{}
+	for _, f := range fields {
+		attrs[f.Attribute] = true
+	}
+	renames := [][2]string{}
+	for _, f := range fields {
+		if f.RenamedFrom == "" || f.RenamedFrom == f.Attribute {
+			continue
+		}
+		if attrs[f.RenamedFrom] {
+			return nil, fmt.Errorf("%v: %v tag %q is the attribute name of another field", f.Field, RenameTag, f.RenamedFrom)
+		}
+		renames = append(renames, [2]string{f.RenamedFrom, f.Attribute})
+	}
+	return renames, nil
+}
+
+// Backfill moves attribute from to to. If the item already has to (ex: it was written by code using the new name) it is kept and from is removed.
+// Items without from are unchanged.
+func Backfill(from, to string) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		v, ok := item[from]
+		if !ok {
+			return item, nil, nil
+		}
+		delete(item, from)
+		if _, ok := item[to]; !ok {
+			item[to] = v
+		}
+		return item, nil, nil
+	})
+}
+
+// RenameMigrations returns the migration implementing the driftrename tags of model on tableName, and its undo.
+// The migration backfills each new attribute from the old one, the undo moves the values back to the old names (see Backfill).
+// Key attributes must not be renamed this way (the rewritten item would not replace the original).
+func RenameMigrations(model interface{}, number uint, tableName string) (*drift.DynamoDrifterMigration, *drift.DynamoDrifterMigration, error) {
+	renames, err := Renames(model)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(renames) == 0 {
+		return nil, nil, fmt.Errorf("%v has no %v tags", reflect.TypeOf(model), RenameTag)
+	}
+	do := make([]drift.Transformer, len(renames))
+	undo := make([]drift.Transformer, len(renames))
+	for i, r := range renames {
+		do[i] = Backfill(r[0], r[1])
+		undo[i] = Backfill(r[1], r[0])
+	}
+	desc := fmt.Sprintf("rename %v attributes %v", reflect.TypeOf(model), renames)
+	return &drift.DynamoDrifterMigration{
+		Number:      number,
+		TableName:   tableName,
+		Description: desc,
+		Callback:    drift.TransformerCallback(drift.Chain(do...)),
+	}, &drift.DynamoDrifterMigration{
+		Number:      number,
+		TableName:   tableName,
+		Description: "undo " + desc,
+		Callback:    drift.TransformerCallback(drift.Chain(undo...)),
+	}, nil
+}
@@ -0,0 +1,63 @@
+package transforms
+
+import (
+	"testing"
+
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+type userV3 struct {
+	ID      string `dynamodbav:"id"`
+	Name    string `dynamodbav:"full_name" driftrename:"name"`
+	Contact string `dynamodbav:"email_address" driftrename:"email"`
+}
+
+func TestRenames(t *testing.T) {
+	renames, err := Renames(&userV3{})
+	if err != nil {
+		t.Fatalf("error getting renames: %v", err)
+	}
+	if len(renames) != 2 || renames[0] != [2]string{"name", "full_name"} || renames[1] != [2]string{"email", "email_address"} {
+		t.Fatalf("bad renames: %v", renames)
+	}
+	type conflict struct {
+		A string `dynamodbav:"a" driftrename:"b"`
+		B string `dynamodbav:"b"`
+	}
+	if _, err := Renames(conflict{}); err == nil {
+		t.Fatalf("rename to an existing attribute should fail")
+	}
+	d, err := Diff(userV1{}, userV3{})
+	if err != nil {
+		t.Fatalf("error diffing: %v", err)
+	}
+	if len(d.Renamed) != 1 || d.Renamed[0] != [2]string{"name", "full_name"} {
+		t.Fatalf("bad diff renames: %v", d.Renamed)
+	}
+}
+
+func TestRenameMigrations(t *testing.T) {
+	m, undo, err := RenameMigrations(userV3{}, 5, "Users")
+	if err != nil {
+		t.Fatalf("error creating migrations: %v", err)
+	}
+	if m.Number != 5 || undo.Number != 5 || m.TableName != "Users" || undo.TableName != "Users" {
+		t.Fatalf("bad migrations: %+v, %+v", m, undo)
+	}
+	for _, mig := range []*drift.DynamoDrifterMigration{m, undo} {
+		if err := mig.Callback(drift.RawDynamoItem{"id": s("1"), "name": s("Jane")}, &drift.DrifterAction{}); err != nil {
+			t.Fatalf("error running callback: %v", err)
+		}
+	}
+	out, _ := transform(t, Backfill("name", "full_name"), drift.RawDynamoItem{"id": s("1"), "name": s("Jane")})
+	if out["name"] != nil || *out["full_name"].S != "Jane" {
+		t.Fatalf("bad backfilled item: %v", out)
+	}
+	out, _ = transform(t, Backfill("name", "full_name"), drift.RawDynamoItem{"id": s("1"), "name": s("Jane"), "full_name": s("Jane Doe")})
+	if out["name"] != nil || *out["full_name"].S != "Jane Doe" {
+		t.Fatalf("existing new attribute should be kept: %v", out)
+	}
+	if _, _, err := RenameMigrations(userV1{}, 5, "Users"); err == nil {
+		t.Fatalf("model without renames should fail")
+	}
+}
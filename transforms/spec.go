@@ -0,0 +1,164 @@
+package transforms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// Step operations
+const (
+	OpRename      = "rename"       // Rename Attribute to To
+	OpCopy        = "copy"         // Copy Attribute to To
+	OpDelete      = "delete"       // Delete Attributes
+	OpDefault     = "default"      // Set Attribute to Value if absent
+	OpRetype      = "retype"       // Convert Attribute to Type
+	OpSplit       = "split"        // Split Attribute on Separator into Attributes
+	OpMerge       = "merge"        // Merge Attributes with Separator into To
+	OpReformatKey = "reformat_key" // Rewrite Attribute from format From to format To (Spec.Keys are the table key attributes)
+	OpSet         = "set"          // Set Attribute to the result of Expression (removed if null)
+	OpUpdate      = "update"       // Queue an update of the item's keys (Spec.Keys) in TableName (defaults to the migration table) using UpdateExpression, Values and Names
+)
+
+// Step is a declarative transform, see the Op constants for the fields used by each operation
+type Step struct {
+	Op         string                   `json:"op"`
+	Attribute  string                   `json:"attribute,omitempty"`
+	Attributes []string                 `json:"attributes,omitempty"`
+	To         string                   `json:"to,omitempty"`
+	From       string                   `json:"from,omitempty"`
+	Type       string                   `json:"type,omitempty"`
+	Separator  string                   `json:"separator,omitempty"`
+	Value      *dynamodb.AttributeValue `json:"value,omitempty"`      // DynamoDB JSON, ex: {"S": "foo"}
+	Expression string                   `json:"expression,omitempty"` // See Expression for the syntax
+	When       string                   `json:"when,omitempty"`       // Optional condition expression, the step only applies to items for which it is true
+
+	UpdateExpression string                              `json:"update_expression,omitempty"`
+	Values           map[string]*dynamodb.AttributeValue `json:"values,omitempty"` // Expression attribute values (DynamoDB JSON)
+	Names            map[string]string                   `json:"names,omitempty"`  // Expression attribute names
+	TableName        string                              `json:"tablename,omitempty"`
+}
+
+// Spec is a declarative migration: a chain of steps applied to each item of the table.
+// Table names, update expressions, expressions and string values may be Go templates, see Render.
+type Spec struct {
+	Number      uint     `json:"number"`
+	TableName   string   `json:"tablename"`
+	Description string   `json:"description"`
+	Keys        []string `json:"keys,omitempty"` // Key attributes of the table (required by reformat_key steps on key attributes)
+	Steps       []Step   `json:"steps"`
+}
+
+type field struct {
+	name string
+	set  bool
+}
+
+func require(s Step, fields ...field) error {
+	for _, f := range fields {
+		if !f.set {
+			return fmt.Errorf("%v: %v is required", s.Op, f.name)
+		}
+	}
+	return nil
+}
+
+// Transformer returns the transformer for the step. keys are the key attributes of the table.
+func (s Step) Transformer(keys []string) (drift.Transformer, error) {
+	t, err := s.transformer(keys)
+	if err != nil || s.When == "" {
+		return t, err
+	}
+	cond, err := Compile(s.When)
+	if err != nil {
+		return nil, err
+	}
+	return When(cond, t), nil
+}
+
+func (s Step) transformer(keys []string) (drift.Transformer, error) {
+	switch s.Op {
+	case OpRename:
+		return Rename(s.Attribute, s.To), require(s, field{"attribute", s.Attribute != ""}, field{"to", s.To != ""})
+	case OpCopy:
+		return Copy(s.Attribute, s.To), require(s, field{"attribute", s.Attribute != ""}, field{"to", s.To != ""})
+	case OpDelete:
+		return Delete(s.Attributes...), require(s, field{"attributes", len(s.Attributes) > 0})
+	case OpDefault:
+		return Default(s.Attribute, s.Value), require(s, field{"attribute", s.Attribute != ""}, field{"value", s.Value != nil})
+	case OpRetype:
+		return Retype(s.Attribute, s.Type), require(s, field{"attribute", s.Attribute != ""}, field{"type", s.Type != ""})
+	case OpSplit:
+		return Split(s.Attribute, s.Separator, s.Attributes...), require(s, field{"attribute", s.Attribute != ""}, field{"separator", s.Separator != ""}, field{"attributes", len(s.Attributes) > 0})
+	case OpMerge:
+		return Merge(s.Attributes, s.Separator, s.To), require(s, field{"attributes", len(s.Attributes) > 0}, field{"to", s.To != ""})
+	case OpReformatKey:
+		if err := require(s, field{"attribute", s.Attribute != ""}, field{"from", s.From != ""}, field{"to", s.To != ""}); err != nil {
+			return nil, err
+		}
+		return ReformatKey(keys, s.Attribute, s.From, s.To)
+	case OpSet:
+		if err := require(s, field{"attribute", s.Attribute != ""}, field{"expression", s.Expression != ""}); err != nil {
+			return nil, err
+		}
+		e, err := Compile(s.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return Set(s.Attribute, e), nil
+	case OpUpdate:
+		if err := require(s, field{"update_expression", s.UpdateExpression != ""}, field{"keys", len(keys) > 0}); err != nil {
+			return nil, err
+		}
+		return Update(keys, s.UpdateExpression, s.Values, s.Names, s.TableName), nil
+	default:
+		return nil, fmt.Errorf("unknown op: %q", s.Op)
+	}
+}
+
+// Transformer returns the chain of all steps
+func (s *Spec) Transformer() (drift.Transformer, error) {
+	ts := make([]drift.Transformer, len(s.Steps))
+	for i, st := range s.Steps {
+		t, err := st.Transformer(s.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("step %v: %v", i, err)
+		}
+		ts[i] = t
+	}
+	return drift.Chain(ts...), nil
+}
+
+// Migration returns the drift migration for the spec
+func (s *Spec) Migration() (*drift.DynamoDrifterMigration, error) {
+	if s.TableName == "" {
+		return nil, fmt.Errorf("tablename is required")
+	}
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("at least one step is required")
+	}
+	t, err := s.Transformer()
+	if err != nil {
+		return nil, err
+	}
+	return &drift.DynamoDrifterMigration{
+		Number:      s.Number,
+		TableName:   s.TableName,
+		Description: s.Description,
+		Callback:    drift.TransformerCallback(t),
+	}, nil
+}
+
+// LoadSpec reads a JSON encoded Spec from r
+func LoadSpec(r io.Reader) (*Spec, error) {
+	s := &Spec{}
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(s); err != nil {
+		return nil, fmt.Errorf("error decoding spec: %v", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,63 @@
+package transforms
+
+import (
+	"strings"
+	"testing"
+
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+const testSpec = `{
+  "number": 3,
+  "tablename": "Users",
+  "description": "split names",
+  "keys": ["ID"],
+  "steps": [
+    {"op": "split", "attribute": "Name", "separator": " ", "attributes": ["First", "Last"]},
+    {"op": "delete", "attributes": ["Name"]},
+    {"op": "default", "attribute": "Active", "value": {"BOOL": true}},
+    {"op": "reformat_key", "attribute": "ID", "from": "user_{id}", "to": "user#{id}"}
+  ]
+}`
+
+func TestSpecMigration(t *testing.T) {
+	spec, err := LoadSpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatalf("error loading spec: %v", err)
+	}
+	m, err := spec.Migration()
+	if err != nil {
+		t.Fatalf("error creating migration: %v", err)
+	}
+	if m.Number != 3 || m.TableName != "Users" || m.Callback == nil {
+		t.Fatalf("bad migration: %+v", m)
+	}
+	tr, _ := spec.Transformer()
+	out, actions := transform(t, tr, drift.RawDynamoItem{"ID": s("user_1"), "Name": s("Jane Doe")})
+	if *out["First"].S != "Jane" || *out["Last"].S != "Doe" || out["Name"] != nil || !*out["Active"].BOOL || *out["ID"].S != "user#1" {
+		t.Fatalf("bad transformed item: %v", out)
+	}
+	if len(actions) != 1 {
+		t.Fatalf("original key should be deleted: %v", actions)
+	}
+}
+
+func TestSpecErrors(t *testing.T) {
+	for _, js := range []string{
+		`{"tablename": "Users", "steps": [{"op": "bogus"}]}`,
+		`{"tablename": "Users", "steps": [{"op": "rename", "attribute": "a"}]}`,
+		`{"tablename": "Users", "steps": []}`,
+		`{"steps": [{"op": "delete", "attributes": ["a"]}]}`,
+	} {
+		spec, err := LoadSpec(strings.NewReader(js))
+		if err != nil {
+			t.Fatalf("error loading spec: %v", err)
+		}
+		if _, err := spec.Migration(); err == nil {
+			t.Fatalf("should have failed: %v", js)
+		}
+	}
+	if _, err := LoadSpec(strings.NewReader(`{"unknown": 1}`)); err == nil {
+		t.Fatalf("unknown fields should fail")
+	}
+}
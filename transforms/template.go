@@ -0,0 +1,112 @@
+package transforms
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// TemplateData is the data Spec templates are executed with, ex: {{.Vars.tenant}}-users, {{.Env.STAGE}}, {{.Now.Format "2006-01-02"}}
+type TemplateData struct {
+	Env  map[string]string // Process environment
+	Vars map[string]string // Caller supplied variables (tenant, etc)
+	Now  time.Time         // Time (UTC) the spec was rendered
+}
+
+// NewTemplateData returns template data for the current process environment and time
+func NewTemplateData(vars map[string]string) *TemplateData {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	return &TemplateData{Env: env, Vars: vars, Now: time.Now().UTC()}
+}
+
+func render(s string, data *TemplateData) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	t, err := template.New("spec").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("error parsing template %q: %v", s, err)
+	}
+	b := &bytes.Buffer{}
+	if err := t.Execute(b, data); err != nil {
+		return "", fmt.Errorf("error executing template %q: %v", s, err)
+	}
+	return b.String(), nil
+}
+
+// renderValue renders string values (including those nested in maps and lists) of av in place
+func renderValue(av *dynamodb.AttributeValue, data *TemplateData) error {
+	if av == nil {
+		return nil
+	}
+	var err error
+	if av.S != nil {
+		var s string
+		if s, err = render(*av.S, data); err != nil {
+			return err
+		}
+		av.S = &s
+	}
+	for _, v := range av.M {
+		if err = renderValue(v, data); err != nil {
+			return err
+		}
+	}
+	for _, v := range av.L {
+		if err = renderValue(v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render returns a copy of the spec with templates in table names, update expressions, expressions and string attribute values executed against data
+func (s *Spec) Render(data *TemplateData) (*Spec, error) {
+	out := *s
+	var err error
+	if out.TableName, err = render(s.TableName, data); err != nil {
+		return nil, fmt.Errorf("tablename: %v", err)
+	}
+	out.Steps = make([]Step, len(s.Steps))
+	for i, st := range s.Steps {
+		fail := func(err error) (*Spec, error) {
+			return nil, fmt.Errorf("step %v: %v", i, err)
+		}
+		for _, f := range []*string{&st.TableName, &st.UpdateExpression, &st.Expression, &st.When} {
+			if *f, err = render(*f, data); err != nil {
+				return fail(err)
+			}
+		}
+		if st.Value != nil {
+			st.Value = drift.CloneAttributeValue(st.Value)
+			if err = renderValue(st.Value, data); err != nil {
+				return fail(err)
+			}
+		}
+		if st.Values != nil {
+			values := drift.RawDynamoItem(st.Values).Clone()
+			for _, v := range values {
+				if err = renderValue(v, data); err != nil {
+					return fail(err)
+				}
+			}
+			st.Values = values
+		}
+		out.Steps[i] = st
+	}
+	return &out, nil
+}
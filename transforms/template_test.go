@@ -0,0 +1,54 @@
+package transforms
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+const testTemplateSpec = `{
+  "tablename": "{{.Vars.tenant}}-users-{{.Env.STAGE}}",
+  "keys": ["ID"],
+  "steps": [
+    {"op": "default", "attribute": "Migrated", "value": {"S": "{{.Now.Format \"2006-01-02\"}}"}},
+    {"op": "update", "tablename": "{{.Vars.tenant}}-audit", "update_expression": "SET #t = :t", "names": {"#t": "Tenant"}, "values": {":t": {"S": "{{.Vars.tenant}}"}}}
+  ]
+}`
+
+func TestSpecRender(t *testing.T) {
+	spec, err := LoadSpec(strings.NewReader(testTemplateSpec))
+	if err != nil {
+		t.Fatalf("error loading spec: %v", err)
+	}
+	data := &TemplateData{
+		Env:  map[string]string{"STAGE": "prod"},
+		Vars: map[string]string{"tenant": "acme"},
+		Now:  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	r, err := spec.Render(data)
+	if err != nil {
+		t.Fatalf("error rendering spec: %v", err)
+	}
+	if r.TableName != "acme-users-prod" {
+		t.Fatalf("bad table name: %v", r.TableName)
+	}
+	if *spec.Steps[0].Value.S == *r.Steps[0].Value.S {
+		t.Fatalf("original spec should not be modified")
+	}
+	tr, err := r.Transformer()
+	if err != nil {
+		t.Fatalf("error creating transformer: %v", err)
+	}
+	out, actions := transform(t, tr, drift.RawDynamoItem{"ID": s("1")})
+	if *out["Migrated"].S != "2020-01-02" {
+		t.Fatalf("bad rendered value: %v", *out["Migrated"].S)
+	}
+	if len(actions) != 1 || actions[0].TableName != "acme-audit" || *actions[0].Values.(drift.RawDynamoItem)[":t"].S != "acme" {
+		t.Fatalf("bad update action: %+v", actions)
+	}
+	if _, err := spec.Render(&TemplateData{}); err == nil {
+		t.Fatalf("missing variables should fail")
+	}
+}
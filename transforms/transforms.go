@@ -0,0 +1,315 @@
+// Package transforms contains common item transforms for use with drift.Chain, drift.TransformerCallback and declarative migrations (see Spec).
+// Attribute names refer to top level item attributes. Transforms modify the item passed to them in place (TransformerCallback passes a copy).
+package transforms
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+// DynamoDB attribute types
+const (
+	TypeString    = "S"
+	TypeNumber    = "N"
+	TypeBool      = "BOOL"
+	TypeStringSet = "SS"
+	TypeNumberSet = "NS"
+	TypeBinary    = "B"
+	TypeNull      = "NULL"
+	TypeMap       = "M"
+	TypeList      = "L"
+	TypeBinarySet = "BS"
+	typeUnknown   = ""
+)
+
+func attributeType(av *dynamodb.AttributeValue) string {
+	switch {
+	case av.S != nil:
+		return TypeString
+	case av.N != nil:
+		return TypeNumber
+	case av.BOOL != nil:
+		return TypeBool
+	case av.SS != nil:
+		return TypeStringSet
+	case av.NS != nil:
+		return TypeNumberSet
+	case av.B != nil:
+		return TypeBinary
+	case av.NULL != nil:
+		return TypeNull
+	case av.M != nil:
+		return TypeMap
+	case av.L != nil:
+		return TypeList
+	case av.BS != nil:
+		return TypeBinarySet
+	default:
+		return typeUnknown
+	}
+}
+
+func transformer(f func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error)) drift.Transformer {
+	return drift.TransformerFunc(f)
+}
+
+// Rename renames attribute from to to. Items without from are unchanged, an existing attribute named to is overwritten.
+func Rename(from, to string) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		if v, ok := item[from]; ok {
+			delete(item, from)
+			item[to] = v
+		}
+		return item, nil, nil
+	})
+}
+
+// Copy copies attribute from to to. Items without from are unchanged, an existing attribute named to is overwritten.
+func Copy(from, to string) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		if v, ok := item[from]; ok {
+			item[to] = drift.CloneAttributeValue(v)
+		}
+		return item, nil, nil
+	})
+}
+
+// Delete removes attrs from the item
+func Delete(attrs ...string) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		for _, a := range attrs {
+			delete(item, a)
+		}
+		return item, nil, nil
+	})
+}
+
+// Default sets attr to value on items that do not have it
+func Default(attr string, value *dynamodb.AttributeValue) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		if _, ok := item[attr]; !ok {
+			item[attr] = drift.CloneAttributeValue(value)
+		}
+		return item, nil, nil
+	})
+}
+
+// Retype converts attr to type t. Supported conversions are between S, N and BOOL (numbers are converted to BOOL as zero/non-zero) and between SS and NS.
+// Items without attr, or where it already has type t, are unchanged.
+func Retype(attr, t string) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		v, ok := item[attr]
+		if !ok {
+			return item, nil, nil
+		}
+		nv, err := convert(v, t)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error converting %v: %v", attr, err)
+		}
+		item[attr] = nv
+		return item, nil, nil
+	})
+}
+
+func convert(v *dynamodb.AttributeValue, t string) (*dynamodb.AttributeValue, error) {
+	from := attributeType(v)
+	if from == t {
+		return v, nil
+	}
+	switch {
+	case from == TypeString && t == TypeNumber:
+		if _, err := strconv.ParseFloat(*v.S, 64); err != nil {
+			return nil, fmt.Errorf("not a number: %q", *v.S)
+		}
+		return &dynamodb.AttributeValue{N: aws.String(*v.S)}, nil
+	case from == TypeString && t == TypeBool:
+		b, err := strconv.ParseBool(*v.S)
+		if err != nil {
+			return nil, fmt.Errorf("not a bool: %q", *v.S)
+		}
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(b)}, nil
+	case from == TypeNumber && t == TypeString:
+		return &dynamodb.AttributeValue{S: aws.String(*v.N)}, nil
+	case from == TypeNumber && t == TypeBool:
+		f, err := strconv.ParseFloat(*v.N, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number: %q", *v.N)
+		}
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(f != 0)}, nil
+	case from == TypeBool && t == TypeString:
+		return &dynamodb.AttributeValue{S: aws.String(strconv.FormatBool(*v.BOOL))}, nil
+	case from == TypeBool && t == TypeNumber:
+		n := "0"
+		if *v.BOOL {
+			n = "1"
+		}
+		return &dynamodb.AttributeValue{N: aws.String(n)}, nil
+	case from == TypeStringSet && t == TypeNumberSet:
+		for _, s := range v.SS {
+			if _, err := strconv.ParseFloat(aws.StringValue(s), 64); err != nil {
+				return nil, fmt.Errorf("not a number: %q", aws.StringValue(s))
+			}
+		}
+		return &dynamodb.AttributeValue{NS: v.SS}, nil
+	case from == TypeNumberSet && t == TypeStringSet:
+		return &dynamodb.AttributeValue{SS: v.NS}, nil
+	default:
+		return nil, fmt.Errorf("unsupported conversion: %v to %v", from, t)
+	}
+}
+
+// scalar returns the string representation of a S or N attribute
+func scalar(v *dynamodb.AttributeValue) (string, bool) {
+	switch {
+	case v.S != nil:
+		return *v.S, true
+	case v.N != nil:
+		return *v.N, true
+	default:
+		return "", false
+	}
+}
+
+// Split splits the string attribute attr on sep into the string attributes into (the last of which receives the remainder).
+// The attribute must have at least len(into) parts. attr is kept, use Delete to remove it. Items without attr are unchanged.
+func Split(attr, sep string, into ...string) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		v, ok := item[attr]
+		if !ok {
+			return item, nil, nil
+		}
+		if v.S == nil {
+			return nil, nil, fmt.Errorf("%v is not a string", attr)
+		}
+		parts := strings.SplitN(*v.S, sep, len(into))
+		if len(parts) != len(into) {
+			return nil, nil, fmt.Errorf("%v: expected %v parts: %q", attr, len(into), *v.S)
+		}
+		for i, p := range parts {
+			item[into[i]] = &dynamodb.AttributeValue{S: aws.String(p)}
+		}
+		return item, nil, nil
+	})
+}
+
+// Merge joins the string or number attributes attrs with sep into the string attribute into. Missing attributes are skipped,
+// items with none of attrs are unchanged. attrs are kept, use Delete to remove them.
+func Merge(attrs []string, sep, into string) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		parts := []string{}
+		for _, a := range attrs {
+			v, ok := item[a]
+			if !ok {
+				continue
+			}
+			s, ok := scalar(v)
+			if !ok {
+				return nil, nil, fmt.Errorf("%v is not a string or number", a)
+			}
+			parts = append(parts, s)
+		}
+		if len(parts) > 0 {
+			item[into] = &dynamodb.AttributeValue{S: aws.String(strings.Join(parts, sep))}
+		}
+		return item, nil, nil
+	})
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// ReformatKey rewrites the string attribute attr from format from to format to. Formats contain literal text and {name} placeholders, ex: from "{type}#{id}" to "{type}-{id}".
+// Every placeholder in to must appear in from. Values that don't match from are unchanged, so reruns are idempotent as long as rewritten
+// values don't match from: formats whose output always matches from are rejected (ex: from "{id}" to "user#{id}", which would rewrite
+// "user#1" to "user#user#1"), but values containing the literal text of from may still be rewritten again (ex: "a#b#1" from "{type}#{id}"
+// to "{id}-{type}").
+// keys are the key attributes of the table: if attr is one of them, a delete of the original item is returned along with the rewritten item.
+func ReformatKey(keys []string, attr, from, to string) (drift.Transformer, error) {
+	names := map[string]bool{}
+	pattern := "^"
+	last := 0
+	for _, m := range placeholder.FindAllStringSubmatchIndex(from, -1) {
+		name := from[m[2]:m[3]]
+		if names[name] {
+			return nil, fmt.Errorf("duplicate placeholder in from: %v", name)
+		}
+		names[name] = true
+		pattern += regexp.QuoteMeta(from[last:m[0]]) + "(?P<" + name + ">.*?)"
+		last = m[1]
+	}
+	pattern += regexp.QuoteMeta(from[last:]) + "$"
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad from format: %v", err)
+	}
+	for _, m := range placeholder.FindAllStringSubmatch(to, -1) {
+		if !names[m[1]] {
+			return nil, fmt.Errorf("placeholder %v in to is not present in from", m[1])
+		}
+	}
+	if sample := placeholder.ReplaceAllString(to, "0"); re.MatchString(sample) {
+		return nil, fmt.Errorf("output of to matches from (ex: %q), reruns would reformat values again", sample)
+	}
+	isKey := false
+	for _, k := range keys {
+		isKey = isKey || k == attr
+	}
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		v, ok := item[attr]
+		if !ok || v.S == nil {
+			return item, nil, nil
+		}
+		m := re.FindStringSubmatch(*v.S)
+		if m == nil {
+			return item, nil, nil
+		}
+		values := map[string]string{}
+		for i, n := range re.SubexpNames() {
+			values[n] = m[i]
+		}
+		nv := placeholder.ReplaceAllStringFunc(to, func(p string) string {
+			return values[p[1:len(p)-1]]
+		})
+		if nv == *v.S {
+			return item, nil, nil
+		}
+		var actions []drift.Action
+		if isKey {
+			orig := drift.RawDynamoItem{}
+			for _, k := range keys {
+				orig[k] = item[k]
+			}
+			actions = append(actions, drift.Action{Type: drift.ActionDelete, Keys: orig.Clone()})
+		}
+		item[attr] = &dynamodb.AttributeValue{S: aws.String(nv)}
+		return item, actions, nil
+	}), nil
+}
+
+// Update queues an update of the item (identified by its keys attributes) in tableName (optional, defaults to the migration table), see DrifterAction.Update.
+// The item itself is unchanged.
+func Update(keys []string, updateExpression string, values map[string]*dynamodb.AttributeValue, names map[string]string, tableName string) drift.Transformer {
+	return transformer(func(item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action, error) {
+		k := drift.RawDynamoItem{}
+		for _, name := range keys {
+			v, ok := item[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("item is missing key attribute %v", name)
+			}
+			k[name] = v
+		}
+		return item, []drift.Action{drift.Action{
+			Type:                     drift.ActionUpdate,
+			Keys:                     k.Clone(),
+			Values:                   drift.RawDynamoItem(values).Clone(),
+			UpdateExpression:         updateExpression,
+			ExpressionAttributeNames: names,
+			TableName:                tableName,
+		}}, nil
+	})
+}
@@ -0,0 +1,105 @@
+package transforms
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	drift "github.com/dollarshaveclub/dynamo-drift"
+)
+
+func s(v string) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{S: aws.String(v)}
+}
+
+func n(v string) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(v)}
+}
+
+func b(v bool) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{BOOL: aws.Bool(v)}
+}
+
+func transform(t *testing.T, tr drift.Transformer, item drift.RawDynamoItem) (drift.RawDynamoItem, []drift.Action) {
+	out, actions, err := tr.Transform(item)
+	if err != nil {
+		t.Fatalf("error transforming: %v", err)
+	}
+	return out, actions
+}
+
+func TestTransforms(t *testing.T) {
+	rk, err := ReformatKey([]string{"ID"}, "ID", "{type}#{id}", "{type}-{id}")
+	if err != nil {
+		t.Fatalf("error creating ReformatKey: %v", err)
+	}
+	cases := []struct {
+		name string
+		t    drift.Transformer
+		in   drift.RawDynamoItem
+		out  drift.RawDynamoItem
+	}{
+		{"rename", Rename("a", "b"), drift.RawDynamoItem{"a": s("1")}, drift.RawDynamoItem{"b": s("1")}},
+		{"rename missing", Rename("a", "b"), drift.RawDynamoItem{"c": s("1")}, drift.RawDynamoItem{"c": s("1")}},
+		{"copy", Copy("a", "b"), drift.RawDynamoItem{"a": s("1")}, drift.RawDynamoItem{"a": s("1"), "b": s("1")}},
+		{"delete", Delete("a", "b"), drift.RawDynamoItem{"a": s("1"), "b": s("2"), "c": s("3")}, drift.RawDynamoItem{"c": s("3")}},
+		{"default", Default("a", n("0")), drift.RawDynamoItem{}, drift.RawDynamoItem{"a": n("0")}},
+		{"default existing", Default("a", n("0")), drift.RawDynamoItem{"a": n("1")}, drift.RawDynamoItem{"a": n("1")}},
+		{"retype S to N", Retype("a", TypeNumber), drift.RawDynamoItem{"a": s("12")}, drift.RawDynamoItem{"a": n("12")}},
+		{"retype N to S", Retype("a", TypeString), drift.RawDynamoItem{"a": n("12")}, drift.RawDynamoItem{"a": s("12")}},
+		{"retype S to BOOL", Retype("a", TypeBool), drift.RawDynamoItem{"a": s("true")}, drift.RawDynamoItem{"a": b(true)}},
+		{"retype BOOL to N", Retype("a", TypeNumber), drift.RawDynamoItem{"a": b(true)}, drift.RawDynamoItem{"a": n("1")}},
+		{"split", Split("name", " ", "first", "last"), drift.RawDynamoItem{"name": s("Jane Q Doe")}, drift.RawDynamoItem{"name": s("Jane Q Doe"), "first": s("Jane"), "last": s("Q Doe")}},
+		{"merge", Merge([]string{"first", "last"}, " ", "name"), drift.RawDynamoItem{"first": s("Jane"), "last": s("Doe")}, drift.RawDynamoItem{"first": s("Jane"), "last": s("Doe"), "name": s("Jane Doe")}},
+		{"reformat key", rk, drift.RawDynamoItem{"ID": s("user#1")}, drift.RawDynamoItem{"ID": s("user-1")}},
+		{"reformat key unmatched", rk, drift.RawDynamoItem{"ID": s("user-1")}, drift.RawDynamoItem{"ID": s("user-1")}},
+	}
+	for _, c := range cases {
+		out, _ := transform(t, c.t, c.in)
+		if !reflect.DeepEqual(out, c.out) {
+			t.Fatalf("%v: unexpected result: %v", c.name, out)
+		}
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	for _, tr := range []drift.Transformer{
+		Retype("a", TypeNumber),
+		Retype("a", TypeMap),
+		Split("a", " ", "b", "c"),
+	} {
+		if _, _, err := tr.Transform(drift.RawDynamoItem{"a": s("foo")}); err == nil {
+			t.Fatalf("should have returned an error")
+		}
+	}
+	if _, err := ReformatKey(nil, "ID", "{id}", "{other}"); err == nil {
+		t.Fatalf("unknown placeholder should have failed")
+	}
+	if _, err := ReformatKey(nil, "ID", "{id}", "user#{id}"); err == nil {
+		t.Fatalf("output matching from should have failed")
+	}
+}
+
+func TestReformatKeyDelete(t *testing.T) {
+	rk, err := ReformatKey([]string{"ID", "Sort"}, "ID", "{type}#{id}", "{id}.{type}")
+	if err != nil {
+		t.Fatalf("error creating ReformatKey: %v", err)
+	}
+	out, actions := transform(t, rk, drift.RawDynamoItem{"ID": s("user#1"), "Sort": n("1")})
+	if *out["ID"].S != "1.user" {
+		t.Fatalf("bad reformatted key: %v", *out["ID"].S)
+	}
+	if len(actions) != 1 || actions[0].Type != drift.ActionDelete {
+		t.Fatalf("original item should be deleted: %v", actions)
+	}
+	if k := actions[0].Keys.(drift.RawDynamoItem); *k["ID"].S != "user#1" || *k["Sort"].N != "1" {
+		t.Fatalf("bad delete keys: %v", k)
+	}
+	// non-key attributes are rewritten in place
+	rk, _ = ReformatKey([]string{"ID"}, "Ref", "{type}#{id}", "{type}/{id}")
+	_, actions = transform(t, rk, drift.RawDynamoItem{"ID": s("x"), "Ref": s("user#1")})
+	if len(actions) != 0 {
+		t.Fatalf("non-key rewrites should not delete: %v", actions)
+	}
+}
@@ -0,0 +1,250 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	calibrationPageSize     = 100
+	calibrationPages        = 3
+	calibrationWrites       = 10
+	maxCalibrationThrottles = 20
+	maxRecommendedWorkers   = 64
+	bytesPerScanSegment     = 2 << 30 // AWS guidance: roughly one segment per 2 GB of table data
+)
+
+// TuningReport contains measurements taken during calibration and the settings recommended for the full run.
+type TuningReport struct {
+	TableName      string
+	BillingMode    string
+	ItemCount      int64 // As reported by DescribeTable (updated by DynamoDB roughly every six hours)
+	TableSizeBytes int64
+
+	SampledItems       int
+	ScanPageLatency    time.Duration // Mean latency of a sample scan page
+	CallbackLatency    time.Duration // Mean callback duration per item
+	ActionsPerItem     float64       // Mean number of actions queued per item
+	WriteLatency       time.Duration // Mean latency of a (no-op) conditional write
+	ThrottledRequests  int
+	EstimatedDuration  time.Duration // Rough estimate of the full run using the recommended settings
+	CalibrationElapsed time.Duration
+
+	// Recommended settings, see the matching fields on DynamoDrifterMigration
+	PageSize            uint
+	ScanSegments        uint
+	CallbackConcurrency uint
+	ActionConcurrency   uint
+}
+
+// Apply sets the recommended settings on migration
+func (tr *TuningReport) Apply(migration *DynamoDrifterMigration) {
+	migration.PageSize = tr.PageSize
+	migration.ScanSegments = tr.ScanSegments
+	migration.CallbackConcurrency = tr.CallbackConcurrency
+	migration.ActionConcurrency = tr.ActionConcurrency
+}
+
+// String renders the report in human readable form
+func (tr *TuningReport) String() string {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "calibration of table %v (%v, ~%v items, %v bytes) took %v\n", tr.TableName, tr.BillingMode, tr.ItemCount, tr.TableSizeBytes, tr.CalibrationElapsed)
+	w := tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "sampled items\t%v\n", tr.SampledItems)
+	fmt.Fprintf(w, "scan page latency\t%v\n", tr.ScanPageLatency)
+	fmt.Fprintf(w, "callback latency\t%v\n", tr.CallbackLatency)
+	fmt.Fprintf(w, "actions per item\t%.2f\n", tr.ActionsPerItem)
+	fmt.Fprintf(w, "write latency\t%v\n", tr.WriteLatency)
+	fmt.Fprintf(w, "throttled requests\t%v\n", tr.ThrottledRequests)
+	fmt.Fprintf(w, "recommended page size\t%v\n", tr.PageSize)
+	fmt.Fprintf(w, "recommended scan segments\t%v\n", tr.ScanSegments)
+	fmt.Fprintf(w, "recommended callback concurrency\t%v\n", tr.CallbackConcurrency)
+	fmt.Fprintf(w, "recommended action concurrency\t%v\n", tr.ActionConcurrency)
+	fmt.Fprintf(w, "estimated duration\t%v\n", tr.EstimatedDuration)
+	w.Flush()
+	return b.String()
+}
+
+// Calibrate performs a short calibration run for migration and returns recommended settings.
+// It scans a few sample pages, runs the migration callback on the sampled items (queued actions are discarded) and performs sample
+// conditional writes against the table whose condition can never succeed, so no data is modified (the writes do consume write capacity).
+func (dd *DynamoDrifter) Calibrate(ctx context.Context, migration *DynamoDrifterMigration) (*TuningReport, error) {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return nil, err
+	}
+	if err := validateCallbacks(migration); err != nil {
+		return nil, err
+	}
+	start := time.Now().UTC()
+	td, mode, err := dd.describeTable(ctx, migration.TableName)
+	if err != nil {
+		return nil, err
+	}
+	tr := &TuningReport{
+		TableName:      migration.TableName,
+		BillingMode:    mode,
+		ItemCount:      aws.Int64Value(td.ItemCount),
+		TableSizeBytes: aws.Int64Value(td.TableSizeBytes),
+	}
+	// throttled requests are counted and retried (up to a limit)
+	isThrottle := func(err error) bool {
+		if ClassifyError(err) == ErrorClassThrottling && tr.ThrottledRequests < maxCalibrationThrottles {
+			tr.ThrottledRequests++
+			time.Sleep(DefaultBackoff.Delay(uint(tr.ThrottledRequests)))
+			return true
+		}
+		return false
+	}
+
+	// sample scan
+	items := []RawDynamoItem{}
+	si := &dynamodb.ScanInput{
+		TableName: aws.String(migration.TableName),
+		Limit:     aws.Int64(calibrationPageSize),
+	}
+	var scanTime time.Duration
+	var pages int
+	for pages < calibrationPages {
+		req, so := dd.DynamoDB.ScanRequest(si)
+		t := time.Now().UTC()
+		err := dd.send(ctx, req)
+		if err != nil {
+			if isThrottle(err) {
+				continue
+			}
+			return nil, fmt.Errorf("error scanning table: %v", err)
+		}
+		scanTime += time.Since(t)
+		pages++
+		for _, item := range so.Items {
+			items = append(items, item)
+		}
+		if len(so.LastEvaluatedKey) == 0 {
+			break
+		}
+		si.ExclusiveStartKey = so.LastEvaluatedKey
+	}
+	tr.SampledItems = len(items)
+	if pages > 0 {
+		tr.ScanPageLatency = scanTime / time.Duration(pages)
+	}
+
+	// sample callbacks
+	if len(items) > 0 {
+		da := &DrifterAction{dyn: dd.DynamoDB}
+		t := time.Now().UTC()
+		// errors are irrelevant for timing purposes
+		if migration.BatchCallback != nil {
+			migration.BatchCallback(items, da)
+		} else {
+			for _, item := range items {
+				migration.Callback(item, da)
+			}
+		}
+		tr.CallbackLatency = time.Since(t) / time.Duration(len(items))
+		tr.ActionsPerItem = float64(da.aq.len()) / float64(len(items))
+	}
+
+	// sample writes
+	var writes int
+	var writeTime time.Duration
+	for i := 0; i < len(items) && writes < calibrationWrites; i++ {
+		key := RawDynamoItem{}
+		for _, ks := range td.KeySchema {
+			key[*ks.AttributeName] = items[i][*ks.AttributeName]
+		}
+		hk := td.KeySchema[0].AttributeName
+		req, _ := dd.DynamoDB.PutItemRequest(&dynamodb.PutItemInput{
+			TableName:                aws.String(migration.TableName),
+			Item:                     key,
+			ConditionExpression:      aws.String("attribute_exists(#k) AND attribute_not_exists(#k)"),
+			ExpressionAttributeNames: map[string]*string{"#k": hk},
+		})
+		t := time.Now().UTC()
+		err := dd.send(ctx, req)
+		d := time.Since(t)
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "ConditionalCheckFailedException" {
+			if isThrottle(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unexpected result for calibration write: %v", err)
+		}
+		writeTime += d
+		writes++
+	}
+	if writes > 0 {
+		tr.WriteLatency = writeTime / time.Duration(writes)
+	}
+	tr.recommend(td)
+	tr.CalibrationElapsed = time.Since(start)
+	return tr, nil
+}
+
+func clampWorkers(n float64) uint {
+	if n < 1 || math.IsNaN(n) {
+		return 1
+	}
+	if n > maxRecommendedWorkers {
+		return maxRecommendedWorkers
+	}
+	return uint(math.Ceil(n))
+}
+
+// recommend computes recommended settings from the measurements (using Little's law to size worker pools)
+func (tr *TuningReport) recommend(td *dynamodb.TableDescription) {
+	avgItemSize := float64(1024)
+	if tr.ItemCount > 0 && tr.TableSizeBytes > 0 {
+		avgItemSize = float64(tr.TableSizeBytes) / float64(tr.ItemCount)
+	}
+	// aim for pages well under the 1 MB scan page limit
+	ps := (512 * 1024) / avgItemSize
+	if ps < 25 {
+		ps = 25
+	}
+	if ps > 1000 {
+		ps = 1000
+	}
+	tr.PageSize = uint(ps)
+
+	tr.ScanSegments = clampWorkers(float64(tr.TableSizeBytes) / bytesPerScanSegment)
+	if tr.ThrottledRequests > 0 && tr.ScanSegments > 1 {
+		tr.ScanSegments /= 2
+	}
+
+	// callbacks must keep up with the scanners: items/sec scanned * seconds per callback
+	var scanRate float64 // items per second
+	if tr.ScanPageLatency > 0 {
+		scanRate = float64(tr.ScanSegments) * float64(tr.PageSize) / tr.ScanPageLatency.Seconds()
+	}
+	tr.CallbackConcurrency = clampWorkers(scanRate * tr.CallbackLatency.Seconds())
+
+	// writes: in flight requests = target write rate * latency
+	writeRate := float64(maxRecommendedWorkers) / math.Max(tr.WriteLatency.Seconds(), 0.001)
+	if tr.BillingMode == BillingModeProvisioned && td.ProvisionedThroughput != nil {
+		writeRate = float64(aws.Int64Value(td.ProvisionedThroughput.WriteCapacityUnits))
+	}
+	tr.ActionConcurrency = clampWorkers(writeRate * tr.WriteLatency.Seconds())
+	if tr.ThrottledRequests > 0 && tr.ActionConcurrency > 1 {
+		tr.ActionConcurrency /= 2
+	}
+
+	// estimate: the slowest of scanning, callbacks and writes
+	if tr.ItemCount > 0 {
+		n := float64(tr.ItemCount)
+		var est float64
+		if scanRate > 0 {
+			est = n / scanRate
+		}
+		est = math.Max(est, n*tr.CallbackLatency.Seconds()/float64(tr.CallbackConcurrency))
+		est = math.Max(est, n*tr.ActionsPerItem*tr.WriteLatency.Seconds()/float64(tr.ActionConcurrency))
+		tr.EstimatedDuration = time.Duration(est * float64(time.Second))
+	}
+}
@@ -0,0 +1,83 @@
+package drift
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestTuningRecommend(t *testing.T) {
+	tr := &TuningReport{
+		BillingMode:     BillingModeProvisioned,
+		ItemCount:       10000000,
+		TableSizeBytes:  10 << 30,
+		ScanPageLatency: 100 * time.Millisecond,
+		CallbackLatency: 10 * time.Millisecond,
+		ActionsPerItem:  1,
+		WriteLatency:    10 * time.Millisecond,
+	}
+	tr.recommend(&dynamodb.TableDescription{
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{WriteCapacityUnits: aws.Int64(1000)},
+	})
+	if tr.PageSize != 488 {
+		t.Fatalf("bad page size: %v", tr.PageSize)
+	}
+	if tr.ScanSegments != 5 {
+		t.Fatalf("bad scan segments: %v", tr.ScanSegments)
+	}
+	if tr.CallbackConcurrency != maxRecommendedWorkers {
+		t.Fatalf("bad callback concurrency: %v", tr.CallbackConcurrency)
+	}
+	if tr.ActionConcurrency != 10 {
+		t.Fatalf("bad action concurrency: %v", tr.ActionConcurrency)
+	}
+	if tr.EstimatedDuration == 0 {
+		t.Fatalf("expected duration estimate")
+	}
+	if !strings.Contains(tr.String(), "recommended scan segments") {
+		t.Fatalf("bad report output: %v", tr.String())
+	}
+	m := &DynamoDrifterMigration{}
+	tr.Apply(m)
+	if m.PageSize != tr.PageSize || m.ScanSegments != tr.ScanSegments || m.ActionConcurrency != tr.ActionConcurrency {
+		t.Fatalf("settings not applied: %+v", m)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	dd := DynamoDrifter{
+		MetaTableName: testMetaTable,
+		DynamoDB:      getTestDDBClient(),
+	}
+	err := setupTestTables(dd.DynamoDB)
+	if err != nil {
+		t.Fatalf("error setting up test tables: %v", err)
+	}
+	defer dropTestTables(dd.DynamoDB)
+	migration := &DynamoDrifterMigration{
+		TableName:   testTableA,
+		Description: "split up names",
+		Callback:    testMigrateUp,
+	}
+	tr, err := dd.Calibrate(context.Background(), migration)
+	if err != nil {
+		t.Fatalf("error calibrating: %v", err)
+	}
+	if tr.SampledItems != 3 {
+		t.Fatalf("bad sampled items: %v", tr.SampledItems)
+	}
+	if tr.ActionsPerItem != 2 {
+		t.Fatalf("bad actions per item: %v", tr.ActionsPerItem)
+	}
+	if tr.PageSize == 0 || tr.ScanSegments == 0 || tr.CallbackConcurrency == 0 || tr.ActionConcurrency == 0 {
+		t.Fatalf("missing recommendations: %+v", tr)
+	}
+	err = testVerifyMigration(dd.DynamoDB, testTableA)
+	if err == nil {
+		t.Fatalf("calibration should not modify the table")
+	}
+}
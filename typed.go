@@ -0,0 +1,177 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// TypedAction queues the actions of a callback on a table with a registered model T (see ActionFor). Updated attributes are designated
+// by pointers to fields of the item, so misspelled attributes fail to compile instead of failing the action:
+//
+//	u := User{ID: 1, FirstName: "Jane"}
+//	users.UpdateFields(&u, &u.FirstName)
+type TypedAction[T any] struct {
+	da    *DrifterAction
+	table string
+	model *Model
+}
+
+// ActionFor returns a TypedAction queuing actions with da on tableName (optional, defaults to the migration table), whose registered
+// model (see DynamoDrifter.Models) must be T
+func ActionFor[T any](da *DrifterAction, tableName string) (*TypedAction[T], error) {
+	table := tableName
+	if table == "" {
+		table = da.table
+	}
+	m := da.models.Model(table)
+	if m == nil {
+		return nil, fmt.Errorf("no model registered for table %v", table)
+	}
+	if t := reflect.TypeOf((*T)(nil)).Elem(); m.Type != t {
+		return nil, fmt.Errorf("model of table %v is %v, not %v", table, m.Type, t)
+	}
+	return &TypedAction[T]{da: da, table: tableName, model: m}, nil
+}
+
+// marshal marshals item, returning it and its key
+func (ta *TypedAction[T]) marshal(item *T) (RawDynamoItem, RawDynamoItem, error) {
+	mitem, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshaling item: %v", err)
+	}
+	keys := RawDynamoItem{}
+	for _, k := range ta.model.keys() {
+		if mitem[k] == nil {
+			return nil, nil, fmt.Errorf("key %v of table %v is missing", k, ta.model.Table)
+		}
+		keys[k] = mitem[k]
+	}
+	return mitem, keys, nil
+}
+
+// Insert queues the insert of item
+func (ta *TypedAction[T]) Insert(item T) error {
+	mitem, _, err := ta.marshal(&item)
+	if err != nil {
+		return err
+	}
+	return ta.da.Insert(mitem, ta.table)
+}
+
+// Delete queues the delete of the item with the key fields of key (other fields are ignored)
+func (ta *TypedAction[T]) Delete(key T) error {
+	_, keys, err := ta.marshal(&key)
+	if err != nil {
+		return err
+	}
+	return ta.da.Delete(keys, ta.table)
+}
+
+// UpdateFields queues an update of the item with the key fields of item, setting the attributes of fields (pointers to fields of item) to
+// their value in item. Fields whose value is omitted when marshaled (see "omitempty") are removed.
+func (ta *TypedAction[T]) UpdateFields(item *T, fields ...interface{}) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("at least one field is required")
+	}
+	mitem, keys, err := ta.marshal(item)
+	if err != nil {
+		return err
+	}
+	ub := ta.da.UpdateItem(keys, ta.table)
+	for _, f := range fields {
+		attr, err := ta.attribute(item, f)
+		if err != nil {
+			return err
+		}
+		if attr == ta.model.HashKey || attr == ta.model.RangeKey {
+			return fmt.Errorf("key %v of table %v can't be updated", attr, ta.model.Table)
+		}
+		if av := mitem[attr]; av != nil {
+			ub.Set(attr, av)
+		} else {
+			ub.Remove(attr)
+		}
+	}
+	return ub.Queue()
+}
+
+// attribute returns the attribute of field, a pointer to a field of item
+func (ta *TypedAction[T]) attribute(item *T, field interface{}) (string, error) {
+	fv := reflect.ValueOf(field)
+	if fv.Kind() != reflect.Ptr || fv.IsNil() {
+		return "", fmt.Errorf("fields must be pointers to fields of the item, not %T", field)
+	}
+	base, addr := reflect.ValueOf(item).Pointer(), fv.Pointer()
+	for _, a := range ta.model.Attributes {
+		if !a.indirect && addr == base+a.offset && fv.Type().Elem() == a.gotype {
+			return a.Name, nil
+		}
+	}
+	return "", fmt.Errorf("%T is not a pointer to an attribute field of the item", field)
+}
+
+// NewTypedMigration returns a migration of tableName whose callback receives the items unmarshaled into model T. Scans of the migration
+// only read the attributes of T and the key attributes (see DynamoDrifterMigration.ItemModel).
+func NewTypedMigration[T any](number uint, tableName, description string, callback func(item T, action *DrifterAction) error) *DynamoDrifterMigration {
+	return &DynamoDrifterMigration{
+		Number:      number,
+		TableName:   tableName,
+		Description: description,
+		ItemModel:   reflect.TypeOf((*T)(nil)).Elem(),
+		Callback: func(raw RawDynamoItem, action *DrifterAction) error {
+			var item T
+			if err := dynamodbattribute.UnmarshalMap(raw, &item); err != nil {
+				return fmt.Errorf("error unmarshaling item: %v", err)
+			}
+			return callback(item, action)
+		},
+	}
+}
+
+// projection returns the projection expression (and its names) of scans of migration, derived from its ItemModel, or "" if scans read
+// whole items
+func (dd *DynamoDrifter) projection(ctx context.Context, migration *DynamoDrifterMigration) (string, map[string]*string, error) {
+	if migration.ItemModel == nil {
+		return "", nil, nil
+	}
+	m, err := newModel(migration.ItemModel)
+	if err != nil {
+		return "", nil, fmt.Errorf("bad item model: %v", err)
+	}
+	td, _, err := dd.describeTable(ctx, migration.TableName)
+	if err != nil {
+		return "", nil, err
+	}
+	attrs := map[string]bool{}
+	for name := range m.Attributes {
+		attrs[name] = true
+	}
+	for _, kse := range td.KeySchema {
+		attrs[aws.StringValue(kse.AttributeName)] = true
+	}
+	if migration.Versioning != nil {
+		attrs[VersionAttribute] = true
+	}
+	if migration.Idempotent {
+		attrs[MarkerAttribute(migration.Number)] = true
+	}
+	sorted := make([]string, 0, len(attrs))
+	for a := range attrs {
+		sorted = append(sorted, a)
+	}
+	sort.Strings(sorted)
+	names := make(map[string]*string, len(sorted))
+	for i, a := range sorted {
+		p := "#drift_p" + strconv.Itoa(i)
+		names[p] = aws.String(a)
+		sorted[i] = p
+	}
+	return strings.Join(sorted, ", "), names, nil
+}
@@ -0,0 +1,108 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestActionFor(t *testing.T) {
+	dd := &DynamoDrifter{Models: &ModelRegistry{}}
+	if err := RegisterModel[testModelUser](dd.Models, "users", "ID", ""); err != nil {
+		t.Fatalf("error registering model: %v", err)
+	}
+	da := dd.newDrifterAction(&DynamoDrifterMigration{TableName: "users"})
+	if _, err := ActionFor[testModelBase](da, ""); err == nil {
+		t.Fatalf("ActionFor should require the model of the table")
+	}
+	if _, err := ActionFor[testModelUser](da, "other"); err == nil {
+		t.Fatalf("ActionFor should require a registered model")
+	}
+	users, err := ActionFor[testModelUser](da, "")
+	if err != nil {
+		t.Fatalf("error getting typed action: %v", err)
+	}
+	u := testModelUser{ID: 1, FirstName: "Jane"}
+	if err := users.UpdateFields(&u, &u.FirstName, &u.Avatar, &u.Nickname); err != nil {
+		t.Fatalf("error updating fields: %v", err)
+	}
+	if err := users.UpdateFields(&u, &u.ID); err == nil {
+		t.Fatalf("keys should not be updated")
+	}
+	other := testModelUser{}
+	if err := users.UpdateFields(&u, &other.FirstName); err == nil {
+		t.Fatalf("fields of other items should be rejected")
+	}
+	if err := users.Insert(u); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := users.Delete(testModelUser{ID: 2}); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	actions := da.aq.actions()
+	if len(actions) != 3 {
+		t.Fatalf("bad actions: %+v", actions)
+	}
+	if a := actions[0]; a.updExpr != "SET #FirstName = :v0, #Avatar = :v1 REMOVE #Nickname" || *a.keys["ID"].N != "1" || *a.values[":v0"].S != "Jane" {
+		t.Fatalf("bad update: %+v", a)
+	}
+	if a := actions[2]; len(a.keys) != 1 || *a.keys["ID"].N != "2" {
+		t.Fatalf("bad delete: %+v", a)
+	}
+}
+
+func TestTypedMigration(t *testing.T) {
+	var scan map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.DescribeTable":
+			w.Write([]byte(`{"Table":{"TableName":"users","KeySchema":[{"AttributeName":"ID","KeyType":"HASH"},{"AttributeName":"Org","KeyType":"RANGE"}]}}`))
+		case "DynamoDB_20120810.Scan":
+			b, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(b, &scan)
+			w.Write([]byte(`{"Items":[{"ID":{"N":"1"},"Org":{"S":"o"},"FirstName":{"S":"Jane"}}],"Count":1,"ScannedCount":1}`))
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL)}
+	var users []testModelUser
+	m := NewTypedMigration(1, "users", "typed", func(u testModelUser, action *DrifterAction) error {
+		users = append(users, u)
+		return nil
+	})
+	m.Idempotent = true
+	da := dd.newDrifterAction(m)
+	dd.scanSegment(context.Background(), m, da, 0, 1, 1, 10, true, nil, make(chan struct{}, 1), func(n uint, errs []error, fatal bool) {
+		if len(errs) != 0 {
+			t.Fatalf("errors scanning: %v", errs)
+		}
+	})
+	if len(users) != 1 || users[0].ID != 1 || users[0].FirstName != "Jane" {
+		t.Fatalf("bad items: %+v", users)
+	}
+	if scan["ProjectionExpression"] == nil {
+		t.Fatalf("scan has no projection: %v", scan)
+	}
+	projected := map[string]bool{}
+	for _, name := range scan["ExpressionAttributeNames"].(map[string]interface{}) {
+		projected[name.(string)] = true
+	}
+	for _, a := range []string{"ID", "Org", "FirstName", "Address", "Nickname", MarkerAttribute(1)} {
+		if !projected[a] {
+			t.Fatalf("attribute %v is not projected: %v", a, scan)
+		}
+	}
+	if projected["Ignored"] || projected["internal"] {
+		t.Fatalf("attributes which aren't in the model should not be projected: %v", scan)
+	}
+	expr, _, err := dd.projection(context.Background(), &DynamoDrifterMigration{TableName: "users"})
+	if err != nil || expr != "" {
+		t.Fatalf("migrations without model should read whole items: %v, %v", expr, err)
+	}
+}
@@ -0,0 +1,41 @@
+package drift
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotApplied is returned (wrapped) by Undo for migrations without a meta table record
+var ErrNotApplied = errors.New("migration is not applied")
+
+// ErrNotLatest is returned (wrapped) by Undo for migrations applied before other applied migrations, unless DynamoDrifter.ForceUndo is set
+var ErrNotLatest = errors.New("migration is not the most recently applied")
+
+// checkUndo returns an error if undoMigration can't be undone: it must have a meta table record, completed or in progress (ex: an
+// interrupted run), and a completed record must be the most recently applied migration unless dd.ForceUndo is set. Records are ordered by
+// AppliedAt, or by Number if either lacks it (older records).
+func (dd *DynamoDrifter) checkUndo(undoMigration *DynamoDrifterMigration) error {
+	rec, err := dd.getMetaItem(undoMigration.Number)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return fmt.Errorf("%w: migration %v has no meta table record", ErrNotApplied, undoMigration.Number)
+	}
+	if dd.ForceUndo || rec.InProgress {
+		return nil
+	}
+	applied, err := dd.Applied()
+	if err != nil {
+		return fmt.Errorf("error getting applied migrations: %v", err)
+	}
+	for _, m := range applied {
+		if m.Number == rec.Number {
+			continue
+		}
+		if m.AppliedAt != nil && rec.AppliedAt != nil && m.AppliedAt.After(*rec.AppliedAt) || (m.AppliedAt == nil || rec.AppliedAt == nil) && m.Number > rec.Number {
+			return fmt.Errorf("%w: migration %v was applied after migration %v", ErrNotLatest, m.Number, rec.Number)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUndoChecks(t *testing.T) {
+	records := map[string]string{
+		"1": `{"Number":{"N":"1"},"TableName":{"S":"foo"},"AppliedAt":{"S":"2026-01-02T00:00:00Z"}}`,
+		"2": `{"Number":{"N":"2"},"TableName":{"S":"foo"},"AppliedAt":{"S":"2026-01-01T00:00:00Z"}}`,
+		"3": `{"Number":{"N":"3"},"TableName":{"S":"foo"},"InProgress":{"BOOL":true}}`,
+	}
+	scans := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+		case "ListTables":
+			w.Write([]byte(`{"TableNames":["foo"]}`))
+		case "GetItem":
+			for n, rec := range records {
+				if strings.Contains(string(b), `"N":"`+n+`"`) {
+					w.Write([]byte(`{"Item":` + rec + `}`))
+					return
+				}
+			}
+			w.Write([]byte(`{}`))
+		case "Scan":
+			if strings.Contains(string(b), `"migrations"`) {
+				w.Write([]byte(`{"Items":[` + records["1"] + `,` + records["2"] + `,` + records["3"] + `]}`))
+				return
+			}
+			scans++
+			w.Write([]byte(`{"Items":[],"Count":0,"ScannedCount":0}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{DynamoDB: getTestHTTPDDBClient(srv.URL), MetaTableName: "migrations"}
+	ctx := context.Background()
+	undo := func(number uint) []error {
+		return dd.Undo(ctx, &DynamoDrifterMigration{Number: number, TableName: "foo", Callback: testMigrateDown}, 1, false, nil)
+	}
+	if errs := undo(4); len(errs) != 1 || !errors.Is(errs[0], ErrNotApplied) || scans != 0 {
+		t.Fatalf("undo of a migration without record should fail: %v", errs)
+	}
+	if errs := undo(2); len(errs) != 1 || !errors.Is(errs[0], ErrNotLatest) || scans != 0 {
+		t.Fatalf("undo of a migration applied before another should fail: %v", errs)
+	}
+	// 1 was applied last, and 3 is an interrupted run
+	for _, n := range []uint{1, 3} {
+		if errs := undo(n); len(errs) != 0 {
+			t.Fatalf("error undoing migration %v: %v", n, errs)
+		}
+	}
+	dd.ForceUndo = true
+	if errs := undo(2); len(errs) != 0 || scans != 3 {
+		t.Fatalf("forced undo should run: %v (%v scans)", errs, scans)
+	}
+	if errs := undo(4); len(errs) != 1 || !errors.Is(errs[0], ErrNotApplied) {
+		t.Fatalf("forced undo of a migration without record should fail: %v", errs)
+	}
+}
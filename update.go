@@ -0,0 +1,132 @@
+package drift
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// UpdateBuilder builds an update of a single item, generating its update expression, names and values. Ex:
+//
+//	da.UpdateItem(keys, "").Set("Name", "foo").Remove("Legacy").Add("Count", 1).If("attribute_exists(ID)", nil).Queue()
+//
+// Attributes are top-level attribute names (placeholders are generated for all of them, so reserved words are fine). Values are marshaled
+// with dynamodbattribute unless they are raw *dynamodb.AttributeValue. Errors (ex: values which can't be marshaled) are returned by Queue.
+type UpdateBuilder struct {
+	da        *DrifterAction
+	keys      interface{}
+	tableName string
+	clauses   map[string][]string
+	names     expressionNames
+	values    map[string]*dynamodb.AttributeValue
+	cond      string
+	err       error
+}
+
+// UpdateItem returns a builder of an update of the item with keys (see Update) in tableName (optional, defaults to migration table)
+func (da *DrifterAction) UpdateItem(keys interface{}, tableName string) *UpdateBuilder {
+	return &UpdateBuilder{
+		da:        da,
+		keys:      keys,
+		tableName: tableName,
+		clauses:   map[string][]string{},
+		names:     expressionNames{},
+		values:    map[string]*dynamodb.AttributeValue{},
+	}
+}
+
+// value adds a value (marshaled unless it is a raw *dynamodb.AttributeValue), returning its placeholder
+func (ub *UpdateBuilder) value(attr string, v interface{}) string {
+	av, ok := v.(*dynamodb.AttributeValue)
+	if !ok {
+		var err error
+		av, err = dynamodbattribute.Marshal(v)
+		if err != nil && ub.err == nil {
+			ub.err = fmt.Errorf("error marshaling value of %v: %v", attr, err)
+		}
+	}
+	p := uniqueValue(ub.values, ":v"+strconv.Itoa(len(ub.values)))
+	ub.values[p] = av
+	return p
+}
+
+// Set sets attr to v
+func (ub *UpdateBuilder) Set(attr string, v interface{}) *UpdateBuilder {
+	ub.clauses["SET"] = append(ub.clauses["SET"], ub.names.placeholder(attr)+" = "+ub.value(attr, v))
+	return ub
+}
+
+// Remove removes attrs
+func (ub *UpdateBuilder) Remove(attrs ...string) *UpdateBuilder {
+	for _, attr := range attrs {
+		ub.clauses["REMOVE"] = append(ub.clauses["REMOVE"], ub.names.placeholder(attr))
+	}
+	return ub
+}
+
+// Add adds v to attr, which must be a number or a set (v is then a set of elements to add)
+func (ub *UpdateBuilder) Add(attr string, v interface{}) *UpdateBuilder {
+	ub.clauses["ADD"] = append(ub.clauses["ADD"], ub.names.placeholder(attr)+" "+ub.value(attr, v))
+	return ub
+}
+
+// Delete removes the elements of set v from set attr
+func (ub *UpdateBuilder) Delete(attr string, v interface{}) *UpdateBuilder {
+	ub.clauses["DELETE"] = append(ub.clauses["DELETE"], ub.names.placeholder(attr)+" "+ub.value(attr, v))
+	return ub
+}
+
+// If makes the update conditional: condition is a DynamoDB condition expression whose :values are defined by values (marshaled
+// individually) and which may use #names generated for attributes of the update. Updates whose condition fails are skipped.
+// Calling If again replaces the condition.
+func (ub *UpdateBuilder) If(condition string, values map[string]interface{}) *UpdateBuilder {
+	ub.cond = condition
+	for p, v := range values {
+		if _, ok := ub.values[p]; ok && ub.err == nil {
+			ub.err = fmt.Errorf("condition value %v is already defined", p)
+		}
+		av, err := dynamodbattribute.Marshal(v)
+		if err != nil && ub.err == nil {
+			ub.err = fmt.Errorf("error marshaling condition value %v: %v", p, err)
+		}
+		ub.values[p] = av
+	}
+	return ub
+}
+
+// Expression returns the generated update expression
+func (ub *UpdateBuilder) Expression() string {
+	clauses := []string{}
+	for _, c := range []string{"SET", "REMOVE", "ADD", "DELETE"} {
+		if len(ub.clauses[c]) > 0 {
+			clauses = append(clauses, c+" "+strings.Join(ub.clauses[c], ", "))
+		}
+	}
+	return strings.Join(clauses, " ")
+}
+
+// Queue queues the update
+func (ub *UpdateBuilder) Queue() error {
+	if ub.err != nil {
+		return ub.err
+	}
+	expr := ub.Expression()
+	if expr == "" {
+		return fmt.Errorf("update has no clauses")
+	}
+	mkeys, err := ub.da.marshalKeys(ub.keys)
+	if err != nil {
+		return err
+	}
+	return ub.da.queueUpdate(mkeys, ub.values, expr, ub.names, ub.cond, false, ub.tableName)
+}
+
+// Increment queues an atomic increment of number attribute attr of the item with keys (see Update) by delta (which may be negative) in
+// tableName (optional, defaults to migration table). A missing attribute counts as 0. Unlike reading the item in the callback and
+// writing the new value, concurrent writes (ex: by live traffic) aren't lost.
+func (da *DrifterAction) Increment(keys interface{}, attr string, delta int64, tableName string) error {
+	return da.UpdateItem(keys, tableName).Add(attr, delta).Queue()
+}
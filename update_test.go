@@ -0,0 +1,56 @@
+package drift
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestUpdateBuilder(t *testing.T) {
+	da := &DrifterAction{}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	ub := da.UpdateItem(keys, "other").
+		Set("Name", "foo").
+		Set("first-name", "bar").
+		Remove("Legacy", "Data").
+		Add("Count", 1).
+		Delete("Tags", []string{"a"}).
+		If("attribute_exists(Name) AND Count < :max", map[string]interface{}{":max": 10})
+	if e := ub.Expression(); e != "SET #Name = :v0, #firstname = :v1 REMOVE #Legacy, #Data ADD #Count :v2 DELETE #Tags :v3" {
+		t.Fatalf("bad expression: %v", e)
+	}
+	if err := ub.Queue(); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	a := da.aq.actions()[0]
+	if a.condExpr != "attribute_exists(#Name) AND #Count < :max" || a.tableName != "other" {
+		t.Fatalf("bad condition: %v", a.condExpr)
+	}
+	if *a.expAttrNames["#firstname"] != "first-name" || *a.values[":v0"].S != "foo" || *a.values[":max"].N != "10" || len(a.values[":v3"].L) != 1 {
+		t.Fatalf("bad names or values: %v %v", a.expAttrNames, a.values)
+	}
+	if err := da.UpdateItem(keys, "").Queue(); err == nil || !strings.Contains(err.Error(), "no clauses") {
+		t.Fatalf("empty update should fail: %v", err)
+	}
+	err := da.UpdateItem(keys, "").Set("Name", "foo").If("Name <> :v0", map[string]interface{}{":v0": "bar"}).Queue()
+	if err == nil || !strings.Contains(err.Error(), ":v0 is already defined") {
+		t.Fatalf("colliding condition value should fail: %v", err)
+	}
+	if len(da.aq.actions()) != 1 {
+		t.Fatalf("failed updates should not be queued")
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	da := &DrifterAction{}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	if err := da.Increment(keys, "Count", -2, "counters"); err != nil {
+		t.Fatalf("error queuing increment: %v", err)
+	}
+	a := da.aq.actions()[0]
+	if a.updExpr != "ADD #Count :v0" || *a.expAttrNames["#Count"] != "Count" || *a.values[":v0"].N != "-2" || a.tableName != "counters" {
+		t.Fatalf("bad increment: %v %v %v", a.updExpr, a.expAttrNames, a.values)
+	}
+}
@@ -0,0 +1,119 @@
+package drift
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// VersionAttribute is the item attribute containing the schema version of an item (a number). Items without it are version 0.
+const VersionAttribute = "_v"
+
+// expression placeholders used for VersionAttribute in scan filters and update expressions
+const (
+	versionName  = "#drift_v"
+	versionValue = ":drift_v"
+)
+
+// ErrFutureItem is returned (wrapped) for items with a schema version greater than the one a migration upgrades to, see RejectFutureItems
+var ErrFutureItem = errors.New("item is from a future schema version")
+
+// ItemVersion returns the schema version of item
+func ItemVersion(item RawDynamoItem) (uint, error) {
+	v, ok := item[VersionAttribute]
+	if !ok {
+		return 0, nil
+	}
+	if v.N == nil {
+		return 0, fmt.Errorf("%v attribute is not a number", VersionAttribute)
+	}
+	n, err := strconv.ParseUint(*v.N, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad %v attribute: %v", VersionAttribute, err)
+	}
+	return uint(n), nil
+}
+
+// SetItemVersion sets the schema version of item
+func SetItemVersion(item RawDynamoItem, version uint) {
+	item[VersionAttribute] = versionAttributeValue(version)
+}
+
+// BelowVersion returns whether the schema version of item is less than version
+func BelowVersion(item RawDynamoItem, version uint) (bool, error) {
+	v, err := ItemVersion(item)
+	if err != nil {
+		return false, err
+	}
+	return v < version, nil
+}
+
+func versionAttributeValue(version uint) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatUint(uint64(version), 10))}
+}
+
+// FutureItemPolicy determines what a versioned migration does with items whose schema version is greater than Versioning.Version
+type FutureItemPolicy int
+
+// Future item policies
+const (
+	SkipFutureItems    FutureItemPolicy = iota // Items are skipped (the default)
+	RejectFutureItems                          // Items are callback errors (wrapping ErrFutureItem)
+	MigrateFutureItems                         // Items are passed to the callback, ex: for undo migrations downgrading items
+)
+
+// Versioning makes a migration upgrade items to a schema version (see VersionAttribute), allowing a read vN/write vN+1 rollout:
+// only items of other versions are scanned and passed to the callback, and items inserted or updated in the migration table by the
+// migration's actions have their version set to Version.
+// Since items already at Version are skipped, an interrupted versioned migration can be rerun without reprocessing them.
+type Versioning struct {
+	Version uint
+	Future  FutureItemPolicy
+}
+
+// filter returns the scan filter expression selecting the items the migration may process
+func (v *Versioning) filter() (string, map[string]*string, map[string]*dynamodb.AttributeValue) {
+	op := "<"
+	if v.Future != SkipFutureItems {
+		op = "<>"
+	}
+	return fmt.Sprintf("attribute_not_exists(%v) OR %v %v %v", versionName, versionName, op, versionValue),
+		map[string]*string{versionName: aws.String(VersionAttribute)},
+		map[string]*dynamodb.AttributeValue{versionValue: versionAttributeValue(v.Version)}
+}
+
+// admit returns whether item should be passed to the callback, or an error for rejected items
+func (v *Versioning) admit(item RawDynamoItem) (bool, error) {
+	if v == nil {
+		return true, nil
+	}
+	iv, err := ItemVersion(item)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case iv < v.Version:
+		return true, nil
+	case iv == v.Version:
+		return false, nil
+	case v.Future == MigrateFutureItems:
+		return true, nil
+	case v.Future == RejectFutureItems:
+		return false, fmt.Errorf("%w: version %v, migration version %v", ErrFutureItem, iv, v.Version)
+	default:
+		return false, nil
+	}
+}
+
+// bumpItem returns a copy of item with its version set (the attribute values are shared with item)
+func (v *Versioning) bumpItem(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	return withAttribute(item, VersionAttribute, versionAttributeValue(v.Version))
+}
+
+// bumpUpdate adds setting the version to an update expression, see addSetClause
+func (v *Versioning) bumpUpdate(expr string, values map[string]*dynamodb.AttributeValue, names map[string]*string) (string, map[string]*dynamodb.AttributeValue, map[string]*string) {
+	return addSetClause(expr, values, names, versionName, versionValue, VersionAttribute, versionAttributeValue(v.Version))
+}
@@ -0,0 +1,97 @@
+package drift
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestItemVersion(t *testing.T) {
+	item := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	if v, err := ItemVersion(item); err != nil || v != 0 {
+		t.Fatalf("unversioned item should be version 0: %v, %v", v, err)
+	}
+	SetItemVersion(item, 3)
+	if v, err := ItemVersion(item); err != nil || v != 3 {
+		t.Fatalf("bad version: %v, %v", v, err)
+	}
+	if below, _ := BelowVersion(item, 4); !below {
+		t.Fatalf("item should be below version 4")
+	}
+	if below, _ := BelowVersion(item, 3); below {
+		t.Fatalf("item should not be below version 3")
+	}
+	item[VersionAttribute] = &dynamodb.AttributeValue{S: aws.String("3")}
+	if _, err := ItemVersion(item); err == nil {
+		t.Fatalf("string version should fail")
+	}
+}
+
+func TestVersioningAdmit(t *testing.T) {
+	item := func(v uint) RawDynamoItem {
+		i := RawDynamoItem{}
+		SetItemVersion(i, v)
+		return i
+	}
+	cases := []struct {
+		name    string
+		future  FutureItemPolicy
+		version uint
+		ok      bool
+		err     error
+	}{
+		{"older", SkipFutureItems, 1, true, nil},
+		{"current", SkipFutureItems, 2, false, nil},
+		{"future skipped", SkipFutureItems, 3, false, nil},
+		{"future rejected", RejectFutureItems, 3, false, ErrFutureItem},
+		{"future migrated", MigrateFutureItems, 3, true, nil},
+	}
+	for _, c := range cases {
+		v := &Versioning{Version: 2, Future: c.future}
+		ok, err := v.admit(item(c.version))
+		if ok != c.ok || !errors.Is(err, c.err) {
+			t.Fatalf("%v: bad result: %v, %v", c.name, ok, err)
+		}
+	}
+	var v *Versioning
+	if ok, err := v.admit(RawDynamoItem{}); !ok || err != nil {
+		t.Fatalf("unversioned migrations should admit all items")
+	}
+}
+
+func TestVersioningBump(t *testing.T) {
+	da := &DrifterAction{version: &Versioning{Version: 2}, table: "users"}
+	keys := RawDynamoItem{"ID": &dynamodb.AttributeValue{N: aws.String("1")}}
+	values := RawDynamoItem{":n": &dynamodb.AttributeValue{S: aws.String("a")}}
+	if err := da.Update(keys, values, "SET #n = :n REMOVE old", map[string]string{"#n": "Name"}, ""); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	if err := da.Update(keys, values, "REMOVE old", nil, "users"); err != nil {
+		t.Fatalf("error queuing update: %v", err)
+	}
+	if err := da.Insert(keys, ""); err != nil {
+		t.Fatalf("error queuing insert: %v", err)
+	}
+	if err := da.Insert(keys, "other"); err != nil {
+		t.Fatalf("error queuing insert: %v", err)
+	}
+	actions := da.aq.actions()
+	if actions[0].updExpr != "SET #drift_v = :drift_v, #n = :n REMOVE #old" || *actions[0].values[":drift_v"].N != "2" ||
+		*actions[0].expAttrNames["#drift_v"] != VersionAttribute || *actions[0].expAttrNames["#n"] != "Name" {
+		t.Fatalf("bad update: %+v", actions[0])
+	}
+	if actions[1].updExpr != "SET #drift_v = :drift_v REMOVE #old" {
+		t.Fatalf("bad update: %+v", actions[1])
+	}
+	if v, _ := ItemVersion(actions[2].item); v != 2 {
+		t.Fatalf("inserted item should be bumped: %v", actions[2].item)
+	}
+	if _, ok := actions[3].item[VersionAttribute]; ok {
+		t.Fatalf("items inserted in other tables should not be bumped: %v", actions[3].item)
+	}
+	if _, ok := keys[VersionAttribute]; ok || len(values) != 1 {
+		t.Fatalf("caller maps should not be modified")
+	}
+}
@@ -0,0 +1,106 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultWatchInterval is the default polling interval of Watch
+const DefaultWatchInterval = 5 * time.Second
+
+// Watch renders a continuously updating view of running migrations to out until ctx is done, polling their meta table records (and
+// progress snapshots) every interval (defaults to DefaultWatchInterval). On a terminal the view is redrawn in place, otherwise each poll
+// appends a view. Progress and throughput are only shown for runs with progress snapshots (see DynamoDrifter.SnapshotInterval), and
+// staleness for runs with heartbeats. Polling errors are shown in the view, Watch returns nil once ctx is done.
+func (dd *DynamoDrifter) Watch(ctx context.Context, out io.Writer, interval time.Duration) error {
+	if err := checkClient(dd.DynamoDB); err != nil {
+		return err
+	}
+	if interval == 0 {
+		interval = DefaultWatchInterval
+	}
+	tty := isTerminal(out)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var view string
+		ms, err := dd.Running()
+		if err == nil {
+			var statuses []MigrationStatus
+			if statuses, err = dd.statuses(ms); err == nil {
+				view = renderStatuses(statuses, time.Now())
+			}
+		}
+		if err != nil {
+			view = fmt.Sprintf("error polling migrations: %v\n", err)
+		}
+		if tty {
+			fmt.Fprint(out, "\x1b[H\x1b[2J") // clear the screen
+		}
+		fmt.Fprintf(out, "%v  %v\n%v", time.Now().Format("15:04:05"), dd.MetaTableName, view)
+		if !tty {
+			fmt.Fprintln(out)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderStatuses renders the status of running migrations at now as a table, followed by their steps and errors
+func renderStatuses(statuses []MigrationStatus, now time.Time) string {
+	b := &strings.Builder{}
+	if len(statuses) == 0 {
+		b.WriteString("no running migrations\n")
+		return b.String()
+	}
+	w := tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NUMBER\tTABLE\tOWNER\tPHASE\tPROGRESS\tCALLBACKS\tACTIONS\tERRORS\tTHROUGHPUT\tHEARTBEAT")
+	for _, s := range statuses {
+		number := fmt.Sprint(s.Number)
+		owner, phase, progress, throughput, heartbeat := "-", "-", "-", "-", "-"
+		var callbacks, actions, errors uint
+		if hb := s.Heartbeat; hb != nil {
+			if hb.Undo {
+				number += " (undo)"
+			}
+			owner = hb.Owner
+			callbacks, actions, errors = hb.CallbacksProcessed, hb.ActionsExecuted, hb.Errors
+			heartbeat = fmt.Sprintf("%v ago", now.Sub(hb.Last).Round(time.Second))
+			if s.Stale {
+				heartbeat += " STALE"
+			}
+		}
+		actionsCol := fmt.Sprint(actions)
+		if p := s.Progress; p != nil {
+			owner, phase = p.Owner, p.Phase
+			progress = fmt.Sprintf("%.1f%%", p.PercentComplete)
+			callbacks, actions, errors = p.CallbacksProcessed, p.ActionsExecuted, p.CallbackErrors+p.ActionErrors
+			actionsCol = fmt.Sprint(actions)
+			if p.ActionsQueued != 0 {
+				actionsCol = fmt.Sprintf("%v/%v", actions, p.ActionsQueued)
+			}
+			throughput = fmt.Sprintf("%.0f items/s", p.ItemsPerSecond)
+			if p.Phase == PhaseActions {
+				throughput = fmt.Sprintf("%.0f actions/s", p.ActionsPerSecond)
+			}
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", number, s.TableName, owner, phase, progress, callbacks, actionsCol, errors, throughput, heartbeat)
+	}
+	w.Flush()
+	for _, s := range statuses {
+		for _, sp := range s.StepProgress {
+			fmt.Fprintf(b, "migration %v step %v: %v (%v callbacks, %v actions, %v errors)\n", s.Number, sp.Name, sp.Status, sp.CallbacksProcessed, sp.ActionsExecuted, sp.Errors)
+		}
+		if s.Progress != nil && s.Progress.Error != "" {
+			fmt.Fprintf(b, "migration %v error: %v\n", s.Number, s.Progress.Error)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderStatuses(t *testing.T) {
+	now := time.Now()
+	statuses := []MigrationStatus{
+		{
+			DynamoDrifterMigration: DynamoDrifterMigration{
+				Number:    2,
+				TableName: "foo",
+				Heartbeat: &Heartbeat{Owner: "host:1", Undo: true, Last: now.Add(-90 * time.Second), CallbacksProcessed: 5},
+				Progress: &ProgressSnapshot{Owner: "host:1", Phase: PhaseActions, PercentComplete: 75, CallbacksProcessed: 10, ActionsQueued: 8,
+					ActionsExecuted: 4, ActionErrors: 1, ActionsPerSecond: 12, Error: "oops"},
+				StepProgress: []StepProgress{{Name: "backfill", Status: StepCompleted, CallbacksProcessed: 10}},
+			},
+			Stale: true,
+		},
+		{DynamoDrifterMigration: DynamoDrifterMigration{Number: 3, TableName: "bar", InProgress: true}},
+	}
+	view := renderStatuses(statuses, now)
+	lines := strings.Split(strings.TrimSpace(view), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("bad view: %v", view)
+	}
+	if f := strings.Fields(lines[1]); strings.Join(f, " ") != "2 (undo) foo host:1 actions 75.0% 10 4/8 1 12 actions/s 1m30s ago STALE" {
+		t.Fatalf("bad row: %q", lines[1])
+	}
+	if f := strings.Fields(lines[2]); strings.Join(f, " ") != "3 bar - - - 0 0 0 - -" {
+		t.Fatalf("bad row: %q", lines[2])
+	}
+	if lines[3] != "migration 2 step backfill: completed (10 callbacks, 0 actions, 0 errors)" || lines[4] != "migration 2 error: oops" {
+		t.Fatalf("bad details: %q", lines[3:])
+	}
+	if view := renderStatuses(nil, now); view != "no running migrations\n" {
+		t.Fatalf("bad empty view: %q", view)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"no table"}`))
+	}))
+	defer srv.Close()
+	dd := &DynamoDrifter{MetaTableName: "migrations", DynamoDB: getTestHTTPDDBClient(srv.URL)}
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+	out := &bytes.Buffer{}
+	if err := dd.Watch(ctx, out, time.Hour); err != nil {
+		t.Fatalf("error watching: %v", err)
+	}
+	if !strings.Contains(out.String(), "migrations\nerror polling migrations: ") {
+		t.Fatalf("polling error should be shown: %q", out.String())
+	}
+	if err := (&DynamoDrifter{}).Watch(ctx, out, 0); err == nil {
+		t.Fatalf("watch should require a client")
+	}
+}